@@ -0,0 +1,98 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/spf13/pflag"
+)
+
+// the --config file is a JSON object whose keys are the connserver flag names (without the "--"), e.g.
+//
+//	{"router": true, "handshake-timeout": "10s", "listen-backlog": 256, "tls-bundle": ["a.example=a.crt,a.key"]}
+//
+// values use the same syntax as on the command line (durations as strings).  flags given on the
+// command line override values from the file.
+func loadConnServerConfigFile(flags *pflag.FlagSet, fileName string) error {
+	barr, err := os.ReadFile(fileName)
+	if err != nil {
+		return fmt.Errorf("cannot read config file: %w", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(barr))
+	decoder.UseNumber()
+	var configMap map[string]any
+	if err := decoder.Decode(&configMap); err != nil {
+		return fmt.Errorf("invalid config file %q: %w", fileName, err)
+	}
+	keys := make([]string, 0, len(configMap))
+	for key := range configMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var errs []error
+	for _, key := range keys {
+		if err := applyConfigValue(flags, key, configMap[key]); err != nil {
+			errs = append(errs, fmt.Errorf("config file %q, field %q: %w", fileName, key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func applyConfigValue(flags *pflag.FlagSet, key string, val any) error {
+	flag := flags.Lookup(key)
+	if flag == nil || key == "config" {
+		return fmt.Errorf("unknown option")
+	}
+	if flag.Changed {
+		// command line wins
+		return nil
+	}
+	var strVals []string
+	if arrVal, ok := val.([]any); ok {
+		if flag.Value.Type() != "stringArray" {
+			return fmt.Errorf("expected a single %s value, got a list", flag.Value.Type())
+		}
+		for _, elem := range arrVal {
+			strVal, err := configScalarToString(elem)
+			if err != nil {
+				return err
+			}
+			strVals = append(strVals, strVal)
+		}
+	} else {
+		strVal, err := configScalarToString(val)
+		if err != nil {
+			return err
+		}
+		strVals = []string{strVal}
+	}
+	for _, strVal := range strVals {
+		if err := flags.Set(key, strVal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func configScalarToString(val any) (string, error) {
+	switch v := val.(type) {
+	case string:
+		return v, nil
+	case json.Number:
+		return v.String(), nil
+	case bool:
+		if v {
+			return "true", nil
+		}
+		return "false", nil
+	default:
+		return "", fmt.Errorf("unsupported value type %T", val)
+	}
+}
@@ -0,0 +1,205 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+)
+
+// daemon mode (router mode, --daemon).  one connserver per user on this host runs detached from any
+// terminal stream, its listeners, routes and sysinfo loop outlive every upstream.  "wsh connserver
+// --router --daemon" attaches its stdin/stdout as the daemon's upstream (the --resume handshake on the
+// resume socket, with attachUpstreamCommand) and starts the daemon first if there is none.  one upstream
+// is connected at a time: an attach takes over from the current one (whose process then exits) and every
+// route re-authenticates with the new one.  without an upstream the daemon waits for the next attach
+// (for --resume-grace if set, otherwise forever).  while it runs it holds the lock file, and describes
+// itself in the state file next to it
+const attachUpstreamCommand = "attachupstream"
+const daemonStartTimeout = 10 * time.Second
+const daemonAttachRetryInterval = 100 * time.Millisecond
+
+const daemonLockFileBaseName = "connserver-daemon.lock"
+const daemonStateFileBaseName = "connserver-daemon.json"
+const daemonLogFileBaseName = "connserver-daemon.log" // the daemon's stdout/stderr (startup errors, panics, the log without --log-file)
+
+var connServerDaemon bool
+var connServerDaemonChild bool // set on the detached process started by startDaemon
+
+// held for the life of the daemon (released by the os when it exits)
+var connServerDaemonLock wavebase.FDLock
+
+type connServerDaemonState struct {
+	Pid          int    `json:"pid"`
+	Version      string `json:"version"`
+	StartTs      int64  `json:"startts"`
+	ConnName     string `json:"connname"`
+	Socket       string `json:"socket"`
+	ResumeSocket string `json:"resumesocket"`
+	LogFile      string `json:"logfile"`
+}
+
+func daemonLockFileName() string {
+	return filepath.Join(wavebase.RemoteWaveHome, daemonLockFileBaseName)
+}
+
+func daemonStateFileName() string {
+	return filepath.Join(wavebase.RemoteWaveHome, daemonStateFileBaseName)
+}
+
+func daemonLogFileName() string {
+	return filepath.Join(wavebase.RemoteWaveHome, daemonLogFileBaseName)
+}
+
+func readDaemonState() (*connServerDaemonState, error) {
+	barr, err := os.ReadFile(daemonStateFileName())
+	if err != nil {
+		return nil, err
+	}
+	var state connServerDaemonState
+	if err := json.Unmarshal(barr, &state); err != nil {
+		return nil, fmt.Errorf("invalid daemon state file: %w", err)
+	}
+	return &state, nil
+}
+
+// only one daemon runs per user, a second one exits here (before touching the sockets)
+func acquireDaemonLock() error {
+	lock, err := lockDaemonFile(daemonLockFileName())
+	if err != nil {
+		if state, stateErr := readDaemonState(); stateErr == nil {
+			return fmt.Errorf("a connserver daemon is already running (pid %d)", state.Pid)
+		}
+		return fmt.Errorf("cannot lock %q: %w", daemonLockFileName(), err)
+	}
+	connServerDaemonLock = lock
+	return nil
+}
+
+// written once the listeners are up, replaced atomically so a reader never sees a partial file
+func writeDaemonState(connName string) error {
+	state := connServerDaemonState{
+		Pid:          os.Getpid(),
+		Version:      wavebase.WaveVersion,
+		StartTs:      time.Now().UnixMilli(),
+		ConnName:     connName,
+		Socket:       wavebase.GetRemoteDomainSocketName(),
+		ResumeSocket: resumeSocketName(),
+		LogFile:      connServerLogFile,
+	}
+	barr, _ := json.MarshalIndent(state, "", "  ")
+	tmpName := daemonStateFileName() + ".tmp"
+	if err := os.WriteFile(tmpName, barr, 0600); err != nil {
+		return fmt.Errorf("cannot write daemon state file: %w", err)
+	}
+	if err := os.Rename(tmpName, daemonStateFileName()); err != nil {
+		os.Remove(tmpName)
+		return fmt.Errorf("cannot write daemon state file: %w", err)
+	}
+	return nil
+}
+
+// the lock file stays (like the wave lock), only the state file goes
+func removeDaemonState() {
+	if err := os.Remove(daemonStateFileName()); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("cannot remove daemon state file: %v\n", err)
+	}
+}
+
+// re-runs this command detached (see daemonSysProcAttr) with --daemon-child, the jwt is passed
+// through the environment.  the returned channel gets the daemon's exit if it exits
+func startDaemon() (chan error, error) {
+	exePath, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("cannot find the wsh executable: %w", err)
+	}
+	if err := os.MkdirAll(wavebase.RemoteWaveHome, 0700); err != nil {
+		return nil, fmt.Errorf("cannot create %q: %w", wavebase.RemoteWaveHome, err)
+	}
+	outputFile, err := os.OpenFile(daemonLogFileName(), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open the daemon log: %w", err)
+	}
+	defer outputFile.Close()
+	args := append(slices.Clone(os.Args[1:]), "--daemon-child")
+	cmd := exec.Command(exePath, args...)
+	// not the caller's cwd, the daemon would keep it busy
+	cmd.Dir = wavebase.GetHomeDir()
+	cmd.Stdout = outputFile
+	cmd.Stderr = outputFile
+	cmd.SysProcAttr = daemonSysProcAttr()
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("cannot start the connserver daemon: %w", err)
+	}
+	log.Printf("started a connserver daemon (pid %d)\n", cmd.Process.Pid)
+	exitCh := make(chan error, 1)
+	go func() {
+		exitCh <- cmd.Wait()
+	}()
+	return exitCh, nil
+}
+
+// the daemon side of the first attach: it is started without an upstream, so this waits (as long as it
+// takes) for one to attach before the server's own route can authenticate through it
+func waitForFirstUpstream(connName string) (*upstreamStream, error) {
+	resumeListener, err := MakeResumeListener()
+	if err != nil {
+		return nil, fmt.Errorf("cannot create resume listener: %v", err)
+	}
+	trackListener(resumeListener)
+	go runResumeListener(resumeListener, connName)
+	if err := writeDaemonState(connName); err != nil {
+		return nil, err
+	}
+	log.Printf("connserver daemon (pid %d) waiting for an upstream to attach\n", os.Getpid())
+	stream := connServerUpstream.waitForResume(connServerResumeGrace)
+	if stream == nil {
+		return nil, fmt.Errorf("no upstream attached within %v", connServerResumeGrace)
+	}
+	log.Printf("upstream attached (%s)\n", stream.Name)
+	return stream, nil
+}
+
+// --daemon: attaches this process's stdin/stdout to the daemon, starting it if none is running.
+// returns when the upstream ends (either side closes, or another attach took over)
+func runDaemonClient() error {
+	jwtToken, err := getConnServerJwtToken()
+	if err != nil {
+		return err
+	}
+	conn, reader, err := dialUpstreamHandshake(attachUpstreamCommand, jwtToken)
+	if errors.Is(err, errNoUpstreamServer) {
+		log.Printf("no connserver daemon is running, starting one\n")
+		exitCh, startErr := startDaemon()
+		if startErr != nil {
+			return startErr
+		}
+		deadline := time.Now().Add(daemonStartTimeout)
+		for errors.Is(err, errNoUpstreamServer) && time.Now().Before(deadline) {
+			select {
+			case exitErr := <-exitCh:
+				// lost the race to another daemon, or it failed (a second exit is never sent)
+				exitCh = nil
+				log.Printf("the connserver daemon exited (%v), see %s\n", exitErr, daemonLogFileName())
+			case <-time.After(daemonAttachRetryInterval):
+			}
+			conn, reader, err = dialUpstreamHandshake(attachUpstreamCommand, jwtToken)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("cannot attach to the connserver daemon: %w", err)
+	}
+	log.Printf("attached to the connserver daemon\n")
+	pipeStdioUpstream(conn, reader)
+	return nil
+}
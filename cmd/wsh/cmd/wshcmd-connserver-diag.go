@@ -0,0 +1,46 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"log"
+	"runtime"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var diagDumpLock = &sync.Mutex{}
+
+// logs a snapshot of the server state (same data as the introspection rpcs), triggered by SIGUSR1.
+// overlapping requests are skipped, the dump only reads state so it is safe to run at any time
+func dumpConnServerDiagnostics(router *wshutil.WshRouter, rpc *wshutil.WshRpc, serverImpl *wshremote.ServerImpl) {
+	if !diagDumpLock.TryLock() {
+		return
+	}
+	defer diagDumpLock.Unlock()
+	var memStats runtime.MemStats
+	runtime.ReadMemStats(&memStats)
+	log.Printf("[diag] ---- diagnostics dump ----\n")
+	log.Printf("[diag] goroutines:%d quiesced:%v listener-up:%v upstream-up:%v\n", runtime.NumGoroutine(), serverImpl.IsQuiesced(), connServerState.ListenerUp.Load(), connServerState.UpstreamUp.Load())
+	log.Printf("[diag] mem alloc:%d sys:%d heap-objects:%d num-gc:%d\n", memStats.Alloc, memStats.Sys, memStats.HeapObjects, memStats.NumGC)
+	fdInfo := wshremote.GetFdInfo()
+	log.Printf("[diag] fds open:%d soft-limit:%d hard-limit:%d (%.1f%%)\n", fdInfo.Open, fdInfo.SoftLimit, fdInfo.HardLimit, fdInfo.UsedPercent)
+	if rpc != nil {
+		numOutgoing, numIncoming := rpc.GetInFlightCounts()
+		log.Printf("[diag] in-flight requests outgoing:%d incoming:%d\n", numOutgoing, numIncoming)
+	}
+	if router != nil {
+		stats := router.GetRouteStats()
+		log.Printf("[diag] routes:%d totals msgs-in:%d msgs-out:%d dropped:%d\n", len(stats.Routes), stats.Totals.MsgsIn, stats.Totals.MsgsOut, stats.Totals.Dropped)
+		for _, route := range stats.Routes {
+			log.Printf("[diag]   route %q msgs-in:%d bytes-in:%d msgs-out:%d bytes-out:%d dropped:%d\n", route.RouteId, route.MsgsIn, route.BytesIn, route.MsgsOut, route.BytesOut, route.Dropped)
+		}
+	}
+	if sysInfoErr := wshremote.GetSysInfoUnavailableError(); sysInfoErr != "" {
+		log.Printf("[diag] sysinfo unavailable: %s\n", sysInfoErr)
+	}
+	log.Printf("[diag] ---- end diagnostics dump ----\n")
+}
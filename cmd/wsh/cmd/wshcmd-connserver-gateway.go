@@ -0,0 +1,491 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// the gateway (--gateway-addr, router mode) lets external programs call wshrpc without the packet protocol:
+//
+//	POST /v1/rpc  {"command": ..., "route": ..., "data": ..., "timeout": ms}, one json response
+//	              ({"data": ...} or {"error": ...}), or one per line with ?stream=1 (for streaming commands)
+//	GET  /v1/ws   websocket, one rpc message (wshutil.RpcMessage json) per text frame both ways, including
+//	              the eventrecv messages for eventsub
+//
+// every call presents a jwt (Authorization: Bearer <jwt>, or for the websocket, since browsers can't set
+// headers, the subprotocols "wshrpc" and "bearer.<jwt>").  tokens are never taken from the url, it ends up
+// in logs and history.  a websocket from a browser must come from a loopback origin or a --gateway-origin.
+// each token is a regular listener client: it authenticates upstream like any wsh client and gets the
+// route (and scope) its token says.  http calls share one connection per token, closed once it has been
+// idle (no call in flight) for gatewaySessionIdleTimeout
+const gatewaySessionIdleTimeout = 2 * time.Minute
+const gatewayMaxBodyBytes = 8 * 1024 * 1024
+const gatewayDefaultTimeoutMs = 5000
+const gatewayAuthTimeout = 10 * time.Second
+const gatewayWsSubprotocol = "wshrpc"
+const gatewayWsTokenSubprotocolPrefix = "bearer."
+
+type gatewayAddr string
+
+func (a gatewayAddr) Network() string {
+	return "gateway"
+}
+
+func (a gatewayAddr) String() string {
+	return string(a)
+}
+
+// the server side of the in-process connection, reported as a "gateway" transport
+type gatewayConn struct {
+	net.Conn
+	remoteAddr string
+}
+
+func (c *gatewayConn) LocalAddr() net.Addr {
+	return gatewayAddr(connServerGatewayAddr)
+}
+
+func (c *gatewayConn) RemoteAddr() net.Addr {
+	return gatewayAddr(c.remoteAddr)
+}
+
+type gatewayServer struct {
+	router     *wshutil.WshRouter
+	serverImpl *wshremote.ServerImpl
+	lock       sync.Mutex
+	sessions   map[string]*gatewaySession // sha256 of the token => session
+}
+
+type gatewaySession struct {
+	key       string
+	routeId   string
+	rpc       *wshutil.WshRpc
+	conn      net.Conn
+	doneCh    chan struct{} // closed when the connection is gone
+	idleTimer *time.Timer   // runs only while inFlight is 0
+	inFlight  int           // calls using the session, guarded by gatewayServer.lock
+}
+
+// a loopback address only, the tokens are sent in the clear
+func parseGatewayAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("must be a loopback address (e.g. 127.0.0.1:port)")
+	}
+	return nil
+}
+
+// connects an in-process client through the regular listener path and authenticates it.  returns the
+// client side of the connection (authenticated) and its route
+func (gs *gatewayServer) connect(token string, remoteAddr string) (net.Conn, string, error) {
+	if gs.serverImpl.IsQuiesced() {
+		return nil, "", errors.New("server quiescing, not accepting new connections")
+	}
+	clientConn, serverConn := net.Pipe()
+	go handleNewListenerConn(&jwtOnlyConn{Conn: &gatewayConn{Conn: serverConn, remoteAddr: remoteAddr}}, time.Now(), gs.router, gs.serverImpl)
+	reqId := uuid.New().String()
+	authMsg := wshutil.RpcMessage{Command: wshrpc.Command_Authenticate, ReqId: reqId, Data: token}
+	barr, _ := json.Marshal(authMsg)
+	clientConn.SetDeadline(time.Now().Add(gatewayAuthTimeout))
+	if _, err := clientConn.Write(append(barr, '\n')); err != nil {
+		clientConn.Close()
+		return nil, "", fmt.Errorf("sending authenticate: %w", err)
+	}
+	// unbuffered, a bufio.Reader could read past the reply
+	var line []byte
+	oneByte := make([]byte, 1)
+	for {
+		_, err := clientConn.Read(oneByte)
+		if errors.Is(err, io.EOF) {
+			// the reply (with the reason) can be lost when the server closes right after it
+			clientConn.Close()
+			return nil, "", errors.New("authentication failed (connection closed by the server)")
+		}
+		if err != nil {
+			clientConn.Close()
+			return nil, "", fmt.Errorf("reading authenticate reply: %w", err)
+		}
+		if oneByte[0] == '\n' {
+			break
+		}
+		line = append(line, oneByte[0])
+	}
+	clientConn.SetDeadline(time.Time{})
+	var reply wshutil.RpcMessage
+	if err := json.Unmarshal(line, &reply); err != nil {
+		clientConn.Close()
+		return nil, "", fmt.Errorf("invalid authenticate reply: %w", err)
+	}
+	if reply.Error != "" {
+		clientConn.Close()
+		return nil, "", errors.New(reply.Error)
+	}
+	var authRtn wshrpc.CommandAuthenticateRtnData
+	if err := utilfn.ReUnmarshal(&authRtn, reply.Data); err != nil || authRtn.RouteId == "" {
+		clientConn.Close()
+		return nil, "", fmt.Errorf("invalid authenticate reply")
+	}
+	return clientConn, authRtn.RouteId, nil
+}
+
+func gatewaySessionKey(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// returns the live session for key (acquired), nil if there is none.  holds gs.lock
+func (gs *gatewayServer) acquireSessionLocked(key string) *gatewaySession {
+	session := gs.sessions[key]
+	if session == nil {
+		return nil
+	}
+	select {
+	case <-session.doneCh:
+		delete(gs.sessions, key)
+		return nil
+	default:
+	}
+	session.inFlight++
+	session.idleTimer.Stop()
+	return session
+}
+
+// every getSession is paired with a releaseSession once the call (including a whole stream) is done
+func (gs *gatewayServer) releaseSession(session *gatewaySession) {
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+	session.inFlight--
+	if session.inFlight == 0 {
+		session.idleTimer.Reset(gatewaySessionIdleTimeout)
+	}
+}
+
+// connects a new session outside the lock (the authenticate round-trip can take gatewayAuthTimeout), when
+// two calls with the same token race the second one to insert closes its connection and uses the first's
+func (gs *gatewayServer) getSession(token string, remoteAddr string) (*gatewaySession, error) {
+	key := gatewaySessionKey(token)
+	gs.lock.Lock()
+	session := gs.acquireSessionLocked(key)
+	gs.lock.Unlock()
+	if session != nil {
+		return session, nil
+	}
+	conn, routeId, err := gs.connect(token, remoteAddr)
+	if err != nil {
+		return nil, err
+	}
+	gs.lock.Lock()
+	defer gs.lock.Unlock()
+	if session := gs.acquireSessionLocked(key); session != nil {
+		conn.Close()
+		return session, nil
+	}
+	inputCh := make(chan []byte, wshutil.DefaultInputChSize)
+	outputCh := make(chan []byte, wshutil.DefaultOutputChSize)
+	session = &gatewaySession{key: key, routeId: routeId, conn: conn, doneCh: make(chan struct{}), inFlight: 1}
+	go func() {
+		defer panichandler.PanicHandler("gateway:AdaptOutputChToStream")
+		wshutil.AdaptOutputChToStream(outputCh, conn)
+	}()
+	go func() {
+		defer panichandler.PanicHandler("gateway:AdaptStreamToMsgCh")
+		defer close(session.doneCh)
+		defer conn.Close()
+		wshutil.AdaptStreamToMsgCh(conn, inputCh)
+	}()
+	session.rpc = wshutil.MakeWshRpc(inputCh, outputCh, wshrpc.RpcContext{}, nil)
+	session.idleTimer = time.AfterFunc(gatewaySessionIdleTimeout, func() { gs.closeIdleSession(session) })
+	session.idleTimer.Stop()
+	gs.sessions[key] = session
+	log.Printf("[gateway] http session for route %q connected\n", routeId)
+	return session, nil
+}
+
+func (gs *gatewayServer) closeIdleSession(session *gatewaySession) {
+	gs.lock.Lock()
+	if session.inFlight > 0 {
+		// acquired after the timer fired
+		gs.lock.Unlock()
+		return
+	}
+	if gs.sessions[session.key] == session {
+		delete(gs.sessions, session.key)
+	}
+	gs.lock.Unlock()
+	session.conn.Close()
+	log.Printf("[gateway] http session for route %q closed (idle)\n", session.routeId)
+}
+
+// the Authorization header, or (allowSubprotocol, for the websocket) a "bearer.<jwt>" subprotocol
+func getGatewayToken(r *http.Request, allowSubprotocol bool) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if allowSubprotocol {
+		for _, protocol := range websocket.Subprotocols(r) {
+			if token, ok := strings.CutPrefix(protocol, gatewayWsTokenSubprotocolPrefix); ok {
+				return token
+			}
+		}
+	}
+	return ""
+}
+
+// an origin for --gateway-origin, scheme://host[:port] as a browser sends it
+func parseGatewayOrigin(origin string) error {
+	originUrl, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+	if originUrl.Scheme == "" || originUrl.Host == "" || (originUrl.Path != "" && originUrl.Path != "/") || originUrl.RawQuery != "" {
+		return fmt.Errorf("must be scheme://host[:port]")
+	}
+	return nil
+}
+
+// no Origin is a non-browser client (it can set the Authorization header anyway), a browser page must be
+// served from a loopback host or be allowed with --gateway-origin
+func checkGatewayOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range connServerGatewayOrigins {
+		if strings.EqualFold(strings.TrimSuffix(allowed, "/"), origin) {
+			return true
+		}
+	}
+	originUrl, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	host := originUrl.Hostname()
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+type gatewayRpcRequest struct {
+	Command string `json:"command"`
+	Route   string `json:"route,omitempty"`
+	Data    any    `json:"data,omitempty"`
+	Timeout int    `json:"timeout,omitempty"` // ms, defaults to 5s
+}
+
+type gatewayRpcResponse struct {
+	Data  any    `json:"data,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+func writeGatewayJson(w http.ResponseWriter, status int, resp gatewayRpcResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (gs *gatewayServer) handleRpc(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeGatewayJson(w, http.StatusMethodNotAllowed, gatewayRpcResponse{Error: "use POST"})
+		return
+	}
+	token := getGatewayToken(r, false)
+	if token == "" {
+		writeGatewayJson(w, http.StatusUnauthorized, gatewayRpcResponse{Error: "no token (Authorization: Bearer <jwt>)"})
+		return
+	}
+	var req gatewayRpcRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, gatewayMaxBodyBytes)).Decode(&req); err != nil {
+		writeGatewayJson(w, http.StatusBadRequest, gatewayRpcResponse{Error: fmt.Sprintf("invalid request: %v", err)})
+		return
+	}
+	if req.Command == "" {
+		writeGatewayJson(w, http.StatusBadRequest, gatewayRpcResponse{Error: "no command"})
+		return
+	}
+	if req.Command == wshrpc.Command_Authenticate || req.Command == wshrpc.Command_Dispose {
+		writeGatewayJson(w, http.StatusBadRequest, gatewayRpcResponse{Error: fmt.Sprintf("command %q is not allowed through the gateway", req.Command)})
+		return
+	}
+	if req.Timeout <= 0 {
+		req.Timeout = gatewayDefaultTimeoutMs
+	}
+	session, err := gs.getSession(token, r.RemoteAddr)
+	if err != nil {
+		writeGatewayJson(w, http.StatusUnauthorized, gatewayRpcResponse{Error: err.Error()})
+		return
+	}
+	defer gs.releaseSession(session)
+	handler, err := session.rpc.SendComplexRequest(req.Command, req.Data, &wshrpc.RpcOpts{Route: req.Route, Timeout: req.Timeout})
+	if err != nil {
+		writeGatewayJson(w, http.StatusBadGateway, gatewayRpcResponse{Error: err.Error()})
+		return
+	}
+	if r.URL.Query().Get("stream") != "1" {
+		// the first response, a streaming command is canceled after it
+		defer func() {
+			if !handler.ResponseDone() {
+				handler.SendCancel()
+			}
+		}()
+		data, err := handler.NextResponse()
+		if err != nil {
+			writeGatewayJson(w, http.StatusBadGateway, gatewayRpcResponse{Error: err.Error()})
+			return
+		}
+		writeGatewayJson(w, http.StatusOK, gatewayRpcResponse{Data: data})
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	for !handler.ResponseDone() {
+		select {
+		case <-r.Context().Done():
+			handler.SendCancel()
+			return
+		default:
+		}
+		data, err := handler.NextResponse()
+		if err != nil {
+			encoder.Encode(gatewayRpcResponse{Error: err.Error()})
+			return
+		}
+		if encoder.Encode(gatewayRpcResponse{Data: data}) != nil {
+			handler.SendCancel()
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+var gatewayUpgrader = websocket.Upgrader{
+	ReadBufferSize:   4 * 1024,
+	WriteBufferSize:  32 * 1024,
+	HandshakeTimeout: 5 * time.Second,
+	// a client offering the token as a subprotocol gets "wshrpc" back (never the token's)
+	Subprotocols: []string{gatewayWsSubprotocol},
+	CheckOrigin:  checkGatewayOrigin,
+}
+
+// authenticated before the upgrade (a bad token is a plain 401), then frames are pumped both ways
+func (gs *gatewayServer) handleWs(w http.ResponseWriter, r *http.Request) {
+	if !checkGatewayOrigin(r) {
+		http.Error(w, fmt.Sprintf("origin %q not allowed (see --gateway-origin)", r.Header.Get("Origin")), http.StatusForbidden)
+		return
+	}
+	token := getGatewayToken(r, true)
+	if token == "" {
+		http.Error(w, fmt.Sprintf("no token (Authorization: Bearer <jwt>, or the subprotocols %q and %q)", gatewayWsSubprotocol, gatewayWsTokenSubprotocolPrefix+"<jwt>"), http.StatusUnauthorized)
+		return
+	}
+	conn, routeId, err := gs.connect(token, r.RemoteAddr)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	defer conn.Close()
+	wsConn, err := gatewayUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Printf("[gateway] websocket upgrade failed: %v\n", err)
+		return
+	}
+	defer wsConn.Close()
+	wsConn.SetReadLimit(gatewayMaxBodyBytes)
+	log.Printf("[gateway] websocket for route %q connected\n", routeId)
+	go func() {
+		defer panichandler.PanicHandler("gateway:wsWriteLoop")
+		defer wsConn.Close()
+		reader := bufio.NewReaderSize(conn, 64*1024)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 1 {
+				if wsConn.WriteMessage(websocket.TextMessage, line[:len(line)-1]) != nil {
+					return
+				}
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for {
+		_, message, err := wsConn.ReadMessage()
+		if err != nil {
+			break
+		}
+		var msg wshutil.RpcMessage
+		if err := json.Unmarshal(message, &msg); err != nil {
+			continue
+		}
+		if msg.Command == wshrpc.Command_Authenticate {
+			// the connection is already authenticated, re-authenticating could switch routes
+			continue
+		}
+		barr, _ := json.Marshal(msg) // compacted, the stream is newline delimited
+		if _, err := conn.Write(append(barr, '\n')); err != nil {
+			break
+		}
+	}
+	log.Printf("[gateway] websocket for route %q closed\n", routeId)
+}
+
+func startGatewayServer(addr string, router *wshutil.WshRouter, serverImpl *wshremote.ServerImpl) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("cannot listen on gateway addr %q: %v", addr, err)
+	}
+	connServerGatewayAddr = listener.Addr().String()
+	gs := &gatewayServer{router: router, serverImpl: serverImpl, sessions: make(map[string]*gatewaySession)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/rpc", gs.handleRpc)
+	mux.HandleFunc("/v1/ws", gs.handleWs)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	trackListener(listener)
+	log.Printf("gateway listening on %s\n", connServerGatewayAddr)
+	go func() {
+		defer panichandler.PanicHandler("connserver:gatewayServer")
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed && !errors.Is(err, net.ErrClosed) {
+			log.Printf("gateway server error: %v\n", err)
+		}
+	}()
+	return nil
+}
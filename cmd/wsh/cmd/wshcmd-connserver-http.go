@@ -0,0 +1,98 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+)
+
+// readiness state of the connserver, updated as the upstream and listener come and go
+type connServerStatus struct {
+	NeedsListener bool // only router mode runs a listener
+	UpstreamUp    atomic.Bool
+	ListenerUp    atomic.Bool
+}
+
+var connServerState = &connServerStatus{}
+
+func (s *connServerStatus) isReady() (bool, string) {
+	if !s.UpstreamUp.Load() {
+		return false, "upstream not connected"
+	}
+	if s.NeedsListener && !s.ListenerUp.Load() {
+		return false, "listener not bound"
+	}
+	return true, ""
+}
+
+// optional http server for liveness/readiness probes, served over tcp (--health-addr) and/or
+// a unix socket (--metrics-socket, keeps the endpoints off the network)
+func startConnServerHttpServer(addr string, socketPath string) error {
+	var listeners []net.Listener
+	if addr != "" {
+		listener, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("cannot listen on health addr %q: %v", addr, err)
+		}
+		listeners = append(listeners, listener)
+	}
+	if socketPath != "" {
+		listener, err := makeRestrictedUnixListener(socketPath)
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return fmt.Errorf("cannot listen on metrics socket: %v", err)
+		}
+		listeners = append(listeners, listener)
+	}
+	if len(listeners) == 0 {
+		return nil
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz)
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	for _, listener := range listeners {
+		log.Printf("health server listening on %s:%s\n", listener.Addr().Network(), listener.Addr())
+		go func() {
+			defer panichandler.PanicHandler("connserver:healthServer")
+			err := server.Serve(listener)
+			if err != nil && err != http.ErrServerClosed {
+				log.Printf("health server error: %v\n", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// liveness, the process is up and serving http
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
+
+// readiness, the upstream is connected and (in router mode) the listener is bound
+func handleReadyz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain")
+	ready, reason := connServerState.isReady()
+	if !ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("not ready: " + reason + "\n"))
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte("ok\n"))
+}
@@ -0,0 +1,96 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const (
+	JwtProblem_Missing    = "jwt-missing"
+	JwtProblem_Misspelled = "jwt-misspelled"
+	JwtProblem_Malformed  = "jwt-malformed"
+	JwtProblem_Truncated  = "jwt-truncated"
+)
+
+// a categorized problem with the WAVETERM_JWT env var (the category is stable, for scripted checks)
+type jwtEnvError struct {
+	Category string
+	Msg      string
+}
+
+func (e *jwtEnvError) Error() string {
+	return e.Msg
+}
+
+const jwtEnvHint = "it is normally set by wave when it starts the connserver over an ssh/wsl connection, connserver is not meant to be started by hand"
+
+var nonAlnumRe = regexp.MustCompile(`[^A-Z0-9]`)
+
+// env vars that look like an attempt at WAVETERM_JWT (wrong case, missing underscore, WAVE_JWT, ...)
+func findMisspelledJwtVars(environ []string) []string {
+	var rtn []string
+	for _, envVar := range environ {
+		name, _, _ := strings.Cut(envVar, "=")
+		if name == wshutil.WaveJwtTokenVarName {
+			continue
+		}
+		normalized := nonAlnumRe.ReplaceAllString(strings.ToUpper(name), "")
+		if strings.Contains(normalized, "JWT") && strings.Contains(normalized, "WAVE") {
+			rtn = append(rtn, name)
+		}
+	}
+	return rtn
+}
+
+// a jwt is three non-empty base64url segments, the header and payload must decode to json objects
+func checkJwtFormat(token string) error {
+	varName := wshutil.WaveJwtTokenVarName
+	if strings.TrimSpace(token) != token || strings.Trim(token, `"'`) != token {
+		return &jwtEnvError{Category: JwtProblem_Malformed, Msg: fmt.Sprintf("%s has surrounding whitespace or quotes (check how it is exported)", varName)}
+	}
+	if !strings.HasPrefix(token, "eyJ") {
+		// every jwt header is a base64 encoded json object (starts with `{"`)
+		return &jwtEnvError{Category: JwtProblem_Malformed, Msg: fmt.Sprintf("%s does not look like a jwt", varName)}
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) > 3 {
+		return &jwtEnvError{Category: JwtProblem_Malformed, Msg: fmt.Sprintf("%s is not a jwt (%d segments, expected 3)", varName, len(parts))}
+	}
+	if len(parts) < 3 || parts[2] == "" {
+		return &jwtEnvError{Category: JwtProblem_Truncated, Msg: fmt.Sprintf("%s looks truncated (%d of 3 segments, %d bytes), the value may have been cut off when it was copied or passed through the environment", varName, len(parts), len(token))}
+	}
+	for idx, part := range parts[:2] {
+		decoded, err := base64.RawURLEncoding.DecodeString(part)
+		if err != nil || !strings.HasPrefix(string(decoded), "{") {
+			return &jwtEnvError{Category: JwtProblem_Malformed, Msg: fmt.Sprintf("%s segment %d is not base64 encoded json", varName, idx+1)}
+		}
+		if !strings.HasSuffix(string(decoded), "}") {
+			return &jwtEnvError{Category: JwtProblem_Truncated, Msg: fmt.Sprintf("%s segment %d is incomplete, the token looks truncated", varName, idx+1)}
+		}
+	}
+	return nil
+}
+
+// returns the token from the environment, or a jwtEnvError describing what's wrong with it
+func getConnServerJwtToken() (string, error) {
+	varName := wshutil.WaveJwtTokenVarName
+	token := os.Getenv(varName)
+	if token == "" {
+		if similar := findMisspelledJwtVars(os.Environ()); len(similar) > 0 {
+			return "", &jwtEnvError{Category: JwtProblem_Misspelled, Msg: fmt.Sprintf("no jwt token found for connserver: %s is not set, but found %s (misspelled?), %s", varName, strings.Join(similar, ", "), jwtEnvHint)}
+		}
+		return "", &jwtEnvError{Category: JwtProblem_Missing, Msg: fmt.Sprintf("no jwt token found for connserver: %s is not set, %s", varName, jwtEnvHint)}
+	}
+	if err := checkJwtFormat(token); err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,121 @@
+//go:build linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"sync/atomic"
+
+	"golang.org/x/sys/unix"
+)
+
+// net.FileListener does not support AF_VSOCK, so this is a minimal listener over the raw socket.
+// the fds are non-blocking and wrapped in *os.File so they use the runtime poller (Accept and Close behave like net.Listener).
+type vsockListener struct {
+	file   *os.File
+	addr   *vsockAddr
+	closed atomic.Bool
+}
+
+type vsockAddr struct {
+	CID  uint32
+	Port uint32
+}
+
+func (a *vsockAddr) Network() string {
+	return "vsock"
+}
+
+func (a *vsockAddr) String() string {
+	return fmt.Sprintf("%d:%d", a.CID, a.Port)
+}
+
+type vsockConn struct {
+	*os.File
+	localAddr  *vsockAddr
+	remoteAddr *vsockAddr
+}
+
+func (c *vsockConn) LocalAddr() net.Addr {
+	return c.localAddr
+}
+
+func (c *vsockConn) RemoteAddr() net.Addr {
+	return c.remoteAddr
+}
+
+// cid is usually unix.VMADDR_CID_ANY for a guest accepting connections from the host
+func MakeRemoteVsockListener(cid uint32, port uint32) (net.Listener, error) {
+	fd, err := unix.Socket(unix.AF_VSOCK, unix.SOCK_STREAM|unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("error creating vsock socket (is the vsock module loaded?): %w", err)
+	}
+	err = unix.Bind(fd, &unix.SockaddrVM{CID: cid, Port: port})
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("error binding vsock %d:%d: %w", cid, port, err)
+	}
+	backlog := unix.SOMAXCONN
+	if connServerListenBacklog > 0 {
+		backlog = connServerListenBacklog
+	}
+	err = unix.Listen(fd, backlog)
+	if err != nil {
+		unix.Close(fd)
+		return nil, fmt.Errorf("error listening on vsock %d:%d: %w", cid, port, err)
+	}
+	rtn := &vsockListener{
+		file: os.NewFile(uintptr(fd), fmt.Sprintf("vsock:%d:%d", cid, port)),
+		addr: &vsockAddr{CID: cid, Port: port},
+	}
+	log.Printf("Server [vsock] listening on %s\n", rtn.addr)
+	return rtn, nil
+}
+
+func (l *vsockListener) Accept() (net.Conn, error) {
+	rawConn, err := l.file.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var newFd int
+	var remoteSa unix.Sockaddr
+	var acceptErr error
+	err = rawConn.Read(func(fd uintptr) bool {
+		newFd, remoteSa, acceptErr = unix.Accept4(int(fd), unix.SOCK_NONBLOCK|unix.SOCK_CLOEXEC)
+		// returning false waits for the fd to become readable again
+		return acceptErr != unix.EAGAIN
+	})
+	if l.closed.Load() {
+		return nil, net.ErrClosed
+	}
+	if err != nil {
+		return nil, err
+	}
+	if acceptErr != nil {
+		return nil, acceptErr
+	}
+	conn := &vsockConn{
+		File:       os.NewFile(uintptr(newFd), "vsock-conn"),
+		localAddr:  l.addr,
+		remoteAddr: &vsockAddr{},
+	}
+	if vmSa, ok := remoteSa.(*unix.SockaddrVM); ok {
+		conn.remoteAddr = &vsockAddr{CID: vmSa.CID, Port: vmSa.Port}
+	}
+	return conn, nil
+}
+
+func (l *vsockListener) Close() error {
+	l.closed.Store(true)
+	return l.file.Close()
+}
+
+func (l *vsockListener) Addr() net.Addr {
+	return l.addr
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"net"
+)
+
+func MakeRemoteVsockListener(cid uint32, port uint32) (net.Listener, error) {
+	return nil, errors.New("vsock listeners are only supported on linux")
+}
@@ -0,0 +1,503 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/packetparser"
+	"github.com/wavetermdev/waveterm/pkg/util/ratelog"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// session resume (router mode, --resume-grace).  when the upstream (stdin/stdout, the terminal stream to
+// the main app) closes, the server keeps running detached for the grace: the listener routes stay up and
+// the messages for the upstream are held (up to --resume-buffer-bytes, oldest dropped first).  the main
+// app reconnects by running "wsh connserver --router --resume" over a new terminal stream, that process
+// attaches its stdin/stdout through the resume socket and every route authenticates again with the new
+// upstream (wshutil.ReauthUpstream) before the held messages are written.
+const DefaultResumeBufferBytes = 8 * 1024 * 1024
+const resumeUpstreamCommand = "resumeupstream"
+const resumeHandshakeTimeout = 10 * time.Second
+
+// the route the connserver's own rpc client authenticated as (see setupConnServerRpcClientWithRouter)
+var connServerRouteId string
+
+var errNoUpstreamServer = errors.New("no connserver is accepting upstreams")
+var errUpstreamRefused = errors.New("the connserver refused the upstream")
+
+// next to the domain socket (or pipe), owner-only like it.  only listening with --resume-grace (or --daemon)
+func resumeSocketName() string {
+	return wavebase.GetRemoteDomainSocketName() + ".resume"
+}
+
+// whether a lost upstream is waited for (instead of shutting down)
+func upstreamResumable() bool {
+	return connServerResumeGrace > 0 || connServerDaemonChild
+}
+
+type upstreamStream struct {
+	Name    string
+	Reader  io.Reader
+	Writer  io.Writer
+	CloseFn func()                     // nil for stdio (it can't be closed from here)
+	Jwt     string                     // the jwt a resumed stream authenticates the server's own route with
+	Packets *packetparser.PacketStream // every packet is written through it (see attachPacketStream)
+}
+
+// compression and flow control are negotiated again with every stream (a resume can bring a different
+// app version).  the hello goes out right away, before anything else is written to the stream
+func (s *upstreamStream) attachPacketStream(router *wshutil.WshRouter) {
+	s.Packets = packetparser.MakePacketStream(s.Writer, packetparser.StreamOpts{
+		Compression: connServerUpstreamCompression,
+		Window:      connServerUpstreamWindow,
+		OnCompress: func(algo string, rawBytes int, wireBytes int) {
+			router.RecordRouteCompression(wshutil.UpstreamRoute, int64(rawBytes), int64(wireBytes))
+		},
+		OnHello: func(peer packetparser.HelloData, algo string) {
+			router.SetRouteCompression(wshutil.UpstreamRoute, algo)
+			log.Printf("upstream (%s) negotiated compression %q, flow control window %d\n", s.Name, algo, peer.Window)
+		},
+	})
+	if err := s.Packets.SendHello(); err != nil {
+		ratelog.Printf("error writing to the upstream (%s): %v\n", s.Name, err)
+	}
+}
+
+func (s *upstreamStream) close() {
+	if s.CloseFn != nil {
+		s.CloseFn()
+	}
+}
+
+type upstreamState struct {
+	lock        sync.Mutex
+	router      *wshutil.WshRouter
+	wakeFn      func()          // wakes the upstream writer (LaneWriter.Wake), called without lock
+	stream      *upstreamStream // nil while detached
+	resuming    bool            // re-authenticating, only authenticate commands are written
+	writeFailed bool            // the stream is broken, messages are held until the next one attaches
+	waiting     bool            // detached and accepting a resume (see waitForResume)
+	held        [][]byte
+	heldBytes   int64
+	dropped     int64 // held messages dropped (buffer full) since the upstream was lost
+	resumeCh    chan *upstreamStream
+}
+
+var connServerUpstream = &upstreamState{resumeCh: make(chan *upstreamStream, 1)}
+
+func (u *upstreamState) setStream(stream *upstreamStream) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.stream = stream
+}
+
+func (u *upstreamState) setWakeFn(wakeFn func()) {
+	u.lock.Lock()
+	u.wakeFn = wakeFn
+	stream := u.stream
+	u.lock.Unlock()
+	if stream != nil && stream.Packets != nil {
+		stream.Packets.SetCreditFn(wakeFn)
+	}
+}
+
+// a new stream (or none) changes what the writer may send
+func (u *upstreamState) wakeWriter() {
+	u.lock.Lock()
+	wakeFn := u.wakeFn
+	u.lock.Unlock()
+	if wakeFn != nil {
+		wakeFn()
+	}
+}
+
+// bulk messages wait for the stream's credit, they are held while detached anyway
+func (u *upstreamState) canSendBulk() bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.stream == nil || u.writeFailed || u.stream.Packets == nil {
+		return true
+	}
+	return u.stream.Packets.CanSendBulk()
+}
+
+func (s *upstreamStream) writePacket(msg []byte) error {
+	if s.Packets != nil {
+		return s.Packets.WritePacket(msg)
+	}
+	return packetparser.WritePacket(s.Writer, msg)
+}
+
+// called by the single upstream writer (writeUpstreamPackets).  without --resume-grace (or --daemon) the stream is
+// never detached and write errors are ignored (as the upstream is gone the server is shutting down)
+func (u *upstreamState) writeMessage(msg []byte) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if u.stream != nil && !u.writeFailed && (!u.resuming || wshutil.IsAuthenticateMessage(msg)) {
+		err := u.stream.writePacket(msg)
+		if err == nil || !upstreamResumable() {
+			return
+		}
+		ratelog.Printf("error writing to the upstream (%s): %v\n", u.stream.Name, err)
+		u.writeFailed = true
+		// the reader then ends too, and the upstream is detached
+		u.stream.close()
+	}
+	u.holdLocked(msg)
+}
+
+func (u *upstreamState) holdLocked(msg []byte) {
+	for len(u.held) > 0 && u.heldBytes+int64(len(msg)) > connServerResumeBufferBytes {
+		u.heldBytes -= int64(len(u.held[0]))
+		u.held = u.held[1:]
+		u.dropped++
+	}
+	if int64(len(msg)) > connServerResumeBufferBytes {
+		u.dropped++
+		return
+	}
+	u.held = append(u.held, msg)
+	u.heldBytes += int64(len(msg))
+}
+
+func (u *upstreamState) detach() {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.stream = nil
+	u.resuming = false
+	u.writeFailed = false
+}
+
+// nil if no stream attached within the grace (0 waits forever)
+func (u *upstreamState) waitForResume(grace time.Duration) *upstreamStream {
+	u.lock.Lock()
+	u.waiting = true
+	u.lock.Unlock()
+	var timeoutCh <-chan time.Time
+	if grace > 0 {
+		timer := time.NewTimer(grace)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
+	select {
+	case stream := <-u.resumeCh:
+		return stream
+	case <-timeoutCh:
+	}
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	u.waiting = false
+	select {
+	case stream := <-u.resumeCh:
+		return stream
+	default:
+		return nil
+	}
+}
+
+// the ok reply is written under the lock, so it is the first thing the resuming process reads
+func (u *upstreamState) offerResume(stream *upstreamStream) error {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if !u.waiting {
+		return fmt.Errorf("the upstream is connected, there is nothing to resume")
+	}
+	if err := writeResumeReply(stream.Writer, ""); err != nil {
+		return err
+	}
+	stream.attachPacketStream(u.router)
+	stream.Packets.SetCreditFn(u.wakeFn)
+	u.waiting = false
+	u.stream = stream
+	u.resuming = true
+	u.writeFailed = false
+	u.resumeCh <- stream
+	return nil
+}
+
+// an attach replacing the connected upstream (--daemon): closes it and waits until runUpstream
+// has detached it and waits for a resume
+func (u *upstreamState) takeOver(timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		u.lock.Lock()
+		waiting, stream := u.waiting, u.stream
+		u.lock.Unlock()
+		if waiting {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("the connected upstream did not detach within %v", timeout)
+		}
+		if stream != nil {
+			stream.close()
+		}
+		time.Sleep(daemonAttachRetryInterval)
+	}
+}
+
+// writes the held messages (with the re-issued auth tokens) and goes back to writing directly
+func (u *upstreamState) finishResume(tokenMap map[string]string) (int, int64) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	numHeld, dropped := len(u.held), u.dropped
+	for idx, msg := range u.held {
+		if u.stream == nil || u.writeFailed {
+			break
+		}
+		if err := u.stream.writePacket(wshutil.RemapAuthToken(msg, tokenMap)); err != nil {
+			ratelog.Printf("error writing held messages to the upstream (%s): %v\n", u.stream.Name, err)
+			u.held = u.held[idx:]
+			u.writeFailed = true
+			u.stream.close()
+			return numHeld, dropped
+		}
+	}
+	u.held = nil
+	u.heldBytes = 0
+	u.dropped = 0
+	u.resuming = false
+	return numHeld, dropped
+}
+
+// until the stream ends.  the packet channel closes with the stream, so it isn't the proxy's
+// FromRemoteCh (that outlives a resume).  raw (non-packet) output is ignored
+func readUpstreamStream(stream *upstreamStream, fromRemoteCh chan []byte, parseStats *packetparser.ParseStats) {
+	packetCh := make(chan []byte, wshutil.DefaultOutputChSize)
+	rawCh := make(chan []byte, wshutil.DefaultOutputChSize)
+	go func() {
+		defer panichandler.PanicHandler("readUpstreamStream:parse")
+		// a writer waiting for this stream's credit stops waiting
+		defer stream.Packets.Close()
+		stream.Packets.Parse(stream.Reader, packetCh, rawCh, parseStats)
+	}()
+	go func() {
+		defer panichandler.PanicHandler("readUpstreamStream:raw")
+		for range rawCh {
+			// ignore
+		}
+	}()
+	for msg := range packetCh {
+		fromRemoteCh <- msg
+	}
+}
+
+// reads the upstream until it ends, then shuts down.  with --resume-grace the server first waits
+// (detached) for a --resume process to attach a new upstream, a daemon waits for the next attach
+func runUpstream(stream *upstreamStream, termProxy *wshutil.WshRpcProxy, router *wshutil.WshRouter, parseStats *packetparser.ParseStats) {
+	defer wshutil.GracefulShutdown("", 0, true, connServerShutdownGrace)
+	defer panichandler.PanicHandler("runUpstream")
+	for {
+		readUpstreamStream(stream, termProxy.FromRemoteCh, parseStats)
+		connServerState.UpstreamUp.Store(false)
+		if !upstreamResumable() {
+			return
+		}
+		connServerUpstream.detach()
+		stream.close()
+		if connServerResumeGrace > 0 {
+			wshremote.PublishServerEvent(wshremote.ServerEvent_UpstreamLost, nil, "upstream (%s) closed, keeping routes for %v", stream.Name, connServerResumeGrace)
+		} else {
+			wshremote.PublishServerEvent(wshremote.ServerEvent_UpstreamLost, nil, "upstream (%s) closed, keeping routes until the next attach", stream.Name)
+		}
+		stream = connServerUpstream.waitForResume(connServerResumeGrace)
+		if stream == nil {
+			log.Printf("upstream was not resumed within %v\n", connServerResumeGrace)
+			return
+		}
+		log.Printf("upstream resumed (%s), re-authenticating routes\n", stream.Name)
+		go reauthResumedUpstream(stream, router)
+	}
+}
+
+func reauthResumedUpstream(stream *upstreamStream, router *wshutil.WshRouter) {
+	defer panichandler.PanicHandler("reauthResumedUpstream")
+	result, err := router.ReauthUpstream(map[string]string{connServerRouteId: stream.Jwt})
+	if err != nil {
+		log.Printf("cannot re-authenticate with the resumed upstream: %v\n", err)
+		// detached again, the grace starts over
+		stream.close()
+		return
+	}
+	numHeld, dropped := connServerUpstream.finishResume(result.TokenMap)
+	connServerState.UpstreamUp.Store(true)
+	for _, routeId := range result.Failed {
+		router.ResetRoute(routeId, true)
+	}
+	wshremote.PublishServerEvent(wshremote.ServerEvent_UpstreamResumed, nil, "upstream resumed (%s), %d routes re-authenticated, %d reset, %d held messages sent, %d dropped", stream.Name, len(result.TokenMap), len(result.Failed), numHeld, dropped)
+}
+
+func writeResumeReply(w io.Writer, errStr string) error {
+	barr, _ := json.Marshal(wshutil.RpcMessage{Command: resumeUpstreamCommand, Error: errStr})
+	_, err := w.Write(append(barr, '\n'))
+	return err
+}
+
+func MakeResumeListener() (net.Listener, error) {
+	sockName := resumeSocketName()
+	listener, err := makeRestrictedLocalListener(sockName)
+	if err != nil {
+		return nil, err
+	}
+	if connServerDaemonChild {
+		log.Printf("accepting upstream attaches on %s\n", sockName)
+	} else {
+		log.Printf("accepting upstream resumes on %s (grace %v)\n", sockName, connServerResumeGrace)
+	}
+	return listener, nil
+}
+
+// unlike runListener, the server keeps running when this listener closes
+func runResumeListener(listener net.Listener, connName string) {
+	defer panichandler.PanicHandler("runResumeListener")
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go handleResumeConn(conn, connName)
+	}
+}
+
+// the first line is the resume request (the new upstream's jwt), after the reply the connection
+// carries the upstream's packets both ways.  a daemon's attach request also takes over a connected upstream
+func handleResumeConn(conn net.Conn, connName string) {
+	defer panichandler.PanicHandler("handleResumeConn")
+	conn.SetReadDeadline(time.Now().Add(resumeHandshakeTimeout))
+	reader := bufio.NewReader(conn)
+	stream, takeOver, err := readResumeRequest(reader, connName)
+	if err == nil && takeOver {
+		err = connServerUpstream.takeOver(resumeHandshakeTimeout)
+	}
+	if err == nil {
+		conn.SetReadDeadline(time.Time{})
+		stream.Reader = reader
+		stream.Writer = conn
+		stream.CloseFn = func() { conn.Close() }
+		err = connServerUpstream.offerResume(stream)
+	}
+	if err != nil {
+		log.Printf("rejecting upstream resume: %v\n", err)
+		writeResumeReply(conn, err.Error())
+		conn.Close()
+		return
+	}
+	connServerUpstream.wakeWriter()
+}
+
+// the stream, and whether it takes over a connected upstream (an attach to a daemon)
+func readResumeRequest(reader *bufio.Reader, connName string) (*upstreamStream, bool, error) {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, false, fmt.Errorf("reading resume request: %w", err)
+	}
+	var msg wshutil.RpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		return nil, false, fmt.Errorf("invalid resume request")
+	}
+	takeOver := msg.Command == attachUpstreamCommand
+	if msg.Command != resumeUpstreamCommand && !takeOver {
+		return nil, false, fmt.Errorf("invalid resume request")
+	}
+	if takeOver && !connServerDaemonChild {
+		return nil, false, fmt.Errorf("this connserver is not a daemon (started without --daemon)")
+	}
+	jwtToken, _ := msg.Data.(string)
+	rpcCtx, err := wshutil.ExtractUnverifiedRpcContext(jwtToken)
+	if err != nil {
+		return nil, false, fmt.Errorf("invalid jwt token: %w", err)
+	}
+	if err := wshutil.CheckUnverifiedTokenExpiry(jwtToken); err != nil {
+		return nil, false, fmt.Errorf("invalid jwt token: %w", err)
+	}
+	if rpcCtx.Conn != connName {
+		return nil, false, fmt.Errorf("jwt is for connection %q, this server is %q", rpcCtx.Conn, connName)
+	}
+	name := "resume"
+	if takeOver {
+		name = "attach"
+	}
+	return &upstreamStream{Name: name, Jwt: jwtToken}, takeOver, nil
+}
+
+// sends a resume (or attach) request on the resume socket.  errNoUpstreamServer if nothing is listening,
+// errUpstreamRefused if the server didn't accept it
+func dialUpstreamHandshake(command string, jwtToken string) (net.Conn, *bufio.Reader, error) {
+	conn, err := dialLocalSocket(resumeSocketName(), resumeHandshakeTimeout)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w (%v)", errNoUpstreamServer, err)
+	}
+	reqBytes, _ := json.Marshal(wshutil.RpcMessage{Command: command, Data: jwtToken})
+	if _, err := conn.Write(append(reqBytes, '\n')); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("sending resume request: %w", err)
+	}
+	conn.SetReadDeadline(time.Now().Add(resumeHandshakeTimeout))
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("reading resume reply: %w", err)
+	}
+	var reply wshutil.RpcMessage
+	if err := json.Unmarshal(line, &reply); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("invalid resume reply: %w", err)
+	}
+	if reply.Error != "" {
+		conn.Close()
+		return nil, nil, fmt.Errorf("%w: %s", errUpstreamRefused, reply.Error)
+	}
+	conn.SetReadDeadline(time.Time{})
+	return conn, reader, nil
+}
+
+// until either side closes
+func pipeStdioUpstream(conn net.Conn, reader *bufio.Reader) {
+	defer conn.Close()
+	go func() {
+		defer panichandler.PanicHandler("pipeStdioUpstream:stdin")
+		io.Copy(conn, os.Stdin)
+		conn.Close()
+	}()
+	io.Copy(os.Stdout, reader)
+}
+
+// --resume: hands this process's stdin/stdout to the running connserver (as its new upstream) and
+// pipes until either side closes.  false if there is no detached server to resume, a new server is
+// started instead
+func runResumeClient() (bool, error) {
+	jwtToken, err := getConnServerJwtToken()
+	if err != nil {
+		return false, err
+	}
+	conn, reader, err := dialUpstreamHandshake(resumeUpstreamCommand, jwtToken)
+	if errors.Is(err, errNoUpstreamServer) {
+		log.Printf("no connserver to resume (%v), starting a new one\n", err)
+		return false, nil
+	}
+	if errors.Is(err, errUpstreamRefused) {
+		log.Printf("cannot resume the running connserver: %v\n", err)
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	log.Printf("resumed the running connserver\n")
+	pipeStdioUpstream(conn, reader)
+	return true, nil
+}
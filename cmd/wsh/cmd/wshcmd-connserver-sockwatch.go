@@ -0,0 +1,99 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/ratelog"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const socketWatchInterval = 2 * time.Second
+
+// --watch-socket.  tmpfs cleanup (e.g. of /run/user/$UID) can remove the socket file (or its whole
+// directory) while the listener fd is still open, so new clients can no longer connect.  this polls the
+// socket path (a directory watch dies with the directory) and rebinds a new socket at the same path.
+// the old listener is kept open (closing its accept loop would shut the server down), existing
+// connections are unaffected.
+func startUnixSocketWatch(listener net.Listener, router *wshutil.WshRouter, serverImpl *wshremote.ServerImpl) {
+	serverAddr := listener.Addr().String()
+	origInfo, err := os.Lstat(serverAddr)
+	if err != nil {
+		log.Printf("warning: cannot watch socket %q: %v\n", serverAddr, err)
+		return
+	}
+	go watchUnixSocket(listener, origInfo, router, serverImpl)
+}
+
+func watchUnixSocket(listener net.Listener, origInfo fs.FileInfo, router *wshutil.WshRouter, serverImpl *wshremote.ServerImpl) {
+	defer panichandler.PanicHandler("watchUnixSocket")
+	serverAddr := listener.Addr().String()
+	replacedWarned := false
+	ticker := time.NewTicker(socketWatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		finfo, err := os.Lstat(serverAddr)
+		if err == nil {
+			if !os.SameFile(origInfo, finfo) && !replacedWarned {
+				// not ours anymore (another server bound the path), never clobber it
+				log.Printf("WARNING: socket %q was replaced by another file, new clients will not reach this server\n", serverAddr)
+				replacedWarned = true
+			}
+			continue
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			ratelog.Printf("cannot stat watched socket %q: %v\n", serverAddr, err)
+			continue
+		}
+		log.Printf("WARNING: socket %q was removed while the server was running, rebinding\n", serverAddr)
+		newListener, ok, err := rebindUnixSocket(serverAddr)
+		if !ok {
+			return // shutting down
+		}
+		if err != nil {
+			ratelog.Printf("cannot rebind socket %q (will retry): %v\n", serverAddr, err)
+			continue
+		}
+		// the path belongs to the new listener now, closing the old one must not remove it
+		if unixListener, ok := listener.(*net.UnixListener); ok {
+			unixListener.SetUnlinkOnClose(false)
+		}
+		log.Printf("socket %q re-created\n", serverAddr)
+		go runListener(newListener, router, serverImpl)
+		listener = newListener
+		origInfo, err = os.Lstat(serverAddr)
+		if err != nil {
+			log.Printf("warning: cannot watch re-created socket %q: %v\n", serverAddr, err)
+			return
+		}
+		replacedWarned = false
+	}
+}
+
+// returns ok=false once the listeners are closed (shutdown), so a socket removed by the shutdown is not re-created
+func rebindUnixSocket(serverAddr string) (net.Listener, bool, error) {
+	connServerListenersLock.Lock()
+	defer connServerListenersLock.Unlock()
+	if connServerListenersClosed {
+		return nil, false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(serverAddr), 0700); err != nil {
+		return nil, true, err
+	}
+	newListener, err := makeRestrictedUnixListener(serverAddr)
+	if err != nil {
+		return nil, true, err
+	}
+	connServerListeners = append(connServerListeners, newListener)
+	return newListener, true, nil
+}
@@ -0,0 +1,185 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshremote"
+)
+
+// a certificate + policy served for one SNI hostname.  the certificate can be swapped (ReloadCert),
+// handshakes always load the current one, established connections keep their session.
+type tlsBundle struct {
+	ServerName string // lowercase, may be a wildcard ("*.example.com")
+	CertFile   string
+	KeyFile    string
+	Cert       atomic.Pointer[tls.Certificate]
+	RootDir    string
+	Impl       *wshremote.ServerImpl // nil to use the default impl
+}
+
+type sniBundles struct {
+	Bundles    map[string]*tlsBundle // servername => bundle
+	ReloadLock *sync.Mutex
+}
+
+// loads the key pair and checks the certificate is currently valid
+func loadTlsCert(serverName string, certFile string, keyFile string) (*tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load certificate for %q: %v", serverName, err)
+	}
+	if cert.Leaf == nil {
+		cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0])
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse certificate for %q: %v", serverName, err)
+		}
+	}
+	now := time.Now()
+	if now.Before(cert.Leaf.NotBefore) {
+		return nil, fmt.Errorf("certificate for %q is not valid until %s", serverName, cert.Leaf.NotBefore.Format(time.RFC3339))
+	}
+	if now.After(cert.Leaf.NotAfter) {
+		return nil, fmt.Errorf("certificate for %q expired at %s", serverName, cert.Leaf.NotAfter.Format(time.RFC3339))
+	}
+	return &cert, nil
+}
+
+// parses "servername=certfile,keyfile[,rootdir]"
+func parseTlsBundle(spec string) (*tlsBundle, error) {
+	serverName, files, found := strings.Cut(spec, "=")
+	if !found || serverName == "" {
+		return nil, fmt.Errorf("invalid tls bundle %q (expected servername=certfile,keyfile[,rootdir])", spec)
+	}
+	parts := strings.Split(files, ",")
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid tls bundle %q (expected servername=certfile,keyfile[,rootdir])", spec)
+	}
+	cert, err := loadTlsCert(serverName, parts[0], parts[1])
+	if err != nil {
+		return nil, err
+	}
+	rtn := &tlsBundle{ServerName: strings.ToLower(serverName), CertFile: parts[0], KeyFile: parts[1]}
+	rtn.Cert.Store(cert)
+	if len(parts) == 3 {
+		rtn.RootDir, err = wshremote.ResolveRootDir(parts[2])
+		if err != nil {
+			return nil, fmt.Errorf("invalid root dir for %q: %v", serverName, err)
+		}
+	}
+	return rtn, nil
+}
+
+func makeSniBundles(specs []string) (*sniBundles, error) {
+	rtn := &sniBundles{Bundles: make(map[string]*tlsBundle), ReloadLock: &sync.Mutex{}}
+	for _, spec := range specs {
+		bundle, err := parseTlsBundle(spec)
+		if err != nil {
+			return nil, err
+		}
+		if rtn.Bundles[bundle.ServerName] != nil {
+			return nil, fmt.Errorf("duplicate tls bundle for %q", bundle.ServerName)
+		}
+		rtn.Bundles[bundle.ServerName] = bundle
+	}
+	return rtn, nil
+}
+
+// exact match first, then a wildcard for the parent domain
+func (b *sniBundles) lookup(serverName string) *tlsBundle {
+	serverName = strings.ToLower(strings.TrimSuffix(serverName, "."))
+	if bundle := b.Bundles[serverName]; bundle != nil {
+		return bundle
+	}
+	if _, parent, found := strings.Cut(serverName, "."); found {
+		return b.Bundles["*."+parent]
+	}
+	return nil
+}
+
+// unknown (or missing) SNI fails the handshake
+func (b *sniBundles) getCertificate(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	bundle := b.lookup(hello.ServerName)
+	if bundle == nil {
+		return nil, fmt.Errorf("unknown tls server name %q", hello.ServerName)
+	}
+	return bundle.Cert.Load(), nil
+}
+
+func makeTlsCertInfo(serverName string, cert *tls.Certificate) wshrpc.TlsCertInfo {
+	rtn := wshrpc.TlsCertInfo{ServerName: serverName}
+	if cert.Leaf != nil {
+		rtn.Subject = cert.Leaf.Subject.String()
+		rtn.NotAfter = cert.Leaf.NotAfter.UnixMilli()
+	}
+	return rtn
+}
+
+// re-reads every bundle's cert/key files.  all of them are loaded and validated first, nothing is
+// swapped unless every bundle succeeds (so a half-finished rotation can be retried)
+func (b *sniBundles) reloadCerts() (*wshrpc.CommandReloadCertRtnData, error) {
+	b.ReloadLock.Lock()
+	defer b.ReloadLock.Unlock()
+	newCerts := make(map[string]*tls.Certificate)
+	var errs []error
+	for serverName, bundle := range b.Bundles {
+		cert, err := loadTlsCert(serverName, bundle.CertFile, bundle.KeyFile)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		newCerts[serverName] = cert
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("certificates not reloaded: %w", errors.Join(errs...))
+	}
+	rtn := &wshrpc.CommandReloadCertRtnData{}
+	for serverName, cert := range newCerts {
+		b.Bundles[serverName].Cert.Store(cert)
+		rtn.Certs = append(rtn.Certs, makeTlsCertInfo(serverName, cert))
+	}
+	log.Printf("reloaded %d tls certificate(s)\n", len(rtn.Certs))
+	return rtn, nil
+}
+
+// returns the policy impl for an (already handshaken) tls connection, nil for the default
+func (b *sniBundles) implForConn(conn net.Conn) *wshremote.ServerImpl {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+	bundle := b.lookup(tlsConn.ConnectionState().ServerName)
+	if bundle == nil {
+		return nil
+	}
+	return bundle.Impl
+}
+
+func MakeRemoteTLSListener(addr string, bundles *sniBundles) (net.Listener, error) {
+	if len(bundles.Bundles) == 0 {
+		return nil, fmt.Errorf("no tls bundles configured (see --tls-bundle)")
+	}
+	tcpListener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("error creating tls listener at %v: %v", addr, err)
+	}
+	applyListenBacklog(tcpListener)
+	tlsConfig := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: bundles.getCertificate,
+	}
+	log.Printf("Server [tls] listening on %s (%d server names)\n", tcpListener.Addr(), len(bundles.Bundles))
+	return tls.NewListener(tcpListener, tlsConfig), nil
+}
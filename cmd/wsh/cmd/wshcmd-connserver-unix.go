@@ -0,0 +1,140 @@
+//go:build !windows
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"golang.org/x/sys/unix"
+)
+
+// umask is process wide, so anything else created during the bind is also restricted (never more permissive)
+func listenUnixRestricted(serverAddr string) (net.Listener, error) {
+	oldMask := syscall.Umask(0077)
+	defer syscall.Umask(oldMask)
+	return net.Listen("unix", serverAddr)
+}
+
+func checkSocketMode(serverAddr string) {
+	finfo, err := os.Stat(serverAddr)
+	if err != nil {
+		log.Printf("warning: cannot stat socket %q: %v\n", serverAddr, err)
+		return
+	}
+	if finfo.Mode().Perm()&0077 != 0 {
+		log.Printf("warning: socket %q has permissive mode %v (expected 0700)\n", serverAddr, finfo.Mode().Perm())
+	}
+}
+
+func installDiagnosticsSignalHandler(dumpFn func()) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, syscall.SIGUSR1)
+	go func() {
+		defer panichandler.PanicHandler("connserver:diagsignal")
+		for range sigCh {
+			dumpFn()
+		}
+	}()
+}
+
+// a leftover socket is only removed if it's really a socket and belongs to us (never clobber another user's socket)
+func checkExistingSocketFile(serverAddr string) error {
+	finfo, err := os.Lstat(serverAddr)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot stat existing socket file %q: %w", serverAddr, err)
+	}
+	if finfo.Mode().Type() != fs.ModeSocket {
+		return fmt.Errorf("refusing to replace %q: it exists but is not a socket (mode %v)", serverAddr, finfo.Mode())
+	}
+	statData, ok := finfo.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	if int(statData.Uid) != os.Getuid() {
+		return fmt.Errorf("refusing to replace socket %q: it is owned by uid %d, not the current user (uid %d)", serverAddr, statData.Uid, os.Getuid())
+	}
+	return nil
+}
+
+// go always creates listeners with the kernel's maximum backlog (SOMAXCONN,
+// read from /proc/sys/net/core/somaxconn on linux, kern.ipc.somaxconn on macos/bsd).
+// a net.ListenConfig control function runs before listen() so it cannot change the backlog.
+// calling listen() again on an already listening socket updates its backlog, so we
+// re-issue it with the requested value.  the kernel silently clamps the value to SOMAXCONN.
+func setListenerBacklog(listener net.Listener, backlog int) error {
+	sysListener, ok := listener.(syscall.Conn)
+	if !ok {
+		return fmt.Errorf("listener type %T does not support setting the backlog", listener)
+	}
+	rawConn, err := sysListener.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var listenErr error
+	err = rawConn.Control(func(fd uintptr) {
+		listenErr = syscall.Listen(int(fd), backlog)
+	})
+	if err != nil {
+		return err
+	}
+	return listenErr
+}
+
+// wraps a listening socket inherited from the parent process (--listen-fd), e.g. bound by a privileged
+// supervisor before it dropped privileges and exec'd us
+func MakeFdListener(fd int) (net.Listener, error) {
+	if fd <= 2 {
+		return nil, fmt.Errorf("fd %d is stdin/stdout/stderr, not a listening socket", fd)
+	}
+	acceptConn, err := syscall.GetsockoptInt(fd, syscall.SOL_SOCKET, syscall.SO_ACCEPTCONN)
+	if err != nil {
+		if errors.Is(err, syscall.ENOTSOCK) {
+			return nil, fmt.Errorf("fd %d is not a socket", fd)
+		}
+		return nil, fmt.Errorf("fd %d is not usable as a listener: %w", fd, err)
+	}
+	if acceptConn == 0 {
+		return nil, fmt.Errorf("fd %d is a socket but is not listening (the parent must call listen() before passing it)", fd)
+	}
+	file := os.NewFile(uintptr(fd), fmt.Sprintf("listen-fd-%d", fd))
+	// FileListener dups the fd, the original is closed so it isn't held open twice
+	defer file.Close()
+	listener, err := net.FileListener(file)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create a listener from fd %d: %w", fd, err)
+	}
+	return listener, nil
+}
+
+// a new session, so the daemon doesn't get the terminal's SIGHUP (or its job control signals)
+func daemonSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{Setsid: true}
+}
+
+// released when the file is closed, or by the kernel when the process exits
+func lockDaemonFile(fileName string) (wavebase.FDLock, error) {
+	fd, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := unix.Flock(int(fd.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return fd, nil
+}
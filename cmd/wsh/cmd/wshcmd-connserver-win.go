@@ -0,0 +1,69 @@
+//go:build windows
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/alexflint/go-filemutex"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"golang.org/x/sys/windows"
+)
+
+// windows has no umask, access to the socket file is controlled by the directory ACLs
+func listenUnixRestricted(serverAddr string) (net.Listener, error) {
+	return net.Listen("unix", serverAddr)
+}
+
+func checkSocketMode(serverAddr string) {}
+
+func MakeFdListener(fd int) (net.Listener, error) {
+	return nil, errors.New("--listen-fd is not supported on windows")
+}
+
+// windows has no SIGUSR1
+func installDiagnosticsSignalHandler(dumpFn func()) {}
+
+// windows reports no owner uid (and unix sockets aren't always ModeSocket), only refuse directories
+func checkExistingSocketFile(serverAddr string) error {
+	finfo, err := os.Lstat(serverAddr)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("cannot stat existing socket file %q: %w", serverAddr, err)
+	}
+	if finfo.IsDir() {
+		return fmt.Errorf("refusing to replace %q: it is a directory", serverAddr)
+	}
+	return nil
+}
+
+// winsock fixes the backlog when the socket starts listening (go uses SOMAXCONN), it cannot be changed afterwards
+func setListenerBacklog(listener net.Listener, backlog int) error {
+	return fmt.Errorf("setting the listen backlog is not supported on windows")
+}
+
+// no console, in its own process group so the console's ctrl-c/ctrl-break don't reach it
+func daemonSysProcAttr() *syscall.SysProcAttr {
+	return &syscall.SysProcAttr{CreationFlags: windows.DETACHED_PROCESS | windows.CREATE_NEW_PROCESS_GROUP}
+}
+
+func lockDaemonFile(fileName string) (wavebase.FDLock, error) {
+	m, err := filemutex.New(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.TryLock(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
@@ -4,18 +4,30 @@
 package cmd
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"net"
 	"os"
-	"sync/atomic"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/asyncwriter"
+	"github.com/wavetermdev/waveterm/pkg/util/logfile"
+	"github.com/wavetermdev/waveterm/pkg/util/logring"
+	"github.com/wavetermdev/waveterm/pkg/util/namedpipe"
 	"github.com/wavetermdev/waveterm/pkg/util/packetparser"
+	"github.com/wavetermdev/waveterm/pkg/util/ratelog"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
@@ -32,32 +44,397 @@ var serverCmd = &cobra.Command{
 }
 
 var connServerRouter bool
+var connServerRootDir string
+var connServerHandshakeTimeout time.Duration
+var connServerListenBacklog int
+var connServerSysInfoInclude string
+var connServerHealthAddr string
+var connServerGatewayAddr string
+var connServerGatewayOrigins []string
+var connServerLogBufferBytes int
+var connServerListenVsock string
+var connServerMaxSysInfoErrors int
+var connServerSysInfoJitter float64
+var connServerSysInfoInterval time.Duration
+var connServerSysInfoHistory int
+var connServerSysInfoTimeout time.Duration
+var connServerShutdownFlushDelay time.Duration
+var connServerShutdownGrace time.Duration
+var connServerDrainTimeout time.Duration
+var connServerConnIdleTimeout time.Duration
+var connServerUpstreamInjectTimeout time.Duration
+var connServerUpstreamCompressionStr string
+var connServerUpstreamCompression []string // parsed from --upstream-compression
+var connServerUpstreamWindow int64
+var connServerTracePipeline bool
+var connServerWatchSocket bool
+var connServerMaxInflight int
+var connServerBackpressureHigh int
+var connServerBackpressureLow int
+var connServerCarryRouteStats bool
+var connServerInputFullPolicy string
+var connServerInputFullTimeout time.Duration
+var connServerMaxBufferMemory int64
+var connServerQueueWatermarks wshremote.QueueWatermarkOpts
+var connServerLoadShed wshremote.LoadShedOpts
+var connServerAcceptRate string
+var connServerAcceptRateWait time.Duration
+var connServerExecEnvDeny string
+var connServerRuntimeProbeTools string
+var connServerDeadmanInterval time.Duration
+var connServerLogFile string
+var connServerLogMaxSize int64
+var connServerLogKeep int
+var connServerSysInfoPushUrl string
+var connServerSysInfoPushToken string
+var connServerConfigFile string
+var connServerLogRepeatInterval time.Duration
+var connServerAuthSecretFile string
+var connServerPolicyFile string
+var connServerPolicy *wshutil.CommandPolicy // loaded from --policy
+var connServerLogHandshakes bool
+var connServerMetricsSocket string
+var connServerCommandConcurrency string
+var connServerCommandQueueSize int
+var connServerCommandLimiter *wshutil.CommandLimiter
+var connServerListenTls string
+var connServerListenAddr string
+var connServerListen string
+var connServerResume bool
+var connServerResumeGrace time.Duration
+var connServerResumeBufferBytes int64
+var connServerListenResolved string // the tcp listener's address with the picked port (see MakeRemoteTCPListener)
+var connServerListenFd int
+var connServerTlsBundles []string
+var connServerSniBundles *sniBundles
+
+// selects the ServerImpl for each route from its jwt claims (the global impl, confined by a rootdir claim), set up in serverRunRouter
+var connServerImplFactory wshremote.ServerImplFactory
+var connServerImplRegistry *wshremote.ServerImplRegistry
+
+// closed on shutdown so the accept loops exit (closing a unix listener also removes the socket file)
+var connServerListenersLock = &sync.Mutex{}
+var connServerListeners []net.Listener
+var connServerListenersClosed bool
 
 func init() {
 	serverCmd.Flags().BoolVar(&connServerRouter, "router", false, "run in local router mode")
+	serverCmd.Flags().StringVar(&connServerRootDir, "root-dir", "", "confine remote file operations to this directory")
+	serverCmd.Flags().DurationVar(&connServerConnIdleTimeout, "conn-idle-timeout", 0, "ping a listener client after this long without any message from it, disconnect it if it doesn't answer (0 to disable)")
+	serverCmd.Flags().DurationVar(&connServerHandshakeTimeout, "handshake-timeout", 10*time.Second, "time allowed for a new listener connection to authenticate (0 to disable)")
+	serverCmd.Flags().IntVar(&connServerListenBacklog, "listen-backlog", 0, "accept backlog for the listener (0 = system default SOMAXCONN, clamped to SOMAXCONN, not supported on windows)")
+	serverCmd.Flags().StringVar(&connServerSysInfoInclude, "sysinfo-include", "", fmt.Sprintf("comma separated list of sysinfo subsystems to collect, or \"all\" (%s, defaults to %s)", strings.Join(wshremote.AllSysInfoSubsystems, ", "), strings.Join(wshremote.DefaultSysInfoSubsystems, ", ")))
+	serverCmd.Flags().StringVar(&connServerHealthAddr, "health-addr", "", "address (host:port) to serve /healthz and /readyz on (disabled if empty)")
+	serverCmd.Flags().StringVar(&connServerGatewayAddr, "gateway-addr", "", "router mode, loopback address (host:port) to serve wshrpc over http and websocket on for external programs, calls authenticate with a jwt (disabled if empty)")
+	serverCmd.Flags().IntVar(&connServerLogBufferBytes, "log-buffer-bytes", logring.DefaultMaxBytes, "max bytes of recent log lines kept in memory for logtail (0 to disable)")
+	serverCmd.Flags().StringVar(&connServerListenVsock, "listen-vsock", "", "also accept connections on a vsock, as [cid:]port (linux only, cid defaults to any)")
+	serverCmd.Flags().IntVar(&connServerMaxSysInfoErrors, "max-sysinfo-errors", wshremote.DefaultMaxSysInfoErrors, "consecutive sysinfo collection failures before giving up (0 to never give up)")
+	serverCmd.Flags().IntVar(&connServerListenFd, "listen-fd", -1, "also accept connections on a listening socket inherited from the parent process as this fd number (not supported on windows)")
+	serverCmd.Flags().StringVar(&connServerListenAddr, "listen-addr", "", "listen on this tcp address (host:port, port 0 picks a free port) instead of the domain socket, clients must authenticate with a jwt")
+	serverCmd.Flags().StringVar(&connServerListen, "listen", "", "main listener as a url: unix (the domain socket, or the named pipe on windows, the default) or tcp://host:port (port 0 picks a free port, clients must authenticate with a jwt, the resolved address is advertised upstream)")
+	serverCmd.Flags().DurationVar(&connServerResumeGrace, "resume-grace", 0, "router mode, when the upstream closes keep the routes for this long waiting for a --resume process to attach a new upstream (0 exits right away)")
+	serverCmd.Flags().Int64Var(&connServerResumeBufferBytes, "resume-buffer-bytes", DefaultResumeBufferBytes, "max bytes of upstream messages held while the upstream is lost (the oldest are dropped first)")
+	serverCmd.Flags().BoolVar(&connServerDaemon, "daemon", false, "router mode, run one detached connserver per user on this host that outlives its upstreams, this process attaches its stdin/stdout as the upstream (starting the daemon if none is running, taking over from the attached upstream otherwise)")
+	serverCmd.Flags().BoolVar(&connServerDaemonChild, "daemon-child", false, "the detached daemon process (set by --daemon)")
+	serverCmd.Flags().MarkHidden("daemon-child")
+	serverCmd.Flags().BoolVar(&connServerResume, "resume", false, "router mode, attach this process's stdin/stdout as the upstream of a running connserver that lost its upstream (starts a new server if there is none)")
+	serverCmd.Flags().StringVar(&connServerListenTls, "listen-tls", "", "also accept tls connections on this address (host:port), requires --tls-bundle")
+	serverCmd.Flags().StringArrayVar(&connServerGatewayOrigins, "gateway-origin", nil, "allow gateway websockets from this browser origin, as scheme://host[:port] (repeatable, loopback origins are always allowed)")
+	serverCmd.Flags().StringArrayVar(&connServerTlsBundles, "tls-bundle", nil, "certificate and policy for an SNI server name, as servername=certfile,keyfile[,rootdir] (repeatable, servername may be *.domain)")
+	serverCmd.Flags().IntVar(&connServerSysInfoHistory, "sysinfo-history", wshremote.DefaultSysInfoHistory, fmt.Sprintf("recent sysinfo snapshots to retain for clients backfilling after a reconnect (0 to disable, max %d)", wshremote.MaxSysInfoHistory))
+	serverCmd.Flags().DurationVar(&connServerSysInfoTimeout, "sysinfo-subsystem-timeout", wshremote.DefaultSysInfoSubsystemTimeout, "max time to wait for each sysinfo subsystem per cycle (a subsystem that takes longer is reported as unavailable)")
+	serverCmd.Flags().DurationVar(&connServerSysInfoInterval, "sysinfo-interval", wshremote.DefaultSysInfoInterval, fmt.Sprintf("sysinfo collection interval (%v to %v), 0 disables the periodic collection (on-demand refreshes still work)", wshremote.MinSysInfoInterval, wshremote.MaxSysInfoInterval))
+	serverCmd.Flags().Float64Var(&connServerSysInfoJitter, "sysinfo-jitter", 0, "randomly spread each sysinfo tick by +/- this fraction of the interval (0-0.5)")
+	serverCmd.Flags().DurationVar(&connServerShutdownFlushDelay, "shutdown-flush-delay", 500*time.Millisecond, "max time to wait for pending upstream messages to be written on shutdown")
+	serverCmd.Flags().DurationVar(&connServerShutdownGrace, "shutdown-grace", wshutil.DefaultShutdownGrace, "max total time for a graceful shutdown (signals, stdin close, listener close, shutdown command)")
+	serverCmd.Flags().DurationVar(&connServerDrainTimeout, "drain-timeout", 5*time.Second, "max time to wait on shutdown for the messages queued to listener clients to be written before their connections are force-closed")
+	serverCmd.Flags().StringVar(&connServerSysInfoPushUrl, "sysinfo-push-url", "", "also POST every sysinfo snapshot as JSON to this http(s) endpoint")
+	serverCmd.Flags().StringVar(&connServerSysInfoPushToken, "sysinfo-push-token", "", "bearer token for --sysinfo-push-url")
+	serverCmd.Flags().StringVar(&connServerConfigFile, "config", "", "read options from a JSON file (keys are flag names, command line flags take precedence)")
+	serverCmd.Flags().DurationVar(&connServerLogRepeatInterval, "log-repeat-interval", ratelog.DefaultInterval, "collapse repeated identical error logs into one summary per interval (0 to log every occurrence)")
+	serverCmd.Flags().StringVar(&connServerAuthSecretFile, "auth-secret-file", "", "router mode, also accept listener clients that authenticate with the shared secret in this file (instead of a jwt), these clients have no token scope, only --policy restricts them")
+	serverCmd.Flags().StringVar(&connServerPolicyFile, "policy", "", "router mode, JSON file of rules restricting the commands listener clients may invoke (on top of their token scope), entries are commands, prefixes (\"remotefile*\") or presets (read-only, file-access, exec, forward; only forward allows port forwarding)")
+	serverCmd.Flags().BoolVar(&connServerLogHandshakes, "log-handshakes", false, "log the latency (accept to route registration) of every listener handshake")
+	serverCmd.Flags().StringVar(&connServerMetricsSocket, "metrics-socket", "", "also serve the health endpoints on this unix socket (owner-only access, can be used instead of --health-addr)")
+	serverCmd.Flags().StringVar(&connServerCommandConcurrency, "command-concurrency", "", "per-command limit on concurrently handled requests, e.g. remotestreamfile=4,exec=2")
+	serverCmd.Flags().IntVar(&connServerCommandQueueSize, "command-queue-size", wshutil.DefaultCommandQueueSize, "requests that can wait for a --command-concurrency slot (per command), 0 rejects immediately")
+	serverCmd.Flags().DurationVar(&connServerUpstreamInjectTimeout, "upstream-inject-timeout", 5*time.Second, "max time an upstream message waits for a stalled router before it is dropped (0 waits forever)")
+	serverCmd.Flags().StringVar(&connServerUpstreamCompressionStr, "upstream-compression", strings.Join(packetparser.SupportedCompression, ","), "router mode, comma separated compression algorithms offered on the upstream stream in order of preference, \"none\" to disable (used only if the app supports them too)")
+	serverCmd.Flags().Int64Var(&connServerUpstreamWindow, "upstream-window", packetparser.DefaultCreditWindow, "router mode, bytes the app may send before waiting for this server to catch up, large messages from the app wait on it while small ones go first (0 to disable flow control)")
+	serverCmd.Flags().BoolVar(&connServerTracePipeline, "trace-pipeline", false, "count messages at each stage of the upstream path into the router (router mode, see the pipelinestats command)")
+	serverCmd.Flags().BoolVar(&connServerWatchSocket, "watch-socket", false, "re-create the domain socket if its file is removed while the server is running (router mode)")
+	serverCmd.Flags().IntVar(&connServerMaxInflight, "max-inflight-per-route", 0, "max requests a listener client can have outstanding at once, more fail until some complete (router mode, 0 for no limit)")
+	serverCmd.Flags().IntVar(&connServerBackpressureHigh, "backpressure-high", 0, "outstanding requests at which a listener client is asked to slow down (0 for 80% of --max-inflight-per-route, off if neither is set)")
+	serverCmd.Flags().IntVar(&connServerBackpressureLow, "backpressure-low", 0, "outstanding requests at which a slowed down client is told to resume (0 for half of the high watermark)")
+	serverCmd.Flags().BoolVar(&connServerCarryRouteStats, "carry-route-stats", false, "a client reconnecting with the same instance id keeps the counters of its previous route (router mode)")
+	serverCmd.Flags().StringVar(&connServerInputFullPolicy, "input-full-policy", wshutil.FullChPolicy_Block, "what a listener connection does when the router stops taking its messages for --input-full-timeout: block, disconnect or drop")
+	serverCmd.Flags().DurationVar(&connServerInputFullTimeout, "input-full-timeout", 30*time.Second, "how long a listener connection waits on a full input channel before --input-full-policy applies")
+	serverCmd.Flags().Int64Var(&connServerMaxBufferMemory, "max-buffer-memory", 0, "cap on the bytes queued for all listener clients, over it the server stops reading new messages and sheds low qos routes (router mode, 0 for no limit)")
+	serverCmd.Flags().IntVar(&connServerQueueWatermarks.High, "queue-high-watermark", wshremote.DefaultQueueHighWatermark, "send a queue:high event when a listener client's output queue stays at this depth for --queue-watermark-sustain (router mode, 0 to disable)")
+	serverCmd.Flags().IntVar(&connServerQueueWatermarks.Low, "queue-low-watermark", wshremote.DefaultQueueLowWatermark, "send a queue:recovered event when a flagged client's output queue drops to this depth")
+	serverCmd.Flags().DurationVar(&connServerQueueWatermarks.Sustain, "queue-watermark-sustain", wshremote.DefaultQueueWatermarkSustain, "how long the output queue must stay at the high watermark before the route is flagged")
+	serverCmd.Flags().Float64Var(&connServerLoadShed.MaxCpuPercent, "reject-above-load", 0, "refuse new listener connections while host cpu usage (percent, from the sysinfo collector) is above this (0 to disable)")
+	serverCmd.Flags().Float64Var(&connServerLoadShed.MaxMemPercent, "reject-above-mem", 0, "refuse new listener connections while host memory usage (percent used) is above this (0 to disable)")
+	serverCmd.Flags().StringVar(&connServerAcceptRate, "accept-rate", "", "limit how fast new listener connections are accepted, \"rate[:burst]\" in connections per second (e.g. 20:50, empty for no limit)")
+	serverCmd.Flags().DurationVar(&connServerAcceptRateWait, "accept-rate-wait", wshremote.DefaultAcceptRateWait, "max time a connection over --accept-rate is held before being handled, connections that would wait longer are refused")
+	serverCmd.Flags().StringVar(&connServerExecEnvDeny, "exec-env-deny", "", "comma separated environment variable names (glob patterns, e.g. LD_*,PATH) that exec clients may not set")
+	serverCmd.Flags().StringVar(&connServerRuntimeProbeTools, "runtime-probe-tools", strings.Join(wshremote.DefaultRuntimeProbeTools, ","), "comma separated tools whose versions RuntimeVersions reports (empty to probe none, known: "+strings.Join(wshremote.KnownRuntimeProbeTools(), ",")+")")
+	serverCmd.Flags().DurationVar(&connServerDeadmanInterval, "deadman-interval", 0, "listener clients must send a keepalive at least this often or are disconnected (router mode, clients may ask for a shorter interval, 0 to only enforce what clients ask for)")
+	serverCmd.Flags().StringVar(&connServerLogFile, "log-file", "", "write the server log to this file instead of stderr (handler logs still go to stdout)")
+	serverCmd.Flags().Int64Var(&connServerLogMaxSize, "log-max-size", 0, "rotate --log-file when it would grow past this many bytes (0 to never rotate)")
+	serverCmd.Flags().IntVar(&connServerLogKeep, "log-keep", logfile.DefaultKeep, fmt.Sprintf("rotated log files to keep, as <log-file>.1 (newest) to <log-file>.N (0 discards the old log, max %d)", logfile.MaxKeep))
 	rootCmd.AddCommand(serverCmd)
 }
 
-func MakeRemoteUnixListener() (net.Listener, error) {
-	serverAddr := wavebase.GetRemoteDomainSocketName()
-	os.Remove(serverAddr) // ignore error
-	rtn, err := net.Listen("unix", serverAddr)
+const staleSocketProbeTimeout = time.Second
+const logSinkFlushTimeout = time.Second
+
+// a connect that succeeds (or times out, a full backlog) means another server is accepting on the socket.
+// any other error (refused, gone) means nobody is listening and the socket is stale.
+func probeExistingSocket(serverAddr string) error {
+	conn, err := net.DialTimeout("unix", serverAddr, staleSocketProbeTimeout)
+	if err == nil {
+		conn.Close()
+		return fmt.Errorf("another instance is already running (socket %q is accepting connections)", serverAddr)
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return fmt.Errorf("another instance is already running (connect to socket %q timed out)", serverAddr)
+	}
+	return nil
+}
+
+// owner-only unix socket, replacing a stale socket of ours at the same path (never a live one)
+func makeRestrictedUnixListener(serverAddr string) (net.Listener, error) {
+	if err := checkExistingSocketFile(serverAddr); err != nil {
+		return nil, err
+	}
+	if _, err := os.Lstat(serverAddr); err == nil {
+		if err := probeExistingSocket(serverAddr); err != nil {
+			return nil, err
+		}
+		log.Printf("removing stale socket %q\n", serverAddr)
+	}
+	os.Remove(serverAddr) // ignore error (a stale socket is checked above)
+	rtn, err := listenUnixRestricted(serverAddr)
 	if err != nil {
 		return nil, fmt.Errorf("error creating listener at %v: %v", serverAddr, err)
 	}
+	// socket is already created with 0700 (umask), chmod is kept as a fallback
 	os.Chmod(serverAddr, 0700)
+	checkSocketMode(serverAddr)
+	return rtn, nil
+}
+
+// owner-only named pipe (windows), another server already listening on it is an error (never shared)
+func makeRestrictedPipeListener(pipeName string) (net.Listener, error) {
+	rtn, err := namedpipe.Listen(pipeName)
+	if errors.Is(err, fs.ErrExist) {
+		return nil, fmt.Errorf("another instance is already running (pipe %q is in use)", pipeName)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error creating listener at %v: %v", pipeName, err)
+	}
+	return rtn, nil
+}
+
+// the listener for local wsh clients, at a path from wavebase (a unix socket, or a named pipe on windows)
+func makeRestrictedLocalListener(serverAddr string) (net.Listener, error) {
+	if namedpipe.IsPipePath(serverAddr) {
+		return makeRestrictedPipeListener(serverAddr)
+	}
+	return makeRestrictedUnixListener(serverAddr)
+}
+
+func dialLocalSocket(serverAddr string, timeout time.Duration) (net.Conn, error) {
+	if namedpipe.IsPipePath(serverAddr) {
+		return namedpipe.Dial(serverAddr, timeout)
+	}
+	return net.DialTimeout("unix", serverAddr, timeout)
+}
+
+func MakeRemoteListener() (net.Listener, error) {
+	serverAddr := wavebase.GetRemoteDomainSocketName()
+	rtn, err := makeRestrictedLocalListener(serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	if namedpipe.IsPipePath(serverAddr) {
+		// pipe instances are created per accept, there is no backlog
+		log.Printf("Server [named-pipe] listening on %s\n", serverAddr)
+		return rtn, nil
+	}
+	applyListenBacklog(rtn)
 	log.Printf("Server [unix-domain] listening on %s\n", serverAddr)
 	return rtn, nil
 }
 
-func handleNewListenerConn(conn net.Conn, router *wshutil.WshRouter) {
-	var routeIdContainer atomic.Pointer[string]
+// marks connections accepted on the tcp listener, they have to authenticate with a jwt (see SetRequireJwt)
+type jwtOnlyConn struct {
+	net.Conn
+}
+
+func (c *jwtOnlyConn) NetConn() net.Conn {
+	return c.Conn
+}
+
+type jwtOnlyListener struct {
+	net.Listener
+}
+
+func (l *jwtOnlyListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return &jwtOnlyConn{Conn: conn}, nil
+}
+
+// for setups where the domain socket doesn't work (some windows builds, containers, wsl).  there is no
+// 0700 protection, so every connection has to present a valid jwt before its route is registered.
+// returns the resolved address (the picked port for port 0)
+func MakeRemoteTCPListener(addr string) (net.Listener, string, error) {
+	tcpListener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, "", fmt.Errorf("error creating tcp listener at %v: %v", addr, err)
+	}
+	applyListenBacklog(tcpListener)
+	resolvedAddr := tcpListener.Addr().String()
+	log.Printf("Server [tcp] listening on %s\n", resolvedAddr)
+	return &jwtOnlyListener{Listener: tcpListener}, resolvedAddr, nil
+}
+
+// the tcp address for a --listen url, empty for the domain socket (or named pipe)
+func parseListenUrl(listenUrl string) (string, error) {
+	if listenUrl == "unix" || listenUrl == "unix://" {
+		return "", nil
+	}
+	addr, ok := strings.CutPrefix(listenUrl, "tcp://")
+	if !ok {
+		return "", fmt.Errorf("must be unix or tcp://host:port")
+	}
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return "", err
+	}
+	if host == "" || port == "" {
+		return "", fmt.Errorf("host and port are required")
+	}
+	return addr, nil
+}
+
+const vsockCidAny = 0xFFFFFFFF // VMADDR_CID_ANY
+
+// parses "[cid:]port"
+func parseVsockAddr(addr string) (uint32, uint32, error) {
+	cidStr, portStr, found := strings.Cut(addr, ":")
+	if !found {
+		cidStr, portStr = "", addr
+	}
+	cid := uint64(vsockCidAny)
+	var err error
+	if cidStr != "" {
+		cid, err = strconv.ParseUint(cidStr, 10, 32)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid vsock cid %q", cidStr)
+		}
+	}
+	port, err := strconv.ParseUint(portStr, 10, 32)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid vsock port %q", portStr)
+	}
+	return uint32(cid), uint32(port), nil
+}
+
+func applyListenBacklog(listener net.Listener) {
+	if connServerListenBacklog <= 0 {
+		return
+	}
+	err := setListenerBacklog(listener, connServerListenBacklog)
+	if err != nil {
+		log.Printf("warning: could not set listen backlog to %d: %v\n", connServerListenBacklog, err)
+		return
+	}
+	log.Printf("listen backlog set to %d\n", connServerListenBacklog)
+}
+
+// tracks what was established for a listener connection so the cleanup only tears down what exists
+type listenerConnState struct {
+	lock           *sync.Mutex
+	closed         bool
+	routeId        string
+	registeredTime time.Time
+}
+
+// returns false if the connection already closed (the caller must undo the registration)
+func (cs *listenerConnState) setRegistered(routeId string) bool {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	if cs.closed {
+		return false
+	}
+	cs.routeId = routeId
+	cs.registeredTime = time.Now()
+	return true
+}
+
+// marks the connection closed, returns the registered route ("" if none)
+func (cs *listenerConnState) setClosed() (string, time.Time) {
+	cs.lock.Lock()
+	defer cs.lock.Unlock()
+	cs.closed = true
+	return cs.routeId, cs.registeredTime
+}
+
+func cleanupListenerRoute(router *wshutil.WshRouter, proxy *wshutil.WshRpcProxy, routeId string) {
+	connServerImplRegistry.RemoveRoute(routeId)
+	wshremote.ClearRouteCwd(routeId)
+	wshremote.ClearRouteFileSubs(routeId)
+	router.UnregisterRoute(routeId)
+	proxy.DrainToRemote()
+	disposeListenerRoute(router, proxy, routeId)
+}
+
+// injects the route's dispose for the upstream, once per proxy (the shutdown drain and the
+// connection's cleanup both dispose)
+func disposeListenerRoute(router *wshutil.WshRouter, proxy *wshutil.WshRpcProxy, routeId string) {
+	if !proxy.MarkDisposed() {
+		return
+	}
+	authToken := proxy.GetAuthToken()
+	if authToken == "" {
+		// auth never completed, there is nothing upstream to dispose of
+		log.Printf("no auth token for route %q at cleanup, skipping dispose\n", routeId)
+		return
+	}
+	disposeMsg := &wshutil.RpcMessage{
+		Command: wshrpc.Command_Dispose,
+		Data: wshrpc.CommandDisposeData{
+			RouteId: routeId,
+		},
+		Source:    routeId,
+		AuthToken: authToken,
+	}
+	disposeBytes, _ := json.Marshal(disposeMsg)
+	router.InjectMessage(disposeBytes, routeId)
+}
+
+func handleNewListenerConn(conn net.Conn, acceptTime time.Time, router *wshutil.WshRouter, serverImpl *wshremote.ServerImpl) {
+	router.ConnOpened()
+	connState := &listenerConnState{lock: &sync.Mutex{}}
+	activity := wshutil.MakeActivityTracker()
+	connDone := make(chan struct{})
 	proxy := wshutil.MakeRpcProxy()
+	proxy.SetCloseFn(func() { conn.Close() })
+	proxy.SetBufferBudget(serverImpl.BufferBudget)
+	if _, ok := conn.(*jwtOnlyConn); ok {
+		proxy.SetRequireJwt(true)
+	}
 	go func() {
 		defer panichandler.PanicHandler("handleNewListenerConn:AdaptOutputChToStream")
-		writeErr := wshutil.AdaptOutputChToStream(proxy.ToRemoteCh, conn)
+		writeErr := wshutil.AdaptProxyOutputToStream(proxy, conn)
 		if writeErr != nil {
-			log.Printf("error writing to domain socket: %v\n", writeErr)
+			ratelog.Printf("error writing to domain socket: %v\n", writeErr)
 		}
 	}()
 	go func() {
@@ -65,129 +442,1076 @@ func handleNewListenerConn(conn net.Conn, router *wshutil.WshRouter) {
 		defer panichandler.PanicHandler("handleNewListenerConn:AdaptStreamToMsgCh")
 		defer func() {
 			conn.Close()
-			routeIdPtr := routeIdContainer.Load()
-			if routeIdPtr != nil && *routeIdPtr != "" {
-				router.UnregisterRoute(*routeIdPtr)
-				disposeMsg := &wshutil.RpcMessage{
-					Command: wshrpc.Command_Dispose,
-					Data: wshrpc.CommandDisposeData{
-						RouteId: *routeIdPtr,
-					},
-					Source:    *routeIdPtr,
-					AuthToken: proxy.GetAuthToken(),
-				}
-				disposeBytes, _ := json.Marshal(disposeMsg)
-				router.InjectMessage(disposeBytes, *routeIdPtr)
+			close(connDone)
+			router.ConnClosed()
+			routeId, regTime := connState.setClosed()
+			if routeId == "" {
+				// never registered (auth failed, timed out, or was rejected)
+				return
+			}
+			if serverImpl.ConnStats != nil {
+				serverImpl.ConnStats.Record(time.Since(regTime))
 			}
+			wshremote.PublishServerEvent(wshremote.ServerEvent_RouteDown, routeId, "route %q disconnected after %v", routeId, time.Since(regTime).Round(time.Second))
+			wshremote.UnregisterRouteConn(routeId, conn)
+			cleanupListenerRoute(router, proxy, routeId)
 		}()
-		wshutil.AdaptStreamToMsgCh(conn, proxy.FromRemoteCh)
+		policy := wshutil.FullChPolicy{
+			Mode:    connServerInputFullPolicy,
+			Timeout: connServerInputFullTimeout,
+			LogName: "listener:" + conn.RemoteAddr().String(),
+		}
+		// the disconnect policy returns here, the deferred cleanup closes the connection
+		input := wshutil.MakeActivityReader(wshutil.MakeBudgetReader(conn, serverImpl.BufferBudget), activity)
+		wshutil.AdaptStreamToMsgChWithPolicy(input, proxy.FromRemoteCh, policy)
 	}()
-	routeId, err := proxy.HandleClientProxyAuth(router)
+	routeId, err := proxy.HandleClientProxyAuth(router, connServerHandshakeTimeout)
+	if err != nil {
+		ratelog.Printf("error handling client proxy auth: %v\n", err)
+		conn.Close()
+		return
+	}
+	if routeId == "" {
+		log.Printf("client proxy auth returned an empty route id, closing connection\n")
+		conn.Close()
+		return
+	}
+	peerCtx := proxy.GetPeerRpcContext()
+	routeImpl, err := connServerImplFactory(peerCtx)
 	if err != nil {
-		log.Printf("error handling client proxy auth: %v\n", err)
+		log.Printf("closing new listener connection for route %q: %v\n", routeId, err)
 		conn.Close()
 		return
 	}
-	router.RegisterRoute(routeId, proxy, false)
-	routeIdContainer.Store(&routeId)
+	if connServerSniBundles != nil {
+		// the tls server name's policy takes precedence
+		if sniImpl := connServerSniBundles.implForConn(conn); sniImpl != nil {
+			routeImpl = sniImpl
+		}
+	}
+	if routeImpl == serverImpl {
+		routeImpl = nil
+	}
+	// two connections resolving to the same route would orphan the first one, so the new connection is rejected.
+	// the route's impl is set along with the registration: before its first request (which must not reach the
+	// global impl), and never by a connection that lost the route
+	err = router.RegisterRouteExclusiveFn(routeId, proxy, false, func() {
+		connServerImplRegistry.SetRouteImpl(routeId, routeImpl)
+	})
+	if err != nil {
+		log.Printf("closing new listener connection: %v\n", err)
+		conn.Close()
+		return
+	}
+	if instanceId := proxy.GetInstanceId(); instanceId != "" {
+		staleRouteId, bindErr := router.BindInstance(routeId, instanceId)
+		if bindErr != nil {
+			log.Printf("cannot bind client instance for route %q: %v\n", routeId, bindErr)
+		} else if staleRouteId != "" {
+			// the same logical client reconnected, its old connection is dead (or about to be)
+			log.Printf("client instance %q reconnected as route %q, resetting stale route %q\n", instanceId, routeId, staleRouteId)
+			router.ResetRoute(staleRouteId, true)
+		}
+	}
+	handshakeDur := time.Since(acceptTime)
+	if serverImpl.HandshakeStats != nil {
+		serverImpl.HandshakeStats.Record(handshakeDur)
+	}
+	if connServerLogHandshakes || wshremote.GetToggle(wshremote.Toggle_Verbose) {
+		log.Printf("[handshake] route %q registered %v after accept\n", routeId, handshakeDur)
+	}
+	wshremote.PublishServerEvent(wshremote.ServerEvent_RouteUp, routeId, "route %q connected (%s)", routeId, conn.LocalAddr().Network())
+	router.SetRouteTransport(routeId, conn.LocalAddr().Network())
+	wshremote.RegisterRouteConn(routeId, conn)
+	if peerCtx != nil && peerCtx.BlockType != "" {
+		router.SetRouteBlockType(routeId, peerCtx.BlockType)
+	}
+	if peerCtx != nil {
+		router.SetRouteQosClass(routeId, peerCtx.QosClass)
+	}
+	if deadman := proxy.GetDeadman(); deadman > 0 {
+		router.StartRouteDeadman(routeId, deadman, func(routeId string, interval time.Duration) {
+			wshremote.PublishServerEvent(wshremote.ServerEvent_Deadman, routeId, "route %q sent no keepalive within %v, disconnecting", routeId, interval)
+		})
+	}
+	if !connState.setRegistered(routeId) {
+		// the connection closed while we were registering, the cleanup already ran without this route
+		wshremote.UnregisterRouteConn(routeId, conn)
+		cleanupListenerRoute(router, proxy, routeId)
+		return
+	}
+	if connServerConnIdleTimeout > 0 {
+		go func() {
+			defer panichandler.PanicHandler("handleNewListenerConn:RunIdleCheck")
+			router.RunIdleCheck(routeId, proxy, activity, connServerConnIdleTimeout, connDone, func(idleFor time.Duration) {
+				wshremote.PublishServerEvent(wshremote.ServerEvent_Idle, routeId, "route %q idle for %v and not answering pings, disconnecting", routeId, idleFor.Round(time.Second))
+				proxy.CloseConn()
+			})
+		}()
+	}
+	serverImpl.ReplayServerIssue(routeId)
+}
+
+// accepted and immediately closed, so the client gets a clear message instead of a hang
+func rejectConn(conn net.Conn, message string) {
+	defer panichandler.PanicHandler("rejectConn")
+	defer conn.Close()
+	msg := &wshutil.RpcMessage{
+		Command: wshrpc.Command_Message,
+		Data:    wshrpc.CommandMessageData{Message: message},
+	}
+	msgBytes, _ := json.Marshal(msg)
+	conn.SetWriteDeadline(time.Now().Add(time.Second))
+	conn.Write(append(msgBytes, '\n'))
+}
+
+func trackListener(listener net.Listener) {
+	connServerListenersLock.Lock()
+	defer connServerListenersLock.Unlock()
+	connServerListeners = append(connServerListeners, listener)
+}
+
+func closeListeners() {
+	connServerListenersLock.Lock()
+	defer connServerListenersLock.Unlock()
+	for _, listener := range connServerListeners {
+		err := listener.Close()
+		if err != nil && !errors.Is(err, net.ErrClosed) {
+			log.Printf("error closing listener %s: %v\n", listener.Addr(), err)
+		}
+	}
+	connServerListeners = nil
+	connServerListenersClosed = true
+}
+
+// a nil message on the upstream output channel is a flush marker. the writer closes the next waiter when it
+// reaches the marker, so everything queued before it has been written.
+var upstreamFlushLock = &sync.Mutex{}
+var upstreamFlushWaiters []chan struct{}
+var upstreamOutputCh chan []byte
+
+// large messages wait for the upstream's flow control credit, small (interactive) ones go first
+func writeUpstreamPackets(outputCh chan []byte) {
+	defer panichandler.PanicHandler("serverRunRouter:WritePackets")
+	laneWriter := wshutil.MakeLaneWriter(func(msg []byte) error {
+		if msg == nil {
+			upstreamFlushLock.Lock()
+			if len(upstreamFlushWaiters) > 0 {
+				close(upstreamFlushWaiters[0])
+				upstreamFlushWaiters = upstreamFlushWaiters[1:]
+			}
+			upstreamFlushLock.Unlock()
+			return nil
+		}
+		connServerUpstream.writeMessage(msg)
+		return nil
+	}, connServerUpstream.canSendBulk, cap(outputCh))
+	connServerUpstream.setWakeFn(laneWriter.Wake)
+	laneWriter.Run(outputCh)
+}
+
+// waits (up to timeout) for the messages already queued for the upstream to be written
+func flushUpstream(timeout time.Duration) bool {
+	if upstreamOutputCh == nil || timeout <= 0 {
+		return true
+	}
+	doneCh := make(chan struct{})
+	upstreamFlushLock.Lock()
+	upstreamFlushWaiters = append(upstreamFlushWaiters, doneCh)
+	upstreamFlushLock.Unlock()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case upstreamOutputCh <- nil:
+	case <-timer.C:
+		return false
+	}
+	select {
+	case <-doneCh:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// the remaining grace, capped at the flush delay
+func flushTimeout(ctx context.Context) time.Duration {
+	timeout := connServerShutdownFlushDelay
+	if deadline, ok := ctx.Deadline(); ok {
+		timeout = min(timeout, time.Until(deadline))
+	}
+	return timeout
+}
+
+func flushUpstreamStep(ctx context.Context) {
+	timeout := flushTimeout(ctx)
+	if !flushUpstream(timeout) {
+		log.Printf("timeout flushing upstream messages (%v)\n", timeout)
+	}
 }
 
-func runListener(listener net.Listener, router *wshutil.WshRouter) {
+// waits (up to --drain-timeout) for the messages queued to the listener clients to be written, false
+// if some are still pending.  a client that stopped reading holds up the wait, not the shutdown
+func waitListenerQueuesFlushed(ctx context.Context, proxies map[string]*wshutil.WshRpcProxy) bool {
+	timer := time.NewTimer(connServerDrainTimeout)
+	defer timer.Stop()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		pending := 0
+		for _, proxy := range proxies {
+			pending += proxy.PendingToRemote()
+		}
+		if pending == 0 {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+			return false
+		case <-ticker.C:
+		}
+	}
+}
+
+// disposes of the listener routes upstream (so nothing new is sent to them), lets their queued
+// messages flush, then closes the connections and waits for the routes to be cleaned up.  the
+// cleanup skips the dispose for these routes, they were already disposed here
+func disposeListenerRoutes(ctx context.Context, router *wshutil.WshRouter) {
+	proxies := make(map[string]*wshutil.WshRpcProxy)
+	for _, routeId := range router.GetLocalRouteIds() {
+		proxy, ok := router.GetRpc(routeId).(*wshutil.WshRpcProxy)
+		if ok && proxy.HasCloseFn() {
+			proxies[routeId] = proxy
+		}
+	}
+	if len(proxies) == 0 {
+		return
+	}
+	for routeId, proxy := range proxies {
+		disposeListenerRoute(router, proxy, routeId)
+	}
+	log.Printf("shutdown: disposed %d listener route(s), draining\n", len(proxies))
+	if !waitListenerQueuesFlushed(ctx, proxies) {
+		var stuck []string
+		for routeId, proxy := range proxies {
+			if proxy.PendingToRemote() > 0 {
+				stuck = append(stuck, routeId)
+			}
+		}
+		log.Printf("shutdown: drain timeout (%v), force-closing %d connection(s) with unwritten messages: %s\n", connServerDrainTimeout, len(stuck), strings.Join(stuck, ", "))
+	}
+	var closed []string
+	for routeId, proxy := range proxies {
+		if proxy.CloseConn() {
+			closed = append(closed, routeId)
+		}
+	}
+	log.Printf("shutdown: closed %d listener connection(s)\n", len(closed))
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		remaining := 0
+		for _, routeId := range closed {
+			if router.IsLocalRoute(routeId) {
+				remaining++
+			}
+		}
+		if remaining == 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			log.Printf("shutdown: %d route(s) were not cleaned up in time\n", remaining)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// the listener routes (proxies) still registered, these are what the shutdown is draining
+func getDrainingRoutes(router *wshutil.WshRouter) []wshrpc.RouteStatsData {
+	var rtn []wshrpc.RouteStatsData
+	for _, routeStats := range router.GetRouteStats().Routes {
+		if _, ok := router.GetRpc(routeStats.RouteId).(*wshutil.WshRpcProxy); ok {
+			rtn = append(rtn, routeStats)
+		}
+	}
+	return rtn
+}
+
+func makeDrainReporter(router *wshutil.WshRouter, serverImpl *wshremote.ServerImpl) *wshutil.ShutdownReporter {
+	return &wshutil.ShutdownReporter{
+		Progress: func() string {
+			routes := getDrainingRoutes(router)
+			queued := 0
+			for _, routeStats := range routes {
+				queued += routeStats.QueueDepth
+			}
+			progress := fmt.Sprintf("%d route(s) remaining, %d message(s) queued for routes, %d for the upstream", len(routes), queued, len(upstreamOutputCh))
+			if serverImpl.BufferBudget != nil {
+				progress += fmt.Sprintf(", %d byte(s) buffered", serverImpl.BufferBudget.Used.Load())
+			}
+			return progress
+		},
+		Pending: func() []string {
+			var pending []string
+			if numQueued := len(upstreamOutputCh); numQueued > 0 {
+				pending = append(pending, fmt.Sprintf("upstream: %d message(s) not written (stdout is blocked)", numQueued))
+			}
+			for _, routeStats := range getDrainingRoutes(router) {
+				var reasons []string
+				if routeStats.QueueDepth > 0 {
+					reasons = append(reasons, fmt.Sprintf("%d message(s) queued, client is not reading", routeStats.QueueDepth))
+				}
+				if routeStats.InFlight > 0 {
+					reasons = append(reasons, fmt.Sprintf("%d request(s) in flight", routeStats.InFlight))
+				}
+				if len(reasons) == 0 {
+					reasons = append(reasons, "connection still open, route cleanup has not run")
+				}
+				routeDesc := fmt.Sprintf("route %q", routeStats.RouteId)
+				if routeStats.Transport != "" {
+					routeDesc += fmt.Sprintf(" (%s)", routeStats.Transport)
+				}
+				pending = append(pending, fmt.Sprintf("%s: %s", routeDesc, strings.Join(reasons, ", ")))
+			}
+			return pending
+		},
+	}
+}
+
+// stop accepting, drain the upstream, dispose the local routes, close the listeners
+func addRouterShutdownSteps(router *wshutil.WshRouter, serverImpl *wshremote.ServerImpl) {
+	wshutil.SetShutdownReporter(makeDrainReporter(router, serverImpl))
+	wshutil.AddShutdownStep(wshutil.ShutdownPhase_StopAccepting, "quiesce", func(ctx context.Context) {
+		serverImpl.Quiesce()
+	})
+	wshutil.AddShutdownStep(wshutil.ShutdownPhase_DrainUpstream, "flushupstream", flushUpstreamStep)
+	wshutil.AddShutdownStep(wshutil.ShutdownPhase_DisposeRoutes, "disposeroutes", func(ctx context.Context) {
+		disposeListenerRoutes(ctx, router)
+	})
+	wshutil.AddShutdownStep(wshutil.ShutdownPhase_CloseListeners, "closelisteners", func(ctx context.Context) {
+		closeListeners()
+	})
+	// the disposes from the route cleanup are queued after the first drain
+	wshutil.AddShutdownStep(wshutil.ShutdownPhase_Final, "flushdisposes", flushUpstreamStep)
+}
+
+const upstreamInjectStallWarning = 1 * time.Second
+
+// forwards messages read from stdin to the router.  a stalled router must not block the stdin reader
+// forever, so after --upstream-inject-timeout the message is dropped (requests get an error back).
+// stats may be nil (--trace-pipeline)
+func forwardUpstreamMessages(termProxy *wshutil.WshRpcProxy, router *wshutil.WshRouter, stats *wshremote.PipelineStats) {
+	defer panichandler.PanicHandler("forwardUpstreamMessages")
+	for msgBytes := range termProxy.FromRemoteCh {
+		if stats != nil {
+			stats.Received.Add(1)
+		}
+		if connServerUpstreamInjectTimeout <= 0 {
+			router.InjectMessage(msgBytes, wshutil.UpstreamRoute)
+			if stats != nil {
+				stats.Injected.Add(1)
+			}
+			continue
+		}
+		startTime := time.Now()
+		if router.InjectMessageWithTimeout(msgBytes, wshutil.UpstreamRoute, connServerUpstreamInjectTimeout) {
+			if stats != nil {
+				stats.Injected.Add(1)
+			}
+			if stallDur := time.Since(startTime); stallDur >= upstreamInjectStallWarning {
+				ratelog.Printf("forwarding upstream message to the router stalled for %v\n", stallDur.Round(time.Millisecond))
+			} else {
+				wshremote.ClearServerIssue(wshremote.ServerIssue_Upstream)
+			}
+			continue
+		}
+		if stats != nil {
+			stats.Dropped.Add(1)
+		}
+		ratelog.Printf("router stalled for %v, dropped upstream message\n", connServerUpstreamInjectTimeout)
+		wshremote.SetServerIssue(wshremote.ServerIssue_Upstream, wshremote.ServerIssueSeverity_Warning, "router stalled for %v, upstream messages are being dropped", connServerUpstreamInjectTimeout)
+		failDroppedUpstreamRequest(termProxy, msgBytes)
+	}
+}
+
+// the upstream writer is separate from the router, so the error can go straight back
+func failDroppedUpstreamRequest(termProxy *wshutil.WshRpcProxy, msgBytes []byte) {
+	var msg wshutil.RpcMessage
+	if err := json.Unmarshal(msgBytes, &msg); err != nil || msg.Command == "" || msg.ReqId == "" {
+		return
+	}
+	respBytes, _ := json.Marshal(wshutil.RpcMessage{
+		ResId: msg.ReqId,
+		Error: "EC-BUSY: connserver router is stalled, request was dropped",
+	})
+	select {
+	case termProxy.ToRemoteCh <- respBytes:
+	default:
+	}
+}
+
+func runListener(listener net.Listener, router *wshutil.WshRouter, serverImpl *wshremote.ServerImpl) {
 	defer func() {
+		connServerState.ListenerUp.Store(false)
 		log.Printf("listener closed, exiting\n")
-		time.Sleep(500 * time.Millisecond)
-		wshutil.DoShutdown("", 1, true)
+		wshutil.GracefulShutdown("", 1, true, connServerShutdownGrace)
 	}()
 	for {
 		conn, err := listener.Accept()
-		if err == io.EOF {
+		if err == io.EOF || errors.Is(err, net.ErrClosed) {
 			break
 		}
 		if err != nil {
-			log.Printf("error accepting connection: %v\n", err)
+			ratelog.Printf("error accepting connection: %v\n", err)
+			continue
+		}
+		if serverImpl.IsQuiesced() {
+			go rejectConn(conn, "server quiescing, not accepting new connections")
+			continue
+		}
+		if reason, overloaded := wshremote.CheckOverloaded(connServerLoadShed); overloaded {
+			ratelog.Printf("rejecting new connection, server overloaded: %s\n", reason)
+			go rejectConn(conn, "server overloaded, not accepting new connections: "+reason)
 			continue
 		}
-		go handleNewListenerConn(conn, router)
+		// waiting here (not in the handler) holds back the following connections too, they queue in the backlog
+		if limiter := wshremote.GetAcceptRateLimiter(); limiter != nil {
+			wait, ok := limiter.Admit()
+			if !ok {
+				ratelog.Printf("rejecting new connection, accept rate limit exceeded\n")
+				go rejectConn(conn, "too many new connections, retry later")
+				continue
+			}
+			if wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+		go handleNewListenerConn(conn, time.Now(), router, serverImpl)
+	}
+}
+
+// the static (flag) part of the config, runtime values are filled in by GetServerConfigCommand.
+// must not contain secrets (jwt tokens, key files)
+func makeConnServerConfig(sysInfoOpts *wshremote.SysInfoLoopOpts) *wshrpc.ConnServerConfigData {
+	rtn := &wshrpc.ConnServerConfigData{
+		RouterMode:          connServerRouter,
+		Transports:          []string{"stdio"},
+		RootDir:             connServerRootDir,
+		HandshakeTimeoutMs:  connServerHandshakeTimeout.Milliseconds(),
+		ConnIdleTimeoutMs:   connServerConnIdleTimeout.Milliseconds(),
+		ListenBacklog:       connServerListenBacklog,
+		HealthAddr:          connServerHealthAddr,
+		GatewayAddr:         connServerGatewayAddr,
+		MetricsSocket:       connServerMetricsSocket,
+		CommandConcurrency:  connServerCommandConcurrencyMap(),
+		CommandQueueSize:    connServerCommandQueueSize,
+		LogBufferBytes:      connServerLogBufferBytes,
+		SysInfoInclude:      sysInfoOpts.Subsystems,
+		MaxSysInfoErrors:    sysInfoOpts.MaxErrors,
+		SysInfoJitter:       sysInfoOpts.Jitter,
+		SysInfoTimeoutMs:    sysInfoOpts.SubsystemTimeout.Milliseconds(),
+		SysInfoHistory:      sysInfoOpts.History,
+		ShutdownFlushMs:     connServerShutdownFlushDelay.Milliseconds(),
+		ShutdownGraceMs:     connServerShutdownGrace.Milliseconds(),
+		DrainTimeoutMs:      connServerDrainTimeout.Milliseconds(),
+		InjectTimeoutMs:     connServerUpstreamInjectTimeout.Milliseconds(),
+		UpstreamCompression: connServerUpstreamCompression,
+		UpstreamWindow:      connServerUpstreamWindow,
+		TracePipeline:       connServerTracePipeline,
+		WatchSocket:         connServerWatchSocket,
+		MaxInflight:         connServerMaxInflight,
+		BackpressureHigh:    connServerBackpressureHigh,
+		BackpressureLow:     connServerBackpressureLow,
+		CarryRouteStats:     connServerCarryRouteStats,
+		InputFullPolicy:     connServerInputFullPolicy,
+		InputFullTimeoutMs:  connServerInputFullTimeout.Milliseconds(),
+		MaxBufferMemory:     connServerMaxBufferMemory,
+		QueueHighWatermark:  connServerQueueWatermarks.High,
+		QueueLowWatermark:   connServerQueueWatermarks.Low,
+		QueueSustainMs:      connServerQueueWatermarks.Sustain.Milliseconds(),
+		RejectAboveLoad:     connServerLoadShed.MaxCpuPercent,
+		RejectAboveMem:      connServerLoadShed.MaxMemPercent,
+		ExecEnvDeny:         wshremote.GetExecEnvDeny(),
+		RuntimeProbeTools:   wshremote.GetRuntimeProbeTools(),
+		ConfigFile:          connServerConfigFile,
+		PolicyFile:          connServerPolicyFile,
+		DeadmanIntervalMs:   connServerDeadmanInterval.Milliseconds(),
+		LogFile:             connServerLogFile,
+		LogMaxSize:          connServerLogMaxSize,
+	}
+	if connServerLogFile != "" {
+		rtn.LogKeep = connServerLogKeep
+	}
+	if connServerPolicy != nil {
+		rtn.PolicyRules = len(connServerPolicy.Rules)
+	}
+	if sysInfoOpts.Pusher != nil {
+		rtn.SysInfoPushUrl = sysInfoOpts.Pusher.RedactedUrl()
+	}
+	if limiter := wshremote.GetAcceptRateLimiter(); limiter != nil {
+		rtn.AcceptRate = limiter.Rate
+		rtn.AcceptBurst = limiter.Burst
+		rtn.AcceptRateWaitMs = limiter.MaxWait.Milliseconds()
+	}
+	if connServerResumeGrace > 0 {
+		rtn.ResumeGraceMs = connServerResumeGrace.Milliseconds()
+	}
+	if upstreamResumable() {
+		rtn.ResumeBufferBytes = connServerResumeBufferBytes
+	}
+	if connServerDaemonChild {
+		rtn.Daemon = true
+		rtn.DaemonStateFile = daemonStateFileName()
+	}
+	if connServerRouter {
+		rtn.Listen = "unix"
+		if connServerListenResolved != "" {
+			rtn.Listen = "tcp://" + connServerListenResolved
+		}
+	}
+	connServerListenersLock.Lock()
+	for _, listener := range connServerListeners {
+		rtn.Transports = append(rtn.Transports, listener.Addr().Network()+":"+listener.Addr().String())
+	}
+	connServerListenersLock.Unlock()
+	if connServerSniBundles != nil {
+		for serverName := range connServerSniBundles.Bundles {
+			rtn.TlsServerNames = append(rtn.TlsServerNames, serverName)
+		}
+		sort.Strings(rtn.TlsServerNames)
+	}
+	return rtn
+}
+
+func connServerCommandConcurrencyMap() map[string]int {
+	if connServerCommandLimiter == nil {
+		return nil
+	}
+	return connServerCommandLimiter.Limits()
+}
+
+func makeConnServerImpl() (*wshremote.ServerImpl, error) {
+	rootDir, err := wshremote.ResolveRootDir(connServerRootDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid --root-dir: %v", err)
+	}
+	if rootDir != "" {
+		log.Printf("confining file operations to root dir %q\n", rootDir)
+	}
+	// handlers log through the async writer, a stalled stdout reader drops lines instead of blocking them
+	logSink := asyncwriter.MakeAsyncWriter(os.Stdout, asyncwriter.DefaultQueueSize)
+	serverImpl := wshremote.MakeServerImpl(&wshremote.ServerState{
+		LogWriter:      logSink,
+		LogSink:        logSink,
+		StartTime:      time.Now(),
+		ConnStats:      wshremote.MakeConnDurationHistogram(),
+		HandshakeStats: wshremote.MakeHandshakeStats(),
+	}, rootDir)
+	logOutput := io.Writer(os.Stderr)
+	if connServerLogFile != "" {
+		logFile, err := logfile.Open(connServerLogFile, connServerLogMaxSize, connServerLogKeep)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --log-file: %v", err)
+		}
+		serverImpl.LogFile = logFile
+		logOutput = logFile
+		log.SetOutput(logOutput)
 	}
+	if connServerLogBufferBytes > 0 {
+		logBuffer := logring.MakeLogRing(connServerLogBufferBytes)
+		log.SetOutput(io.MultiWriter(logOutput, logBuffer))
+		serverImpl.LogWriter = io.MultiWriter(logSink, logBuffer)
+		serverImpl.LogBuffer = logBuffer
+	}
+	wshutil.AddShutdownStep(wshutil.ShutdownPhase_Final, "flushlogsink", func(ctx context.Context) {
+		if !logSink.Flush(logSinkFlushTimeout) {
+			log.Printf("log output did not drain within %v, %d queued writes lost\n", logSinkFlushTimeout, logSink.GetStats().Queued)
+		}
+	})
+	return serverImpl, nil
 }
 
-func setupConnServerRpcClientWithRouter(router *wshutil.WshRouter) (*wshutil.WshRpc, error) {
-	jwtToken := os.Getenv(wshutil.WaveJwtTokenVarName)
-	if jwtToken == "" {
-		return nil, fmt.Errorf("no jwt token found for connserver")
+// surrounding whitespace (e.g. a trailing newline) is not part of the secret
+func readAuthSecretFile(fileName string) (string, error) {
+	barr, err := os.ReadFile(fileName)
+	if err != nil {
+		return "", fmt.Errorf("cannot read --auth-secret-file: %w", err)
+	}
+	secret := strings.TrimSpace(string(barr))
+	if secret == "" {
+		return "", fmt.Errorf("--auth-secret-file %q is empty", fileName)
+	}
+	return secret, nil
+}
+
+func setupConnServerRpcClientWithRouter(router *wshutil.WshRouter, serverImpl *wshremote.ServerImpl) (*wshutil.WshRpc, error) {
+	jwtToken, err := getConnServerJwtToken()
+	if err != nil {
+		return nil, err
 	}
 	rpcCtx, err := wshutil.ExtractUnverifiedRpcContext(jwtToken)
 	if err != nil {
 		return nil, fmt.Errorf("error extracting rpc context from %s: %v", wshutil.WaveJwtTokenVarName, err)
 	}
+	if err := wshutil.CheckUnverifiedTokenExpiry(jwtToken); err != nil {
+		return nil, fmt.Errorf("%s: %w", wshutil.WaveJwtTokenVarName, err)
+	}
 	authRtn, err := router.HandleProxyAuth(jwtToken)
 	if err != nil {
 		return nil, fmt.Errorf("error handling proxy auth: %v", err)
 	}
 	inputCh := make(chan []byte, wshutil.DefaultInputChSize)
 	outputCh := make(chan []byte, wshutil.DefaultOutputChSize)
-	connServerClient := wshutil.MakeWshRpc(inputCh, outputCh, *rpcCtx, &wshremote.ServerImpl{LogWriter: os.Stdout})
+	routeImpl, err := connServerImplFactory(rpcCtx)
+	if err != nil {
+		return nil, err
+	}
+	if routeImpl == nil {
+		routeImpl = serverImpl
+	}
+	connServerClient := wshutil.MakeWshRpc(inputCh, outputCh, *rpcCtx, routeImpl)
+	// requests coming from listener routes are served by that route's impl
+	connServerClient.SetServerImplSelector(connServerImplRegistry.SelectServerImpl)
+	connServerClient.SetCommandLimiter(connServerCommandLimiter)
+	wshremote.AddToggleHook(wshremote.Toggle_TraceRpc, connServerClient.SetTrace)
 	connServerClient.SetAuthToken(authRtn.AuthToken)
 	router.RegisterRoute(authRtn.RouteId, connServerClient, false)
+	connServerRouteId = authRtn.RouteId
 	wshclient.RouteAnnounceCommand(connServerClient, nil)
 	return connServerClient, nil
 }
 
-func serverRunRouter() error {
+func serverRunRouter(sysInfoOpts *wshremote.SysInfoLoopOpts) error {
+	serverImpl, err := makeConnServerImpl()
+	if err != nil {
+		return err
+	}
+	go serverImpl.RunServerEventLog()
 	router := wshutil.NewWshRouter()
+	router.SetMaxInflightPerRoute(connServerMaxInflight)
+	router.SetBackpressure(connServerBackpressureHigh, connServerBackpressureLow)
+	router.SetCarryInstanceStats(connServerCarryRouteStats)
+	router.SetDeadmanPolicy(connServerDeadmanInterval)
+	if connServerPolicy != nil {
+		router.SetCommandPolicy(connServerPolicy)
+		log.Printf("command policy loaded from %s (%d rules)\n", connServerPolicyFile, len(connServerPolicy.Rules))
+	}
+	if connServerMaxBufferMemory > 0 {
+		serverImpl.BufferBudget = wshutil.MakeBufferBudget(connServerMaxBufferMemory)
+	}
+	serverImpl.Router = router
+	if connServerImplFactory == nil {
+		connServerImplFactory = wshremote.MakeRootDirClaimServerImplFactory(serverImpl)
+	}
+	connServerImplRegistry = wshremote.MakeServerImplRegistry()
 	termProxy := wshutil.MakeRpcProxy()
-	rawCh := make(chan []byte, wshutil.DefaultOutputChSize)
-	go packetparser.Parse(os.Stdin, termProxy.FromRemoteCh, rawCh)
-	go func() {
-		defer panichandler.PanicHandler("serverRunRouter:WritePackets")
-		for msg := range termProxy.ToRemoteCh {
-			packetparser.WritePacket(os.Stdout, msg)
+	var parseStats *packetparser.ParseStats
+	if connServerTracePipeline {
+		serverImpl.PipelineStats = &wshremote.PipelineStats{}
+		parseStats = &serverImpl.PipelineStats.Parse
+		log.Printf("tracing the upstream message pipeline (see PipelineStats)\n")
+	}
+	connServerUpstream.router = router
+	upstreamOutputCh = termProxy.ToRemoteCh
+	if !connServerDaemonChild {
+		stdioStream := &upstreamStream{Name: "stdio", Reader: os.Stdin, Writer: os.Stdout}
+		stdioStream.attachPacketStream(router)
+		connServerUpstream.setStream(stdioStream)
+		// when stdin is closed, shutdown (after the resume grace)
+		go runUpstream(stdioStream, termProxy, router, parseStats)
+	}
+	// a daemon holds everything for the upstream until the first one attaches
+	go writeUpstreamPackets(termProxy.ToRemoteCh)
+	go forwardUpstreamMessages(termProxy, router, serverImpl.PipelineStats)
+	router.SetUpstreamClient(termProxy)
+	// now set up the domain socket
+	// closeListeners also runs on an abrupt DoShutdown (e.g. the upstream write failing)
+	wshutil.SetExtraShutdownFunc(closeListeners)
+	addRouterShutdownSteps(router, serverImpl)
+	var mainListener net.Listener
+	if connServerListenAddr != "" {
+		mainListener, connServerListenResolved, err = MakeRemoteTCPListener(connServerListenAddr)
+		if err != nil {
+			return fmt.Errorf("cannot create tcp listener: %v", err)
 		}
-	}()
-	go func() {
-		// just ignore and drain the rawCh (stdin)
-		// when stdin is closed, shutdown
-		defer wshutil.DoShutdown("", 0, true)
-		for range rawCh {
-			// ignore
+		router.SetListenAddr(connServerListenResolved)
+	} else {
+		mainListener, err = MakeRemoteListener()
+		if err != nil {
+			return fmt.Errorf("cannot create local listener: %v", err)
 		}
-	}()
-	go func() {
-		for msg := range termProxy.FromRemoteCh {
-			// send this to the router
-			router.InjectMessage(msg, wshutil.UpstreamRoute)
+	}
+	trackListener(mainListener)
+	connServerState.ListenerUp.Store(true)
+	var extraListeners []net.Listener
+	if connServerListenVsock != "" {
+		cid, port, err := parseVsockAddr(connServerListenVsock)
+		if err != nil {
+			return fmt.Errorf("invalid --listen-vsock: %v", err)
 		}
-	}()
-	router.SetUpstreamClient(termProxy)
-	// now set up the domain socket
-	unixListener, err := MakeRemoteUnixListener()
-	if err != nil {
-		return fmt.Errorf("cannot create unix listener: %v", err)
+		vsockListener, err := MakeRemoteVsockListener(cid, port)
+		if err != nil {
+			return fmt.Errorf("cannot create vsock listener: %v", err)
+		}
+		trackListener(vsockListener)
+		extraListeners = append(extraListeners, vsockListener)
+	}
+	if connServerListenFd >= 0 {
+		fdListener, err := MakeFdListener(connServerListenFd)
+		if err != nil {
+			return fmt.Errorf("invalid --listen-fd: %v", err)
+		}
+		log.Printf("accepting connections on inherited fd %d (%s:%s)\n", connServerListenFd, fdListener.Addr().Network(), fdListener.Addr())
+		trackListener(fdListener)
+		extraListeners = append(extraListeners, fdListener)
 	}
-	client, err := setupConnServerRpcClientWithRouter(router)
+	if connServerListenTls != "" {
+		bundles, err := makeSniBundles(connServerTlsBundles)
+		if err != nil {
+			return fmt.Errorf("invalid --tls-bundle: %v", err)
+		}
+		for _, bundle := range bundles.Bundles {
+			if bundle.RootDir != "" {
+				bundle.Impl = serverImpl.WithRootDir(bundle.RootDir)
+			}
+		}
+		tlsListener, err := MakeRemoteTLSListener(connServerListenTls, bundles)
+		if err != nil {
+			return fmt.Errorf("cannot create tls listener: %v", err)
+		}
+		connServerSniBundles = bundles
+		wshremote.SetCertReloader(bundles.reloadCerts)
+		trackListener(tlsListener)
+		extraListeners = append(extraListeners, tlsListener)
+	}
+	if connServerDaemonChild {
+		// the jwt in the environment is the one the starting process attaches with
+		jwtToken, err := getConnServerJwtToken()
+		if err != nil {
+			return err
+		}
+		rpcCtx, err := wshutil.ExtractUnverifiedRpcContext(jwtToken)
+		if err != nil {
+			return fmt.Errorf("error extracting rpc context from %s: %v", wshutil.WaveJwtTokenVarName, err)
+		}
+		stream, err := waitForFirstUpstream(rpcCtx.Conn)
+		if err != nil {
+			return err
+		}
+		go runUpstream(stream, termProxy, router, parseStats)
+		wshutil.SetHangupHandler(func() {
+			log.Printf("got SIGHUP, ignoring it (daemon)\n")
+		})
+		wshutil.AddShutdownStep(wshutil.ShutdownPhase_Final, "daemonstate", func(ctx context.Context) {
+			removeDaemonState()
+		})
+	}
+	serverImpl.Config = makeConnServerConfig(sysInfoOpts)
+	client, err := setupConnServerRpcClientWithRouter(router, serverImpl)
 	if err != nil {
 		return fmt.Errorf("error setting up connserver rpc client: %v", err)
 	}
-	go runListener(unixListener, router)
+	if connServerDaemonChild {
+		// the first attach was re-authenticating like a resume, only the server's own route had to
+		numHeld, _ := connServerUpstream.finishResume(nil)
+		log.Printf("authenticated with the attached upstream, %d held messages sent\n", numHeld)
+	}
+	connServerState.UpstreamUp.Store(true)
+	if connServerAuthSecretFile != "" {
+		secret, err := readAuthSecretFile(connServerAuthSecretFile)
+		if err != nil {
+			return err
+		}
+		router.SetAuthVerifier(&wshutil.StaticSecretAuthVerifier{
+			Secret:            secret,
+			UpstreamAuthToken: client.GetAuthToken(),
+			RpcContext:        wshrpc.RpcContext{Conn: client.GetRpcContext().Conn},
+			Fallback:          wshutil.JwtAuthVerifier{},
+		})
+		log.Printf("accepting shared secret auth for listener clients\n")
+		if connServerPolicy != nil && connServerPolicy.Default == nil {
+			log.Printf("the command policy has no default, shared secret clients that no rule matches are refused every command\n")
+		}
+	}
+	installDiagnosticsSignalHandler(func() { dumpConnServerDiagnostics(router, client, serverImpl) })
+	serverImpl.ConnName = client.GetRpcContext().Conn
+	if listenAddr := router.GetListenAddr(); listenAddr != "" {
+		wshremote.AdvertiseListenAddr(client, serverImpl.ConnName, listenAddr)
+	}
+	go wshremote.RunQueueWatermarkMonitor(router, connServerQueueWatermarks)
+	go wshremote.RunServerEventPublisher(client, serverImpl.ConnName)
+	go runListener(mainListener, router, serverImpl)
+	if connServerResumeGrace > 0 && !connServerDaemonChild {
+		resumeListener, err := MakeResumeListener()
+		if err != nil {
+			return fmt.Errorf("cannot create resume listener: %v", err)
+		}
+		trackListener(resumeListener)
+		go runResumeListener(resumeListener, serverImpl.ConnName)
+		// the terminal going away is what --resume-grace is for
+		wshutil.SetHangupHandler(func() {
+			log.Printf("got SIGHUP, waiting for the upstream to resume\n")
+		})
+	}
+	if connServerWatchSocket {
+		if connServerListenAddr != "" {
+			log.Printf("ignoring --watch-socket, there is no domain socket with a tcp listener\n")
+		} else {
+			startUnixSocketWatch(mainListener, router, serverImpl)
+		}
+	}
+	for _, listener := range extraListeners {
+		go runListener(listener, router, serverImpl)
+	}
+	if connServerGatewayAddr != "" {
+		if err := startGatewayServer(connServerGatewayAddr, router, serverImpl); err != nil {
+			return err
+		}
+	}
 	// run the sysinfo loop
-	wshremote.RunSysInfoLoop(client, client.GetRpcContext().Conn)
+	wshremote.RunSysInfoLoop(client, client.GetRpcContext().Conn, sysInfoOpts)
 	select {}
 }
 
-func serverRunNormal() error {
-	err := setupRpcClient(&wshremote.ServerImpl{LogWriter: os.Stdout})
+func serverRunNormal(sysInfoOpts *wshremote.SysInfoLoopOpts) error {
+	serverImpl, err := makeConnServerImpl()
+	if err != nil {
+		return err
+	}
+	go serverImpl.RunServerEventLog()
+	serverImpl.Config = makeConnServerConfig(sysInfoOpts)
+	err = setupRpcClient(serverImpl)
 	if err != nil {
 		return err
 	}
+	RpcClient.SetCommandLimiter(connServerCommandLimiter)
+	wshremote.AddToggleHook(wshremote.Toggle_TraceRpc, RpcClient.SetTrace)
+	connServerState.UpstreamUp.Store(true)
+	installDiagnosticsSignalHandler(func() { dumpConnServerDiagnostics(nil, RpcClient, serverImpl) })
+	go wshremote.RunServerEventPublisher(RpcClient, RpcContext.Conn)
 	WriteStdout("running wsh connserver (%s)\n", RpcContext.Conn)
-	go wshremote.RunSysInfoLoop(RpcClient, RpcContext.Conn)
+	go wshremote.RunSysInfoLoop(RpcClient, RpcContext.Conn, sysInfoOpts)
 	select {} // run forever
 }
 
 func serverRun(cmd *cobra.Command, args []string) error {
+	if connServerConfigFile != "" {
+		if err := loadConnServerConfigFile(cmd.Flags(), connServerConfigFile); err != nil {
+			return err
+		}
+	}
+	ratelog.SetInterval(connServerLogRepeatInterval)
+	sysInfoSubsystems, err := wshremote.ParseSysInfoSubsystems(connServerSysInfoInclude)
+	if err != nil {
+		return err
+	}
+	sysInfoOpts := &wshremote.SysInfoLoopOpts{
+		Subsystems:       sysInfoSubsystems,
+		MaxErrors:        connServerMaxSysInfoErrors,
+		Jitter:           connServerSysInfoJitter,
+		History:          connServerSysInfoHistory,
+		SubsystemTimeout: connServerSysInfoTimeout,
+		Interval:         connServerSysInfoInterval,
+	}
+	if sysInfoOpts.Interval != 0 && (sysInfoOpts.Interval < wshremote.MinSysInfoInterval || sysInfoOpts.Interval > wshremote.MaxSysInfoInterval) {
+		return fmt.Errorf("invalid --sysinfo-interval %v (must be 0 or between %v and %v)", sysInfoOpts.Interval, wshremote.MinSysInfoInterval, wshremote.MaxSysInfoInterval)
+	}
+	if connServerConnIdleTimeout < 0 {
+		return fmt.Errorf("invalid --conn-idle-timeout %v (must not be negative)", connServerConnIdleTimeout)
+	}
+	if connServerListen != "" {
+		listenAddr, err := parseListenUrl(connServerListen)
+		if err != nil {
+			return fmt.Errorf("invalid --listen %q: %v", connServerListen, err)
+		}
+		if connServerListenAddr != "" {
+			return fmt.Errorf("--listen and --listen-addr can't be combined")
+		}
+		connServerListenAddr = listenAddr
+	}
+	if connServerResumeGrace < 0 {
+		return fmt.Errorf("invalid --resume-grace %v (must not be negative)", connServerResumeGrace)
+	}
+	if connServerResumeBufferBytes < 0 {
+		return fmt.Errorf("invalid --resume-buffer-bytes %d", connServerResumeBufferBytes)
+	}
+	if (connServerResume || connServerResumeGrace > 0) && !connServerRouter {
+		return fmt.Errorf("--resume and --resume-grace require --router")
+	}
+	if connServerDaemon || connServerDaemonChild {
+		if !connServerRouter {
+			return fmt.Errorf("--daemon requires --router")
+		}
+		if connServerResume {
+			return fmt.Errorf("--daemon and --resume can't be combined (attaching to the daemon already resumes it)")
+		}
+		if connServerListenFd >= 0 {
+			return fmt.Errorf("--listen-fd can't be used with --daemon (the fd isn't passed to the daemon)")
+		}
+	}
+	if connServerGatewayAddr != "" {
+		if !connServerRouter {
+			return fmt.Errorf("--gateway-addr requires --router")
+		}
+		if err := parseGatewayAddr(connServerGatewayAddr); err != nil {
+			return fmt.Errorf("invalid --gateway-addr %q: %v", connServerGatewayAddr, err)
+		}
+	}
+	if len(connServerGatewayOrigins) > 0 && connServerGatewayAddr == "" {
+		return fmt.Errorf("--gateway-origin requires --gateway-addr")
+	}
+	for _, origin := range connServerGatewayOrigins {
+		if err := parseGatewayOrigin(origin); err != nil {
+			return fmt.Errorf("invalid --gateway-origin %q: %v", origin, err)
+		}
+	}
+	connServerUpstreamCompression, err = packetparser.ParseCompressionList(connServerUpstreamCompressionStr)
+	if err != nil {
+		return fmt.Errorf("invalid --upstream-compression: %w", err)
+	}
+	if connServerUpstreamWindow < 0 {
+		return fmt.Errorf("invalid --upstream-window %d (must not be negative)", connServerUpstreamWindow)
+	}
+	if connServerPolicyFile != "" {
+		if !connServerRouter {
+			return fmt.Errorf("--policy requires --router")
+		}
+		connServerPolicy, err = wshutil.ReadCommandPolicyFile(connServerPolicyFile)
+		if err != nil {
+			return fmt.Errorf("invalid --policy: %w", err)
+		}
+	}
+	if connServerDrainTimeout < 0 {
+		return fmt.Errorf("invalid --drain-timeout %v (must not be negative)", connServerDrainTimeout)
+	}
+	if sysInfoOpts.Jitter < 0 || sysInfoOpts.Jitter > wshremote.MaxSysInfoJitter {
+		return fmt.Errorf("invalid --sysinfo-jitter %v (must be between 0 and %v)", sysInfoOpts.Jitter, wshremote.MaxSysInfoJitter)
+	}
+	if sysInfoOpts.SubsystemTimeout <= 0 {
+		return fmt.Errorf("invalid --sysinfo-subsystem-timeout %v (must be positive)", sysInfoOpts.SubsystemTimeout)
+	}
+	if sysInfoOpts.History < 0 || sysInfoOpts.History > wshremote.MaxSysInfoHistory {
+		return fmt.Errorf("invalid --sysinfo-history %d (must be between 0 and %d)", sysInfoOpts.History, wshremote.MaxSysInfoHistory)
+	}
+	if connServerSysInfoPushUrl != "" {
+		sysInfoOpts.Pusher, err = wshremote.MakeSysInfoPusher(connServerSysInfoPushUrl, connServerSysInfoPushToken)
+		if err != nil {
+			return err
+		}
+	} else if connServerSysInfoPushToken != "" {
+		return fmt.Errorf("--sysinfo-push-token requires --sysinfo-push-url")
+	}
+	commandLimits, err := wshutil.ParseCommandConcurrency(connServerCommandConcurrency)
+	if err != nil {
+		return fmt.Errorf("invalid --command-concurrency: %v", err)
+	}
+	if connServerCommandQueueSize < 0 {
+		return fmt.Errorf("invalid --command-queue-size %d", connServerCommandQueueSize)
+	}
+	if err := wshutil.ValidateFullChPolicy(connServerInputFullPolicy); err != nil {
+		return fmt.Errorf("invalid --input-full-policy: %w", err)
+	}
+	if connServerInputFullTimeout < 0 {
+		return fmt.Errorf("invalid --input-full-timeout %v", connServerInputFullTimeout)
+	}
+	if connServerQueueWatermarks.High > 0 && (connServerQueueWatermarks.Low < 0 || connServerQueueWatermarks.Low >= connServerQueueWatermarks.High) {
+		return fmt.Errorf("invalid --queue-low-watermark %d (must be below --queue-high-watermark %d)", connServerQueueWatermarks.Low, connServerQueueWatermarks.High)
+	}
+	if connServerQueueWatermarks.High < 0 || connServerQueueWatermarks.Sustain < 0 {
+		return fmt.Errorf("invalid --queue-high-watermark/--queue-watermark-sustain %d/%v", connServerQueueWatermarks.High, connServerQueueWatermarks.Sustain)
+	}
+	execEnvDeny, err := wshremote.ParseExecEnvDeny(connServerExecEnvDeny)
+	if err != nil {
+		return fmt.Errorf("invalid --exec-env-deny: %w", err)
+	}
+	wshremote.SetExecEnvDeny(execEnvDeny)
+	runtimeProbeTools, err := wshremote.ParseRuntimeProbeTools(connServerRuntimeProbeTools)
+	if err != nil {
+		return fmt.Errorf("invalid --runtime-probe-tools: %w", err)
+	}
+	wshremote.SetRuntimeProbeTools(runtimeProbeTools)
+	if connServerLoadShed.MaxCpuPercent < 0 || connServerLoadShed.MaxCpuPercent > 100 {
+		return fmt.Errorf("invalid --reject-above-load %v (must be between 0 and 100)", connServerLoadShed.MaxCpuPercent)
+	}
+	if connServerLoadShed.MaxMemPercent < 0 || connServerLoadShed.MaxMemPercent > 100 {
+		return fmt.Errorf("invalid --reject-above-mem %v (must be between 0 and 100)", connServerLoadShed.MaxMemPercent)
+	}
+	if connServerLoadShed.MaxCpuPercent > 0 && !slices.Contains(sysInfoSubsystems, wshremote.SysInfo_Cpu) {
+		return fmt.Errorf("--reject-above-load requires the cpu sysinfo subsystem (--sysinfo-include)")
+	}
+	if connServerLoadShed.MaxMemPercent > 0 && !slices.Contains(sysInfoSubsystems, wshremote.SysInfo_Mem) {
+		return fmt.Errorf("--reject-above-mem requires the mem sysinfo subsystem (--sysinfo-include)")
+	}
+	if connServerAcceptRate != "" {
+		rate, burst, err := wshremote.ParseAcceptRate(connServerAcceptRate)
+		if err != nil {
+			return fmt.Errorf("invalid --accept-rate: %w", err)
+		}
+		if connServerAcceptRateWait < 0 {
+			return fmt.Errorf("invalid --accept-rate-wait %v", connServerAcceptRateWait)
+		}
+		wshremote.SetAcceptRateLimiter(wshremote.MakeAcceptRateLimiter(rate, burst, connServerAcceptRateWait))
+	}
+	if connServerMaxBufferMemory < 0 {
+		return fmt.Errorf("invalid --max-buffer-memory %d", connServerMaxBufferMemory)
+	}
+	if connServerMaxInflight < 0 {
+		return fmt.Errorf("invalid --max-inflight-per-route %d", connServerMaxInflight)
+	}
+	if connServerBackpressureHigh < 0 || connServerBackpressureLow < 0 {
+		return fmt.Errorf("invalid --backpressure-high/--backpressure-low %d/%d", connServerBackpressureHigh, connServerBackpressureLow)
+	}
+	if connServerLogFile == "" && (connServerLogMaxSize != 0 || cmd.Flags().Changed("log-keep")) {
+		return fmt.Errorf("--log-max-size and --log-keep require --log-file")
+	}
+	if connServerLogMaxSize < 0 {
+		return fmt.Errorf("invalid --log-max-size %d", connServerLogMaxSize)
+	}
+	if connServerLogKeep < 0 || connServerLogKeep > logfile.MaxKeep {
+		return fmt.Errorf("invalid --log-keep %d (must be between 0 and %d)", connServerLogKeep, logfile.MaxKeep)
+	}
+	if connServerDeadmanInterval != 0 {
+		if _, err := wshutil.NegotiateDeadman(connServerDeadmanInterval, 0); err != nil {
+			return fmt.Errorf("invalid --deadman-interval: %w", err)
+		}
+	}
+	if len(commandLimits) > 0 {
+		connServerCommandLimiter = wshutil.MakeCommandLimiter(commandLimits, connServerCommandQueueSize)
+		log.Printf("command concurrency limits: %s (queue %d)\n", connServerCommandLimiter, connServerCommandQueueSize)
+	}
+	if connServerResume {
+		resumed, err := runResumeClient()
+		if resumed || err != nil {
+			return err
+		}
+	}
+	if connServerDaemon && !connServerDaemonChild {
+		return runDaemonClient()
+	}
+	if connServerDaemonChild {
+		if err := acquireDaemonLock(); err != nil {
+			return err
+		}
+		// for a failed startup, a shutdown removes it in its final phase
+		defer removeDaemonState()
+	}
+	connServerState.NeedsListener = connServerRouter
+	wshremote.InstallPanicEvents()
+	wshutil.AddShutdownStep(wshutil.ShutdownPhase_Final, "flushlogs", func(ctx context.Context) {
+		ratelog.Flush()
+	})
+	wshutil.InstallShutdownSignalHandlers(false, connServerShutdownGrace)
+	err = startConnServerHttpServer(connServerHealthAddr, connServerMetricsSocket)
+	if err != nil {
+		return err
+	}
 	if connServerRouter {
-		return serverRunRouter()
+		return serverRunRouter(sysInfoOpts)
 	} else {
-		return serverRunNormal()
+		return serverRunNormal(sysInfoOpts)
 	}
 }
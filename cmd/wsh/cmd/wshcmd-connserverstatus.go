@@ -0,0 +1,49 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var connServerStatusConn string
+
+var connServerStatusCmd = &cobra.Command{
+	Use:               "connserver-status",
+	Short:             "print the routes and connections of a running connserver as json",
+	RunE:              connServerStatusRun,
+	PersistentPreRunE: preRunSetupRpcClient,
+	Hidden:            true,
+}
+
+func init() {
+	connServerStatusCmd.Flags().StringVarP(&connServerStatusConn, "connection", "c", "", "connection whose connserver to query (defaults to the current connection)")
+	rootCmd.AddCommand(connServerStatusCmd)
+}
+
+func connServerStatusRun(cmd *cobra.Command, args []string) error {
+	connName := connServerStatusConn
+	if connName == "" {
+		connName = RpcContext.Conn
+	}
+	if connName == "" {
+		return fmt.Errorf("not running on a remote connection, use --connection")
+	}
+	routeInfo, err := wshclient.RouteInfoCommand(RpcClient, &wshrpc.RpcOpts{Route: wshutil.MakeConnectionRouteId(connName), Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("getting connserver route info: %w", err)
+	}
+	barr, err := json.MarshalIndent(routeInfo, "", "  ")
+	if err != nil {
+		return err
+	}
+	WriteStdout("%s\n", string(barr))
+	return nil
+}
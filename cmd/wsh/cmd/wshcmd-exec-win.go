@@ -0,0 +1,33 @@
+//go:build windows
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"time"
+)
+
+const execResizePollInterval = 250 * time.Millisecond
+
+// windows has no resize signal, resizeFn is called periodically (it checks the size itself).
+// returns the function that stops watching
+func watchTermResize(resizeFn func()) func() {
+	ticker := time.NewTicker(execResizePollInterval)
+	doneCh := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				resizeFn()
+			case <-doneCh:
+				return
+			}
+		}
+	}()
+	return func() {
+		ticker.Stop()
+		close(doneCh)
+	}
+}
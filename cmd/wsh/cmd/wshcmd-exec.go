@@ -0,0 +1,197 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+	"golang.org/x/term"
+)
+
+const execStreamTimeoutMs = math.MaxInt32 // the stream lives until the command exits
+const execCallTimeoutMs = 30000
+const execReadBufSize = 32 * 1024
+
+var execConn string
+var execPty bool
+var execNoPty bool
+var execCwd string
+var execEnv []string
+
+var execCmd = &cobra.Command{
+	Use:   "exec [flags] [--] command [args...]",
+	Short: "run a command on a connection",
+	Long: `run a command on a connection through its connserver (like ssh host command), without opening a block.
+stdin is forwarded and the command's exit code is wsh's exit code.  the command runs on a pty when stdin
+and stdout are terminals (force with -t, disable with -T), the pty follows the size of the local terminal.
+the command is not run through a shell, use "sh -c '...'" for pipes and globs.`,
+	Args:    cobra.MinimumNArgs(1),
+	RunE:    execRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	flags := execCmd.Flags()
+	// everything after the command is its own args
+	flags.SetInterspersed(false)
+	flags.StringVarP(&execConn, "connection", "c", "", "connection to run the command on (defaults to the current connection)")
+	flags.StringVar(&execConn, "conn", "", "alias for --connection")
+	flags.MarkHidden("conn")
+	flags.BoolVarP(&execPty, "pty", "t", false, "run the command on a pty even if stdin/stdout are not terminals")
+	flags.BoolVarP(&execNoPty, "no-pty", "T", false, "never run the command on a pty")
+	flags.StringVar(&execCwd, "cwd", "", "working directory for the command (defaults to the route's cwd)")
+	flags.StringArrayVarP(&execEnv, "env", "e", nil, "set an environment variable for the command (KEY=VALUE)")
+	rootCmd.AddCommand(execCmd)
+}
+
+func parseExecEnv(envArgs []string) (map[string]string, error) {
+	env := make(map[string]string)
+	for _, envArg := range envArgs {
+		key, value, ok := strings.Cut(envArg, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid env %q (expected KEY=VALUE)", envArg)
+		}
+		env[key] = value
+	}
+	return env, nil
+}
+
+func getExecTermSize(fd int) *waveobj.TermSize {
+	cols, rows, err := term.GetSize(fd)
+	if err != nil || rows <= 0 || cols <= 0 {
+		return nil
+	}
+	return &waveobj.TermSize{Rows: rows, Cols: cols}
+}
+
+// forwards stdin until eof (which is forwarded too) or until the session is gone
+func pumpExecStdin(execId string, opts *wshrpc.RpcOpts) {
+	buf := make([]byte, execReadBufSize)
+	for {
+		n, err := WrappedStdin.Read(buf)
+		if n > 0 {
+			data := wshrpc.CommandExecInputData{ExecId: execId, Data64: base64.StdEncoding.EncodeToString(buf[:n])}
+			if rpcErr := wshclient.ExecInputCommand(RpcClient, data, opts); rpcErr != nil {
+				return
+			}
+		}
+		if err != nil {
+			wshclient.ExecInputCommand(RpcClient, wshrpc.CommandExecInputData{ExecId: execId, Eof: true}, opts)
+			return
+		}
+	}
+}
+
+func execRun(cmd *cobra.Command, args []string) (rtnErr error) {
+	defer func() {
+		sendActivity("exec", rtnErr == nil)
+	}()
+	if execPty && execNoPty {
+		return fmt.Errorf("cannot use both --pty and --no-pty")
+	}
+	connName := execConn
+	if connName == "" {
+		connName = RpcContext.Conn
+	}
+	if connName == "" {
+		return fmt.Errorf("not running on a remote connection, use --connection")
+	}
+	env, err := parseExecEnv(execEnv)
+	if err != nil {
+		return err
+	}
+	stdinFd := int(os.Stdin.Fd())
+	stdoutFd := int(os.Stdout.Fd())
+	usePty := (term.IsTerminal(stdinFd) && term.IsTerminal(stdoutFd) && !execNoPty) || execPty
+	data := wshrpc.CommandExecData{Cmd: args[0], Args: args[1:], Cwd: execCwd, Env: env, Pty: usePty}
+	if usePty {
+		data.TermSize = getExecTermSize(stdoutFd)
+		if _, ok := env["TERM"]; !ok {
+			termName := os.Getenv("TERM")
+			if termName == "" {
+				termName = "xterm-256color"
+			}
+			env["TERM"] = termName
+		}
+		if term.IsTerminal(stdinFd) {
+			// keys (including ^C) go to the remote terminal
+			wshutil.SetTermRawMode()
+			defer wshutil.RestoreTermState()
+		}
+	}
+	route := wshutil.MakeConnectionRouteId(connName)
+	ch := wshclient.ExecCommand(RpcClient, data, &wshrpc.RpcOpts{Route: route, Timeout: execStreamTimeoutMs})
+	first, ok := <-ch
+	if !ok {
+		return errors.New("exec stream ended")
+	}
+	if first.Error != nil {
+		return fmt.Errorf("cannot run %q on %q: %w", data.Cmd, connName, first.Error)
+	}
+	execId := first.Response.ExecId
+	callOpts := &wshrpc.RpcOpts{Route: route, Timeout: execCallTimeoutMs}
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sigCh)
+	go func() {
+		// the stream still ends with the exit packet
+		<-sigCh
+		wshclient.KillExecCommand(RpcClient, wshrpc.CommandKillExecData{ExecId: execId}, callOpts)
+	}()
+	if usePty && term.IsTerminal(stdoutFd) {
+		lastSize := data.TermSize
+		stopResize := watchTermResize(func() {
+			termSize := getExecTermSize(stdoutFd)
+			if termSize == nil || (lastSize != nil && *termSize == *lastSize) {
+				return
+			}
+			lastSize = termSize
+			wshclient.ExecInputCommand(RpcClient, wshrpc.CommandExecInputData{ExecId: execId, TermSize: termSize}, callOpts)
+		})
+		defer stopResize()
+	}
+	go pumpExecStdin(execId, callOpts)
+	for resp := range ch {
+		if resp.Error != nil {
+			return fmt.Errorf("%q on %q: %w", data.Cmd, connName, resp.Error)
+		}
+		pkt := resp.Response
+		if pkt.Data64 != "" {
+			barr, err := base64.StdEncoding.DecodeString(pkt.Data64)
+			if err != nil {
+				continue
+			}
+			switch {
+			case usePty:
+				// the remote terminal already translates newlines
+				os.Stdout.Write(barr)
+			case pkt.Stream == wshrpc.ExecStream_Stderr:
+				WrappedStderr.Write(barr)
+			default:
+				WrappedStdout.Write(barr)
+			}
+		}
+		if pkt.Exited {
+			WshExitCode = pkt.ExitCode
+			if WshExitCode < 0 {
+				// killed by a signal
+				WshExitCode = 1
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("exec stream for %q on %q ended before the command exited", data.Cmd, connName)
+}
@@ -0,0 +1,324 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const forwardStreamTimeoutMs = math.MaxInt32 // the streams live until wsh forward exits
+const forwardCallTimeoutMs = 30000
+const forwardLocalDialTimeout = 5 * time.Second
+const forwardReadBufSize = 32 * 1024
+
+var forwardLocalSpecs []string
+var forwardRemoteSpecs []string
+var forwardConn string
+
+var forwardCmd = &cobra.Command{
+	Use:   "forward [-L [bind:]port:host:hostport]... [-R [bind:]port:host:hostport]...",
+	Short: "forward tcp ports through a connection",
+	Long: `forward tcp ports through a connection (like ssh -L/-R).
+-L listens locally and connects to host:hostport from the remote side,
+-R listens on the remote side (loopback only) and connects to host:hostport locally.
+the bind address defaults to 127.0.0.1.  runs until interrupted.`,
+	Args:    cobra.NoArgs,
+	RunE:    forwardRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	forwardCmd.Flags().StringArrayVarP(&forwardLocalSpecs, "local", "L", nil, "forward a local port to host:hostport on the remote side")
+	forwardCmd.Flags().StringArrayVarP(&forwardRemoteSpecs, "remote", "R", nil, "forward a remote port to host:hostport on this side")
+	forwardCmd.Flags().StringVarP(&forwardConn, "connection", "c", "", "connection to forward through (defaults to the current connection)")
+	rootCmd.AddCommand(forwardCmd)
+}
+
+// splits on colons outside of brackets, so ipv6 addresses can be given as [::1]
+func splitForwardSpec(spec string) []string {
+	var fields []string
+	var cur strings.Builder
+	inBrackets := false
+	for _, ch := range spec {
+		switch {
+		case ch == '[':
+			inBrackets = true
+		case ch == ']':
+			inBrackets = false
+		case ch == ':' && !inBrackets:
+			fields = append(fields, cur.String())
+			cur.Reset()
+			continue
+		}
+		cur.WriteRune(ch)
+	}
+	return append(fields, cur.String())
+}
+
+func parseForwardPort(port string, allowZero bool) error {
+	portNum, err := strconv.Atoi(port)
+	if err != nil || portNum < 0 || portNum > 65535 || (portNum == 0 && !allowZero) {
+		return fmt.Errorf("invalid port %q", port)
+	}
+	return nil
+}
+
+// "[bind:]port:host:hostport" => the listen address and the target address
+func parseForwardSpec(spec string) (string, string, error) {
+	fields := splitForwardSpec(spec)
+	if len(fields) == 3 {
+		fields = append([]string{"127.0.0.1"}, fields...)
+	}
+	if len(fields) != 4 {
+		return "", "", fmt.Errorf("invalid forward %q (expected [bind:]port:host:hostport)", spec)
+	}
+	for idx, field := range fields {
+		fields[idx] = strings.TrimSuffix(strings.TrimPrefix(field, "["), "]")
+	}
+	if fields[0] == "" || fields[2] == "" {
+		return "", "", fmt.Errorf("invalid forward %q (empty host)", spec)
+	}
+	if err := parseForwardPort(fields[1], true); err != nil {
+		return "", "", fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+	if err := parseForwardPort(fields[3], false); err != nil {
+		return "", "", fmt.Errorf("invalid forward %q: %w", spec, err)
+	}
+	return net.JoinHostPort(fields[0], fields[1]), net.JoinHostPort(fields[2], fields[3]), nil
+}
+
+type forwardClient struct {
+	route      string
+	lock       sync.Mutex
+	forwardIds map[string]bool // active forwards, stopped on exit
+}
+
+func (fc *forwardClient) callOpts() *wshrpc.RpcOpts {
+	return &wshrpc.RpcOpts{Route: fc.route, Timeout: forwardCallTimeoutMs}
+}
+
+func (fc *forwardClient) start(data wshrpc.CommandForwardStartData) (chan wshrpc.RespOrErrorUnion[wshrpc.ForwardPacketData], *wshrpc.ForwardPacketData, error) {
+	ch := wshclient.ForwardStartCommand(RpcClient, data, &wshrpc.RpcOpts{Route: fc.route, Timeout: forwardStreamTimeoutMs})
+	first, ok := <-ch
+	if !ok {
+		return nil, nil, errors.New("forward stream ended")
+	}
+	if first.Error != nil {
+		return nil, nil, first.Error
+	}
+	fc.lock.Lock()
+	fc.forwardIds[first.Response.ForwardId] = true
+	fc.lock.Unlock()
+	return ch, &first.Response, nil
+}
+
+func (fc *forwardClient) done(forwardId string) {
+	fc.lock.Lock()
+	defer fc.lock.Unlock()
+	delete(fc.forwardIds, forwardId)
+}
+
+func (fc *forwardClient) stopAll() {
+	fc.lock.Lock()
+	forwardIds := make([]string, 0, len(fc.forwardIds))
+	for forwardId := range fc.forwardIds {
+		forwardIds = append(forwardIds, forwardId)
+	}
+	fc.lock.Unlock()
+	for _, forwardId := range forwardIds {
+		wshclient.ForwardStopCommand(RpcClient, wshrpc.CommandForwardStopData{ForwardId: forwardId}, &wshrpc.RpcOpts{Route: fc.route, Timeout: 2000})
+	}
+}
+
+// copies the local connection to the remote one, each chunk is acknowledged before the next is sent
+func (fc *forwardClient) pumpToRemote(conn net.Conn, forwardId string, connId string) {
+	buf := make([]byte, forwardReadBufSize)
+	for {
+		n, err := conn.Read(buf)
+		if n > 0 {
+			data := wshrpc.CommandForwardDataData{ForwardId: forwardId, ConnId: connId, Data64: base64.StdEncoding.EncodeToString(buf[:n])}
+			if rpcErr := wshclient.ForwardDataCommand(RpcClient, data, fc.callOpts()); rpcErr != nil {
+				conn.Close()
+				return
+			}
+		}
+		if err != nil {
+			data := wshrpc.CommandForwardDataData{ForwardId: forwardId, ConnId: connId}
+			if errors.Is(err, io.EOF) {
+				data.Eof = true
+			} else {
+				data.Close = true
+			}
+			wshclient.ForwardDataCommand(RpcClient, data, fc.callOpts())
+			return
+		}
+	}
+}
+
+// applies a data/eof/closed packet to its local connection, returns false once the connection is gone
+func (fc *forwardClient) handlePacket(forwardId string, conn net.Conn, pkt wshrpc.ForwardPacketData) bool {
+	if pkt.Data64 != "" {
+		barr, err := base64.StdEncoding.DecodeString(pkt.Data64)
+		if err == nil {
+			_, err = conn.Write(barr)
+		}
+		if err != nil {
+			conn.Close()
+			wshclient.ForwardDataCommand(RpcClient, wshrpc.CommandForwardDataData{ForwardId: forwardId, ConnId: pkt.ConnId, Close: true}, fc.callOpts())
+			return false
+		}
+	}
+	if pkt.Eof {
+		if tcpConn, ok := conn.(*net.TCPConn); ok {
+			tcpConn.CloseWrite()
+		}
+	}
+	if pkt.Closed {
+		conn.Close()
+		return false
+	}
+	return true
+}
+
+// -L, a dial forward per accepted connection
+func (fc *forwardClient) handleLocalConn(conn net.Conn, targetAddr string) {
+	defer conn.Close()
+	ch, first, err := fc.start(wshrpc.CommandForwardStartData{Mode: wshrpc.ForwardMode_Dial, Addr: targetAddr})
+	if err != nil {
+		WriteStderr("[forward] cannot connect to %s: %v\n", targetAddr, err)
+		return
+	}
+	defer fc.done(first.ForwardId)
+	open := true
+	for resp := range ch {
+		if resp.Error != nil {
+			WriteStderr("[forward] %s: %v\n", targetAddr, resp.Error)
+			continue
+		}
+		if resp.Response.Opened {
+			go fc.pumpToRemote(conn, first.ForwardId, resp.Response.ConnId)
+			continue
+		}
+		if open {
+			open = fc.handlePacket(first.ForwardId, conn, resp.Response)
+		}
+	}
+}
+
+func (fc *forwardClient) runLocalForward(ctx context.Context, listener net.Listener, targetAddr string) {
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		go fc.handleLocalConn(conn, targetAddr)
+	}
+}
+
+// -R, one listen forward, every remote connection is dialed locally
+func (fc *forwardClient) runRemoteForward(ch chan wshrpc.RespOrErrorUnion[wshrpc.ForwardPacketData], first *wshrpc.ForwardPacketData, targetAddr string) error {
+	defer fc.done(first.ForwardId)
+	conns := make(map[string]net.Conn)
+	for resp := range ch {
+		if resp.Error != nil {
+			return fmt.Errorf("remote forward %s: %w", first.Addr, resp.Error)
+		}
+		pkt := resp.Response
+		if pkt.Opened {
+			conn, err := net.DialTimeout("tcp", targetAddr, forwardLocalDialTimeout)
+			if err != nil {
+				WriteStderr("[forward] cannot connect to %s (for %s): %v\n", targetAddr, pkt.PeerAddr, err)
+				wshclient.ForwardDataCommand(RpcClient, wshrpc.CommandForwardDataData{ForwardId: first.ForwardId, ConnId: pkt.ConnId, Close: true}, fc.callOpts())
+				continue
+			}
+			conns[pkt.ConnId] = conn
+			go fc.pumpToRemote(conn, first.ForwardId, pkt.ConnId)
+			continue
+		}
+		conn := conns[pkt.ConnId]
+		if conn == nil {
+			continue
+		}
+		if !fc.handlePacket(first.ForwardId, conn, pkt) {
+			delete(conns, pkt.ConnId)
+		}
+	}
+	for _, conn := range conns {
+		conn.Close()
+	}
+	return fmt.Errorf("remote forward %s ended", first.Addr)
+}
+
+func forwardRun(cmd *cobra.Command, args []string) error {
+	if len(forwardLocalSpecs) == 0 && len(forwardRemoteSpecs) == 0 {
+		OutputHelpMessage(cmd)
+		return fmt.Errorf("no forwards given, use -L or -R")
+	}
+	connName := forwardConn
+	if connName == "" {
+		connName = RpcContext.Conn
+	}
+	if connName == "" {
+		return fmt.Errorf("not running on a remote connection, use --connection")
+	}
+	ctx, cancelFn := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelFn()
+	fc := &forwardClient{route: wshutil.MakeConnectionRouteId(connName), forwardIds: make(map[string]bool)}
+	defer fc.stopAll()
+	errCh := make(chan error, len(forwardRemoteSpecs))
+	for _, spec := range forwardLocalSpecs {
+		listenAddr, targetAddr, err := parseForwardSpec(spec)
+		if err != nil {
+			return err
+		}
+		listener, err := net.Listen("tcp", listenAddr)
+		if err != nil {
+			return fmt.Errorf("cannot listen on %s: %w", listenAddr, err)
+		}
+		WriteStderr("forwarding %s to %s on %q\n", listener.Addr(), targetAddr, connName)
+		go fc.runLocalForward(ctx, listener, targetAddr)
+	}
+	for _, spec := range forwardRemoteSpecs {
+		listenAddr, targetAddr, err := parseForwardSpec(spec)
+		if err != nil {
+			return err
+		}
+		ch, first, err := fc.start(wshrpc.CommandForwardStartData{Mode: wshrpc.ForwardMode_Listen, Addr: listenAddr})
+		if err != nil {
+			return fmt.Errorf("cannot listen on %s on %q: %w", listenAddr, connName, err)
+		}
+		WriteStderr("forwarding %s on %q to %s\n", first.Addr, connName, targetAddr)
+		go func() {
+			errCh <- fc.runRemoteForward(ch, first, targetAddr)
+		}()
+	}
+	select {
+	case <-ctx.Done():
+		return nil
+	case err := <-errCh:
+		return err
+	}
+}
@@ -25,6 +25,9 @@ var (
 	}
 )
 
+// ~6s of backoff (see wshutil.DefaultReconnectInitialBackoff), about as long as a request's default timeout
+const rpcClientReconnectMaxAttempts = 6
+
 var WrappedStdin io.Reader = os.Stdin
 var WrappedStdout io.Writer = &WrappedWriter{dest: os.Stdout}
 var WrappedStderr io.Writer = &WrappedWriter{dest: os.Stderr}
@@ -145,15 +148,38 @@ func setupRpcClient(serverImpl wshutil.ServerImpl) error {
 	if err != nil {
 		return fmt.Errorf("error extracting socket name from %s: %v", wshutil.WaveJwtTokenVarName, err)
 	}
-	RpcClient, err = wshutil.SetupDomainSocketRpcClient(sockName, serverImpl)
+	// the reconnecting client sends the authenticate packet itself (again after every reconnect)
+	reconnectOpts := &wshutil.ReconnectOpts{
+		MaxAttempts: rpcClientReconnectMaxAttempts,
+		OnEvent:     writeReconnectEvent,
+	}
+	RpcClient, err = wshutil.SetupReconnectingRpcClient(wshutil.MakeDomainSocketDialer(sockName), jwtToken, serverImpl, reconnectOpts)
 	if err != nil {
 		return fmt.Errorf("error setting up domain socket rpc client: %v", err)
 	}
-	wshclient.AuthenticateCommand(RpcClient, jwtToken, &wshrpc.RpcOpts{NoResponse: true})
 	// note we don't modify WrappedStdin here (just use os.Stdin)
 	return nil
 }
 
+// the first connect is not reported, only drops and what follows them (events come from one goroutine)
+var rpcClientDropped bool
+
+func writeReconnectEvent(event wshutil.ReconnectEvent) {
+	switch event.Type {
+	case wshutil.ReconnectEvent_Connected:
+		if rpcClientDropped {
+			WriteStderr("[wsh] reconnected\n")
+		}
+	case wshutil.ReconnectEvent_Disconnected:
+		rpcClientDropped = true
+		WriteStderr("[wsh] connection to wave lost (%v)\n", event.Err)
+	case wshutil.ReconnectEvent_Reconnecting:
+		WriteStderr("[wsh] reconnecting in %v...\n", event.Delay)
+	case wshutil.ReconnectEvent_GaveUp:
+		WriteStderr("[wsh] giving up reconnecting after %d attempts (%v)\n", event.Attempt, event.Err)
+	}
+}
+
 func isFullORef(orefStr string) bool {
 	_, err := waveobj.ParseORef(orefStr)
 	return err == nil
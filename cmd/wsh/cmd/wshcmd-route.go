@@ -0,0 +1,195 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const routeTraceTimeoutMs = math.MaxInt32 // the trace runs until wsh route trace exits
+
+var routeConn string
+var routeListJson bool
+var routeTraceRouteId string
+var routeTraceCommand string
+var routeTraceJson bool
+
+var routeCmd = &cobra.Command{
+	Use:   "route",
+	Short: "inspect the routes of a connserver",
+	Long:  "Commands to inspect the routes of a connserver running in router mode",
+}
+
+var routeListCmd = &cobra.Command{
+	Use:     "list",
+	Short:   "list the registered routes with their auth state and message counts",
+	Args:    cobra.NoArgs,
+	RunE:    routeListRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+var routeTraceCmd = &cobra.Command{
+	Use:   "trace",
+	Short: "print the messages passing through the router (metadata only) until interrupted",
+	Long: `print the messages passing through the router until interrupted.
+only the metadata is shown (routes, command, ids and size), never the message data.
+requires admin authorization (wsh clients attached to the connserver itself are rejected).`,
+	Args:    cobra.NoArgs,
+	RunE:    routeTraceRun,
+	PreRunE: preRunSetupRpcClient,
+}
+
+func init() {
+	routeCmd.PersistentFlags().StringVarP(&routeConn, "connection", "c", "", "connection whose connserver to inspect (defaults to the current connection)")
+	routeListCmd.Flags().BoolVar(&routeListJson, "json", false, "print the route info as json")
+	routeTraceCmd.Flags().StringVar(&routeTraceRouteId, "route", "", "only messages from or to this route")
+	routeTraceCmd.Flags().StringVar(&routeTraceCommand, "command", "", "only requests for this command")
+	routeTraceCmd.Flags().BoolVar(&routeTraceJson, "json", false, "print one json object per message")
+	routeCmd.AddCommand(routeListCmd)
+	routeCmd.AddCommand(routeTraceCmd)
+	rootCmd.AddCommand(routeCmd)
+}
+
+func getRouteConnRoute() (string, error) {
+	connName := routeConn
+	if connName == "" {
+		connName = RpcContext.Conn
+	}
+	if connName == "" {
+		return "", fmt.Errorf("not running on a remote connection, use --connection")
+	}
+	return wshutil.MakeConnectionRouteId(connName), nil
+}
+
+func formatRouteTs(ts int64) string {
+	if ts == 0 {
+		return "-"
+	}
+	return time.UnixMilli(ts).Format("15:04:05")
+}
+
+func routeListRun(cmd *cobra.Command, args []string) error {
+	route, err := getRouteConnRoute()
+	if err != nil {
+		return err
+	}
+	routeInfo, err := wshclient.RouteInfoCommand(RpcClient, &wshrpc.RpcOpts{Route: route, Timeout: 5000})
+	if err != nil {
+		return fmt.Errorf("getting connserver route info: %w", err)
+	}
+	if routeListJson {
+		barr, err := json.MarshalIndent(routeInfo, "", "  ")
+		if err != nil {
+			return err
+		}
+		WriteStdout("%s\n", string(barr))
+		return nil
+	}
+	if len(routeInfo.Routes) == 0 {
+		WriteStdout("no routes\n")
+		return nil
+	}
+	WriteStdout("%-40s %-8s %-6s %8s %8s %7s %-9s %-12s %s\n", "route", "kind", "auth", "in", "out", "dropped", "active", "policy", "scope")
+	WriteStdout("%s\n", strings.Repeat("-", 113))
+	for _, r := range routeInfo.Routes {
+		auth := r.AuthState
+		if auth == "" {
+			auth = "-"
+		}
+		policyRule := r.PolicyRule
+		if policyRule == "" {
+			policyRule = "-"
+		}
+		scope := "-"
+		if len(r.Scope) > 0 {
+			scope = strings.Join(r.Scope, ",")
+		}
+		WriteStdout("%-40s %-8s %-6s %8d %8d %7d %-9s %-12s %s\n", r.RouteId, r.Kind, auth, r.MsgsIn, r.MsgsOut, r.Dropped, formatRouteTs(r.LastActivityTs), policyRule, scope)
+	}
+	WriteStdout("%d routes (%d proxy, %d local), %d open connections\n", routeInfo.NumRoutes, routeInfo.NumProxy, routeInfo.NumLocal, routeInfo.Conns)
+	return nil
+}
+
+func formatRouteTrace(event wshrpc.RouteTraceData) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s %s -> ", time.UnixMilli(event.Ts).Format("15:04:05.000"), event.From)
+	if event.To != "" {
+		sb.WriteString(event.To)
+	} else {
+		fmt.Fprintf(&sb, "(dropped: %s)", event.Dropped)
+	}
+	switch {
+	case event.Command != "":
+		fmt.Fprintf(&sb, " command=%s route=%s", event.Command, event.Route)
+		if event.ReqId != "" {
+			fmt.Fprintf(&sb, " reqid=%s", event.ReqId)
+		}
+	case event.ReqId != "":
+		fmt.Fprintf(&sb, " reqid=%s (cancel)", event.ReqId)
+	case event.ResId != "":
+		fmt.Fprintf(&sb, " resid=%s", event.ResId)
+		if event.Cont {
+			sb.WriteString(" cont")
+		}
+		if event.Error {
+			sb.WriteString(" error")
+		}
+	}
+	fmt.Fprintf(&sb, " size=%d", event.Size)
+	if event.Missed > 0 {
+		fmt.Fprintf(&sb, " (%d missed)", event.Missed)
+	}
+	return sb.String()
+}
+
+func routeTraceRun(cmd *cobra.Command, args []string) error {
+	route, err := getRouteConnRoute()
+	if err != nil {
+		return err
+	}
+	ctx, cancelFn := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancelFn()
+	data := wshrpc.CommandRouteTraceData{RouteId: routeTraceRouteId, Command: routeTraceCommand}
+	opts := &wshrpc.RpcOpts{Route: route, Timeout: routeTraceTimeoutMs}
+	ch := wshclient.RouteTraceCommand(RpcClient, data, opts)
+	for {
+		select {
+		case <-ctx.Done():
+			if opts.StreamCancelFn != nil {
+				// ends the subscription on the connserver
+				opts.StreamCancelFn()
+			}
+			return nil
+		case resp, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("route trace ended")
+			}
+			if resp.Error != nil {
+				return fmt.Errorf("route trace: %w", resp.Error)
+			}
+			if routeTraceJson {
+				barr, err := json.Marshal(resp.Response)
+				if err != nil {
+					return err
+				}
+				WriteStdout("%s\n", string(barr))
+				continue
+			}
+			WriteStdout("%s\n", formatRouteTrace(resp.Response))
+		}
+	}
+}
@@ -22,11 +22,36 @@ class RpcApiType {
         return client.wshRpcCall("authenticate", data, opts);
     }
 
+    // command "batch" [call]
+    BatchCommand(client: WshClient, data: CommandBatchData, opts?: RpcOpts): Promise<CommandBatchRtnData> {
+        return client.wshRpcCall("batch", data, opts);
+    }
+
     // command "blockinfo" [call]
     BlockInfoCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<BlockInfoData> {
         return client.wshRpcCall("blockinfo", data, opts);
     }
 
+    // command "broadcast" [call]
+    BroadcastCommand(client: WshClient, data: CommandBroadcastData, opts?: RpcOpts): Promise<CommandBroadcastRtnData> {
+        return client.wshRpcCall("broadcast", data, opts);
+    }
+
+    // command "capabilities" [call]
+    CapabilitiesCommand(client: WshClient, opts?: RpcOpts): Promise<CommandCapabilitiesRtnData> {
+        return client.wshRpcCall("capabilities", null, opts);
+    }
+
+    // command "cgrouplimits" [call]
+    CgroupLimitsCommand(client: WshClient, opts?: RpcOpts): Promise<CgroupLimitsData> {
+        return client.wshRpcCall("cgrouplimits", null, opts);
+    }
+
+    // command "checkwritable" [call]
+    CheckWritableCommand(client: WshClient, data: CommandCheckWritableData, opts?: RpcOpts): Promise<CheckWritableRtnData> {
+        return client.wshRpcCall("checkwritable", data, opts);
+    }
+
     // command "connconnect" [call]
     ConnConnectCommand(client: WshClient, data: ConnRequest, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("connconnect", data, opts);
@@ -72,6 +97,11 @@ class RpcApiType {
         return client.wshRpcCall("controllerstop", data, opts);
     }
 
+    // command "cpudetail" [call]
+    CpuDetailCommand(client: WshClient, opts?: RpcOpts): Promise<CpuDetailData> {
+        return client.wshRpcCall("cpudetail", null, opts);
+    }
+
     // command "createblock" [call]
     CreateBlockCommand(client: WshClient, data: CommandCreateBlockData, opts?: RpcOpts): Promise<ORef> {
         return client.wshRpcCall("createblock", data, opts);
@@ -92,6 +122,11 @@ class RpcApiType {
         return client.wshRpcCall("deletesubblock", data, opts);
     }
 
+    // command "diskusage" [call]
+    DiskUsageCommand(client: WshClient, data: CommandDiskUsageData, opts?: RpcOpts): Promise<CommandDiskUsageRtnData> {
+        return client.wshRpcCall("diskusage", data, opts);
+    }
+
     // command "dismisswshfail" [call]
     DismissWshFailCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("dismisswshfail", data, opts);
@@ -102,6 +137,11 @@ class RpcApiType {
         return client.wshRpcCall("dispose", data, opts);
     }
 
+    // command "entropyinfo" [call]
+    EntropyInfoCommand(client: WshClient, opts?: RpcOpts): Promise<EntropyInfoData> {
+        return client.wshRpcCall("entropyinfo", null, opts);
+    }
+
     // command "eventpublish" [call]
     EventPublishCommand(client: WshClient, data: WaveEvent, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("eventpublish", data, opts);
@@ -132,6 +172,21 @@ class RpcApiType {
         return client.wshRpcCall("eventunsuball", null, opts);
     }
 
+    // command "exec" [responsestream]
+	ExecCommand(client: WshClient, data: CommandExecData, opts?: RpcOpts): AsyncGenerator<ExecOutputData, void, boolean> {
+        return client.wshRpcStream("exec", data, opts);
+    }
+
+    // command "execinput" [call]
+    ExecInputCommand(client: WshClient, data: CommandExecInputData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("execinput", data, opts);
+    }
+
+    // command "fdinfo" [call]
+    FdInfoCommand(client: WshClient, opts?: RpcOpts): Promise<FdInfoData> {
+        return client.wshRpcCall("fdinfo", null, opts);
+    }
+
     // command "fileappend" [call]
     FileAppendCommand(client: WshClient, data: CommandFileData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("fileappend", data, opts);
@@ -142,6 +197,11 @@ class RpcApiType {
         return client.wshRpcCall("fileappendijson", data, opts);
     }
 
+    // command "filechecksum" [call]
+    FileChecksumCommand(client: WshClient, data: CommandFileChecksumData, opts?: RpcOpts): Promise<FileChecksumData> {
+        return client.wshRpcCall("filechecksum", data, opts);
+    }
+
     // command "filecreate" [call]
     FileCreateCommand(client: WshClient, data: CommandFileCreateData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("filecreate", data, opts);
@@ -167,6 +227,36 @@ class RpcApiType {
         return client.wshRpcCall("fileread", data, opts);
     }
 
+    // command "filesubscribe" [call]
+    FileSubscribeCommand(client: WshClient, data: CommandFileSubscribeData, opts?: RpcOpts): Promise<CommandFileSubscribeRtnData> {
+        return client.wshRpcCall("filesubscribe", data, opts);
+    }
+
+    // command "filetail" [responsestream]
+	FileTailCommand(client: WshClient, data: CommandFileTailData, opts?: RpcOpts): AsyncGenerator<FileTailData, void, boolean> {
+        return client.wshRpcStream("filetail", data, opts);
+    }
+
+    // command "filetransferread" [responsestream]
+	FileTransferReadCommand(client: WshClient, data: CommandFileTransferReadData, opts?: RpcOpts): AsyncGenerator<FileTransferChunkData, void, boolean> {
+        return client.wshRpcStream("filetransferread", data, opts);
+    }
+
+    // command "filetransferwrite" [call]
+    FileTransferWriteCommand(client: WshClient, data: CommandFileTransferWriteData, opts?: RpcOpts): Promise<FileTransferWriteRtnData> {
+        return client.wshRpcCall("filetransferwrite", data, opts);
+    }
+
+    // command "fileunsubscribe" [call]
+    FileUnsubscribeCommand(client: WshClient, data: CommandFileUnsubscribeData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("fileunsubscribe", data, opts);
+    }
+
+    // command "filewatch" [responsestream]
+	FileWatchCommand(client: WshClient, data: CommandFileWatchData, opts?: RpcOpts): AsyncGenerator<FileWatchEventData, void, boolean> {
+        return client.wshRpcStream("filewatch", data, opts);
+    }
+
     // command "filewrite" [call]
     FileWriteCommand(client: WshClient, data: CommandFileData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("filewrite", data, opts);
@@ -177,11 +267,56 @@ class RpcApiType {
         return client.wshRpcCall("focuswindow", data, opts);
     }
 
+    // command "forwarddata" [call]
+    ForwardDataCommand(client: WshClient, data: CommandForwardDataData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("forwarddata", data, opts);
+    }
+
+    // command "forwardstart" [responsestream]
+	ForwardStartCommand(client: WshClient, data: CommandForwardStartData, opts?: RpcOpts): AsyncGenerator<ForwardPacketData, void, boolean> {
+        return client.wshRpcStream("forwardstart", data, opts);
+    }
+
+    // command "forwardstop" [call]
+    ForwardStopCommand(client: WshClient, data: CommandForwardStopData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("forwardstop", data, opts);
+    }
+
+    // command "getcwd" [call]
+    GetCwdCommand(client: WshClient, opts?: RpcOpts): Promise<CwdData> {
+        return client.wshRpcCall("getcwd", null, opts);
+    }
+
     // command "getmeta" [call]
     GetMetaCommand(client: WshClient, data: CommandGetMetaData, opts?: RpcOpts): Promise<MetaType> {
         return client.wshRpcCall("getmeta", data, opts);
     }
 
+    // command "getpriority" [call]
+    GetPriorityCommand(client: WshClient, data: CommandGetPriorityData, opts?: RpcOpts): Promise<PriorityData> {
+        return client.wshRpcCall("getpriority", data, opts);
+    }
+
+    // command "getserverconfig" [call]
+    GetServerConfigCommand(client: WshClient, opts?: RpcOpts): Promise<ConnServerConfigData> {
+        return client.wshRpcCall("getserverconfig", null, opts);
+    }
+
+    // command "getsysinfocollectors" [call]
+    GetSysInfoCollectorsCommand(client: WshClient, opts?: RpcOpts): Promise<CommandSysInfoCollectorsRtnData> {
+        return client.wshRpcCall("getsysinfocollectors", null, opts);
+    }
+
+    // command "getsysinfointerval" [call]
+    GetSysInfoIntervalCommand(client: WshClient, opts?: RpcOpts): Promise<CommandSysInfoIntervalData> {
+        return client.wshRpcCall("getsysinfointerval", null, opts);
+    }
+
+    // command "gettoggle" [call]
+    GetToggleCommand(client: WshClient, data: CommandGetToggleData, opts?: RpcOpts): Promise<CommandToggleRtnData> {
+        return client.wshRpcCall("gettoggle", data, opts);
+    }
+
     // command "getupdatechannel" [call]
     GetUpdateChannelCommand(client: WshClient, opts?: RpcOpts): Promise<string> {
         return client.wshRpcCall("getupdatechannel", null, opts);
@@ -192,6 +327,56 @@ class RpcApiType {
         return client.wshRpcCall("getvar", data, opts);
     }
 
+    // command "gpuinfo" [responsestream]
+	GpuInfoCommand(client: WshClient, data: CommandGpuInfoData, opts?: RpcOpts): AsyncGenerator<GpuInfoData, void, boolean> {
+        return client.wshRpcStream("gpuinfo", data, opts);
+    }
+
+    // command "journaltail" [responsestream]
+	JournalTailCommand(client: WshClient, data: CommandJournalTailData, opts?: RpcOpts): AsyncGenerator<JournalTailData, void, boolean> {
+        return client.wshRpcStream("journaltail", data, opts);
+    }
+
+    // command "keepalive" [call]
+    KeepaliveCommand(client: WshClient, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("keepalive", null, opts);
+    }
+
+    // command "killexec" [call]
+    KillExecCommand(client: WshClient, data: CommandKillExecData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("killexec", data, opts);
+    }
+
+    // command "listexec" [call]
+    ListExecCommand(client: WshClient, opts?: RpcOpts): Promise<CommandListExecRtnData> {
+        return client.wshRpcCall("listexec", null, opts);
+    }
+
+    // command "listlisteners" [call]
+    ListListenersCommand(client: WshClient, data: CommandListListenersData, opts?: RpcOpts): Promise<CommandListListenersRtnData> {
+        return client.wshRpcCall("listlisteners", data, opts);
+    }
+
+    // command "localeinfo" [call]
+    LocaleInfoCommand(client: WshClient, opts?: RpcOpts): Promise<LocaleInfoData> {
+        return client.wshRpcCall("localeinfo", null, opts);
+    }
+
+    // command "logfile" [call]
+    LogFileCommand(client: WshClient, data: CommandLogFileData, opts?: RpcOpts): Promise<LogFileData> {
+        return client.wshRpcCall("logfile", data, opts);
+    }
+
+    // command "logtail" [call]
+    LogTailCommand(client: WshClient, data: CommandLogTailData, opts?: RpcOpts): Promise<CommandLogTailRtnData> {
+        return client.wshRpcCall("logtail", data, opts);
+    }
+
+    // command "memorypressure" [call]
+    MemoryPressureCommand(client: WshClient, opts?: RpcOpts): Promise<MemoryPressureData> {
+        return client.wshRpcCall("memorypressure", null, opts);
+    }
+
     // command "message" [call]
     MessageCommand(client: WshClient, data: CommandMessageData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("message", data, opts);
@@ -202,6 +387,36 @@ class RpcApiType {
         return client.wshRpcCall("notify", data, opts);
     }
 
+    // command "osinfo" [call]
+    OSInfoCommand(client: WshClient, opts?: RpcOpts): Promise<CommandOSInfoRtnData> {
+        return client.wshRpcCall("osinfo", null, opts);
+    }
+
+    // command "pauseroute" [call]
+    PauseRouteCommand(client: WshClient, data: CommandPauseRouteData, opts?: RpcOpts): Promise<PauseRouteRtnData> {
+        return client.wshRpcCall("pauseroute", data, opts);
+    }
+
+    // command "pipelinestats" [call]
+    PipelineStatsCommand(client: WshClient, opts?: RpcOpts): Promise<PipelineStatsData> {
+        return client.wshRpcCall("pipelinestats", null, opts);
+    }
+
+    // command "processwatch" [responsestream]
+	ProcessWatchCommand(client: WshClient, data: CommandProcessWatchData, opts?: RpcOpts): AsyncGenerator<ProcessWatchData, void, boolean> {
+        return client.wshRpcStream("processwatch", data, opts);
+    }
+
+    // command "quiesce" [call]
+    QuiesceCommand(client: WshClient, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("quiesce", null, opts);
+    }
+
+    // command "reloadcert" [call]
+    ReloadCertCommand(client: WshClient, opts?: RpcOpts): Promise<CommandReloadCertRtnData> {
+        return client.wshRpcCall("reloadcert", null, opts);
+    }
+
     // command "remotefiledelete" [call]
     RemoteFileDeleteCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("remotefiledelete", data, opts);
@@ -232,6 +447,11 @@ class RpcApiType {
         return client.wshRpcCall("remotemkdir", data, opts);
     }
 
+    // command "remoteprocesslist" [call]
+    RemoteProcessListCommand(client: WshClient, data: CommandRemoteProcessListData, opts?: RpcOpts): Promise<CommandRemoteProcessListRtnData> {
+        return client.wshRpcCall("remoteprocesslist", data, opts);
+    }
+
     // command "remotestreamcpudata" [responsestream]
 	RemoteStreamCpuDataCommand(client: WshClient, opts?: RpcOpts): AsyncGenerator<TimeSeriesData, void, boolean> {
         return client.wshRpcStream("remotestreamcpudata", null, opts);
@@ -247,21 +467,66 @@ class RpcApiType {
         return client.wshRpcCall("remotewritefile", data, opts);
     }
 
+    // command "resetroute" [call]
+    ResetRouteCommand(client: WshClient, data: CommandResetRouteData, opts?: RpcOpts): Promise<CommandResetRouteRtnData> {
+        return client.wshRpcCall("resetroute", data, opts);
+    }
+
+    // command "resetstats" [call]
+    ResetStatsCommand(client: WshClient, opts?: RpcOpts): Promise<CommandRouteStatsRtnData> {
+        return client.wshRpcCall("resetstats", null, opts);
+    }
+
+    // command "resolvehost" [call]
+    ResolveHostCommand(client: WshClient, data: CommandResolveHostData, opts?: RpcOpts): Promise<CommandResolveHostRtnData> {
+        return client.wshRpcCall("resolvehost", data, opts);
+    }
+
     // command "resolveids" [call]
     ResolveIdsCommand(client: WshClient, data: CommandResolveIdsData, opts?: RpcOpts): Promise<CommandResolveIdsRtnData> {
         return client.wshRpcCall("resolveids", data, opts);
     }
 
+    // command "resumeroute" [call]
+    ResumeRouteCommand(client: WshClient, data: CommandResumeRouteData, opts?: RpcOpts): Promise<PauseRouteRtnData> {
+        return client.wshRpcCall("resumeroute", data, opts);
+    }
+
     // command "routeannounce" [call]
     RouteAnnounceCommand(client: WshClient, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("routeannounce", null, opts);
     }
 
+    // command "routeinfo" [call]
+    RouteInfoCommand(client: WshClient, opts?: RpcOpts): Promise<CommandRouteInfoRtnData> {
+        return client.wshRpcCall("routeinfo", null, opts);
+    }
+
+    // command "routestats" [call]
+    RouteStatsCommand(client: WshClient, data: CommandRouteStatsData, opts?: RpcOpts): Promise<CommandRouteStatsRtnData> {
+        return client.wshRpcCall("routestats", data, opts);
+    }
+
+    // command "routetrace" [responsestream]
+	RouteTraceCommand(client: WshClient, data: CommandRouteTraceData, opts?: RpcOpts): AsyncGenerator<RouteTraceData, void, boolean> {
+        return client.wshRpcStream("routetrace", data, opts);
+    }
+
     // command "routeunannounce" [call]
     RouteUnannounceCommand(client: WshClient, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("routeunannounce", null, opts);
     }
 
+    // command "runtimeversions" [call]
+    RuntimeVersionsCommand(client: WshClient, data: CommandRuntimeVersionsData, opts?: RpcOpts): Promise<RuntimeVersionsData> {
+        return client.wshRpcCall("runtimeversions", data, opts);
+    }
+
+    // command "serverinfo" [call]
+    ServerInfoCommand(client: WshClient, opts?: RpcOpts): Promise<CommandServerInfoRtnData> {
+        return client.wshRpcCall("serverinfo", null, opts);
+    }
+
     // command "setconfig" [call]
     SetConfigCommand(client: WshClient, data: SettingsType, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("setconfig", data, opts);
@@ -272,11 +537,36 @@ class RpcApiType {
         return client.wshRpcCall("setconnectionsconfig", data, opts);
     }
 
+    // command "setcwd" [call]
+    SetCwdCommand(client: WshClient, data: CommandSetCwdData, opts?: RpcOpts): Promise<CwdData> {
+        return client.wshRpcCall("setcwd", data, opts);
+    }
+
     // command "setmeta" [call]
     SetMetaCommand(client: WshClient, data: CommandSetMetaData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("setmeta", data, opts);
     }
 
+    // command "setpriority" [call]
+    SetPriorityCommand(client: WshClient, data: CommandSetPriorityData, opts?: RpcOpts): Promise<PriorityData> {
+        return client.wshRpcCall("setpriority", data, opts);
+    }
+
+    // command "setsysinfocollectors" [call]
+    SetSysInfoCollectorsCommand(client: WshClient, data: CommandSetSysInfoCollectorsData, opts?: RpcOpts): Promise<CommandSysInfoCollectorsRtnData> {
+        return client.wshRpcCall("setsysinfocollectors", data, opts);
+    }
+
+    // command "setsysinfointerval" [call]
+    SetSysInfoIntervalCommand(client: WshClient, data: CommandSysInfoIntervalData, opts?: RpcOpts): Promise<CommandSysInfoIntervalData> {
+        return client.wshRpcCall("setsysinfointerval", data, opts);
+    }
+
+    // command "settoggle" [call]
+    SetToggleCommand(client: WshClient, data: CommandSetToggleData, opts?: RpcOpts): Promise<CommandToggleRtnData> {
+        return client.wshRpcCall("settoggle", data, opts);
+    }
+
     // command "setvar" [call]
     SetVarCommand(client: WshClient, data: CommandVarData, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("setvar", data, opts);
@@ -287,6 +577,16 @@ class RpcApiType {
         return client.wshRpcCall("setview", data, opts);
     }
 
+    // command "shutdown" [call]
+    ShutdownCommand(client: WshClient, data: CommandShutdownData, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("shutdown", data, opts);
+    }
+
+    // command "socketstats" [call]
+    SocketStatsCommand(client: WshClient, data: CommandSocketStatsData, opts?: RpcOpts): Promise<SocketStatsData> {
+        return client.wshRpcCall("socketstats", data, opts);
+    }
+
     // command "streamcpudata" [responsestream]
 	StreamCpuDataCommand(client: WshClient, data: CpuDataRequest, opts?: RpcOpts): AsyncGenerator<TimeSeriesData, void, boolean> {
         return client.wshRpcStream("streamcpudata", data, opts);
@@ -302,11 +602,36 @@ class RpcApiType {
         return client.wshRpcStream("streamwaveai", data, opts);
     }
 
+    // command "sysinfohistory" [call]
+    SysInfoHistoryCommand(client: WshClient, data: CommandSysInfoHistoryData, opts?: RpcOpts): Promise<CommandSysInfoHistoryRtnData> {
+        return client.wshRpcCall("sysinfohistory", data, opts);
+    }
+
+    // command "sysinforefresh" [call]
+    SysInfoRefreshCommand(client: WshClient, opts?: RpcOpts): Promise<TimeSeriesData> {
+        return client.wshRpcCall("sysinforefresh", null, opts);
+    }
+
+    // command "sysinfostream" [responsestream]
+	SysInfoStreamCommand(client: WshClient, data: CommandSysInfoStreamData, opts?: RpcOpts): AsyncGenerator<SysInfoStreamData, void, boolean> {
+        return client.wshRpcStream("sysinfostream", data, opts);
+    }
+
     // command "test" [call]
     TestCommand(client: WshClient, data: string, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("test", data, opts);
     }
 
+    // command "timesyncstatus" [call]
+    TimeSyncStatusCommand(client: WshClient, opts?: RpcOpts): Promise<TimeSyncStatusData> {
+        return client.wshRpcCall("timesyncstatus", null, opts);
+    }
+
+    // command "unquiesce" [call]
+    UnquiesceCommand(client: WshClient, opts?: RpcOpts): Promise<void> {
+        return client.wshRpcCall("unquiesce", null, opts);
+    }
+
     // command "vdomasyncinitiation" [call]
     VDomAsyncInitiationCommand(client: WshClient, data: VDomAsyncInitiationRequest, opts?: RpcOpts): Promise<void> {
         return client.wshRpcCall("vdomasyncinitiation", data, opts);
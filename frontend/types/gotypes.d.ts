@@ -45,6 +45,23 @@ declare global {
         message?: string;
     };
 
+    // wshrpc.BatchSubRequest
+    type BatchSubRequest = {
+        id?: string;
+        command: string;
+        data?: any;
+    };
+
+    // wshrpc.BatchSubResponse
+    type BatchSubResponse = {
+        id?: string;
+        command: string;
+        data?: any;
+        error?: string;
+        skipped?: boolean;
+        durationms: number;
+    };
+
     // waveobj.Block
     type Block = WaveObj & {
         parentoref?: string;
@@ -84,6 +101,57 @@ declare global {
         inputdata64: string;
     };
 
+    // wshrpc.BufferMemoryData
+    type BufferMemoryData = {
+        used: number;
+        limit: number;
+        shedroutes: number;
+    };
+
+    // wshrpc.CapabilityLimitsData
+    type CapabilityLimitsData = {
+        maxpacketsize: number;
+        encodings: string[];
+        compression: string[];
+        maxinflight?: number;
+        commandqueuesize?: number;
+        execenvdeny?: string[];
+    };
+
+    // wshrpc.CgroupLimitsData
+    type CgroupLimitsData = {
+        ts: number;
+        version: number;
+        path?: string;
+        limited: boolean;
+        message?: string;
+        cpulimit?: number;
+        cpuquotaus?: number;
+        cpuperiodus?: number;
+        cpusetcpus?: string;
+        cpusetcount?: number;
+        cpuusageus?: number;
+        nrthrottled?: number;
+        throttledus?: number;
+        memlimit?: number;
+        memusage: number;
+        mempercent?: number;
+        pidslimit?: number;
+        pidscurrent?: number;
+        hostcpus: number;
+        hostmemtotal?: number;
+    };
+
+    // wshrpc.CheckWritableRtnData
+    type CheckWritableRtnData = {
+        path: string;
+        testpath?: string;
+        exists: boolean;
+        isdir?: boolean;
+        writable: boolean;
+        reason?: string;
+    };
+
     // waveobj.Client
     type Client = WaveObj & {
         windowids: string[];
@@ -109,6 +177,20 @@ declare global {
     type CommandAuthenticateRtnData = {
         routeid: string;
         authtoken?: string;
+        deadmanms?: number;
+    };
+
+    // wshrpc.CommandBatchData
+    type CommandBatchData = {
+        requests: BatchSubRequest[];
+        sequential?: boolean;
+        stoponerror?: boolean;
+    };
+
+    // wshrpc.CommandBatchRtnData
+    type CommandBatchRtnData = {
+        responses: BatchSubResponse[];
+        errors?: number;
     };
 
     // wshrpc.CommandBlockInputData
@@ -125,6 +207,43 @@ declare global {
         view: string;
     };
 
+    // wshrpc.CommandBroadcastData
+    type CommandBroadcastData = {
+        message: string;
+        level?: string;
+        inms?: number;
+    };
+
+    // wshrpc.CommandBroadcastRtnData
+    type CommandBroadcastRtnData = {
+        numroutes: number;
+    };
+
+    // wshrpc.CommandCapabilitiesRtnData
+    type CommandCapabilitiesRtnData = {
+        version: string;
+        routermode?: boolean;
+        readonly?: boolean;
+        admin?: boolean;
+        scope?: string[];
+        policyrule?: string;
+        commands: CommandCapabilityData[];
+        limits: CapabilityLimitsData;
+    };
+
+    // wshrpc.CommandCapabilityData
+    type CommandCapabilityData = {
+        command: string;
+        enabled: boolean;
+        reason?: string;
+        concurrency?: number;
+    };
+
+    // wshrpc.CommandCheckWritableData
+    type CommandCheckWritableData = {
+        path: string;
+    };
+
     // wshrpc.CommandControllerResyncData
     type CommandControllerResyncData = {
         forcerestart?: boolean;
@@ -152,6 +271,17 @@ declare global {
         blockid: string;
     };
 
+    // wshrpc.CommandDiskUsageData
+    type CommandDiskUsageData = {
+        all?: boolean;
+        includetmpfs?: boolean;
+    };
+
+    // wshrpc.CommandDiskUsageRtnData
+    type CommandDiskUsageRtnData = {
+        filesystems: DiskUsageInfo[];
+    };
+
     // wshrpc.CommandDisposeData
     type CommandDisposeData = {
         routeid: string;
@@ -164,6 +294,31 @@ declare global {
         maxitems: number;
     };
 
+    // wshrpc.CommandExecData
+    type CommandExecData = {
+        cmd: string;
+        args?: string[];
+        cwd?: string;
+        env?: {[key: string]: string};
+        envmode?: string;
+        pty?: boolean;
+        termsize?: TermSize;
+    };
+
+    // wshrpc.CommandExecInputData
+    type CommandExecInputData = {
+        execid: string;
+        data64?: string;
+        eof?: boolean;
+        termsize?: TermSize;
+    };
+
+    // wshrpc.CommandFileChecksumData
+    type CommandFileChecksumData = {
+        path: string;
+        algorithm?: string;
+    };
+
     // wshrpc.CommandFileCreateData
     type CommandFileCreateData = {
         zoneid: string;
@@ -195,21 +350,203 @@ declare global {
         limit?: number;
     };
 
+    // wshrpc.CommandFileSubscribeData
+    type CommandFileSubscribeData = {
+        path: string;
+        ops?: string[];
+    };
+
+    // wshrpc.CommandFileSubscribeRtnData
+    type CommandFileSubscribeRtnData = {
+        subid: string;
+        dir: string;
+    };
+
+    // wshrpc.CommandFileTailData
+    type CommandFileTailData = {
+        path: string;
+        lines?: number;
+        bytes?: number;
+        follow?: boolean;
+    };
+
+    // wshrpc.CommandFileTransferReadData
+    type CommandFileTransferReadData = {
+        path: string;
+        resumetoken?: string;
+        offset?: number;
+        chunksize?: number;
+    };
+
+    // wshrpc.CommandFileTransferWriteData
+    type CommandFileTransferWriteData = {
+        path: string;
+        resumetoken?: string;
+        size: number;
+        offset: number;
+        data64?: string;
+        checksum?: string;
+        final?: boolean;
+        filechecksum?: string;
+        createmode?: number;
+    };
+
+    // wshrpc.CommandFileUnsubscribeData
+    type CommandFileUnsubscribeData = {
+        subid: string;
+    };
+
+    // wshrpc.CommandFileWatchData
+    type CommandFileWatchData = {
+        path: string;
+    };
+
+    // wshrpc.CommandForwardDataData
+    type CommandForwardDataData = {
+        forwardid: string;
+        connid: string;
+        data64?: string;
+        eof?: boolean;
+        close?: boolean;
+    };
+
+    // wshrpc.CommandForwardStartData
+    type CommandForwardStartData = {
+        mode: string;
+        addr: string;
+    };
+
+    // wshrpc.CommandForwardStopData
+    type CommandForwardStopData = {
+        forwardid: string;
+    };
+
     // wshrpc.CommandGetMetaData
     type CommandGetMetaData = {
         oref: ORef;
     };
 
+    // wshrpc.CommandGetPriorityData
+    type CommandGetPriorityData = {
+        pid?: number;
+    };
+
+    // wshrpc.CommandGetToggleData
+    type CommandGetToggleData = {
+        key?: string;
+    };
+
+    // wshrpc.CommandGpuInfoData
+    type CommandGpuInfoData = {
+        intervalms?: number;
+    };
+
+    // wshrpc.CommandJournalTailData
+    type CommandJournalTailData = {
+        unit?: string;
+        lines?: number;
+        follow?: boolean;
+    };
+
+    // wshrpc.CommandKillExecData
+    type CommandKillExecData = {
+        execid: string;
+    };
+
+    // wshrpc.CommandListExecRtnData
+    type CommandListExecRtnData = {
+        sessions: ExecSessionInfo[];
+    };
+
+    // wshrpc.CommandListListenersData
+    type CommandListListenersData = {
+        protocol?: string;
+        limit?: number;
+    };
+
+    // wshrpc.CommandListListenersRtnData
+    type CommandListListenersRtnData = {
+        listeners: ListenerInfo[];
+        total: number;
+        truncated?: boolean;
+    };
+
+    // wshrpc.CommandLogFileData
+    type CommandLogFileData = {
+        action?: string;
+    };
+
+    // wshrpc.CommandLogTailData
+    type CommandLogTailData = {
+        lines?: number;
+    };
+
+    // wshrpc.CommandLogTailRtnData
+    type CommandLogTailRtnData = {
+        entries: LogEntry[];
+        dropped: number;
+        truncated: boolean;
+        bufferbytes: number;
+        maxbytes: number;
+    };
+
     // wshrpc.CommandMessageData
     type CommandMessageData = {
         oref: ORef;
         message: string;
     };
 
+    // wshrpc.CommandOSInfoRtnData
+    type CommandOSInfoRtnData = {
+        os: string;
+        arch: string;
+        hostname?: string;
+        platform?: string;
+        platformfamily?: string;
+        platformversion?: string;
+        prettyname?: string;
+        kernelversion?: string;
+        kernelarch?: string;
+        container?: string;
+        virtualization?: string;
+    };
+
+    // wshrpc.CommandPauseRouteData
+    type CommandPauseRouteData = {
+        routeid: string;
+        overflow?: string;
+    };
+
+    // wshrpc.CommandProcessWatchData
+    type CommandProcessWatchData = {
+        pid: number;
+        intervalms?: number;
+    };
+
+    // wshrpc.CommandReloadCertRtnData
+    type CommandReloadCertRtnData = {
+        certs: TlsCertInfo[];
+    };
+
+    // wshrpc.CommandRemoteProcessListData
+    type CommandRemoteProcessListData = {
+        sortby?: string;
+        count?: number;
+    };
+
+    // wshrpc.CommandRemoteProcessListRtnData
+    type CommandRemoteProcessListRtnData = {
+        ts: number;
+        numprocs: number;
+        processes: ProcessInfo[];
+    };
+
     // wshrpc.CommandRemoteStreamFileData
     type CommandRemoteStreamFileData = {
         path: string;
         byterange?: string;
+        offset?: number;
+        expectedsize?: number;
     };
 
     // wshrpc.CommandRemoteStreamFileRtnData
@@ -223,6 +560,42 @@ declare global {
         path: string;
         data64: string;
         createmode?: number;
+        offset?: number;
+    };
+
+    // wshrpc.CommandResetRouteData
+    type CommandResetRouteData = {
+        routeid: string;
+        disconnect?: boolean;
+    };
+
+    // wshrpc.CommandResetRouteRtnData
+    type CommandResetRouteRtnData = {
+        routeid: string;
+        drainedmessages: number;
+        canceledrequests: number;
+        failedrequests: number;
+        disconnected?: boolean;
+    };
+
+    // wshrpc.CommandResolveHostData
+    type CommandResolveHostData = {
+        host: string;
+        timeoutms?: number;
+    };
+
+    // wshrpc.CommandResolveHostRtnData
+    type CommandResolveHostRtnData = {
+        host: string;
+        addrs?: string[];
+        cname?: string;
+        names?: string[];
+        nameservers?: string[];
+        searchdomains?: string[];
+        durationms: number;
+        error?: string;
+        notfound?: boolean;
+        timedout?: boolean;
     };
 
     // wshrpc.CommandResolveIdsData
@@ -236,12 +609,148 @@ declare global {
         resolvedids: {[key: string]: ORef};
     };
 
+    // wshrpc.CommandResumeRouteData
+    type CommandResumeRouteData = {
+        routeid: string;
+    };
+
+    // wshrpc.CommandRouteInfoRtnData
+    type CommandRouteInfoRtnData = {
+        ts: number;
+        routes: RegisteredRouteData[];
+        numroutes: number;
+        numproxy: number;
+        numlocal: number;
+        hasupstream: boolean;
+        conns: number;
+        connstotal: number;
+        listenaddr?: string;
+    };
+
+    // wshrpc.CommandRouteStatsData
+    type CommandRouteStatsData = {
+        offset?: number;
+        limit?: number;
+        blocktype?: string;
+        transport?: string;
+        qosclass?: string;
+    };
+
+    // wshrpc.CommandRouteStatsRtnData
+    type CommandRouteStatsRtnData = {
+        statssince: number;
+        totals: RouteStatsData;
+        routes: RouteStatsData[];
+        total: number;
+    };
+
+    // wshrpc.CommandRouteTraceData
+    type CommandRouteTraceData = {
+        routeid?: string;
+        command?: string;
+    };
+
+    // wshrpc.CommandRuntimeVersionsData
+    type CommandRuntimeVersionsData = {
+        tools?: string[];
+        nocache?: boolean;
+    };
+
+    // wshrpc.CommandServerInfoRtnData
+    type CommandServerInfoRtnData = {
+        version: string;
+        pid: number;
+        startts?: number;
+        routermode?: boolean;
+        rootdir?: string;
+        quiesced?: boolean;
+        overloadrejected?: number;
+        acceptratedelayed?: number;
+        acceptraterejected?: number;
+        logwritesdropped?: number;
+        logwriteerrors?: number;
+        sysinfounavailable?: boolean;
+        sysinfoerror?: string;
+        conndurations?: ConnDurationBucketData[];
+        blocktypecounts?: {[key: string]: number};
+        handshakes?: HandshakeStatsData;
+        buffermemory?: BufferMemoryData;
+        issues?: ServerIssueData[];
+    };
+
+    // wshrpc.CommandSetCwdData
+    type CommandSetCwdData = {
+        path: string;
+    };
+
     // wshrpc.CommandSetMetaData
     type CommandSetMetaData = {
         oref: ORef;
         meta: MetaType;
     };
 
+    // wshrpc.CommandSetPriorityData
+    type CommandSetPriorityData = {
+        pid?: number;
+        nice: number;
+    };
+
+    // wshrpc.CommandSetSysInfoCollectorsData
+    type CommandSetSysInfoCollectorsData = {
+        enable?: string[];
+        disable?: string[];
+    };
+
+    // wshrpc.CommandSetToggleData
+    type CommandSetToggleData = {
+        key: string;
+        value: boolean;
+    };
+
+    // wshrpc.CommandShutdownData
+    type CommandShutdownData = {
+        gracems?: number;
+    };
+
+    // wshrpc.CommandSocketStatsData
+    type CommandSocketStatsData = {
+        routeid?: string;
+    };
+
+    // wshrpc.CommandSysInfoCollectorsRtnData
+    type CommandSysInfoCollectorsRtnData = {
+        collectors: SysInfoCollectorInfo[];
+    };
+
+    // wshrpc.CommandSysInfoHistoryData
+    type CommandSysInfoHistoryData = {
+        sincets?: number;
+        maxitems?: number;
+    };
+
+    // wshrpc.CommandSysInfoHistoryRtnData
+    type CommandSysInfoHistoryRtnData = {
+        count: number;
+        historysize: number;
+        intervalms: number;
+        data64: string;
+    };
+
+    // wshrpc.CommandSysInfoIntervalData
+    type CommandSysInfoIntervalData = {
+        intervalms: number;
+    };
+
+    // wshrpc.CommandSysInfoStreamData
+    type CommandSysInfoStreamData = {
+        format?: string;
+    };
+
+    // wshrpc.CommandToggleRtnData
+    type CommandToggleRtnData = {
+        toggles: {[key: string]: boolean};
+    };
+
     // wshrpc.CommandVarData
     type CommandVarData = {
         key: string;
@@ -285,6 +794,13 @@ declare global {
         metamaptype: MetaType;
     };
 
+    // wshrpc.ConnDurationBucketData
+    type ConnDurationBucketData = {
+        label: string;
+        maxms?: number;
+        count: number;
+    };
+
     // wshrpc.ConnKeywords
     type ConnKeywords = {
         "conn:wshenabled"?: boolean;
@@ -317,6 +833,78 @@ declare global {
         keywords?: ConnKeywords;
     };
 
+    // wshrpc.ConnServerConfigData
+    type ConnServerConfigData = {
+        routermode: boolean;
+        transports: string[];
+        listen?: string;
+        resumegracems?: number;
+        resumebufferbytes?: number;
+        daemon?: boolean;
+        daemonstatefile?: string;
+        rootdir?: string;
+        handshaketimeoutms: number;
+        connidletimeoutms?: number;
+        listenbacklog?: number;
+        healthaddr?: string;
+        gatewayaddr?: string;
+        metricssocket?: string;
+        commandconcurrency?: {[key: string]: number};
+        commandqueuesize: number;
+        logbufferbytes: number;
+        logfile?: string;
+        logmaxsize?: number;
+        logkeep?: number;
+        tlsservernames?: string[];
+        sysinfoinclude: string[];
+        sysinfointervalms: number;
+        maxsysinfoerrors: number;
+        sysinfojitter?: number;
+        sysinfohistory: number;
+        sysinfotimeoutms: number;
+        shutdownflushms: number;
+        shutdowngracems: number;
+        draintimeoutms: number;
+        injecttimeoutms: number;
+        upstreamcompression?: string[];
+        upstreamwindow?: number;
+        tracepipeline?: boolean;
+        watchsocket?: boolean;
+        maxinflight?: number;
+        carryroutestats?: boolean;
+        inputfullpolicy: string;
+        inputfulltimeoutms: number;
+        maxbuffermemory?: number;
+        queuehighwatermark: number;
+        queuelowwatermark: number;
+        queuesustainms: number;
+        rejectaboveload?: number;
+        rejectabovemem?: number;
+        acceptrate?: number;
+        acceptburst?: number;
+        acceptratewaitms?: number;
+        execenvdeny?: string[];
+        runtimeprobetools?: string[];
+        backpressurehigh?: number;
+        backpressurelow?: number;
+        deadmanintervalms?: number;
+        sysinfopushurl?: string;
+        configfile?: string;
+        policyfile?: string;
+        policyrules?: number;
+        quiesced: boolean;
+        toggles: {[key: string]: boolean};
+    };
+
+    // wshrpc.ConnServerEventData
+    type ConnServerEventData = {
+        type: string;
+        ts: number;
+        message: string;
+        data?: any;
+        dropped?: number;
+    };
+
     // wshrpc.ConnStatus
     type ConnStatus = {
         status: string;
@@ -335,6 +923,36 @@ declare global {
         count: number;
     };
 
+    // wshrpc.CpuDetailData
+    type CpuDetailData = {
+        ts: number;
+        loadavg1?: number;
+        loadavg5?: number;
+        loadavg15?: number;
+        logicalcores: number;
+        physicalcores?: number;
+        totalpercent: number;
+        corepercents: number[];
+        samplems: number;
+    };
+
+    // wshrpc.CwdData
+    type CwdData = {
+        cwd: string;
+        default?: boolean;
+    };
+
+    // wshrpc.DiskUsageInfo
+    type DiskUsageInfo = {
+        path: string;
+        device: string;
+        fstype: string;
+        total: number;
+        used: number;
+        free: number;
+        usedpercent: number;
+    };
+
     // vdom.DomRect
     type DomRect = {
         top: number;
@@ -345,6 +963,54 @@ declare global {
         height: number;
     };
 
+    // wshrpc.EntropyInfoData
+    type EntropyInfoData = {
+        available: boolean;
+        entropyavail?: number;
+        poolsize?: number;
+        low?: boolean;
+    };
+
+    // wshrpc.ExecOutputData
+    type ExecOutputData = {
+        execid?: string;
+        pid?: number;
+        stream?: string;
+        data64?: string;
+        exited?: boolean;
+        exitcode?: number;
+    };
+
+    // wshrpc.ExecSessionInfo
+    type ExecSessionInfo = {
+        execid: string;
+        pid: number;
+        cmd: string;
+        args?: string[];
+        cwd?: string;
+        pty?: boolean;
+        startts: number;
+        cpupercent: number;
+        rss: number;
+    };
+
+    // wshrpc.FdInfoData
+    type FdInfoData = {
+        open: number;
+        softlimit?: number;
+        hardlimit?: number;
+        usedpercent?: number;
+    };
+
+    // wshrpc.FileChecksumData
+    type FileChecksumData = {
+        path: string;
+        algorithm: string;
+        checksum: string;
+        size: number;
+        durationms: number;
+    };
+
     // waveobj.FileDef
     type FileDef = {
         content?: string;
@@ -374,6 +1040,52 @@ declare global {
         ijsonbudget?: number;
     };
 
+    // wshrpc.FileTailData
+    type FileTailData = {
+        data64?: string;
+        offset: number;
+        rotated?: boolean;
+        truncated?: boolean;
+    };
+
+    // wshrpc.FileTransferChunkData
+    type FileTransferChunkData = {
+        resumetoken?: string;
+        size?: number;
+        offset: number;
+        data64?: string;
+        checksum?: string;
+        done?: boolean;
+        filechecksum?: string;
+    };
+
+    // wshrpc.FileTransferWriteRtnData
+    type FileTransferWriteRtnData = {
+        resumetoken: string;
+        offset: number;
+        done?: boolean;
+    };
+
+    // wshrpc.FileWatchEventData
+    type FileWatchEventData = {
+        ts: number;
+        path: string;
+        op: string;
+    };
+
+    // wshrpc.ForwardPacketData
+    type ForwardPacketData = {
+        forwardid?: string;
+        addr?: string;
+        connid?: string;
+        opened?: boolean;
+        peeraddr?: string;
+        data64?: string;
+        eof?: boolean;
+        closed?: boolean;
+        error?: string;
+    };
+
     // wconfig.FullConfigType
     type FullConfigType = {
         settings: SettingsType;
@@ -392,6 +1104,53 @@ declare global {
         data64: string;
     };
 
+    // wshrpc.GpuData
+    type GpuData = {
+        index: number;
+        name: string;
+        vendor: string;
+        busid?: string;
+        utilpercent: number;
+        memused: number;
+        memtotal: number;
+        tempc: number;
+        powerw: number;
+        powerlimitw?: number;
+        unsupported?: string[];
+    };
+
+    // wshrpc.GpuInfoData
+    type GpuInfoData = {
+        ts: number;
+        source?: string;
+        gpus: GpuData[];
+        message?: string;
+        error?: string;
+    };
+
+    // wshrpc.HandshakeStatsData
+    type HandshakeStatsData = {
+        count: number;
+        maxms: number;
+        avgms: number;
+        windowsize: number;
+    };
+
+    // wshrpc.JournalEntryData
+    type JournalEntryData = {
+        ts: number;
+        unit?: string;
+        priority: number;
+        pid?: number;
+        message: string;
+    };
+
+    // wshrpc.JournalTailData
+    type JournalTailData = {
+        unit: string;
+        entries: JournalEntryData[];
+    };
+
     // waveobj.LayoutActionData
     type LayoutActionData = {
         actiontype: string;
@@ -417,6 +1176,72 @@ declare global {
         blockid: string;
     };
 
+    // wshrpc.ListenerInfo
+    type ListenerInfo = {
+        protocol: string;
+        addr: string;
+        port: number;
+        pid?: number;
+        process?: string;
+    };
+
+    // wshrpc.LocaleInfoData
+    type LocaleInfoData = {
+        ts: number;
+        timezone?: string;
+        timezonesource?: string;
+        tzabbrev: string;
+        utcoffsetsec: number;
+        dst?: boolean;
+        locale: string;
+        timelocale: string;
+        numericlocale: string;
+        localesource?: string;
+        localevars?: {[key: string]: string};
+        dateformat?: string;
+        timeformat?: string;
+        datetimeformat?: string;
+        decimalpoint?: string;
+        thousandssep?: string;
+    };
+
+    // logring.LogEntry
+    type LogEntry = {
+        ts: number;
+        line: string;
+    };
+
+    // wshrpc.LogFileData
+    type LogFileData = {
+        path: string;
+        size: number;
+        maxsize?: number;
+        keep: number;
+        rotatedfiles?: string[];
+        rotations?: number;
+        lastrotatets?: number;
+        lasterror?: string;
+    };
+
+    // wshrpc.MemoryPressureData
+    type MemoryPressureData = {
+        ts: number;
+        swaptotal: number;
+        swapused: number;
+        swapusedpercent: number;
+        swapinpersec: number;
+        swapoutpersec: number;
+        majfaultspersec?: number;
+        samplems: number;
+        psi?: MemoryPsiData;
+    };
+
+    // wshrpc.MemoryPsiData
+    type MemoryPsiData = {
+        some: PsiLineData;
+        full: PsiLineData;
+    };
+
     // waveobj.MetaTSType
     type MetaType = {
         view?: string;
@@ -559,23 +1384,146 @@ declare global {
         prompt: OpenAIPromptMessageType[];
     };
 
+    // wshrpc.PauseRouteRtnData
+    type PauseRouteRtnData = {
+        routeid: string;
+        paused: boolean;
+        overflow?: string;
+        queued: number;
+        dropped?: number;
+    };
+
+    // wshrpc.PipelineStatsData
+    type PipelineStatsData = {
+        enabled: boolean;
+        parsed: number;
+        delivered: number;
+        received: number;
+        injected: number;
+        dropped: number;
+        rawlines: number;
+        corruptframes?: number;
+        pendingparse: number;
+        pendingchannel: number;
+        pendinginject: number;
+    };
+
     // waveobj.Point
     type Point = {
         x: number;
         y: number;
     };
 
+    // wshrpc.PriorityData
+    type PriorityData = {
+        pid: number;
+        nice: number;
+    };
+
+    // wshrpc.ProcessInfo
+    type ProcessInfo = {
+        pid: number;
+        command: string;
+        cpupercent: number;
+        rss: number;
+    };
+
+    // wshrpc.ProcessWatchData
+    type ProcessWatchData = {
+        ts: number;
+        pid: number;
+        cpupercent: number;
+        rss: number;
+        numthreads: number;
+        numfds?: number;
+        exited?: boolean;
+    };
+
+    // wshrpc.PsiLineData
+    type PsiLineData = {
+        avg10: number;
+        avg60: number;
+        avg300: number;
+        total: number;
+    };
+
+    // wshrpc.RegisteredRouteData
+    type RegisteredRouteData = {
+        routeid: string;
+        kind: string;
+        registeredts?: number;
+        announced?: number;
+        authstate?: string;
+        scope?: string[];
+        policyrule?: string;
+        msgsin: number;
+        msgsout: number;
+        dropped?: number;
+        lastactivityts?: number;
+    };
+
+    // wshrpc.RouteStatsData
+    type RouteStatsData = {
+        routeid?: string;
+        blocktype?: string;
+        transport?: string;
+        qosclass?: string;
+        msgsin: number;
+        bytesin: number;
+        msgsout: number;
+        bytesout: number;
+        dropped: number;
+        inflight?: number;
+        queuedepth?: number;
+        paused?: boolean;
+        lastactivityts?: number;
+        instanceid?: string;
+        prevrouteid?: string;
+        reconnects?: number;
+        deadmanms?: number;
+        keepalives?: number;
+        lastkeepalivets?: number;
+        compression?: string;
+        bytesraw?: number;
+        bytescompressed?: number;
+        compressionratio?: number;
+    };
+
+    // wshrpc.RouteTraceData
+    type RouteTraceData = {
+        ts: number;
+        from: string;
+        to?: string;
+        source?: string;
+        route?: string;
+        command?: string;
+        reqid?: string;
+        resid?: string;
+        cont?: boolean;
+        error?: boolean;
+        size: number;
+        dropped?: string;
+        missed?: number;
+    };
+
     // wshutil.RpcMessage
     type RpcMessage = {
         command?: string;
         reqid?: string;
         resid?: string;
         timeout?: number;
+        deadline?: number;
         route?: string;
         authtoken?: string;
         source?: string;
         cont?: boolean;
+        seq?: number;
         cancel?: boolean;
+        ackreq?: boolean;
+        ackid?: string;
+        instanceid?: string;
+        deadman?: number;
+        headers?: {[key: string]: string};
         error?: string;
         datatype?: string;
         data?: any;
@@ -584,8 +1532,10 @@ declare global {
     // wshrpc.RpcOpts
     type RpcOpts = {
         timeout?: number;
+        deadline?: number;
         noresponse?: boolean;
         route?: string;
+        headers?: {[key: string]: string};
     };
 
     // waveobj.RuntimeOpts
@@ -594,6 +1544,32 @@ declare global {
         winsize?: WinSize;
     };
 
+    // wshrpc.RuntimeToolData
+    type RuntimeToolData = {
+        name: string;
+        found: boolean;
+        path?: string;
+        version?: string;
+        raw?: string;
+        error?: string;
+        probets: number;
+    };
+
+    // wshrpc.RuntimeVersionsData
+    type RuntimeVersionsData = {
+        shell?: string;
+        shellversion?: string;
+        tools: RuntimeToolData[];
+    };
+
+    // wshrpc.ServerIssueData
+    type ServerIssueData = {
+        key: string;
+        severity: string;
+        message: string;
+        ts: number;
+    };
+
     // webcmd.SetBlockTermSizeWSCommand
     type SetBlockTermSizeWSCommand = {
         wscommand: "setblocktermsize";
@@ -663,6 +1639,17 @@ declare global {
         "conn:wshenabled"?: boolean;
     };
 
+    // wshrpc.SocketStatsData
+    type SocketStatsData = {
+        routeid: string;
+        transport: string;
+        localaddr?: string;
+        remoteaddr?: string;
+        available: boolean;
+        reason?: string;
+        tcp?: TcpInfoData;
+    };
+
     // waveobj.StickerClickOptsType
     type StickerClickOptsType = {
         sendinput?: string;
@@ -691,6 +1678,21 @@ declare global {
         allscopes?: boolean;
     };
 
+    // wshrpc.SysInfoCollectorInfo
+    type SysInfoCollectorInfo = {
+        name: string;
+        enabled: boolean;
+        default?: boolean;
+    };
+
+    // wshrpc.SysInfoStreamData
+    type SysInfoStreamData = {
+        format: string;
+        data?: TimeSeriesData;
+        records?: string;
+        dropped?: number;
+    };
+
     // waveobj.Tab
     type Tab = WaveObj & {
         name: string;
@@ -698,6 +1700,31 @@ declare global {
         blockids: string[];
     };
 
+    // wshrpc.TcpInfoData
+    type TcpInfoData = {
+        state: string;
+        rttus: number;
+        rttvarus: number;
+        minrttus?: number;
+        rtous: number;
+        retransmits: number;
+        lost: number;
+        unacked: number;
+        sndcwnd: number;
+        sndssthresh: number;
+        sndmss: number;
+        rcvwnd?: number;
+        notsentbytes: number;
+        bytessent?: number;
+        bytesacked?: number;
+        bytesreceived?: number;
+        bytesretrans?: number;
+        deliveryrate?: number;
+        busytimeus?: number;
+        rwndlimitedus?: number;
+        sndbuflimitedus?: number;
+    };
+
     // waveobj.TermSize
     type TermSize = {
         rows: number;
@@ -736,6 +1763,30 @@ declare global {
     type TimeSeriesData = {
         ts: number;
         values: {[key: string]: number};
+        unavailable?: string[];
+    };
+
+    // wshrpc.TimeSyncStatusData
+    type TimeSyncStatusData = {
+        ts: number;
+        synchronized: boolean;
+        statusfrom?: string;
+        clockstate?: string;
+        offsetus?: number;
+        maxerrorus?: number;
+        esterrorus?: number;
+        ntpenabled?: boolean;
+        daemon?: string;
+        source?: string;
+        stratum?: number;
+        errors?: string[];
+    };
+
+    // wshrpc.TlsCertInfo
+    type TlsCertInfo = {
+        servername: string;
+        subject?: string;
+        notafter?: number;
     };
 
     // waveobj.UIContext
@@ -13,6 +13,9 @@ import (
 // gets around import cycles
 var PanicTelemetryHandler func()
 
+// optional, called (in its own goroutine) with every panic caught by PanicHandler
+var PanicHook func(debugStr string, panicVal any)
+
 func PanicHandlerNoTelemetry(debugStr string) {
 	r := recover()
 	if r == nil {
@@ -36,6 +39,12 @@ func PanicHandler(debugStr string) error {
 			PanicTelemetryHandler()
 		}()
 	}
+	if hookFn := PanicHook; hookFn != nil {
+		go func() {
+			defer PanicHandlerNoTelemetry("PanicHook")
+			hookFn(debugStr, r)
+		}()
+	}
 	if err, ok := r.(error); ok {
 		return fmt.Errorf("panic in %s: %w", debugStr, err)
 	}
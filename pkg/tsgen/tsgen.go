@@ -41,6 +41,7 @@ var ExtraTypes = []any{
 	wconfig.WatcherUpdate{},
 	wshutil.RpcMessage{},
 	wshrpc.WshServerCommandMeta{},
+	wshrpc.ConnServerEventData{},
 	userinput.UserInputRequest{},
 	vdom.VDomCreateContext{},
 	vdom.VDomElem{},
@@ -0,0 +1,121 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// a writer that never blocks the caller.  writes are queued and copied to the underlying writer by a
+// background goroutine, when the queue is full the write is dropped (and counted) instead of waiting.
+// meant for log sinks (e.g. stdout going to a pipe) where a stalled reader must not stall the logger.
+package asyncwriter
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+)
+
+const DefaultQueueSize = 1024
+
+type AsyncWriter struct {
+	out       io.Writer
+	queue     chan []byte
+	written   atomic.Int64
+	dropped   atomic.Int64
+	errors    atomic.Int64
+	reported  int64 // drops already reported to out (only touched by the write loop)
+	pending   atomic.Int64
+	lastError atomic.Pointer[string]
+}
+
+type Stats struct {
+	Written   int64
+	Dropped   int64
+	Errors    int64
+	Queued    int64
+	QueueSize int
+	LastError string
+}
+
+func MakeAsyncWriter(out io.Writer, queueSize int) *AsyncWriter {
+	if queueSize <= 0 {
+		queueSize = DefaultQueueSize
+	}
+	w := &AsyncWriter{out: out, queue: make(chan []byte, queueSize)}
+	go w.writeLoop()
+	return w
+}
+
+// always succeeds, p is copied (callers like fmt.Fprintf reuse their buffers)
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	buf := make([]byte, len(p))
+	copy(buf, p)
+	w.pending.Add(1)
+	select {
+	case w.queue <- buf:
+	default:
+		w.pending.Add(-1)
+		w.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+func (w *AsyncWriter) writeLoop() {
+	defer panichandler.PanicHandler("AsyncWriter:writeLoop")
+	for buf := range w.queue {
+		// once the sink catches up, note the gap so the output doesn't silently skip lines
+		if dropped := w.dropped.Load(); dropped > w.reported {
+			w.writeOut([]byte(fmt.Sprintf("[%d log writes dropped, output could not keep up]\n", dropped-w.reported)))
+			w.reported = dropped
+		}
+		if w.writeOut(buf) {
+			w.written.Add(1)
+		}
+		w.pending.Add(-1)
+	}
+}
+
+func (w *AsyncWriter) writeOut(buf []byte) bool {
+	_, err := w.out.Write(buf)
+	if err != nil {
+		w.errors.Add(1)
+		errStr := err.Error()
+		w.lastError.Store(&errStr)
+		return false
+	}
+	return true
+}
+
+// number of writes dropped because the queue was full
+func (w *AsyncWriter) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+func (w *AsyncWriter) GetStats() Stats {
+	rtn := Stats{
+		Written:   w.written.Load(),
+		Dropped:   w.dropped.Load(),
+		Errors:    w.errors.Load(),
+		Queued:    w.pending.Load(),
+		QueueSize: cap(w.queue),
+	}
+	if lastErr := w.lastError.Load(); lastErr != nil {
+		rtn.LastError = *lastErr
+	}
+	return rtn
+}
+
+// waits (up to timeout) for the queued writes to reach the underlying writer, false on timeout
+func (w *AsyncWriter) Flush(timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for w.pending.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	return true
+}
@@ -0,0 +1,104 @@
+package asyncwriter
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
+
+// blocks every write until released
+type stalledWriter struct {
+	release chan struct{}
+	out     lockedBuffer
+}
+
+func (s *stalledWriter) Write(p []byte) (int, error) {
+	<-s.release
+	return s.out.Write(p)
+}
+
+func TestAsyncWriter_Writes(t *testing.T) {
+	var out lockedBuffer
+	w := MakeAsyncWriter(&out, 16)
+	w.Write([]byte("line1\n"))
+	w.Write([]byte("line2\n"))
+	if !w.Flush(time.Second) {
+		t.Fatalf("flush timed out")
+	}
+	if out.String() != "line1\nline2\n" {
+		t.Fatalf("unexpected output %q", out.String())
+	}
+	stats := w.GetStats()
+	if stats.Written != 2 || stats.Dropped != 0 || stats.Queued != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestAsyncWriter_CopiesInput(t *testing.T) {
+	var out lockedBuffer
+	w := MakeAsyncWriter(&out, 16)
+	buf := []byte("abc\n")
+	w.Write(buf)
+	copy(buf, "xyz\n")
+	w.Flush(time.Second)
+	if out.String() != "abc\n" {
+		t.Fatalf("write was not copied, got %q", out.String())
+	}
+}
+
+func TestAsyncWriter_DropsWhenStalled(t *testing.T) {
+	sink := &stalledWriter{release: make(chan struct{})}
+	w := MakeAsyncWriter(sink, 4)
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 20; i++ {
+			w.Write([]byte("line\n"))
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("writes blocked on a stalled sink")
+	}
+	// 4 queued plus at most 1 held by the write loop
+	if dropped := w.Dropped(); dropped < 15 {
+		t.Errorf("expected at least 15 dropped, got %d", dropped)
+	}
+	if w.Flush(20 * time.Millisecond) {
+		t.Errorf("flush should time out while the sink is stalled")
+	}
+	close(sink.release)
+	if !w.Flush(time.Second) {
+		t.Fatalf("flush timed out after release")
+	}
+	w.Write([]byte("after\n"))
+	w.Flush(time.Second)
+	output := sink.out.String()
+	if !strings.Contains(output, "log writes dropped") || !strings.HasSuffix(output, "after\n") {
+		t.Errorf("expected a drop notice and the later write, got %q", output)
+	}
+	stats := w.GetStats()
+	if stats.Written+stats.Dropped != 21 {
+		t.Errorf("written+dropped should account for every write: %+v", stats)
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// small in-process pub/sub for server-internal events.  publishing never blocks, every subscriber has
+// a bounded buffer and events that don't fit are dropped and counted (the count is reported on the
+// subscriber's next delivered event).
+package evbus
+
+import (
+	"sync"
+	"time"
+)
+
+const DefaultBufferSize = 256
+
+type Event struct {
+	Type    string
+	Ts      int64  // unix millis, set by Publish
+	Message string // human readable, used by log consumers
+	Data    any
+	Dropped int64 // events this subscriber missed (buffer full) just before this one
+}
+
+type Bus struct {
+	Lock   *sync.Mutex
+	Subs   map[*Subscription]bool
+	Closed bool
+}
+
+type Subscription struct {
+	Ch        chan Event      // closed by Unsubscribe (or Bus.Close)
+	Types     map[string]bool // nil for all types
+	bus       *Bus
+	pending   int64 // dropped since the last delivered event (under bus lock)
+	dropped   int64 // total dropped (under bus lock)
+	delivered int64 // total delivered (under bus lock)
+	closed    bool
+}
+
+func MakeBus() *Bus {
+	return &Bus{Lock: &sync.Mutex{}, Subs: make(map[*Subscription]bool)}
+}
+
+// no types subscribes to every event type.  bufSize <= 0 uses DefaultBufferSize
+func (b *Bus) Subscribe(bufSize int, types ...string) *Subscription {
+	if bufSize <= 0 {
+		bufSize = DefaultBufferSize
+	}
+	sub := &Subscription{Ch: make(chan Event, bufSize), bus: b}
+	if len(types) > 0 {
+		sub.Types = make(map[string]bool)
+		for _, evType := range types {
+			sub.Types[evType] = true
+		}
+	}
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	if b.Closed {
+		sub.closed = true
+		close(sub.Ch)
+		return sub
+	}
+	b.Subs[sub] = true
+	return sub
+}
+
+func (b *Bus) Publish(evType string, message string, data any) {
+	event := Event{Type: evType, Ts: time.Now().UnixMilli(), Message: message, Data: data}
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	for sub := range b.Subs {
+		if sub.Types != nil && !sub.Types[evType] {
+			continue
+		}
+		subEvent := event
+		subEvent.Dropped = sub.pending
+		select {
+		case sub.Ch <- subEvent:
+			sub.pending = 0
+			sub.delivered++
+		default:
+			sub.pending++
+			sub.dropped++
+		}
+	}
+}
+
+// closes every subscription, later publishes are no-ops
+func (b *Bus) Close() {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	b.Closed = true
+	for sub := range b.Subs {
+		sub.closed = true
+		close(sub.Ch)
+	}
+	b.Subs = make(map[*Subscription]bool)
+}
+
+func (b *Bus) NumSubscribers() int {
+	b.Lock.Lock()
+	defer b.Lock.Unlock()
+	return len(b.Subs)
+}
+
+func (s *Subscription) Unsubscribe() {
+	s.bus.Lock.Lock()
+	defer s.bus.Lock.Unlock()
+	if s.closed {
+		return
+	}
+	s.closed = true
+	delete(s.bus.Subs, s)
+	close(s.Ch)
+}
+
+// total events delivered to and dropped for this subscriber
+func (s *Subscription) Stats() (int64, int64) {
+	s.bus.Lock.Lock()
+	defer s.bus.Lock.Unlock()
+	return s.delivered, s.dropped
+}
@@ -0,0 +1,112 @@
+package evbus
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBus_Delivers(t *testing.T) {
+	bus := MakeBus()
+	sub := bus.Subscribe(4)
+	bus.Publish("a", "first", 1)
+	bus.Publish("b", "second", 2)
+	ev := <-sub.Ch
+	if ev.Type != "a" || ev.Message != "first" || ev.Data != 1 || ev.Ts == 0 {
+		t.Fatalf("unexpected first event: %+v", ev)
+	}
+	ev = <-sub.Ch
+	if ev.Type != "b" || ev.Dropped != 0 {
+		t.Fatalf("unexpected second event: %+v", ev)
+	}
+}
+
+func TestBus_TypeFilter(t *testing.T) {
+	bus := MakeBus()
+	sub := bus.Subscribe(4, "b")
+	bus.Publish("a", "", nil)
+	bus.Publish("b", "", nil)
+	bus.Publish("c", "", nil)
+	if len(sub.Ch) != 1 {
+		t.Fatalf("expected 1 filtered event, got %d", len(sub.Ch))
+	}
+	if ev := <-sub.Ch; ev.Type != "b" {
+		t.Fatalf("expected type b, got %q", ev.Type)
+	}
+}
+
+func TestBus_DropsWithCount(t *testing.T) {
+	bus := MakeBus()
+	slow := bus.Subscribe(2)
+	fast := bus.Subscribe(10)
+	for i := 0; i < 5; i++ {
+		bus.Publish("a", "", i)
+	}
+	// a full subscriber must not affect the others
+	if len(fast.Ch) != 5 {
+		t.Fatalf("expected the fast subscriber to get all 5 events, got %d", len(fast.Ch))
+	}
+	delivered, dropped := slow.Stats()
+	if delivered != 2 || dropped != 3 {
+		t.Fatalf("expected 2 delivered and 3 dropped, got %d and %d", delivered, dropped)
+	}
+	<-slow.Ch
+	<-slow.Ch
+	bus.Publish("a", "", 5)
+	ev := <-slow.Ch
+	if ev.Data != 5 || ev.Dropped != 3 {
+		t.Fatalf("expected the next event to report 3 dropped, got %+v", ev)
+	}
+	bus.Publish("a", "", 6)
+	if ev := <-slow.Ch; ev.Dropped != 0 {
+		t.Fatalf("expected the dropped count to reset, got %d", ev.Dropped)
+	}
+}
+
+func TestBus_Unsubscribe(t *testing.T) {
+	bus := MakeBus()
+	sub := bus.Subscribe(4)
+	sub.Unsubscribe()
+	sub.Unsubscribe() // idempotent
+	bus.Publish("a", "", nil)
+	if _, ok := <-sub.Ch; ok {
+		t.Fatalf("expected the channel to be closed")
+	}
+	if bus.NumSubscribers() != 0 {
+		t.Fatalf("expected no subscribers, got %d", bus.NumSubscribers())
+	}
+}
+
+func TestBus_Close(t *testing.T) {
+	bus := MakeBus()
+	sub := bus.Subscribe(4)
+	bus.Close()
+	bus.Publish("a", "", nil)
+	if _, ok := <-sub.Ch; ok {
+		t.Fatalf("expected the channel to be closed")
+	}
+	sub.Unsubscribe() // safe after close
+	late := bus.Subscribe(4)
+	if _, ok := <-late.Ch; ok {
+		t.Fatalf("expected a subscription on a closed bus to be closed")
+	}
+}
+
+func TestBus_ConcurrentPublish(t *testing.T) {
+	bus := MakeBus()
+	sub := bus.Subscribe(1000)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				bus.Publish("a", "", j)
+			}
+		}()
+	}
+	wg.Wait()
+	delivered, dropped := sub.Stats()
+	if delivered+dropped != 1000 || len(sub.Ch) != int(delivered) {
+		t.Fatalf("lost events: delivered %d, dropped %d, buffered %d", delivered, dropped, len(sub.Ch))
+	}
+}
@@ -0,0 +1,182 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// a log file that rotates itself once it reaches a size limit.  the current file is renamed to
+// <path>.1 (older files shift up to <path>.<keep>, anything beyond keep is removed) and a new file is
+// started at path.  rotation and Reopen hold the same lock as Write, so a write never lands in a
+// file that is being renamed.
+package logfile
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const DefaultKeep = 3
+const MaxKeep = 100
+
+type RotatingFile struct {
+	lock         *sync.Mutex
+	path         string
+	maxSize      int64 // 0 never rotates on size
+	keep         int
+	file         *os.File
+	size         int64
+	rotations    int64
+	lastRotateTs int64
+	lastErr      string
+}
+
+type Stats struct {
+	Path         string
+	Size         int64
+	MaxSize      int64
+	Keep         int
+	Rotations    int64
+	LastRotateTs int64 // unix ms, 0 if it never rotated
+	LastError    string
+}
+
+func RotatedName(path string, idx int) string {
+	return fmt.Sprintf("%s.%d", path, idx)
+}
+
+// opens (appends to) path, a maxSize of 0 disables size based rotation
+func Open(path string, maxSize int64, keep int) (*RotatingFile, error) {
+	if maxSize < 0 {
+		return nil, fmt.Errorf("invalid max size %d", maxSize)
+	}
+	if keep < 0 || keep > MaxKeep {
+		return nil, fmt.Errorf("invalid keep %d (must be between 0 and %d)", keep, MaxKeep)
+	}
+	rf := &RotatingFile{lock: &sync.Mutex{}, path: path, maxSize: maxSize, keep: keep}
+	if err := rf.open_nolock(); err != nil {
+		return nil, err
+	}
+	return rf, nil
+}
+
+func (rf *RotatingFile) open_nolock() error {
+	file, err := os.OpenFile(rf.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("cannot open log file: %w", err)
+	}
+	finfo, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("cannot stat log file: %w", err)
+	}
+	rf.file = file
+	rf.size = finfo.Size()
+	return nil
+}
+
+func (rf *RotatingFile) setErr_nolock(err error) error {
+	if err != nil {
+		rf.lastErr = err.Error()
+	}
+	return err
+}
+
+// a single write larger than maxSize still goes (whole) into a fresh file
+func (rf *RotatingFile) Write(p []byte) (int, error) {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.maxSize > 0 && rf.size > 0 && rf.size+int64(len(p)) > rf.maxSize {
+		// a failure is recorded in lastErr, the file is reopened below if it has to be
+		rf.rotate_nolock()
+	}
+	if rf.file == nil {
+		// a rotation or reopen couldn't create the file, try again
+		if err := rf.setErr_nolock(rf.open_nolock()); err != nil {
+			return 0, err
+		}
+	}
+	n, err := rf.file.Write(p)
+	rf.size += int64(n)
+	return n, rf.setErr_nolock(err)
+}
+
+// shifts <path>.N up to <path>.N+1 (dropping the ones past keep), moves path to <path>.1 and starts
+// a new file.  with keep 0 the old contents are discarded
+func (rf *RotatingFile) rotate_nolock() error {
+	if rf.file != nil {
+		rf.file.Close()
+		rf.file = nil
+	}
+	if rf.keep == 0 {
+		if err := os.Remove(rf.path); err != nil && !os.IsNotExist(err) {
+			rf.setErr_nolock(fmt.Errorf("cannot remove log file: %w", err))
+		}
+	} else {
+		os.Remove(RotatedName(rf.path, rf.keep))
+		for idx := rf.keep - 1; idx >= 1; idx-- {
+			os.Rename(RotatedName(rf.path, idx), RotatedName(rf.path, idx+1))
+		}
+		if err := os.Rename(rf.path, RotatedName(rf.path, 1)); err != nil && !os.IsNotExist(err) {
+			rf.setErr_nolock(fmt.Errorf("cannot rotate log file: %w", err))
+		}
+	}
+	rf.rotations++
+	rf.lastRotateTs = time.Now().UnixMilli()
+	return rf.setErr_nolock(rf.open_nolock())
+}
+
+// rotates now, regardless of the size
+func (rf *RotatingFile) Rotate() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	return rf.rotate_nolock()
+}
+
+// closes and reopens path without renaming anything (for an external logrotate that moved the file)
+func (rf *RotatingFile) Reopen() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.file != nil {
+		rf.file.Close()
+		rf.file = nil
+	}
+	return rf.setErr_nolock(rf.open_nolock())
+}
+
+func (rf *RotatingFile) Close() error {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	if rf.file == nil {
+		return nil
+	}
+	err := rf.file.Close()
+	rf.file = nil
+	return err
+}
+
+// the rotated files that currently exist, newest first
+func (rf *RotatingFile) RotatedFiles() []string {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	var rtn []string
+	for idx := 1; idx <= rf.keep; idx++ {
+		name := RotatedName(rf.path, idx)
+		if _, err := os.Stat(name); err == nil {
+			rtn = append(rtn, name)
+		}
+	}
+	return rtn
+}
+
+func (rf *RotatingFile) GetStats() Stats {
+	rf.lock.Lock()
+	defer rf.lock.Unlock()
+	return Stats{
+		Path:         rf.path,
+		Size:         rf.size,
+		MaxSize:      rf.maxSize,
+		Keep:         rf.keep,
+		Rotations:    rf.rotations,
+		LastRotateTs: rf.lastRotateTs,
+		LastError:    rf.lastErr,
+	}
+}
@@ -0,0 +1,98 @@
+package logfile
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func readFile(t *testing.T, name string) string {
+	barr, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatalf("cannot read %s: %v", name, err)
+	}
+	return string(barr)
+}
+
+func TestRotatingFile_RotatesAtMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	rf, err := Open(path, 20, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	line := strings.Repeat("x", 9) + "\n" // 10 bytes
+	for i := 0; i < 7; i++ {
+		rf.Write([]byte(line))
+	}
+	// 7 lines, 2 per file: current has 1, .1 and .2 have 2 each, the oldest file was removed
+	if got := readFile(t, path); got != line {
+		t.Errorf("unexpected current file %q", got)
+	}
+	for _, idx := range []int{1, 2} {
+		if got := readFile(t, RotatedName(path, idx)); got != line+line {
+			t.Errorf("unexpected rotated file %d: %q", idx, got)
+		}
+	}
+	if _, err := os.Stat(RotatedName(path, 3)); !os.IsNotExist(err) {
+		t.Errorf("expected no file past keep, got err %v", err)
+	}
+	stats := rf.GetStats()
+	if stats.Rotations != 3 || stats.Size != 10 || stats.LastError != "" {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+	if files := rf.RotatedFiles(); len(files) != 2 {
+		t.Errorf("expected 2 rotated files, got %v", files)
+	}
+}
+
+func TestRotatingFile_AppendsAndKeepZero(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	os.WriteFile(path, []byte("old\n"), 0600)
+	rf, err := Open(path, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	rf.Write([]byte("new\n"))
+	if got := readFile(t, path); got != "old\nnew\n" {
+		t.Errorf("expected append, got %q", got)
+	}
+	if err := rf.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	rf.Write([]byte("after\n"))
+	if got := readFile(t, path); got != "after\n" {
+		t.Errorf("expected a fresh file, got %q", got)
+	}
+	if _, err := os.Stat(RotatedName(path, 1)); !os.IsNotExist(err) {
+		t.Errorf("keep 0 should not leave rotated files")
+	}
+}
+
+func TestRotatingFile_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	rf, err := Open(path, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rf.Close()
+	rf.Write([]byte("one\n"))
+	// an external logrotate moves the file away
+	os.Rename(path, path+".moved")
+	rf.Write([]byte("two\n"))
+	if err := rf.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	rf.Write([]byte("three\n"))
+	if got := readFile(t, path+".moved"); got != "one\ntwo\n" {
+		t.Errorf("unexpected moved file %q", got)
+	}
+	if got := readFile(t, path); got != "three\n" {
+		t.Errorf("unexpected reopened file %q", got)
+	}
+	if stats := rf.GetStats(); stats.Size != 6 || stats.Rotations != 0 {
+		t.Errorf("unexpected stats: %+v", stats)
+	}
+}
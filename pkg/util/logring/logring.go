@@ -0,0 +1,129 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// in-memory ring buffer of log lines, bounded by total bytes.
+// when full the oldest entries are dropped (and counted) so readers can tell the tail is truncated.
+package logring
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+const DefaultMaxBytes = 1024 * 1024
+const MaxLineSize = 16 * 1024 // longer lines are truncated
+
+// fixed per-entry overhead charged against the byte budget (so many tiny lines are still bounded)
+const entryOverhead = 32
+
+type LogEntry struct {
+	Ts   int64  `json:"ts"` // unix ms
+	Line string `json:"line"`
+}
+
+type LogRing struct {
+	lock       *sync.Mutex
+	maxBytes   int
+	curBytes   int
+	entries    []LogEntry // oldest first
+	dropped    int64      // entries dropped because the buffer was full
+	partial    []byte     // incomplete line (waiting for a newline)
+	totalLines int64
+}
+
+type LogRingStats struct {
+	MaxBytes   int   `json:"maxbytes"`
+	CurBytes   int   `json:"curbytes"`
+	NumEntries int   `json:"numentries"`
+	Dropped    int64 `json:"dropped"`
+	TotalLines int64 `json:"totallines"`
+}
+
+func MakeLogRing(maxBytes int) *LogRing {
+	if maxBytes <= 0 {
+		maxBytes = DefaultMaxBytes
+	}
+	return &LogRing{
+		lock:     &sync.Mutex{},
+		maxBytes: maxBytes,
+	}
+}
+
+func entrySize(line string) int {
+	return len(line) + entryOverhead
+}
+
+// implements io.Writer, each newline terminated line becomes an entry
+func (lr *LogRing) Write(p []byte) (int, error) {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+	data := p
+	for len(data) > 0 {
+		idx := bytes.IndexByte(data, '\n')
+		if idx == -1 {
+			lr.partial = append(lr.partial, data...)
+			if len(lr.partial) > MaxLineSize {
+				lr.addEntry_nolock(string(lr.partial))
+				lr.partial = nil
+			}
+			break
+		}
+		var line string
+		if len(lr.partial) > 0 {
+			line = string(append(lr.partial, data[:idx]...))
+			lr.partial = nil
+		} else {
+			line = string(data[:idx])
+		}
+		lr.addEntry_nolock(line)
+		data = data[idx+1:]
+	}
+	return len(p), nil
+}
+
+func (lr *LogRing) addEntry_nolock(line string) {
+	if len(line) > MaxLineSize {
+		line = line[:MaxLineSize]
+	}
+	lr.totalLines++
+	size := entrySize(line)
+	for len(lr.entries) > 0 && lr.curBytes+size > lr.maxBytes {
+		lr.curBytes -= entrySize(lr.entries[0].Line)
+		lr.entries[0] = LogEntry{}
+		lr.entries = lr.entries[1:]
+		lr.dropped++
+	}
+	if size > lr.maxBytes {
+		// can never fit
+		lr.dropped++
+		return
+	}
+	lr.entries = append(lr.entries, LogEntry{Ts: time.Now().UnixMilli(), Line: line})
+	lr.curBytes += size
+}
+
+// returns (up to) the last n entries (n <= 0 for all), oldest first, and the number of entries dropped so far
+func (lr *LogRing) Tail(n int) ([]LogEntry, int64) {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+	start := 0
+	if n > 0 && n < len(lr.entries) {
+		start = len(lr.entries) - n
+	}
+	rtn := make([]LogEntry, len(lr.entries)-start)
+	copy(rtn, lr.entries[start:])
+	return rtn, lr.dropped
+}
+
+func (lr *LogRing) GetStats() LogRingStats {
+	lr.lock.Lock()
+	defer lr.lock.Unlock()
+	return LogRingStats{
+		MaxBytes:   lr.maxBytes,
+		CurBytes:   lr.curBytes,
+		NumEntries: len(lr.entries),
+		Dropped:    lr.dropped,
+		TotalLines: lr.totalLines,
+	}
+}
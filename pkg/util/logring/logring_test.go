@@ -0,0 +1,47 @@
+package logring
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLogRing_Lines(t *testing.T) {
+	lr := MakeLogRing(1024)
+	lr.Write([]byte("line1\nli"))
+	lr.Write([]byte("ne2\n"))
+	entries, dropped := lr.Tail(0)
+	if len(entries) != 2 || entries[0].Line != "line1" || entries[1].Line != "line2" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	if dropped != 0 {
+		t.Errorf("expected 0 dropped, got %d", dropped)
+	}
+}
+
+func TestLogRing_DropsOldest(t *testing.T) {
+	line := strings.Repeat("x", 68) // 100 bytes per entry with overhead
+	lr := MakeLogRing(350)
+	for i := 0; i < 5; i++ {
+		lr.Write([]byte(line + "\n"))
+	}
+	stats := lr.GetStats()
+	if stats.NumEntries != 3 || stats.Dropped != 2 || stats.TotalLines != 5 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+	if stats.CurBytes > stats.MaxBytes {
+		t.Errorf("buffer over budget: %d > %d", stats.CurBytes, stats.MaxBytes)
+	}
+	entries, dropped := lr.Tail(2)
+	if len(entries) != 2 || dropped != 2 {
+		t.Errorf("expected 2 entries and 2 dropped, got %d and %d", len(entries), dropped)
+	}
+}
+
+func TestLogRing_OversizedLine(t *testing.T) {
+	lr := MakeLogRing(64)
+	lr.Write([]byte(strings.Repeat("y", 100) + "\n"))
+	entries, dropped := lr.Tail(0)
+	if len(entries) != 0 || dropped != 1 {
+		t.Errorf("expected oversized line to be dropped, got %d entries, %d dropped", len(entries), dropped)
+	}
+}
@@ -0,0 +1,19 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build !windows
+
+package namedpipe
+
+import (
+	"net"
+	"time"
+)
+
+func Listen(path string) (net.Listener, error) {
+	return nil, ErrNotSupported
+}
+
+func Dial(path string, timeout time.Duration) (net.Conn, error) {
+	return nil, ErrNotSupported
+}
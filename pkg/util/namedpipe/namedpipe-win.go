@@ -0,0 +1,335 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+//go:build windows
+
+package namedpipe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+)
+
+const pipeBufSize = 64 * 1024
+const dialRetryInterval = 20 * time.Millisecond
+
+// owner (the current user) and SYSTEM get full access, protected from inheriting anything more permissive
+func makeSecurityAttributes() (*windows.SecurityAttributes, error) {
+	tokenUser, err := windows.GetCurrentProcessToken().GetTokenUser()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the current user: %w", err)
+	}
+	sddl := fmt.Sprintf("D:P(A;;GA;;;%s)(A;;GA;;;SY)", tokenUser.User.Sid.String())
+	sd, err := windows.SecurityDescriptorFromString(sddl)
+	if err != nil {
+		return nil, fmt.Errorf("cannot build the pipe security descriptor: %w", err)
+	}
+	sa := &windows.SecurityAttributes{SecurityDescriptor: sd}
+	sa.Length = uint32(unsafe.Sizeof(*sa))
+	return sa, nil
+}
+
+type pipeListener struct {
+	path    string
+	sa      *windows.SecurityAttributes
+	lock    sync.Mutex
+	next    windows.Handle // the instance the next client connects to
+	closed  bool
+	closeEv windows.Handle // set by Close, wakes a pending Accept
+}
+
+func createPipe(path string, sa *windows.SecurityAttributes, first bool) (windows.Handle, error) {
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return windows.InvalidHandle, err
+	}
+	flags := uint32(windows.PIPE_ACCESS_DUPLEX | windows.FILE_FLAG_OVERLAPPED)
+	if first {
+		// fails if another server already owns the name (never share it with someone else's instances)
+		flags |= windows.FILE_FLAG_FIRST_PIPE_INSTANCE
+	}
+	mode := uint32(windows.PIPE_TYPE_BYTE | windows.PIPE_READMODE_BYTE | windows.PIPE_WAIT | windows.PIPE_REJECT_REMOTE_CLIENTS)
+	return windows.CreateNamedPipe(pathPtr, flags, mode, windows.PIPE_UNLIMITED_INSTANCES, pipeBufSize, pipeBufSize, 0, sa)
+}
+
+// an error wrapping fs.ErrExist (ERROR_ACCESS_DENIED) means another server is listening on the pipe
+func Listen(path string) (net.Listener, error) {
+	if !IsPipePath(path) {
+		return nil, fmt.Errorf("invalid pipe name %q (must start with %s)", path, PipePrefix)
+	}
+	sa, err := makeSecurityAttributes()
+	if err != nil {
+		return nil, err
+	}
+	handle, err := createPipe(path, sa, true)
+	if errors.Is(err, windows.ERROR_ACCESS_DENIED) {
+		return nil, fmt.Errorf("pipe %q is already in use: %w", path, os.ErrExist)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot create pipe %q: %w", path, err)
+	}
+	closeEv, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		windows.CloseHandle(handle)
+		return nil, err
+	}
+	return &pipeListener{path: path, sa: sa, next: handle, closeEv: closeEv}, nil
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.lock.Lock()
+	if l.closed {
+		l.lock.Unlock()
+		return nil, net.ErrClosed
+	}
+	handle := l.next
+	l.next = windows.InvalidHandle
+	l.lock.Unlock()
+	if handle == windows.InvalidHandle {
+		var err error
+		handle, err = createPipe(l.path, l.sa, false)
+		if err != nil {
+			return nil, fmt.Errorf("cannot create pipe instance: %w", err)
+		}
+	}
+	if err := l.waitConnect(handle); err != nil {
+		windows.CloseHandle(handle)
+		return nil, err
+	}
+	// the next instance is created right away, clients dialing in between get ERROR_PIPE_BUSY and retry
+	if next, err := createPipe(l.path, l.sa, false); err == nil {
+		l.lock.Lock()
+		if l.closed {
+			windows.CloseHandle(next)
+		} else {
+			l.next = next
+		}
+		l.lock.Unlock()
+	}
+	return makePipeConn(handle, l.path), nil
+}
+
+func (l *pipeListener) waitConnect(handle windows.Handle) error {
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return err
+	}
+	defer windows.CloseHandle(event)
+	ov := &windows.Overlapped{HEvent: event}
+	err = windows.ConnectNamedPipe(handle, ov)
+	if err == nil || errors.Is(err, windows.ERROR_PIPE_CONNECTED) {
+		return nil
+	}
+	if !errors.Is(err, windows.ERROR_IO_PENDING) {
+		return fmt.Errorf("cannot accept on pipe %q: %w", l.path, err)
+	}
+	idx, err := windows.WaitForMultipleObjects([]windows.Handle{event, l.closeEv}, false, windows.INFINITE)
+	if err != nil || idx != windows.WAIT_OBJECT_0 {
+		windows.CancelIoEx(handle, ov)
+		var done uint32
+		windows.GetOverlappedResult(handle, ov, &done, true)
+		return net.ErrClosed
+	}
+	var done uint32
+	return windows.GetOverlappedResult(handle, ov, &done, true)
+}
+
+func (l *pipeListener) Close() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.closed {
+		return nil
+	}
+	l.closed = true
+	windows.SetEvent(l.closeEv)
+	if l.next != windows.InvalidHandle {
+		windows.CloseHandle(l.next)
+		l.next = windows.InvalidHandle
+	}
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr {
+	return pipeAddr(l.path)
+}
+
+// overlapped handle, so a read and a write can be pending at the same time.  a deadline applies to the
+// reads/writes started after it is set
+type pipeConn struct {
+	handle        windows.Handle
+	path          string
+	ioLock        sync.RWMutex // held (shared) by every operation, Close takes it exclusively to close the handle
+	closed        atomic.Bool
+	readDeadline  atomic.Int64 // unix nanos, 0 for none
+	writeDeadline atomic.Int64
+}
+
+func makePipeConn(handle windows.Handle, path string) *pipeConn {
+	return &pipeConn{handle: handle, path: path}
+}
+
+func (c *pipeConn) doIo(deadline int64, ioFn func(ov *windows.Overlapped, done *uint32) error) (int, error) {
+	c.ioLock.RLock()
+	defer c.ioLock.RUnlock()
+	if c.closed.Load() {
+		return 0, net.ErrClosed
+	}
+	event, err := windows.CreateEvent(nil, 1, 0, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer windows.CloseHandle(event)
+	ov := &windows.Overlapped{HEvent: event}
+	var done uint32
+	err = ioFn(ov, &done)
+	if err != nil && !errors.Is(err, windows.ERROR_IO_PENDING) {
+		return int(done), c.mapErr(err)
+	}
+	timedOut := false
+	if err != nil {
+		waitMs := uint32(windows.INFINITE)
+		if deadline != 0 {
+			waitMs = uint32(max(time.Until(time.Unix(0, deadline)).Milliseconds(), 0))
+		}
+		waitResult, _ := windows.WaitForSingleObject(event, waitMs)
+		if waitResult == uint32(windows.WAIT_TIMEOUT) {
+			timedOut = true
+			windows.CancelIoEx(c.handle, ov)
+		}
+	}
+	err = windows.GetOverlappedResult(c.handle, ov, &done, true)
+	if timedOut && errors.Is(err, windows.ERROR_OPERATION_ABORTED) {
+		return int(done), os.ErrDeadlineExceeded
+	}
+	if err != nil {
+		return int(done), c.mapErr(err)
+	}
+	return int(done), nil
+}
+
+func (c *pipeConn) mapErr(err error) error {
+	if c.closed.Load() || errors.Is(err, windows.ERROR_OPERATION_ABORTED) {
+		return net.ErrClosed
+	}
+	if errors.Is(err, windows.ERROR_BROKEN_PIPE) || errors.Is(err, windows.ERROR_NO_DATA) || errors.Is(err, windows.ERROR_PIPE_NOT_CONNECTED) {
+		return io.EOF
+	}
+	return err
+}
+
+func (c *pipeConn) Read(buf []byte) (int, error) {
+	if len(buf) == 0 {
+		return 0, nil
+	}
+	n, err := c.doIo(c.readDeadline.Load(), func(ov *windows.Overlapped, done *uint32) error {
+		return windows.ReadFile(c.handle, buf, done, ov)
+	})
+	if n == 0 && err == nil {
+		// a zero length message, the other side never sends one
+		return 0, io.EOF
+	}
+	return n, err
+}
+
+func (c *pipeConn) Write(buf []byte) (int, error) {
+	written := 0
+	for written < len(buf) {
+		n, err := c.doIo(c.writeDeadline.Load(), func(ov *windows.Overlapped, done *uint32) error {
+			return windows.WriteFile(c.handle, buf[written:], done, ov)
+		})
+		written += n
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				err = io.ErrClosedPipe
+			}
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+func (c *pipeConn) Close() error {
+	if c.closed.Swap(true) {
+		return nil
+	}
+	// pending operations are canceled until they've all returned (one may start just as we close)
+	for !c.ioLock.TryLock() {
+		windows.CancelIoEx(c.handle, nil)
+		time.Sleep(time.Millisecond)
+	}
+	defer c.ioLock.Unlock()
+	windows.FlushFileBuffers(c.handle)
+	windows.DisconnectNamedPipe(c.handle)
+	return windows.CloseHandle(c.handle)
+}
+
+func (c *pipeConn) LocalAddr() net.Addr {
+	return pipeAddr(c.path)
+}
+
+func (c *pipeConn) RemoteAddr() net.Addr {
+	return pipeAddr(c.path)
+}
+
+func deadlineNanos(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func (c *pipeConn) SetDeadline(t time.Time) error {
+	c.readDeadline.Store(deadlineNanos(t))
+	c.writeDeadline.Store(deadlineNanos(t))
+	return nil
+}
+
+func (c *pipeConn) SetReadDeadline(t time.Time) error {
+	c.readDeadline.Store(deadlineNanos(t))
+	return nil
+}
+
+func (c *pipeConn) SetWriteDeadline(t time.Time) error {
+	c.writeDeadline.Store(deadlineNanos(t))
+	return nil
+}
+
+// retries while every instance is busy (the listener creates the next one after each accept).  a missing
+// pipe is returned right away, wrapping fs.ErrNotExist
+func Dial(path string, timeout time.Duration) (net.Conn, error) {
+	if !IsPipePath(path) {
+		return nil, fmt.Errorf("invalid pipe name %q (must start with %s)", path, PipePrefix)
+	}
+	pathPtr, err := windows.UTF16PtrFromString(path)
+	if err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	for {
+		// SECURITY_IDENTIFICATION: the server may identify us but never impersonate us
+		handle, err := windows.CreateFile(pathPtr, windows.GENERIC_READ|windows.GENERIC_WRITE, 0, nil, windows.OPEN_EXISTING,
+			windows.FILE_FLAG_OVERLAPPED|windows.SECURITY_SQOS_PRESENT|windows.SECURITY_IDENTIFICATION, 0)
+		if err == nil {
+			return makePipeConn(handle, path), nil
+		}
+		if errors.Is(err, windows.ERROR_FILE_NOT_FOUND) {
+			return nil, fmt.Errorf("no server listening on pipe %q: %w", path, os.ErrNotExist)
+		}
+		if !errors.Is(err, windows.ERROR_PIPE_BUSY) {
+			return nil, fmt.Errorf("cannot connect to pipe %q: %w", path, err)
+		}
+		if timeout > 0 && time.Now().After(deadline) {
+			return nil, fmt.Errorf("cannot connect to pipe %q: %w", path, os.ErrDeadlineExceeded)
+		}
+		time.Sleep(dialRetryInterval)
+	}
+}
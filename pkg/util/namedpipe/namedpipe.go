@@ -0,0 +1,29 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// named pipe listener and dialer for windows, where the wsh clients of a connserver can't rely on unix
+// domain sockets.  the pipes are local only and owner-only (the ACL grants the current user and SYSTEM)
+package namedpipe
+
+import (
+	"errors"
+	"strings"
+)
+
+const PipePrefix = `\\.\pipe\`
+
+var ErrNotSupported = errors.New("named pipes are only supported on windows")
+
+func IsPipePath(name string) bool {
+	return strings.HasPrefix(name, PipePrefix)
+}
+
+type pipeAddr string
+
+func (a pipeAddr) Network() string {
+	return "pipe"
+}
+
+func (a pipeAddr) String() string {
+	return string(a)
+}
@@ -6,16 +6,79 @@ package packetparser
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
 	"fmt"
 	"io"
+	"sync/atomic"
+
+	"github.com/wavetermdev/waveterm/pkg/util/ratelog"
 )
 
+// a packet is a single line "##N{...}\n" (the json never contains a raw newline)
+var packetMarker = []byte("##N{")
+
 type PacketParser struct {
 	Reader io.Reader
 	Ch     chan []byte
 }
 
+// optional counters for tracing the parser (see ParseWithStats)
+type ParseStats struct {
+	Parsed    atomic.Int64 // packets recognized in the input
+	Delivered atomic.Int64 // packets handed to packetCh
+	Raw       atomic.Int64 // non-packet lines sent to rawCh
+	Corrupt   atomic.Int64 // corrupt packet frames that were discarded (see splitPacketLine)
+}
+
 func Parse(input io.Reader, packetCh chan []byte, rawCh chan []byte) error {
+	return ParseWithStats(input, packetCh, rawCh, nil)
+}
+
+// a packet frame is only found complete at the end of a line, so a frame that lost its newline (or got
+// truncated) is glued to whatever comes next on the same line.  returns the raw text before the first
+// marker (nil if none), the corrupt bytes between the first marker and the packet (nil if none) and
+// the packet itself (nil if the line has no valid packet).  candidates are checked from the first
+// marker on, so a packet that contains the marker in one of its strings is still taken whole.
+// a line without a valid packet comes back as raw (a marker in the middle of raw text is just text) or,
+// when it starts with the marker, as corrupt
+func splitPacketLine(line []byte) ([]byte, []byte, []byte) {
+	firstMarker := bytes.Index(line, packetMarker)
+	if firstMarker < 0 {
+		return line, nil, nil
+	}
+	if bytes.HasSuffix(line, []byte{'}', '\n'}) {
+		for start := firstMarker; start >= 0; {
+			if json.Valid(line[start+3 : len(line)-1]) {
+				var raw, corrupt []byte
+				if firstMarker > 0 {
+					raw = append(line[:firstMarker:firstMarker], '\n')
+				}
+				if start > firstMarker {
+					corrupt = line[firstMarker:start]
+				}
+				return raw, corrupt, line[start+3 : len(line)-1]
+			}
+			next := bytes.Index(line[start+1:], packetMarker)
+			if next < 0 {
+				break
+			}
+			start += next + 1
+		}
+	}
+	if firstMarker == 0 {
+		return nil, line, nil
+	}
+	return line, nil, nil
+}
+
+// stats may be nil.  a corrupt packet frame (truncated, bad json) is logged and discarded, parsing
+// resyncs at the next packet, only the end of the input (or a read error) stops the parser
+func ParseWithStats(input io.Reader, packetCh chan []byte, rawCh chan []byte, stats *ParseStats) error {
+	return parseStream(input, packetCh, rawCh, stats, nil)
+}
+
+// ps is nil for plain packets (the negotiated frames of a PacketStream are then raw lines)
+func parseStream(input io.Reader, packetCh chan []byte, rawCh chan []byte, stats *ParseStats, ps *PacketStream) error {
 	bufReader := bufio.NewReader(input)
 	defer close(packetCh)
 	defer close(rawCh)
@@ -31,21 +94,63 @@ func Parse(input io.Reader, packetCh chan []byte, rawCh chan []byte) error {
 			// just a blank line
 			continue
 		}
-		if bytes.HasPrefix(line, []byte{'#', '#', 'N', '{'}) && bytes.HasSuffix(line, []byte{'}', '\n'}) {
-			// strip off the leading "##" and trailing "\n" (single byte)
-			packetCh <- line[3 : len(line)-1]
-		} else {
-			rawCh <- line
+		if ps != nil {
+			if packet, isFrame := ps.readFrame(line); isFrame {
+				if packet == nil {
+					continue
+				}
+				if stats != nil {
+					stats.Parsed.Add(1)
+				}
+				packetCh <- packet
+				if stats != nil {
+					stats.Delivered.Add(1)
+				}
+				ps.recordDelivered(len(packet))
+				continue
+			}
+		}
+		raw, corrupt, packet := splitPacketLine(line)
+		if len(raw) > 0 {
+			if stats != nil {
+				stats.Raw.Add(1)
+			}
+			rawCh <- raw
 		}
+		if len(corrupt) > 0 {
+			if stats != nil {
+				stats.Corrupt.Add(1)
+			}
+			ratelog.Printf("packetparser: discarded a corrupt packet frame (%d bytes), resyncing\n", len(corrupt))
+		}
+		if packet != nil {
+			if stats != nil {
+				stats.Parsed.Add(1)
+			}
+			packetCh <- packet
+			if stats != nil {
+				stats.Delivered.Add(1)
+			}
+			if ps != nil {
+				ps.recordDelivered(len(packet))
+			}
+		}
+	}
+}
+
+func checkPacket(packet []byte) error {
+	if packet[0] != '{' || packet[len(packet)-1] != '}' {
+		return fmt.Errorf("invalid packet, must start with '{' and end with '}'")
 	}
+	return nil
 }
 
 func WritePacket(output io.Writer, packet []byte) error {
 	if len(packet) < 2 {
 		return nil
 	}
-	if packet[0] != '{' || packet[len(packet)-1] != '}' {
-		return fmt.Errorf("invalid packet, must start with '{' and end with '}'")
+	if err := checkPacket(packet); err != nil {
+		return err
 	}
 	fullPacket := make([]byte, 0, len(packet)+5)
 	// we add the extra newline to make sure the ## appears at the beginning of the line
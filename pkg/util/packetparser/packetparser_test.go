@@ -0,0 +1,237 @@
+package packetparser
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// reads the input in fixed size chunks, so frames straddle read boundaries
+type chunkReader struct {
+	data      []byte
+	chunkSize int
+}
+
+func (r *chunkReader) Read(buf []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, io.EOF
+	}
+	n := min(r.chunkSize, len(r.data), len(buf))
+	copy(buf, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func parseAll(t *testing.T, input io.Reader) ([]string, []string, *ParseStats) {
+	packetCh := make(chan []byte, 100)
+	rawCh := make(chan []byte, 100)
+	stats := &ParseStats{}
+	if err := ParseWithStats(input, packetCh, rawCh, stats); err != nil {
+		t.Fatalf("unexpected parse error: %v", err)
+	}
+	var packets, raws []string
+	for packet := range packetCh {
+		packets = append(packets, string(packet))
+	}
+	for raw := range rawCh {
+		raws = append(raws, string(raw))
+	}
+	return packets, raws, stats
+}
+
+func checkStrings(t *testing.T, kind string, got []string, expected ...string) {
+	if len(got) != len(expected) {
+		t.Fatalf("expected %d %s, got %d: %q", len(expected), kind, len(got), got)
+	}
+	for idx := range expected {
+		if got[idx] != expected[idx] {
+			t.Errorf("%s %d: expected %q, got %q", kind, idx, expected[idx], got[idx])
+		}
+	}
+}
+
+func writePackets(t *testing.T, buf *bytes.Buffer, packets ...string) {
+	for _, packet := range packets {
+		if err := WritePacket(buf, []byte(packet)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParse_ResyncsAfterBadFrame(t *testing.T) {
+	var buf bytes.Buffer
+	writePackets(t, &buf, `{"a":1}`)
+	// a frame that lost its end, glued to the next good frame
+	buf.WriteString("\n##N{\"command\":\"trunc")
+	writePackets(t, &buf, `{"b":2}`)
+	// a complete but undecodable frame on its own line
+	buf.WriteString("\n##N{not json}\n")
+	writePackets(t, &buf, `{"c":3}`)
+	input := buf.Bytes()
+	readers := map[string]func() io.Reader{
+		"whole":   func() io.Reader { return bytes.NewReader(input) },
+		"onebyte": func() io.Reader { return iotest.OneByteReader(bytes.NewReader(input)) },
+		"chunk7":  func() io.Reader { return &chunkReader{data: input, chunkSize: 7} },
+		"chunk16": func() io.Reader { return &chunkReader{data: input, chunkSize: 16} },
+	}
+	for name, makeReader := range readers {
+		t.Run(name, func(t *testing.T) {
+			packets, raws, stats := parseAll(t, makeReader())
+			checkStrings(t, "packets", packets, `{"a":1}`, `{"b":2}`, `{"c":3}`)
+			checkStrings(t, "raw lines", raws)
+			if stats.Corrupt.Load() != 2 || stats.Parsed.Load() != 3 || stats.Delivered.Load() != 3 {
+				t.Errorf("unexpected stats: corrupt %d, parsed %d, delivered %d", stats.Corrupt.Load(), stats.Parsed.Load(), stats.Delivered.Load())
+			}
+		})
+	}
+}
+
+func TestParse_RawText(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("plain output\n")
+	// raw text that lost its newline before a packet
+	buf.WriteString("prompt$ ##N{\"a\":1}\n")
+	// a marker in the middle of raw text (no packet) stays raw
+	buf.WriteString("echo ##N{ done\n")
+	// the marker inside a packet's string doesn't split it
+	writePackets(t, &buf, `{"data":"x##N{\"y\":1}"}`)
+	packets, raws, stats := parseAll(t, &buf)
+	checkStrings(t, "packets", packets, `{"a":1}`, `{"data":"x##N{\"y\":1}"}`)
+	checkStrings(t, "raw lines", raws, "plain output\n", "prompt$ \n", "echo ##N{ done\n")
+	if stats.Corrupt.Load() != 0 {
+		t.Errorf("expected no corrupt frames, got %d", stats.Corrupt.Load())
+	}
+}
+
+func TestParse_ReadError(t *testing.T) {
+	var buf bytes.Buffer
+	writePackets(t, &buf, `{"a":1}`)
+	input := io.MultiReader(&buf, iotest.ErrReader(io.ErrUnexpectedEOF))
+	err := Parse(input, make(chan []byte, 10), make(chan []byte, 10))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n atomic.Int64
+}
+
+func (cw *countingWriter) Write(buf []byte) (int, error) {
+	cw.n.Add(int64(len(buf)))
+	return cw.w.Write(buf)
+}
+
+// two streams talking over (os buffered) pipes, the returned channels get what the other side sent.
+// B's channel is unbuffered, so B only counts a packet as delivered once the test took it
+func makeStreamPair(t *testing.T, optsA StreamOpts, optsB StreamOpts) (*PacketStream, *PacketStream, *countingWriter, chan []byte, chan []byte) {
+	abRead, abWrite, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	baRead, baWrite, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { abWrite.Close(); baWrite.Close() })
+	wireA := &countingWriter{w: abWrite}
+	streamA := MakePacketStream(wireA, optsA)
+	streamB := MakePacketStream(baWrite, optsB)
+	packetsA := make(chan []byte, 100) // received by A
+	packetsB := make(chan []byte)
+	go streamA.Parse(baRead, packetsA, make(chan []byte, 100), nil)
+	go streamB.Parse(abRead, packetsB, make(chan []byte, 100), nil)
+	go streamA.SendHello()
+	go streamB.SendHello()
+	waitFor(t, func() bool { return streamA.GetStatus().PeerHello && streamB.GetStatus().PeerHello })
+	return streamA, streamB, wireA, packetsA, packetsB
+}
+
+func waitFor(t *testing.T, condFn func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condFn() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPacketStream_Compression(t *testing.T) {
+	streamA, _, wireA, _, packetsB := makeStreamPair(t, StreamOpts{Compression: SupportedCompression}, StreamOpts{Compression: SupportedCompression})
+	if status := streamA.GetStatus(); status.Compression != Compression_Gzip {
+		t.Fatalf("expected gzip to be negotiated, got %q", status.Compression)
+	}
+	big := `{"data":"` + strings.Repeat("abcdefgh", 4096) + `"}`
+	before := wireA.n.Load()
+	if err := streamA.WritePacket([]byte(big)); err != nil {
+		t.Fatal(err)
+	}
+	if err := streamA.WritePacket([]byte(`{"small":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(<-packetsB); got != big {
+		t.Errorf("compressed packet came back different (%d bytes)", len(got))
+	}
+	if got := string(<-packetsB); got != `{"small":1}` {
+		t.Errorf("unexpected packet %q", got)
+	}
+	if wireBytes := wireA.n.Load() - before; wireBytes >= int64(len(big))/4 {
+		t.Errorf("expected the packet to be compressed, %d bytes on the wire for %d", wireBytes, len(big))
+	}
+}
+
+// a peer that never says hello gets plain packets, and a plain parser sees the hello as a raw line
+func TestPacketStream_OldPeer(t *testing.T) {
+	var buf bytes.Buffer
+	stream := MakePacketStream(&buf, StreamOpts{Compression: SupportedCompression, Window: 10})
+	if err := stream.SendHello(); err != nil {
+		t.Fatal(err)
+	}
+	big := `{"data":"` + strings.Repeat("x", 4096) + `"}`
+	for range 3 {
+		if err := stream.WritePacket([]byte(big)); err != nil {
+			t.Fatal(err)
+		}
+		if !stream.CanSendBulk() {
+			t.Fatal("a peer without flow control should never hold back packets")
+		}
+	}
+	packets, raws, _ := parseAll(t, &buf)
+	checkStrings(t, "packets", packets, big, big, big)
+	if len(raws) != 1 || !strings.HasPrefix(raws[0], "##H{") {
+		t.Errorf("expected the hello as the only raw line, got %q", raws)
+	}
+}
+
+func TestPacketStream_Credit(t *testing.T) {
+	const window = 8192
+	streamA, _, _, _, packetsB := makeStreamPair(t, StreamOpts{}, StreamOpts{Window: window})
+	packet := []byte(`{"data":"` + strings.Repeat("x", 3000) + `"}`)
+	sent := 0
+	for streamA.CanSendBulk() {
+		if err := streamA.WritePacket(packet); err != nil {
+			t.Fatal(err)
+		}
+		sent++
+		if sent > 10 {
+			t.Fatal("the window never filled")
+		}
+	}
+	if sent != 3 {
+		t.Errorf("expected 3 packets to fill the window, sent %d", sent)
+	}
+	for range sent {
+		<-packetsB
+	}
+	waitFor(t, streamA.CanSendBulk)
+	if status := streamA.GetStatus(); status.Outstanding >= window || status.Waits == 0 {
+		t.Errorf("unexpected status after the credit: %+v", status)
+	}
+}
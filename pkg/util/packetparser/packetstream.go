@@ -0,0 +1,389 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package packetparser
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/ratelog"
+)
+
+// negotiated framing on top of the plain "##N{...}" packets, for one stream (both directions).  each side
+// starts by writing a hello ("##H{...}") with what it supports.  an older peer sees the hello as a raw
+// line and never sends one, so nothing changes until both sides said hello:
+//   - compression: packets of at least MinCompressSize bytes are sent as "##C<algo>:<base64>" when the
+//     peer accepts the algorithm and it makes them smaller
+//   - flow control: each side advertises a window (bytes), the sender keeps track of the packet bytes the
+//     receiver hasn't acknowledged yet (acks are "##F{...}" credit frames) and CanSendBulk is false while
+//     the window is full.  it is up to the writer to hold back bulk packets, small interactive ones can
+//     always be sent (see wshutil.LaneWriter)
+
+const (
+	Compression_Gzip = "gzip"
+)
+
+// what this build can compress and decompress, in order of preference
+var SupportedCompression = []string{Compression_Gzip}
+
+const DefaultMinCompressSize = 1024
+const DefaultCreditWindow = 1024 * 1024
+const MaxDecompressedSize = 64 * 1024 * 1024
+
+const streamVersion = 1
+
+var helloMarker = []byte("##H{")
+var compressedMarker = []byte("##C")
+var creditMarker = []byte("##F{")
+
+type HelloData struct {
+	Version     int      `json:"v"`
+	Compression []string `json:"compression,omitempty"` // algorithms the side accepts
+	Window      int64    `json:"window,omitempty"`      // unacknowledged bytes the side accepts, 0 for no flow control
+}
+
+type creditData struct {
+	Credit int64 `json:"credit"`
+}
+
+type StreamOpts struct {
+	Compression     []string // algorithms we accept and send with, in order of preference (nil for none)
+	MinCompressSize int      // 0 for DefaultMinCompressSize
+	Window          int64    // bytes the peer may send us unacknowledged, 0 turns off flow control for the peer
+	// optional, called after each compressed packet is written
+	OnCompress func(algo string, rawBytes int, wireBytes int)
+	// optional, called when the peer's hello arrives with the algorithm we send with ("" for none)
+	OnHello func(peer HelloData, algo string)
+}
+
+type StreamStatus struct {
+	PeerHello   bool   `json:"peerhello"`             // the peer negotiates (false for older peers)
+	Compression string `json:"compression,omitempty"` // the algorithm we send with
+	PeerWindow  int64  `json:"peerwindow,omitempty"`  // 0 when our sending side isn't flow controlled
+	Outstanding int64  `json:"outstanding"`           // bytes sent that the peer hasn't acknowledged
+	Waits       int64  `json:"waits"`                 // times CanSendBulk said no
+}
+
+type PacketStream struct {
+	output    io.Writer
+	opts      StreamOpts
+	writeLock sync.Mutex // one frame at a time
+	lock      sync.Mutex
+	peerHello *HelloData
+	algo      string // chosen once the peer said hello
+	sent      int64  // packet bytes written (every packet, from the start)
+	acked     int64  // credit from the peer
+	waits     int64
+	received  int64 // packet bytes delivered (every packet, from the start)
+	granted   int64 // credit we sent
+	creditFn  func()
+	creditCh  chan struct{} // wakes the credit writer
+	helloSent bool          // no credit goes out before our hello
+	closed    bool
+}
+
+func MakePacketStream(output io.Writer, opts StreamOpts) *PacketStream {
+	if opts.MinCompressSize <= 0 {
+		opts.MinCompressSize = DefaultMinCompressSize
+	}
+	opts.Compression = slices.DeleteFunc(slices.Clone(opts.Compression), func(algo string) bool {
+		return !slices.Contains(SupportedCompression, algo)
+	})
+	return &PacketStream{output: output, opts: opts, creditCh: make(chan struct{}, 1)}
+}
+
+// the unknown entries of a comma separated list are an error, "none" (or empty) is no compression
+func ParseCompressionList(str string) ([]string, error) {
+	var rtn []string
+	for _, algo := range bytes.Split([]byte(str), []byte{','}) {
+		name := string(bytes.TrimSpace(algo))
+		if name == "" || name == "none" {
+			continue
+		}
+		if !slices.Contains(SupportedCompression, name) {
+			return nil, fmt.Errorf("unsupported compression %q (supported: %v)", name, SupportedCompression)
+		}
+		if !slices.Contains(rtn, name) {
+			rtn = append(rtn, name)
+		}
+	}
+	return rtn, nil
+}
+
+// must be the first thing written to the stream
+func (ps *PacketStream) SendHello() error {
+	barr, _ := json.Marshal(HelloData{Version: streamVersion, Compression: ps.opts.Compression, Window: ps.opts.Window})
+	err := ps.writeFrame(helloMarker[:3], barr)
+	ps.lock.Lock()
+	ps.helloSent = true
+	ps.lock.Unlock()
+	ps.wakeCreditWriter()
+	return err
+}
+
+// fn is called (without any lock held) when CanSendBulk may have become true
+func (ps *PacketStream) SetCreditFn(fn func()) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	ps.creditFn = fn
+}
+
+// wakes a writer waiting for credit (the stream is gone, CanSendBulk is now always true)
+func (ps *PacketStream) Close() {
+	ps.lock.Lock()
+	ps.closed = true
+	creditFn := ps.creditFn
+	ps.lock.Unlock()
+	if creditFn != nil {
+		creditFn()
+	}
+}
+
+// false while the peer's window is full.  always true for peers without flow control
+func (ps *PacketStream) CanSendBulk() bool {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	if ps.closed || ps.peerHello == nil || ps.peerHello.Window <= 0 {
+		return true
+	}
+	if ps.sent-ps.acked < ps.peerHello.Window {
+		return true
+	}
+	ps.waits++
+	return false
+}
+
+func (ps *PacketStream) GetStatus() StreamStatus {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+	rtn := StreamStatus{PeerHello: ps.peerHello != nil, Compression: ps.algo, Outstanding: ps.sent - ps.acked, Waits: ps.waits}
+	if ps.peerHello != nil {
+		rtn.PeerWindow = ps.peerHello.Window
+	}
+	return rtn
+}
+
+func (ps *PacketStream) writeFrame(prefix []byte, body []byte) error {
+	frame := make([]byte, 0, len(body)+len(prefix)+5)
+	frame = append(frame, '\n')
+	frame = append(frame, prefix...)
+	frame = append(frame, body...)
+	frame = append(frame, '\n')
+	ps.writeLock.Lock()
+	defer ps.writeLock.Unlock()
+	_, err := ps.output.Write(frame)
+	return err
+}
+
+func compressPacket(algo string, packet []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	switch algo {
+	case Compression_Gzip:
+		writer := gzip.NewWriter(&buf)
+		if _, err := writer.Write(packet); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported compression %q", algo)
+	}
+	return buf.Bytes(), nil
+}
+
+func decompressPacket(algo string, data []byte) ([]byte, error) {
+	switch algo {
+	case Compression_Gzip:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+		rtn, err := io.ReadAll(io.LimitReader(reader, MaxDecompressedSize+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(rtn) > MaxDecompressedSize {
+			return nil, fmt.Errorf("decompressed packet is over %d bytes", MaxDecompressedSize)
+		}
+		return rtn, nil
+	}
+	return nil, fmt.Errorf("unsupported compression %q", algo)
+}
+
+// compressed when the peer accepts it and it pays off, otherwise the same as WritePacket
+func (ps *PacketStream) WritePacket(packet []byte) error {
+	if len(packet) < 2 {
+		return nil
+	}
+	if err := checkPacket(packet); err != nil {
+		return err
+	}
+	ps.lock.Lock()
+	algo := ps.algo
+	ps.sent += int64(len(packet))
+	ps.lock.Unlock()
+	if algo != "" && len(packet) >= ps.opts.MinCompressSize {
+		compressed, err := compressPacket(algo, packet)
+		if err == nil && base64.StdEncoding.EncodedLen(len(compressed))+len(algo)+1 < len(packet) {
+			body := make([]byte, 0, len(algo)+1+base64.StdEncoding.EncodedLen(len(compressed)))
+			body = append(body, algo...)
+			body = append(body, ':')
+			body = base64.StdEncoding.AppendEncode(body, compressed)
+			if err := ps.writeFrame(compressedMarker, body); err != nil {
+				return err
+			}
+			if ps.opts.OnCompress != nil {
+				ps.opts.OnCompress(algo, len(packet), len(body))
+			}
+			return nil
+		}
+	}
+	ps.writeLock.Lock()
+	defer ps.writeLock.Unlock()
+	return WritePacket(ps.output, packet)
+}
+
+// until the input ends.  hellos and credit frames are handled here, compressed packets are delivered
+// decompressed
+func (ps *PacketStream) Parse(input io.Reader, packetCh chan []byte, rawCh chan []byte, stats *ParseStats) error {
+	doneCh := make(chan struct{})
+	defer close(doneCh)
+	go ps.runCreditWriter(doneCh)
+	return parseStream(input, packetCh, rawCh, stats, ps)
+}
+
+// credit is written from here so the parser never blocks on the output
+func (ps *PacketStream) runCreditWriter(doneCh chan struct{}) {
+	defer panichandler.PanicHandler("PacketStream:runCreditWriter")
+	for {
+		select {
+		case <-doneCh:
+			return
+		case <-ps.creditCh:
+		}
+		ps.lock.Lock()
+		credit := ps.received - ps.granted
+		ps.granted = ps.received
+		ps.lock.Unlock()
+		if credit <= 0 {
+			continue
+		}
+		barr, _ := json.Marshal(creditData{Credit: credit})
+		if err := ps.writeFrame(creditMarker[:3], barr); err != nil {
+			return
+		}
+	}
+}
+
+// credit goes back once a quarter of our window was delivered (only to peers that negotiate)
+func (ps *PacketStream) recordDelivered(numBytes int) {
+	ps.lock.Lock()
+	ps.received += int64(numBytes)
+	ps.lock.Unlock()
+	ps.wakeCreditWriter()
+}
+
+func (ps *PacketStream) wakeCreditWriter() {
+	ps.lock.Lock()
+	sendCredit := ps.helloSent && ps.peerHello != nil && ps.opts.Window > 0 && ps.received-ps.granted >= max(ps.opts.Window/4, 1)
+	ps.lock.Unlock()
+	if sendCredit {
+		select {
+		case ps.creditCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (ps *PacketStream) handleHello(hello *HelloData) {
+	ps.lock.Lock()
+	ps.peerHello = hello
+	ps.algo = ""
+	for _, algo := range ps.opts.Compression {
+		if slices.Contains(hello.Compression, algo) {
+			ps.algo = algo
+			break
+		}
+	}
+	algo := ps.algo
+	creditFn := ps.creditFn
+	ps.lock.Unlock()
+	if ps.opts.OnHello != nil {
+		ps.opts.OnHello(*hello, algo)
+	}
+	if creditFn != nil {
+		creditFn()
+	}
+}
+
+func (ps *PacketStream) handleCredit(credit int64) {
+	ps.lock.Lock()
+	ps.acked += credit
+	creditFn := ps.creditFn
+	ps.lock.Unlock()
+	if creditFn != nil {
+		creditFn()
+	}
+}
+
+// isFrame is false for lines that aren't negotiated frames (they are parsed as plain packets).  a
+// compressed packet is returned decompressed, control frames return a nil packet
+func (ps *PacketStream) readFrame(line []byte) ([]byte, bool) {
+	line = bytes.TrimSuffix(line, []byte{'\n'})
+	switch {
+	case bytes.HasPrefix(line, helloMarker):
+		var hello HelloData
+		if err := json.Unmarshal(line[3:], &hello); err != nil {
+			ratelog.Printf("packetparser: discarded an invalid hello frame: %v\n", err)
+			return nil, true
+		}
+		ps.handleHello(&hello)
+		return nil, true
+	case bytes.HasPrefix(line, creditMarker):
+		var credit creditData
+		if err := json.Unmarshal(line[3:], &credit); err != nil || credit.Credit < 0 {
+			ratelog.Printf("packetparser: discarded an invalid credit frame\n")
+			return nil, true
+		}
+		ps.handleCredit(credit.Credit)
+		return nil, true
+	case bytes.HasPrefix(line, compressedMarker):
+		packet, err := readCompressedFrame(line[len(compressedMarker):])
+		if err != nil {
+			ratelog.Printf("packetparser: discarded a corrupt compressed frame (%d bytes): %v\n", len(line), err)
+			return nil, true
+		}
+		return packet, true
+	}
+	return nil, false
+}
+
+func readCompressedFrame(body []byte) ([]byte, error) {
+	algo, data, ok := bytes.Cut(body, []byte{':'})
+	if !ok {
+		return nil, errors.New("no algorithm")
+	}
+	compressed, err := base64.StdEncoding.AppendDecode(nil, data)
+	if err != nil {
+		return nil, err
+	}
+	packet, err := decompressPacket(string(algo), compressed)
+	if err != nil {
+		return nil, err
+	}
+	if len(packet) < 2 || checkPacket(packet) != nil || !json.Valid(packet) {
+		return nil, errors.New("not a json packet")
+	}
+	return packet, nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// collapses repeated identical log messages so a persistent fault can't flood the log.
+// the first occurrence of a message is logged immediately, repeats within the interval are counted
+// and reported as "(repeated N times)" once the interval has passed.
+package ratelog
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultInterval = 10 * time.Second
+const MaxTrackedMessages = 1000
+
+type rateEntry struct {
+	LastLogged time.Time
+	Suppressed int64
+}
+
+type RateLimiter struct {
+	Lock     *sync.Mutex
+	Interval time.Duration // 0 disables rate limiting
+	Entries  map[string]*rateEntry
+	LogFn    func(msg string)
+	NowFn    func() time.Time
+}
+
+func MakeRateLimiter(interval time.Duration) *RateLimiter {
+	return &RateLimiter{
+		Lock:     &sync.Mutex{},
+		Interval: interval,
+		Entries:  make(map[string]*rateEntry),
+		LogFn:    func(msg string) { log.Print(msg) },
+		NowFn:    time.Now,
+	}
+}
+
+var defaultLimiter = MakeRateLimiter(DefaultInterval)
+
+func SetInterval(interval time.Duration) {
+	defaultLimiter.SetInterval(interval)
+}
+
+func Printf(format string, args ...any) {
+	defaultLimiter.Printf(format, args...)
+}
+
+func (rl *RateLimiter) SetInterval(interval time.Duration) {
+	rl.Lock.Lock()
+	defer rl.Lock.Unlock()
+	rl.Interval = interval
+}
+
+func withRepeatCount(msg string, count int64) string {
+	return fmt.Sprintf("%s (repeated %d times)\n", strings.TrimRight(msg, "\n"), count)
+}
+
+// must hold lock.  reports and forgets messages whose interval has passed
+func (rl *RateLimiter) sweep_nolock(now time.Time) {
+	for msg, entry := range rl.Entries {
+		if now.Sub(entry.LastLogged) < rl.Interval {
+			continue
+		}
+		if entry.Suppressed > 0 {
+			rl.LogFn(withRepeatCount(msg, entry.Suppressed))
+		}
+		delete(rl.Entries, msg)
+	}
+}
+
+func (rl *RateLimiter) Printf(format string, args ...any) {
+	msg := fmt.Sprintf(format, args...)
+	rl.Lock.Lock()
+	defer rl.Lock.Unlock()
+	if rl.Interval <= 0 {
+		rl.LogFn(msg)
+		return
+	}
+	now := rl.NowFn()
+	rl.sweep_nolock(now)
+	if entry := rl.Entries[msg]; entry != nil {
+		entry.Suppressed++
+		return
+	}
+	if len(rl.Entries) >= MaxTrackedMessages {
+		// too many distinct messages to track, stop collapsing rather than growing without bound
+		rl.LogFn(msg)
+		return
+	}
+	rl.Entries[msg] = &rateEntry{LastLogged: now}
+	rl.LogFn(msg)
+}
+
+// logs pending repeat counts (e.g. before shutdown)
+func (rl *RateLimiter) Flush() {
+	rl.Lock.Lock()
+	defer rl.Lock.Unlock()
+	for msg, entry := range rl.Entries {
+		if entry.Suppressed > 0 {
+			rl.LogFn(withRepeatCount(msg, entry.Suppressed))
+		}
+		delete(rl.Entries, msg)
+	}
+}
+
+func Flush() {
+	defaultLimiter.Flush()
+}
@@ -0,0 +1,53 @@
+package ratelog
+
+import (
+	"testing"
+	"time"
+)
+
+func makeTestLimiter(interval time.Duration) (*RateLimiter, *[]string, *time.Time) {
+	var logged []string
+	now := time.Unix(1000, 0)
+	rl := MakeRateLimiter(interval)
+	rl.LogFn = func(msg string) { logged = append(logged, msg) }
+	rl.NowFn = func() time.Time { return now }
+	return rl, &logged, &now
+}
+
+func TestRateLimiter_CollapsesRepeats(t *testing.T) {
+	rl, logged, now := makeTestLimiter(10 * time.Second)
+	for i := 0; i < 5; i++ {
+		rl.Printf("accept error: %v\n", "boom")
+	}
+	if len(*logged) != 1 || (*logged)[0] != "accept error: boom\n" {
+		t.Fatalf("expected a single log line, got %q", *logged)
+	}
+	*now = now.Add(11 * time.Second)
+	rl.Printf("other message\n")
+	if len(*logged) != 3 || (*logged)[1] != "accept error: boom (repeated 4 times)\n" {
+		t.Fatalf("expected a repeat summary, got %q", *logged)
+	}
+}
+
+func TestRateLimiter_DistinctMessages(t *testing.T) {
+	rl, logged, _ := makeTestLimiter(10 * time.Second)
+	rl.Printf("a\n")
+	rl.Printf("b\n")
+	rl.Printf("a\n")
+	if len(*logged) != 2 {
+		t.Fatalf("expected 2 log lines, got %q", *logged)
+	}
+	rl.Flush()
+	if len(*logged) != 3 || (*logged)[2] != "a (repeated 1 times)\n" {
+		t.Fatalf("expected flush summary, got %q", *logged)
+	}
+}
+
+func TestRateLimiter_Disabled(t *testing.T) {
+	rl, logged, _ := makeTestLimiter(0)
+	rl.Printf("a\n")
+	rl.Printf("a\n")
+	if len(*logged) != 2 {
+		t.Fatalf("expected every line logged, got %q", *logged)
+	}
+}
@@ -11,12 +11,15 @@ import (
 	"log"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/util/namedpipe"
 )
 
 // set by main-server.go
@@ -39,6 +42,7 @@ var Dev_VarCache string        // caches WAVETERM_DEV
 const WaveLockFile = "wave.lock"
 const DomainSocketBaseName = "wave.sock"
 const RemoteDomainSocketBaseName = "wave-remote.sock"
+const RemotePipeBaseName = "wave"
 const WaveDBDir = "db"
 const JwtSecret = "waveterm" // TODO generate and store this
 const ConfigDir = "config"
@@ -137,10 +141,30 @@ func GetDomainSocketName() string {
 	return filepath.Join(GetWaveDataDir(), DomainSocketBaseName)
 }
 
+// what the connserver's local wsh clients connect to: a unix socket under RemoteWaveHome, or a per user
+// named pipe on windows (see GetRemotePipeName)
 func GetRemoteDomainSocketName() string {
+	if runtime.GOOS == "windows" {
+		return GetRemotePipeName()
+	}
 	return filepath.Join(RemoteWaveHome, RemoteDomainSocketBaseName)
 }
 
+// \\.\pipe\wave-<user>, pipes are machine wide so the name has to be per user (the ACL is owner-only)
+func GetRemotePipeName() string {
+	userName := "unknown"
+	if curUser, err := user.Current(); err == nil && curUser.Username != "" {
+		userName = curUser.Username
+	}
+	userName = strings.Map(func(ch rune) rune {
+		if (ch >= 'a' && ch <= 'z') || (ch >= '0' && ch <= '9') || ch == '.' || ch == '-' || ch == '_' {
+			return ch
+		}
+		return '_'
+	}, strings.ToLower(userName))
+	return namedpipe.PipePrefix + RemotePipeBaseName + "-" + userName
+}
+
 func EnsureWaveDataDir() error {
 	return CacheEnsureDir(GetWaveDataDir(), "wavehome", 0700, "wave home directory")
 }
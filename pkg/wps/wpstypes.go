@@ -13,6 +13,8 @@ const (
 	Event_UserInput        = "userinput"
 	Event_RouteGone        = "route:gone"
 	Event_WorkspaceUpdate  = "workspace:update"
+	Event_ConnServer       = "connserver:event"
+	Event_FileChange       = "file:change" // a remote file subscription, see wshrpc.CommandFileSubscribeData
 )
 
 type WaveEvent struct {
@@ -0,0 +1,96 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshclient
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"log"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// called after every chunk, totalBytes is -1 if unknown
+type StreamProgressFnType = func(bytesRead int64, totalBytes int64)
+
+type remoteFileReader struct {
+	path       string
+	finfo      *wshrpc.FileInfo
+	buf        bytes.Buffer
+	totalBytes int64
+	progressFn StreamProgressFnType
+}
+
+// appends the stream's data to the buffer, the fileinfo is taken from the first stream only
+func (r *remoteFileReader) readStream(w *wshutil.WshRpc, data wshrpc.CommandRemoteStreamFileData, opts *wshrpc.RpcOpts) error {
+	respCh := RemoteStreamFileCommand(w, data, opts)
+	gotFileInfo := false
+	for respUnion := range respCh {
+		if respUnion.Error != nil {
+			return respUnion.Error
+		}
+		resp := respUnion.Response
+		if !gotFileInfo && len(resp.FileInfo) > 0 {
+			gotFileInfo = true
+			if r.finfo == nil {
+				r.finfo = resp.FileInfo[0]
+				if r.finfo.NotFound {
+					return nil
+				}
+				if r.finfo.IsDir {
+					return fmt.Errorf("cannot read %q: is a directory", r.path)
+				}
+				r.totalBytes = r.finfo.Size
+			}
+		}
+		if resp.Data64 == "" {
+			continue
+		}
+		chunk, err := base64.StdEncoding.DecodeString(resp.Data64)
+		if err != nil {
+			return fmt.Errorf("error decoding file chunk: %w", err)
+		}
+		r.buf.Write(chunk)
+		if r.progressFn != nil {
+			r.progressFn(int64(r.buf.Len()), r.totalBytes)
+		}
+	}
+	if r.finfo == nil {
+		return fmt.Errorf("no fileinfo returned for %q", r.path)
+	}
+	return nil
+}
+
+// reassembles a streaming RemoteStreamFileCommand response into a single buffer
+// the first chunk carries the fileinfo, subsequent chunks carry the data
+func ReadRemoteFile(w *wshutil.WshRpc, data wshrpc.CommandRemoteStreamFileData, opts *wshrpc.RpcOpts, progressFn StreamProgressFnType) (*wshrpc.FileInfo, []byte, error) {
+	return ReadRemoteFileWithResume(w, data, opts, progressFn, 0)
+}
+
+// like ReadRemoteFile, but if the stream fails partway through (e.g. the connection dropped and was re-established)
+// the read resumes from the last received offset, up to maxResumes times.
+// the server fails the resume if the file changed size in the meantime.
+func ReadRemoteFileWithResume(w *wshutil.WshRpc, data wshrpc.CommandRemoteStreamFileData, opts *wshrpc.RpcOpts, progressFn StreamProgressFnType, maxResumes int) (*wshrpc.FileInfo, []byte, error) {
+	reader := &remoteFileReader{path: data.Path, totalBytes: -1, progressFn: progressFn}
+	baseOffset := data.Offset
+	for attempt := 0; ; attempt++ {
+		err := reader.readStream(w, data, opts)
+		if err == nil {
+			break
+		}
+		canResume := reader.finfo != nil && !reader.finfo.IsDir && data.ByteRange == ""
+		if !canResume || attempt >= maxResumes {
+			return nil, nil, err
+		}
+		data.Offset = baseOffset + int64(reader.buf.Len())
+		data.ExpectedSize = reader.finfo.Size
+		log.Printf("resuming read of %q at offset %d (attempt %d): %v\n", data.Path, data.Offset, attempt+1, err)
+	}
+	if reader.finfo.NotFound {
+		return reader.finfo, nil, nil
+	}
+	return reader.finfo, reader.buf.Bytes(), nil
+}
@@ -0,0 +1,88 @@
+package wshclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// streams its chunks for any path, the first response carries the fileinfo
+type testStreamFileImpl struct {
+	finfo  *wshrpc.FileInfo
+	chunks []string
+}
+
+func (impl *testStreamFileImpl) WshServerImpl() {}
+
+func (impl *testStreamFileImpl) RemoteStreamFileCommand(ctx context.Context, data wshrpc.CommandRemoteStreamFileData) chan wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData], len(impl.chunks)+1)
+	ch <- wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData]{Response: wshrpc.CommandRemoteStreamFileRtnData{FileInfo: []*wshrpc.FileInfo{impl.finfo}}}
+	for _, chunk := range impl.chunks {
+		ch <- wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData]{Response: wshrpc.CommandRemoteStreamFileRtnData{Data64: base64.StdEncoding.EncodeToString([]byte(chunk))}}
+	}
+	close(ch)
+	return ch
+}
+
+// a client rpc connected to a server rpc running impl
+func makeTestClient(impl wshutil.ServerImpl) *wshutil.WshRpc {
+	client := wshutil.MakeWshRpc(nil, nil, wshrpc.RpcContext{}, nil)
+	server := wshutil.MakeWshRpc(nil, nil, wshrpc.RpcContext{}, impl)
+	go func() {
+		for msg := range client.OutputCh {
+			server.InputCh <- msg
+		}
+	}()
+	go func() {
+		for msg := range server.OutputCh {
+			client.InputCh <- msg
+		}
+	}()
+	return client
+}
+
+func TestReadRemoteFile_ReassemblesChunks(t *testing.T) {
+	chunks := []string{"hello ", "streaming ", "", "world"}
+	impl := &testStreamFileImpl{finfo: &wshrpc.FileInfo{Path: "/test/file", Name: "file", Size: 22}, chunks: chunks}
+	client := makeTestClient(impl)
+	var progress [][2]int64
+	progressFn := func(bytesRead int64, totalBytes int64) {
+		progress = append(progress, [2]int64{bytesRead, totalBytes})
+	}
+	finfo, data, err := ReadRemoteFile(client, wshrpc.CommandRemoteStreamFileData{Path: "/test/file"}, &wshrpc.RpcOpts{Timeout: 5000}, progressFn)
+	if err != nil {
+		t.Fatalf("ReadRemoteFile: %v", err)
+	}
+	if finfo == nil || finfo.Path != "/test/file" {
+		t.Fatalf("fileinfo = %+v", finfo)
+	}
+	if !bytes.Equal(data, []byte("hello streaming world")) {
+		t.Fatalf("data = %q", data)
+	}
+	// one call per non-empty chunk
+	expected := [][2]int64{{6, 22}, {16, 22}, {21, 22}}
+	if len(progress) != len(expected) {
+		t.Fatalf("progress = %v, want %v", progress, expected)
+	}
+	for i := range expected {
+		if progress[i] != expected[i] {
+			t.Fatalf("progress = %v, want %v", progress, expected)
+		}
+	}
+}
+
+func TestReadRemoteFile_NotFound(t *testing.T) {
+	impl := &testStreamFileImpl{finfo: &wshrpc.FileInfo{Path: "/test/missing", NotFound: true}}
+	client := makeTestClient(impl)
+	finfo, data, err := ReadRemoteFile(client, wshrpc.CommandRemoteStreamFileData{Path: "/test/missing"}, &wshrpc.RpcOpts{Timeout: 5000}, nil)
+	if err != nil {
+		t.Fatalf("ReadRemoteFile: %v", err)
+	}
+	if finfo == nil || !finfo.NotFound || data != nil {
+		t.Fatalf("got %+v, %q, want a notfound fileinfo and no data", finfo, data)
+	}
+}
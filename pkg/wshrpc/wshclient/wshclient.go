@@ -31,12 +31,42 @@ func AuthenticateCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (
 	return resp, err
 }
 
+// command "batch", wshserver.BatchCommand
+func BatchCommand(w *wshutil.WshRpc, data wshrpc.CommandBatchData, opts *wshrpc.RpcOpts) (*wshrpc.CommandBatchRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandBatchRtnData](w, "batch", data, opts)
+	return resp, err
+}
+
 // command "blockinfo", wshserver.BlockInfoCommand
 func BlockInfoCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) (*wshrpc.BlockInfoData, error) {
 	resp, err := sendRpcRequestCallHelper[*wshrpc.BlockInfoData](w, "blockinfo", data, opts)
 	return resp, err
 }
 
+// command "broadcast", wshserver.BroadcastCommand
+func BroadcastCommand(w *wshutil.WshRpc, data wshrpc.CommandBroadcastData, opts *wshrpc.RpcOpts) (*wshrpc.CommandBroadcastRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandBroadcastRtnData](w, "broadcast", data, opts)
+	return resp, err
+}
+
+// command "capabilities", wshserver.CapabilitiesCommand
+func CapabilitiesCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CommandCapabilitiesRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandCapabilitiesRtnData](w, "capabilities", nil, opts)
+	return resp, err
+}
+
+// command "cgrouplimits", wshserver.CgroupLimitsCommand
+func CgroupLimitsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CgroupLimitsData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CgroupLimitsData](w, "cgrouplimits", nil, opts)
+	return resp, err
+}
+
+// command "checkwritable", wshserver.CheckWritableCommand
+func CheckWritableCommand(w *wshutil.WshRpc, data wshrpc.CommandCheckWritableData, opts *wshrpc.RpcOpts) (*wshrpc.CheckWritableRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CheckWritableRtnData](w, "checkwritable", data, opts)
+	return resp, err
+}
+
 // command "connconnect", wshserver.ConnConnectCommand
 func ConnConnectCommand(w *wshutil.WshRpc, data wshrpc.ConnRequest, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "connconnect", data, opts)
@@ -91,6 +121,12 @@ func ControllerStopCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts)
 	return err
 }
 
+// command "cpudetail", wshserver.CpuDetailCommand
+func CpuDetailCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CpuDetailData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CpuDetailData](w, "cpudetail", nil, opts)
+	return resp, err
+}
+
 // command "createblock", wshserver.CreateBlockCommand
 func CreateBlockCommand(w *wshutil.WshRpc, data wshrpc.CommandCreateBlockData, opts *wshrpc.RpcOpts) (waveobj.ORef, error) {
 	resp, err := sendRpcRequestCallHelper[waveobj.ORef](w, "createblock", data, opts)
@@ -115,6 +151,12 @@ func DeleteSubBlockCommand(w *wshutil.WshRpc, data wshrpc.CommandDeleteBlockData
 	return err
 }
 
+// command "diskusage", wshserver.DiskUsageCommand
+func DiskUsageCommand(w *wshutil.WshRpc, data wshrpc.CommandDiskUsageData, opts *wshrpc.RpcOpts) (*wshrpc.CommandDiskUsageRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandDiskUsageRtnData](w, "diskusage", data, opts)
+	return resp, err
+}
+
 // command "dismisswshfail", wshserver.DismissWshFailCommand
 func DismissWshFailCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "dismisswshfail", data, opts)
@@ -127,6 +169,12 @@ func DisposeCommand(w *wshutil.WshRpc, data wshrpc.CommandDisposeData, opts *wsh
 	return err
 }
 
+// command "entropyinfo", wshserver.EntropyInfoCommand
+func EntropyInfoCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.EntropyInfoData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.EntropyInfoData](w, "entropyinfo", nil, opts)
+	return resp, err
+}
+
 // command "eventpublish", wshserver.EventPublishCommand
 func EventPublishCommand(w *wshutil.WshRpc, data wps.WaveEvent, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "eventpublish", data, opts)
@@ -163,6 +211,23 @@ func EventUnsubAllCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
 	return err
 }
 
+// command "exec", wshserver.ExecCommand
+func ExecCommand(w *wshutil.WshRpc, data wshrpc.CommandExecData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.ExecOutputData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.ExecOutputData](w, "exec", data, opts)
+}
+
+// command "execinput", wshserver.ExecInputCommand
+func ExecInputCommand(w *wshutil.WshRpc, data wshrpc.CommandExecInputData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "execinput", data, opts)
+	return err
+}
+
+// command "fdinfo", wshserver.FdInfoCommand
+func FdInfoCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.FdInfoData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.FdInfoData](w, "fdinfo", nil, opts)
+	return resp, err
+}
+
 // command "fileappend", wshserver.FileAppendCommand
 func FileAppendCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "fileappend", data, opts)
@@ -175,6 +240,12 @@ func FileAppendIJsonCommand(w *wshutil.WshRpc, data wshrpc.CommandAppendIJsonDat
 	return err
 }
 
+// command "filechecksum", wshserver.FileChecksumCommand
+func FileChecksumCommand(w *wshutil.WshRpc, data wshrpc.CommandFileChecksumData, opts *wshrpc.RpcOpts) (*wshrpc.FileChecksumData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.FileChecksumData](w, "filechecksum", data, opts)
+	return resp, err
+}
+
 // command "filecreate", wshserver.FileCreateCommand
 func FileCreateCommand(w *wshutil.WshRpc, data wshrpc.CommandFileCreateData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "filecreate", data, opts)
@@ -205,6 +276,39 @@ func FileReadCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrp
 	return resp, err
 }
 
+// command "filesubscribe", wshserver.FileSubscribeCommand
+func FileSubscribeCommand(w *wshutil.WshRpc, data wshrpc.CommandFileSubscribeData, opts *wshrpc.RpcOpts) (*wshrpc.CommandFileSubscribeRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandFileSubscribeRtnData](w, "filesubscribe", data, opts)
+	return resp, err
+}
+
+// command "filetail", wshserver.FileTailCommand
+func FileTailCommand(w *wshutil.WshRpc, data wshrpc.CommandFileTailData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.FileTailData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.FileTailData](w, "filetail", data, opts)
+}
+
+// command "filetransferread", wshserver.FileTransferReadCommand
+func FileTransferReadCommand(w *wshutil.WshRpc, data wshrpc.CommandFileTransferReadData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.FileTransferChunkData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.FileTransferChunkData](w, "filetransferread", data, opts)
+}
+
+// command "filetransferwrite", wshserver.FileTransferWriteCommand
+func FileTransferWriteCommand(w *wshutil.WshRpc, data wshrpc.CommandFileTransferWriteData, opts *wshrpc.RpcOpts) (*wshrpc.FileTransferWriteRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.FileTransferWriteRtnData](w, "filetransferwrite", data, opts)
+	return resp, err
+}
+
+// command "fileunsubscribe", wshserver.FileUnsubscribeCommand
+func FileUnsubscribeCommand(w *wshutil.WshRpc, data wshrpc.CommandFileUnsubscribeData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "fileunsubscribe", data, opts)
+	return err
+}
+
+// command "filewatch", wshserver.FileWatchCommand
+func FileWatchCommand(w *wshutil.WshRpc, data wshrpc.CommandFileWatchData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.FileWatchEventData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.FileWatchEventData](w, "filewatch", data, opts)
+}
+
 // command "filewrite", wshserver.FileWriteCommand
 func FileWriteCommand(w *wshutil.WshRpc, data wshrpc.CommandFileData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "filewrite", data, opts)
@@ -217,12 +321,65 @@ func FocusWindowCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) er
 	return err
 }
 
+// command "forwarddata", wshserver.ForwardDataCommand
+func ForwardDataCommand(w *wshutil.WshRpc, data wshrpc.CommandForwardDataData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "forwarddata", data, opts)
+	return err
+}
+
+// command "forwardstart", wshserver.ForwardStartCommand
+func ForwardStartCommand(w *wshutil.WshRpc, data wshrpc.CommandForwardStartData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.ForwardPacketData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.ForwardPacketData](w, "forwardstart", data, opts)
+}
+
+// command "forwardstop", wshserver.ForwardStopCommand
+func ForwardStopCommand(w *wshutil.WshRpc, data wshrpc.CommandForwardStopData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "forwardstop", data, opts)
+	return err
+}
+
+// command "getcwd", wshserver.GetCwdCommand
+func GetCwdCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CwdData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CwdData](w, "getcwd", nil, opts)
+	return resp, err
+}
+
 // command "getmeta", wshserver.GetMetaCommand
 func GetMetaCommand(w *wshutil.WshRpc, data wshrpc.CommandGetMetaData, opts *wshrpc.RpcOpts) (waveobj.MetaMapType, error) {
 	resp, err := sendRpcRequestCallHelper[waveobj.MetaMapType](w, "getmeta", data, opts)
 	return resp, err
 }
 
+// command "getpriority", wshserver.GetPriorityCommand
+func GetPriorityCommand(w *wshutil.WshRpc, data wshrpc.CommandGetPriorityData, opts *wshrpc.RpcOpts) (*wshrpc.PriorityData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.PriorityData](w, "getpriority", data, opts)
+	return resp, err
+}
+
+// command "getserverconfig", wshserver.GetServerConfigCommand
+func GetServerConfigCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.ConnServerConfigData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.ConnServerConfigData](w, "getserverconfig", nil, opts)
+	return resp, err
+}
+
+// command "getsysinfocollectors", wshserver.GetSysInfoCollectorsCommand
+func GetSysInfoCollectorsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CommandSysInfoCollectorsRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandSysInfoCollectorsRtnData](w, "getsysinfocollectors", nil, opts)
+	return resp, err
+}
+
+// command "getsysinfointerval", wshserver.GetSysInfoIntervalCommand
+func GetSysInfoIntervalCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CommandSysInfoIntervalData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandSysInfoIntervalData](w, "getsysinfointerval", nil, opts)
+	return resp, err
+}
+
+// command "gettoggle", wshserver.GetToggleCommand
+func GetToggleCommand(w *wshutil.WshRpc, data wshrpc.CommandGetToggleData, opts *wshrpc.RpcOpts) (*wshrpc.CommandToggleRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandToggleRtnData](w, "gettoggle", data, opts)
+	return resp, err
+}
+
 // command "getupdatechannel", wshserver.GetUpdateChannelCommand
 func GetUpdateChannelCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (string, error) {
 	resp, err := sendRpcRequestCallHelper[string](w, "getupdatechannel", nil, opts)
@@ -235,6 +392,64 @@ func GetVarCommand(w *wshutil.WshRpc, data wshrpc.CommandVarData, opts *wshrpc.R
 	return resp, err
 }
 
+// command "gpuinfo", wshserver.GpuInfoCommand
+func GpuInfoCommand(w *wshutil.WshRpc, data wshrpc.CommandGpuInfoData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.GpuInfoData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.GpuInfoData](w, "gpuinfo", data, opts)
+}
+
+// command "journaltail", wshserver.JournalTailCommand
+func JournalTailCommand(w *wshutil.WshRpc, data wshrpc.CommandJournalTailData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.JournalTailData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.JournalTailData](w, "journaltail", data, opts)
+}
+
+// command "keepalive", wshserver.KeepaliveCommand
+func KeepaliveCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "keepalive", nil, opts)
+	return err
+}
+
+// command "killexec", wshserver.KillExecCommand
+func KillExecCommand(w *wshutil.WshRpc, data wshrpc.CommandKillExecData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "killexec", data, opts)
+	return err
+}
+
+// command "listexec", wshserver.ListExecCommand
+func ListExecCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CommandListExecRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandListExecRtnData](w, "listexec", nil, opts)
+	return resp, err
+}
+
+// command "listlisteners", wshserver.ListListenersCommand
+func ListListenersCommand(w *wshutil.WshRpc, data wshrpc.CommandListListenersData, opts *wshrpc.RpcOpts) (*wshrpc.CommandListListenersRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandListListenersRtnData](w, "listlisteners", data, opts)
+	return resp, err
+}
+
+// command "localeinfo", wshserver.LocaleInfoCommand
+func LocaleInfoCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.LocaleInfoData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.LocaleInfoData](w, "localeinfo", nil, opts)
+	return resp, err
+}
+
+// command "logfile", wshserver.LogFileCommand
+func LogFileCommand(w *wshutil.WshRpc, data wshrpc.CommandLogFileData, opts *wshrpc.RpcOpts) (*wshrpc.LogFileData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.LogFileData](w, "logfile", data, opts)
+	return resp, err
+}
+
+// command "logtail", wshserver.LogTailCommand
+func LogTailCommand(w *wshutil.WshRpc, data wshrpc.CommandLogTailData, opts *wshrpc.RpcOpts) (*wshrpc.CommandLogTailRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandLogTailRtnData](w, "logtail", data, opts)
+	return resp, err
+}
+
+// command "memorypressure", wshserver.MemoryPressureCommand
+func MemoryPressureCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.MemoryPressureData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.MemoryPressureData](w, "memorypressure", nil, opts)
+	return resp, err
+}
+
 // command "message", wshserver.MessageCommand
 func MessageCommand(w *wshutil.WshRpc, data wshrpc.CommandMessageData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "message", data, opts)
@@ -247,6 +462,41 @@ func NotifyCommand(w *wshutil.WshRpc, data wshrpc.WaveNotificationOptions, opts
 	return err
 }
 
+// command "osinfo", wshserver.OSInfoCommand
+func OSInfoCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CommandOSInfoRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandOSInfoRtnData](w, "osinfo", nil, opts)
+	return resp, err
+}
+
+// command "pauseroute", wshserver.PauseRouteCommand
+func PauseRouteCommand(w *wshutil.WshRpc, data wshrpc.CommandPauseRouteData, opts *wshrpc.RpcOpts) (*wshrpc.PauseRouteRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.PauseRouteRtnData](w, "pauseroute", data, opts)
+	return resp, err
+}
+
+// command "pipelinestats", wshserver.PipelineStatsCommand
+func PipelineStatsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.PipelineStatsData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.PipelineStatsData](w, "pipelinestats", nil, opts)
+	return resp, err
+}
+
+// command "processwatch", wshserver.ProcessWatchCommand
+func ProcessWatchCommand(w *wshutil.WshRpc, data wshrpc.CommandProcessWatchData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.ProcessWatchData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.ProcessWatchData](w, "processwatch", data, opts)
+}
+
+// command "quiesce", wshserver.QuiesceCommand
+func QuiesceCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "quiesce", nil, opts)
+	return err
+}
+
+// command "reloadcert", wshserver.ReloadCertCommand
+func ReloadCertCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CommandReloadCertRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandReloadCertRtnData](w, "reloadcert", nil, opts)
+	return resp, err
+}
+
 // command "remotefiledelete", wshserver.RemoteFileDeleteCommand
 func RemoteFileDeleteCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "remotefiledelete", data, opts)
@@ -283,6 +533,12 @@ func RemoteMkdirCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) er
 	return err
 }
 
+// command "remoteprocesslist", wshserver.RemoteProcessListCommand
+func RemoteProcessListCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteProcessListData, opts *wshrpc.RpcOpts) (*wshrpc.CommandRemoteProcessListRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandRemoteProcessListRtnData](w, "remoteprocesslist", data, opts)
+	return resp, err
+}
+
 // command "remotestreamcpudata", wshserver.RemoteStreamCpuDataCommand
 func RemoteStreamCpuDataCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.TimeSeriesData] {
 	return sendRpcRequestResponseStreamHelper[wshrpc.TimeSeriesData](w, "remotestreamcpudata", nil, opts)
@@ -299,24 +555,77 @@ func RemoteWriteFileCommand(w *wshutil.WshRpc, data wshrpc.CommandRemoteWriteFil
 	return err
 }
 
+// command "resetroute", wshserver.ResetRouteCommand
+func ResetRouteCommand(w *wshutil.WshRpc, data wshrpc.CommandResetRouteData, opts *wshrpc.RpcOpts) (*wshrpc.CommandResetRouteRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandResetRouteRtnData](w, "resetroute", data, opts)
+	return resp, err
+}
+
+// command "resetstats", wshserver.ResetStatsCommand
+func ResetStatsCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CommandRouteStatsRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandRouteStatsRtnData](w, "resetstats", nil, opts)
+	return resp, err
+}
+
+// command "resolvehost", wshserver.ResolveHostCommand
+func ResolveHostCommand(w *wshutil.WshRpc, data wshrpc.CommandResolveHostData, opts *wshrpc.RpcOpts) (*wshrpc.CommandResolveHostRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandResolveHostRtnData](w, "resolvehost", data, opts)
+	return resp, err
+}
+
 // command "resolveids", wshserver.ResolveIdsCommand
 func ResolveIdsCommand(w *wshutil.WshRpc, data wshrpc.CommandResolveIdsData, opts *wshrpc.RpcOpts) (wshrpc.CommandResolveIdsRtnData, error) {
 	resp, err := sendRpcRequestCallHelper[wshrpc.CommandResolveIdsRtnData](w, "resolveids", data, opts)
 	return resp, err
 }
 
+// command "resumeroute", wshserver.ResumeRouteCommand
+func ResumeRouteCommand(w *wshutil.WshRpc, data wshrpc.CommandResumeRouteData, opts *wshrpc.RpcOpts) (*wshrpc.PauseRouteRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.PauseRouteRtnData](w, "resumeroute", data, opts)
+	return resp, err
+}
+
 // command "routeannounce", wshserver.RouteAnnounceCommand
 func RouteAnnounceCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "routeannounce", nil, opts)
 	return err
 }
 
+// command "routeinfo", wshserver.RouteInfoCommand
+func RouteInfoCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CommandRouteInfoRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandRouteInfoRtnData](w, "routeinfo", nil, opts)
+	return resp, err
+}
+
+// command "routestats", wshserver.RouteStatsCommand
+func RouteStatsCommand(w *wshutil.WshRpc, data wshrpc.CommandRouteStatsData, opts *wshrpc.RpcOpts) (*wshrpc.CommandRouteStatsRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandRouteStatsRtnData](w, "routestats", data, opts)
+	return resp, err
+}
+
+// command "routetrace", wshserver.RouteTraceCommand
+func RouteTraceCommand(w *wshutil.WshRpc, data wshrpc.CommandRouteTraceData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.RouteTraceData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.RouteTraceData](w, "routetrace", data, opts)
+}
+
 // command "routeunannounce", wshserver.RouteUnannounceCommand
 func RouteUnannounceCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "routeunannounce", nil, opts)
 	return err
 }
 
+// command "runtimeversions", wshserver.RuntimeVersionsCommand
+func RuntimeVersionsCommand(w *wshutil.WshRpc, data wshrpc.CommandRuntimeVersionsData, opts *wshrpc.RpcOpts) (*wshrpc.RuntimeVersionsData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.RuntimeVersionsData](w, "runtimeversions", data, opts)
+	return resp, err
+}
+
+// command "serverinfo", wshserver.ServerInfoCommand
+func ServerInfoCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.CommandServerInfoRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandServerInfoRtnData](w, "serverinfo", nil, opts)
+	return resp, err
+}
+
 // command "setconfig", wshserver.SetConfigCommand
 func SetConfigCommand(w *wshutil.WshRpc, data wshrpc.MetaSettingsType, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "setconfig", data, opts)
@@ -329,12 +638,42 @@ func SetConnectionsConfigCommand(w *wshutil.WshRpc, data wshrpc.ConnConfigReques
 	return err
 }
 
+// command "setcwd", wshserver.SetCwdCommand
+func SetCwdCommand(w *wshutil.WshRpc, data wshrpc.CommandSetCwdData, opts *wshrpc.RpcOpts) (*wshrpc.CwdData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CwdData](w, "setcwd", data, opts)
+	return resp, err
+}
+
 // command "setmeta", wshserver.SetMetaCommand
 func SetMetaCommand(w *wshutil.WshRpc, data wshrpc.CommandSetMetaData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "setmeta", data, opts)
 	return err
 }
 
+// command "setpriority", wshserver.SetPriorityCommand
+func SetPriorityCommand(w *wshutil.WshRpc, data wshrpc.CommandSetPriorityData, opts *wshrpc.RpcOpts) (*wshrpc.PriorityData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.PriorityData](w, "setpriority", data, opts)
+	return resp, err
+}
+
+// command "setsysinfocollectors", wshserver.SetSysInfoCollectorsCommand
+func SetSysInfoCollectorsCommand(w *wshutil.WshRpc, data wshrpc.CommandSetSysInfoCollectorsData, opts *wshrpc.RpcOpts) (*wshrpc.CommandSysInfoCollectorsRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandSysInfoCollectorsRtnData](w, "setsysinfocollectors", data, opts)
+	return resp, err
+}
+
+// command "setsysinfointerval", wshserver.SetSysInfoIntervalCommand
+func SetSysInfoIntervalCommand(w *wshutil.WshRpc, data wshrpc.CommandSysInfoIntervalData, opts *wshrpc.RpcOpts) (*wshrpc.CommandSysInfoIntervalData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandSysInfoIntervalData](w, "setsysinfointerval", data, opts)
+	return resp, err
+}
+
+// command "settoggle", wshserver.SetToggleCommand
+func SetToggleCommand(w *wshutil.WshRpc, data wshrpc.CommandSetToggleData, opts *wshrpc.RpcOpts) (*wshrpc.CommandToggleRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandToggleRtnData](w, "settoggle", data, opts)
+	return resp, err
+}
+
 // command "setvar", wshserver.SetVarCommand
 func SetVarCommand(w *wshutil.WshRpc, data wshrpc.CommandVarData, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "setvar", data, opts)
@@ -347,6 +686,18 @@ func SetViewCommand(w *wshutil.WshRpc, data wshrpc.CommandBlockSetViewData, opts
 	return err
 }
 
+// command "shutdown", wshserver.ShutdownCommand
+func ShutdownCommand(w *wshutil.WshRpc, data wshrpc.CommandShutdownData, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "shutdown", data, opts)
+	return err
+}
+
+// command "socketstats", wshserver.SocketStatsCommand
+func SocketStatsCommand(w *wshutil.WshRpc, data wshrpc.CommandSocketStatsData, opts *wshrpc.RpcOpts) (*wshrpc.SocketStatsData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.SocketStatsData](w, "socketstats", data, opts)
+	return resp, err
+}
+
 // command "streamcpudata", wshserver.StreamCpuDataCommand
 func StreamCpuDataCommand(w *wshutil.WshRpc, data wshrpc.CpuDataRequest, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.TimeSeriesData] {
 	return sendRpcRequestResponseStreamHelper[wshrpc.TimeSeriesData](w, "streamcpudata", data, opts)
@@ -362,12 +713,41 @@ func StreamWaveAiCommand(w *wshutil.WshRpc, data wshrpc.OpenAiStreamRequest, opt
 	return sendRpcRequestResponseStreamHelper[wshrpc.OpenAIPacketType](w, "streamwaveai", data, opts)
 }
 
+// command "sysinfohistory", wshserver.SysInfoHistoryCommand
+func SysInfoHistoryCommand(w *wshutil.WshRpc, data wshrpc.CommandSysInfoHistoryData, opts *wshrpc.RpcOpts) (*wshrpc.CommandSysInfoHistoryRtnData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.CommandSysInfoHistoryRtnData](w, "sysinfohistory", data, opts)
+	return resp, err
+}
+
+// command "sysinforefresh", wshserver.SysInfoRefreshCommand
+func SysInfoRefreshCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.TimeSeriesData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.TimeSeriesData](w, "sysinforefresh", nil, opts)
+	return resp, err
+}
+
+// command "sysinfostream", wshserver.SysInfoStreamCommand
+func SysInfoStreamCommand(w *wshutil.WshRpc, data wshrpc.CommandSysInfoStreamData, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[wshrpc.SysInfoStreamData] {
+	return sendRpcRequestResponseStreamHelper[wshrpc.SysInfoStreamData](w, "sysinfostream", data, opts)
+}
+
 // command "test", wshserver.TestCommand
 func TestCommand(w *wshutil.WshRpc, data string, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "test", data, opts)
 	return err
 }
 
+// command "timesyncstatus", wshserver.TimeSyncStatusCommand
+func TimeSyncStatusCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) (*wshrpc.TimeSyncStatusData, error) {
+	resp, err := sendRpcRequestCallHelper[*wshrpc.TimeSyncStatusData](w, "timesyncstatus", nil, opts)
+	return resp, err
+}
+
+// command "unquiesce", wshserver.UnquiesceCommand
+func UnquiesceCommand(w *wshutil.WshRpc, opts *wshrpc.RpcOpts) error {
+	_, err := sendRpcRequestCallHelper[any](w, "unquiesce", nil, opts)
+	return err
+}
+
 // command "vdomasyncinitiation", wshserver.VDomAsyncInitiationCommand
 func VDomAsyncInitiationCommand(w *wshutil.WshRpc, data vdom.VDomAsyncInitiationRequest, opts *wshrpc.RpcOpts) error {
 	_, err := sendRpcRequestCallHelper[any](w, "vdomasyncinitiation", data, opts)
@@ -0,0 +1,105 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const DefaultAcceptRateWait = 500 * time.Millisecond
+
+// token bucket for the listener accept loop.  a connection that would wait longer than MaxWait
+// for a token is refused instead (so a reconnect storm can't queue up unbounded work).
+type AcceptRateLimiter struct {
+	Rate    float64 // tokens per second
+	Burst   int
+	MaxWait time.Duration
+
+	lock     *sync.Mutex
+	tokens   float64 // goes negative for admitted connections that are waiting for their token
+	lastTs   time.Time
+	engaged  bool
+	limited  atomic.Int64
+	rejected atomic.Int64
+}
+
+// parses --accept-rate, "rate[:burst]" (connections per second), the burst defaults to the rate (minimum 1)
+func ParseAcceptRate(val string) (float64, int, error) {
+	rateStr, burstStr, hasBurst := strings.Cut(val, ":")
+	rate, err := strconv.ParseFloat(strings.TrimSpace(rateStr), 64)
+	if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+		return 0, 0, fmt.Errorf("invalid rate %q (must be a positive number of connections per second)", rateStr)
+	}
+	burst := max(1, int(math.Ceil(rate)))
+	if hasBurst {
+		burst, err = strconv.Atoi(strings.TrimSpace(burstStr))
+		if err != nil || burst < 1 {
+			return 0, 0, fmt.Errorf("invalid burst %q (must be at least 1)", burstStr)
+		}
+	}
+	return rate, burst, nil
+}
+
+func MakeAcceptRateLimiter(rate float64, burst int, maxWait time.Duration) *AcceptRateLimiter {
+	return &AcceptRateLimiter{
+		Rate:    rate,
+		Burst:   burst,
+		MaxWait: maxWait,
+		lock:    &sync.Mutex{},
+		tokens:  float64(burst),
+		lastTs:  time.Now(),
+	}
+}
+
+// returns how long to wait before handling the connection, or false if it should be refused
+func (l *AcceptRateLimiter) Admit() (time.Duration, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := time.Now()
+	l.tokens = min(float64(l.Burst), l.tokens+now.Sub(l.lastTs).Seconds()*l.Rate)
+	l.lastTs = now
+	if l.tokens >= 1 {
+		if l.engaged && l.tokens >= float64(l.Burst) {
+			l.engaged = false
+			log.Printf("accept rate limit disengaged (%d connections delayed, %d refused so far)\n", l.limited.Load(), l.rejected.Load())
+		}
+		l.tokens--
+		return 0, true
+	}
+	if !l.engaged {
+		l.engaged = true
+		log.Printf("accept rate limit engaged (%g/s, burst %d), new connections are being delayed\n", l.Rate, l.Burst)
+	}
+	wait := time.Duration((1 - l.tokens) / l.Rate * float64(time.Second))
+	if wait > l.MaxWait {
+		l.rejected.Add(1)
+		return wait, false
+	}
+	l.tokens--
+	l.limited.Add(1)
+	return wait, true
+}
+
+// lifetime counts of connections delayed and refused by the limiter
+func (l *AcceptRateLimiter) GetCounts() (int64, int64) {
+	return l.limited.Load(), l.rejected.Load()
+}
+
+// the limiter used by the listeners (nil when --accept-rate is not set), for ServerInfo
+var acceptRateLimiter atomic.Pointer[AcceptRateLimiter]
+
+func SetAcceptRateLimiter(limiter *AcceptRateLimiter) {
+	acceptRateLimiter.Store(limiter)
+}
+
+func GetAcceptRateLimiter() *AcceptRateLimiter {
+	return acceptRateLimiter.Load()
+}
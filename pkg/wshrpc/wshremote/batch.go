@@ -0,0 +1,22 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// the router only checks the token scope and policy against "batch", so every sub-request is checked here
+func (impl *ServerImpl) BatchCommand(ctx context.Context, data wshrpc.CommandBatchData) (*wshrpc.CommandBatchRtnData, error) {
+	if impl.Router == nil {
+		return wshutil.RunBatch(ctx, impl, data, nil)
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	return wshutil.RunBatch(ctx, impl, data, func(ctx context.Context, command string) error {
+		return impl.Router.CheckRouteCommand(source, command)
+	})
+}
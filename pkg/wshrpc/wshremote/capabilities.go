@@ -0,0 +1,137 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"sort"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const (
+	CapabilityReason_ReadOnly = "read-only"
+	CapabilityReason_Admin    = "admin"
+	CapabilityReason_Scope    = "scope"
+	CapabilityReason_Policy   = "policy"
+	CapabilityReason_Router   = "router"
+)
+
+// messages are newline delimited json, there is no size limit and no compression (yet)
+var capabilityEncodings = []string{"json"}
+var capabilityCompression = []string{}
+
+// commands that call checkWritable (refused while the server is read-only)
+var writeCommands = map[string]bool{
+	wshrpc.Command_RemoteFileTouch:  true,
+	wshrpc.Command_RemoteFileRename: true,
+	wshrpc.Command_RemoteMkdir:      true,
+	wshrpc.Command_RemoteWriteFile:  true,
+	wshrpc.Command_RemoteFileDelete: true,
+	wshrpc.Command_Exec:             true,
+	wshrpc.Command_KillExec:         true,
+	wshrpc.Command_SetPriority:      true,
+	wshrpc.Command_ForwardStart:     true,
+}
+
+// commands that call checkAdmin.  SocketStats is left out, a route may always query its own socket
+var adminCommands = map[string]bool{
+	wshrpc.Command_ResetStats:    true,
+	wshrpc.Command_Quiesce:       true,
+	wshrpc.Command_Unquiesce:     true,
+	wshrpc.Command_LogTail:       true,
+	wshrpc.Command_LogFile:       true,
+	wshrpc.Command_ResetRoute:    true,
+	wshrpc.Command_PauseRoute:    true,
+	wshrpc.Command_ResumeRoute:   true,
+	wshrpc.Command_Broadcast:     true,
+	wshrpc.Command_Shutdown:      true,
+	wshrpc.Command_ReloadCert:    true,
+	wshrpc.Command_JournalTail:   true,
+	wshrpc.Command_ListListeners: true,
+	wshrpc.Command_SetToggle:     true,
+}
+
+// commands that need the router (getRouter)
+var routerCommands = map[string]bool{
+	wshrpc.Command_RouteStats:    true,
+	wshrpc.Command_ResetStats:    true,
+	wshrpc.Command_Quiesce:       true,
+	wshrpc.Command_Unquiesce:     true,
+	wshrpc.Command_ResetRoute:    true,
+	wshrpc.Command_PauseRoute:    true,
+	wshrpc.Command_ResumeRoute:   true,
+	wshrpc.Command_Broadcast:     true,
+	wshrpc.Command_Shutdown:      true,
+	wshrpc.Command_ReloadCert:    true,
+	wshrpc.Command_PipelineStats: true,
+	wshrpc.Command_SocketStats:   true,
+	wshrpc.Command_FileSubscribe: true,
+}
+
+// the first check that would refuse the command for this caller, "" if it is allowed
+func commandDisabledReason(command string, routerMode bool, readOnly bool, isAdmin bool, scope []string, policyRule *wshutil.CommandPolicyRule) string {
+	switch {
+	case !wshutil.ScopeAllowsCommand(scope, command):
+		return CapabilityReason_Scope
+	case policyRule != nil && !policyRule.AllowsCommand(command):
+		return CapabilityReason_Policy
+	case routerCommands[command] && !routerMode:
+		return CapabilityReason_Router
+	case adminCommands[command] && !isAdmin:
+		return CapabilityReason_Admin
+	case writeCommands[command] && readOnly:
+		return CapabilityReason_ReadOnly
+	}
+	return ""
+}
+
+// reflects the current state (toggles, the caller's scope), so clients should ask again after a reconnect
+func (impl *ServerImpl) CapabilitiesCommand(ctx context.Context) (*wshrpc.CommandCapabilitiesRtnData, error) {
+	rtn := &wshrpc.CommandCapabilitiesRtnData{
+		Version:    wavebase.WaveVersion,
+		RouterMode: impl.Router != nil,
+		ReadOnly:   GetToggle(Toggle_ReadOnly),
+		Admin:      impl.checkAdmin(ctx) == nil,
+		Limits: wshrpc.CapabilityLimitsData{
+			Encodings:   capabilityEncodings,
+			Compression: capabilityCompression,
+			ExecEnvDeny: GetExecEnvDeny(),
+		},
+	}
+	var policyRule *wshutil.CommandPolicyRule
+	if impl.Router != nil {
+		source := wshutil.GetRpcSourceFromContext(ctx)
+		rtn.Scope = impl.Router.GetRouteScope(source)
+		policyRule = impl.Router.GetRoutePolicyRule(source)
+		if policyRule != nil {
+			rtn.PolicyRule = policyRule.Name
+		}
+	}
+	var concurrency map[string]int
+	if impl.Config != nil {
+		concurrency = impl.Config.CommandConcurrency
+		rtn.Limits.MaxInflight = impl.Config.MaxInflight
+		rtn.Limits.CommandQueueSize = impl.Config.CommandQueueSize
+	}
+	methodMap := wshrpc.MakeMethodMapForImpl(impl, wshutil.WshCommandDeclMap)
+	commands := make([]string, 0, len(methodMap))
+	for command := range methodMap {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	rtn.Commands = make([]wshrpc.CommandCapabilityData, 0, len(commands))
+	for _, command := range commands {
+		reason := commandDisabledReason(command, rtn.RouterMode, rtn.ReadOnly, rtn.Admin, rtn.Scope, policyRule)
+		rtn.Commands = append(rtn.Commands, wshrpc.CommandCapabilityData{
+			Command:     command,
+			Enabled:     reason == "",
+			Reason:      reason,
+			Concurrency: concurrency[command],
+		})
+	}
+	return rtn, nil
+}
@@ -0,0 +1,43 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const NotContainerizedMessage = "not containerized (no cgroup limits apply)"
+
+func (impl *ServerImpl) CgroupLimitsCommand(ctx context.Context) (*wshrpc.CgroupLimitsData, error) {
+	rtn := &wshrpc.CgroupLimitsData{Ts: time.Now().UnixMilli(), HostCpus: runtime.NumCPU()}
+	if vmStat, err := mem.VirtualMemoryWithContext(ctx); err == nil {
+		rtn.HostMemTotal = vmStat.Total
+	}
+	if err := readCgroupLimits(rtn); err != nil {
+		return nil, err
+	}
+	// a "limit" at or above what the host has doesn't limit anything
+	if rtn.CpuLimit >= float64(rtn.HostCpus) {
+		rtn.CpuLimit, rtn.CpuQuotaUs, rtn.CpuPeriodUs = 0, 0, 0
+	}
+	if rtn.CpusetCount >= rtn.HostCpus {
+		rtn.CpusetCount = 0
+	}
+	if rtn.HostMemTotal > 0 && rtn.MemLimit >= rtn.HostMemTotal {
+		rtn.MemLimit = 0
+	}
+	if rtn.MemLimit > 0 {
+		rtn.MemPercent = float64(rtn.MemUsage) / float64(rtn.MemLimit) * 100
+	}
+	rtn.Limited = rtn.CpuLimit > 0 || rtn.CpusetCount > 0 || rtn.MemLimit > 0 || rtn.PidsLimit > 0
+	if !rtn.Limited {
+		rtn.Message = NotContainerizedMessage
+	}
+	return rtn, nil
+}
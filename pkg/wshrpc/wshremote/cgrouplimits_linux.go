@@ -0,0 +1,272 @@
+//go:build linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bufio"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const cgroupMountDir = "/sys/fs/cgroup"
+
+// v1 reports "no limit" as a huge (page aligned) number instead of "max"
+const cgroupV1Unlimited = uint64(1) << 62
+
+type cgroupV1Entry struct {
+	MountDir string
+	Path     string
+}
+
+// /proc/self/cgroup, "0::/path" is the v2 (unified) entry, "N:cpu,cpuacct:/path" are v1 controllers
+func parseProcCgroup(content string) (string, bool, map[string]cgroupV1Entry) {
+	var v2Path string
+	var hasV2 bool
+	v1 := make(map[string]cgroupV1Entry)
+	for _, line := range strings.Split(content, "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "0" && parts[1] == "" {
+			v2Path, hasV2 = parts[2], true
+			continue
+		}
+		// joined controllers are usually mounted together ("cpu,cpuacct"), sometimes one per dir
+		mountDir := filepath.Join(cgroupMountDir, parts[1])
+		for _, controller := range strings.Split(parts[1], ",") {
+			dir := mountDir
+			if _, err := os.Stat(dir); err != nil {
+				dir = filepath.Join(cgroupMountDir, strings.TrimPrefix(controller, "name="))
+			}
+			v1[controller] = cgroupV1Entry{MountDir: dir, Path: parts[2]}
+		}
+	}
+	return v2Path, hasV2, v1
+}
+
+// the cgroup's dir and its parents up to the mount.  inside a container the mount usually is the
+// container's own cgroup (the host path in /proc/self/cgroup doesn't exist there), then it's just the mount
+func cgroupDirs(mountDir string, cgPath string) []string {
+	leaf := filepath.Join(mountDir, cgPath)
+	if _, err := os.Stat(leaf); err != nil {
+		return []string{mountDir}
+	}
+	var rtn []string
+	for dir := leaf; ; dir = filepath.Dir(dir) {
+		rtn = append(rtn, dir)
+		if dir == mountDir || len(dir) <= len(mountDir) {
+			break
+		}
+	}
+	return rtn
+}
+
+func readCgroupFile(dir string, name string) (string, bool) {
+	barr, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(barr)), true
+}
+
+// "max" (and missing files) are no limit (0)
+func readCgroupLimit(dir string, name string) uint64 {
+	val, ok := readCgroupFile(dir, name)
+	if !ok || val == "max" {
+		return 0
+	}
+	uval, err := strconv.ParseUint(val, 10, 64)
+	if err != nil || uval >= cgroupV1Unlimited {
+		return 0
+	}
+	return uval
+}
+
+func readCgroupUint(dir string, name string) uint64 {
+	val, _ := readCgroupFile(dir, name)
+	uval, _ := strconv.ParseUint(val, 10, 64)
+	return uval
+}
+
+// the tightest limit along the hierarchy, 0 if none is set
+func minCgroupLimit(dirs []string, name string) uint64 {
+	var rtn uint64
+	for _, dir := range dirs {
+		if limit := readCgroupLimit(dir, name); limit > 0 && (rtn == 0 || limit < rtn) {
+			rtn = limit
+		}
+	}
+	return rtn
+}
+
+// sets the cpu fields from the tightest quota/period pair along the hierarchy
+func setCgroupCpuQuota(rtn *wshrpc.CgroupLimitsData, dirs []string, readFn func(dir string) (int64, int64, bool)) {
+	for _, dir := range dirs {
+		quota, period, ok := readFn(dir)
+		if !ok || quota <= 0 || period <= 0 {
+			continue
+		}
+		cpus := float64(quota) / float64(period)
+		if rtn.CpuLimit == 0 || cpus < rtn.CpuLimit {
+			rtn.CpuLimit = math.Round(cpus*100) / 100
+			rtn.CpuQuotaUs = quota
+			rtn.CpuPeriodUs = period
+		}
+	}
+}
+
+// v2 cpu.max, "max 100000" or "50000 100000"
+func readCgroupV2CpuMax(dir string) (int64, int64, bool) {
+	val, ok := readCgroupFile(dir, "cpu.max")
+	if !ok {
+		return 0, 0, false
+	}
+	fields := strings.Fields(val)
+	if len(fields) != 2 || fields[0] == "max" {
+		return 0, 0, false
+	}
+	quota, err1 := strconv.ParseInt(fields[0], 10, 64)
+	period, err2 := strconv.ParseInt(fields[1], 10, 64)
+	return quota, period, err1 == nil && err2 == nil
+}
+
+func readCgroupV1CfsQuota(dir string) (int64, int64, bool) {
+	quotaStr, ok1 := readCgroupFile(dir, "cpu.cfs_quota_us")
+	periodStr, ok2 := readCgroupFile(dir, "cpu.cfs_period_us")
+	if !ok1 || !ok2 {
+		return 0, 0, false
+	}
+	quota, err1 := strconv.ParseInt(quotaStr, 10, 64) // -1 for no limit
+	period, err2 := strconv.ParseInt(periodStr, 10, 64)
+	return quota, period, err1 == nil && err2 == nil
+}
+
+// "key value" lines (cpu.stat)
+func readCgroupKeyValues(dir string, name string) map[string]uint64 {
+	rtn := make(map[string]uint64)
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		return rtn
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		if val, err := strconv.ParseUint(fields[1], 10, 64); err == nil {
+			rtn[fields[0]] = val
+		}
+	}
+	return rtn
+}
+
+// counts a cpu list like "0-3,6"
+func countCpuList(cpuList string) int {
+	count := 0
+	for _, part := range strings.Split(cpuList, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		startStr, endStr, isRange := strings.Cut(part, "-")
+		start, err := strconv.Atoi(startStr)
+		if err != nil {
+			continue
+		}
+		end := start
+		if isRange {
+			if end, err = strconv.Atoi(endStr); err != nil || end < start {
+				continue
+			}
+		}
+		count += end - start + 1
+	}
+	return count
+}
+
+func setCgroupCpuset(rtn *wshrpc.CgroupLimitsData, dir string, names ...string) {
+	for _, name := range names {
+		if cpus, ok := readCgroupFile(dir, name); ok && cpus != "" {
+			rtn.CpusetCpus = cpus
+			rtn.CpusetCount = countCpuList(cpus)
+			return
+		}
+	}
+}
+
+func readCgroupV2Limits(rtn *wshrpc.CgroupLimitsData, cgPath string) {
+	rtn.Version = 2
+	rtn.Path = cgPath
+	dirs := cgroupDirs(cgroupMountDir, cgPath)
+	leaf := dirs[0]
+	setCgroupCpuQuota(rtn, dirs, readCgroupV2CpuMax)
+	cpuStat := readCgroupKeyValues(leaf, "cpu.stat")
+	rtn.CpuUsageUs = cpuStat["usage_usec"]
+	rtn.NrThrottled = cpuStat["nr_throttled"]
+	rtn.ThrottledUs = cpuStat["throttled_usec"]
+	setCgroupCpuset(rtn, leaf, "cpuset.cpus.effective")
+	rtn.MemLimit = minCgroupLimit(dirs, "memory.max")
+	rtn.MemUsage = readCgroupUint(leaf, "memory.current")
+	rtn.PidsLimit = int64(minCgroupLimit(dirs, "pids.max"))
+	rtn.PidsCurrent = int64(readCgroupUint(leaf, "pids.current"))
+}
+
+func readCgroupV1Limits(rtn *wshrpc.CgroupLimitsData, v1 map[string]cgroupV1Entry) {
+	rtn.Version = 1
+	if entry, ok := v1["memory"]; ok {
+		rtn.Path = entry.Path
+		dirs := cgroupDirs(entry.MountDir, entry.Path)
+		rtn.MemLimit = minCgroupLimit(dirs, "memory.limit_in_bytes")
+		rtn.MemUsage = readCgroupUint(dirs[0], "memory.usage_in_bytes")
+	}
+	if entry, ok := v1["cpu"]; ok {
+		if rtn.Path == "" {
+			rtn.Path = entry.Path
+		}
+		dirs := cgroupDirs(entry.MountDir, entry.Path)
+		setCgroupCpuQuota(rtn, dirs, readCgroupV1CfsQuota)
+		cpuStat := readCgroupKeyValues(dirs[0], "cpu.stat")
+		rtn.NrThrottled = cpuStat["nr_throttled"]
+		rtn.ThrottledUs = cpuStat["throttled_time"] / 1000 // ns
+	}
+	if entry, ok := v1["cpuacct"]; ok {
+		rtn.CpuUsageUs = readCgroupUint(cgroupDirs(entry.MountDir, entry.Path)[0], "cpuacct.usage") / 1000 // ns
+	}
+	if entry, ok := v1["cpuset"]; ok {
+		setCgroupCpuset(rtn, cgroupDirs(entry.MountDir, entry.Path)[0], "cpuset.effective_cpus", "cpuset.cpus")
+	}
+	if entry, ok := v1["pids"]; ok {
+		dirs := cgroupDirs(entry.MountDir, entry.Path)
+		rtn.PidsLimit = int64(minCgroupLimit(dirs, "pids.max"))
+		rtn.PidsCurrent = int64(readCgroupUint(dirs[0], "pids.current"))
+	}
+}
+
+// a unified hierarchy (cgroup.controllers at the mount) is v2, otherwise the v1 controllers are used
+// (on a hybrid system the v2 hierarchy has no controllers, so v1 is the one that limits)
+func readCgroupLimits(rtn *wshrpc.CgroupLimitsData) error {
+	barr, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil
+	}
+	v2Path, hasV2, v1 := parseProcCgroup(string(barr))
+	if _, err := os.Stat(filepath.Join(cgroupMountDir, "cgroup.controllers")); err == nil && hasV2 {
+		readCgroupV2Limits(rtn, v2Path)
+		return nil
+	}
+	if len(v1) > 0 {
+		readCgroupV1Limits(rtn, v1)
+	}
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// cgroups are linux only, everything else reports no limits
+func readCgroupLimits(rtn *wshrpc.CgroupLimitsData) error {
+	return nil
+}
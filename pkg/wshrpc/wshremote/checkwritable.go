@@ -0,0 +1,122 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// a short reason for the ui, the path is already in the response
+func writableReason(err error) string {
+	switch {
+	case errors.Is(err, syscall.EROFS):
+		return "read-only filesystem"
+	case errors.Is(err, syscall.ENOSPC):
+		return "no space left on device"
+	case errors.Is(err, syscall.EDQUOT):
+		return "disk quota exceeded"
+	case errors.Is(err, fs.ErrPermission):
+		return "permission denied"
+	}
+	var pathErr *fs.PathError
+	if errors.As(err, &pathErr) {
+		return pathErr.Err.Error()
+	}
+	return err.Error()
+}
+
+func testDirWritable(dir string) error {
+	tempFile, err := os.CreateTemp(dir, ".wsh-writetest-*")
+	if err != nil {
+		return err
+	}
+	tempName := tempFile.Name()
+	tempFile.Close()
+	return os.Remove(tempName)
+}
+
+// the nearest parent of path that exists (path itself does not)
+func nearestExistingParent(path string) (string, fs.FileInfo, error) {
+	curPath := path
+	for {
+		parent := filepath.Dir(curPath)
+		if parent == curPath {
+			return "", nil, fmt.Errorf("no existing parent directory for %q", path)
+		}
+		curPath = parent
+		finfo, err := os.Stat(curPath)
+		if err == nil {
+			return curPath, finfo, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return curPath, nil, err
+		}
+	}
+}
+
+// problems with the path are reported in the response (Writable false with a Reason), not as errors
+func (impl *ServerImpl) CheckWritableCommand(ctx context.Context, data wshrpc.CommandCheckWritableData) (*wshrpc.CheckWritableRtnData, error) {
+	if data.Path == "" {
+		return nil, errors.New("path is required")
+	}
+	rtn := &wshrpc.CheckWritableRtnData{Path: data.Path}
+	cleanedPath, err := impl.resolveRoutePath(ctx, data.Path)
+	if err != nil {
+		if errors.Is(err, fs.ErrPermission) {
+			rtn.Reason = "outside of the server root dir"
+			return rtn, nil
+		}
+		return nil, err
+	}
+	rtn.Path = cleanedPath
+	if err := impl.checkWritable(data.Path); err != nil {
+		rtn.Reason = "server is read-only"
+		return rtn, nil
+	}
+	finfo, err := os.Stat(cleanedPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		rtn.Reason = writableReason(err)
+		return rtn, nil
+	}
+	if err == nil {
+		rtn.Exists = true
+		rtn.IsDir = finfo.IsDir()
+		rtn.TestPath = cleanedPath
+		if rtn.IsDir {
+			err = testDirWritable(cleanedPath)
+		} else if !finfo.Mode().IsRegular() {
+			rtn.Reason = "not a regular file"
+			return rtn, nil
+		} else {
+			var fd *os.File
+			if fd, err = os.OpenFile(cleanedPath, os.O_WRONLY, 0); err == nil {
+				fd.Close()
+			}
+		}
+	} else {
+		var parentInfo fs.FileInfo
+		rtn.TestPath, parentInfo, err = nearestExistingParent(cleanedPath)
+		if err == nil {
+			if !parentInfo.IsDir() {
+				rtn.Reason = fmt.Sprintf("%q is not a directory", rtn.TestPath)
+				return rtn, nil
+			}
+			err = testDirWritable(rtn.TestPath)
+		}
+	}
+	if err != nil {
+		rtn.Reason = writableReason(err)
+		return rtn, nil
+	}
+	rtn.Writable = true
+	return rtn, nil
+}
@@ -0,0 +1,431 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// commands that only make sense when connserver is running in router mode
+
+func (impl *ServerImpl) getRouter() (*wshutil.WshRouter, error) {
+	if impl.Router == nil {
+		return nil, errors.New("connserver is not running in router mode")
+	}
+	return impl.Router, nil
+}
+
+// admin commands may only be invoked by the wave app (coming in through the upstream).
+// local wsh clients attached to the connserver listener are registered as local routes and are rejected.
+func (impl *ServerImpl) checkAdmin(ctx context.Context) error {
+	if impl.Router == nil {
+		// not a router, every request comes from the wave app
+		return nil
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	if source == "" || impl.Router.IsLocalRoute(source) {
+		return fmt.Errorf("permission denied: command requires admin authorization (source %q)", source)
+	}
+	return nil
+}
+
+func (impl *ServerImpl) RouteStatsCommand(ctx context.Context, data wshrpc.CommandRouteStatsData) (*wshrpc.CommandRouteStatsRtnData, error) {
+	router, err := impl.getRouter()
+	if err != nil {
+		return nil, err
+	}
+	if data.Offset < 0 || data.Limit < 0 {
+		return nil, fmt.Errorf("invalid offset/limit %d/%d", data.Offset, data.Limit)
+	}
+	return wshutil.FilterRouteStats(router.GetRouteStats(), data), nil
+}
+
+func (impl *ServerImpl) RouteInfoCommand(ctx context.Context) (*wshrpc.CommandRouteInfoRtnData, error) {
+	router, err := impl.getRouter()
+	if err != nil {
+		return nil, err
+	}
+	return router.GetRegisteredRoutes(), nil
+}
+
+func (impl *ServerImpl) RouteTraceCommand(ctx context.Context, data wshrpc.CommandRouteTraceData) chan wshrpc.RespOrErrorUnion[wshrpc.RouteTraceData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.RouteTraceData], 16)
+	sendErr := func(err error) chan wshrpc.RespOrErrorUnion[wshrpc.RouteTraceData] {
+		ch <- wshrpc.RespOrErrorUnion[wshrpc.RouteTraceData]{Error: err}
+		close(ch)
+		return ch
+	}
+	router, err := impl.getRouter()
+	if err != nil {
+		return sendErr(err)
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return sendErr(err)
+	}
+	var reqId string
+	if handler := wshutil.GetRpcResponseHandlerFromContext(ctx); handler != nil {
+		reqId = handler.GetReqId()
+	}
+	sub, err := router.SubscribeTrace(data, reqId)
+	if err != nil {
+		return sendErr(err)
+	}
+	impl.Log("[routetrace] trace started (route %q, command %q)\n", data.RouteId, data.Command)
+	go func() {
+		defer panichandler.PanicHandler("RouteTraceCommand")
+		defer close(ch)
+		defer router.UnsubscribeTrace(sub)
+		for {
+			select {
+			case <-ctx.Done():
+				impl.Log("[routetrace] trace stopped\n")
+				return
+			case event := <-sub.Ch:
+				select {
+				case ch <- wshrpc.RespOrErrorUnion[wshrpc.RouteTraceData]{Response: event}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ch
+}
+
+// returns the final stats (just before the reset) so the caller can still record them
+func (impl *ServerImpl) ResetStatsCommand(ctx context.Context) (*wshrpc.CommandRouteStatsRtnData, error) {
+	router, err := impl.getRouter()
+	if err != nil {
+		return nil, err
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	rtn := router.GetRouteStats()
+	resetTime := router.ResetRouteStats()
+	impl.Log("[stats] counters reset at %s\n", resetTime.Format("2006-01-02 15:04:05"))
+	return rtn, nil
+}
+
+func (impl *ServerImpl) IsQuiesced() bool {
+	return impl.quiesced.Load()
+}
+
+// returns true if the server was not already quiesced
+func (impl *ServerImpl) Quiesce() bool {
+	if impl.quiesced.Swap(true) {
+		return false
+	}
+	PublishServerEvent(ServerEvent_Quiesce, true, "server quiescing, new connections will be rejected")
+	return true
+}
+
+func (impl *ServerImpl) ServerInfoCommand(ctx context.Context) (*wshrpc.CommandServerInfoRtnData, error) {
+	rtn := &wshrpc.CommandServerInfoRtnData{
+		Version:    wavebase.WaveVersion,
+		Pid:        os.Getpid(),
+		RouterMode: impl.Router != nil,
+		RootDir:    impl.RootDir,
+		Quiesced:   impl.IsQuiesced(),
+	}
+	rtn.OverloadRejected = GetLoadShedRejected()
+	if limiter := GetAcceptRateLimiter(); limiter != nil {
+		rtn.AcceptRateDelayed, rtn.AcceptRateRejected = limiter.GetCounts()
+	}
+	if impl.LogSink != nil {
+		sinkStats := impl.LogSink.GetStats()
+		rtn.LogWritesDropped = sinkStats.Dropped
+		rtn.LogWriteErrors = sinkStats.Errors
+	}
+	if !impl.StartTime.IsZero() {
+		rtn.StartTs = impl.StartTime.UnixMilli()
+	}
+	if sysInfoErr := GetSysInfoUnavailableError(); sysInfoErr != "" {
+		rtn.SysInfoUnavailable = true
+		rtn.SysInfoError = sysInfoErr
+	}
+	if impl.ConnStats != nil {
+		rtn.ConnDurations = impl.ConnStats.Snapshot()
+	}
+	if impl.HandshakeStats != nil {
+		rtn.Handshakes = impl.HandshakeStats.Snapshot()
+	}
+	rtn.Issues = GetServerIssues()
+	if impl.BufferBudget != nil {
+		rtn.BufferMemory = impl.BufferBudget.Snapshot()
+	}
+	if impl.Router != nil {
+		for _, route := range impl.Router.GetRouteStats().Routes {
+			if route.BlockType == "" {
+				continue
+			}
+			if rtn.BlockTypeCounts == nil {
+				rtn.BlockTypeCounts = make(map[string]int)
+			}
+			rtn.BlockTypeCounts[route.BlockType]++
+		}
+	}
+	return rtn, nil
+}
+
+// stop accepting new listener connections, existing routes keep working
+func (impl *ServerImpl) QuiesceCommand(ctx context.Context) error {
+	if _, err := impl.getRouter(); err != nil {
+		return err
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return err
+	}
+	impl.Quiesce()
+	return nil
+}
+
+// keepalives from deadman routes are consumed by the router, one that gets here came from a route
+// without a deadman (and is accepted so clients can send them unconditionally)
+func (impl *ServerImpl) KeepaliveCommand(ctx context.Context) error {
+	return nil
+}
+
+func (impl *ServerImpl) UnquiesceCommand(ctx context.Context) error {
+	if _, err := impl.getRouter(); err != nil {
+		return err
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return err
+	}
+	if impl.quiesced.Swap(false) {
+		PublishServerEvent(ServerEvent_Quiesce, false, "server accepting new connections")
+	}
+	return nil
+}
+
+func (impl *ServerImpl) LogTailCommand(ctx context.Context, data wshrpc.CommandLogTailData) (*wshrpc.CommandLogTailRtnData, error) {
+	if impl.LogBuffer == nil {
+		return nil, errors.New("log buffer is not enabled (see --log-buffer-bytes)")
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	entries, dropped := impl.LogBuffer.Tail(data.Lines)
+	stats := impl.LogBuffer.GetStats()
+	return &wshrpc.CommandLogTailRtnData{
+		Entries:     entries,
+		Dropped:     dropped,
+		Truncated:   dropped > 0,
+		BufferBytes: stats.CurBytes,
+		MaxBytes:    stats.MaxBytes,
+	}, nil
+}
+
+func (impl *ServerImpl) LogFileCommand(ctx context.Context, data wshrpc.CommandLogFileData) (*wshrpc.LogFileData, error) {
+	if impl.LogFile == nil {
+		return nil, errors.New("the server is not logging to a file (see --log-file)")
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	switch data.Action {
+	case "":
+	case "rotate":
+		if err := impl.LogFile.Rotate(); err != nil {
+			return nil, err
+		}
+		log.Printf("log file rotated by request\n")
+	case "reopen":
+		if err := impl.LogFile.Reopen(); err != nil {
+			return nil, err
+		}
+		log.Printf("log file reopened by request\n")
+	default:
+		return nil, fmt.Errorf("invalid action %q (must be rotate or reopen)", data.Action)
+	}
+	stats := impl.LogFile.GetStats()
+	return &wshrpc.LogFileData{
+		Path:         stats.Path,
+		Size:         stats.Size,
+		MaxSize:      stats.MaxSize,
+		Keep:         stats.Keep,
+		RotatedFiles: impl.LogFile.RotatedFiles(),
+		Rotations:    stats.Rotations,
+		LastRotateTs: stats.LastRotateTs,
+		LastError:    stats.LastError,
+	}, nil
+}
+
+// the effective config: the startup config plus the current runtime settings
+func (impl *ServerImpl) GetServerConfigCommand(ctx context.Context) (*wshrpc.ConnServerConfigData, error) {
+	if impl.Config == nil {
+		return nil, errors.New("server config not available")
+	}
+	rtn := *impl.Config
+	if impl.RootDir != "" {
+		// resolved (and possibly per-route) root dir
+		rtn.RootDir = impl.RootDir
+	}
+	rtn.SysInfoIntervalMs = GetSysInfoInterval().Milliseconds()
+	rtn.Quiesced = impl.IsQuiesced()
+	rtn.Toggles = GetToggles()
+	return &rtn, nil
+}
+
+func (impl *ServerImpl) ResetRouteCommand(ctx context.Context, data wshrpc.CommandResetRouteData) (*wshrpc.CommandResetRouteRtnData, error) {
+	router, err := impl.getRouter()
+	if err != nil {
+		return nil, err
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	rtn, err := router.ResetRoute(data.RouteId, data.Disconnect)
+	if err != nil {
+		return nil, err
+	}
+	impl.Log("[reset] route %q reset: drained:%d canceled:%d failed:%d disconnected:%v\n", data.RouteId, rtn.DrainedMessages, rtn.CanceledRequests, rtn.FailedRequests, rtn.Disconnected)
+	return rtn, nil
+}
+
+func (impl *ServerImpl) PauseRouteCommand(ctx context.Context, data wshrpc.CommandPauseRouteData) (*wshrpc.PauseRouteRtnData, error) {
+	router, err := impl.getRouter()
+	if err != nil {
+		return nil, err
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	rtn, err := router.PauseRoute(data.RouteId, data.Overflow)
+	if err != nil {
+		return nil, err
+	}
+	impl.Log("[pause] route %q paused (overflow:%s queued:%d)\n", data.RouteId, rtn.Overflow, rtn.Queued)
+	return rtn, nil
+}
+
+func (impl *ServerImpl) ResumeRouteCommand(ctx context.Context, data wshrpc.CommandResumeRouteData) (*wshrpc.PauseRouteRtnData, error) {
+	router, err := impl.getRouter()
+	if err != nil {
+		return nil, err
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	rtn, err := router.ResumeRoute(data.RouteId)
+	if err != nil {
+		return nil, err
+	}
+	impl.Log("[pause] route %q resumed (flushing:%d dropped:%d)\n", data.RouteId, rtn.Queued, rtn.Dropped)
+	return rtn, nil
+}
+
+const MaxBroadcastMessageLen = 1024
+
+var broadcastLevels = []string{"info", "warning", "error"}
+
+func (impl *ServerImpl) BroadcastCommand(ctx context.Context, data wshrpc.CommandBroadcastData) (*wshrpc.CommandBroadcastRtnData, error) {
+	router, err := impl.getRouter()
+	if err != nil {
+		return nil, err
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	message := strings.TrimSpace(data.Message)
+	if message == "" {
+		return nil, errors.New("no broadcast message given")
+	}
+	if len(message) > MaxBroadcastMessageLen {
+		return nil, fmt.Errorf("broadcast message too long (%d bytes, max %d)", len(message), MaxBroadcastMessageLen)
+	}
+	level := data.Level
+	if level == "" {
+		level = broadcastLevels[0]
+	}
+	if !slices.Contains(broadcastLevels, level) {
+		return nil, fmt.Errorf("invalid broadcast level %q (valid levels: %s)", level, strings.Join(broadcastLevels, ", "))
+	}
+	if data.InMs < 0 {
+		return nil, fmt.Errorf("invalid inms %d", data.InMs)
+	}
+	nowTs := time.Now().UnixMilli()
+	evData := wshrpc.BroadcastEventData{Message: message, Level: level}
+	if data.InMs > 0 {
+		evData.AtTs = nowTs + data.InMs
+	}
+	event := wps.WaveEvent{
+		Event:  wps.Event_ConnServer,
+		Scopes: []string{impl.ConnName},
+		Data:   wshrpc.ConnServerEventData{Type: ServerEvent_Broadcast, Ts: nowTs, Message: message, Data: evData},
+	}
+	routeIds := router.GetLocalRouteIds()
+	for _, routeId := range routeIds {
+		router.SendEvent(routeId, event)
+	}
+	PublishServerEvent(ServerEvent_Broadcast, evData, "%s (sent to %d routes)", message, len(routeIds))
+	return &wshrpc.CommandBroadcastRtnData{NumRoutes: len(routeIds)}, nil
+}
+
+// delay before the shutdown starts, so the response is queued before the upstream is drained
+const shutdownCommandDelay = 50 * time.Millisecond
+
+func (impl *ServerImpl) ShutdownCommand(ctx context.Context, data wshrpc.CommandShutdownData) error {
+	if _, err := impl.getRouter(); err != nil {
+		return err
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return err
+	}
+	if data.GraceMs < 0 {
+		return fmt.Errorf("invalid gracems %d", data.GraceMs)
+	}
+	grace := time.Duration(data.GraceMs) * time.Millisecond
+	if grace == 0 && impl.Config != nil {
+		grace = time.Duration(impl.Config.ShutdownGraceMs) * time.Millisecond
+	}
+	if grace == 0 {
+		grace = wshutil.DefaultShutdownGrace
+	}
+	PublishServerEvent(ServerEvent_Shutdown, nil, "shutdown requested by route %q (grace %v)", wshutil.GetRpcSourceFromContext(ctx), grace)
+	go func() {
+		defer panichandler.PanicHandler("ShutdownCommand")
+		time.Sleep(shutdownCommandDelay)
+		wshutil.GracefulShutdown("shutdown command", 0, false, grace)
+	}()
+	return nil
+}
+
+// set by the tls listener (--listen-tls), nil when no certificates are loaded
+var certReloader atomic.Pointer[func() (*wshrpc.CommandReloadCertRtnData, error)]
+
+func SetCertReloader(reloadFn func() (*wshrpc.CommandReloadCertRtnData, error)) {
+	certReloader.Store(&reloadFn)
+}
+
+// re-reads the tls certificate files and swaps them in, new handshakes use the new certificates
+// (existing connections keep theirs).  nothing is swapped if any certificate fails to load.
+func (impl *ServerImpl) ReloadCertCommand(ctx context.Context) (*wshrpc.CommandReloadCertRtnData, error) {
+	if _, err := impl.getRouter(); err != nil {
+		return nil, err
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	reloadFn := certReloader.Load()
+	if reloadFn == nil {
+		return nil, errors.New("no tls certificates to reload (--listen-tls is not enabled)")
+	}
+	return (*reloadFn)()
+}
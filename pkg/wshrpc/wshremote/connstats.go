@@ -0,0 +1,104 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+type connDurationBucket struct {
+	Label string
+	Max   time.Duration // 0 for the overflow bucket
+}
+
+var connDurationBuckets = []connDurationBucket{
+	{Label: "<1s", Max: time.Second},
+	{Label: "<10s", Max: 10 * time.Second},
+	{Label: "<1m", Max: time.Minute},
+	{Label: "<10m", Max: 10 * time.Minute},
+	{Label: ">10m"},
+}
+
+// how long listener connections lasted (registration to cleanup).
+// a spike in short connections usually means a reconnect storm or failing clients.
+type ConnDurationHistogram struct {
+	lock   *sync.Mutex
+	counts []int64
+}
+
+func MakeConnDurationHistogram() *ConnDurationHistogram {
+	return &ConnDurationHistogram{
+		lock:   &sync.Mutex{},
+		counts: make([]int64, len(connDurationBuckets)),
+	}
+}
+
+func (h *ConnDurationHistogram) Record(dur time.Duration) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	for idx, bucket := range connDurationBuckets {
+		if bucket.Max == 0 || dur < bucket.Max {
+			h.counts[idx]++
+			return
+		}
+	}
+}
+
+func (h *ConnDurationHistogram) Snapshot() []wshrpc.ConnDurationBucketData {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	rtn := make([]wshrpc.ConnDurationBucketData, len(connDurationBuckets))
+	for idx, bucket := range connDurationBuckets {
+		rtn[idx] = wshrpc.ConnDurationBucketData{Label: bucket.Label, MaxMs: bucket.Max.Milliseconds(), Count: h.counts[idx]}
+	}
+	return rtn
+}
+
+const HandshakeStatsWindow = 128
+
+// listener handshake latency (accept to route registration), averaged over the last HandshakeStatsWindow handshakes.
+// slow handshakes usually mean upstream auth latency.
+type HandshakeStats struct {
+	lock    *sync.Mutex
+	samples []time.Duration // ring buffer
+	next    int
+	count   int64
+	max     time.Duration
+}
+
+func MakeHandshakeStats() *HandshakeStats {
+	return &HandshakeStats{lock: &sync.Mutex{}}
+}
+
+func (s *HandshakeStats) Record(dur time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if len(s.samples) < HandshakeStatsWindow {
+		s.samples = append(s.samples, dur)
+	} else {
+		s.samples[s.next] = dur
+		s.next = (s.next + 1) % HandshakeStatsWindow
+	}
+	s.count++
+	if dur > s.max {
+		s.max = dur
+	}
+}
+
+func (s *HandshakeStats) Snapshot() *wshrpc.HandshakeStatsData {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	rtn := &wshrpc.HandshakeStatsData{Count: s.count, MaxMs: s.max.Milliseconds(), WindowSize: len(s.samples)}
+	if len(s.samples) > 0 {
+		var total time.Duration
+		for _, sample := range s.samples {
+			total += sample
+		}
+		rtn.AvgMs = float64(total.Microseconds()) / float64(len(s.samples)) / 1000
+	}
+	return rtn
+}
@@ -0,0 +1,107 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/cpu"
+	"github.com/shirou/gopsutil/v4/load"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// requests use the time since the previous request as the sample window when it is between these,
+// otherwise they sample for cpuDetailMinSample
+const cpuDetailMinSample = 250 * time.Millisecond
+const cpuDetailMaxSample = 10 * time.Second
+
+// cpu times from the last request.  kept separate from cpu.Percent, whose shared "last call" state
+// belongs to the sysinfo loop.
+type cpuTimesSample struct {
+	Ts    time.Time
+	Total cpu.TimesStat
+	Cores []cpu.TimesStat
+}
+
+var cpuDetailLock = &sync.Mutex{}
+var lastCpuDetailSample *cpuTimesSample
+
+func readCpuTimes(ctx context.Context) (*cpuTimesSample, error) {
+	cores, err := cpu.TimesWithContext(ctx, true)
+	if err != nil {
+		return nil, err
+	}
+	total, err := cpu.TimesWithContext(ctx, false)
+	if err != nil || len(total) == 0 {
+		return nil, fmt.Errorf("cannot read total cpu times: %v", err)
+	}
+	return &cpuTimesSample{Ts: time.Now(), Total: total[0], Cores: cores}, nil
+}
+
+// same as gopsutil's busy calculation (guest time is already counted in user on linux)
+func cpuBusyTimes(times cpu.TimesStat) (float64, float64) {
+	total := times.Total()
+	if runtime.GOOS == "linux" {
+		total -= times.Guest + times.GuestNice
+	}
+	return total, total - times.Idle - times.Iowait
+}
+
+func cpuBusyPercent(prev cpu.TimesStat, cur cpu.TimesStat) float64 {
+	prevTotal, prevBusy := cpuBusyTimes(prev)
+	curTotal, curBusy := cpuBusyTimes(cur)
+	if curBusy <= prevBusy || curTotal <= prevTotal {
+		return 0
+	}
+	return min(100, (curBusy-prevBusy)/(curTotal-prevTotal)*100)
+}
+
+func (impl *ServerImpl) CpuDetailCommand(ctx context.Context) (*wshrpc.CpuDetailData, error) {
+	cpuDetailLock.Lock()
+	defer cpuDetailLock.Unlock()
+	prev := lastCpuDetailSample
+	if prev == nil || time.Since(prev.Ts) < cpuDetailMinSample || time.Since(prev.Ts) > cpuDetailMaxSample {
+		var err error
+		prev, err = readCpuTimes(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("cannot read cpu times: %w", err)
+		}
+		select {
+		case <-time.After(cpuDetailMinSample):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	cur, err := readCpuTimes(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read cpu times: %w", err)
+	}
+	lastCpuDetailSample = cur
+	rtn := &wshrpc.CpuDetailData{
+		Ts:           cur.Ts.UnixMilli(),
+		LogicalCores: len(cur.Cores),
+		TotalPercent: cpuBusyPercent(prev.Total, cur.Total),
+		CorePercents: make([]float64, len(cur.Cores)),
+		SampleMs:     cur.Ts.Sub(prev.Ts).Milliseconds(),
+	}
+	for idx, coreTimes := range cur.Cores {
+		// a cpu that went offline/online since the last sample has no previous times to compare
+		if idx < len(prev.Cores) && prev.Cores[idx].CPU == coreTimes.CPU {
+			rtn.CorePercents[idx] = cpuBusyPercent(prev.Cores[idx], coreTimes)
+		}
+	}
+	if physicalCores, err := cpu.CountsWithContext(ctx, false); err == nil {
+		rtn.PhysicalCores = physicalCores
+	}
+	if loadAvg, err := load.AvgWithContext(ctx); err == nil {
+		rtn.LoadAvg1 = loadAvg.Load1
+		rtn.LoadAvg5 = loadAvg.Load5
+		rtn.LoadAvg15 = loadAvg.Load15
+	}
+	return rtn, nil
+}
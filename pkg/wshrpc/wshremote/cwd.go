@@ -0,0 +1,94 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var routeCwdLock = &sync.Mutex{}
+var routeCwds = make(map[string]string) // source route => cwd (already resolved)
+
+func getRouteCwd(source string) string {
+	routeCwdLock.Lock()
+	defer routeCwdLock.Unlock()
+	return routeCwds[source]
+}
+
+func setRouteCwd(source string, cwd string) {
+	routeCwdLock.Lock()
+	defer routeCwdLock.Unlock()
+	if cwd == "" {
+		delete(routeCwds, source)
+		return
+	}
+	routeCwds[source] = cwd
+}
+
+// called when a route disconnects
+func ClearRouteCwd(routeId string) {
+	setRouteCwd(routeId, "")
+}
+
+// resolvePath, with relative paths first joined to the calling route's cwd (SetCwd).  the cwd is
+// always within the root dir, so the root dir check is unchanged
+func (impl *ServerImpl) resolveRoutePath(ctx context.Context, path string) (string, error) {
+	expanded, err := wavebase.ExpandHomeDir(path)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(expanded) {
+		if cwd := getRouteCwd(wshutil.GetRpcSourceFromContext(ctx)); cwd != "" {
+			expanded = filepath.Join(cwd, expanded)
+		}
+	}
+	return impl.resolvePath(expanded)
+}
+
+func (impl *ServerImpl) SetCwdCommand(ctx context.Context, data wshrpc.CommandSetCwdData) (*wshrpc.CwdData, error) {
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	if data.Path == "" {
+		setRouteCwd(source, "")
+		return impl.GetCwdCommand(ctx)
+	}
+	cwd, err := impl.resolveRoutePath(ctx, data.Path)
+	if err != nil {
+		return nil, err
+	}
+	cwd, err = filepath.Abs(cwd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot resolve %q: %w", data.Path, err)
+	}
+	finfo, err := os.Stat(cwd)
+	if err != nil {
+		return nil, fmt.Errorf("cannot set cwd: %w", err)
+	}
+	if !finfo.IsDir() {
+		return nil, fmt.Errorf("cannot set cwd: %q is not a directory", cwd)
+	}
+	setRouteCwd(source, cwd)
+	return &wshrpc.CwdData{Cwd: cwd}, nil
+}
+
+func (impl *ServerImpl) GetCwdCommand(ctx context.Context) (*wshrpc.CwdData, error) {
+	if cwd := getRouteCwd(wshutil.GetRpcSourceFromContext(ctx)); cwd != "" {
+		return &wshrpc.CwdData{Cwd: cwd}, nil
+	}
+	if impl.RootDir != "" {
+		return &wshrpc.CwdData{Cwd: impl.RootDir, Default: true}, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, fmt.Errorf("cannot get the server's cwd: %w", err)
+	}
+	return &wshrpc.CwdData{Cwd: cwd, Default: true}, nil
+}
@@ -0,0 +1,67 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+var pseudoFsTypes = map[string]bool{
+	"proc": true, "sysfs": true, "cgroup": true, "cgroup2": true, "devpts": true, "securityfs": true,
+	"debugfs": true, "tracefs": true, "pstore": true, "bpf": true, "configfs": true, "fusectl": true,
+	"mqueue": true, "hugetlbfs": true, "binfmt_misc": true, "autofs": true, "efivarfs": true,
+	"rpc_pipefs": true, "nsfs": true, "selinuxfs": true, "devfs": true,
+}
+
+var memFsTypes = map[string]bool{
+	"tmpfs": true, "devtmpfs": true, "ramfs": true,
+}
+
+func (impl *ServerImpl) DiskUsageCommand(ctx context.Context, data wshrpc.CommandDiskUsageData) (*wshrpc.CommandDiskUsageRtnData, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list mounted filesystems: %w", err)
+	}
+	rtn := &wshrpc.CommandDiskUsageRtnData{Filesystems: []wshrpc.DiskUsageInfo{}}
+	seen := make(map[string]bool)
+	for _, partition := range partitions {
+		if !data.All && pseudoFsTypes[partition.Fstype] {
+			continue
+		}
+		if !data.All && !data.IncludeTmpfs && memFsTypes[partition.Fstype] {
+			continue
+		}
+		if seen[partition.Mountpoint] {
+			// over-mounted, only the first entry has meaningful usage
+			continue
+		}
+		seen[partition.Mountpoint] = true
+		usage, err := disk.UsageWithContext(ctx, partition.Mountpoint)
+		if err != nil {
+			// permission denied or a stale network mount, skip it rather than failing the whole list
+			continue
+		}
+		if !data.All && usage.Total == 0 {
+			continue
+		}
+		rtn.Filesystems = append(rtn.Filesystems, wshrpc.DiskUsageInfo{
+			Path:        partition.Mountpoint,
+			Device:      partition.Device,
+			FsType:      partition.Fstype,
+			Total:       usage.Total,
+			Used:        usage.Used,
+			Free:        usage.Free,
+			UsedPercent: usage.UsedPercent,
+		})
+	}
+	sort.Slice(rtn.Filesystems, func(i, j int) bool {
+		return rtn.Filesystems[i].Path < rtn.Filesystems[j].Path
+	})
+	return rtn, nil
+}
@@ -0,0 +1,49 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const entropyAvailFile = "/proc/sys/kernel/random/entropy_avail"
+const entropyPoolSizeFile = "/proc/sys/kernel/random/poolsize"
+
+// freshly booted vms can sit below this for a while, blocking getrandom() (and so tls handshakes)
+const EntropyLowThreshold = 256
+
+func readProcInt(fileName string) (int, error) {
+	barr, err := os.ReadFile(fileName)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(barr)))
+}
+
+func (impl *ServerImpl) EntropyInfoCommand(ctx context.Context) (*wshrpc.EntropyInfoData, error) {
+	entropyAvail, err := readProcInt(entropyAvailFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return &wshrpc.EntropyInfoData{Available: false}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %w", entropyAvailFile, err)
+	}
+	rtn := &wshrpc.EntropyInfoData{
+		Available:    true,
+		EntropyAvail: entropyAvail,
+		Low:          entropyAvail < EntropyLowThreshold,
+	}
+	if poolSize, err := readProcInt(entropyPoolSizeFile); err == nil {
+		rtn.PoolSize = poolSize
+	}
+	return rtn, nil
+}
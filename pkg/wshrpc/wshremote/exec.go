@@ -0,0 +1,433 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/creack/pty"
+	"github.com/google/uuid"
+	"github.com/shirou/gopsutil/v4/process"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/waveobj"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const MaxExecSessionsPerRoute = 8
+const execReadBufSize = 32 * 1024
+const execPtyDrainTimeout = 500 * time.Millisecond // after a pty command exits, for its children's last output
+const MaxExecTermDim = 10000
+
+var defaultExecTermSize = waveobj.TermSize{Rows: 24, Cols: 80}
+
+type execSession struct {
+	Source   string
+	Stdin    io.WriteCloser // the pty for pty sessions, set once the command has started
+	Pty      pty.Pty        // nil unless the command runs on a pseudo terminal
+	Cmd      string
+	Args     []string
+	Cwd      string
+	StartTs  int64
+	CancelFn context.CancelFunc // kills the command
+	Pid      int                // set once the command has started
+	Proc     *process.Process   // kept between ListExec calls for the cpu percent
+}
+
+var execLock = &sync.Mutex{}
+var execSessions = make(map[string]*execSession) // execid => session
+var execCounts = make(map[string]int)            // source route => active sessions
+
+func registerExecSession(execId string, session *execSession) error {
+	execLock.Lock()
+	defer execLock.Unlock()
+	if execCounts[session.Source] >= MaxExecSessionsPerRoute {
+		return fmt.Errorf("too many exec sessions for route %q (max %d)", session.Source, MaxExecSessionsPerRoute)
+	}
+	execCounts[session.Source]++
+	execSessions[execId] = session
+	return nil
+}
+
+func unregisterExecSession(execId string) {
+	execLock.Lock()
+	defer execLock.Unlock()
+	session := execSessions[execId]
+	if session == nil {
+		return
+	}
+	delete(execSessions, execId)
+	execCounts[session.Source]--
+	if execCounts[session.Source] <= 0 {
+		delete(execCounts, session.Source)
+	}
+}
+
+func getExecSession(execId string) *execSession {
+	execLock.Lock()
+	defer execLock.Unlock()
+	return execSessions[execId]
+}
+
+func setExecSessionStarted(execId string, pid int, ptyFile pty.Pty) {
+	execLock.Lock()
+	defer execLock.Unlock()
+	if session := execSessions[execId]; session != nil {
+		session.Pid = pid
+		if ptyFile != nil {
+			session.Stdin = ptyFile
+			session.Pty = ptyFile
+		}
+	}
+}
+
+func getExecSessionIo(session *execSession) (io.WriteCloser, pty.Pty) {
+	execLock.Lock()
+	defer execLock.Unlock()
+	return session.Stdin, session.Pty
+}
+
+func validateExecTermSize(termSize *waveobj.TermSize) error {
+	if termSize.Rows < 1 || termSize.Cols < 1 || termSize.Rows > MaxExecTermDim || termSize.Cols > MaxExecTermDim {
+		return fmt.Errorf("invalid terminal size %dx%d", termSize.Rows, termSize.Cols)
+	}
+	return nil
+}
+
+// the given route's sessions that have started (execid => session)
+func getRouteExecSessions(source string) map[string]*execSession {
+	execLock.Lock()
+	defer execLock.Unlock()
+	rtn := make(map[string]*execSession)
+	for execId, session := range execSessions {
+		if session.Source == source && session.Pid > 0 {
+			rtn[execId] = session
+		}
+	}
+	return rtn
+}
+
+func execErr(err error) wshrpc.RespOrErrorUnion[wshrpc.ExecOutputData] {
+	return wshrpc.RespOrErrorUnion[wshrpc.ExecOutputData]{Error: err}
+}
+
+func (impl *ServerImpl) ExecCommand(ctx context.Context, data wshrpc.CommandExecData) chan wshrpc.RespOrErrorUnion[wshrpc.ExecOutputData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.ExecOutputData], 16)
+	if impl.RootDir != "" {
+		// a command can access anything, it can't be confined to the root dir
+		ch <- execErr(rootDirErr(data.Cmd))
+		close(ch)
+		return ch
+	}
+	if err := impl.checkWritable(data.Cmd); err != nil {
+		// a command can modify anything
+		ch <- execErr(err)
+		close(ch)
+		return ch
+	}
+	if data.Cmd == "" {
+		ch <- execErr(errors.New("no command given"))
+		close(ch)
+		return ch
+	}
+	termSize := defaultExecTermSize
+	if data.TermSize != nil {
+		if err := validateExecTermSize(data.TermSize); err != nil {
+			ch <- execErr(err)
+			close(ch)
+			return ch
+		}
+		termSize = *data.TermSize
+	}
+	execCtx, cancelFn := context.WithCancel(ctx)
+	cmd := exec.CommandContext(execCtx, data.Cmd, data.Args...)
+	cmd.WaitDelay = 2 * time.Second
+	cwdPath := data.Cwd
+	if cwdPath == "" {
+		cwdPath = getRouteCwd(wshutil.GetRpcSourceFromContext(ctx))
+	}
+	if cwdPath != "" {
+		cwd, err := impl.resolveRoutePath(ctx, cwdPath)
+		if err != nil {
+			cancelFn()
+			ch <- execErr(err)
+			close(ch)
+			return ch
+		}
+		cmd.Dir = cwd
+	}
+	env, err := buildExecEnv(data)
+	if err != nil {
+		cancelFn()
+		ch <- execErr(err)
+		close(ch)
+		return ch
+	}
+	cmd.Env = env
+	var stdin io.WriteCloser
+	var stdout, stderr io.ReadCloser
+	if !data.Pty {
+		var stdinErr, stdoutErr, stderrErr error
+		stdin, stdinErr = cmd.StdinPipe()
+		stdout, stdoutErr = cmd.StdoutPipe()
+		stderr, stderrErr = cmd.StderrPipe()
+		if err := errors.Join(stdinErr, stdoutErr, stderrErr); err != nil {
+			cancelFn()
+			ch <- execErr(fmt.Errorf("cannot set up command pipes: %w", err))
+			close(ch)
+			return ch
+		}
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	execId := uuid.New().String()
+	session := &execSession{
+		Source:   source,
+		Stdin:    stdin,
+		Cmd:      data.Cmd,
+		Args:     data.Args,
+		Cwd:      cmd.Dir,
+		StartTs:  time.Now().UnixMilli(),
+		CancelFn: cancelFn,
+	}
+	if err := registerExecSession(execId, session); err != nil {
+		cancelFn()
+		ch <- execErr(err)
+		close(ch)
+		return ch
+	}
+	var ptyFile pty.Pty
+	var startErr error
+	if data.Pty {
+		ptyFile, startErr = pty.StartWithSize(cmd, &pty.Winsize{Rows: uint16(termSize.Rows), Cols: uint16(termSize.Cols)})
+	} else {
+		startErr = cmd.Start()
+	}
+	if startErr != nil {
+		unregisterExecSession(execId)
+		cancelFn()
+		ch <- execErr(fmt.Errorf("cannot start command: %w", startErr))
+		close(ch)
+		return ch
+	}
+	setExecSessionStarted(execId, cmd.Process.Pid, ptyFile)
+	impl.Log("[exec] started %q pid:%d pty:%v for route %q\n", data.Cmd, cmd.Process.Pid, data.Pty, source)
+	ch <- wshrpc.RespOrErrorUnion[wshrpc.ExecOutputData]{Response: wshrpc.ExecOutputData{ExecId: execId, Pid: cmd.Process.Pid}}
+	sendFn := func(resp wshrpc.ExecOutputData) {
+		select {
+		case ch <- wshrpc.RespOrErrorUnion[wshrpc.ExecOutputData]{Response: resp}:
+		case <-execCtx.Done():
+		}
+	}
+	// like FileWatch, local routes kill their commands when they disconnect
+	localRoute := impl.Router != nil && impl.Router.IsLocalRoute(source)
+	go func() {
+		defer panichandler.PanicHandler("ExecCommand:routecheck")
+		ticker := time.NewTicker(fileWatchRouteCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-execCtx.Done():
+				return
+			case <-ticker.C:
+				if localRoute && !impl.Router.IsLocalRoute(source) {
+					cancelFn()
+					return
+				}
+			}
+		}
+	}()
+	go func() {
+		defer panichandler.PanicHandler("ExecCommand")
+		defer func() {
+			unregisterExecSession(execId)
+			cancelFn()
+			close(ch)
+		}()
+		readFn := func(stream string, reader io.Reader) {
+			defer panichandler.PanicHandler("ExecCommand:read")
+			buf := make([]byte, execReadBufSize)
+			for {
+				n, err := reader.Read(buf)
+				if n > 0 {
+					sendFn(wshrpc.ExecOutputData{Stream: stream, Data64: base64.StdEncoding.EncodeToString(buf[:n])})
+				}
+				if err != nil {
+					return
+				}
+			}
+		}
+		var waitErr error
+		if ptyFile != nil {
+			go func() {
+				<-execCtx.Done()
+				// a pty process isn't always started by cmd.Start (windows), so the ctx doesn't kill it
+				cmd.Process.Kill()
+			}()
+			readDone := make(chan struct{})
+			go func() {
+				defer close(readDone)
+				readFn(wshrpc.ExecStream_Stdout, ptyFile)
+			}()
+			waitErr = cmd.Wait()
+			// background children may keep the terminal open, don't wait for them
+			select {
+			case <-readDone:
+			case <-time.After(execPtyDrainTimeout):
+			}
+			ptyFile.Close()
+			<-readDone
+		} else {
+			go func() {
+				// a killed command's children may keep the pipes open, don't wait for them
+				<-execCtx.Done()
+				stdout.Close()
+				stderr.Close()
+			}()
+			var readWg sync.WaitGroup
+			readWg.Add(2)
+			go func() {
+				defer readWg.Done()
+				readFn(wshrpc.ExecStream_Stdout, stdout)
+			}()
+			go func() {
+				defer readWg.Done()
+				readFn(wshrpc.ExecStream_Stderr, stderr)
+			}()
+			// all reads must finish before Wait (Wait closes the pipes)
+			readWg.Wait()
+			waitErr = cmd.Wait()
+		}
+		exitCode := 0
+		if waitErr != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(waitErr, &exitErr) {
+				select {
+				case ch <- execErr(fmt.Errorf("error waiting for command: %w", waitErr)):
+				case <-execCtx.Done():
+				}
+				return
+			}
+			exitCode = exitErr.ExitCode()
+		}
+		impl.Log("[exec] pid:%d exited with code %d\n", cmd.Process.Pid, exitCode)
+		// the exec ctx is already done after a KillExec, only a done request drops the exit packet
+		select {
+		case ch <- wshrpc.RespOrErrorUnion[wshrpc.ExecOutputData]{Response: wshrpc.ExecOutputData{Exited: true, ExitCode: exitCode}}:
+		case <-ctx.Done():
+		}
+	}()
+	return ch
+}
+
+// only the route that started the command may write to it
+func (impl *ServerImpl) ExecInputCommand(ctx context.Context, data wshrpc.CommandExecInputData) error {
+	session := getExecSession(data.ExecId)
+	if session == nil || session.Source != wshutil.GetRpcSourceFromContext(ctx) {
+		return fmt.Errorf("no exec session %q", data.ExecId)
+	}
+	stdin, ptyFile := getExecSessionIo(session)
+	if stdin == nil {
+		return fmt.Errorf("exec session %q has not started", data.ExecId)
+	}
+	if data.TermSize != nil {
+		if ptyFile == nil {
+			return fmt.Errorf("exec session %q has no pty", data.ExecId)
+		}
+		if err := validateExecTermSize(data.TermSize); err != nil {
+			return err
+		}
+		if err := pty.Setsize(ptyFile, &pty.Winsize{Rows: uint16(data.TermSize.Rows), Cols: uint16(data.TermSize.Cols)}); err != nil {
+			return fmt.Errorf("cannot resize the terminal: %w", err)
+		}
+	}
+	if data.Data64 != "" {
+		barr, err := base64.StdEncoding.DecodeString(data.Data64)
+		if err != nil {
+			return fmt.Errorf("invalid base64 input: %w", err)
+		}
+		if _, err := stdin.Write(barr); err != nil {
+			return fmt.Errorf("error writing to command stdin: %w", err)
+		}
+	}
+	if data.Eof {
+		if ptyFile != nil {
+			// closing the pty would end the session, the terminal turns ^D into an eof
+			if _, err := ptyFile.Write([]byte{0x04}); err != nil {
+				return fmt.Errorf("error writing to command stdin: %w", err)
+			}
+			return nil
+		}
+		return stdin.Close()
+	}
+	return nil
+}
+
+func (impl *ServerImpl) ListExecCommand(ctx context.Context) (*wshrpc.CommandListExecRtnData, error) {
+	sessions := getRouteExecSessions(wshutil.GetRpcSourceFromContext(ctx))
+	rtn := &wshrpc.CommandListExecRtnData{Sessions: []wshrpc.ExecSessionInfo{}}
+	for execId, session := range sessions {
+		_, sessionPty := getExecSessionIo(session)
+		info := wshrpc.ExecSessionInfo{
+			ExecId:  execId,
+			Pid:     session.Pid,
+			Cmd:     session.Cmd,
+			Args:    session.Args,
+			Cwd:     session.Cwd,
+			Pty:     sessionPty != nil,
+			StartTs: session.StartTs,
+		}
+		execLock.Lock()
+		proc := session.Proc
+		execLock.Unlock()
+		sampled := proc != nil
+		if proc == nil {
+			proc, _ = process.NewProcessWithContext(ctx, int32(session.Pid))
+		}
+		if proc != nil {
+			cpuPercent, err := proc.PercentWithContext(ctx, 0)
+			if err == nil && !sampled {
+				cpuPercent, err = proc.CPUPercentWithContext(ctx)
+			}
+			if err == nil {
+				info.CpuPercent = cpuPercent
+			}
+			if memInfo, err := proc.MemoryInfoWithContext(ctx); err == nil {
+				info.Rss = memInfo.RSS
+			}
+			execLock.Lock()
+			session.Proc = proc
+			execLock.Unlock()
+		}
+		rtn.Sessions = append(rtn.Sessions, info)
+	}
+	sort.Slice(rtn.Sessions, func(i, j int) bool {
+		if rtn.Sessions[i].StartTs != rtn.Sessions[j].StartTs {
+			return rtn.Sessions[i].StartTs < rtn.Sessions[j].StartTs
+		}
+		return rtn.Sessions[i].ExecId < rtn.Sessions[j].ExecId
+	})
+	return rtn, nil
+}
+
+// only the route that started the command may kill it
+func (impl *ServerImpl) KillExecCommand(ctx context.Context, data wshrpc.CommandKillExecData) error {
+	session := getExecSession(data.ExecId)
+	if session == nil || session.Source != wshutil.GetRpcSourceFromContext(ctx) {
+		return fmt.Errorf("no exec session %q", data.ExecId)
+	}
+	if err := impl.checkWritable(session.Cmd); err != nil {
+		return err
+	}
+	impl.Log("[exec] killing pid:%d (exec session %q)\n", session.Pid, data.ExecId)
+	session.CancelFn()
+	return nil
+}
@@ -0,0 +1,142 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const MaxExecEnvVars = 256
+const MaxExecEnvNameLen = 256
+const MaxExecEnvValueLen = 32 * 1024
+const MaxExecEnvTotalLen = 256 * 1024
+
+var execEnvNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// glob patterns (path.Match syntax) of the variables exec clients may not set
+var execEnvDeny atomic.Pointer[[]string]
+
+// parses the comma separated --exec-env-deny value
+func ParseExecEnvDeny(val string) ([]string, error) {
+	var rtn []string
+	for _, pattern := range strings.Split(val, ",") {
+		pattern = strings.TrimSpace(pattern)
+		if pattern == "" {
+			continue
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+		rtn = append(rtn, pattern)
+	}
+	return rtn, nil
+}
+
+func SetExecEnvDeny(patterns []string) {
+	execEnvDeny.Store(&patterns)
+}
+
+func GetExecEnvDeny() []string {
+	if patterns := execEnvDeny.Load(); patterns != nil {
+		return *patterns
+	}
+	return nil
+}
+
+// windows environment variable names are case insensitive
+func normalizeEnvName(name string) string {
+	if runtime.GOOS == "windows" {
+		return strings.ToUpper(name)
+	}
+	return name
+}
+
+func isExecEnvDenied(name string) bool {
+	patterns := execEnvDeny.Load()
+	if patterns == nil {
+		return false
+	}
+	name = normalizeEnvName(name)
+	for _, pattern := range *patterns {
+		if matched, _ := path.Match(normalizeEnvName(pattern), name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func validateExecEnv(env map[string]string) error {
+	if len(env) > MaxExecEnvVars {
+		return fmt.Errorf("too many environment variables (%d, max %d)", len(env), MaxExecEnvVars)
+	}
+	totalLen := 0
+	for name, val := range env {
+		if len(name) > MaxExecEnvNameLen || !execEnvNameRe.MatchString(name) {
+			return fmt.Errorf("invalid environment variable name %q", name)
+		}
+		if len(val) > MaxExecEnvValueLen {
+			return fmt.Errorf("environment variable %q is too long (%d bytes, max %d)", name, len(val), MaxExecEnvValueLen)
+		}
+		if strings.IndexByte(val, 0) >= 0 {
+			return fmt.Errorf("environment variable %q contains a NUL byte", name)
+		}
+		if isExecEnvDenied(name) {
+			return fmt.Errorf("permission denied: environment variable %q is protected by the server", name)
+		}
+		totalLen += len(name) + len(val) + 2
+	}
+	if totalLen > MaxExecEnvTotalLen {
+		return fmt.Errorf("environment too large (%d bytes, max %d)", totalLen, MaxExecEnvTotalLen)
+	}
+	return nil
+}
+
+// the command's environment, nil to inherit the server's unchanged
+func buildExecEnv(data wshrpc.CommandExecData) ([]string, error) {
+	mode := data.EnvMode
+	if mode == "" {
+		mode = wshrpc.ExecEnvMode_Merge
+	}
+	if mode != wshrpc.ExecEnvMode_Merge && mode != wshrpc.ExecEnvMode_Replace {
+		return nil, fmt.Errorf("invalid envmode %q (must be %q or %q)", mode, wshrpc.ExecEnvMode_Merge, wshrpc.ExecEnvMode_Replace)
+	}
+	if err := validateExecEnv(data.Env); err != nil {
+		return nil, err
+	}
+	if mode == wshrpc.ExecEnvMode_Merge && len(data.Env) == 0 {
+		return nil, nil
+	}
+	rtn := []string{}
+	overridden := make(map[string]bool, len(data.Env))
+	for name := range data.Env {
+		overridden[normalizeEnvName(name)] = true
+	}
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if overridden[normalizeEnvName(name)] {
+			continue
+		}
+		if mode == wshrpc.ExecEnvMode_Merge || isExecEnvDenied(name) {
+			rtn = append(rtn, kv)
+		}
+	}
+	names := make([]string, 0, len(data.Env))
+	for name := range data.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		rtn = append(rtn, name+"="+data.Env[name])
+	}
+	return rtn, nil
+}
@@ -0,0 +1,39 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"os"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// linux has /proc/self/fd, macos and the bsds /dev/fd
+var fdDirs = []string{"/proc/self/fd", "/dev/fd"}
+
+// the ReadDir itself holds one fd open, it is not counted
+func countOpenFds() int {
+	for _, fdDir := range fdDirs {
+		entries, err := os.ReadDir(fdDir)
+		if err != nil {
+			continue
+		}
+		return max(len(entries)-1, 0)
+	}
+	return -1
+}
+
+func GetFdInfo() *wshrpc.FdInfoData {
+	rtn := &wshrpc.FdInfoData{Open: countOpenFds()}
+	rtn.SoftLimit, rtn.HardLimit = getFdLimits()
+	if rtn.Open >= 0 && rtn.SoftLimit > 0 {
+		rtn.UsedPercent = float64(rtn.Open) * 100 / float64(rtn.SoftLimit)
+	}
+	return rtn
+}
+
+func (impl *ServerImpl) FdInfoCommand(ctx context.Context) (*wshrpc.FdInfoData, error) {
+	return GetFdInfo(), nil
+}
@@ -0,0 +1,17 @@
+//go:build !windows
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import "syscall"
+
+// RLIM_INFINITY is reported as is (max uint64)
+func getFdLimits() (uint64, uint64) {
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		return 0, 0
+	}
+	return uint64(rlimit.Cur), uint64(rlimit.Max)
+}
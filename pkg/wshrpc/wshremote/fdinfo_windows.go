@@ -0,0 +1,11 @@
+//go:build windows
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+// windows has no fd rlimit (handles are limited per process by available memory)
+func getFdLimits() (uint64, uint64) {
+	return 0, 0
+}
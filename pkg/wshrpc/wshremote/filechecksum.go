@@ -0,0 +1,95 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const DefaultChecksumAlgorithm = "sha256"
+const checksumBufSize = 256 * 1024
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+	"sha1":   sha1.New,
+	"md5":    md5.New,
+}
+
+// stops a long hash when the request is canceled or times out
+type ctxReader struct {
+	Ctx    context.Context
+	Reader io.Reader
+}
+
+func (r *ctxReader) Read(buf []byte) (int, error) {
+	if err := r.Ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.Reader.Read(buf)
+}
+
+func (impl *ServerImpl) FileChecksumCommand(ctx context.Context, data wshrpc.CommandFileChecksumData) (*wshrpc.FileChecksumData, error) {
+	algorithm := strings.ToLower(data.Algorithm)
+	if algorithm == "" {
+		algorithm = DefaultChecksumAlgorithm
+	}
+	hashFn := checksumAlgorithms[algorithm]
+	if hashFn == nil {
+		var names []string
+		for name := range checksumAlgorithms {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("invalid algorithm %q (valid algorithms: %s)", data.Algorithm, strings.Join(names, ", "))
+	}
+	path, err := impl.resolveRoutePath(ctx, data.Path)
+	if err != nil {
+		return nil, err
+	}
+	startTime := time.Now()
+	// checked before opening, opening a fifo would block
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat file %q: %w", path, err)
+	}
+	if !finfo.Mode().IsRegular() {
+		return nil, fmt.Errorf("%q is not a regular file", path)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open file %q: %w", path, err)
+	}
+	defer file.Close()
+	hasher := hashFn()
+	size, err := io.CopyBuffer(hasher, &ctxReader{Ctx: ctx, Reader: file}, make([]byte, checksumBufSize))
+	if err != nil {
+		if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+			return nil, fmt.Errorf("checksum of %q stopped after %d bytes: %w", path, size, err)
+		}
+		return nil, fmt.Errorf("error reading file %q: %w", path, err)
+	}
+	return &wshrpc.FileChecksumData{
+		Path:       path,
+		Algorithm:  algorithm,
+		Checksum:   hex.EncodeToString(hasher.Sum(nil)),
+		Size:       size,
+		DurationMs: time.Since(startTime).Milliseconds(),
+	}, nil
+}
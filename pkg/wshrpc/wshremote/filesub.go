@@ -0,0 +1,301 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const MaxFileSubsPerRoute = 32
+const fileSubCoalesceWindow = 100 * time.Millisecond // repeats of a change within this are dropped (the writes of one save)
+
+var fileWatchOps = []string{wshrpc.FileWatchOp_Create, wshrpc.FileWatchOp_Modify, wshrpc.FileWatchOp_Delete, wshrpc.FileWatchOp_Rename}
+
+type fileSub struct {
+	Route    string
+	Router   *wshutil.WshRouter
+	Dir      string          // the watched directory
+	Glob     string          // matched against the name of a changed entry of Dir, "" to match Path
+	Path     string          // the subscribed file when Glob is ""
+	Ops      map[string]bool // nil for all ops
+	lastPath string
+	lastOp   string
+	lastTs   time.Time
+}
+
+// every subscription shares one fsnotify watcher, each directory is watched once however many
+// subscriptions need it.  the watcher is closed with the last subscription
+type fileSubManager struct {
+	lock        *sync.Mutex
+	watcher     *fsnotify.Watcher
+	subs        map[string]*fileSub // subid => sub
+	dirRefs     map[string]int      // watched dir => subscriptions
+	routeCounts map[string]int      // route => subscriptions
+}
+
+var fileSubs = &fileSubManager{
+	lock:        &sync.Mutex{},
+	subs:        make(map[string]*fileSub),
+	dirRefs:     make(map[string]int),
+	routeCounts: make(map[string]int),
+}
+
+type fileSubDelivery struct {
+	SubId  string
+	Route  string
+	Router *wshutil.WshRouter
+}
+
+func (fm *fileSubManager) add(subId string, sub *fileSub) error {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+	if fm.routeCounts[sub.Route] >= MaxFileSubsPerRoute {
+		return fmt.Errorf("too many file subscriptions for route %q (max %d)", sub.Route, MaxFileSubsPerRoute)
+	}
+	if fm.watcher == nil {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return fmt.Errorf("cannot create file watcher: %w", err)
+		}
+		fm.watcher = watcher
+		go fm.run(watcher)
+	}
+	if fm.dirRefs[sub.Dir] == 0 {
+		if err := fm.watcher.Add(sub.Dir); err != nil {
+			if len(fm.subs) == 0 {
+				fm.watcher.Close()
+				fm.watcher = nil
+			}
+			return fmt.Errorf("cannot watch %q: %w", sub.Dir, err)
+		}
+	}
+	fm.dirRefs[sub.Dir]++
+	fm.routeCounts[sub.Route]++
+	fm.subs[subId] = sub
+	return nil
+}
+
+func (fm *fileSubManager) remove(subId string) *fileSub {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+	return fm.removeLocked(subId)
+}
+
+func (fm *fileSubManager) removeLocked(subId string) *fileSub {
+	sub := fm.subs[subId]
+	if sub == nil {
+		return nil
+	}
+	delete(fm.subs, subId)
+	if fm.routeCounts[sub.Route]--; fm.routeCounts[sub.Route] <= 0 {
+		delete(fm.routeCounts, sub.Route)
+	}
+	if fm.dirRefs[sub.Dir]--; fm.dirRefs[sub.Dir] <= 0 {
+		delete(fm.dirRefs, sub.Dir)
+		// fails if the directory is gone (its watch went with it)
+		fm.watcher.Remove(sub.Dir)
+	}
+	if len(fm.subs) == 0 {
+		fm.watcher.Close()
+		fm.watcher = nil
+	}
+	return sub
+}
+
+// returns the number of subscriptions removed
+func (fm *fileSubManager) removeRoute(routeId string) int {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+	numRemoved := 0
+	for subId, sub := range fm.subs {
+		if sub.Route == routeId {
+			fm.removeLocked(subId)
+			numRemoved++
+		}
+	}
+	return numRemoved
+}
+
+func (sub *fileSub) matches(name string, op string) bool {
+	if sub.Ops != nil && !sub.Ops[op] {
+		return false
+	}
+	if name == sub.Dir {
+		// the watched directory itself was removed or renamed
+		return true
+	}
+	if filepath.Dir(name) != sub.Dir {
+		return false
+	}
+	if sub.Glob == "" {
+		return name == sub.Path
+	}
+	matched, _ := filepath.Match(sub.Glob, filepath.Base(name))
+	return matched
+}
+
+// the subscriptions to notify of a change (coalesced repeats are left out)
+func (fm *fileSubManager) getDeliveries(name string, op string, now time.Time) []fileSubDelivery {
+	fm.lock.Lock()
+	defer fm.lock.Unlock()
+	var rtn []fileSubDelivery
+	for subId, sub := range fm.subs {
+		if !sub.matches(name, op) {
+			continue
+		}
+		if sub.lastPath == name && sub.lastOp == op && now.Sub(sub.lastTs) < fileSubCoalesceWindow {
+			continue
+		}
+		sub.lastPath, sub.lastOp, sub.lastTs = name, op, now
+		rtn = append(rtn, fileSubDelivery{SubId: subId, Route: sub.Route, Router: sub.Router})
+	}
+	return rtn
+}
+
+// until the watcher is closed
+func (fm *fileSubManager) run(watcher *fsnotify.Watcher) {
+	defer panichandler.PanicHandler("fileSubManager.run")
+	for {
+		select {
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			log.Printf("filesubscribe error: %v\n", err)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			now := time.Now()
+			for _, op := range fsnotifyOpsToFileWatchOps(event.Op) {
+				for _, delivery := range fm.getDeliveries(event.Name, op, now) {
+					waveEvent := wps.WaveEvent{
+						Event:  wps.Event_FileChange,
+						Scopes: []string{delivery.SubId},
+						Data: wshrpc.FileChangeEventData{
+							SubId: delivery.SubId,
+							Ts:    now.UnixMilli(),
+							Path:  wavebase.ReplaceHomeDir(event.Name),
+							Op:    op,
+						},
+					}
+					if !delivery.Router.SendRoutedEvent(delivery.Route, waveEvent) {
+						// the route is gone and there is no upstream to reach it through
+						fm.remove(delivery.SubId)
+					}
+				}
+			}
+		}
+	}
+}
+
+// called when a route disconnects
+func ClearRouteFileSubs(routeId string) {
+	if numRemoved := fileSubs.removeRoute(routeId); numRemoved > 0 {
+		log.Printf("[filesubscribe] removed %d subscriptions of route %q\n", numRemoved, routeId)
+	}
+}
+
+func hasGlobMeta(path string) bool {
+	return strings.ContainsAny(path, "*?[")
+}
+
+// the directory to watch, and the glob or the file to match in it
+func (impl *ServerImpl) resolveFileSubPath(ctx context.Context, path string) (string, string, string, error) {
+	dirPart, base := filepath.Split(path)
+	if hasGlobMeta(dirPart) {
+		return "", "", "", fmt.Errorf("invalid path %q (only the last element can be a glob)", path)
+	}
+	if hasGlobMeta(base) {
+		if _, err := filepath.Match(base, ""); err != nil {
+			return "", "", "", fmt.Errorf("invalid glob %q: %w", base, err)
+		}
+		if dirPart == "" {
+			dirPart = "."
+		}
+		dir, err := impl.resolveRoutePath(ctx, dirPart)
+		if err != nil {
+			return "", "", "", err
+		}
+		return dir, base, "", nil
+	}
+	resolved, err := impl.resolveRoutePath(ctx, path)
+	if err != nil {
+		return "", "", "", err
+	}
+	finfo, err := os.Stat(resolved)
+	if err == nil && finfo.IsDir() {
+		return resolved, "*", "", nil
+	}
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return "", "", "", fmt.Errorf("cannot watch %q: %w", path, err)
+	}
+	// a file that doesn't exist yet is reported once created
+	return filepath.Dir(resolved), "", resolved, nil
+}
+
+func (impl *ServerImpl) FileSubscribeCommand(ctx context.Context, data wshrpc.CommandFileSubscribeData) (*wshrpc.CommandFileSubscribeRtnData, error) {
+	router, err := impl.getRouter()
+	if err != nil {
+		return nil, err
+	}
+	if data.Path == "" {
+		return nil, errors.New("no path given")
+	}
+	var ops map[string]bool
+	for _, op := range data.Ops {
+		if !slices.Contains(fileWatchOps, op) {
+			return nil, fmt.Errorf("invalid op %q (valid ops: %s)", op, strings.Join(fileWatchOps, ", "))
+		}
+		if ops == nil {
+			ops = make(map[string]bool)
+		}
+		ops[op] = true
+	}
+	dir, glob, filePath, err := impl.resolveFileSubPath(ctx, data.Path)
+	if err != nil {
+		return nil, err
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	subId := uuid.New().String()
+	sub := &fileSub{Route: source, Router: router, Dir: dir, Glob: glob, Path: filePath, Ops: ops}
+	if err := fileSubs.add(subId, sub); err != nil {
+		return nil, err
+	}
+	impl.Log("[filesubscribe] route %q subscribed to %q (sub %s)\n", source, data.Path, subId)
+	return &wshrpc.CommandFileSubscribeRtnData{SubId: subId, Dir: wavebase.ReplaceHomeDir(dir)}, nil
+}
+
+// only the route that subscribed may unsubscribe
+func (impl *ServerImpl) FileUnsubscribeCommand(ctx context.Context, data wshrpc.CommandFileUnsubscribeData) error {
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	fileSubs.lock.Lock()
+	sub := fileSubs.subs[data.SubId]
+	if sub == nil || sub.Route != source {
+		fileSubs.lock.Unlock()
+		return fmt.Errorf("no file subscription %q", data.SubId)
+	}
+	fileSubs.removeLocked(data.SubId)
+	fileSubs.lock.Unlock()
+	impl.Log("[filesubscribe] route %q unsubscribed (sub %s)\n", source, data.SubId)
+	return nil
+}
@@ -0,0 +1,268 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const MaxFileTailFollowsPerRoute = 8
+const MaxFileTailBytes = 1024 * 1024 // cap on the initial tail (lines or bytes)
+const DefaultFileTailLines = 10
+const fileTailPollInterval = 500 * time.Millisecond
+const fileTailChunkSize = 64 * 1024
+
+var fileTailLock = &sync.Mutex{}
+var fileTailCounts = make(map[string]int) // source route => active follows
+
+func acquireFileTail(source string) error {
+	fileTailLock.Lock()
+	defer fileTailLock.Unlock()
+	if fileTailCounts[source] >= MaxFileTailFollowsPerRoute {
+		return fmt.Errorf("too many file tail follows for route %q (max %d)", source, MaxFileTailFollowsPerRoute)
+	}
+	fileTailCounts[source]++
+	return nil
+}
+
+func releaseFileTail(source string) {
+	fileTailLock.Lock()
+	defer fileTailLock.Unlock()
+	fileTailCounts[source]--
+	if fileTailCounts[source] <= 0 {
+		delete(fileTailCounts, source)
+	}
+}
+
+func fileTailErr(err error) wshrpc.RespOrErrorUnion[wshrpc.FileTailData] {
+	return wshrpc.RespOrErrorUnion[wshrpc.FileTailData]{Error: err}
+}
+
+// drops the error if the request is already done (nobody is reading the stream)
+func sendFileTailErr(ctx context.Context, ch chan wshrpc.RespOrErrorUnion[wshrpc.FileTailData], err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	select {
+	case ch <- fileTailErr(err):
+	case <-ctx.Done():
+	}
+}
+
+// returns the offset where the last numLines lines of the file start (a trailing newline does not
+// start a new line).  never goes back more than MaxFileTailBytes.
+func findTailLinesOffset(fd *os.File, size int64, numLines int) (int64, error) {
+	minOffset := max(size-MaxFileTailBytes, 0)
+	buf := make([]byte, fileTailChunkSize)
+	pos := size
+	newlines := 0
+	skipLast := true
+	for pos > minOffset {
+		readLen := min(int64(len(buf)), pos-minOffset)
+		pos -= readLen
+		chunk := buf[:readLen]
+		if _, err := fd.ReadAt(chunk, pos); err != nil && err != io.EOF {
+			return 0, err
+		}
+		for idx := len(chunk) - 1; idx >= 0; idx-- {
+			if chunk[idx] != '\n' {
+				skipLast = false
+				continue
+			}
+			if skipLast {
+				skipLast = false
+				continue
+			}
+			newlines++
+			if newlines == numLines {
+				return pos + int64(idx) + 1, nil
+			}
+		}
+	}
+	return minOffset, nil
+}
+
+// reads [offset, endOffset) and sends it in chunks, returns the new offset
+func (impl *ServerImpl) sendFileTailRange(ctx context.Context, ch chan wshrpc.RespOrErrorUnion[wshrpc.FileTailData], fd *os.File, offset int64, endOffset int64, first wshrpc.FileTailData) (int64, error) {
+	buf := make([]byte, fileTailChunkSize)
+	for {
+		readLen := min(int64(len(buf)), endOffset-offset)
+		var chunk []byte
+		if readLen > 0 {
+			n, err := fd.ReadAt(buf[:readLen], offset)
+			if err != nil && err != io.EOF {
+				return offset, err
+			}
+			chunk = buf[:n]
+			offset += int64(n)
+		}
+		resp := first
+		first = wshrpc.FileTailData{}
+		resp.Data64 = base64.StdEncoding.EncodeToString(chunk)
+		resp.Offset = offset
+		if len(chunk) > 0 || resp.Rotated || resp.Truncated {
+			select {
+			case ch <- wshrpc.RespOrErrorUnion[wshrpc.FileTailData]{Response: resp}:
+			case <-ctx.Done():
+				return offset, ctx.Err()
+			}
+		}
+		if len(chunk) == 0 || offset >= endOffset {
+			return offset, nil
+		}
+	}
+}
+
+func (impl *ServerImpl) FileTailCommand(ctx context.Context, data wshrpc.CommandFileTailData) chan wshrpc.RespOrErrorUnion[wshrpc.FileTailData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.FileTailData], 16)
+	sendErr := func(err error) chan wshrpc.RespOrErrorUnion[wshrpc.FileTailData] {
+		ch <- fileTailErr(err)
+		close(ch)
+		return ch
+	}
+	if data.Lines < 0 || data.Bytes < 0 {
+		return sendErr(errors.New("lines and bytes cannot be negative"))
+	}
+	if data.Lines > 0 && data.Bytes > 0 {
+		return sendErr(errors.New("cannot set both lines and bytes"))
+	}
+	path, err := impl.resolveRoutePath(ctx, data.Path)
+	if err != nil {
+		return sendErr(err)
+	}
+	fd, err := os.Open(path)
+	if err != nil {
+		return sendErr(fmt.Errorf("cannot open %q: %w", data.Path, err))
+	}
+	finfo, err := fd.Stat()
+	if err == nil && !finfo.Mode().IsRegular() {
+		err = fmt.Errorf("not a regular file")
+	}
+	if err != nil {
+		fd.Close()
+		return sendErr(fmt.Errorf("cannot tail %q: %w", data.Path, err))
+	}
+	var startOffset int64
+	if data.Bytes > 0 {
+		startOffset = max(finfo.Size()-min(data.Bytes, MaxFileTailBytes), 0)
+	} else {
+		numLines := data.Lines
+		if numLines == 0 {
+			numLines = DefaultFileTailLines
+		}
+		startOffset, err = findTailLinesOffset(fd, finfo.Size(), numLines)
+		if err != nil {
+			fd.Close()
+			return sendErr(fmt.Errorf("cannot read %q: %w", data.Path, err))
+		}
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	if data.Follow {
+		if err := acquireFileTail(source); err != nil {
+			fd.Close()
+			return sendErr(err)
+		}
+	}
+	// same route tracking as FileWatch, upstream routes are only stopped by the request context
+	localRoute := impl.Router != nil && impl.Router.IsLocalRoute(source)
+	go func() {
+		defer panichandler.PanicHandler("FileTailCommand")
+		defer func() {
+			fd.Close()
+			if data.Follow {
+				releaseFileTail(source)
+				impl.Log("[filetail] stopped following %q for route %q\n", path, source)
+			}
+			close(ch)
+		}()
+		// the initial tail is always sent, even if empty
+		initial := wshrpc.FileTailData{Offset: finfo.Size()}
+		if startOffset < finfo.Size() {
+			offset, err := impl.sendFileTailRange(ctx, ch, fd, startOffset, finfo.Size(), wshrpc.FileTailData{})
+			if err != nil {
+				sendFileTailErr(ctx, ch, fmt.Errorf("cannot read %q: %w", data.Path, err))
+				return
+			}
+			initial.Offset = offset
+		} else {
+			select {
+			case ch <- wshrpc.RespOrErrorUnion[wshrpc.FileTailData]{Response: initial}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if !data.Follow {
+			return
+		}
+		impl.Log("[filetail] following %q for route %q\n", path, source)
+		offset := initial.Offset
+		curInfo := finfo
+		ticker := time.NewTicker(fileTailPollInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if localRoute && !impl.Router.IsLocalRoute(source) {
+				return
+			}
+			var next wshrpc.FileTailData
+			pathInfo, statErr := os.Stat(path)
+			if statErr == nil && !os.SameFile(curInfo, pathInfo) {
+				// rotated: finish what was appended to the old file, then switch to the new one
+				if oldInfo, err := fd.Stat(); err == nil && oldInfo.Size() > offset {
+					offset, err = impl.sendFileTailRange(ctx, ch, fd, offset, oldInfo.Size(), wshrpc.FileTailData{})
+					if err != nil && ctx.Err() != nil {
+						return
+					}
+				}
+				newFd, err := os.Open(path)
+				if err != nil {
+					// can race with the rotation, retried on the next tick
+					continue
+				}
+				fd.Close()
+				fd = newFd
+				if newInfo, err := fd.Stat(); err == nil {
+					pathInfo = newInfo
+				}
+				curInfo = pathInfo
+				offset = 0
+				next.Rotated = true
+			}
+			// a missing path (mid-rotation) keeps reading the old file until a new one shows up
+			sizeInfo, err := fd.Stat()
+			if err != nil {
+				sendFileTailErr(ctx, ch, fmt.Errorf("cannot stat %q: %w", data.Path, err))
+				return
+			}
+			if sizeInfo.Size() < offset {
+				offset = 0
+				next.Truncated = true
+			}
+			if sizeInfo.Size() == offset && !next.Rotated && !next.Truncated {
+				continue
+			}
+			offset, err = impl.sendFileTailRange(ctx, ch, fd, offset, sizeInfo.Size(), next)
+			if err != nil {
+				sendFileTailErr(ctx, ch, fmt.Errorf("cannot read %q: %w", data.Path, err))
+				return
+			}
+		}
+	}()
+	return ch
+}
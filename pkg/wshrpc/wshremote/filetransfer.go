@@ -0,0 +1,328 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const DefaultTransferChunkSize = 64 * 1024
+const MaxTransferChunkSize = 1024 * 1024
+const TransferPartSuffix = ".wavepart"
+const transferProgressInterval = time.Second
+const transferProgressExpiry = 10 * time.Minute // abandoned uploads are forgotten after this
+
+// resume tokens are stateless, they carry the resolved path and what the file looked like when the
+// transfer started (the path is resolved again on every use, so a token can't escape the root dir)
+type transferToken struct {
+	Dir     string `json:"d"`
+	Path    string `json:"p"`
+	Size    int64  `json:"s"`
+	ModTime int64  `json:"m,omitempty"` // unix ns, reads only
+}
+
+func (t transferToken) String() string {
+	barr, _ := json.Marshal(t)
+	return base64.RawURLEncoding.EncodeToString(barr)
+}
+
+func parseTransferToken(tokenStr string, dir string) (*transferToken, error) {
+	barr, err := base64.RawURLEncoding.DecodeString(tokenStr)
+	var token transferToken
+	if err == nil {
+		err = json.Unmarshal(barr, &token)
+	}
+	if err != nil || token.Dir != dir || token.Path == "" {
+		return nil, fmt.Errorf("invalid %s resume token", dir)
+	}
+	return &token, nil
+}
+
+var transferLock = &sync.Mutex{}
+var transferLastProgress = make(map[string]time.Time) // resume token => last progress event
+
+// rate limited per token, done (or failed) transfers always publish
+func publishTransferProgress(progress wshrpc.FileTransferProgressData) {
+	now := time.Now()
+	final := progress.Done || progress.Error != ""
+	transferLock.Lock()
+	for token, ts := range transferLastProgress {
+		if now.Sub(ts) > transferProgressExpiry {
+			delete(transferLastProgress, token)
+		}
+	}
+	lastTs, ok := transferLastProgress[progress.ResumeToken]
+	if !final && ok && now.Sub(lastTs) < transferProgressInterval {
+		transferLock.Unlock()
+		return
+	}
+	if final {
+		delete(transferLastProgress, progress.ResumeToken)
+	} else {
+		transferLastProgress[progress.ResumeToken] = now
+	}
+	transferLock.Unlock()
+	switch {
+	case progress.Error != "":
+		PublishServerEvent(ServerEvent_Transfer, progress, "%s %q failed at %d/%d bytes: %s", progress.Dir, progress.Path, progress.Offset, progress.Size, progress.Error)
+	case progress.Done:
+		PublishServerEvent(ServerEvent_Transfer, progress, "%s %q done (%d bytes)", progress.Dir, progress.Path, progress.Size)
+	default:
+		PublishServerEvent(ServerEvent_Transfer, progress, "%s %q %d/%d bytes", progress.Dir, progress.Path, progress.Offset, progress.Size)
+	}
+}
+
+func checkChunkChecksum(data []byte, checksum string) error {
+	if checksum == "" {
+		return nil
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != checksum {
+		return errors.New("chunk checksum mismatch")
+	}
+	return nil
+}
+
+func transferChunkErr(err error) wshrpc.RespOrErrorUnion[wshrpc.FileTransferChunkData] {
+	return wshrpc.RespOrErrorUnion[wshrpc.FileTransferChunkData]{Error: err}
+}
+
+func (impl *ServerImpl) FileTransferReadCommand(ctx context.Context, data wshrpc.CommandFileTransferReadData) chan wshrpc.RespOrErrorUnion[wshrpc.FileTransferChunkData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.FileTransferChunkData], 16)
+	go func() {
+		defer close(ch)
+		if err := impl.fileTransferRead(ctx, data, ch); err != nil {
+			select {
+			case ch <- transferChunkErr(err):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return ch
+}
+
+func (impl *ServerImpl) fileTransferRead(ctx context.Context, data wshrpc.CommandFileTransferReadData, ch chan wshrpc.RespOrErrorUnion[wshrpc.FileTransferChunkData]) error {
+	chunkSize := data.ChunkSize
+	if chunkSize == 0 {
+		chunkSize = DefaultTransferChunkSize
+	}
+	if chunkSize < 0 || chunkSize > MaxTransferChunkSize {
+		return fmt.Errorf("invalid chunk size %d (max %d)", data.ChunkSize, MaxTransferChunkSize)
+	}
+	pathArg := data.Path
+	var token *transferToken
+	if data.ResumeToken != "" {
+		var err error
+		token, err = parseTransferToken(data.ResumeToken, wshrpc.FileTransferDir_Read)
+		if err != nil {
+			return err
+		}
+		pathArg = token.Path
+	} else if data.Offset != 0 {
+		return errors.New("offset requires a resume token")
+	}
+	path, err := impl.resolveRoutePath(ctx, pathArg)
+	if err != nil {
+		return err
+	}
+	// checked before opening, opening a fifo would block
+	finfo, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("cannot stat file %q: %w", path, err)
+	}
+	if !finfo.Mode().IsRegular() {
+		return fmt.Errorf("%q is not a regular file", path)
+	}
+	if token == nil {
+		token = &transferToken{Dir: wshrpc.FileTransferDir_Read, Path: path, Size: finfo.Size(), ModTime: finfo.ModTime().UnixNano()}
+	} else if token.Size != finfo.Size() || token.ModTime != finfo.ModTime().UnixNano() {
+		return fmt.Errorf("cannot resume reading %q: file changed since the interrupted transfer", path)
+	}
+	if data.Offset < 0 || data.Offset > token.Size {
+		return fmt.Errorf("invalid offset %d (file is %d bytes)", data.Offset, token.Size)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("cannot open file %q: %w", path, err)
+	}
+	defer file.Close()
+	tokenStr := token.String()
+	progress := wshrpc.FileTransferProgressData{ResumeToken: tokenStr, Dir: wshrpc.FileTransferDir_Read, Path: path, Offset: data.Offset, Size: token.Size}
+	sendFn := func(chunk wshrpc.FileTransferChunkData) error {
+		select {
+		case ch <- wshrpc.RespOrErrorUnion[wshrpc.FileTransferChunkData]{Response: chunk}:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	failFn := func(err error) error {
+		progress.Error = err.Error()
+		publishTransferProgress(progress)
+		return err
+	}
+	if err := sendFn(wshrpc.FileTransferChunkData{ResumeToken: tokenStr, Size: token.Size, Offset: data.Offset}); err != nil {
+		return err
+	}
+	// the file checksum covers the part sent before the interruption too
+	hasher := sha256.New()
+	if data.Offset > 0 {
+		if _, err := io.CopyN(hasher, &ctxReader{Ctx: ctx, Reader: file}, data.Offset); err != nil {
+			return failFn(fmt.Errorf("error reading file %q: %w", path, err))
+		}
+	}
+	buf := make([]byte, chunkSize)
+	offset := data.Offset
+	for offset < token.Size {
+		if err := ctx.Err(); err != nil {
+			return failFn(err)
+		}
+		n, err := io.ReadFull(file, buf[:min(int64(chunkSize), token.Size-offset)])
+		if err != nil {
+			return failFn(fmt.Errorf("error reading file %q at offset %d: %w", path, offset, err))
+		}
+		hasher.Write(buf[:n])
+		sum := sha256.Sum256(buf[:n])
+		chunk := wshrpc.FileTransferChunkData{Offset: offset, Data64: base64.StdEncoding.EncodeToString(buf[:n]), Checksum: hex.EncodeToString(sum[:])}
+		if err := sendFn(chunk); err != nil {
+			return failFn(err)
+		}
+		offset += int64(n)
+		progress.Offset = offset
+		publishTransferProgress(progress)
+	}
+	progress.Done = true
+	publishTransferProgress(progress)
+	return sendFn(wshrpc.FileTransferChunkData{Offset: offset, Done: true, FileChecksum: hex.EncodeToString(hasher.Sum(nil))})
+}
+
+func (impl *ServerImpl) FileTransferWriteCommand(ctx context.Context, data wshrpc.CommandFileTransferWriteData) (*wshrpc.FileTransferWriteRtnData, error) {
+	if err := impl.checkWritable(data.Path); err != nil {
+		return nil, err
+	}
+	var token *transferToken
+	pathArg := data.Path
+	if data.ResumeToken != "" {
+		var err error
+		token, err = parseTransferToken(data.ResumeToken, wshrpc.FileTransferDir_Write)
+		if err != nil {
+			return nil, err
+		}
+		pathArg = token.Path
+	} else if data.Offset != 0 {
+		return nil, errors.New("offset requires a resume token")
+	} else if data.Size < 0 {
+		return nil, fmt.Errorf("invalid size %d", data.Size)
+	}
+	path, err := impl.resolveRoutePath(ctx, pathArg)
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		token = &transferToken{Dir: wshrpc.FileTransferDir_Write, Path: path, Size: data.Size}
+	}
+	tokenStr := token.String()
+	partPath := path + TransferPartSuffix
+	// opened (and created) itself, a dangling symlink in its place must not take the write outside of the root dir
+	if _, err := impl.resolvePath(partPath); err != nil {
+		return nil, err
+	}
+	progress := wshrpc.FileTransferProgressData{ResumeToken: tokenStr, Dir: wshrpc.FileTransferDir_Write, Path: path, Offset: data.Offset, Size: token.Size}
+	failFn := func(err error) (*wshrpc.FileTransferWriteRtnData, error) {
+		progress.Error = err.Error()
+		publishTransferProgress(progress)
+		return nil, err
+	}
+	var file *os.File
+	if data.ResumeToken == "" {
+		createMode := data.CreateMode
+		if createMode == 0 {
+			createMode = 0644
+		}
+		file, err = os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, createMode)
+	} else {
+		file, err = os.OpenFile(partPath, os.O_WRONLY, 0)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("cannot open partial file %q: %w", partPath, err)
+	}
+	defer file.Close()
+	finfo, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat partial file %q: %w", partPath, err)
+	}
+	committed := finfo.Size()
+	if data.Data64 == "" && !data.Final {
+		return &wshrpc.FileTransferWriteRtnData{ResumeToken: tokenStr, Offset: committed}, nil
+	}
+	if data.Offset < 0 || data.Offset > committed {
+		return nil, fmt.Errorf("invalid offset %d (%d bytes committed)", data.Offset, committed)
+	}
+	chunk, err := base64.StdEncoding.DecodeString(data.Data64)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode base64 data: %w", err)
+	}
+	if err := checkChunkChecksum(chunk, data.Checksum); err != nil {
+		return failFn(fmt.Errorf("chunk at offset %d: %w", data.Offset, err))
+	}
+	if data.Offset+int64(len(chunk)) > token.Size {
+		return failFn(fmt.Errorf("chunk at offset %d is past the end of the file (%d bytes)", data.Offset, token.Size))
+	}
+	if data.Offset < committed {
+		// a chunk sent again after an interruption
+		if err := file.Truncate(data.Offset); err != nil {
+			return failFn(fmt.Errorf("cannot truncate partial file %q: %w", partPath, err))
+		}
+	}
+	if _, err := file.WriteAt(chunk, data.Offset); err != nil {
+		return failFn(fmt.Errorf("cannot write partial file %q: %w", partPath, err))
+	}
+	committed = data.Offset + int64(len(chunk))
+	progress.Offset = committed
+	rtn := &wshrpc.FileTransferWriteRtnData{ResumeToken: tokenStr, Offset: committed}
+	if !data.Final {
+		publishTransferProgress(progress)
+		return rtn, nil
+	}
+	if committed != token.Size {
+		return failFn(fmt.Errorf("final chunk ends at %d, file is %d bytes", committed, token.Size))
+	}
+	if data.FileChecksum != "" {
+		hasher := sha256.New()
+		readFile, err := os.Open(partPath)
+		if err != nil {
+			return failFn(fmt.Errorf("cannot read partial file %q: %w", partPath, err))
+		}
+		_, err = io.Copy(hasher, &ctxReader{Ctx: ctx, Reader: readFile})
+		readFile.Close()
+		if err != nil {
+			return failFn(fmt.Errorf("cannot read partial file %q: %w", partPath, err))
+		}
+		if hex.EncodeToString(hasher.Sum(nil)) != data.FileChecksum {
+			return failFn(errors.New("file checksum mismatch"))
+		}
+	}
+	if err := file.Close(); err != nil {
+		return failFn(fmt.Errorf("cannot write partial file %q: %w", partPath, err))
+	}
+	if err := os.Rename(partPath, path); err != nil {
+		return failFn(fmt.Errorf("cannot rename %q to %q: %w", partPath, path, err))
+	}
+	progress.Done = true
+	publishTransferProgress(progress)
+	rtn.Done = true
+	return rtn, nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const MaxFileWatchesPerRoute = 16
+const fileWatchRouteCheckInterval = 1 * time.Second
+
+var fileWatchLock = &sync.Mutex{}
+var fileWatchCounts = make(map[string]int) // source route => active watches
+
+func acquireFileWatch(source string) error {
+	fileWatchLock.Lock()
+	defer fileWatchLock.Unlock()
+	if fileWatchCounts[source] >= MaxFileWatchesPerRoute {
+		return fmt.Errorf("too many file watches for route %q (max %d)", source, MaxFileWatchesPerRoute)
+	}
+	fileWatchCounts[source]++
+	return nil
+}
+
+func releaseFileWatch(source string) {
+	fileWatchLock.Lock()
+	defer fileWatchLock.Unlock()
+	fileWatchCounts[source]--
+	if fileWatchCounts[source] <= 0 {
+		delete(fileWatchCounts, source)
+	}
+}
+
+// a single fsnotify event can have multiple ops set, they are reported separately
+func fsnotifyOpsToFileWatchOps(op fsnotify.Op) []string {
+	var rtn []string
+	if op.Has(fsnotify.Create) {
+		rtn = append(rtn, wshrpc.FileWatchOp_Create)
+	}
+	if op.Has(fsnotify.Write) {
+		rtn = append(rtn, wshrpc.FileWatchOp_Modify)
+	}
+	if op.Has(fsnotify.Remove) {
+		rtn = append(rtn, wshrpc.FileWatchOp_Delete)
+	}
+	if op.Has(fsnotify.Rename) {
+		rtn = append(rtn, wshrpc.FileWatchOp_Rename)
+	}
+	return rtn
+}
+
+func fileWatchErr(err error) wshrpc.RespOrErrorUnion[wshrpc.FileWatchEventData] {
+	return wshrpc.RespOrErrorUnion[wshrpc.FileWatchEventData]{Error: err}
+}
+
+func (impl *ServerImpl) FileWatchCommand(ctx context.Context, data wshrpc.CommandFileWatchData) chan wshrpc.RespOrErrorUnion[wshrpc.FileWatchEventData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.FileWatchEventData], 16)
+	path, err := impl.resolveRoutePath(ctx, data.Path)
+	if err != nil {
+		ch <- fileWatchErr(err)
+		close(ch)
+		return ch
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	if err := acquireFileWatch(source); err != nil {
+		ch <- fileWatchErr(err)
+		close(ch)
+		return ch
+	}
+	watcher, err := fsnotify.NewWatcher()
+	if err == nil {
+		err = watcher.Add(path)
+		if err != nil {
+			watcher.Close()
+		}
+	}
+	if err != nil {
+		releaseFileWatch(source)
+		ch <- fileWatchErr(fmt.Errorf("cannot watch %q: %w", data.Path, err))
+		close(ch)
+		return ch
+	}
+	// routes connected directly to this router are torn down when they unregister (the request
+	// context only ends on timeout or cancel).  routes coming through the upstream can't be tracked here.
+	localRoute := impl.Router != nil && impl.Router.IsLocalRoute(source)
+	impl.Log("[filewatch] watching %q for route %q\n", path, source)
+	go func() {
+		defer panichandler.PanicHandler("FileWatchCommand")
+		defer func() {
+			watcher.Close()
+			releaseFileWatch(source)
+			close(ch)
+			impl.Log("[filewatch] stopped watching %q for route %q\n", path, source)
+		}()
+		routeTicker := time.NewTicker(fileWatchRouteCheckInterval)
+		defer routeTicker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-routeTicker.C:
+				if localRoute && !impl.Router.IsLocalRoute(source) {
+					return
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Printf("filewatch error %q: %v\n", path, err)
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				for _, op := range fsnotifyOpsToFileWatchOps(event.Op) {
+					resp := wshrpc.FileWatchEventData{Ts: time.Now().UnixMilli(), Path: wavebase.ReplaceHomeDir(event.Name), Op: op}
+					select {
+					case ch <- wshrpc.RespOrErrorUnion[wshrpc.FileWatchEventData]{Response: resp}:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}
+		}
+	}()
+	return ch
+}
@@ -0,0 +1,407 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const MaxForwardsPerRoute = 16
+const MaxForwardConns = 64 // open connections per listen forward
+const forwardReadBufSize = 32 * 1024
+const forwardDialTimeout = 10 * time.Second
+const forwardWriteTimeout = 30 * time.Second
+
+type forwardConn struct {
+	conn     net.Conn
+	done     chan struct{} // closed by closeConn
+	closing  bool          // closeConn was called, the read error is expected
+	readEof  bool          // the server side sent eof
+	writeEof bool          // the client sent eof
+}
+
+type forwardSession struct {
+	Source     string
+	Mode       string
+	Addr       string
+	CancelFn   context.CancelFunc // closes the listener and every connection
+	Lock       *sync.Mutex
+	Conns      map[string]*forwardConn // connid => conn
+	NextConnId int
+}
+
+var forwardLock = &sync.Mutex{}
+var forwardSessions = make(map[string]*forwardSession) // forwardid => session
+var forwardCounts = make(map[string]int)               // source route => active forwards
+
+func registerForwardSession(forwardId string, session *forwardSession) error {
+	forwardLock.Lock()
+	defer forwardLock.Unlock()
+	if forwardCounts[session.Source] >= MaxForwardsPerRoute {
+		return fmt.Errorf("too many forwards for route %q (max %d)", session.Source, MaxForwardsPerRoute)
+	}
+	forwardCounts[session.Source]++
+	forwardSessions[forwardId] = session
+	return nil
+}
+
+func unregisterForwardSession(forwardId string) {
+	forwardLock.Lock()
+	defer forwardLock.Unlock()
+	session := forwardSessions[forwardId]
+	if session == nil {
+		return
+	}
+	delete(forwardSessions, forwardId)
+	forwardCounts[session.Source]--
+	if forwardCounts[session.Source] <= 0 {
+		delete(forwardCounts, session.Source)
+	}
+}
+
+// only the route that started the forward can use it
+func getForwardSession(ctx context.Context, forwardId string) (*forwardSession, error) {
+	forwardLock.Lock()
+	defer forwardLock.Unlock()
+	session := forwardSessions[forwardId]
+	if session == nil || session.Source != wshutil.GetRpcSourceFromContext(ctx) {
+		return nil, fmt.Errorf("no forward %q", forwardId)
+	}
+	return session, nil
+}
+
+// returns "" if the forward already has MaxForwardConns connections
+func (session *forwardSession) addConn(conn net.Conn) (string, *forwardConn) {
+	session.Lock.Lock()
+	defer session.Lock.Unlock()
+	if len(session.Conns) >= MaxForwardConns {
+		return "", nil
+	}
+	session.NextConnId++
+	connId := strconv.Itoa(session.NextConnId)
+	fc := &forwardConn{conn: conn, done: make(chan struct{})}
+	session.Conns[connId] = fc
+	return connId, fc
+}
+
+func (session *forwardSession) getConn(connId string) *forwardConn {
+	session.Lock.Lock()
+	defer session.Lock.Unlock()
+	return session.Conns[connId]
+}
+
+func (session *forwardSession) closeConn(connId string) {
+	session.Lock.Lock()
+	defer session.Lock.Unlock()
+	fc := session.Conns[connId]
+	if fc == nil {
+		return
+	}
+	delete(session.Conns, connId)
+	fc.closing = true
+	fc.conn.Close()
+	close(fc.done)
+}
+
+func (session *forwardSession) closeAllConns() {
+	session.Lock.Lock()
+	connIds := make([]string, 0, len(session.Conns))
+	for connId := range session.Conns {
+		connIds = append(connIds, connId)
+	}
+	session.Lock.Unlock()
+	for _, connId := range connIds {
+		session.closeConn(connId)
+	}
+}
+
+// marks one direction done, the connection is closed once both are
+func (session *forwardSession) setConnEof(connId string, readSide bool) {
+	session.Lock.Lock()
+	fc := session.Conns[connId]
+	if fc == nil {
+		session.Lock.Unlock()
+		return
+	}
+	if readSide {
+		fc.readEof = true
+	} else {
+		fc.writeEof = true
+	}
+	bothDone := fc.readEof && fc.writeEof
+	session.Lock.Unlock()
+	if bothDone {
+		session.closeConn(connId)
+	}
+}
+
+// streams the connection until it is closed, the last packet sent is Closed
+func (session *forwardSession) runConn(connId string, fc *forwardConn, sendFn func(wshrpc.ForwardPacketData)) {
+	defer panichandler.PanicHandler("ForwardCommand:conn")
+	buf := make([]byte, forwardReadBufSize)
+	var readErr error
+	for {
+		n, err := fc.conn.Read(buf)
+		if n > 0 {
+			sendFn(wshrpc.ForwardPacketData{ConnId: connId, Data64: base64.StdEncoding.EncodeToString(buf[:n])})
+		}
+		if err != nil {
+			readErr = err
+			break
+		}
+	}
+	if errors.Is(readErr, io.EOF) {
+		sendFn(wshrpc.ForwardPacketData{ConnId: connId, Eof: true})
+		session.setConnEof(connId, true)
+		// the client may still be writing
+		<-fc.done
+	}
+	session.Lock.Lock()
+	closing := fc.closing
+	session.Lock.Unlock()
+	session.closeConn(connId)
+	closed := wshrpc.ForwardPacketData{ConnId: connId, Closed: true}
+	if !closing && !errors.Is(readErr, io.EOF) {
+		closed.Error = readErr.Error()
+	}
+	sendFn(closed)
+}
+
+func forwardErr(err error) wshrpc.RespOrErrorUnion[wshrpc.ForwardPacketData] {
+	return wshrpc.RespOrErrorUnion[wshrpc.ForwardPacketData]{Error: err}
+}
+
+// remote forwards are only reachable from the server's host
+func checkForwardListenAddr(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return fmt.Errorf("invalid listen address %q: %w", addr, err)
+	}
+	if host == "localhost" {
+		return nil
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsLoopback() {
+		return fmt.Errorf("invalid listen address %q: forwards can only listen on a loopback address", addr)
+	}
+	return nil
+}
+
+func (impl *ServerImpl) ForwardStartCommand(ctx context.Context, data wshrpc.CommandForwardStartData) chan wshrpc.RespOrErrorUnion[wshrpc.ForwardPacketData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.ForwardPacketData], 16)
+	if impl.RootDir != "" {
+		// a forward reaches outside of the root dir just like exec does
+		ch <- forwardErr(fmt.Errorf("%w: port forwarding is not allowed on a server with a root dir", fs.ErrPermission))
+		close(ch)
+		return ch
+	}
+	// a tunnel to a local service is as open-ended as exec
+	if err := impl.checkWritable(data.Addr); err != nil {
+		ch <- forwardErr(err)
+		close(ch)
+		return ch
+	}
+	switch data.Mode {
+	case wshrpc.ForwardMode_Dial:
+		if _, _, err := net.SplitHostPort(data.Addr); err != nil {
+			ch <- forwardErr(fmt.Errorf("invalid address %q: %w", data.Addr, err))
+			close(ch)
+			return ch
+		}
+	case wshrpc.ForwardMode_Listen:
+		if err := checkForwardListenAddr(data.Addr); err != nil {
+			ch <- forwardErr(err)
+			close(ch)
+			return ch
+		}
+	default:
+		ch <- forwardErr(fmt.Errorf("invalid forward mode %q (must be %q or %q)", data.Mode, wshrpc.ForwardMode_Dial, wshrpc.ForwardMode_Listen))
+		close(ch)
+		return ch
+	}
+	fwdCtx, cancelFn := context.WithCancel(ctx)
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	forwardId := uuid.New().String()
+	session := &forwardSession{
+		Source:   source,
+		Mode:     data.Mode,
+		Addr:     data.Addr,
+		CancelFn: cancelFn,
+		Lock:     &sync.Mutex{},
+		Conns:    make(map[string]*forwardConn),
+	}
+	if err := registerForwardSession(forwardId, session); err != nil {
+		cancelFn()
+		ch <- forwardErr(err)
+		close(ch)
+		return ch
+	}
+	var dialConn net.Conn
+	var listener net.Listener
+	var resolvedAddr string
+	if data.Mode == wshrpc.ForwardMode_Dial {
+		dialer := &net.Dialer{Timeout: forwardDialTimeout}
+		conn, err := dialer.DialContext(fwdCtx, "tcp", data.Addr)
+		if err != nil {
+			unregisterForwardSession(forwardId)
+			cancelFn()
+			ch <- forwardErr(fmt.Errorf("cannot connect to %q: %w", data.Addr, err))
+			close(ch)
+			return ch
+		}
+		dialConn = conn
+		resolvedAddr = conn.RemoteAddr().String()
+	} else {
+		var listenConfig net.ListenConfig
+		l, err := listenConfig.Listen(fwdCtx, "tcp", data.Addr)
+		if err != nil {
+			unregisterForwardSession(forwardId)
+			cancelFn()
+			ch <- forwardErr(fmt.Errorf("cannot listen on %q: %w", data.Addr, err))
+			close(ch)
+			return ch
+		}
+		listener = l
+		resolvedAddr = l.Addr().String()
+	}
+	impl.Log("[forward] %s %q (%s) for route %q\n", data.Mode, data.Addr, resolvedAddr, source)
+	ch <- wshrpc.RespOrErrorUnion[wshrpc.ForwardPacketData]{Response: wshrpc.ForwardPacketData{ForwardId: forwardId, Addr: resolvedAddr}}
+	sendFn := func(resp wshrpc.ForwardPacketData) {
+		select {
+		case ch <- wshrpc.RespOrErrorUnion[wshrpc.ForwardPacketData]{Response: resp}:
+		case <-ctx.Done():
+		}
+	}
+	// like FileWatch, local routes lose their forwards when they disconnect
+	localRoute := impl.Router != nil && impl.Router.IsLocalRoute(source)
+	go func() {
+		defer panichandler.PanicHandler("ForwardCommand:routecheck")
+		ticker := time.NewTicker(fileWatchRouteCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-fwdCtx.Done():
+				return
+			case <-ticker.C:
+				if localRoute && !impl.Router.IsLocalRoute(source) {
+					cancelFn()
+					return
+				}
+			}
+		}
+	}()
+	go func() {
+		defer panichandler.PanicHandler("ForwardCommand:cancel")
+		<-fwdCtx.Done()
+		if listener != nil {
+			listener.Close()
+		}
+		session.closeAllConns()
+	}()
+	go func() {
+		defer panichandler.PanicHandler("ForwardCommand")
+		var connWg sync.WaitGroup
+		defer func() {
+			cancelFn()
+			// every connection sends its Closed packet before the stream ends
+			connWg.Wait()
+			unregisterForwardSession(forwardId)
+			impl.Log("[forward] %s %q stopped\n", data.Mode, data.Addr)
+			close(ch)
+		}()
+		if dialConn != nil {
+			connId, fc := session.addConn(dialConn)
+			sendFn(wshrpc.ForwardPacketData{ConnId: connId, Opened: true, PeerAddr: resolvedAddr})
+			connWg.Add(1)
+			func() {
+				defer connWg.Done()
+				session.runConn(connId, fc, sendFn)
+			}()
+			return
+		}
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				if fwdCtx.Err() == nil {
+					select {
+					case ch <- forwardErr(fmt.Errorf("error accepting connection: %w", err)):
+					case <-ctx.Done():
+					}
+				}
+				return
+			}
+			connId, fc := session.addConn(conn)
+			if fc == nil {
+				impl.Log("[forward] dropping connection from %s, forward %q has %d connections\n", conn.RemoteAddr(), data.Addr, MaxForwardConns)
+				conn.Close()
+				continue
+			}
+			sendFn(wshrpc.ForwardPacketData{ConnId: connId, Opened: true, PeerAddr: conn.RemoteAddr().String()})
+			connWg.Add(1)
+			go func() {
+				defer connWg.Done()
+				session.runConn(connId, fc, sendFn)
+			}()
+		}
+	}()
+	return ch
+}
+
+// writes are done in order, so the client has to wait for each call before sending the next chunk
+func (impl *ServerImpl) ForwardDataCommand(ctx context.Context, data wshrpc.CommandForwardDataData) error {
+	session, err := getForwardSession(ctx, data.ForwardId)
+	if err != nil {
+		return err
+	}
+	fc := session.getConn(data.ConnId)
+	if fc == nil {
+		return fmt.Errorf("no connection %q on forward %q", data.ConnId, data.ForwardId)
+	}
+	if data.Data64 != "" {
+		barr, err := base64.StdEncoding.DecodeString(data.Data64)
+		if err != nil {
+			return fmt.Errorf("invalid base64 data: %w", err)
+		}
+		fc.conn.SetWriteDeadline(time.Now().Add(forwardWriteTimeout))
+		if _, err := fc.conn.Write(barr); err != nil {
+			session.closeConn(data.ConnId)
+			return fmt.Errorf("error writing to connection: %w", err)
+		}
+	}
+	if data.Close {
+		session.closeConn(data.ConnId)
+		return nil
+	}
+	if data.Eof {
+		if cw, ok := fc.conn.(interface{ CloseWrite() error }); ok {
+			cw.CloseWrite()
+		}
+		session.setConnEof(data.ConnId, false)
+	}
+	return nil
+}
+
+func (impl *ServerImpl) ForwardStopCommand(ctx context.Context, data wshrpc.CommandForwardStopData) error {
+	session, err := getForwardSession(ctx, data.ForwardId)
+	if err != nil {
+		return err
+	}
+	impl.Log("[forward] stopping %s %q (forward %q)\n", session.Mode, session.Addr, data.ForwardId)
+	session.CancelFn()
+	return nil
+}
@@ -0,0 +1,38 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestForwardStart_RefusedWhenReadOnly(t *testing.T) {
+	if err := SetToggle(Toggle_ReadOnly, true); err != nil {
+		t.Fatal(err)
+	}
+	defer SetToggle(Toggle_ReadOnly, false)
+	impl := MakeServerImpl(nil, "")
+	for _, data := range []wshrpc.CommandForwardStartData{
+		{Mode: wshrpc.ForwardMode_Dial, Addr: "127.0.0.1:5432"},
+		{Mode: wshrpc.ForwardMode_Listen, Addr: "127.0.0.1:0"},
+	} {
+		var errs []error
+		for resp := range impl.ForwardStartCommand(context.Background(), data) {
+			errs = append(errs, resp.Error)
+		}
+		if len(errs) != 1 || errs[0] == nil || !strings.Contains(errs[0].Error(), "read-only") {
+			t.Errorf("%s forward on a read-only server: got %v, want the read-only error", data.Mode, errs)
+		}
+	}
+	if reason := commandDisabledReason(wshrpc.Command_ForwardStart, true, true, true, nil, nil); reason != CapabilityReason_ReadOnly {
+		t.Errorf("forwardstart capability reason = %q on a read-only server, want %q", reason, CapabilityReason_ReadOnly)
+	}
+	if reason := commandDisabledReason(wshrpc.Command_ForwardStart, true, false, true, nil, nil); reason != "" {
+		t.Errorf("forwardstart capability reason = %q on a writable server, want enabled", reason)
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// gpu queries can hang on a wedged driver, every probe is bounded by this
+const GpuProbeTimeout = 5 * time.Second
+const MinGpuInfoInterval = time.Second
+const MaxGpuInfoStreamsPerRoute = 4
+
+const (
+	GpuSource_NvidiaSmi = "nvidia-smi"
+	GpuSource_Sysfs     = "sysfs"
+)
+
+const NoGpuMessage = "no GPU detected"
+
+// the order of the fields in the nvidia-smi query (and its csv output)
+var nvidiaSmiQueryFields = []string{"index", "name", "pci.bus_id", "utilization.gpu", "memory.used", "memory.total", "temperature.gpu", "power.draw", "power.limit"}
+
+var gpuStreamLock = &sync.Mutex{}
+var gpuStreamCounts = make(map[string]int) // source route => active streams
+
+func acquireGpuStream(source string) error {
+	gpuStreamLock.Lock()
+	defer gpuStreamLock.Unlock()
+	if gpuStreamCounts[source] >= MaxGpuInfoStreamsPerRoute {
+		return fmt.Errorf("too many gpuinfo streams for route %q (max %d)", source, MaxGpuInfoStreamsPerRoute)
+	}
+	gpuStreamCounts[source]++
+	return nil
+}
+
+func releaseGpuStream(source string) {
+	gpuStreamLock.Lock()
+	defer gpuStreamLock.Unlock()
+	gpuStreamCounts[source]--
+	if gpuStreamCounts[source] <= 0 {
+		delete(gpuStreamCounts, source)
+	}
+}
+
+// "[N/A]" and "[Not Supported]" (and anything else that isn't a number) are unsupported
+func parseNvidiaSmiFloat(val string) (float64, bool) {
+	fval, err := strconv.ParseFloat(strings.TrimSpace(val), 64)
+	if err != nil {
+		return 0, false
+	}
+	return fval, true
+}
+
+// parses `nvidia-smi --query-gpu=<nvidiaSmiQueryFields> --format=csv,noheader,nounits`
+func parseNvidiaSmiOutput(output string) ([]wshrpc.GpuData, error) {
+	var rtn []wshrpc.GpuData
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, ",")
+		if len(fields) != len(nvidiaSmiQueryFields) {
+			return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+		}
+		index, err := strconv.Atoi(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("unexpected nvidia-smi output %q", line)
+		}
+		gpu := wshrpc.GpuData{
+			Index:  index,
+			Name:   strings.TrimSpace(fields[1]),
+			Vendor: "nvidia",
+			BusId:  strings.TrimSpace(fields[2]),
+		}
+		setVal := func(jsonName string, fieldIdx int, setFn func(float64)) {
+			if fval, ok := parseNvidiaSmiFloat(fields[fieldIdx]); ok {
+				setFn(fval)
+			} else {
+				gpu.Unsupported = append(gpu.Unsupported, jsonName)
+			}
+		}
+		setVal("utilpercent", 3, func(v float64) { gpu.UtilPercent = v })
+		setVal("memused", 4, func(v float64) { gpu.MemUsed = uint64(v * 1024 * 1024) }) // MiB
+		setVal("memtotal", 5, func(v float64) { gpu.MemTotal = uint64(v * 1024 * 1024) })
+		setVal("tempc", 6, func(v float64) { gpu.TempC = v })
+		setVal("powerw", 7, func(v float64) { gpu.PowerW = v })
+		if fval, ok := parseNvidiaSmiFloat(fields[8]); ok {
+			gpu.PowerLimitW = fval
+		}
+		rtn = append(rtn, gpu)
+	}
+	return rtn, nil
+}
+
+func probeNvidiaSmi(ctx context.Context, path string) ([]wshrpc.GpuData, error) {
+	probeCtx, cancelFn := context.WithTimeout(ctx, GpuProbeTimeout)
+	defer cancelFn()
+	cmd := exec.CommandContext(probeCtx, path, "--query-gpu="+strings.Join(nvidiaSmiQueryFields, ","), "--format=csv,noheader,nounits")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// a process stuck in the driver may not die on kill, don't wait on its pipes forever
+	cmd.WaitDelay = 500 * time.Millisecond
+	err := cmd.Run()
+	if probeCtx.Err() == context.DeadlineExceeded {
+		return nil, fmt.Errorf("nvidia-smi timed out after %v", GpuProbeTimeout)
+	}
+	if err != nil {
+		// e.g. "NVIDIA-SMI has failed because it couldn't communicate with the NVIDIA driver" (printed to stdout)
+		msg := firstLine(stderr.Bytes())
+		if msg == "" {
+			msg = firstLine(stdout.Bytes())
+		}
+		if msg == "" {
+			msg = err.Error()
+		}
+		return nil, fmt.Errorf("nvidia-smi failed: %s", msg)
+	}
+	return parseNvidiaSmiOutput(stdout.String())
+}
+
+// sysfs reads can block on a bad driver too, and those can't be interrupted, so a timed out read is
+// left behind in its goroutine
+func probeSysfsGpusWithTimeout(ctx context.Context) ([]wshrpc.GpuData, error) {
+	type probeResult struct {
+		gpus []wshrpc.GpuData
+		err  error
+	}
+	resultCh := make(chan probeResult, 1)
+	go func() {
+		defer panichandler.PanicHandler("probeSysfsGpus")
+		gpus, err := probeSysfsGpus()
+		resultCh <- probeResult{gpus, err}
+	}()
+	timer := time.NewTimer(GpuProbeTimeout)
+	defer timer.Stop()
+	select {
+	case result := <-resultCh:
+		return result.gpus, result.err
+	case <-timer.C:
+		return nil, fmt.Errorf("reading gpu sysfs files timed out after %v", GpuProbeTimeout)
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// nvidia-smi is preferred, the sysfs files (amdgpu) are the fallback when it is missing or fails
+func sampleGpus(ctx context.Context) wshrpc.GpuInfoData {
+	rtn := wshrpc.GpuInfoData{Gpus: []wshrpc.GpuData{}}
+	var nvidiaErr error
+	if path, err := exec.LookPath("nvidia-smi"); err == nil {
+		gpus, err := probeNvidiaSmi(ctx, path)
+		if err == nil && len(gpus) > 0 {
+			rtn.Ts = time.Now().UnixMilli()
+			rtn.Source = GpuSource_NvidiaSmi
+			rtn.Gpus = gpus
+			return rtn
+		}
+		nvidiaErr = err
+	}
+	gpus, sysfsErr := probeSysfsGpusWithTimeout(ctx)
+	rtn.Ts = time.Now().UnixMilli()
+	if len(gpus) > 0 {
+		rtn.Source = GpuSource_Sysfs
+		rtn.Gpus = gpus
+		return rtn
+	}
+	if err := errors.Join(nvidiaErr, sysfsErr); err != nil {
+		rtn.Error = err.Error()
+		return rtn
+	}
+	rtn.Message = NoGpuMessage
+	return rtn
+}
+
+func gpuInfoErr(err error) wshrpc.RespOrErrorUnion[wshrpc.GpuInfoData] {
+	return wshrpc.RespOrErrorUnion[wshrpc.GpuInfoData]{Error: err}
+}
+
+func (impl *ServerImpl) GpuInfoCommand(ctx context.Context, data wshrpc.CommandGpuInfoData) chan wshrpc.RespOrErrorUnion[wshrpc.GpuInfoData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.GpuInfoData], 16)
+	if data.IntervalMs < 0 {
+		ch <- gpuInfoErr(fmt.Errorf("invalid intervalms %d", data.IntervalMs))
+		close(ch)
+		return ch
+	}
+	if data.IntervalMs == 0 {
+		go func() {
+			defer panichandler.PanicHandler("GpuInfoCommand")
+			defer close(ch)
+			ch <- wshrpc.RespOrErrorUnion[wshrpc.GpuInfoData]{Response: sampleGpus(ctx)}
+		}()
+		return ch
+	}
+	interval := max(time.Duration(data.IntervalMs)*time.Millisecond, MinGpuInfoInterval)
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	if err := acquireGpuStream(source); err != nil {
+		ch <- gpuInfoErr(err)
+		close(ch)
+		return ch
+	}
+	localRoute := impl.Router != nil && impl.Router.IsLocalRoute(source)
+	impl.Log("[gpuinfo] streaming gpu info to route %q every %v\n", source, interval)
+	go func() {
+		defer panichandler.PanicHandler("GpuInfoCommand")
+		defer func() {
+			releaseGpuStream(source)
+			close(ch)
+			impl.Log("[gpuinfo] stopped streaming gpu info to route %q\n", source)
+		}()
+		streamCtx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+		if localRoute {
+			go func() {
+				defer panichandler.PanicHandler("GpuInfoCommand:routecheck")
+				waitForRouteGone(streamCtx, impl.Router, source)
+				cancelFn()
+			}()
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			resp := sampleGpus(streamCtx)
+			if streamCtx.Err() != nil {
+				return
+			}
+			select {
+			case ch <- wshrpc.RespOrErrorUnion[wshrpc.GpuInfoData]{Response: resp}:
+			case <-streamCtx.Done():
+				return
+			}
+			// nothing will show up later, so there is no point in polling
+			if resp.Message == NoGpuMessage {
+				return
+			}
+			select {
+			case <-streamCtx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return ch
+}
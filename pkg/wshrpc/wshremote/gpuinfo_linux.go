@@ -0,0 +1,134 @@
+//go:build linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const drmClassDir = "/sys/class/drm"
+
+var drmCardRe = regexp.MustCompile(`^card(\d+)$`)
+
+var pciVendorNames = map[string]string{
+	"0x1002": "amd",
+	"0x10de": "nvidia",
+	"0x8086": "intel",
+}
+
+func readSysfsString(path string) (string, bool) {
+	barr, err := os.ReadFile(path)
+	if err != nil {
+		return "", false
+	}
+	return strings.TrimSpace(string(barr)), true
+}
+
+func readSysfsUint(path string) (uint64, bool) {
+	val, ok := readSysfsString(path)
+	if !ok {
+		return 0, false
+	}
+	uval, err := strconv.ParseUint(val, 10, 64)
+	return uval, err == nil
+}
+
+// the first hwmon dir of the device (amdgpu has exactly one)
+func gpuHwmonDir(deviceDir string) string {
+	matches, _ := filepath.Glob(filepath.Join(deviceDir, "hwmon", "hwmon*"))
+	if len(matches) == 0 {
+		return ""
+	}
+	sort.Strings(matches)
+	return matches[0]
+}
+
+// temp is millidegrees, power is microwatts
+func readGpuHwmon(hwmonDir string, gpu *wshrpc.GpuData) {
+	if hwmonDir == "" {
+		gpu.Unsupported = append(gpu.Unsupported, "tempc", "powerw")
+		return
+	}
+	if temp, ok := readSysfsUint(filepath.Join(hwmonDir, "temp1_input")); ok {
+		gpu.TempC = float64(temp) / 1000
+	} else {
+		gpu.Unsupported = append(gpu.Unsupported, "tempc")
+	}
+	power, ok := readSysfsUint(filepath.Join(hwmonDir, "power1_average"))
+	if !ok {
+		power, ok = readSysfsUint(filepath.Join(hwmonDir, "power1_input"))
+	}
+	if ok {
+		gpu.PowerW = float64(power) / 1_000_000
+	} else {
+		gpu.Unsupported = append(gpu.Unsupported, "powerw")
+	}
+	if powerCap, ok := readSysfsUint(filepath.Join(hwmonDir, "power1_cap")); ok {
+		gpu.PowerLimitW = float64(powerCap) / 1_000_000
+	}
+}
+
+// only devices that report their utilization (amdgpu's gpu_busy_percent) are listed, so plain display
+// adapters (virtual gpus, i915 without metrics) don't show up as gpus
+func probeSysfsGpus() ([]wshrpc.GpuData, error) {
+	entries, err := os.ReadDir(drmClassDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("cannot read %s: %w", drmClassDir, err)
+	}
+	var rtn []wshrpc.GpuData
+	for _, entry := range entries {
+		match := drmCardRe.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		deviceDir := filepath.Join(drmClassDir, entry.Name(), "device")
+		utilPercent, ok := readSysfsUint(filepath.Join(deviceDir, "gpu_busy_percent"))
+		if !ok {
+			continue
+		}
+		index, _ := strconv.Atoi(match[1])
+		gpu := wshrpc.GpuData{Index: index, UtilPercent: float64(utilPercent)}
+		vendorId, _ := readSysfsString(filepath.Join(deviceDir, "vendor"))
+		gpu.Vendor = pciVendorNames[vendorId]
+		if gpu.Vendor == "" {
+			gpu.Vendor = vendorId
+		}
+		if name, ok := readSysfsString(filepath.Join(deviceDir, "product_name")); ok && name != "" {
+			gpu.Name = name
+		} else {
+			deviceId, _ := readSysfsString(filepath.Join(deviceDir, "device"))
+			gpu.Name = strings.TrimSpace(fmt.Sprintf("%s gpu %s", gpu.Vendor, deviceId))
+		}
+		if devicePath, err := filepath.EvalSymlinks(deviceDir); err == nil {
+			gpu.BusId = filepath.Base(devicePath)
+		}
+		if memUsed, ok := readSysfsUint(filepath.Join(deviceDir, "mem_info_vram_used")); ok {
+			gpu.MemUsed = memUsed
+		} else {
+			gpu.Unsupported = append(gpu.Unsupported, "memused")
+		}
+		if memTotal, ok := readSysfsUint(filepath.Join(deviceDir, "mem_info_vram_total")); ok {
+			gpu.MemTotal = memTotal
+		} else {
+			gpu.Unsupported = append(gpu.Unsupported, "memtotal")
+		}
+		readGpuHwmon(gpuHwmonDir(deviceDir), &gpu)
+		rtn = append(rtn, gpu)
+	}
+	sort.Slice(rtn, func(i, j int) bool { return rtn[i].Index < rtn[j].Index })
+	return rtn, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// there is no sysfs fallback outside linux, only nvidia-smi is used
+func probeSysfsGpus() ([]wshrpc.GpuData, error) {
+	return nil, nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// picks the ServerImpl that serves a route, based on the claims in the jwt it authenticated with.
+// lets routes behind one router get different policies (root dir, permissions) without separate processes.
+// an error refuses the route (a claim that can't be honored must not fall back to the global impl)
+type ServerImplFactory func(rpcCtx *wshrpc.RpcContext) (*ServerImpl, error)
+
+// the default factory serves every route with the same (global) impl
+func MakeDefaultServerImplFactory(impl *ServerImpl) ServerImplFactory {
+	return func(rpcCtx *wshrpc.RpcContext) (*ServerImpl, error) {
+		return impl, nil
+	}
+}
+
+// routes whose token has a "rootdir" claim get impl's state confined to that dir (see WithRootDir), the
+// rest get impl.  the claim can only narrow impl's own root dir: a relative claim is resolved against it,
+// and one outside of it (or that doesn't exist) refuses the route
+func MakeRootDirClaimServerImplFactory(impl *ServerImpl) ServerImplFactory {
+	return func(rpcCtx *wshrpc.RpcContext) (*ServerImpl, error) {
+		if rpcCtx == nil || rpcCtx.RootDir == "" {
+			return impl, nil
+		}
+		claimedDir, err := impl.resolvePath(rpcCtx.RootDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rootdir claim: %w", err)
+		}
+		rootDir, err := ResolveRootDir(claimedDir)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rootdir claim: %w", err)
+		}
+		if impl.RootDir != "" && !isPathInDir(rootDir, impl.RootDir) {
+			return nil, fmt.Errorf("invalid rootdir claim: %w", rootDirErr(rpcCtx.RootDir))
+		}
+		return impl.WithRootDir(rootDir), nil
+	}
+}
+
+// route id => ServerImpl, only for routes that are not served by the default impl
+type ServerImplRegistry struct {
+	lock   *sync.Mutex
+	routes map[string]*ServerImpl
+}
+
+func MakeServerImplRegistry() *ServerImplRegistry {
+	return &ServerImplRegistry{
+		lock:   &sync.Mutex{},
+		routes: make(map[string]*ServerImpl),
+	}
+}
+
+func (r *ServerImplRegistry) SetRouteImpl(routeId string, impl *ServerImpl) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if impl == nil {
+		delete(r.routes, routeId)
+		return
+	}
+	r.routes[routeId] = impl
+}
+
+func (r *ServerImplRegistry) RemoveRoute(routeId string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	delete(r.routes, routeId)
+}
+
+// returns nil if the route uses the default impl
+func (r *ServerImplRegistry) GetRouteImpl(routeId string) *ServerImpl {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return r.routes[routeId]
+}
+
+// for WshRpc.SetServerImplSelector (nil falls back to the rpc's own ServerImpl)
+func (r *ServerImplRegistry) SelectServerImpl(source string) wshutil.ServerImpl {
+	impl := r.GetRouteImpl(source)
+	if impl == nil {
+		return nil
+	}
+	return impl
+}
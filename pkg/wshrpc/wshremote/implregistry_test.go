@@ -0,0 +1,149 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+func TestDefaultServerImplFactory(t *testing.T) {
+	impl := MakeServerImpl(nil, "")
+	factory := MakeDefaultServerImplFactory(impl)
+	for _, rpcCtx := range []*wshrpc.RpcContext{nil, {}, {RootDir: "/tmp"}} {
+		routeImpl, err := factory(rpcCtx)
+		if err != nil || routeImpl != impl {
+			t.Errorf("factory(%+v) = %p, %v, want the global impl", rpcCtx, routeImpl, err)
+		}
+	}
+}
+
+func TestRootDirClaimServerImplFactory(t *testing.T) {
+	rootDir, outsideDir := makeRootDirTree(t)
+	tests := []struct {
+		name       string
+		baseRoot   string
+		claim      string
+		expected   string // the route's root dir, "" for the global impl
+		refused    bool
+		permission bool // refused with fs.ErrPermission
+	}{
+		{"no claim", "", "", "", false, false},
+		{"no claim under a root", rootDir, "", "", false, false},
+		{"claim without a server root", "", rootDir, rootDir, false, false},
+		{"absolute claim inside the root", rootDir, filepath.Join(rootDir, "real"), filepath.Join(rootDir, "real"), false, false},
+		{"relative claim", rootDir, "real", filepath.Join(rootDir, "real"), false, false},
+		{"claim of the root itself", rootDir, rootDir, rootDir, false, false},
+		{"claim via a symlink inside", rootDir, "inlink", filepath.Join(rootDir, "real"), false, false},
+		{"claim outside the root", rootDir, outsideDir, "", true, true},
+		{"dotdot claim", rootDir, "../outside", "", true, true},
+		{"claim via a symlink outside", rootDir, "outlink", "", true, true},
+		{"claim of a file", rootDir, "real/file", "", true, false},
+		{"claim that doesn't exist", rootDir, "nothere", "", true, false},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			impl := MakeServerImpl(nil, tc.baseRoot)
+			routeImpl, err := MakeRootDirClaimServerImplFactory(impl)(&wshrpc.RpcContext{RootDir: tc.claim})
+			if tc.refused {
+				if err == nil {
+					t.Fatalf("claim %q was not refused (root dir %q)", tc.claim, routeImpl.RootDir)
+				}
+				if tc.permission && !errors.Is(err, fs.ErrPermission) {
+					t.Fatalf("claim %q refused with %v, want a permission error", tc.claim, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("claim %q refused: %v", tc.claim, err)
+			}
+			if tc.expected == "" {
+				if routeImpl != impl {
+					t.Fatalf("got a new impl (root dir %q), want the global impl", routeImpl.RootDir)
+				}
+				return
+			}
+			if routeImpl == impl || routeImpl.RootDir != tc.expected {
+				t.Fatalf("root dir = %q, want %q on a new impl", routeImpl.RootDir, tc.expected)
+			}
+			if routeImpl.ServerState != impl.ServerState {
+				t.Fatalf("the route impl does not share the server state")
+			}
+		})
+	}
+}
+
+func TestServerImplRegistry_RouteImpls(t *testing.T) {
+	impl := MakeServerImpl(nil, "")
+	routeImpl := impl.WithRootDir(t.TempDir())
+	registry := MakeServerImplRegistry()
+	registry.SetRouteImpl("route1", routeImpl)
+	if registry.GetRouteImpl("route1") != routeImpl {
+		t.Fatalf("route1 does not have its impl")
+	}
+	if registry.GetRouteImpl("route2") != nil || registry.SelectServerImpl("route2") != nil {
+		t.Fatalf("a route without an impl must select nil (the rpc's own impl)")
+	}
+	registry.SetRouteImpl("route1", nil)
+	if registry.GetRouteImpl("route1") != nil {
+		t.Fatalf("setting a nil impl did not remove the route")
+	}
+	registry.SetRouteImpl("route1", routeImpl)
+	registry.RemoveRoute("route1")
+	if registry.SelectServerImpl("route1") != nil {
+		t.Fatalf("RemoveRoute did not remove the route")
+	}
+}
+
+// requests from a route with a rootdir claim are confined, the same request from another route is not
+func TestRootDirClaimServerImplFactory_SelectedPerSource(t *testing.T) {
+	rootDir, outsideDir := makeRootDirTree(t)
+	base := MakeServerImpl(&ServerState{Router: wshutil.NewWshRouter()}, "")
+	factory := MakeRootDirClaimServerImplFactory(base)
+	registry := MakeServerImplRegistry()
+	for routeId, rpcCtx := range map[string]*wshrpc.RpcContext{"confined": {RootDir: rootDir}, "unconfined": {}} {
+		routeImpl, err := factory(rpcCtx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if routeImpl != base {
+			registry.SetRouteImpl(routeId, routeImpl)
+		}
+	}
+	inputCh := make(chan []byte, 1)
+	outputCh := make(chan []byte, 1)
+	rpc := wshutil.MakeWshRpc(inputCh, outputCh, wshrpc.RpcContext{}, base)
+	rpc.SetServerImplSelector(registry.SelectServerImpl)
+	secretPath := filepath.Join(outsideDir, "secret")
+	fileInfo := func(source string) string {
+		t.Helper()
+		reqBytes, _ := json.Marshal(wshutil.RpcMessage{Command: wshrpc.Command_RemoteFileInfo, ReqId: "req-" + source, Source: source, Data: secretPath})
+		inputCh <- reqBytes
+		select {
+		case respBytes := <-outputCh:
+			var resp wshutil.RpcMessage
+			if err := json.Unmarshal(respBytes, &resp); err != nil {
+				t.Fatalf("invalid response: %v", err)
+			}
+			return resp.Error
+		case <-time.After(5 * time.Second):
+			t.Fatalf("no response to fileinfo from %q", source)
+		}
+		return ""
+	}
+	if errStr := fileInfo("confined"); !strings.Contains(errStr, "outside of the server root dir") {
+		t.Errorf("fileinfo of %q outside the confined route's root dir: got error %q", secretPath, errStr)
+	}
+	if errStr := fileInfo("unconfined"); errStr != "" {
+		t.Errorf("the unconfined route could not stat %q: %s", secretPath, errStr)
+	}
+}
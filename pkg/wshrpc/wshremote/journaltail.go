@@ -0,0 +1,277 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const MaxJournalFollowsPerRoute = 4
+const DefaultJournalTailLines = 50
+const MaxJournalTailLines = 1000
+const MaxJournalMessageLen = 8 * 1024
+const maxJournalLineLen = 1024 * 1024
+
+// unit names as systemd allows them (and never a leading "-", so it can't be read as a flag)
+var journalUnitRe = regexp.MustCompile(`^[A-Za-z0-9_:.@\\][A-Za-z0-9_:.@\\-]*$`)
+
+var journalFollowLock = &sync.Mutex{}
+var journalFollowCounts = make(map[string]int) // source route => active follows
+
+func acquireJournalFollow(source string) error {
+	journalFollowLock.Lock()
+	defer journalFollowLock.Unlock()
+	if journalFollowCounts[source] >= MaxJournalFollowsPerRoute {
+		return fmt.Errorf("too many journal follows for route %q (max %d)", source, MaxJournalFollowsPerRoute)
+	}
+	journalFollowCounts[source]++
+	return nil
+}
+
+func releaseJournalFollow(source string) {
+	journalFollowLock.Lock()
+	defer journalFollowLock.Unlock()
+	journalFollowCounts[source]--
+	if journalFollowCounts[source] <= 0 {
+		delete(journalFollowCounts, source)
+	}
+}
+
+func journalTailErr(err error) wshrpc.RespOrErrorUnion[wshrpc.JournalTailData] {
+	return wshrpc.RespOrErrorUnion[wshrpc.JournalTailData]{Error: err}
+}
+
+// drops the error if the request is already done (nobody is reading the stream)
+func sendJournalTailErr(ctx context.Context, ch chan wshrpc.RespOrErrorUnion[wshrpc.JournalTailData], err error) {
+	if ctx.Err() != nil {
+		return
+	}
+	select {
+	case ch <- journalTailErr(err):
+	case <-ctx.Done():
+	}
+}
+
+// returns when the route unregisters or ctx is done
+func waitForRouteGone(ctx context.Context, router *wshutil.WshRouter, routeId string) {
+	ticker := time.NewTicker(fileWatchRouteCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if !router.IsLocalRoute(routeId) {
+				return
+			}
+		}
+	}
+}
+
+// the systemd unit the connserver runs in, from the last ".service" component of its cgroup
+func getOwnSystemdUnit() (string, error) {
+	cgroupBytes, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return "", errors.New("cannot determine the connserver's systemd unit, specify a unit")
+	}
+	for _, line := range strings.Split(string(cgroupBytes), "\n") {
+		parts := strings.Split(line, "/")
+		for idx := len(parts) - 1; idx >= 0; idx-- {
+			if strings.HasSuffix(parts[idx], ".service") {
+				return parts[idx], nil
+			}
+		}
+	}
+	return "", errors.New("connserver is not running in a systemd service, specify a unit")
+}
+
+// journalctl -o json fields are strings, except MESSAGE which is a byte array when it isn't valid utf-8
+type journalJsonEntry struct {
+	Cursor     string          `json:"__CURSOR"`
+	Realtime   string          `json:"__REALTIME_TIMESTAMP"` // unix microseconds
+	Unit       string          `json:"_SYSTEMD_UNIT"`
+	Priority   string          `json:"PRIORITY"`
+	Pid        string          `json:"_PID"`
+	RawMessage json.RawMessage `json:"MESSAGE"`
+}
+
+func decodeJournalMessage(raw json.RawMessage) string {
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil {
+		return message
+	}
+	var msgBytes []byte
+	var byteArr []int
+	if err := json.Unmarshal(raw, &byteArr); err == nil {
+		for _, b := range byteArr {
+			msgBytes = append(msgBytes, byte(b))
+		}
+	}
+	return strings.ToValidUTF8(string(msgBytes), "�")
+}
+
+func parseJournalLine(line []byte) (wshrpc.JournalEntryData, string, error) {
+	var raw journalJsonEntry
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return wshrpc.JournalEntryData{}, "", err
+	}
+	entry := wshrpc.JournalEntryData{Unit: raw.Unit, Message: decodeJournalMessage(raw.RawMessage)}
+	if usec, err := strconv.ParseInt(raw.Realtime, 10, 64); err == nil {
+		entry.Ts = usec / 1000
+	}
+	entry.Priority, _ = strconv.Atoi(raw.Priority)
+	entry.Pid, _ = strconv.Atoi(raw.Pid)
+	if len(entry.Message) > MaxJournalMessageLen {
+		entry.Message = strings.ToValidUTF8(entry.Message[:MaxJournalMessageLen], "") + "..."
+	}
+	return entry, raw.Cursor, nil
+}
+
+// reads entries until journalctl exits, calling entryFn for each one.  returns the last cursor.
+func runJournalctl(ctx context.Context, args []string, entryFn func(wshrpc.JournalEntryData) error) (string, error) {
+	cmd := exec.CommandContext(ctx, "journalctl", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return "", err
+	}
+	if err := cmd.Start(); err != nil {
+		return "", err
+	}
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxJournalLineLen)
+	var cursor string
+	for scanner.Scan() {
+		entry, entryCursor, err := parseJournalLine(scanner.Bytes())
+		if err != nil {
+			continue
+		}
+		cursor = entryCursor
+		if err := entryFn(entry); err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			return cursor, err
+		}
+	}
+	if scanErr := scanner.Err(); scanErr != nil && scanErr != io.EOF {
+		cmd.Process.Kill()
+		cmd.Wait()
+		return cursor, scanErr
+	}
+	if err := cmd.Wait(); err != nil && ctx.Err() == nil {
+		if errMsg := strings.TrimSpace(stderr.String()); errMsg != "" {
+			return cursor, fmt.Errorf("journalctl: %s", errMsg)
+		}
+		return cursor, fmt.Errorf("journalctl: %w", err)
+	}
+	return cursor, nil
+}
+
+// gated behind admin (other units' logs can be sensitive), allowed when read-only
+func (impl *ServerImpl) JournalTailCommand(ctx context.Context, data wshrpc.CommandJournalTailData) chan wshrpc.RespOrErrorUnion[wshrpc.JournalTailData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.JournalTailData], 16)
+	sendErr := func(err error) chan wshrpc.RespOrErrorUnion[wshrpc.JournalTailData] {
+		ch <- journalTailErr(err)
+		close(ch)
+		return ch
+	}
+	if err := impl.checkAdmin(ctx); err != nil {
+		return sendErr(err)
+	}
+	if _, err := exec.LookPath("journalctl"); err != nil {
+		return sendErr(errors.New("the systemd journal is not available on this host (journalctl not found)"))
+	}
+	unit := data.Unit
+	if unit == "" {
+		var err error
+		if unit, err = getOwnSystemdUnit(); err != nil {
+			return sendErr(err)
+		}
+	}
+	if !journalUnitRe.MatchString(unit) {
+		return sendErr(fmt.Errorf("invalid unit name %q", unit))
+	}
+	lines := DefaultJournalTailLines
+	if data.Lines > 0 {
+		lines = min(data.Lines, MaxJournalTailLines)
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	if data.Follow {
+		if err := acquireJournalFollow(source); err != nil {
+			return sendErr(err)
+		}
+	}
+	// same route tracking as FileWatch, upstream routes are only stopped by the request context
+	localRoute := impl.Router != nil && impl.Router.IsLocalRoute(source)
+	go func() {
+		defer panichandler.PanicHandler("JournalTailCommand")
+		defer close(ch)
+		if data.Follow {
+			defer releaseJournalFollow(source)
+		}
+		sendPacket := func(entries []wshrpc.JournalEntryData) error {
+			select {
+			case ch <- wshrpc.RespOrErrorUnion[wshrpc.JournalTailData]{Response: wshrpc.JournalTailData{Unit: unit, Entries: entries}}:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		entries := []wshrpc.JournalEntryData{}
+		baseArgs := []string{"--no-pager", "-o", "json", "-u", unit}
+		cursor, err := runJournalctl(ctx, append(baseArgs, "-n", strconv.Itoa(lines)), func(entry wshrpc.JournalEntryData) error {
+			entries = append(entries, entry)
+			return nil
+		})
+		if err != nil {
+			sendJournalTailErr(ctx, ch, err)
+			return
+		}
+		if sendPacket(entries) != nil || !data.Follow {
+			return
+		}
+		followCtx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+		if localRoute {
+			go func() {
+				defer panichandler.PanicHandler("JournalTailCommand:routecheck")
+				waitForRouteGone(followCtx, impl.Router, source)
+				cancelFn()
+			}()
+		}
+		followArgs := append(baseArgs, "-f")
+		if cursor != "" {
+			followArgs = append(followArgs, "--after-cursor", cursor)
+		} else {
+			followArgs = append(followArgs, "-n", "0")
+		}
+		impl.Log("[journaltail] following unit %q for route %q\n", unit, source)
+		_, err = runJournalctl(followCtx, followArgs, func(entry wshrpc.JournalEntryData) error {
+			return sendPacket([]wshrpc.JournalEntryData{entry})
+		})
+		if err != nil && followCtx.Err() == nil {
+			sendJournalTailErr(ctx, ch, err)
+		}
+		impl.Log("[journaltail] stopped following unit %q for route %q\n", unit, source)
+	}()
+	return ch
+}
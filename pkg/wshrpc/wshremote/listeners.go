@@ -0,0 +1,102 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"syscall"
+
+	"github.com/shirou/gopsutil/v4/net"
+	"github.com/shirou/gopsutil/v4/process"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const MaxListListeners = 1000
+
+func listenerProtocol(conn net.ConnectionStat) string {
+	proto := "tcp"
+	if conn.Type == syscall.SOCK_DGRAM {
+		proto = "udp"
+	}
+	if conn.Family == syscall.AF_INET6 {
+		proto += "6"
+	}
+	return proto
+}
+
+// a listening tcp socket, or a udp socket that is bound but not connected
+func isListeningConn(conn net.ConnectionStat) bool {
+	if conn.Type == syscall.SOCK_DGRAM {
+		return conn.Raddr.Port == 0
+	}
+	return conn.Status == "LISTEN"
+}
+
+// gated behind admin since it exposes every service on the host (allowed when read-only, it's a read)
+func (impl *ServerImpl) ListListenersCommand(ctx context.Context, data wshrpc.CommandListListenersData) (*wshrpc.CommandListListenersRtnData, error) {
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	kind := "inet"
+	switch data.Protocol {
+	case "":
+	case "tcp", "udp":
+		kind = data.Protocol
+	default:
+		return nil, fmt.Errorf("invalid protocol %q (must be \"tcp\" or \"udp\")", data.Protocol)
+	}
+	limit := MaxListListeners
+	if data.Limit > 0 {
+		limit = min(data.Limit, MaxListListeners)
+	}
+	// on linux this reads /proc/net/{tcp,tcp6,udp,udp6} and matches socket inodes to /proc/<pid>/fd
+	conns, err := net.ConnectionsWithContext(ctx, kind)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list sockets: %w", err)
+	}
+	procNames := make(map[int32]string)
+	var listeners []wshrpc.ListenerInfo
+	for _, conn := range conns {
+		if !isListeningConn(conn) {
+			continue
+		}
+		info := wshrpc.ListenerInfo{
+			Protocol: listenerProtocol(conn),
+			Addr:     conn.Laddr.IP,
+			Port:     conn.Laddr.Port,
+			Pid:      conn.Pid,
+		}
+		if conn.Pid > 0 {
+			name, found := procNames[conn.Pid]
+			if !found {
+				if proc, err := process.NewProcessWithContext(ctx, conn.Pid); err == nil {
+					name, _ = proc.NameWithContext(ctx)
+				}
+				procNames[conn.Pid] = name
+			}
+			info.Process = name
+		}
+		listeners = append(listeners, info)
+	}
+	sort.Slice(listeners, func(i, j int) bool {
+		if listeners[i].Protocol != listeners[j].Protocol {
+			return listeners[i].Protocol < listeners[j].Protocol
+		}
+		if listeners[i].Port != listeners[j].Port {
+			return listeners[i].Port < listeners[j].Port
+		}
+		return listeners[i].Addr < listeners[j].Addr
+	})
+	rtn := &wshrpc.CommandListListenersRtnData{Total: len(listeners), Listeners: listeners}
+	if len(listeners) > limit {
+		rtn.Listeners = listeners[:limit]
+		rtn.Truncated = true
+	}
+	if rtn.Listeners == nil {
+		rtn.Listeners = []wshrpc.ListenerInfo{}
+	}
+	return rtn, nil
+}
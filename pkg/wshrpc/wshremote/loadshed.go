@@ -0,0 +1,75 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// a sample older than this many sysinfo intervals is ignored (the collector is stuck or gave up),
+// so a stale spike can't lock clients out
+const loadSampleMaxAgeIntervals = 3
+
+// new listener connections are refused while the latest sysinfo sample is above a threshold
+// (existing connections are unaffected)
+type LoadShedOpts struct {
+	MaxCpuPercent float64 // 0 disables
+	MaxMemPercent float64 // used (total - available) as a percent of total, 0 disables
+}
+
+func (opts LoadShedOpts) Enabled() bool {
+	return opts.MaxCpuPercent > 0 || opts.MaxMemPercent > 0
+}
+
+type loadSample struct {
+	Ts         time.Time
+	CpuPercent float64 // -1 if not collected
+	MemPercent float64 // -1 if not collected
+}
+
+var latestLoadSample atomic.Pointer[loadSample]
+var loadShedRejected atomic.Int64
+
+// called with every sysinfo collection
+func recordLoadSample(values map[string]float64, ts time.Time) {
+	sample := &loadSample{Ts: ts, CpuPercent: -1, MemPercent: -1}
+	if cpuPercent, ok := values[wshrpc.TimeSeries_Cpu]; ok {
+		sample.CpuPercent = cpuPercent
+	}
+	if total := values["mem:total"]; total > 0 {
+		if available, ok := values["mem:available"]; ok {
+			sample.MemPercent = (total - available) / total * 100
+		}
+	}
+	latestLoadSample.Store(sample)
+}
+
+// returns a reason when a new connection should be refused
+func CheckOverloaded(opts LoadShedOpts) (string, bool) {
+	if !opts.Enabled() {
+		return "", false
+	}
+	sample := latestLoadSample.Load()
+	if sample == nil || time.Since(sample.Ts) > loadSampleMaxAgeIntervals*GetSysInfoInterval() {
+		return "", false
+	}
+	if opts.MaxCpuPercent > 0 && sample.CpuPercent > opts.MaxCpuPercent {
+		loadShedRejected.Add(1)
+		return fmt.Sprintf("cpu at %.1f%% (limit %g%%)", sample.CpuPercent, opts.MaxCpuPercent), true
+	}
+	if opts.MaxMemPercent > 0 && sample.MemPercent > opts.MaxMemPercent {
+		loadShedRejected.Add(1)
+		return fmt.Sprintf("memory at %.1f%% (limit %g%%)", sample.MemPercent, opts.MaxMemPercent), true
+	}
+	return "", false
+}
+
+// connections refused by CheckOverloaded (lifetime)
+func GetLoadShedRejected() int64 {
+	return loadShedRejected.Load()
+}
@@ -0,0 +1,165 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const localeCmdTimeout = 2 * time.Second
+
+var localeEnvVars = []string{"LC_ALL", "LC_CTYPE", "LC_TIME", "LC_NUMERIC", "LC_MONETARY", "LC_MESSAGES", "LC_COLLATE", "LANG", "LANGUAGE"}
+
+// the system default when the connserver's environment has no locale (e.g. started over a non-login ssh session)
+var systemLocaleFiles = []string{"/etc/locale.conf", "/etc/default/locale"}
+
+// the zone name from a zoneinfo path (".../zoneinfo/Europe/Berlin" => "Europe/Berlin")
+func zoneNameFromPath(zonePath string) string {
+	_, name, found := strings.Cut(filepath.ToSlash(zonePath), "zoneinfo/")
+	if !found {
+		return ""
+	}
+	return name
+}
+
+func detectTimezone() (string, string) {
+	if tz, ok := os.LookupEnv("TZ"); ok && tz != "" {
+		tz = strings.TrimPrefix(tz, ":")
+		if filepath.IsAbs(tz) {
+			return zoneNameFromPath(tz), "TZ"
+		}
+		return tz, "TZ"
+	}
+	if target, err := os.Readlink("/etc/localtime"); err == nil {
+		if name := zoneNameFromPath(target); name != "" {
+			return name, "/etc/localtime"
+		}
+	}
+	if tzBytes, err := os.ReadFile("/etc/timezone"); err == nil {
+		if name := strings.TrimSpace(string(tzBytes)); name != "" {
+			return name, "/etc/timezone"
+		}
+	}
+	return "", ""
+}
+
+func readLocaleFile(fileName string) map[string]string {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil
+	}
+	defer file.Close()
+	rtn := make(map[string]string)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, value, found := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if found && (name == "LANG" || name == "LANGUAGE" || strings.HasPrefix(name, "LC_")) {
+			rtn[name] = strings.Trim(value, "\"'")
+		}
+	}
+	return rtn
+}
+
+func getLocaleVars() (map[string]string, string) {
+	vars := make(map[string]string)
+	for _, name := range localeEnvVars {
+		if val := os.Getenv(name); val != "" {
+			vars[name] = val
+		}
+	}
+	if len(vars) > 0 {
+		return vars, "env"
+	}
+	for _, fileName := range systemLocaleFiles {
+		if fileVars := readLocaleFile(fileName); len(fileVars) > 0 {
+			return fileVars, fileName
+		}
+	}
+	return vars, ""
+}
+
+// posix precedence: LC_ALL, then the category variable, then LANG
+func effectiveLocale(vars map[string]string, category string) string {
+	for _, name := range []string{"LC_ALL", category, "LANG"} {
+		if val := vars[name]; val != "" {
+			return val
+		}
+	}
+	return "C"
+}
+
+// asks the locale database for the formats (glibc `locale -k`), empty map if it isn't available
+func queryLocaleFormats(ctx context.Context, timeLocale string, numericLocale string) map[string]string {
+	rtn := make(map[string]string)
+	if runtime.GOOS == "windows" {
+		return rtn
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, localeCmdTimeout)
+	defer cancelFn()
+	cmd := exec.CommandContext(ctx, "locale", "-k", "d_fmt", "t_fmt", "d_t_fmt", "decimal_point", "thousands_sep")
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "LC_ALL=") && !strings.HasPrefix(kv, "LC_TIME=") && !strings.HasPrefix(kv, "LC_NUMERIC=") {
+			cmd.Env = append(cmd.Env, kv)
+		}
+	}
+	cmd.Env = append(cmd.Env, "LC_TIME="+timeLocale, "LC_NUMERIC="+numericLocale)
+	output, err := cmd.Output()
+	if err != nil {
+		return rtn
+	}
+	for _, line := range strings.Split(string(output), "\n") {
+		name, value, found := strings.Cut(line, "=")
+		if !found {
+			continue
+		}
+		if unquoted, err := strconv.Unquote(value); err == nil {
+			value = unquoted
+		}
+		rtn[name] = value
+	}
+	return rtn
+}
+
+func (impl *ServerImpl) LocaleInfoCommand(ctx context.Context) (*wshrpc.LocaleInfoData, error) {
+	now := time.Now()
+	rtn := &wshrpc.LocaleInfoData{Ts: now.UnixMilli()}
+	rtn.Timezone, rtn.TimezoneSource = detectTimezone()
+	if rtn.Timezone == "" && time.Local.String() != "Local" {
+		rtn.Timezone = time.Local.String()
+	}
+	// the offset comes from the zone that was detected (time.Local is fixed when the process starts)
+	zoneNow := now
+	if rtn.Timezone != "" {
+		if loc, err := time.LoadLocation(rtn.Timezone); err == nil {
+			zoneNow = now.In(loc)
+		}
+	}
+	rtn.TzAbbrev, rtn.UtcOffsetSec = zoneNow.Zone()
+	rtn.Dst = zoneNow.IsDST()
+	vars, source := getLocaleVars()
+	if len(vars) > 0 {
+		rtn.LocaleVars = vars
+	}
+	rtn.LocaleSource = source
+	rtn.Locale = effectiveLocale(vars, "LC_CTYPE")
+	rtn.TimeLocale = effectiveLocale(vars, "LC_TIME")
+	rtn.NumericLocale = effectiveLocale(vars, "LC_NUMERIC")
+	formats := queryLocaleFormats(ctx, rtn.TimeLocale, rtn.NumericLocale)
+	rtn.DateFormat = formats["d_fmt"]
+	rtn.TimeFormat = formats["t_fmt"]
+	rtn.DateTimeFormat = formats["d_t_fmt"]
+	rtn.DecimalPoint = formats["decimal_point"]
+	rtn.ThousandsSep = formats["thousands_sep"]
+	return rtn, nil
+}
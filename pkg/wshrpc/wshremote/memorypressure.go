@@ -0,0 +1,82 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// same windowing as cpudetail, a longer window is allowed since swap activity is bursty
+const memPressureMinSample = time.Second
+const memPressureMaxSample = 60 * time.Second
+
+type swapSample struct {
+	Ts   time.Time
+	Swap *mem.SwapMemoryStat
+}
+
+var memPressureLock = &sync.Mutex{}
+var lastSwapSample *swapSample
+
+func readSwapSample(ctx context.Context) (*swapSample, error) {
+	swapStat, err := mem.SwapMemoryWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read swap stats: %w", err)
+	}
+	return &swapSample{Ts: time.Now(), Swap: swapStat}, nil
+}
+
+// counters can go backwards (wrap or reset), that window reports 0
+func counterRate(prev uint64, cur uint64, elapsed time.Duration) float64 {
+	if cur < prev || elapsed <= 0 {
+		return 0
+	}
+	return float64(cur-prev) / elapsed.Seconds()
+}
+
+func (impl *ServerImpl) MemoryPressureCommand(ctx context.Context) (*wshrpc.MemoryPressureData, error) {
+	memPressureLock.Lock()
+	defer memPressureLock.Unlock()
+	prev := lastSwapSample
+	if prev == nil || time.Since(prev.Ts) < memPressureMinSample || time.Since(prev.Ts) > memPressureMaxSample {
+		var err error
+		prev, err = readSwapSample(ctx)
+		if err != nil {
+			return nil, err
+		}
+		select {
+		case <-time.After(memPressureMinSample):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	cur, err := readSwapSample(ctx)
+	if err != nil {
+		return nil, err
+	}
+	lastSwapSample = cur
+	elapsed := cur.Ts.Sub(prev.Ts)
+	rtn := &wshrpc.MemoryPressureData{
+		Ts:              cur.Ts.UnixMilli(),
+		SwapTotal:       cur.Swap.Total,
+		SwapUsed:        cur.Swap.Used,
+		SwapUsedPercent: cur.Swap.UsedPercent,
+		SwapInPerSec:    counterRate(prev.Swap.Sin, cur.Swap.Sin, elapsed),
+		SwapOutPerSec:   counterRate(prev.Swap.Sout, cur.Swap.Sout, elapsed),
+		MajFaultsPerSec: counterRate(prev.Swap.PgMajFault, cur.Swap.PgMajFault, elapsed),
+		SampleMs:        elapsed.Milliseconds(),
+	}
+	psi, err := readMemoryPsi()
+	if err != nil {
+		impl.Log("[memorypressure] cannot read memory psi: %v\n", err)
+	}
+	rtn.Psi = psi
+	return rtn, nil
+}
@@ -0,0 +1,75 @@
+//go:build linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const memoryPsiFile = "/proc/pressure/memory"
+
+// "some avg10=0.00 avg60=0.00 avg300=0.00 total=0"
+func parsePsiLine(fields []string) (wshrpc.PsiLineData, error) {
+	var rtn wshrpc.PsiLineData
+	for _, field := range fields {
+		name, val, found := strings.Cut(field, "=")
+		if !found {
+			return rtn, fmt.Errorf("invalid psi field %q", field)
+		}
+		var err error
+		switch name {
+		case "avg10":
+			rtn.Avg10, err = strconv.ParseFloat(val, 64)
+		case "avg60":
+			rtn.Avg60, err = strconv.ParseFloat(val, 64)
+		case "avg300":
+			rtn.Avg300, err = strconv.ParseFloat(val, 64)
+		case "total":
+			rtn.Total, err = strconv.ParseUint(val, 10, 64)
+		}
+		if err != nil {
+			return rtn, fmt.Errorf("invalid psi field %q: %w", field, err)
+		}
+	}
+	return rtn, nil
+}
+
+// nil without an error when the kernel has no psi (older than 4.20, or booted with psi=0)
+func readMemoryPsi() (*wshrpc.MemoryPsiData, error) {
+	psiBytes, err := os.ReadFile(memoryPsiFile)
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.EOPNOTSUPP) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rtn := &wshrpc.MemoryPsiData{}
+	for _, line := range strings.Split(strings.TrimSpace(string(psiBytes)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		lineData, err := parsePsiLine(fields[1:])
+		if err != nil {
+			return nil, err
+		}
+		switch fields[0] {
+		case "some":
+			rtn.Some = lineData
+		case "full":
+			rtn.Full = lineData
+		}
+	}
+	return rtn, nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// pressure stall information is linux only
+func readMemoryPsi() (*wshrpc.MemoryPsiData, error) {
+	return nil, nil
+}
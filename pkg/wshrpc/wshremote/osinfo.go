@@ -0,0 +1,97 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/shirou/gopsutil/v4/host"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const osReleaseFile = "/etc/os-release"
+
+var containerVirtSystems = map[string]bool{"docker": true, "lxc": true, "podman": true, "openvz": true, "linux-vserver": true, "rkt": true, "systemd-nspawn": true}
+
+// reads the (possibly quoted) value of one key from /etc/os-release
+func readOsReleaseField(key string) string {
+	file, err := os.Open(osReleaseFile)
+	if err != nil {
+		return ""
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		name, value, found := strings.Cut(scanner.Text(), "=")
+		if found && name == key {
+			return strings.Trim(value, "\"'")
+		}
+	}
+	return ""
+}
+
+// heuristics, the first match wins.  kubernetes is checked first since its pods also look like docker/containerd
+func detectContainer() string {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") != "" {
+		return "kubernetes"
+	}
+	if _, err := os.Stat("/.dockerenv"); err == nil {
+		return "docker"
+	}
+	if _, err := os.Stat("/run/.containerenv"); err == nil {
+		return "podman"
+	}
+	if container := os.Getenv("container"); container != "" {
+		// set by lxc, systemd-nspawn and podman
+		return container
+	}
+	if cgroupBytes, err := os.ReadFile("/proc/1/cgroup"); err == nil {
+		cgroups := string(cgroupBytes)
+		for _, name := range []string{"kubepods", "docker", "lxc", "containerd"} {
+			if strings.Contains(cgroups, name) {
+				if name == "kubepods" {
+					return "kubernetes"
+				}
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func (impl *ServerImpl) OSInfoCommand(ctx context.Context) (*wshrpc.CommandOSInfoRtnData, error) {
+	rtn := &wshrpc.CommandOSInfoRtnData{
+		Os:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		PrettyName: readOsReleaseField("PRETTY_NAME"),
+		Container:  detectContainer(),
+	}
+	// partial info is still useful, fields that can't be read are left empty
+	info, err := host.InfoWithContext(ctx)
+	if err != nil && info == nil {
+		rtn.Hostname, _ = os.Hostname()
+		return rtn, nil
+	}
+	rtn.Hostname = info.Hostname
+	rtn.Platform = info.Platform
+	rtn.PlatformFamily = info.PlatformFamily
+	rtn.PlatformVersion = info.PlatformVersion
+	rtn.KernelVersion = info.KernelVersion
+	rtn.KernelArch = info.KernelArch
+	if info.VirtualizationRole == "guest" {
+		// gopsutil reports containers as virtualization systems too
+		if containerVirtSystems[info.VirtualizationSystem] {
+			if rtn.Container == "" {
+				rtn.Container = info.VirtualizationSystem
+			}
+		} else {
+			rtn.Virtualization = info.VirtualizationSystem
+		}
+	}
+	return rtn, nil
+}
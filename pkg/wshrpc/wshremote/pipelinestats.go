@@ -0,0 +1,48 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"sync/atomic"
+
+	"github.com/wavetermdev/waveterm/pkg/util/packetparser"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// per-stage counters for the upstream (stdin) path into the router, enabled with --trace-pipeline.
+// every message passes the stages in order, so a count that falls behind the previous stage shows
+// where messages are stuck or lost.
+type PipelineStats struct {
+	Parse    packetparser.ParseStats // parsed from stdin, delivered to FromRemoteCh
+	Received atomic.Int64            // read from FromRemoteCh by the forwarder
+	Injected atomic.Int64            // accepted by the router's input channel
+	Dropped  atomic.Int64            // dropped by the forwarder (router stalled past --upstream-inject-timeout)
+}
+
+func (s *PipelineStats) Snapshot() *wshrpc.PipelineStatsData {
+	// read in reverse pipeline order, so a later stage can never appear ahead of an earlier one
+	rtn := &wshrpc.PipelineStatsData{Enabled: true}
+	rtn.Dropped = s.Dropped.Load()
+	rtn.Injected = s.Injected.Load()
+	rtn.Received = s.Received.Load()
+	rtn.Delivered = s.Parse.Delivered.Load()
+	rtn.Parsed = s.Parse.Parsed.Load()
+	rtn.RawLines = s.Parse.Raw.Load()
+	rtn.CorruptFrames = s.Parse.Corrupt.Load()
+	rtn.PendingParse = rtn.Parsed - rtn.Delivered
+	rtn.PendingChannel = rtn.Delivered - rtn.Received
+	rtn.PendingInject = rtn.Received - rtn.Injected - rtn.Dropped
+	return rtn
+}
+
+func (impl *ServerImpl) PipelineStatsCommand(ctx context.Context) (*wshrpc.PipelineStatsData, error) {
+	if _, err := impl.getRouter(); err != nil {
+		return nil, err
+	}
+	if impl.PipelineStats == nil {
+		return &wshrpc.PipelineStatsData{Enabled: false}, nil
+	}
+	return impl.PipelineStats.Snapshot(), nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const MinNice = -20
+const MaxNice = 19
+
+func resolvePriorityPid(pid int32) (int, error) {
+	if pid < 0 {
+		return 0, fmt.Errorf("invalid pid %d", pid)
+	}
+	if pid == 0 {
+		return os.Getpid(), nil
+	}
+	return int(pid), nil
+}
+
+func (impl *ServerImpl) GetPriorityCommand(ctx context.Context, data wshrpc.CommandGetPriorityData) (*wshrpc.PriorityData, error) {
+	pid, err := resolvePriorityPid(data.Pid)
+	if err != nil {
+		return nil, err
+	}
+	nice, err := getProcessNice(pid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get priority of pid %d: %w", pid, err)
+	}
+	return &wshrpc.PriorityData{Pid: int32(pid), Nice: nice}, nil
+}
+
+// the kernel also checks ownership, this adds the (clearer) error for raising priority without root
+func (impl *ServerImpl) SetPriorityCommand(ctx context.Context, data wshrpc.CommandSetPriorityData) (*wshrpc.PriorityData, error) {
+	pid, err := resolvePriorityPid(data.Pid)
+	if err != nil {
+		return nil, err
+	}
+	if err := impl.checkWritable(fmt.Sprintf("pid %d", pid)); err != nil {
+		return nil, err
+	}
+	if data.Nice < MinNice || data.Nice > MaxNice {
+		return nil, fmt.Errorf("invalid nice value %d (must be %d to %d)", data.Nice, MinNice, MaxNice)
+	}
+	curNice, err := getProcessNice(pid)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get priority of pid %d: %w", pid, err)
+	}
+	if data.Nice < curNice && os.Geteuid() != 0 {
+		return nil, fmt.Errorf("permission denied: raising the priority of pid %d (nice %d to %d) requires root", pid, curNice, data.Nice)
+	}
+	if err := setProcessNice(pid, data.Nice); err != nil {
+		return nil, fmt.Errorf("cannot set priority of pid %d: %w", pid, err)
+	}
+	impl.Log("[priority] pid %d nice set from %d to %d\n", pid, curNice, data.Nice)
+	return &wshrpc.PriorityData{Pid: int32(pid), Nice: data.Nice}, nil
+}
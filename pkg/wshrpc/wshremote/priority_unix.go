@@ -0,0 +1,27 @@
+//go:build !windows
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"runtime"
+	"syscall"
+)
+
+func getProcessNice(pid int) (int, error) {
+	prio, err := syscall.Getpriority(syscall.PRIO_PROCESS, pid)
+	if err != nil {
+		return 0, err
+	}
+	if runtime.GOOS == "linux" {
+		// the raw linux syscall returns 20-nice (so it is never negative), libc converts it elsewhere
+		return 20 - prio, nil
+	}
+	return prio, nil
+}
+
+func setProcessNice(pid int, nice int) error {
+	return syscall.Setpriority(syscall.PRIO_PROCESS, pid, nice)
+}
@@ -0,0 +1,17 @@
+//go:build windows
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import "errors"
+
+// windows has priority classes instead of nice values
+func getProcessNice(pid int) (int, error) {
+	return 0, errors.New("process priority is not supported on windows")
+}
+
+func setProcessNice(pid int, nice int) error {
+	return errors.New("process priority is not supported on windows")
+}
@@ -0,0 +1,122 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const DefaultProcessListCount = 20
+const MaxProcessListCount = 500
+
+type cachedProc struct {
+	Proc       *process.Process
+	CreateTime int64
+}
+
+// process objects are kept between requests so cpu percent is computed over the refresh interval (like top)
+var procCacheLock = &sync.Mutex{}
+var procCache = make(map[int32]*cachedProc)
+
+func getCachedProc(ctx context.Context, pid int32) (*process.Process, bool, error) {
+	proc, err := process.NewProcessWithContext(ctx, pid)
+	if err != nil {
+		return nil, false, err
+	}
+	createTime, _ := proc.CreateTimeWithContext(ctx)
+	if cached := procCache[pid]; cached != nil && cached.CreateTime == createTime {
+		return cached.Proc, true, nil
+	}
+	procCache[pid] = &cachedProc{Proc: proc, CreateTime: createTime}
+	return proc, false, nil
+}
+
+func getProcessInfo(ctx context.Context, pid int32) (*wshrpc.ProcessInfo, error) {
+	proc, sampled, err := getCachedProc(ctx, pid)
+	if err != nil {
+		return nil, err
+	}
+	cpuPercent, err := proc.PercentWithContext(ctx, 0)
+	if err == nil && !sampled {
+		// first time we've seen this process, fall back to the lifetime average
+		cpuPercent, err = proc.CPUPercentWithContext(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+	rtn := &wshrpc.ProcessInfo{Pid: pid, CpuPercent: cpuPercent}
+	if memInfo, err := proc.MemoryInfoWithContext(ctx); err == nil {
+		rtn.Rss = memInfo.RSS
+	}
+	if name, err := proc.NameWithContext(ctx); err == nil {
+		rtn.Command = name
+	}
+	return rtn, nil
+}
+
+func (impl *ServerImpl) RemoteProcessListCommand(ctx context.Context, data wshrpc.CommandRemoteProcessListData) (*wshrpc.CommandRemoteProcessListRtnData, error) {
+	sortBy := data.SortBy
+	if sortBy == "" {
+		sortBy = wshrpc.ProcessSort_Cpu
+	}
+	if sortBy != wshrpc.ProcessSort_Cpu && sortBy != wshrpc.ProcessSort_Mem {
+		return nil, fmt.Errorf("invalid sort key %q (must be %q or %q)", sortBy, wshrpc.ProcessSort_Cpu, wshrpc.ProcessSort_Mem)
+	}
+	count := data.Count
+	if count <= 0 {
+		count = DefaultProcessListCount
+	}
+	if count > MaxProcessListCount {
+		count = MaxProcessListCount
+	}
+	pids, err := process.PidsWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("cannot list processes: %w", err)
+	}
+	procCacheLock.Lock()
+	defer procCacheLock.Unlock()
+	procs := make([]wshrpc.ProcessInfo, 0, len(pids))
+	livePids := make(map[int32]bool, len(pids))
+	for _, pid := range pids {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		livePids[pid] = true
+		procInfo, err := getProcessInfo(ctx, pid)
+		if err != nil {
+			// process exited or we don't have permission to read it
+			continue
+		}
+		procs = append(procs, *procInfo)
+	}
+	for pid := range procCache {
+		if !livePids[pid] {
+			delete(procCache, pid)
+		}
+	}
+	sort.Slice(procs, func(i, j int) bool {
+		if sortBy == wshrpc.ProcessSort_Mem && procs[i].Rss != procs[j].Rss {
+			return procs[i].Rss > procs[j].Rss
+		}
+		if sortBy == wshrpc.ProcessSort_Cpu && procs[i].CpuPercent != procs[j].CpuPercent {
+			return procs[i].CpuPercent > procs[j].CpuPercent
+		}
+		return procs[i].Pid < procs[j].Pid
+	})
+	if len(procs) > count {
+		procs = procs[:count]
+	}
+	return &wshrpc.CommandRemoteProcessListRtnData{
+		Ts:        time.Now().UnixMilli(),
+		NumProcs:  len(pids),
+		Processes: procs,
+	}, nil
+}
@@ -0,0 +1,150 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/process"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const MaxProcessWatchesPerRoute = 8
+const DefaultProcessWatchInterval = 1 * time.Second
+const MinProcessWatchInterval = 250 * time.Millisecond
+
+var processWatchLock = &sync.Mutex{}
+var processWatchCounts = make(map[string]int) // source route => active watches
+
+func acquireProcessWatch(source string) error {
+	processWatchLock.Lock()
+	defer processWatchLock.Unlock()
+	if processWatchCounts[source] >= MaxProcessWatchesPerRoute {
+		return fmt.Errorf("too many process watches for route %q (max %d)", source, MaxProcessWatchesPerRoute)
+	}
+	processWatchCounts[source]++
+	return nil
+}
+
+func releaseProcessWatch(source string) {
+	processWatchLock.Lock()
+	defer processWatchLock.Unlock()
+	processWatchCounts[source]--
+	if processWatchCounts[source] <= 0 {
+		delete(processWatchCounts, source)
+	}
+}
+
+func processWatchErr(err error) wshrpc.RespOrErrorUnion[wshrpc.ProcessWatchData] {
+	return wshrpc.RespOrErrorUnion[wshrpc.ProcessWatchData]{Error: err}
+}
+
+// the pid may have been reused, so a different create time also counts as exited
+func processWatchExited(ctx context.Context, proc *process.Process, createTime int64) bool {
+	running, err := proc.IsRunningWithContext(ctx)
+	if err != nil || !running {
+		return true
+	}
+	curCreateTime, err := proc.CreateTimeWithContext(ctx)
+	return err != nil || curCreateTime != createTime
+}
+
+// returns false if the process is gone
+func sampleWatchedProcess(ctx context.Context, proc *process.Process) (wshrpc.ProcessWatchData, bool) {
+	rtn := wshrpc.ProcessWatchData{Ts: time.Now().UnixMilli(), Pid: proc.Pid}
+	cpuPercent, err := proc.PercentWithContext(ctx, 0)
+	if err != nil {
+		return rtn, false
+	}
+	rtn.CpuPercent = cpuPercent
+	if memInfo, err := proc.MemoryInfoWithContext(ctx); err == nil {
+		rtn.Rss = memInfo.RSS
+	}
+	if numThreads, err := proc.NumThreadsWithContext(ctx); err == nil {
+		rtn.NumThreads = numThreads
+	}
+	if numFds, err := proc.NumFDsWithContext(ctx); err == nil {
+		rtn.NumFds = numFds
+	}
+	return rtn, true
+}
+
+func (impl *ServerImpl) ProcessWatchCommand(ctx context.Context, data wshrpc.CommandProcessWatchData) chan wshrpc.RespOrErrorUnion[wshrpc.ProcessWatchData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.ProcessWatchData], 16)
+	if data.Pid <= 0 {
+		ch <- processWatchErr(fmt.Errorf("invalid pid %d", data.Pid))
+		close(ch)
+		return ch
+	}
+	interval := DefaultProcessWatchInterval
+	if data.IntervalMs > 0 {
+		interval = max(time.Duration(data.IntervalMs)*time.Millisecond, MinProcessWatchInterval)
+	}
+	proc, err := process.NewProcessWithContext(ctx, data.Pid)
+	if err != nil {
+		ch <- processWatchErr(fmt.Errorf("cannot watch process %d: %w", data.Pid, err))
+		close(ch)
+		return ch
+	}
+	createTime, err := proc.CreateTimeWithContext(ctx)
+	if err != nil {
+		ch <- processWatchErr(fmt.Errorf("cannot watch process %d: %w", data.Pid, err))
+		close(ch)
+		return ch
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	if err := acquireProcessWatch(source); err != nil {
+		ch <- processWatchErr(err)
+		close(ch)
+		return ch
+	}
+	// same as filewatch, only routes connected directly to this router can be tracked
+	localRoute := impl.Router != nil && impl.Router.IsLocalRoute(source)
+	impl.Log("[processwatch] watching pid %d for route %q\n", data.Pid, source)
+	go func() {
+		defer panichandler.PanicHandler("ProcessWatchCommand")
+		defer func() {
+			releaseProcessWatch(source)
+			close(ch)
+			impl.Log("[processwatch] stopped watching pid %d for route %q\n", data.Pid, source)
+		}()
+		// primes the cpu counters, the first packet is sent after one interval
+		proc.PercentWithContext(ctx, 0)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if localRoute && !impl.Router.IsLocalRoute(source) {
+				return
+			}
+			resp, ok := sampleWatchedProcess(ctx, proc)
+			if !ok || processWatchExited(ctx, proc, createTime) {
+				if ctx.Err() != nil {
+					return
+				}
+				resp = wshrpc.ProcessWatchData{Ts: time.Now().UnixMilli(), Pid: data.Pid, Exited: true}
+				select {
+				case ch <- wshrpc.RespOrErrorUnion[wshrpc.ProcessWatchData]{Response: resp}:
+				case <-ctx.Done():
+				}
+				return
+			}
+			select {
+			case ch <- wshrpc.RespOrErrorUnion[wshrpc.ProcessWatchData]{Response: resp}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
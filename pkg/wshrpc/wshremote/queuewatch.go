@@ -0,0 +1,93 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+const DefaultQueueHighWatermark = 24 // of wshutil.DefaultInputChSize (32)
+const DefaultQueueLowWatermark = 8
+const DefaultQueueWatermarkSustain = 5 * time.Second
+const queueWatchInterval = 1 * time.Second
+
+// a route is flagged (ServerEvent_QueueHigh) once its output queue stays at or above High for Sustain,
+// and cleared (ServerEvent_QueueRecovered) when it drops to Low or below
+type QueueWatermarkOpts struct {
+	High    int // 0 disables the monitor
+	Low     int
+	Sustain time.Duration
+}
+
+type queueWatchState struct {
+	HighSince time.Time // zero when below the high watermark
+	Flagged   bool
+	PeakDepth int
+}
+
+// runs forever (until the process exits), meant to be started with go
+func RunQueueWatermarkMonitor(router *wshutil.WshRouter, opts QueueWatermarkOpts) {
+	defer panichandler.PanicHandler("RunQueueWatermarkMonitor")
+	if opts.High <= 0 {
+		return
+	}
+	states := make(map[string]*queueWatchState)
+	ticker := time.NewTicker(queueWatchInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		depths := router.GetRouteQueueDepths()
+		for routeId := range states {
+			if _, found := depths[routeId]; !found {
+				// route is gone, the route:down event already covers it
+				delete(states, routeId)
+			}
+		}
+		now := time.Now()
+		for routeId, depth := range depths {
+			state := states[routeId]
+			if state == nil {
+				if depth < opts.High {
+					continue
+				}
+				state = &queueWatchState{}
+				states[routeId] = state
+			}
+			checkQueueWatermark(routeId, depth, state, opts, now)
+			if !state.Flagged && state.HighSince.IsZero() {
+				delete(states, routeId)
+			}
+		}
+	}
+}
+
+func checkQueueWatermark(routeId string, depth int, state *queueWatchState, opts QueueWatermarkOpts, now time.Time) {
+	state.PeakDepth = max(state.PeakDepth, depth)
+	if state.Flagged {
+		if depth <= opts.Low {
+			state.Flagged = false
+			state.HighSince = time.Time{}
+			data := wshrpc.QueueWatermarkEventData{RouteId: routeId, Depth: depth, PeakDepth: state.PeakDepth, Watermark: opts.Low}
+			PublishServerEvent(ServerEvent_QueueRecovered, data, "route %q output queue recovered (%d queued, peak %d)", routeId, depth, state.PeakDepth)
+			state.PeakDepth = 0
+		}
+		return
+	}
+	if depth < opts.High {
+		state.HighSince = time.Time{}
+		state.PeakDepth = 0
+		return
+	}
+	if state.HighSince.IsZero() {
+		state.HighSince = now
+	}
+	if now.Sub(state.HighSince) >= opts.Sustain {
+		state.Flagged = true
+		data := wshrpc.QueueWatermarkEventData{RouteId: routeId, Depth: depth, PeakDepth: state.PeakDepth, Watermark: opts.High}
+		PublishServerEvent(ServerEvent_QueueHigh, data, "route %q output queue at %d for %v (high watermark %d)", routeId, depth, now.Sub(state.HighSince).Round(time.Second), opts.High)
+	}
+}
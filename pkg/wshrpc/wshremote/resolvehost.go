@@ -0,0 +1,90 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const DefaultResolveHostTimeout = 5 * time.Second
+const MaxResolveHostTimeout = 30 * time.Second
+const resolvConfFile = "/etc/resolv.conf"
+
+// nameservers and search domains the system resolver uses (best effort, missing on windows)
+func readResolvConf() ([]string, []string) {
+	file, err := os.Open(resolvConfFile)
+	if err != nil {
+		return nil, nil
+	}
+	defer file.Close()
+	var nameservers, searchDomains []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			nameservers = append(nameservers, fields[1])
+		case "search", "domain":
+			// the last of these wins
+			searchDomains = fields[1:]
+		}
+	}
+	return nameservers, searchDomains
+}
+
+func (impl *ServerImpl) ResolveHostCommand(ctx context.Context, data wshrpc.CommandResolveHostData) (*wshrpc.CommandResolveHostRtnData, error) {
+	host := strings.TrimSpace(data.Host)
+	if host == "" {
+		return nil, errors.New("no host given")
+	}
+	if len(host) > 253 {
+		return nil, fmt.Errorf("invalid host %q (too long)", host)
+	}
+	timeout := DefaultResolveHostTimeout
+	if data.TimeoutMs > 0 {
+		timeout = min(time.Duration(data.TimeoutMs)*time.Millisecond, MaxResolveHostTimeout)
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, timeout)
+	defer cancelFn()
+	rtn := &wshrpc.CommandResolveHostRtnData{Host: host}
+	rtn.Nameservers, rtn.SearchDomains = readResolvConf()
+	startTime := time.Now()
+	var err error
+	if net.ParseIP(host) != nil {
+		rtn.Names, err = net.DefaultResolver.LookupAddr(ctx, host)
+	} else {
+		rtn.Addrs, err = net.DefaultResolver.LookupHost(ctx, host)
+		if err == nil {
+			// only reported when it differs from the host, a failed cname lookup is ignored
+			if cname, cnameErr := net.DefaultResolver.LookupCNAME(ctx, host); cnameErr == nil && strings.TrimSuffix(cname, ".") != strings.TrimSuffix(host, ".") {
+				rtn.CName = cname
+			}
+		}
+	}
+	rtn.DurationMs = time.Since(startTime).Milliseconds()
+	if err != nil {
+		rtn.Error = err.Error()
+		var dnsErr *net.DNSError
+		if errors.As(err, &dnsErr) {
+			rtn.NotFound = dnsErr.IsNotFound
+			rtn.TimedOut = dnsErr.IsTimeout
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			rtn.TimedOut = true
+		}
+	}
+	return rtn, nil
+}
@@ -0,0 +1,172 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wavebase"
+)
+
+// resolves the --root-dir value to a clean absolute path with all symlinks evaluated
+func ResolveRootDir(rootDir string) (string, error) {
+	if rootDir == "" {
+		return "", nil
+	}
+	expanded, err := wavebase.ExpandHomeDir(rootDir)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(expanded)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve root dir %q: %w", rootDir, err)
+	}
+	realPath, err := filepath.EvalSymlinks(absPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve root dir %q: %w", rootDir, err)
+	}
+	finfo, err := os.Stat(realPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot stat root dir %q: %w", rootDir, err)
+	}
+	if !finfo.IsDir() {
+		return "", fmt.Errorf("root dir %q is not a directory", rootDir)
+	}
+	return realPath, nil
+}
+
+func isPathInDir(path string, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// like the kernel's limit, a chain of dangling symlinks longer than this is refused
+const maxSymlinkHops = 40
+
+// evaluates symlinks for the longest existing prefix of path (the rest of the path may not exist yet)
+func evalExistingSymlinks(path string) (string, error) {
+	return evalExistingSymlinksHops(path, 0)
+}
+
+func evalExistingSymlinksHops(path string, hops int) (string, error) {
+	var rest []string
+	curPath := path
+	for {
+		realPath, err := filepath.EvalSymlinks(curPath)
+		if err == nil {
+			return joinRest(realPath, rest), nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return "", err
+		}
+		// EvalSymlinks fails on a dangling symlink just like on a missing file, but opening (or creating)
+		// through the link writes to its target, so the target is evaluated in its place
+		if finfo, lstatErr := os.Lstat(curPath); lstatErr == nil && finfo.Mode()&fs.ModeSymlink != 0 {
+			if hops >= maxSymlinkHops {
+				return "", fmt.Errorf("too many levels of symbolic links at %q", curPath)
+			}
+			target, err := os.Readlink(curPath)
+			if err != nil {
+				return "", err
+			}
+			if hasInnerDotDot(target) {
+				// the kernel follows any symlink before the "..", joining would clean it away lexically
+				return "", fmt.Errorf("cannot resolve symlink %q (target %q)", curPath, target)
+			}
+			if !filepath.IsAbs(target) {
+				// the link's dir exists (the link is in it), evaluated first so a ".." in the target is not cleaned lexically
+				linkDir, err := filepath.EvalSymlinks(filepath.Dir(curPath))
+				if err != nil {
+					return "", err
+				}
+				target = filepath.Join(linkDir, target)
+			}
+			return evalExistingSymlinksHops(joinRest(target, rest), hops+1)
+		}
+		parent := filepath.Dir(curPath)
+		if parent == curPath {
+			return path, nil
+		}
+		rest = append(rest, filepath.Base(curPath))
+		curPath = parent
+	}
+}
+
+// a ".." after a regular component (leading ones are fine, they apply to an already evaluated dir)
+func hasInnerDotDot(path string) bool {
+	seenName := false
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		switch part {
+		case "", ".":
+		case "..":
+			if seenName {
+				return true
+			}
+		default:
+			seenName = true
+		}
+	}
+	return false
+}
+
+// rest holds the stripped components innermost first
+func joinRest(path string, rest []string) string {
+	for i := len(rest) - 1; i >= 0; i-- {
+		path = filepath.Join(path, rest[i])
+	}
+	return path
+}
+
+// the same server (quiesce, logs, stats and the rest of the state are shared) with its file operations
+// confined to a different root dir (resolved with ResolveRootDir)
+func (impl *ServerImpl) WithRootDir(rootDir string) *ServerImpl {
+	return MakeServerImpl(impl.ServerState, rootDir)
+}
+
+func rootDirErr(path string) error {
+	return fmt.Errorf("%w: path %q is outside of the server root dir", fs.ErrPermission, path)
+}
+
+// expands and cleans the given path.  when a root dir is set, relative paths are resolved against the root,
+// and any path that escapes the root (lexically or via symlinks) returns a permission error
+func (impl *ServerImpl) resolvePath(path string) (string, error) {
+	expanded, err := wavebase.ExpandHomeDir(path)
+	if err != nil {
+		return "", err
+	}
+	if impl.RootDir == "" {
+		return filepath.Clean(expanded), nil
+	}
+	if !filepath.IsAbs(expanded) {
+		expanded = filepath.Join(impl.RootDir, expanded)
+	}
+	cleanedPath := filepath.Clean(expanded)
+	if !isPathInDir(cleanedPath, impl.RootDir) {
+		return "", rootDirErr(path)
+	}
+	realPath, err := evalExistingSymlinks(cleanedPath)
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve path %q: %w", path, err)
+	}
+	if !isPathInDir(realPath, impl.RootDir) {
+		return "", rootDirErr(path)
+	}
+	return cleanedPath, nil
+}
+
+func (impl *ServerImpl) isPathAllowed(path string) bool {
+	if impl.RootDir == "" {
+		return true
+	}
+	_, err := impl.resolvePath(path)
+	return err == nil
+}
@@ -0,0 +1,294 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+func TestWithRootDir_QuiesceThroughRootDirRoute(t *testing.T) {
+	base := MakeServerImpl(&ServerState{Router: wshutil.NewWshRouter()}, "")
+	rootDir, err := ResolveRootDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootImpl := base.WithRootDir(rootDir)
+	registry := MakeServerImplRegistry()
+	registry.SetRouteImpl("sniroute", rootImpl)
+	inputCh := make(chan []byte, 1)
+	outputCh := make(chan []byte, 1)
+	rpc := wshutil.MakeWshRpc(inputCh, outputCh, wshrpc.RpcContext{}, base)
+	rpc.SetServerImplSelector(registry.SelectServerImpl)
+	// the source isn't a local route of the router, so it passes checkAdmin like an upstream request
+	reqBytes, _ := json.Marshal(wshutil.RpcMessage{Command: wshrpc.Command_Quiesce, ReqId: "req1", Source: "sniroute"})
+	inputCh <- reqBytes
+	select {
+	case respBytes := <-outputCh:
+		var resp wshutil.RpcMessage
+		if err := json.Unmarshal(respBytes, &resp); err != nil {
+			t.Fatalf("invalid response: %v", err)
+		}
+		if resp.Error != "" {
+			t.Fatalf("quiesce failed: %s", resp.Error)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no response to quiesce")
+	}
+	if !base.IsQuiesced() {
+		t.Fatalf("quiesce through the root dir route did not quiesce the server")
+	}
+	if rootImpl.RootDir != rootDir || base.RootDir != "" {
+		t.Errorf("unexpected root dirs %q/%q", rootImpl.RootDir, base.RootDir)
+	}
+	base.ConnName = "conn1"
+	if rootImpl.ConnName != "conn1" {
+		t.Errorf("state set on the base impl after WithRootDir is not shared")
+	}
+}
+
+// root/
+//
+//	real/file
+//	inlink -> real (stays inside)
+//	outlink -> outside dir
+//	outfile -> outside/secret
+//
+// outside/secret, outside/sub/
+func makeRootDirTree(t *testing.T) (string, string) {
+	baseDir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rootDir := filepath.Join(baseDir, "root")
+	outsideDir := filepath.Join(baseDir, "outside")
+	for _, dir := range []string{filepath.Join(rootDir, "real"), filepath.Join(outsideDir, "sub")} {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, fileName := range []string{filepath.Join(rootDir, "real", "file"), filepath.Join(outsideDir, "secret")} {
+		if err := os.WriteFile(fileName, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"inlink":  filepath.Join(rootDir, "real"),
+		"outlink": outsideDir,
+		"outfile": filepath.Join(outsideDir, "secret"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(rootDir, name)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+	}
+	return rootDir, outsideDir
+}
+
+func TestResolvePath_RootDirJail(t *testing.T) {
+	rootDir, outsideDir := makeRootDirTree(t)
+	impl := MakeServerImpl(nil, rootDir)
+	tests := []struct {
+		name     string
+		path     string
+		expected string // "" when the path must be refused
+	}{
+		{"root itself", rootDir, rootDir},
+		{"root relative", ".", rootDir},
+		{"relative file", "real/file", filepath.Join(rootDir, "real", "file")},
+		{"absolute file", filepath.Join(rootDir, "real", "file"), filepath.Join(rootDir, "real", "file")},
+		{"dotdot that stays inside", "real/../real/file", filepath.Join(rootDir, "real", "file")},
+		{"dotdot traversal", "../outside/secret", ""},
+		{"nested dotdot traversal", "real/../../outside/secret", ""},
+		{"dotdot to the parent", "..", ""},
+		{"absolute outside", outsideDir, ""},
+		{"absolute outside file", filepath.Join(outsideDir, "secret"), ""},
+		{"absolute dotdot traversal", filepath.Join(rootDir, "..", "outside"), ""},
+		{"symlink to an outside file", "outfile", ""},
+		{"symlink to an outside dir", "outlink", ""},
+		{"symlinked parent dir outside", "outlink/secret", ""},
+		{"symlinked parent dir outside, nested", "outlink/sub", ""},
+		{"nonexistent tail under an outside symlink", "outlink/missing/deeper", ""},
+		{"symlinked parent dir inside", "inlink/file", filepath.Join(rootDir, "inlink", "file")},
+		{"nonexistent tail under an inside symlink", "inlink/missing/deeper", filepath.Join(rootDir, "inlink", "missing", "deeper")},
+		{"nonexistent file", "newdir/newfile", filepath.Join(rootDir, "newdir", "newfile")},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resolved, err := impl.resolvePath(tc.path)
+			if tc.expected == "" {
+				if err == nil {
+					t.Fatalf("expected %q to be refused, got %q", tc.path, resolved)
+				}
+				if !errors.Is(err, fs.ErrPermission) {
+					t.Fatalf("expected a permission error for %q, got %v", tc.path, err)
+				}
+				if impl.isPathAllowed(tc.path) {
+					t.Errorf("isPathAllowed(%q) is true", tc.path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error for %q: %v", tc.path, err)
+			}
+			if resolved != tc.expected {
+				t.Errorf("resolvePath(%q) = %q, expected %q", tc.path, resolved, tc.expected)
+			}
+		})
+	}
+}
+
+func TestResolvePath_NoRootDir(t *testing.T) {
+	impl := MakeServerImpl(nil, "")
+	resolved, err := impl.resolvePath("/a/b/../c")
+	if err != nil || resolved != "/a/c" {
+		t.Fatalf("expected /a/c, got %q (%v)", resolved, err)
+	}
+	if !impl.isPathAllowed("/etc") {
+		t.Errorf("every path is allowed without a root dir")
+	}
+}
+
+func TestEvalExistingSymlinks(t *testing.T) {
+	rootDir, outsideDir := makeRootDirTree(t)
+	tests := []struct {
+		path     string
+		expected string
+	}{
+		{rootDir, rootDir},
+		{filepath.Join(rootDir, "inlink", "file"), filepath.Join(rootDir, "real", "file")},
+		{filepath.Join(rootDir, "outlink", "missing", "deeper"), filepath.Join(outsideDir, "missing", "deeper")},
+		{filepath.Join(rootDir, "missing", "deeper"), filepath.Join(rootDir, "missing", "deeper")},
+	}
+	for _, tc := range tests {
+		realPath, err := evalExistingSymlinks(tc.path)
+		if err != nil {
+			t.Fatalf("evalExistingSymlinks(%q): %v", tc.path, err)
+		}
+		if realPath != tc.expected {
+			t.Errorf("evalExistingSymlinks(%q) = %q, expected %q", tc.path, realPath, tc.expected)
+		}
+	}
+}
+
+func TestResolveRootDir_Symlinked(t *testing.T) {
+	rootDir, _ := makeRootDirTree(t)
+	resolved, err := ResolveRootDir(filepath.Join(rootDir, "inlink"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != filepath.Join(rootDir, "real") {
+		t.Errorf("expected the symlink to be evaluated, got %q", resolved)
+	}
+	if _, err := ResolveRootDir(filepath.Join(rootDir, "real", "file")); err == nil {
+		t.Errorf("expected a file to be refused as root dir")
+	}
+}
+
+// links in root whose targets don't exist yet, writing through them would create the target
+func makeDanglingLinks(t *testing.T, rootDir string, outsideDir string) map[string]string {
+	t.Helper()
+	links := map[string]string{
+		"danglingabs":   filepath.Join(outsideDir, "missing"),
+		"danglingrel":   "../outside/missing",
+		"danglingchain": "danglingabs",
+		"danglingsub":   "real/../../outside/missing", // resolved by the kernel, never lexically
+		"danglingin":    filepath.Join(rootDir, "real", "newfile"),
+		"danglinginrel": "real/newfile",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(rootDir, name)); err != nil {
+			t.Skipf("cannot create symlinks: %v", err)
+		}
+	}
+	return links
+}
+
+func TestResolvePath_DanglingSymlinks(t *testing.T) {
+	rootDir, outsideDir := makeRootDirTree(t)
+	makeDanglingLinks(t, rootDir, outsideDir)
+	impl := MakeServerImpl(nil, rootDir)
+	tests := []struct {
+		path    string
+		allowed bool
+	}{
+		{"danglingabs", false},
+		{"danglingrel", false},
+		{"danglingchain", false},
+		{"danglingsub", false},
+		{"danglingabs/deeper/file", false},
+		{"danglingin", true},
+		{"danglinginrel", true},
+	}
+	for _, tc := range tests {
+		_, err := impl.resolvePath(tc.path)
+		if tc.allowed && err != nil {
+			t.Errorf("resolvePath(%q): %v", tc.path, err)
+		}
+		if !tc.allowed && err == nil {
+			t.Errorf("resolvePath(%q) escaped the root dir through a dangling symlink", tc.path)
+		}
+	}
+	realPath, err := evalExistingSymlinks(filepath.Join(rootDir, "danglingrel", "deeper"))
+	if err != nil || realPath != filepath.Join(outsideDir, "missing", "deeper") {
+		t.Errorf("evalExistingSymlinks of a relative dangling link = %q, %v", realPath, err)
+	}
+}
+
+func TestWriteCommands_DanglingSymlinks(t *testing.T) {
+	rootDir, outsideDir := makeRootDirTree(t)
+	makeDanglingLinks(t, rootDir, outsideDir)
+	impl := MakeServerImpl(nil, rootDir)
+	ctx := context.Background()
+	data64 := base64.StdEncoding.EncodeToString([]byte("x"))
+	writeFns := map[string]func(path string) error{
+		"writefile": func(path string) error {
+			return impl.RemoteWriteFileCommand(ctx, wshrpc.CommandRemoteWriteFileData{Path: path, Data64: data64})
+		},
+		"touch": func(path string) error {
+			return impl.RemoteFileTouchCommand(ctx, path)
+		},
+		"mkdir": func(path string) error {
+			return impl.RemoteMkdirCommand(ctx, path)
+		},
+		"rename dest": func(path string) error {
+			srcPath := filepath.Join(rootDir, "real", "renamesrc")
+			if err := os.WriteFile(srcPath, []byte("x"), 0600); err != nil {
+				t.Fatal(err)
+			}
+			return impl.RemoteFileRenameCommand(ctx, [2]string{srcPath, path})
+		},
+		"filetransferwrite": func(path string) error {
+			_, err := impl.FileTransferWriteCommand(ctx, wshrpc.CommandFileTransferWriteData{Path: path, Size: 1, Data64: data64, Final: true})
+			return err
+		},
+	}
+	for name, writeFn := range writeFns {
+		for _, linkName := range []string{"danglingabs", "danglingrel", "danglingchain", "danglingsub"} {
+			if err := writeFn(linkName); err == nil {
+				t.Errorf("%s through %q succeeded", name, linkName)
+			}
+			if _, err := os.Lstat(filepath.Join(outsideDir, "missing")); err == nil {
+				t.Fatalf("%s through %q created a file outside of the root dir", name, linkName)
+			}
+		}
+	}
+	// a dangling link that stays inside can be written through
+	if err := writeFns["writefile"]("danglingin"); err != nil {
+		t.Fatalf("writefile through a dangling link inside the root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rootDir, "real", "newfile")); err != nil {
+		t.Errorf("the inside target was not created: %v", err)
+	}
+}
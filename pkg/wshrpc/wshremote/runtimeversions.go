@@ -0,0 +1,199 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const RuntimeProbeTimeout = 2 * time.Second
+const RuntimeVersionsCacheTime = time.Minute
+const maxRuntimeProbeOutput = 4096
+
+// only these are ever run (clients pick from them, they can't name arbitrary commands)
+var runtimeProbeArgs = map[string][]string{
+	"git":     {"--version"},
+	"python3": {"--version"},
+	"python":  {"--version"},
+	"node":    {"--version"},
+	"npm":     {"--version"},
+	"go":      {"version"},
+	"rustc":   {"--version"},
+	"cargo":   {"--version"},
+	"ruby":    {"--version"},
+	"java":    {"-version"}, // prints to stderr
+	"docker":  {"--version"},
+}
+
+var DefaultRuntimeProbeTools = []string{"git", "python3", "node", "go"}
+
+// shells whose `--version` is safe to run (others may start an interactive shell)
+var runtimeShellProbes = []string{"bash", "zsh", "fish"}
+
+var runtimeVersionRe = regexp.MustCompile(`\d+(\.\d+)+`)
+
+var runtimeProbeTools atomic.Pointer[[]string]
+
+type cachedRuntimeTool struct {
+	Data    wshrpc.RuntimeToolData
+	Expires time.Time
+}
+
+var runtimeCacheLock = &sync.Mutex{}
+var runtimeCache = make(map[string]cachedRuntimeTool) // tool name (or "shell:<path>") => last probe
+
+// parses the comma separated --runtime-probe-tools value, empty disables probing
+func ParseRuntimeProbeTools(val string) ([]string, error) {
+	rtn := []string{}
+	for _, name := range strings.Split(val, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || slices.Contains(rtn, name) {
+			continue
+		}
+		if _, ok := runtimeProbeArgs[name]; !ok {
+			return nil, fmt.Errorf("unknown tool %q (known tools: %s)", name, strings.Join(KnownRuntimeProbeTools(), ","))
+		}
+		rtn = append(rtn, name)
+	}
+	return rtn, nil
+}
+
+func KnownRuntimeProbeTools() []string {
+	var rtn []string
+	for name := range runtimeProbeArgs {
+		rtn = append(rtn, name)
+	}
+	slices.Sort(rtn)
+	return rtn
+}
+
+func SetRuntimeProbeTools(tools []string) {
+	runtimeProbeTools.Store(&tools)
+}
+
+func GetRuntimeProbeTools() []string {
+	if tools := runtimeProbeTools.Load(); tools != nil {
+		return *tools
+	}
+	return DefaultRuntimeProbeTools
+}
+
+func firstLine(output []byte) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(line)
+}
+
+func runVersionProbe(ctx context.Context, name string, path string, args []string) wshrpc.RuntimeToolData {
+	rtn := wshrpc.RuntimeToolData{Name: name, Found: true, Path: path, ProbeTs: time.Now().UnixMilli()}
+	probeCtx, cancelFn := context.WithTimeout(ctx, RuntimeProbeTimeout)
+	defer cancelFn()
+	cmd := exec.CommandContext(probeCtx, path, args...)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	cmd.WaitDelay = 100 * time.Millisecond
+	err := cmd.Run()
+	if output.Len() > maxRuntimeProbeOutput {
+		output.Truncate(maxRuntimeProbeOutput)
+	}
+	rtn.Raw = firstLine(output.Bytes())
+	if probeCtx.Err() == context.DeadlineExceeded {
+		rtn.Error = fmt.Sprintf("timed out after %v", RuntimeProbeTimeout)
+		return rtn
+	}
+	if err != nil && rtn.Raw == "" {
+		rtn.Error = err.Error()
+		return rtn
+	}
+	rtn.Version = runtimeVersionRe.FindString(rtn.Raw)
+	return rtn
+}
+
+func probeRuntimeTool(ctx context.Context, name string) wshrpc.RuntimeToolData {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		return wshrpc.RuntimeToolData{Name: name, ProbeTs: time.Now().UnixMilli()}
+	}
+	return runVersionProbe(ctx, name, path, runtimeProbeArgs[name])
+}
+
+// cancelled probes (the request went away) are never cached
+func getCachedProbe(ctx context.Context, cacheKey string, noCache bool, probeFn func() wshrpc.RuntimeToolData) wshrpc.RuntimeToolData {
+	if !noCache {
+		runtimeCacheLock.Lock()
+		cached, ok := runtimeCache[cacheKey]
+		runtimeCacheLock.Unlock()
+		if ok && time.Now().Before(cached.Expires) {
+			return cached.Data
+		}
+	}
+	data := probeFn()
+	if ctx.Err() == nil {
+		runtimeCacheLock.Lock()
+		runtimeCache[cacheKey] = cachedRuntimeTool{Data: data, Expires: time.Now().Add(RuntimeVersionsCacheTime)}
+		runtimeCacheLock.Unlock()
+	}
+	return data
+}
+
+func getShellVersion(ctx context.Context, shellPath string, noCache bool) string {
+	if !slices.Contains(runtimeShellProbes, filepath.Base(shellPath)) {
+		return ""
+	}
+	data := getCachedProbe(ctx, "shell:"+shellPath, noCache, func() wshrpc.RuntimeToolData {
+		return runVersionProbe(ctx, filepath.Base(shellPath), shellPath, []string{"--version"})
+	})
+	return data.Version
+}
+
+// probes run in parallel, each bounded by RuntimeProbeTimeout
+func (impl *ServerImpl) RuntimeVersionsCommand(ctx context.Context, data wshrpc.CommandRuntimeVersionsData) (*wshrpc.RuntimeVersionsData, error) {
+	allowed := GetRuntimeProbeTools()
+	tools := allowed
+	if len(data.Tools) > 0 {
+		tools = nil
+		for _, name := range data.Tools {
+			if !slices.Contains(allowed, name) {
+				return nil, fmt.Errorf("tool %q is not probed by this server (probed tools: %s)", name, strings.Join(allowed, ","))
+			}
+			if !slices.Contains(tools, name) {
+				tools = append(tools, name)
+			}
+		}
+	}
+	rtn := &wshrpc.RuntimeVersionsData{Shell: os.Getenv("SHELL"), Tools: make([]wshrpc.RuntimeToolData, len(tools))}
+	var wg sync.WaitGroup
+	for idx, name := range tools {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer panichandler.PanicHandler("RuntimeVersionsCommand")
+			rtn.Tools[idx] = getCachedProbe(ctx, name, data.NoCache, func() wshrpc.RuntimeToolData {
+				return probeRuntimeTool(ctx, name)
+			})
+		}()
+	}
+	if rtn.Shell != "" {
+		rtn.ShellVersion = getShellVersion(ctx, rtn.Shell, data.NoCache)
+	}
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return rtn, nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/evbus"
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// server-internal events, producers publish to ServerEvents and never block.
+// consumers: the server log (and so logtail) and the upstream (a connserver:event wave event).
+const (
+	ServerEvent_RouteUp         = "route:up"
+	ServerEvent_RouteDown       = "route:down"
+	ServerEvent_Deadman         = "route:deadman" // a deadman route missed its keepalive (see wshutil.StartRouteDeadman)
+	ServerEvent_Idle            = "route:idle"    // an idle route didn't answer its ping (--conn-idle-timeout)
+	ServerEvent_Panic           = "panic"
+	ServerEvent_Toggle          = "toggle"
+	ServerEvent_Quiesce         = "quiesce"
+	ServerEvent_Shutdown        = "shutdown"
+	ServerEvent_Issue           = "issue" // see SetServerIssue
+	ServerEvent_IssueCleared    = "issue:cleared"
+	ServerEvent_QueueHigh       = "queue:high" // see RunQueueWatermarkMonitor
+	ServerEvent_QueueRecovered  = "queue:recovered"
+	ServerEvent_Broadcast       = "broadcast"     // operator message, see BroadcastCommand
+	ServerEvent_Listen          = "listen"        // the tcp address wsh clients can connect to, see AdvertiseListenAddr
+	ServerEvent_UpstreamLost    = "upstream:lost" // waiting for a resume (--resume-grace)
+	ServerEvent_UpstreamResumed = "upstream:resumed"
+	ServerEvent_Transfer        = "transfer" // file transfer progress (wshrpc.FileTransferProgressData)
+)
+
+var ServerEvents = evbus.MakeBus()
+
+func PublishServerEvent(evType string, data any, format string, args ...any) {
+	ServerEvents.Publish(evType, fmt.Sprintf(format, args...), data)
+}
+
+// hooks panics (from any goroutine using panichandler) into the event bus
+func InstallPanicEvents() {
+	panichandler.PanicHook = func(debugStr string, panicVal any) {
+		PublishServerEvent(ServerEvent_Panic, nil, "panic in %s: %v", debugStr, panicVal)
+	}
+}
+
+// writes every event to the server log, runs until the bus is closed
+func (impl *ServerImpl) RunServerEventLog() {
+	defer panichandler.PanicHandlerNoTelemetry("RunServerEventLog")
+	sub := ServerEvents.Subscribe(evbus.DefaultBufferSize)
+	for event := range sub.Ch {
+		if event.Dropped > 0 {
+			impl.Log("[event] %d events dropped (log consumer too slow)\n", event.Dropped)
+		}
+		impl.Log("[%s] %s\n", event.Type, event.Message)
+	}
+}
+
+// forwards every event upstream (scoped to connName), runs until the bus is closed
+func RunServerEventPublisher(client *wshutil.WshRpc, connName string) {
+	defer panichandler.PanicHandlerNoTelemetry("RunServerEventPublisher")
+	sub := ServerEvents.Subscribe(evbus.DefaultBufferSize)
+	for event := range sub.Ch {
+		waveEvent := wps.WaveEvent{
+			Event:  wps.Event_ConnServer,
+			Scopes: []string{connName},
+			Data: wshrpc.ConnServerEventData{
+				Type:    event.Type,
+				Ts:      event.Ts,
+				Message: event.Message,
+				Data:    event.Data,
+				Dropped: event.Dropped,
+			},
+		}
+		wshclient.EventPublishCommand(client, waveEvent, &wshrpc.RpcOpts{NoResponse: true})
+	}
+}
+
+// tells the upstream which tcp address (host:port, the resolved port for port 0) the main listener
+// accepts wsh clients on, so jwts for local wsh invocations can carry it as their sock.  published
+// directly instead of through ServerEvents, the listener is up before RunServerEventPublisher subscribes
+func AdvertiseListenAddr(client *wshutil.WshRpc, connName string, addr string) {
+	waveEvent := wps.WaveEvent{
+		Event:  wps.Event_ConnServer,
+		Scopes: []string{connName},
+		Data: wshrpc.ConnServerEventData{
+			Type:    ServerEvent_Listen,
+			Ts:      time.Now().UnixMilli(),
+			Message: fmt.Sprintf("accepting wsh clients on tcp://%s", addr),
+			Data:    addr,
+		},
+	}
+	wshclient.EventPublishCommand(client, waveEvent, &wshrpc.RpcOpts{NoResponse: true})
+}
@@ -0,0 +1,96 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wps"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// ongoing conditions that degrade the server (one per key), newly connected routes are told about the
+// latest one so the ui can warn right away instead of waiting for the problem to recur
+const (
+	ServerIssue_SysInfo  = "sysinfo"
+	ServerIssue_Upstream = "upstream"
+
+	ServerIssueSeverity_Warning = "warning"
+	ServerIssueSeverity_Error   = "error"
+)
+
+var serverIssuesLock = &sync.Mutex{}
+var serverIssues = make(map[string]*wshrpc.ServerIssueData)
+var numServerIssues atomic.Int32 // lets ClearServerIssue skip the lock on hot paths
+
+// publishes a ServerEvent_Issue when the issue is new or its message changed
+func SetServerIssue(key string, severity string, format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	serverIssuesLock.Lock()
+	issue := serverIssues[key]
+	if issue != nil && issue.Severity == severity && issue.Message == message {
+		serverIssuesLock.Unlock()
+		return
+	}
+	issue = &wshrpc.ServerIssueData{Key: key, Severity: severity, Message: message, Ts: time.Now().UnixMilli()}
+	serverIssues[key] = issue
+	numServerIssues.Store(int32(len(serverIssues)))
+	serverIssuesLock.Unlock()
+	PublishServerEvent(ServerEvent_Issue, *issue, "%s %s: %s", key, severity, message)
+}
+
+// publishes a ServerEvent_IssueCleared if the issue was set
+func ClearServerIssue(key string) {
+	if numServerIssues.Load() == 0 {
+		return
+	}
+	serverIssuesLock.Lock()
+	_, found := serverIssues[key]
+	delete(serverIssues, key)
+	numServerIssues.Store(int32(len(serverIssues)))
+	serverIssuesLock.Unlock()
+	if found {
+		PublishServerEvent(ServerEvent_IssueCleared, key, "%s resolved", key)
+	}
+}
+
+// newest first
+func GetServerIssues() []wshrpc.ServerIssueData {
+	serverIssuesLock.Lock()
+	defer serverIssuesLock.Unlock()
+	rtn := make([]wshrpc.ServerIssueData, 0, len(serverIssues))
+	for _, issue := range serverIssues {
+		rtn = append(rtn, *issue)
+	}
+	sort.Slice(rtn, func(i, j int) bool {
+		if rtn[i].Ts != rtn[j].Ts {
+			return rtn[i].Ts > rtn[j].Ts
+		}
+		return rtn[i].Key < rtn[j].Key
+	})
+	return rtn
+}
+
+// sends the latest issue (if any) to a route that just connected, as a connserver:event
+func (impl *ServerImpl) ReplayServerIssue(routeId string) {
+	issues := GetServerIssues()
+	if len(issues) == 0 || impl.Router == nil {
+		return
+	}
+	issue := issues[0]
+	impl.Router.SendEvent(routeId, wps.WaveEvent{
+		Event:  wps.Event_ConnServer,
+		Scopes: []string{impl.ConnName},
+		Data: wshrpc.ConnServerEventData{
+			Type:    ServerEvent_Issue,
+			Ts:      issue.Ts,
+			Message: fmt.Sprintf("%s %s: %s", issue.Key, issue.Severity, issue.Message),
+			Data:    issue,
+		},
+	})
+}
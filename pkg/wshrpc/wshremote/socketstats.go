@@ -0,0 +1,88 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+var routeConnsLock = &sync.Mutex{}
+var routeConns = make(map[string]net.Conn) // listener route => its connection
+
+// called once the listener connection's route is registered
+func RegisterRouteConn(routeId string, conn net.Conn) {
+	routeConnsLock.Lock()
+	defer routeConnsLock.Unlock()
+	routeConns[routeId] = conn
+}
+
+// only removes the entry if it is still this connection (the route id may have been reused)
+func UnregisterRouteConn(routeId string, conn net.Conn) {
+	routeConnsLock.Lock()
+	defer routeConnsLock.Unlock()
+	if routeConns[routeId] == conn {
+		delete(routeConns, routeId)
+	}
+}
+
+func getRouteConn(routeId string) net.Conn {
+	routeConnsLock.Lock()
+	defer routeConnsLock.Unlock()
+	return routeConns[routeId]
+}
+
+// the tcp connection under conn (tls and other wrappers with a NetConn method are unwrapped), nil for
+// other transports
+func getTcpConn(conn net.Conn) *net.TCPConn {
+	if wrapped, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = wrapped.NetConn()
+	}
+	tcpConn, _ := conn.(*net.TCPConn)
+	return tcpConn
+}
+
+func (impl *ServerImpl) SocketStatsCommand(ctx context.Context, data wshrpc.CommandSocketStatsData) (*wshrpc.SocketStatsData, error) {
+	if _, err := impl.getRouter(); err != nil {
+		return nil, err
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	routeId := data.RouteId
+	if routeId == "" {
+		routeId = source
+	}
+	if routeId != source {
+		if err := impl.checkAdmin(ctx); err != nil {
+			return nil, err
+		}
+	}
+	conn := getRouteConn(routeId)
+	if conn == nil {
+		return nil, fmt.Errorf("route %q is not a listener connection", routeId)
+	}
+	rtn := &wshrpc.SocketStatsData{
+		RouteId:    routeId,
+		Transport:  conn.LocalAddr().Network(),
+		LocalAddr:  conn.LocalAddr().String(),
+		RemoteAddr: conn.RemoteAddr().String(),
+	}
+	tcpConn := getTcpConn(conn)
+	if tcpConn == nil {
+		rtn.Reason = fmt.Sprintf("unavailable, not a tcp connection (%s)", rtn.Transport)
+		return rtn, nil
+	}
+	tcpInfo, err := getTcpInfo(tcpConn)
+	if err != nil {
+		rtn.Reason = fmt.Sprintf("unavailable: %v", err)
+		return rtn, nil
+	}
+	rtn.Available = true
+	rtn.Tcp = tcpInfo
+	return rtn, nil
+}
@@ -0,0 +1,65 @@
+//go:build linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/sys/unix"
+)
+
+// indexed by the kernel's TCP_ESTABLISHED... constants (include/net/tcp_states.h)
+var tcpStateNames = []string{
+	"", "ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT1", "FIN_WAIT2", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "CLOSING",
+}
+
+func getTcpInfo(conn *net.TCPConn) (*wshrpc.TcpInfoData, error) {
+	rawConn, err := conn.SyscallConn()
+	if err != nil {
+		return nil, err
+	}
+	var info *unix.TCPInfo
+	var sockErr error
+	err = rawConn.Control(func(fd uintptr) {
+		info, sockErr = unix.GetsockoptTCPInfo(int(fd), unix.IPPROTO_TCP, unix.TCP_INFO)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if sockErr != nil {
+		return nil, fmt.Errorf("getsockopt TCP_INFO: %w", sockErr)
+	}
+	state := fmt.Sprintf("%d", info.State)
+	if int(info.State) < len(tcpStateNames) && info.State > 0 {
+		state = tcpStateNames[info.State]
+	}
+	return &wshrpc.TcpInfoData{
+		State:           state,
+		RttUs:           info.Rtt,
+		RttVarUs:        info.Rttvar,
+		MinRttUs:        info.Min_rtt,
+		RtoUs:           info.Rto,
+		Retransmits:     info.Total_retrans,
+		Lost:            info.Lost,
+		Unacked:         info.Unacked,
+		SndCwnd:         info.Snd_cwnd,
+		SndSsthresh:     info.Snd_ssthresh,
+		SndMss:          info.Snd_mss,
+		RcvWnd:          info.Rcv_wnd,
+		NotSentBytes:    info.Notsent_bytes,
+		BytesSent:       info.Bytes_sent,
+		BytesAcked:      info.Bytes_acked,
+		BytesReceived:   info.Bytes_received,
+		BytesRetrans:    info.Bytes_retrans,
+		DeliveryRate:    info.Delivery_rate,
+		BusyTimeUs:      info.Busy_time,
+		RwndLimitedUs:   info.Rwnd_limited,
+		SndbufLimitedUs: info.Sndbuf_limited,
+	}, nil
+}
@@ -0,0 +1,17 @@
+//go:build !linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"errors"
+	"net"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func getTcpInfo(conn *net.TCPConn) (*wshrpc.TcpInfoData, error) {
+	return nil, errors.New("tcp stats are only supported on linux")
+}
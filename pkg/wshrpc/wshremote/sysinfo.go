@@ -4,12 +4,21 @@
 package wshremote
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"log"
+	mathrand "math/rand"
+	"slices"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/shirou/gopsutil/v4/cpu"
 	"github.com/shirou/gopsutil/v4/mem"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/ratelog"
 	"github.com/wavetermdev/waveterm/pkg/wps"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc/wshclient"
@@ -18,40 +27,242 @@ import (
 
 const BYTES_PER_GB = 1073741824
 
-func getCpuData(values map[string]float64) {
+const DefaultSysInfoInterval = 1 * time.Second
+const MinSysInfoInterval = 100 * time.Millisecond
+const MaxSysInfoInterval = 1 * time.Hour
+
+// read by the sysinfo loop before every wait, a change wakes the loop (so enabling a disabled loop
+// takes effect right away).  0 disables the periodic collection, on-demand refreshes still run
+var sysInfoInterval atomic.Int64
+var sysInfoIntervalCh = make(chan struct{}, 1)
+
+// pending on-demand refreshes, each gets the next collection's result
+var sysInfoRefreshCh = make(chan chan sysInfoRefreshResult, maxPendingSysInfoRefreshes)
+
+const maxPendingSysInfoRefreshes = 16
+
+type sysInfoRefreshResult struct {
+	Data *wshrpc.TimeSeriesData
+	Err  error
+}
+
+func init() {
+	sysInfoInterval.Store(int64(DefaultSysInfoInterval))
+	RegisterSysInfoCollector(SysInfo_Cpu, SysInfoCollectorFunc(getCpuData), true)
+	RegisterSysInfoCollector(SysInfo_Mem, SysInfoCollectorFunc(getMemData), true)
+}
+
+// 0 (disabled) is kept, everything else is clamped to the allowed range
+func clampSysInfoInterval(interval time.Duration) time.Duration {
+	if interval <= 0 {
+		return 0
+	}
+	if interval < MinSysInfoInterval {
+		return MinSysInfoInterval
+	}
+	if interval > MaxSysInfoInterval {
+		return MaxSysInfoInterval
+	}
+	return interval
+}
+
+func GetSysInfoInterval() time.Duration {
+	return time.Duration(sysInfoInterval.Load())
+}
+
+// returns the (clamped) interval that was set
+func SetSysInfoInterval(interval time.Duration) time.Duration {
+	interval = clampSysInfoInterval(interval)
+	sysInfoInterval.Store(int64(interval))
+	select {
+	case sysInfoIntervalCh <- struct{}{}:
+	default:
+	}
+	return interval
+}
+
+const (
+	SysInfo_Cpu    = "cpu"
+	SysInfo_Mem    = "mem"
+	SysInfo_DiskIO = "diskio"
+	SysInfo_Net    = "net"
+	SysInfo_Temp   = "temp"
+	SysInfo_Gpu    = "gpu"
+)
+
+// a sysinfo subsystem, Collect adds its values to the cycle's snapshot (keys prefixed with the
+// subsystem name).  collectors run concurrently with each other, but never with themselves
+type SysInfoCollector interface {
+	Collect(values map[string]float64) error
+}
+
+type SysInfoCollectorFunc func(values map[string]float64) error
+
+func (fn SysInfoCollectorFunc) Collect(values map[string]float64) error {
+	return fn(values)
+}
+
+// all subsystems in collection order
+var AllSysInfoSubsystems []string
+
+// the subsystems collected when --sysinfo-include isn't given, slow ones (e.g. gpu) are opt-in
+var DefaultSysInfoSubsystems []string
+
+var sysInfoCollectors = make(map[string]SysInfoCollector)
+
+// must be called before the sysinfo loop starts (from an init func)
+func RegisterSysInfoCollector(name string, collector SysInfoCollector, enabledByDefault bool) {
+	if sysInfoCollectors[name] != nil {
+		panic(fmt.Sprintf("sysinfo collector %q registered twice", name))
+	}
+	sysInfoCollectors[name] = collector
+	sysInfoCollectorBusy[name] = &atomic.Bool{}
+	AllSysInfoSubsystems = append(AllSysInfoSubsystems, name)
+	if enabledByDefault {
+		DefaultSysInfoSubsystems = append(DefaultSysInfoSubsystems, name)
+	}
+}
+
+// parses a comma separated list of subsystems ("" means the default subsystems, "all" all of them)
+func ParseSysInfoSubsystems(val string) ([]string, error) {
+	val = strings.TrimSpace(val)
+	if val == "" {
+		return DefaultSysInfoSubsystems, nil
+	}
+	if val == "all" {
+		return AllSysInfoSubsystems, nil
+	}
+	rtn := []string{}
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(val, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" || seen[name] {
+			continue
+		}
+		if sysInfoCollectors[name] == nil {
+			return nil, fmt.Errorf("invalid sysinfo subsystem %q (valid subsystems: %s)", name, strings.Join(AllSysInfoSubsystems, ", "))
+		}
+		seen[name] = true
+		rtn = append(rtn, name)
+	}
+	return rtn, nil
+}
+
+func getCpuData(values map[string]float64) error {
 	percentArr, err := cpu.Percent(0, false)
 	if err != nil {
-		return
+		return err
 	}
 	if len(percentArr) > 0 {
 		values[wshrpc.TimeSeries_Cpu] = percentArr[0]
 	}
 	percentArr, err = cpu.Percent(0, true)
 	if err != nil {
-		return
+		return err
 	}
 	for idx, percent := range percentArr {
 		values[wshrpc.TimeSeries_Cpu+":"+strconv.Itoa(idx)] = percent
 	}
+	return nil
 }
 
-func getMemData(values map[string]float64) {
+func getMemData(values map[string]float64) error {
 	memData, err := mem.VirtualMemory()
 	if err != nil {
-		return
+		return err
 	}
 	values["mem:total"] = float64(memData.Total) / BYTES_PER_GB
 	values["mem:available"] = float64(memData.Available) / BYTES_PER_GB
 	values["mem:used"] = float64(memData.Used) / BYTES_PER_GB
 	values["mem:free"] = float64(memData.Free) / BYTES_PER_GB
+	return nil
 }
 
-func generateSingleServerData(client *wshutil.WshRpc, connName string) {
-	now := time.Now()
+const DefaultSysInfoSubsystemTimeout = 2 * time.Second
+
+// set while a subsystem's collector is running.  a collector that is still stuck from an earlier
+// cycle is not started again (so a hung mount doesn't pile up goroutines)
+var sysInfoCollectorBusy = make(map[string]*atomic.Bool)
+
+type sysInfoCollectResult struct {
+	Name   string
+	Values map[string]float64
+	Err    error
+}
+
+// runs the subsystems concurrently, each with its own timeout.  returns the merged values of the
+// subsystems that finished, and the subsystems that timed out (or were still stuck)
+func collectSysInfo(subsystems []string, timeout time.Duration) (map[string]float64, []string, []error) {
+	resultCh := make(chan sysInfoCollectResult, len(subsystems))
+	var unavailable []string
+	started := 0
+	for _, name := range subsystems {
+		collector := sysInfoCollectors[name]
+		busy := sysInfoCollectorBusy[name]
+		if collector == nil || busy == nil {
+			continue
+		}
+		if !busy.CompareAndSwap(false, true) {
+			unavailable = append(unavailable, name)
+			continue
+		}
+		started++
+		go func() {
+			defer panichandler.PanicHandler("collectSysInfo:" + name)
+			defer busy.Store(false)
+			values := make(map[string]float64)
+			err := collector.Collect(values)
+			resultCh <- sysInfoCollectResult{Name: name, Values: values, Err: err}
+		}()
+	}
 	values := make(map[string]float64)
-	getCpuData(values)
-	getMemData(values)
-	tsData := wshrpc.TimeSeriesData{Ts: now.UnixMilli(), Values: values}
+	var errs []error
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	done := make(map[string]bool)
+	for len(done) < started {
+		select {
+		case result := <-resultCh:
+			done[result.Name] = true
+			if result.Err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", result.Name, result.Err))
+				continue
+			}
+			for key, val := range result.Values {
+				values[key] = val
+			}
+		case <-timer.C:
+			for _, name := range subsystems {
+				if !done[name] && sysInfoCollectorBusy[name] != nil && !slices.Contains(unavailable, name) {
+					unavailable = append(unavailable, name)
+				}
+			}
+			return values, unavailable, errs
+		}
+	}
+	return values, unavailable, errs
+}
+
+// a collection only fails if every subsystem failed or timed out (partial data is still published)
+func generateSingleServerData(client *wshutil.WshRpc, connName string, subsystems []string, opts *SysInfoLoopOpts, history *SysInfoHistory) (*wshrpc.TimeSeriesData, error) {
+	now := time.Now()
+	timeout := opts.SubsystemTimeout
+	if timeout <= 0 {
+		timeout = DefaultSysInfoSubsystemTimeout
+	}
+	values, unavailable, errs := collectSysInfo(subsystems, timeout)
+	recordLoadSample(values, now)
+	for _, name := range unavailable {
+		errs = append(errs, fmt.Errorf("%s: timed out after %v", name, timeout))
+	}
+	if len(errs) == len(subsystems) {
+		return nil, errors.Join(errs...)
+	}
+	if len(unavailable) > 0 {
+		ratelog.Printf("sysinfo subsystem(s) %s timed out, sending partial data conn:%s\n", strings.Join(unavailable, ","), connName)
+	}
+	tsData := wshrpc.TimeSeriesData{Ts: now.UnixMilli(), Values: values, Unavailable: unavailable}
+	pusher := opts.Pusher
 	event := wps.WaveEvent{
 		Event:   wps.Event_SysInfo,
 		Scopes:  []string{connName},
@@ -59,14 +270,212 @@ func generateSingleServerData(client *wshutil.WshRpc, connName string) {
 		Persist: 1024,
 	}
 	wshclient.EventPublishCommand(client, event, &wshrpc.RpcOpts{NoResponse: true})
+	if pusher != nil {
+		pusher.Push(tsData)
+	}
+	if history != nil {
+		history.Add(tsData)
+	}
+	publishSysInfoStream(connName, tsData)
+	return &tsData, nil
 }
 
-func RunSysInfoLoop(client *wshutil.WshRpc, connName string) {
+const DefaultMaxSysInfoErrors = 10
+
+const MaxSysInfoJitter = 0.5
+
+type SysInfoLoopOpts struct {
+	Subsystems       []string       // nil for DefaultSysInfoSubsystems, changed at runtime by SetSysInfoCollectors
+	MaxErrors        int            // consecutive failed collections before the loop gives up (0 to never give up)
+	Jitter           float64        // each tick is randomly moved by up to +/- this fraction of the interval (0 to disable)
+	Pusher           *SysInfoPusher // optional external endpoint that also receives every snapshot
+	History          int            // recent snapshots retained for SysInfoHistory (0 to disable)
+	SubsystemTimeout time.Duration  // per-subsystem collection timeout (0 for DefaultSysInfoSubsystemTimeout)
+	Interval         time.Duration  // collection interval, 0 disables the periodic collection (only on-demand refreshes run)
+}
+
+// spreads out collections across many servers that share a backend (avoids synchronized uploads)
+func jitterInterval(interval time.Duration, jitter float64) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	if jitter > MaxSysInfoJitter {
+		jitter = MaxSysInfoJitter
+	}
+	offset := (mathrand.Float64()*2 - 1) * jitter * float64(interval)
+	return interval + time.Duration(offset)
+}
+
+// set when the loop gave up, reported in ServerInfo
+var sysInfoUnavailableErr atomic.Pointer[string]
+
+// returns "" if sysinfo is available
+func GetSysInfoUnavailableError() string {
+	errPtr := sysInfoUnavailableErr.Load()
+	if errPtr == nil {
+		return ""
+	}
+	return *errPtr
+}
+
+func RunSysInfoLoop(client *wshutil.WshRpc, connName string, opts *SysInfoLoopOpts) {
 	defer func() {
 		log.Printf("sysinfo loop ended conn:%s\n", connName)
 	}()
+	if opts == nil {
+		opts = &SysInfoLoopOpts{MaxErrors: DefaultMaxSysInfoErrors, Interval: DefaultSysInfoInterval}
+	}
+	SetSysInfoInterval(opts.Interval)
+	subsystems := opts.Subsystems
+	if subsystems == nil {
+		subsystems = DefaultSysInfoSubsystems
+	}
+	setSysInfoSubsystems(subsystems)
+	if len(subsystems) == 0 {
+		log.Printf("sysinfo collection disabled (no subsystems) conn:%s\n", connName)
+		return
+	}
+	if opts.Pusher != nil {
+		log.Printf("pushing sysinfo to %s conn:%s\n", opts.Pusher.RedactedUrl(), connName)
+		go opts.Pusher.Run(connName)
+	}
+	sysInfoLoopRunning.Store(true)
+	defer sysInfoLoopRunning.Store(false)
+	var history *SysInfoHistory
+	if opts.History > 0 {
+		history = MakeSysInfoHistory(opts.History)
+		sysInfoHistory.Store(history)
+	}
+	if GetSysInfoInterval() == 0 {
+		log.Printf("periodic sysinfo collection disabled (interval 0), on-demand refreshes only conn:%s\n", connName)
+	}
+	numErrors := 0
+	var refreshes []chan sysInfoRefreshResult
+	collect := GetSysInfoInterval() > 0
+	for {
+		if !collect {
+			refreshes = waitSysInfoTick(opts.Jitter)
+		}
+		collect = false
+		refreshes = drainSysInfoRefreshes(refreshes)
+		subsystems = GetSysInfoSubsystems()
+		if len(subsystems) == 0 {
+			// everything was disabled at runtime, that's not a failing collection
+			for _, respCh := range refreshes {
+				respCh <- sysInfoRefreshResult{Err: errors.New("every sysinfo subsystem is disabled")}
+			}
+			refreshes = nil
+			continue
+		}
+		tsData, err := generateSingleServerData(client, connName, subsystems, opts, history)
+		for _, respCh := range refreshes {
+			respCh <- sysInfoRefreshResult{Data: tsData, Err: err}
+		}
+		refreshes = nil
+		if err == nil {
+			numErrors = 0
+			ClearServerIssue(ServerIssue_SysInfo)
+		} else {
+			numErrors++
+			if numErrors == 1 {
+				log.Printf("sysinfo collection failed conn:%s: %v\n", connName, err)
+				SetServerIssue(ServerIssue_SysInfo, ServerIssueSeverity_Warning, "sysinfo collection is failing: %v", err)
+			}
+			if opts.MaxErrors > 0 && numErrors >= opts.MaxErrors {
+				errStr := fmt.Sprintf("sysinfo collection failed %d times in a row: %v", numErrors, err)
+				sysInfoUnavailableErr.Store(&errStr)
+				log.Printf("giving up on sysinfo conn:%s: %s\n", connName, errStr)
+				SetServerIssue(ServerIssue_SysInfo, ServerIssueSeverity_Error, "%s (gave up)", errStr)
+				failSysInfoRefreshes(errors.New(errStr))
+				return
+			}
+		}
+	}
+}
+
+// waits for the next periodic tick or an on-demand refresh (returns the refresh requests).  with the
+// interval at 0 there is no tick, an interval change restarts the wait with the new interval
+func waitSysInfoTick(jitter float64) []chan sysInfoRefreshResult {
+	for {
+		var timer *time.Timer
+		var tickCh <-chan time.Time
+		if interval := GetSysInfoInterval(); interval > 0 {
+			timer = time.NewTimer(jitterInterval(interval, jitter))
+			tickCh = timer.C
+		}
+		var refreshes []chan sysInfoRefreshResult
+		ticked := false
+		select {
+		case <-tickCh:
+			ticked = true
+		case respCh := <-sysInfoRefreshCh:
+			refreshes = append(refreshes, respCh)
+		case <-sysInfoIntervalCh:
+		}
+		if timer != nil {
+			timer.Stop()
+		}
+		if ticked || len(refreshes) > 0 {
+			return refreshes
+		}
+	}
+}
+
+// refreshes requested while a collection was already due share its result
+func drainSysInfoRefreshes(refreshes []chan sysInfoRefreshResult) []chan sysInfoRefreshResult {
 	for {
-		generateSingleServerData(client, connName)
-		time.Sleep(1 * time.Second)
+		select {
+		case respCh := <-sysInfoRefreshCh:
+			refreshes = append(refreshes, respCh)
+		default:
+			return refreshes
+		}
+	}
+}
+
+// the loop gave up, pending (and later) refreshes fail instead of waiting for a collection that won't come
+func failSysInfoRefreshes(err error) {
+	for _, respCh := range drainSysInfoRefreshes(nil) {
+		respCh <- sysInfoRefreshResult{Err: err}
+	}
+}
+
+// an immediate collection (published like a periodic one), works with the periodic collection disabled
+func (impl *ServerImpl) SysInfoRefreshCommand(ctx context.Context) (*wshrpc.TimeSeriesData, error) {
+	if errStr := GetSysInfoUnavailableError(); errStr != "" {
+		return nil, fmt.Errorf("sysinfo is unavailable: %s", errStr)
+	}
+	if !sysInfoLoopRunning.Load() {
+		return nil, errors.New("sysinfo collection is not running on this server")
+	}
+	respCh := make(chan sysInfoRefreshResult, 1)
+	select {
+	case sysInfoRefreshCh <- respCh:
+	default:
+		return nil, fmt.Errorf("too many pending sysinfo refreshes (max %d)", maxPendingSysInfoRefreshes)
+	}
+	select {
+	case result := <-respCh:
+		return result.Data, result.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (impl *ServerImpl) GetSysInfoIntervalCommand(ctx context.Context) (*wshrpc.CommandSysInfoIntervalData, error) {
+	return &wshrpc.CommandSysInfoIntervalData{IntervalMs: GetSysInfoInterval().Milliseconds()}, nil
+}
+
+// returns the interval actually set (clamped to the allowed range), 0 disables the periodic collection
+func (impl *ServerImpl) SetSysInfoIntervalCommand(ctx context.Context, data wshrpc.CommandSysInfoIntervalData) (*wshrpc.CommandSysInfoIntervalData, error) {
+	if data.IntervalMs < 0 {
+		return nil, fmt.Errorf("invalid sysinfo interval %dms", data.IntervalMs)
+	}
+	interval := SetSysInfoInterval(time.Duration(data.IntervalMs) * time.Millisecond)
+	if interval == 0 {
+		impl.Log("[sysinfo] periodic collection disabled, on-demand refreshes only\n")
+	} else {
+		impl.Log("[sysinfo] interval set to %v\n", interval)
 	}
+	return &wshrpc.CommandSysInfoIntervalData{IntervalMs: interval.Milliseconds()}, nil
 }
@@ -0,0 +1,239 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/shirou/gopsutil/v4/disk"
+	"github.com/shirou/gopsutil/v4/net"
+	"github.com/shirou/gopsutil/v4/sensors"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const BYTES_PER_MB = 1048576
+
+func init() {
+	RegisterSysInfoCollector(SysInfo_DiskIO, &rateCollector{Name: SysInfo_DiskIO, ReadFn: readDiskIOCounters}, true)
+	RegisterSysInfoCollector(SysInfo_Net, &rateCollector{Name: SysInfo_Net, ReadFn: readNetCounters}, true)
+	RegisterSysInfoCollector(SysInfo_Temp, SysInfoCollectorFunc(getTempData), false)
+	RegisterSysInfoCollector(SysInfo_Gpu, SysInfoCollectorFunc(getGpuData), false)
+}
+
+// the subsystems the loop collects, set when it starts and changed by SetSysInfoCollectors
+var sysInfoEnabled atomic.Pointer[[]string]
+var sysInfoEnabledLock = &sync.Mutex{} // serializes changes
+
+func setSysInfoSubsystems(subsystems []string) {
+	subsystems = slices.Clone(subsystems)
+	sysInfoEnabled.Store(&subsystems)
+}
+
+func GetSysInfoSubsystems() []string {
+	subsystems := sysInfoEnabled.Load()
+	if subsystems == nil {
+		return nil
+	}
+	return *subsystems
+}
+
+// turns cumulative counters into per second rates (in MB/s) between two collections, the first
+// collection only records the counters
+type rateCollector struct {
+	Name   string
+	ReadFn func() (map[string]uint64, error)
+	Lock   sync.Mutex
+	PrevTs time.Time
+	Prev   map[string]uint64
+}
+
+func (rc *rateCollector) Collect(values map[string]float64) error {
+	counters, err := rc.ReadFn()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	rc.Lock.Lock()
+	defer rc.Lock.Unlock()
+	if rc.Prev != nil {
+		elapsed := now.Sub(rc.PrevTs).Seconds()
+		for key, val := range counters {
+			prevVal, ok := rc.Prev[key]
+			// a counter that went backwards was reset (or wrapped), skip it for this cycle
+			if !ok || val < prevVal || elapsed <= 0 {
+				continue
+			}
+			values[rc.Name+":"+key] = float64(val-prevVal) / elapsed / BYTES_PER_MB
+		}
+	}
+	rc.Prev = counters
+	rc.PrevTs = now
+	return nil
+}
+
+// layered and virtual block devices would count the same io twice (or aren't disks at all)
+var skipDiskPrefixes = []string{"loop", "ram", "zram", "dm-", "md", "sr"}
+
+// partitions are skipped when their disk is listed too (sda1 of sda, nvme0n1p1 of nvme0n1)
+func isDiskPartition(name string, allNames map[string]bool) bool {
+	if name == "" || name[len(name)-1] < '0' || name[len(name)-1] > '9' {
+		return false
+	}
+	for other := range allNames {
+		if other != name && strings.HasPrefix(name, other) {
+			return true
+		}
+	}
+	return false
+}
+
+func readDiskIOCounters() (map[string]uint64, error) {
+	counters, err := disk.IOCounters()
+	if err != nil {
+		return nil, err
+	}
+	allNames := make(map[string]bool)
+	for name := range counters {
+		allNames[name] = true
+	}
+	var read, write uint64
+	for name, stat := range counters {
+		if slices.ContainsFunc(skipDiskPrefixes, func(prefix string) bool { return strings.HasPrefix(name, prefix) }) {
+			continue
+		}
+		if isDiskPartition(name, allNames) {
+			continue
+		}
+		read += stat.ReadBytes
+		write += stat.WriteBytes
+	}
+	return map[string]uint64{"read": read, "write": write}, nil
+}
+
+func readNetCounters() (map[string]uint64, error) {
+	counters, err := net.IOCounters(true)
+	if err != nil {
+		return nil, err
+	}
+	var sent, recv uint64
+	for _, stat := range counters {
+		if stat.Name == "lo" || strings.HasPrefix(stat.Name, "Loopback") {
+			continue
+		}
+		sent += stat.BytesSent
+		recv += stat.BytesRecv
+	}
+	return map[string]uint64{"sent": sent, "recv": recv}, nil
+}
+
+// keys become part of the value names, e.g. "temp:coretemp_package_id_0"
+func sanitizeSensorKey(key string) string {
+	return strings.Map(func(ch rune) rune {
+		if ch == ':' || ch == ' ' {
+			return '_'
+		}
+		return ch
+	}, strings.ToLower(key))
+}
+
+// degrees celsius per sensor, plus "temp:max" over all of them
+func getTempData(values map[string]float64) error {
+	temps, err := sensors.SensorsTemperatures()
+	// some sensors failing is reported as a warning along with the others
+	if len(temps) == 0 {
+		if err != nil {
+			return err
+		}
+		return errors.New("no temperature sensors found")
+	}
+	maxTemp := math.Inf(-1)
+	for _, temp := range temps {
+		if temp.Temperature <= 0 {
+			continue
+		}
+		values[SysInfo_Temp+":"+sanitizeSensorKey(temp.SensorKey)] = temp.Temperature
+		maxTemp = max(maxTemp, temp.Temperature)
+	}
+	if !math.IsInf(maxTemp, -1) {
+		values[SysInfo_Temp+":max"] = maxTemp
+	}
+	return nil
+}
+
+// per gpu (by index): "gpu:0:util" (percent), "gpu:0:mem" (GB used), "gpu:0:temp" (celsius), only the
+// values the driver reports.  no gpu is no values, not an error
+func getGpuData(values map[string]float64) error {
+	info := sampleGpus(context.Background())
+	if info.Error != "" {
+		return errors.New(info.Error)
+	}
+	for _, gpu := range info.Gpus {
+		prefix := SysInfo_Gpu + ":" + strconv.Itoa(gpu.Index) + ":"
+		setFn := func(key string, jsonName string, val float64) {
+			if !slices.Contains(gpu.Unsupported, jsonName) {
+				values[prefix+key] = val
+			}
+		}
+		setFn("util", "utilpercent", gpu.UtilPercent)
+		setFn("mem", "memused", float64(gpu.MemUsed)/BYTES_PER_GB)
+		setFn("temp", "tempc", gpu.TempC)
+	}
+	return nil
+}
+
+func getSysInfoCollectorInfo() *wshrpc.CommandSysInfoCollectorsRtnData {
+	enabled := GetSysInfoSubsystems()
+	rtn := &wshrpc.CommandSysInfoCollectorsRtnData{Collectors: []wshrpc.SysInfoCollectorInfo{}}
+	for _, name := range AllSysInfoSubsystems {
+		rtn.Collectors = append(rtn.Collectors, wshrpc.SysInfoCollectorInfo{
+			Name:    name,
+			Enabled: slices.Contains(enabled, name),
+			Default: slices.Contains(DefaultSysInfoSubsystems, name),
+		})
+	}
+	return rtn
+}
+
+func (impl *ServerImpl) GetSysInfoCollectorsCommand(ctx context.Context) (*wshrpc.CommandSysInfoCollectorsRtnData, error) {
+	return getSysInfoCollectorInfo(), nil
+}
+
+func (impl *ServerImpl) SetSysInfoCollectorsCommand(ctx context.Context, data wshrpc.CommandSetSysInfoCollectorsData) (*wshrpc.CommandSysInfoCollectorsRtnData, error) {
+	if !sysInfoLoopRunning.Load() {
+		return nil, errors.New("sysinfo collection is not running on this server")
+	}
+	for _, name := range slices.Concat(data.Enable, data.Disable) {
+		if sysInfoCollectors[name] == nil {
+			return nil, fmt.Errorf("invalid sysinfo subsystem %q (valid subsystems: %s)", name, strings.Join(AllSysInfoSubsystems, ", "))
+		}
+	}
+	sysInfoEnabledLock.Lock()
+	defer sysInfoEnabledLock.Unlock()
+	enabled := GetSysInfoSubsystems()
+	var newEnabled []string
+	for _, name := range AllSysInfoSubsystems {
+		if slices.Contains(data.Disable, name) {
+			continue
+		}
+		if slices.Contains(enabled, name) || slices.Contains(data.Enable, name) {
+			newEnabled = append(newEnabled, name)
+		}
+	}
+	setSysInfoSubsystems(newEnabled)
+	if len(newEnabled) == 0 {
+		impl.Log("[sysinfo] every subsystem disabled\n")
+	} else {
+		impl.Log("[sysinfo] collecting %s\n", strings.Join(newEnabled, ","))
+	}
+	return getSysInfoCollectorInfo(), nil
+}
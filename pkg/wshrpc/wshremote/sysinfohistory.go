@@ -0,0 +1,104 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const DefaultSysInfoHistory = 60
+const MaxSysInfoHistory = 3600
+
+// ring buffer of the most recent sysinfo snapshots (shared by all clients)
+type SysInfoHistory struct {
+	Lock  *sync.Mutex
+	Items []wshrpc.TimeSeriesData
+	Start int
+	Count int
+}
+
+// nil when --sysinfo-history is 0 (or the sysinfo loop is not running)
+var sysInfoHistory atomic.Pointer[SysInfoHistory]
+
+func MakeSysInfoHistory(size int) *SysInfoHistory {
+	size = min(max(size, 1), MaxSysInfoHistory)
+	return &SysInfoHistory{Lock: &sync.Mutex{}, Items: make([]wshrpc.TimeSeriesData, size)}
+}
+
+func (h *SysInfoHistory) Add(tsData wshrpc.TimeSeriesData) {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	idx := (h.Start + h.Count) % len(h.Items)
+	h.Items[idx] = tsData
+	if h.Count < len(h.Items) {
+		h.Count++
+	} else {
+		h.Start = (h.Start + 1) % len(h.Items)
+	}
+}
+
+// oldest first, only snapshots newer than sinceTs (0 for all), at most maxItems (0 for all, keeps the newest)
+func (h *SysInfoHistory) Snapshot(sinceTs int64, maxItems int) []wshrpc.TimeSeriesData {
+	h.Lock.Lock()
+	defer h.Lock.Unlock()
+	var rtn []wshrpc.TimeSeriesData
+	for i := 0; i < h.Count; i++ {
+		item := h.Items[(h.Start+i)%len(h.Items)]
+		if item.Ts > sinceTs {
+			rtn = append(rtn, item)
+		}
+	}
+	if maxItems > 0 && len(rtn) > maxItems {
+		rtn = rtn[len(rtn)-maxItems:]
+	}
+	return rtn
+}
+
+func (h *SysInfoHistory) Size() int {
+	return len(h.Items)
+}
+
+func encodeSysInfoHistory(items []wshrpc.TimeSeriesData) (string, error) {
+	var buf bytes.Buffer
+	gzWriter := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gzWriter).Encode(items); err != nil {
+		return "", err
+	}
+	if err := gzWriter.Close(); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// lets a reconnecting client backfill its graphs (the sysinfo events it missed are not replayed)
+func (impl *ServerImpl) SysInfoHistoryCommand(ctx context.Context, data wshrpc.CommandSysInfoHistoryData) (*wshrpc.CommandSysInfoHistoryRtnData, error) {
+	history := sysInfoHistory.Load()
+	if history == nil {
+		return nil, errors.New("sysinfo history is not enabled (--sysinfo-history)")
+	}
+	if data.MaxItems < 0 {
+		return nil, fmt.Errorf("invalid maxitems %d", data.MaxItems)
+	}
+	items := history.Snapshot(data.SinceTs, data.MaxItems)
+	data64, err := encodeSysInfoHistory(items)
+	if err != nil {
+		return nil, fmt.Errorf("cannot encode sysinfo history: %w", err)
+	}
+	return &wshrpc.CommandSysInfoHistoryRtnData{
+		Count:       len(items),
+		HistorySize: history.Size(),
+		IntervalMs:  GetSysInfoInterval().Milliseconds(),
+		Data64:      data64,
+	}, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const SysInfoPushTimeout = 10 * time.Second
+const SysInfoPushMinBackoff = 1 * time.Second
+const SysInfoPushMaxBackoff = 1 * time.Minute
+
+// the JSON body POSTed to the push url (one snapshot per request, Content-Type application/json).
+// values uses the same keys as the sysinfo event ("cpu", "cpu:0", "mem:total", ...), mem values are in GB
+type SysInfoPushData struct {
+	Host   string             `json:"host"`
+	Conn   string             `json:"conn"`
+	Ts     int64              `json:"ts"` // unix millis
+	Values map[string]float64 `json:"values"`
+}
+
+// posts sysinfo snapshots to an external endpoint. only the latest snapshot is kept, so a slow or
+// failing endpoint never blocks the collection loop (stale snapshots are dropped instead)
+type SysInfoPusher struct {
+	Url    string
+	Token  string // sent as a bearer token if set
+	Host   string
+	client *http.Client
+	ch     chan wshrpc.TimeSeriesData
+}
+
+func MakeSysInfoPusher(pushUrl string, token string) (*SysInfoPusher, error) {
+	parsedUrl, err := url.Parse(pushUrl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sysinfo push url: %w", err)
+	}
+	if parsedUrl.Scheme != "http" && parsedUrl.Scheme != "https" {
+		return nil, fmt.Errorf("invalid sysinfo push url %q (must be http or https)", parsedUrl.Redacted())
+	}
+	if parsedUrl.Host == "" {
+		return nil, fmt.Errorf("invalid sysinfo push url %q (no host)", parsedUrl.Redacted())
+	}
+	hostName, _ := os.Hostname()
+	return &SysInfoPusher{
+		Url:    pushUrl,
+		Token:  token,
+		Host:   hostName,
+		client: &http.Client{Timeout: SysInfoPushTimeout},
+		ch:     make(chan wshrpc.TimeSeriesData, 1),
+	}, nil
+}
+
+// url with any userinfo password removed (safe to log)
+func (p *SysInfoPusher) RedactedUrl() string {
+	parsedUrl, err := url.Parse(p.Url)
+	if err != nil {
+		return ""
+	}
+	return parsedUrl.Redacted()
+}
+
+// never blocks, replaces a snapshot that hasn't been sent yet
+func (p *SysInfoPusher) Push(tsData wshrpc.TimeSeriesData) {
+	for {
+		select {
+		case p.ch <- tsData:
+			return
+		default:
+		}
+		select {
+		case <-p.ch:
+		default:
+		}
+	}
+}
+
+func (p *SysInfoPusher) post(connName string, tsData wshrpc.TimeSeriesData) error {
+	body, err := json.Marshal(SysInfoPushData{Host: p.Host, Conn: connName, Ts: tsData.Ts, Values: tsData.Values})
+	if err != nil {
+		return err
+	}
+	ctx, cancelFn := context.WithTimeout(context.Background(), SysInfoPushTimeout)
+	defer cancelFn()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if p.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+p.Token)
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("push endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// sends snapshots until the process exits. failures back off exponentially, retrying with the newest snapshot
+func (p *SysInfoPusher) Run(connName string) {
+	defer panichandler.PanicHandler("SysInfoPusher.Run")
+	backoff := time.Duration(0)
+	numFailures := 0
+	tsData := <-p.ch
+	for {
+		err := p.post(connName, tsData)
+		if err == nil {
+			if numFailures > 0 {
+				log.Printf("sysinfo push to %s recovered after %d failures\n", p.RedactedUrl(), numFailures)
+			}
+			numFailures = 0
+			backoff = 0
+			tsData = <-p.ch
+			continue
+		}
+		numFailures++
+		if backoff == 0 {
+			backoff = SysInfoPushMinBackoff
+			log.Printf("sysinfo push to %s failed: %v (retrying with backoff)\n", p.RedactedUrl(), err)
+		} else {
+			backoff = min(backoff*2, SysInfoPushMaxBackoff)
+		}
+		time.Sleep(backoff)
+		select {
+		case tsData = <-p.ch:
+		default:
+		}
+	}
+}
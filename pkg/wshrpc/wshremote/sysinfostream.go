@@ -0,0 +1,240 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
+)
+
+// SysInfoStream formats.  every collection produces one packet, the values are the same as the
+// sysinfo event ("cpu" and "cpu:N" are percent, "mem:*" are GB).  subsystems that timed out are
+// simply missing from that packet.
+//
+// influx (InfluxDB line protocol), one line per collection:
+//
+//	wave_sysinfo,host=<hostname>,conn=<conn name> cpu=12.5,cpu_0=10.1,mem_total=15.5 <unix ns>
+//
+//	measurement  wave_sysinfo
+//	tags         host (os.Hostname), conn (omitted when empty)
+//	fields       one float field per value, the key with ":" replaced by "_" (cpu:0 => cpu_0)
+//	timestamp    the collection time in nanoseconds (ms precision)
+//
+// csv, one row per value (long format, so the columns don't change with the cpu count or subsystems):
+//
+//	ts,host,conn,key,value
+//	1700000000000,myhost,conn1,cpu:0,10.1
+//
+//	ts is unix ms, key is the sysinfo key unchanged.  the header is only sent in the first packet.
+const (
+	SysInfoFormat_Json   = "json"
+	SysInfoFormat_Influx = "influx"
+	SysInfoFormat_Csv    = "csv"
+)
+
+const SysInfoInfluxMeasurement = "wave_sysinfo"
+const MaxSysInfoStreamsPerRoute = 4
+const sysInfoStreamBufferSize = 8
+
+var sysInfoCsvHeader = []string{"ts", "host", "conn", "key", "value"}
+
+type sysInfoStreamItem struct {
+	Conn string
+	Data wshrpc.TimeSeriesData
+}
+
+type sysInfoStreamSub struct {
+	ch      chan sysInfoStreamItem
+	dropped atomic.Int32
+}
+
+var sysInfoStreamLock = &sync.Mutex{}
+var sysInfoStreamSubs = make(map[*sysInfoStreamSub]string) // sub => source route
+var sysInfoLoopRunning atomic.Bool
+
+func addSysInfoStreamSub(source string) (*sysInfoStreamSub, error) {
+	sysInfoStreamLock.Lock()
+	defer sysInfoStreamLock.Unlock()
+	count := 0
+	for _, subSource := range sysInfoStreamSubs {
+		if subSource == source {
+			count++
+		}
+	}
+	if count >= MaxSysInfoStreamsPerRoute {
+		return nil, fmt.Errorf("too many sysinfo streams for route %q (max %d)", source, MaxSysInfoStreamsPerRoute)
+	}
+	sub := &sysInfoStreamSub{ch: make(chan sysInfoStreamItem, sysInfoStreamBufferSize)}
+	sysInfoStreamSubs[sub] = source
+	return sub, nil
+}
+
+func removeSysInfoStreamSub(sub *sysInfoStreamSub) {
+	sysInfoStreamLock.Lock()
+	defer sysInfoStreamLock.Unlock()
+	delete(sysInfoStreamSubs, sub)
+}
+
+// called with every collection, never blocks (a slow subscriber loses snapshots, counted in Dropped)
+func publishSysInfoStream(connName string, tsData wshrpc.TimeSeriesData) {
+	sysInfoStreamLock.Lock()
+	defer sysInfoStreamLock.Unlock()
+	for sub := range sysInfoStreamSubs {
+		select {
+		case sub.ch <- sysInfoStreamItem{Conn: connName, Data: tsData}:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+func sortedSysInfoKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key, val := range values {
+		if math.IsNaN(val) || math.IsInf(val, 0) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var influxEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\n`)
+
+// one line protocol record, "" if there are no values
+func formatSysInfoInflux(host string, connName string, tsData wshrpc.TimeSeriesData) string {
+	keys := sortedSysInfoKeys(tsData.Values)
+	if len(keys) == 0 {
+		return ""
+	}
+	var buf strings.Builder
+	buf.WriteString(SysInfoInfluxMeasurement)
+	if host != "" {
+		buf.WriteString(",host=" + influxEscaper.Replace(host))
+	}
+	if connName != "" {
+		buf.WriteString(",conn=" + influxEscaper.Replace(connName))
+	}
+	for idx, key := range keys {
+		if idx == 0 {
+			buf.WriteByte(' ')
+		} else {
+			buf.WriteByte(',')
+		}
+		buf.WriteString(influxEscaper.Replace(strings.ReplaceAll(key, ":", "_")))
+		buf.WriteByte('=')
+		buf.WriteString(strconv.FormatFloat(tsData.Values[key], 'f', -1, 64))
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(tsData.Ts*1_000_000, 10))
+	buf.WriteByte('\n')
+	return buf.String()
+}
+
+func formatSysInfoCsv(host string, connName string, tsData wshrpc.TimeSeriesData, header bool) string {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	if header {
+		writer.Write(sysInfoCsvHeader)
+	}
+	tsStr := strconv.FormatInt(tsData.Ts, 10)
+	for _, key := range sortedSysInfoKeys(tsData.Values) {
+		writer.Write([]string{tsStr, host, connName, key, strconv.FormatFloat(tsData.Values[key], 'f', -1, 64)})
+	}
+	writer.Flush()
+	return buf.String()
+}
+
+func sysInfoStreamErr(err error) wshrpc.RespOrErrorUnion[wshrpc.SysInfoStreamData] {
+	return wshrpc.RespOrErrorUnion[wshrpc.SysInfoStreamData]{Error: err}
+}
+
+// uses the server's collection loop (no extra sampling), packets arrive at the sysinfo interval
+func (impl *ServerImpl) SysInfoStreamCommand(ctx context.Context, data wshrpc.CommandSysInfoStreamData) chan wshrpc.RespOrErrorUnion[wshrpc.SysInfoStreamData] {
+	ch := make(chan wshrpc.RespOrErrorUnion[wshrpc.SysInfoStreamData], 16)
+	sendErr := func(err error) chan wshrpc.RespOrErrorUnion[wshrpc.SysInfoStreamData] {
+		ch <- sysInfoStreamErr(err)
+		close(ch)
+		return ch
+	}
+	format := data.Format
+	if format == "" {
+		format = SysInfoFormat_Json
+	}
+	if format != SysInfoFormat_Json && format != SysInfoFormat_Influx && format != SysInfoFormat_Csv {
+		return sendErr(fmt.Errorf("invalid format %q (must be %s, %s or %s)", format, SysInfoFormat_Json, SysInfoFormat_Influx, SysInfoFormat_Csv))
+	}
+	if errStr := GetSysInfoUnavailableError(); errStr != "" {
+		return sendErr(fmt.Errorf("sysinfo is unavailable: %s", errStr))
+	}
+	if !sysInfoLoopRunning.Load() {
+		return sendErr(errors.New("sysinfo collection is not running on this server"))
+	}
+	source := wshutil.GetRpcSourceFromContext(ctx)
+	sub, err := addSysInfoStreamSub(source)
+	if err != nil {
+		return sendErr(err)
+	}
+	localRoute := impl.Router != nil && impl.Router.IsLocalRoute(source)
+	hostName, _ := os.Hostname()
+	impl.Log("[sysinfostream] streaming %s sysinfo to route %q\n", format, source)
+	go func() {
+		defer panichandler.PanicHandler("SysInfoStreamCommand")
+		defer func() {
+			removeSysInfoStreamSub(sub)
+			close(ch)
+			impl.Log("[sysinfostream] stopped streaming sysinfo to route %q\n", source)
+		}()
+		streamCtx, cancelFn := context.WithCancel(ctx)
+		defer cancelFn()
+		if localRoute {
+			go func() {
+				defer panichandler.PanicHandler("SysInfoStreamCommand:routecheck")
+				waitForRouteGone(streamCtx, impl.Router, source)
+				cancelFn()
+			}()
+		}
+		sentHeader := false
+		for {
+			var item sysInfoStreamItem
+			select {
+			case <-streamCtx.Done():
+				return
+			case item = <-sub.ch:
+			}
+			resp := wshrpc.SysInfoStreamData{Format: format, Dropped: int(sub.dropped.Swap(0))}
+			switch format {
+			case SysInfoFormat_Influx:
+				resp.Records = formatSysInfoInflux(hostName, item.Conn, item.Data)
+			case SysInfoFormat_Csv:
+				resp.Records = formatSysInfoCsv(hostName, item.Conn, item.Data, !sentHeader)
+				sentHeader = true
+			default:
+				tsData := item.Data
+				resp.Data = &tsData
+			}
+			select {
+			case ch <- wshrpc.RespOrErrorUnion[wshrpc.SysInfoStreamData]{Response: resp}:
+			case <-streamCtx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
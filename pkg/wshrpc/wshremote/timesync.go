@@ -0,0 +1,116 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const timeSyncCmdTimeout = 2 * time.Second
+
+// output of a tool that may not be installed, ok is false (without an error) when it isn't
+func runTimeSyncTool(ctx context.Context, name string, args ...string) (string, bool, error) {
+	if _, err := exec.LookPath(name); err != nil {
+		return "", false, nil
+	}
+	ctx, cancelFn := context.WithTimeout(ctx, timeSyncCmdTimeout)
+	defer cancelFn()
+	output, err := exec.CommandContext(ctx, name, args...).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+			return "", true, fmt.Errorf("%s: %s", name, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", true, fmt.Errorf("%s: %w", name, err)
+	}
+	return string(output), true, nil
+}
+
+// "Key=value" lines (timedatectl show)
+func parseKeyValueLines(output string) map[string]string {
+	rtn := make(map[string]string)
+	for _, line := range strings.Split(output, "\n") {
+		if key, val, found := strings.Cut(strings.TrimSpace(line), "="); found {
+			rtn[key] = val
+		}
+	}
+	return rtn
+}
+
+// `chronyc -c tracking` is one csv line: refid,name,stratum,reftime,offset,...,leap status
+func applyChronyTracking(rtn *wshrpc.TimeSyncStatusData, output string) {
+	fields := strings.Split(strings.TrimSpace(output), ",")
+	if len(fields) < 3 {
+		return
+	}
+	rtn.Daemon = "chronyd"
+	rtn.Source = fields[1]
+	rtn.Stratum, _ = strconv.Atoi(fields[2])
+}
+
+// timedatectl needs systemd as init (sd_booted checks for /run/systemd/system), containers often have
+// the binary without it
+func queryTimedatectl(ctx context.Context, rtn *wshrpc.TimeSyncStatusData) {
+	if _, err := os.Stat("/run/systemd/system"); err != nil {
+		return
+	}
+	output, found, err := runTimeSyncTool(ctx, "timedatectl", "show")
+	if !found {
+		return
+	}
+	if err != nil {
+		rtn.Errors = append(rtn.Errors, err.Error())
+		return
+	}
+	props := parseKeyValueLines(output)
+	rtn.NtpEnabled = props["NTP"] == "yes"
+	if rtn.StatusFrom == "" && props["NTPSynchronized"] != "" {
+		rtn.Synchronized = props["NTPSynchronized"] == "yes"
+		rtn.StatusFrom = "timedatectl"
+	}
+	if rtn.Daemon != "" {
+		return
+	}
+	// only systemd-timesyncd answers show-timesync, it fails for other daemons
+	output, _, err = runTimeSyncTool(ctx, "timedatectl", "show-timesync", "--property=ServerName", "--property=ServerAddress")
+	if err != nil {
+		return
+	}
+	props = parseKeyValueLines(output)
+	if props["ServerName"] != "" || props["ServerAddress"] != "" {
+		rtn.Daemon = "systemd-timesyncd"
+		rtn.Source = props["ServerName"]
+		if rtn.Source == "" {
+			rtn.Source = props["ServerAddress"]
+		}
+	}
+}
+
+// every probe is optional, a host without ntp tooling just reports less
+func (impl *ServerImpl) TimeSyncStatusCommand(ctx context.Context) (*wshrpc.TimeSyncStatusData, error) {
+	rtn := &wshrpc.TimeSyncStatusData{Ts: time.Now().UnixMilli()}
+	if err := readKernelTimeSync(rtn); err != nil {
+		rtn.Errors = append(rtn.Errors, err.Error())
+	}
+	output, found, err := runTimeSyncTool(ctx, "chronyc", "-c", "tracking")
+	if err != nil {
+		rtn.Errors = append(rtn.Errors, err.Error())
+	} else if found {
+		applyChronyTracking(rtn, output)
+	}
+	queryTimedatectl(ctx, rtn)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return rtn, nil
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"fmt"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"golang.org/x/sys/unix"
+)
+
+// from linux/timex.h (not exported by x/sys)
+const (
+	timexStaUnsync = 0x0040
+	timexStaNano   = 0x2000
+	timexTimeError = 5
+)
+
+var timexClockStates = []string{"ok", "insert", "delete", "oop", "wait", "error"}
+
+// Modes 0 only reads the kernel clock state, no privileges needed
+func readKernelTimeSync(rtn *wshrpc.TimeSyncStatusData) error {
+	var timex unix.Timex
+	state, err := unix.Adjtimex(&timex)
+	if err != nil {
+		return fmt.Errorf("adjtimex: %w", err)
+	}
+	if state >= 0 && state < len(timexClockStates) {
+		rtn.ClockState = timexClockStates[state]
+	}
+	rtn.Synchronized = timex.Status&timexStaUnsync == 0 && state != timexTimeError
+	rtn.StatusFrom = "adjtimex"
+	rtn.OffsetUs = int64(timex.Offset)
+	if timex.Status&timexStaNano != 0 {
+		rtn.OffsetUs /= 1000
+	}
+	rtn.MaxErrorUs = int64(timex.Maxerror)
+	rtn.EstErrorUs = int64(timex.Esterror)
+	return nil
+}
@@ -0,0 +1,15 @@
+//go:build !linux
+
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// the kernel clock state is only queried on linux, the ntp tools are still tried
+func readKernelTimeSync(rtn *wshrpc.TimeSyncStatusData) error {
+	return nil
+}
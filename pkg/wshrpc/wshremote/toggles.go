@@ -0,0 +1,102 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshremote
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// runtime toggles, shared by every ServerImpl in the process.  all default to off.
+const (
+	Toggle_Verbose  = "verbose"   // extra logging (e.g. every listener handshake)
+	Toggle_TraceRpc = "trace-rpc" // logs every rpc message received by the connserver
+	Toggle_ReadOnly = "read-only" // rejects file modifications and exec
+)
+
+var AllToggles = []string{Toggle_Verbose, Toggle_TraceRpc, Toggle_ReadOnly}
+
+var toggleLock = &sync.Mutex{}
+var toggleValues = make(map[string]bool)
+var toggleHooks = make(map[string][]func(bool))
+
+func GetToggle(key string) bool {
+	toggleLock.Lock()
+	defer toggleLock.Unlock()
+	return toggleValues[key]
+}
+
+func GetToggles() map[string]bool {
+	toggleLock.Lock()
+	defer toggleLock.Unlock()
+	rtn := make(map[string]bool)
+	for _, key := range AllToggles {
+		rtn[key] = toggleValues[key]
+	}
+	return rtn
+}
+
+func checkToggleKey(key string) error {
+	if !slices.Contains(AllToggles, key) {
+		return fmt.Errorf("invalid toggle %q (valid toggles: %s)", key, strings.Join(AllToggles, ", "))
+	}
+	return nil
+}
+
+// hooks run (outside the lock) every time the toggle is set, so the change takes effect immediately
+func SetToggle(key string, value bool) error {
+	if err := checkToggleKey(key); err != nil {
+		return err
+	}
+	toggleLock.Lock()
+	toggleValues[key] = value
+	hooks := slices.Clone(toggleHooks[key])
+	toggleLock.Unlock()
+	PublishServerEvent(ServerEvent_Toggle, map[string]bool{key: value}, "%s set to %v", key, value)
+	for _, hookFn := range hooks {
+		hookFn(value)
+	}
+	return nil
+}
+
+func AddToggleHook(key string, hookFn func(bool)) {
+	toggleLock.Lock()
+	defer toggleLock.Unlock()
+	toggleHooks[key] = append(toggleHooks[key], hookFn)
+}
+
+func (impl *ServerImpl) checkWritable(path string) error {
+	if GetToggle(Toggle_ReadOnly) {
+		return fmt.Errorf("permission denied: server is read-only (%q)", path)
+	}
+	return nil
+}
+
+// an empty key returns every toggle
+func (impl *ServerImpl) GetToggleCommand(ctx context.Context, data wshrpc.CommandGetToggleData) (*wshrpc.CommandToggleRtnData, error) {
+	toggles := GetToggles()
+	if data.Key == "" {
+		return &wshrpc.CommandToggleRtnData{Toggles: toggles}, nil
+	}
+	if err := checkToggleKey(data.Key); err != nil {
+		return nil, err
+	}
+	return &wshrpc.CommandToggleRtnData{Toggles: map[string]bool{data.Key: toggles[data.Key]}}, nil
+}
+
+// returns every toggle after the change
+func (impl *ServerImpl) SetToggleCommand(ctx context.Context, data wshrpc.CommandSetToggleData) (*wshrpc.CommandToggleRtnData, error) {
+	if err := impl.checkAdmin(ctx); err != nil {
+		return nil, err
+	}
+	if err := SetToggle(data.Key, data.Value); err != nil {
+		return nil, err
+	}
+	return &wshrpc.CommandToggleRtnData{Toggles: GetToggles()}, nil
+}
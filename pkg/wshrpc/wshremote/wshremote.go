@@ -14,10 +14,16 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"github.com/wavetermdev/waveterm/pkg/util/asyncwriter"
+	"github.com/wavetermdev/waveterm/pkg/util/logfile"
+	"github.com/wavetermdev/waveterm/pkg/util/logring"
 	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+	"github.com/wavetermdev/waveterm/pkg/wshutil"
 )
 
 const MaxFileSize = 50 * 1024 * 1024 // 10M
@@ -25,8 +31,33 @@ const MaxDirSize = 1024
 const FileChunkSize = 16 * 1024
 const DirChunkSize = 128
 
+// the state every impl of one server shares (the root dir impls of WithRootDir point to the same one)
+type ServerState struct {
+	LogWriter      io.Writer
+	Router         *wshutil.WshRouter // set when running in router mode (nil otherwise)
+	ConnName       string             // scope for the connserver:event events sent to routes
+	StartTime      time.Time
+	LogBuffer      *logring.LogRing         // recent log lines (for LogTail), nil if disabled
+	LogSink        *asyncwriter.AsyncWriter // non-blocking stdout writer behind LogWriter (for its drop count), may be nil
+	LogFile        *logfile.RotatingFile    // --log-file, nil if the log goes to stderr
+	ConnStats      *ConnDurationHistogram
+	HandshakeStats *HandshakeStats
+	PipelineStats  *PipelineStats               // nil unless --trace-pipeline
+	BufferBudget   *wshutil.BufferBudget        // nil unless --max-buffer-memory
+	Config         *wshrpc.ConnServerConfigData // static server config (for GetServerConfig)
+	quiesced       atomic.Bool                  // when set, the listener closes new connections (existing routes are untouched)
+}
+
 type ServerImpl struct {
-	LogWriter io.Writer
+	*ServerState
+	RootDir string // if set, all file operations are confined to this directory (must be resolved with ResolveRootDir)
+}
+
+func MakeServerImpl(state *ServerState, rootDir string) *ServerImpl {
+	if state == nil {
+		state = &ServerState{}
+	}
+	return &ServerImpl{ServerState: state, RootDir: rootDir}
 }
 
 func (*ServerImpl) WshServerImpl() {}
@@ -91,7 +122,7 @@ func (impl *ServerImpl) remoteStreamFileDir(ctx context.Context, path string, by
 	var fileInfoArr []*wshrpc.FileInfo
 	parent := filepath.Dir(path)
 	parentFileInfo, err := impl.fileInfoInternal(parent, false)
-	if err == nil && parent != path {
+	if err == nil && parent != path && impl.isPathAllowed(parent) {
 		parentFileInfo.Name = ".."
 		parentFileInfo.Size = -1
 		fileInfoArr = append(fileInfoArr, parentFileInfo)
@@ -159,11 +190,17 @@ func (impl *ServerImpl) remoteStreamFileRegular(ctx context.Context, path string
 }
 
 func (impl *ServerImpl) remoteStreamFileInternal(ctx context.Context, data wshrpc.CommandRemoteStreamFileData, dataCallback func(fileInfo []*wshrpc.FileInfo, data []byte)) error {
+	if data.Offset < 0 || data.ExpectedSize < 0 {
+		return errors.New("invalid offset or expected size")
+	}
+	if data.Offset > 0 && data.ByteRange != "" {
+		return errors.New("cannot specify both offset and byterange")
+	}
 	byteRange, err := parseByteRange(data.ByteRange)
 	if err != nil {
 		return err
 	}
-	path, err := wavebase.ExpandHomeDir(data.Path)
+	path, err := impl.resolveRoutePath(ctx, data.Path)
 	if err != nil {
 		return err
 	}
@@ -179,10 +216,21 @@ func (impl *ServerImpl) remoteStreamFileInternal(ctx context.Context, data wshrp
 		return fmt.Errorf("file %q is too large to read, use /wave/stream-file", path)
 	}
 	if finfo.IsDir {
+		if data.Offset > 0 {
+			return fmt.Errorf("cannot resume reading %q: is a directory", path)
+		}
 		return impl.remoteStreamFileDir(ctx, path, byteRange, dataCallback)
-	} else {
-		return impl.remoteStreamFileRegular(ctx, path, byteRange, dataCallback)
 	}
+	if data.ExpectedSize > 0 && finfo.Size != data.ExpectedSize {
+		return fmt.Errorf("cannot resume reading %q: file changed size since the interrupted transfer (expected %d bytes, now %d)", path, data.ExpectedSize, finfo.Size)
+	}
+	if data.Offset > 0 {
+		if data.Offset > finfo.Size {
+			return fmt.Errorf("cannot resume reading %q: offset %d is past the end of the file (%d bytes)", path, data.Offset, finfo.Size)
+		}
+		byteRange = ByteRangeType{Start: data.Offset, End: finfo.Size}
+	}
+	return impl.remoteStreamFileRegular(ctx, path, byteRange, dataCallback)
 }
 
 func (impl *ServerImpl) RemoteStreamFileCommand(ctx context.Context, data wshrpc.CommandRemoteStreamFileData) chan wshrpc.RespOrErrorUnion[wshrpc.CommandRemoteStreamFileRtnData] {
@@ -299,16 +347,29 @@ func resolvePaths(paths []string) string {
 }
 
 func (impl *ServerImpl) RemoteFileJoinCommand(ctx context.Context, paths []string) (*wshrpc.FileInfo, error) {
-	rtnPath := resolvePaths(paths)
+	rtnPath, err := impl.resolveRoutePath(ctx, resolvePaths(paths))
+	if err != nil {
+		return nil, err
+	}
 	return impl.fileInfoInternal(rtnPath, true)
 }
 
 func (impl *ServerImpl) RemoteFileInfoCommand(ctx context.Context, path string) (*wshrpc.FileInfo, error) {
-	return impl.fileInfoInternal(path, true)
+	cleanedPath, err := impl.resolveRoutePath(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return impl.fileInfoInternal(cleanedPath, true)
 }
 
 func (impl *ServerImpl) RemoteFileTouchCommand(ctx context.Context, path string) error {
-	cleanedPath := filepath.Clean(wavebase.ExpandHomeDirSafe(path))
+	if err := impl.checkWritable(path); err != nil {
+		return err
+	}
+	cleanedPath, err := impl.resolveRoutePath(ctx, path)
+	if err != nil {
+		return err
+	}
 	if _, err := os.Stat(cleanedPath); err == nil {
 		return fmt.Errorf("file %q already exists", path)
 	}
@@ -322,10 +383,22 @@ func (impl *ServerImpl) RemoteFileTouchCommand(ctx context.Context, path string)
 }
 
 func (impl *ServerImpl) RemoteFileRenameCommand(ctx context.Context, pathTuple [2]string) error {
+	// both ends are written (the source is removed, the destination created)
+	for _, checkPath := range pathTuple {
+		if err := impl.checkWritable(checkPath); err != nil {
+			return err
+		}
+	}
 	path := pathTuple[0]
 	newPath := pathTuple[1]
-	cleanedPath := filepath.Clean(wavebase.ExpandHomeDirSafe(path))
-	cleanedNewPath := filepath.Clean(wavebase.ExpandHomeDirSafe(newPath))
+	cleanedPath, err := impl.resolveRoutePath(ctx, path)
+	if err != nil {
+		return err
+	}
+	cleanedNewPath, err := impl.resolveRoutePath(ctx, newPath)
+	if err != nil {
+		return err
+	}
 	if _, err := os.Stat(cleanedNewPath); err == nil {
 		return fmt.Errorf("destination file path %q already exists", path)
 	}
@@ -336,7 +409,13 @@ func (impl *ServerImpl) RemoteFileRenameCommand(ctx context.Context, pathTuple [
 }
 
 func (impl *ServerImpl) RemoteMkdirCommand(ctx context.Context, path string) error {
-	cleanedPath := filepath.Clean(wavebase.ExpandHomeDirSafe(path))
+	if err := impl.checkWritable(path); err != nil {
+		return err
+	}
+	cleanedPath, err := impl.resolveRoutePath(ctx, path)
+	if err != nil {
+		return err
+	}
 	if stat, err := os.Stat(cleanedPath); err == nil {
 		if stat.IsDir() {
 			return fmt.Errorf("directory %q already exists", path)
@@ -350,8 +429,11 @@ func (impl *ServerImpl) RemoteMkdirCommand(ctx context.Context, path string) err
 	return nil
 }
 
-func (*ServerImpl) RemoteWriteFileCommand(ctx context.Context, data wshrpc.CommandRemoteWriteFileData) error {
-	path, err := wavebase.ExpandHomeDir(data.Path)
+func (impl *ServerImpl) RemoteWriteFileCommand(ctx context.Context, data wshrpc.CommandRemoteWriteFileData) error {
+	if err := impl.checkWritable(data.Path); err != nil {
+		return err
+	}
+	path, err := impl.resolveRoutePath(ctx, data.Path)
 	if err != nil {
 		return err
 	}
@@ -365,6 +447,12 @@ func (*ServerImpl) RemoteWriteFileCommand(ctx context.Context, data wshrpc.Comma
 	if err != nil {
 		return fmt.Errorf("cannot decode base64 data: %w", err)
 	}
+	if data.Offset < 0 {
+		return fmt.Errorf("invalid offset %d", data.Offset)
+	}
+	if data.Offset > 0 {
+		return resumeWriteFile(path, data.Offset, dataBytes[:n])
+	}
 	err = os.WriteFile(path, dataBytes[:n], createMode)
 	if err != nil {
 		return fmt.Errorf("cannot write file %q: %w", path, err)
@@ -372,12 +460,35 @@ func (*ServerImpl) RemoteWriteFileCommand(ctx context.Context, data wshrpc.Comma
 	return nil
 }
 
-func (*ServerImpl) RemoteFileDeleteCommand(ctx context.Context, path string) error {
-	expandedPath, err := wavebase.ExpandHomeDir(path)
+// the file must be exactly offset bytes long, otherwise it changed since the interrupted transfer
+func resumeWriteFile(path string, offset int64, data []byte) error {
+	fd, err := os.OpenFile(path, os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("cannot resume writing file %q: %w", path, err)
+	}
+	defer fd.Close()
+	finfo, err := fd.Stat()
+	if err != nil {
+		return fmt.Errorf("cannot stat file %q: %w", path, err)
+	}
+	if finfo.Size() != offset {
+		return fmt.Errorf("cannot resume writing file %q: file changed size since the interrupted transfer (expected %d bytes, now %d)", path, offset, finfo.Size())
+	}
+	_, err = fd.WriteAt(data, offset)
+	if err != nil {
+		return fmt.Errorf("cannot write file %q: %w", path, err)
+	}
+	return nil
+}
+
+func (impl *ServerImpl) RemoteFileDeleteCommand(ctx context.Context, path string) error {
+	if err := impl.checkWritable(path); err != nil {
+		return err
+	}
+	cleanedPath, err := impl.resolveRoutePath(ctx, path)
 	if err != nil {
 		return fmt.Errorf("cannot delete file %q: %w", path, err)
 	}
-	cleanedPath := filepath.Clean(expandedPath)
 	err = os.Remove(cleanedPath)
 	if err != nil {
 		return fmt.Errorf("cannot delete file %q: %w", path, err)
@@ -14,6 +14,7 @@ import (
 
 	"github.com/wavetermdev/waveterm/pkg/filestore"
 	"github.com/wavetermdev/waveterm/pkg/ijson"
+	"github.com/wavetermdev/waveterm/pkg/util/logring"
 	"github.com/wavetermdev/waveterm/pkg/vdom"
 	"github.com/wavetermdev/waveterm/pkg/waveobj"
 	"github.com/wavetermdev/waveterm/pkg/wps"
@@ -33,6 +34,8 @@ const (
 	Command_Dispose              = "dispose"         // special (disposes of the route, for multiproxy only)
 	Command_RouteAnnounce        = "routeannounce"   // special (for routing)
 	Command_RouteUnannounce      = "routeunannounce" // special (for routing)
+	Command_Ack                  = "ack"             // special (acknowledges a message sent with ackreq)
+	Command_FlowControl          = "flowcontrol"     // special (router asks a client to slow down / resume, see FlowControlData)
 	Command_Message              = "message"
 	Command_GetMeta              = "getmeta"
 	Command_SetMeta              = "setmeta"
@@ -64,6 +67,7 @@ const (
 	Command_RemoteStreamFile     = "remotestreamfile"
 	Command_RemoteFileInfo       = "remotefileinfo"
 	Command_RemoteFileTouch      = "remotefiletouch"
+	Command_RemoteFileRename     = "remotefilerename"
 	Command_RemoteWriteFile      = "remotewritefile"
 	Command_RemoteFileDelete     = "remotefiledelete"
 	Command_RemoteFileJoin       = "remotefilejoin"
@@ -73,6 +77,71 @@ const (
 	Command_GetVar               = "getvar"
 	Command_SetVar               = "setvar"
 	Command_RemoteMkdir          = "remotemkdir"
+	Command_RemoteProcessList    = "remoteprocesslist"
+	Command_GetSysInfoInterval   = "getsysinfointerval"
+	Command_SetSysInfoInterval   = "setsysinfointerval"
+	Command_SysInfoRefresh       = "sysinforefresh"
+	Command_RouteStats           = "routestats"
+	Command_ResetStats           = "resetstats"
+	Command_ServerInfo           = "serverinfo"
+	Command_Quiesce              = "quiesce"
+	Command_Unquiesce            = "unquiesce"
+	Command_LogTail              = "logtail"
+	Command_GetServerConfig      = "getserverconfig"
+	Command_ResetRoute           = "resetroute"
+	Command_Shutdown             = "shutdown"
+	Command_PipelineStats        = "pipelinestats"
+	Command_FileWatch            = "filewatch"
+	Command_FileSubscribe        = "filesubscribe"
+	Command_FileUnsubscribe      = "fileunsubscribe"
+	Command_DiskUsage            = "diskusage"
+	Command_Exec                 = "exec"
+	Command_ExecInput            = "execinput"
+	Command_FileTail             = "filetail"
+	Command_SysInfoHistory       = "sysinfohistory"
+	Command_GetToggle            = "gettoggle"
+	Command_SetToggle            = "settoggle"
+	Command_EntropyInfo          = "entropyinfo"
+	Command_FdInfo               = "fdinfo"
+	Command_ReloadCert           = "reloadcert"
+	Command_OSInfo               = "osinfo"
+	Command_ProcessWatch         = "processwatch"
+	Command_ResolveHost          = "resolvehost"
+	Command_CpuDetail            = "cpudetail"
+	Command_ListListeners        = "listlisteners"
+	Command_Broadcast            = "broadcast"
+	Command_GetPriority          = "getpriority"
+	Command_SetPriority          = "setpriority"
+	Command_JournalTail          = "journaltail"
+	Command_CheckWritable        = "checkwritable"
+	Command_SocketStats          = "socketstats"
+	Command_ListExec             = "listexec"
+	Command_KillExec             = "killexec"
+	Command_LocaleInfo           = "localeinfo"
+	Command_PauseRoute           = "pauseroute"
+	Command_ResumeRoute          = "resumeroute"
+	Command_FileChecksum         = "filechecksum"
+	Command_RuntimeVersions      = "runtimeversions"
+	Command_SysInfoStream        = "sysinfostream"
+	Command_Capabilities         = "capabilities"
+	Command_Batch                = "batch"
+	Command_MemoryPressure       = "memorypressure"
+	Command_SetCwd               = "setcwd"
+	Command_GetCwd               = "getcwd"
+	Command_TimeSyncStatus       = "timesyncstatus"
+	Command_GpuInfo              = "gpuinfo"
+	Command_Keepalive            = "keepalive"
+	Command_LogFile              = "logfile"
+	Command_CgroupLimits         = "cgrouplimits"
+	Command_RouteInfo            = "routeinfo"
+	Command_ForwardStart         = "forwardstart"
+	Command_ForwardData          = "forwarddata"
+	Command_ForwardStop          = "forwardstop"
+	Command_FileTransferRead     = "filetransferread"
+	Command_FileTransferWrite    = "filetransferwrite"
+	Command_GetSysInfoCollectors = "getsysinfocollectors"
+	Command_SetSysInfoCollectors = "setsysinfocollectors"
+	Command_RouteTrace           = "routetrace"
 
 	Command_ConnStatus       = "connstatus"
 	Command_WslStatus        = "wslstatus"
@@ -175,6 +244,73 @@ type WshRpcInterface interface {
 	RemoteFileJoinCommand(ctx context.Context, paths []string) (*FileInfo, error)
 	RemoteMkdirCommand(ctx context.Context, path string) error
 	RemoteStreamCpuDataCommand(ctx context.Context) chan RespOrErrorUnion[TimeSeriesData]
+	RemoteProcessListCommand(ctx context.Context, data CommandRemoteProcessListData) (*CommandRemoteProcessListRtnData, error)
+	GetSysInfoIntervalCommand(ctx context.Context) (*CommandSysInfoIntervalData, error)
+	SetSysInfoIntervalCommand(ctx context.Context, data CommandSysInfoIntervalData) (*CommandSysInfoIntervalData, error)
+	SysInfoRefreshCommand(ctx context.Context) (*TimeSeriesData, error)
+	SysInfoHistoryCommand(ctx context.Context, data CommandSysInfoHistoryData) (*CommandSysInfoHistoryRtnData, error)
+	GetToggleCommand(ctx context.Context, data CommandGetToggleData) (*CommandToggleRtnData, error)
+	SetToggleCommand(ctx context.Context, data CommandSetToggleData) (*CommandToggleRtnData, error)
+	FileWatchCommand(ctx context.Context, data CommandFileWatchData) chan RespOrErrorUnion[FileWatchEventData]
+	FileSubscribeCommand(ctx context.Context, data CommandFileSubscribeData) (*CommandFileSubscribeRtnData, error)
+	FileUnsubscribeCommand(ctx context.Context, data CommandFileUnsubscribeData) error
+	DiskUsageCommand(ctx context.Context, data CommandDiskUsageData) (*CommandDiskUsageRtnData, error)
+	ExecCommand(ctx context.Context, data CommandExecData) chan RespOrErrorUnion[ExecOutputData]
+	ExecInputCommand(ctx context.Context, data CommandExecInputData) error
+	FileTailCommand(ctx context.Context, data CommandFileTailData) chan RespOrErrorUnion[FileTailData]
+	EntropyInfoCommand(ctx context.Context) (*EntropyInfoData, error)
+	FdInfoCommand(ctx context.Context) (*FdInfoData, error)
+	OSInfoCommand(ctx context.Context) (*CommandOSInfoRtnData, error)
+	ProcessWatchCommand(ctx context.Context, data CommandProcessWatchData) chan RespOrErrorUnion[ProcessWatchData]
+	ResolveHostCommand(ctx context.Context, data CommandResolveHostData) (*CommandResolveHostRtnData, error)
+	CpuDetailCommand(ctx context.Context) (*CpuDetailData, error)
+	ListListenersCommand(ctx context.Context, data CommandListListenersData) (*CommandListListenersRtnData, error)
+	GetPriorityCommand(ctx context.Context, data CommandGetPriorityData) (*PriorityData, error)
+	SetPriorityCommand(ctx context.Context, data CommandSetPriorityData) (*PriorityData, error)
+	JournalTailCommand(ctx context.Context, data CommandJournalTailData) chan RespOrErrorUnion[JournalTailData]
+	CheckWritableCommand(ctx context.Context, data CommandCheckWritableData) (*CheckWritableRtnData, error)
+	ListExecCommand(ctx context.Context) (*CommandListExecRtnData, error)
+	KillExecCommand(ctx context.Context, data CommandKillExecData) error
+	LocaleInfoCommand(ctx context.Context) (*LocaleInfoData, error)
+	FileChecksumCommand(ctx context.Context, data CommandFileChecksumData) (*FileChecksumData, error)
+	RuntimeVersionsCommand(ctx context.Context, data CommandRuntimeVersionsData) (*RuntimeVersionsData, error)
+	SysInfoStreamCommand(ctx context.Context, data CommandSysInfoStreamData) chan RespOrErrorUnion[SysInfoStreamData]
+	CapabilitiesCommand(ctx context.Context) (*CommandCapabilitiesRtnData, error)
+	BatchCommand(ctx context.Context, data CommandBatchData) (*CommandBatchRtnData, error)
+	MemoryPressureCommand(ctx context.Context) (*MemoryPressureData, error)
+	SetCwdCommand(ctx context.Context, data CommandSetCwdData) (*CwdData, error)
+	GetCwdCommand(ctx context.Context) (*CwdData, error)
+	TimeSyncStatusCommand(ctx context.Context) (*TimeSyncStatusData, error)
+	GpuInfoCommand(ctx context.Context, data CommandGpuInfoData) chan RespOrErrorUnion[GpuInfoData]
+	CgroupLimitsCommand(ctx context.Context) (*CgroupLimitsData, error)
+	ForwardStartCommand(ctx context.Context, data CommandForwardStartData) chan RespOrErrorUnion[ForwardPacketData]
+	ForwardDataCommand(ctx context.Context, data CommandForwardDataData) error
+	ForwardStopCommand(ctx context.Context, data CommandForwardStopData) error
+	FileTransferReadCommand(ctx context.Context, data CommandFileTransferReadData) chan RespOrErrorUnion[FileTransferChunkData]
+	FileTransferWriteCommand(ctx context.Context, data CommandFileTransferWriteData) (*FileTransferWriteRtnData, error)
+	GetSysInfoCollectorsCommand(ctx context.Context) (*CommandSysInfoCollectorsRtnData, error)
+	SetSysInfoCollectorsCommand(ctx context.Context, data CommandSetSysInfoCollectorsData) (*CommandSysInfoCollectorsRtnData, error)
+
+	// connserver (router mode)
+	RouteStatsCommand(ctx context.Context, data CommandRouteStatsData) (*CommandRouteStatsRtnData, error)
+	ResetStatsCommand(ctx context.Context) (*CommandRouteStatsRtnData, error)
+	ServerInfoCommand(ctx context.Context) (*CommandServerInfoRtnData, error)
+	QuiesceCommand(ctx context.Context) error
+	UnquiesceCommand(ctx context.Context) error
+	LogTailCommand(ctx context.Context, data CommandLogTailData) (*CommandLogTailRtnData, error)
+	GetServerConfigCommand(ctx context.Context) (*ConnServerConfigData, error)
+	ResetRouteCommand(ctx context.Context, data CommandResetRouteData) (*CommandResetRouteRtnData, error)
+	ShutdownCommand(ctx context.Context, data CommandShutdownData) error
+	PipelineStatsCommand(ctx context.Context) (*PipelineStatsData, error)
+	ReloadCertCommand(ctx context.Context) (*CommandReloadCertRtnData, error)
+	BroadcastCommand(ctx context.Context, data CommandBroadcastData) (*CommandBroadcastRtnData, error)
+	SocketStatsCommand(ctx context.Context, data CommandSocketStatsData) (*SocketStatsData, error)
+	PauseRouteCommand(ctx context.Context, data CommandPauseRouteData) (*PauseRouteRtnData, error)
+	ResumeRouteCommand(ctx context.Context, data CommandResumeRouteData) (*PauseRouteRtnData, error)
+	KeepaliveCommand(ctx context.Context) error
+	LogFileCommand(ctx context.Context, data CommandLogFileData) (*LogFileData, error)
+	RouteInfoCommand(ctx context.Context) (*CommandRouteInfoRtnData, error)
+	RouteTraceCommand(ctx context.Context, data CommandRouteTraceData) chan RespOrErrorUnion[RouteTraceData]
 
 	// emain
 	WebSelectorCommand(ctx context.Context, data CommandWebSelectorData) ([]string, error)
@@ -202,9 +338,11 @@ type WshServerCommandMeta struct {
 }
 
 type RpcOpts struct {
-	Timeout    int    `json:"timeout,omitempty"`
-	NoResponse bool   `json:"noresponse,omitempty"`
-	Route      string `json:"route,omitempty"`
+	Timeout    int               `json:"timeout,omitempty"`
+	Deadline   int64             `json:"deadline,omitempty"` // optional absolute deadline (unix ms), sent to the server so it can stop work the client no longer waits for
+	NoResponse bool              `json:"noresponse,omitempty"`
+	Route      string            `json:"route,omitempty"`
+	Headers    map[string]string `json:"headers,omitempty"` // request metadata, forwarded untouched to the handler (see wshutil.ValidateHeaders for the limits)
 
 	StreamCancelFn func() `json:"-"` // this is an *output* parameter, set by the handler
 }
@@ -214,11 +352,60 @@ const (
 	ClientType_BlockController = "blockcontroller"
 )
 
+// the view of the block that opened a connection (sent in the jwt), unknown views are reported as "other"
+const (
+	BlockType_Term    = "term"
+	BlockType_Preview = "preview"
+	BlockType_Web     = "web"
+	BlockType_WaveAi  = "waveai"
+	BlockType_SysInfo = "sysinfo"
+	BlockType_CpuPlot = "cpuplot"
+	BlockType_Help    = "help"
+	BlockType_Tips    = "tips"
+	BlockType_VDom    = "vdom"
+	BlockType_Other   = "other"
+)
+
+var validBlockTypes = map[string]bool{
+	BlockType_Term: true, BlockType_Preview: true, BlockType_Web: true, BlockType_WaveAi: true, BlockType_SysInfo: true,
+	BlockType_CpuPlot: true, BlockType_Help: true, BlockType_Tips: true, BlockType_VDom: true, BlockType_Other: true,
+}
+
+// returns "" for no block type
+func NormalizeBlockType(blockType string) string {
+	if blockType == "" || validBlockTypes[blockType] {
+		return blockType
+	}
+	return BlockType_Other
+}
+
+// quality of service class a client asks for in its jwt ("" means normal)
+const (
+	QosClass_High   = "high"
+	QosClass_Normal = "normal"
+	QosClass_Low    = "low"
+)
+
+// returns false for an unknown class
+func NormalizeQosClass(qosClass string) (string, bool) {
+	switch qosClass {
+	case "":
+		return QosClass_Normal, true
+	case QosClass_High, QosClass_Normal, QosClass_Low:
+		return qosClass, true
+	}
+	return "", false
+}
+
 type RpcContext struct {
-	ClientType string `json:"ctype,omitempty"`
-	BlockId    string `json:"blockid,omitempty"`
-	TabId      string `json:"tabid,omitempty"`
-	Conn       string `json:"conn,omitempty"`
+	ClientType string   `json:"ctype,omitempty"`
+	BlockId    string   `json:"blockid,omitempty"`
+	BlockType  string   `json:"blocktype,omitempty"`
+	QosClass   string   `json:"qosclass,omitempty"`
+	Scope      []string `json:"scope,omitempty"` // commands the token allows (empty for all), see wshutil.ScopeAllowsCommand
+	TabId      string   `json:"tabid,omitempty"`
+	Conn       string   `json:"conn,omitempty"`
+	RootDir    string   `json:"rootdir,omitempty"` // confines the route's file operations, see wshremote.MakeRootDirClaimServerImplFactory
 }
 
 func HackRpcContextIntoData(dataPtr any, rpcContext RpcContext) {
@@ -255,6 +442,7 @@ func HackRpcContextIntoData(dataPtr any, rpcContext RpcContext) {
 type CommandAuthenticateRtnData struct {
 	RouteId   string `json:"routeid"`
 	AuthToken string `json:"authtoken,omitempty"`
+	DeadmanMs int64  `json:"deadmanms,omitempty"` // negotiated keepalive deadline, 0 if the route has none
 }
 
 type CommandDisposeData struct {
@@ -441,8 +629,55 @@ type FileInfo struct {
 }
 
 type CommandRemoteStreamFileData struct {
-	Path      string `json:"path"`
-	ByteRange string `json:"byterange,omitempty"`
+	Path         string `json:"path"`
+	ByteRange    string `json:"byterange,omitempty"`
+	Offset       int64  `json:"offset,omitempty"`       // resume reading at this offset (cannot be combined with byterange)
+	ExpectedSize int64  `json:"expectedsize,omitempty"` // when resuming, the file size reported by the interrupted transfer
+}
+
+const (
+	FileWatchOp_Create = "create"
+	FileWatchOp_Modify = "modify"
+	FileWatchOp_Delete = "delete"
+	FileWatchOp_Rename = "rename"
+)
+
+// watches a file, or the direct entries of a directory (not recursive).
+// the stream runs until the request times out, is canceled, or the route disconnects
+type CommandFileWatchData struct {
+	Path string `json:"path"`
+}
+
+type FileWatchEventData struct {
+	Ts   int64  `json:"ts"`
+	Path string `json:"path"` // the changed file (may have "~")
+	Op   string `json:"op"`
+}
+
+// like FileWatch, but the changes are pushed to the calling route as file:change events (scoped to the
+// SubId) until it unsubscribes or disconnects.  Path is a file, a directory (its direct entries) or a
+// glob in its last element (e.g. "~/logs/*.log").  Ops are FileWatchOp_*, empty for all of them.
+// routes watching the same directory share one watch
+type CommandFileSubscribeData struct {
+	Path string   `json:"path"`
+	Ops  []string `json:"ops,omitempty"`
+}
+
+type CommandFileSubscribeRtnData struct {
+	SubId string `json:"subid"`
+	Dir   string `json:"dir"` // the watched directory (may have "~")
+}
+
+type CommandFileUnsubscribeData struct {
+	SubId string `json:"subid"`
+}
+
+// the data of a file:change event
+type FileChangeEventData struct {
+	SubId string `json:"subid"`
+	Ts    int64  `json:"ts"`
+	Path  string `json:"path"` // the changed file (may have "~")
+	Op    string `json:"op"`
 }
 
 type CommandRemoteStreamFileRtnData struct {
@@ -454,6 +689,1100 @@ type CommandRemoteWriteFileData struct {
 	Path       string      `json:"path"`
 	Data64     string      `json:"data64"`
 	CreateMode os.FileMode `json:"createmode,omitempty"`
+	Offset     int64       `json:"offset,omitempty"` // resume writing at this offset (the file must currently be exactly this size)
+}
+
+const (
+	ProcessSort_Cpu = "cpu"
+	ProcessSort_Mem = "mem"
+)
+
+type CommandRemoteProcessListData struct {
+	SortBy string `json:"sortby,omitempty"` // "cpu" (default) or "mem"
+	Count  int    `json:"count,omitempty"`  // defaults to 20
+}
+
+type ProcessInfo struct {
+	Pid        int32   `json:"pid"`
+	Command    string  `json:"command"`
+	CpuPercent float64 `json:"cpupercent"`
+	Rss        uint64  `json:"rss"`
+}
+
+type CommandRemoteProcessListRtnData struct {
+	Ts        int64         `json:"ts"`
+	NumProcs  int           `json:"numprocs"` // total number of processes on the host
+	Processes []ProcessInfo `json:"processes"`
+}
+
+// streams samples of one process until the process exits (a last packet with Exited set), the request
+// times out or is canceled, or the route disconnects.  cpu percent is over the sample interval.
+type CommandProcessWatchData struct {
+	Pid        int32 `json:"pid"`
+	IntervalMs int64 `json:"intervalms,omitempty"` // defaults to 1000, min 250
+}
+
+type ProcessWatchData struct {
+	Ts         int64   `json:"ts"`
+	Pid        int32   `json:"pid"`
+	CpuPercent float64 `json:"cpupercent"`
+	Rss        uint64  `json:"rss"`
+	NumThreads int32   `json:"numthreads"`
+	NumFds     int32   `json:"numfds,omitempty"` // 0 if it can't be read (e.g. another user's process)
+	Exited     bool    `json:"exited,omitempty"`
+}
+
+// runs a command (not through a shell).  the stream runs until the command exits, so the request
+// timeout must cover the command's runtime.  the command is killed if the request is canceled or times out.
+// EnvMode "merge" (the default) starts from the server's environment and sets Env on top of it,
+// "replace" runs the command with only Env.  variables protected by the server (--exec-env-deny) can't
+// be set either way, and keep the server's value in replace mode.
+// with Pty set the command runs on a pseudo terminal of TermSize (24x80 if not set), its output comes
+// as stdout packets (stderr is the same terminal)
+type CommandExecData struct {
+	Cmd      string            `json:"cmd"`
+	Args     []string          `json:"args,omitempty"`
+	Cwd      string            `json:"cwd,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	EnvMode  string            `json:"envmode,omitempty"`
+	Pty      bool              `json:"pty,omitempty"`
+	TermSize *waveobj.TermSize `json:"termsize,omitempty"`
+}
+
+const (
+	ExecEnvMode_Merge   = "merge"
+	ExecEnvMode_Replace = "replace"
+)
+
+const (
+	ExecStream_Stdout = "stdout"
+	ExecStream_Stderr = "stderr"
+)
+
+// the first packet has ExecId and Pid set (use ExecId for ExecInput), the last one has Exited set
+type ExecOutputData struct {
+	ExecId   string `json:"execid,omitempty"`
+	Pid      int    `json:"pid,omitempty"`
+	Stream   string `json:"stream,omitempty"`
+	Data64   string `json:"data64,omitempty"`
+	Exited   bool   `json:"exited,omitempty"`
+	ExitCode int    `json:"exitcode,omitempty"` // -1 if the command was killed by a signal
+}
+
+// TermSize resizes the terminal of a pty session
+type CommandExecInputData struct {
+	ExecId   string            `json:"execid"`
+	Data64   string            `json:"data64,omitempty"`
+	Eof      bool              `json:"eof,omitempty"` // closes the command's stdin (after writing Data64), sends ^D on a pty
+	TermSize *waveobj.TermSize `json:"termsize,omitempty"`
+}
+
+// an active exec session (see CommandExecData), CpuPercent is over the time since the previous list
+// (the lifetime average on the first one)
+type ExecSessionInfo struct {
+	ExecId     string   `json:"execid"`
+	Pid        int      `json:"pid"`
+	Cmd        string   `json:"cmd"`
+	Args       []string `json:"args,omitempty"`
+	Cwd        string   `json:"cwd,omitempty"`
+	Pty        bool     `json:"pty,omitempty"`
+	StartTs    int64    `json:"startts"` // unix ms
+	CpuPercent float64  `json:"cpupercent"`
+	Rss        uint64   `json:"rss"`
+}
+
+// the caller's own sessions, oldest first
+type CommandListExecRtnData struct {
+	Sessions []ExecSessionInfo `json:"sessions"`
+}
+
+// kills the command (the session's stream ends with Exited set), only the route that started it may kill it
+type CommandKillExecData struct {
+	ExecId string `json:"execid"`
+}
+
+type CommandDiskUsageData struct {
+	All          bool `json:"all,omitempty"`          // include pseudo filesystems (proc, sysfs, cgroup, ...)
+	IncludeTmpfs bool `json:"includetmpfs,omitempty"` // include memory backed filesystems (tmpfs, devtmpfs, ramfs)
+}
+
+type DiskUsageInfo struct {
+	Path        string  `json:"path"`
+	Device      string  `json:"device"`
+	FsType      string  `json:"fstype"`
+	Total       uint64  `json:"total"` // bytes
+	Used        uint64  `json:"used"`
+	Free        uint64  `json:"free"` // available to unprivileged users
+	UsedPercent float64 `json:"usedpercent"`
+}
+
+type CommandDiskUsageRtnData struct {
+	Filesystems []DiskUsageInfo `json:"filesystems"`
+}
+
+// returns the last lines (default 10) or the last bytes of a file (set one, not both).
+// with follow the stream keeps sending appended data until the request times out, is canceled,
+// or the route disconnects.  otherwise it ends after the first packet.
+type CommandFileTailData struct {
+	Path   string `json:"path"`
+	Lines  int    `json:"lines,omitempty"`
+	Bytes  int64  `json:"bytes,omitempty"`
+	Follow bool   `json:"follow,omitempty"`
+}
+
+// Offset is the file offset just past Data64.  Rotated is set on the first packet after the file
+// was replaced (a new inode at the path), Truncated when the file shrank.  both restart at offset 0.
+type FileTailData struct {
+	Data64    string `json:"data64,omitempty"`
+	Offset    int64  `json:"offset"`
+	Rotated   bool   `json:"rotated,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// Available is false on hosts without /proc/sys/kernel/random (non-linux).  since linux 5.18 the kernel
+// always reports a full pool (256 bits), so Low is only meaningful on older kernels.
+type EntropyInfoData struct {
+	Available    bool `json:"available"`
+	EntropyAvail int  `json:"entropyavail,omitempty"` // bits
+	PoolSize     int  `json:"poolsize,omitempty"`     // bits
+	Low          bool `json:"low,omitempty"`          // below the threshold where crypto (e.g. tls handshakes) may stall
+}
+
+// Open is -1 when the count is not available (no /proc/self/fd or /dev/fd).  the limits are 0 on windows
+type FdInfoData struct {
+	Open        int     `json:"open"`
+	SoftLimit   uint64  `json:"softlimit,omitempty"` // RLIMIT_NOFILE, accepts fail with EMFILE past this
+	HardLimit   uint64  `json:"hardlimit,omitempty"`
+	UsedPercent float64 `json:"usedpercent,omitempty"` // of the soft limit
+}
+
+type CommandOSInfoRtnData struct {
+	Os              string `json:"os"`   // runtime.GOOS
+	Arch            string `json:"arch"` // runtime.GOARCH
+	Hostname        string `json:"hostname,omitempty"`
+	Platform        string `json:"platform,omitempty"`       // distribution id ("ubuntu", "darwin", ...)
+	PlatformFamily  string `json:"platformfamily,omitempty"` // "debian", "rhel", ...
+	PlatformVersion string `json:"platformversion,omitempty"`
+	PrettyName      string `json:"prettyname,omitempty"` // PRETTY_NAME from /etc/os-release
+	KernelVersion   string `json:"kernelversion,omitempty"`
+	KernelArch      string `json:"kernelarch,omitempty"`     // uname -m
+	Container       string `json:"container,omitempty"`      // "docker", "podman", "lxc", "kubernetes", ... (empty if not detected)
+	Virtualization  string `json:"virtualization,omitempty"` // guest virtualization system ("kvm", "xen", ...)
+}
+
+// looks the name up with the server's resolver.  a failed lookup is not an rpc error, it is reported in
+// Error (with the timing and nameservers) so the caller can tell a dns failure from an unreachable server.
+// an ip address is reverse resolved (Names).
+type CommandResolveHostData struct {
+	Host      string `json:"host"`
+	TimeoutMs int64  `json:"timeoutms,omitempty"` // defaults to 5000, max 30000
+}
+
+type CommandResolveHostRtnData struct {
+	Host          string   `json:"host"`
+	Addrs         []string `json:"addrs,omitempty"`
+	CName         string   `json:"cname,omitempty"`
+	Names         []string `json:"names,omitempty"`       // reverse lookup of an ip address
+	Nameservers   []string `json:"nameservers,omitempty"` // from /etc/resolv.conf (empty on windows)
+	SearchDomains []string `json:"searchdomains,omitempty"`
+	DurationMs    int64    `json:"durationms"`
+	Error         string   `json:"error,omitempty"`
+	NotFound      bool     `json:"notfound,omitempty"`
+	TimedOut      bool     `json:"timedout,omitempty"`
+}
+
+// per-core utilization is over the time since the previous cpudetail request when that was recent
+// (up to 10s ago), otherwise over a 250ms sample.  load averages are not available on windows.
+type CpuDetailData struct {
+	Ts            int64     `json:"ts"`
+	LoadAvg1      float64   `json:"loadavg1,omitempty"`
+	LoadAvg5      float64   `json:"loadavg5,omitempty"`
+	LoadAvg15     float64   `json:"loadavg15,omitempty"`
+	LogicalCores  int       `json:"logicalcores"`
+	PhysicalCores int       `json:"physicalcores,omitempty"`
+	TotalPercent  float64   `json:"totalpercent"`
+	CorePercents  []float64 `json:"corepercents"`
+	SampleMs      int64     `json:"samplems"` // window the percentages cover
+}
+
+// swap in/out rates are over the time since the previous memorypressure request when that was recent
+// (up to 60s ago), otherwise over a 1s sample.  Psi is linux only (nil when /proc/pressure is unavailable)
+type MemoryPressureData struct {
+	Ts              int64          `json:"ts"`
+	SwapTotal       uint64         `json:"swaptotal"` // bytes
+	SwapUsed        uint64         `json:"swapused"`
+	SwapUsedPercent float64        `json:"swapusedpercent"`
+	SwapInPerSec    float64        `json:"swapinpersec"` // bytes per second
+	SwapOutPerSec   float64        `json:"swapoutpersec"`
+	MajFaultsPerSec float64        `json:"majfaultspersec,omitempty"` // linux only
+	SampleMs        int64          `json:"samplems"`                  // window the rates cover
+	Psi             *MemoryPsiData `json:"psi,omitempty"`
+}
+
+// /proc/pressure/memory, "some" is the share of time at least one task stalled on memory, "full" all
+// non-idle tasks at once.  averages are percent over 10s/60s/300s, totals are cumulative microseconds
+type MemoryPsiData struct {
+	Some PsiLineData `json:"some"`
+	Full PsiLineData `json:"full"`
+}
+
+type PsiLineData struct {
+	Avg10  float64 `json:"avg10"`
+	Avg60  float64 `json:"avg60"`
+	Avg300 float64 `json:"avg300"`
+	Total  uint64  `json:"total"`
+}
+
+// the resource limits of the cgroup the server runs in (limits set on a parent cgroup count too, the
+// tightest one wins).  Limited is false (with Message set) when no cpu, memory or pids limit applies
+type CgroupLimitsData struct {
+	Ts           int64   `json:"ts"`
+	Version      int     `json:"version"` // 1 or 2, 0 if no cgroup filesystem was found
+	Path         string  `json:"path,omitempty"`
+	Limited      bool    `json:"limited"`
+	Message      string  `json:"message,omitempty"`  // e.g. "not containerized"
+	CpuLimit     float64 `json:"cpulimit,omitempty"` // cpus (quota / period), 0 for no limit
+	CpuQuotaUs   int64   `json:"cpuquotaus,omitempty"`
+	CpuPeriodUs  int64   `json:"cpuperiodus,omitempty"`
+	CpusetCpus   string  `json:"cpusetcpus,omitempty"` // e.g. "0-3,6"
+	CpusetCount  int     `json:"cpusetcount,omitempty"`
+	CpuUsageUs   uint64  `json:"cpuusageus,omitempty"` // cumulative
+	NrThrottled  uint64  `json:"nrthrottled,omitempty"`
+	ThrottledUs  uint64  `json:"throttledus,omitempty"`
+	MemLimit     uint64  `json:"memlimit,omitempty"` // bytes, 0 for no limit
+	MemUsage     uint64  `json:"memusage"`
+	MemPercent   float64 `json:"mempercent,omitempty"` // usage of the limit
+	PidsLimit    int64   `json:"pidslimit,omitempty"`
+	PidsCurrent  int64   `json:"pidscurrent,omitempty"`
+	HostCpus     int     `json:"hostcpus"` // for comparison with the limits
+	HostMemTotal uint64  `json:"hostmemtotal,omitempty"`
+}
+
+// samples the host's gpus (nvidia-smi, or the amdgpu sysfs files on linux).  IntervalMs 0 sends a single
+// packet, otherwise a packet every interval (min 1000) until the request times out, is canceled, or the
+// route disconnects.  a host without a gpu gets one packet with Message set and an empty Gpus.
+type CommandGpuInfoData struct {
+	IntervalMs int64 `json:"intervalms,omitempty"`
+}
+
+type GpuInfoData struct {
+	Ts      int64     `json:"ts"`
+	Source  string    `json:"source,omitempty"` // "nvidia-smi" or "sysfs"
+	Gpus    []GpuData `json:"gpus"`
+	Message string    `json:"message,omitempty"` // e.g. "no GPU detected"
+	Error   string    `json:"error,omitempty"`   // this sample failed (e.g. the probe timed out), a stream keeps going
+}
+
+// values the driver doesn't report are zero and listed in Unsupported (by json name)
+type GpuData struct {
+	Index       int      `json:"index"`
+	Name        string   `json:"name"`
+	Vendor      string   `json:"vendor"`
+	BusId       string   `json:"busid,omitempty"`
+	UtilPercent float64  `json:"utilpercent"`
+	MemUsed     uint64   `json:"memused"` // bytes
+	MemTotal    uint64   `json:"memtotal"`
+	TempC       float64  `json:"tempc"`
+	PowerW      float64  `json:"powerw"`
+	PowerLimitW float64  `json:"powerlimitw,omitempty"`
+	Unsupported []string `json:"unsupported,omitempty"`
+}
+
+// listening tcp sockets and bound udp sockets on the host (not just the connserver's).  the owning
+// process is only known for processes we can inspect (our own user's unless running as root).
+type CommandListListenersData struct {
+	Protocol string `json:"protocol,omitempty"` // "tcp", "udp" or empty for both
+	Limit    int    `json:"limit,omitempty"`    // defaults to 1000 (also the max)
+}
+
+type ListenerInfo struct {
+	Protocol string `json:"protocol"` // "tcp", "tcp6", "udp", "udp6"
+	Addr     string `json:"addr"`
+	Port     uint32 `json:"port"`
+	Pid      int32  `json:"pid,omitempty"`
+	Process  string `json:"process,omitempty"`
+}
+
+type CommandListListenersRtnData struct {
+	Listeners []ListenerInfo `json:"listeners"` // sorted by protocol, port
+	Total     int            `json:"total"`
+	Truncated bool           `json:"truncated,omitempty"`
+}
+
+// Pid 0 is the connserver itself.  nice values are -20 (highest priority) to 19 (lowest).
+type CommandGetPriorityData struct {
+	Pid int32 `json:"pid,omitempty"`
+}
+
+// lowering the priority (a higher nice) is allowed for our own processes, raising it requires root
+type CommandSetPriorityData struct {
+	Pid  int32 `json:"pid,omitempty"`
+	Nice int   `json:"nice"`
+}
+
+type PriorityData struct {
+	Pid  int32 `json:"pid"`
+	Nice int   `json:"nice"`
+}
+
+// reads the systemd journal with journalctl.  an empty Unit is the connserver's own unit.  the first
+// packet has the last Lines entries, with Follow each new entry is sent as it is written (until the
+// request times out, is canceled, or the route disconnects).
+type CommandJournalTailData struct {
+	Unit   string `json:"unit,omitempty"`
+	Lines  int    `json:"lines,omitempty"` // defaults to 50, max 1000
+	Follow bool   `json:"follow,omitempty"`
+}
+
+type JournalEntryData struct {
+	Ts       int64  `json:"ts"` // unix ms
+	Unit     string `json:"unit,omitempty"`
+	Priority int    `json:"priority"` // syslog priority, 0 (emerg) to 7 (debug)
+	Pid      int    `json:"pid,omitempty"`
+	Message  string `json:"message"`
+}
+
+type JournalTailData struct {
+	Unit    string             `json:"unit"`
+	Entries []JournalEntryData `json:"entries"`
+}
+
+// pre-flight check for a transfer.  an existing directory is tested by creating (and removing) a temp
+// file in it, an existing file by opening it for writing (without truncating), and a path that doesn't
+// exist yet by testing its nearest existing parent directory.
+type CommandCheckWritableData struct {
+	Path string `json:"path"`
+}
+
+type CheckWritableRtnData struct {
+	Path     string `json:"path"`               // resolved path
+	TestPath string `json:"testpath,omitempty"` // the file or directory that was actually tested
+	Exists   bool   `json:"exists"`
+	IsDir    bool   `json:"isdir,omitempty"`
+	Writable bool   `json:"writable"`
+	Reason   string `json:"reason,omitempty"` // why it isn't writable
+}
+
+// Ts is the server's clock (unix ms) when the response was built, compare it with the client's clock for drift.
+// the date/number formats come from the system locale database (glibc `locale`), empty when unavailable
+type LocaleInfoData struct {
+	Ts             int64             `json:"ts"`
+	Timezone       string            `json:"timezone,omitempty"`       // IANA name, e.g. "Europe/Berlin"
+	TimezoneSource string            `json:"timezonesource,omitempty"` // "TZ", "/etc/localtime" or "/etc/timezone"
+	TzAbbrev       string            `json:"tzabbrev"`                 // e.g. "CEST"
+	UtcOffsetSec   int               `json:"utcoffsetsec"`
+	Dst            bool              `json:"dst,omitempty"`
+	Locale         string            `json:"locale"`                 // effective LC_CTYPE, "C" if nothing is set
+	TimeLocale     string            `json:"timelocale"`             // effective LC_TIME
+	NumericLocale  string            `json:"numericlocale"`          // effective LC_NUMERIC
+	LocaleSource   string            `json:"localesource,omitempty"` // "env" or the system locale file
+	LocaleVars     map[string]string `json:"localevars,omitempty"`   // the LANG/LC_* variables that are set
+	DateFormat     string            `json:"dateformat,omitempty"`   // strftime, e.g. "%m/%d/%Y"
+	TimeFormat     string            `json:"timeformat,omitempty"`
+	DateTimeFormat string            `json:"datetimeformat,omitempty"`
+	DecimalPoint   string            `json:"decimalpoint,omitempty"`
+	ThousandsSep   string            `json:"thousandssep,omitempty"`
+}
+
+// Tools selects from the server's probed tools (--runtime-probe-tools), empty means all of them.
+// results are cached briefly, NoCache forces a fresh probe
+type CommandRuntimeVersionsData struct {
+	Tools   []string `json:"tools,omitempty"`
+	NoCache bool     `json:"nocache,omitempty"`
+}
+
+type RuntimeToolData struct {
+	Name    string `json:"name"`
+	Found   bool   `json:"found"`
+	Path    string `json:"path,omitempty"`
+	Version string `json:"version,omitempty"` // e.g. "2.43.0", empty if it couldn't be parsed
+	Raw     string `json:"raw,omitempty"`     // first line of the version output
+	Error   string `json:"error,omitempty"`   // found but the probe failed (or timed out)
+	ProbeTs int64  `json:"probets"`           // unix ms of the probe (older than the response when cached)
+}
+
+type RuntimeVersionsData struct {
+	Shell        string            `json:"shell,omitempty"` // $SHELL
+	ShellVersion string            `json:"shellversion,omitempty"`
+	Tools        []RuntimeToolData `json:"tools"`
+}
+
+// Synchronized comes from the kernel (adjtimex) on linux, or from timedatectl when the kernel can't be
+// queried.  StatusFrom is empty when neither is available (Synchronized is then meaningless).
+// errors are in microseconds, from adjtimex
+type TimeSyncStatusData struct {
+	Ts           int64    `json:"ts"`
+	Synchronized bool     `json:"synchronized"`
+	StatusFrom   string   `json:"statusfrom,omitempty"` // "adjtimex" or "timedatectl"
+	ClockState   string   `json:"clockstate,omitempty"` // kernel clock state: "ok", "insert", "delete", "oop", "wait" or "error"
+	OffsetUs     int64    `json:"offsetus,omitempty"`
+	MaxErrorUs   int64    `json:"maxerrorus,omitempty"`
+	EstErrorUs   int64    `json:"esterrorus,omitempty"`
+	NtpEnabled   bool     `json:"ntpenabled,omitempty"` // timedatectl NTP=yes
+	Daemon       string   `json:"daemon,omitempty"`     // "chronyd" or "systemd-timesyncd" when detected
+	Source       string   `json:"source,omitempty"`     // the server the daemon syncs to
+	Stratum      int      `json:"stratum,omitempty"`
+	Errors       []string `json:"errors,omitempty"` // probes that failed (missing tools are not errors)
+}
+
+// hashes a remote file without transferring it, Algorithm is one of sha256 (the default), sha512, sha1 or md5
+type CommandFileChecksumData struct {
+	Path      string `json:"path"`
+	Algorithm string `json:"algorithm,omitempty"`
+}
+
+type FileChecksumData struct {
+	Path       string `json:"path"` // resolved path
+	Algorithm  string `json:"algorithm"`
+	Checksum   string `json:"checksum"` // lowercase hex
+	Size       int64  `json:"size"`     // bytes hashed
+	DurationMs int64  `json:"durationms"`
+}
+
+// sub-requests run concurrently (at most wshutil.MaxBatchConcurrency at a time) unless Sequential is set,
+// which runs them one at a time in order (use it when later requests depend on earlier ones).
+// responses are always in request order.  StopOnError (sequential only) skips the rest after a failure.
+type CommandBatchData struct {
+	Requests    []BatchSubRequest `json:"requests"`
+	Sequential  bool              `json:"sequential,omitempty"`
+	StopOnError bool              `json:"stoponerror,omitempty"`
+}
+
+// only call (single response) commands can be batched
+type BatchSubRequest struct {
+	Id      string `json:"id,omitempty"` // echoed in the response
+	Command string `json:"command"`
+	Data    any    `json:"data,omitempty"`
+}
+
+// a failed sub-request only sets its own Error, the batch itself still succeeds
+type BatchSubResponse struct {
+	Id         string `json:"id,omitempty"`
+	Command    string `json:"command"`
+	Data       any    `json:"data,omitempty"`
+	Error      string `json:"error,omitempty"`
+	Skipped    bool   `json:"skipped,omitempty"` // not run (StopOnError after an earlier failure)
+	DurationMs int64  `json:"durationms"`
+}
+
+type CommandBatchRtnData struct {
+	Responses []BatchSubResponse `json:"responses"`
+	Errors    int                `json:"errors,omitempty"`
+}
+
+// an empty Path clears the route's cwd (back to the default)
+type CommandSetCwdData struct {
+	Path string `json:"path"`
+}
+
+// relative paths in the route's file and exec commands resolve against Cwd.  Default is set when the
+// route hasn't set one (Cwd is then the server's, the root dir if set)
+type CwdData struct {
+	Cwd     string `json:"cwd"`
+	Default bool   `json:"default,omitempty"`
+}
+
+const (
+	ForwardMode_Dial   = "dial"   // the server connects to Addr, one connection per forward (wsh forward -L)
+	ForwardMode_Listen = "listen" // the server listens on Addr (loopback only), every accepted connection is streamed back (wsh forward -R)
+)
+
+// forwards tcp connections through the server.  the stream runs until ForwardStop (or the dial mode
+// connection closes), so the request timeout must cover the forward's lifetime.  local routes lose their
+// forwards when they disconnect
+type CommandForwardStartData struct {
+	Mode string `json:"mode"`
+	Addr string `json:"addr"` // host:port
+}
+
+// the first packet has ForwardId and Addr (the resolved address) set.  then per connection: an Opened
+// packet, its data, Eof once the server side stops sending, and Closed (Error set if it failed)
+type ForwardPacketData struct {
+	ForwardId string `json:"forwardid,omitempty"`
+	Addr      string `json:"addr,omitempty"`
+	ConnId    string `json:"connid,omitempty"`
+	Opened    bool   `json:"opened,omitempty"`
+	PeerAddr  string `json:"peeraddr,omitempty"` // with Opened, the remote address of the connection
+	Data64    string `json:"data64,omitempty"`
+	Eof       bool   `json:"eof,omitempty"`
+	Closed    bool   `json:"closed,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+// only the route that started the forward may write to it
+type CommandForwardDataData struct {
+	ForwardId string `json:"forwardid"`
+	ConnId    string `json:"connid"`
+	Data64    string `json:"data64,omitempty"`
+	Eof       bool   `json:"eof,omitempty"`   // closes the write side of the connection (after writing Data64)
+	Close     bool   `json:"close,omitempty"` // closes the connection
+}
+
+// closes the forward's listener and connections, its stream ends
+type CommandForwardStopData struct {
+	ForwardId string `json:"forwardid"`
+}
+
+// streams a file of any size in chunks, each with its offset and sha256.  an interrupted transfer resumes
+// with the ResumeToken of its first packet and the offset after the last chunk it received, as long as
+// the file hasn't changed since (Path is ignored when resuming)
+type CommandFileTransferReadData struct {
+	Path        string `json:"path"`
+	ResumeToken string `json:"resumetoken,omitempty"`
+	Offset      int64  `json:"offset,omitempty"`
+	ChunkSize   int    `json:"chunksize,omitempty"` // bytes, defaults to 64k (max 1m)
+}
+
+// the first packet has ResumeToken and Size set (and no data), the last one has Done and FileChecksum
+type FileTransferChunkData struct {
+	ResumeToken  string `json:"resumetoken,omitempty"`
+	Size         int64  `json:"size,omitempty"`
+	Offset       int64  `json:"offset"`
+	Data64       string `json:"data64,omitempty"`
+	Checksum     string `json:"checksum,omitempty"` // sha256 of the chunk (lowercase hex)
+	Done         bool   `json:"done,omitempty"`
+	FileChecksum string `json:"filechecksum,omitempty"` // sha256 of the whole file
+}
+
+// writes one chunk of an upload of Size bytes.  chunks go to a partial file next to Path (Path + ".wavepart")
+// which replaces Path after the Final chunk.  the first chunk (Offset 0, no ResumeToken) starts the
+// upload, later chunks pass the returned ResumeToken.  a chunk with no data and no Final returns the
+// committed offset, which is where an interrupted upload resumes (a smaller Offset rewrites from there).
+// Checksum and FileChecksum are sha256 (lowercase hex), both optional
+type CommandFileTransferWriteData struct {
+	Path         string      `json:"path"`
+	ResumeToken  string      `json:"resumetoken,omitempty"`
+	Size         int64       `json:"size"`
+	Offset       int64       `json:"offset"`
+	Data64       string      `json:"data64,omitempty"`
+	Checksum     string      `json:"checksum,omitempty"`     // of the chunk, verified before it is written
+	Final        bool        `json:"final,omitempty"`        // the upload is complete after this chunk
+	FileChecksum string      `json:"filechecksum,omitempty"` // with Final, verified before Path is replaced
+	CreateMode   os.FileMode `json:"createmode,omitempty"`
+}
+
+type FileTransferWriteRtnData struct {
+	ResumeToken string `json:"resumetoken"`
+	Offset      int64  `json:"offset"` // bytes committed
+	Done        bool   `json:"done,omitempty"`
+}
+
+const (
+	FileTransferDir_Read  = "read"
+	FileTransferDir_Write = "write"
+)
+
+// the data of a "transfer" connserver event, published at most once a second per transfer and when it ends
+type FileTransferProgressData struct {
+	ResumeToken string `json:"resumetoken"`
+	Dir         string `json:"dir"`
+	Path        string `json:"path"`
+	Offset      int64  `json:"offset"`
+	Size        int64  `json:"size"`
+	Done        bool   `json:"done,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type SysInfoCollectorInfo struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	Default bool   `json:"default,omitempty"` // collected when --sysinfo-include isn't given
+}
+
+// every sysinfo subsystem in collection order
+type CommandSysInfoCollectorsRtnData struct {
+	Collectors []SysInfoCollectorInfo `json:"collectors"`
+}
+
+// enables/disables sysinfo subsystems of the running loop (Disable wins for a name in both), an unknown
+// name fails the whole request.  returns the resulting state
+type CommandSetSysInfoCollectorsData struct {
+	Enable  []string `json:"enable,omitempty"`
+	Disable []string `json:"disable,omitempty"`
+}
+
+type CommandSysInfoIntervalData struct {
+	IntervalMs int64 `json:"intervalms"`
+}
+
+type CommandGetToggleData struct {
+	Key string `json:"key,omitempty"` // empty for all toggles
+}
+
+type CommandSetToggleData struct {
+	Key   string `json:"key"`
+	Value bool   `json:"value"`
+}
+
+type CommandToggleRtnData struct {
+	Toggles map[string]bool `json:"toggles"`
+}
+
+type CommandSysInfoHistoryData struct {
+	SinceTs  int64 `json:"sincets,omitempty"`  // only snapshots after this time (unix ms), e.g. the last one the client saw
+	MaxItems int   `json:"maxitems,omitempty"` // 0 for all retained snapshots
+}
+
+// Data64 is a gzipped JSON array of TimeSeriesData (oldest first)
+type CommandSysInfoHistoryRtnData struct {
+	Count       int    `json:"count"`
+	HistorySize int    `json:"historysize"` // snapshots the server retains
+	IntervalMs  int64  `json:"intervalms"`
+	Data64      string `json:"data64"`
+}
+
+// Format is one of "json" (the default), "influx" (InfluxDB line protocol) or "csv", see wshremote/sysinfostream.go for the mapping
+type CommandSysInfoStreamData struct {
+	Format string `json:"format,omitempty"`
+}
+
+// one packet per collection.  Records holds complete newline terminated lines (influx/csv), the first
+// csv packet starts with the header line
+type SysInfoStreamData struct {
+	Format  string          `json:"format"`
+	Data    *TimeSeriesData `json:"data,omitempty"` // json format
+	Records string          `json:"records,omitempty"`
+	Dropped int             `json:"dropped,omitempty"` // snapshots skipped since the previous packet (the reader fell behind)
+}
+
+type RouteStatsData struct {
+	RouteId        string `json:"routeid,omitempty"`
+	BlockType      string `json:"blocktype,omitempty"`
+	Transport      string `json:"transport,omitempty"` // listener network ("unix", "vsock", "tcp"), empty for the upstream
+	QosClass       string `json:"qosclass,omitempty"`
+	MsgsIn         int64  `json:"msgsin"` // messages received from the route
+	BytesIn        int64  `json:"bytesin"`
+	MsgsOut        int64  `json:"msgsout"` // messages delivered to the route
+	BytesOut       int64  `json:"bytesout"`
+	Dropped        int64  `json:"dropped"`                  // messages from the route that could not be delivered
+	InFlight       int    `json:"inflight,omitempty"`       // requests from the route still waiting for a response
+	QueueDepth     int    `json:"queuedepth,omitempty"`     // messages waiting to be written to the route (proxies only)
+	Paused         bool   `json:"paused,omitempty"`         // see PauseRoute
+	LastActivityTs int64  `json:"lastactivityts,omitempty"` // unix ms, the last message from or to the route (kept across resets)
+
+	// set when the client presented an instance id (see WshRouter.BindInstance, wshinstance.go)
+	InstanceId  string `json:"instanceid,omitempty"`
+	PrevRouteId string `json:"prevrouteid,omitempty"` // the instance's previous route (same logical client)
+	Reconnects  int    `json:"reconnects,omitempty"`  // earlier connections seen from this instance
+
+	// set for deadman routes (see wshutil.StartRouteDeadman), the route must send a keepalive every DeadmanMs
+	DeadmanMs       int64 `json:"deadmanms,omitempty"`
+	Keepalives      int64 `json:"keepalives,omitempty"`
+	LastKeepaliveTs int64 `json:"lastkeepalivets,omitempty"`
+
+	// set by the route's transport when it compresses traffic (empty/zero for uncompressed routes)
+	Compression      string  `json:"compression,omitempty"`      // negotiated algorithm
+	BytesRaw         int64   `json:"bytesraw,omitempty"`         // payload bytes before compression
+	BytesCompressed  int64   `json:"bytescompressed,omitempty"`  // bytes on the wire
+	CompressionRatio float64 `json:"compressionratio,omitempty"` // compressed/raw (lower is better, near 1 means compression isn't helping)
+}
+
+// routes are sorted by route id.  filters are applied before paging, Limit 0 returns every matching route
+type CommandRouteStatsData struct {
+	Offset    int    `json:"offset,omitempty"`
+	Limit     int    `json:"limit,omitempty"`
+	BlockType string `json:"blocktype,omitempty"`
+	Transport string `json:"transport,omitempty"`
+	QosClass  string `json:"qosclass,omitempty"`
+}
+
+type CommandRouteStatsRtnData struct {
+	StatsSince int64            `json:"statssince"` // unix ms, server start or last reset
+	Totals     RouteStatsData   `json:"totals"`
+	Routes     []RouteStatsData `json:"routes"`
+	Total      int              `json:"total"` // matching routes (before paging)
+}
+
+type RegisteredRouteData struct {
+	RouteId      string `json:"routeid"`
+	Kind         string `json:"kind"`                   // "proxy" (a listener client), "local" (in this process) or "upstream"
+	RegisteredTs int64  `json:"registeredts,omitempty"` // unix ms, 0 for the upstream
+	Announced    int    `json:"announced,omitempty"`    // routes announced through this route
+
+	AuthState      string   `json:"authstate,omitempty"`  // proxies only: "jwt" or "static" (--auth-secret-file), see wshutil.RouteAuth_*
+	Scope          []string `json:"scope,omitempty"`      // commands the route's token allows (empty for all)
+	PolicyRule     string   `json:"policyrule,omitempty"` // the connserver --policy rule that applies to the route
+	MsgsIn         int64    `json:"msgsin"`               // the counters are since the last stats reset (see RouteStatsData)
+	MsgsOut        int64    `json:"msgsout"`
+	Dropped        int64    `json:"dropped,omitempty"`
+	LastActivityTs int64    `json:"lastactivityts,omitempty"` // unix ms, the last message from or to the route
+}
+
+// one consistent snapshot (taken under the router's lock)
+type CommandRouteInfoRtnData struct {
+	Ts          int64                 `json:"ts"`
+	Routes      []RegisteredRouteData `json:"routes"` // sorted by route id
+	NumRoutes   int                   `json:"numroutes"`
+	NumProxy    int                   `json:"numproxy"`
+	NumLocal    int                   `json:"numlocal"`
+	HasUpstream bool                  `json:"hasupstream"`
+	Conns       int                   `json:"conns"`                // open listener connections, including ones still authenticating
+	ConnsTotal  int64                 `json:"connstotal"`           // accepted since start
+	ListenAddr  string                `json:"listenaddr,omitempty"` // tcp address wsh clients can connect to (--listen tcp://...)
+}
+
+// streams the metadata of every message the router handles until the request ends (admin only).  the
+// filters are exact matches on either end of the message (empty matches everything).  the trace's own
+// messages are never traced
+type CommandRouteTraceData struct {
+	RouteId string `json:"routeid,omitempty"` // the message came from or went to this route
+	Command string `json:"command,omitempty"` // only requests for this command (responses have no command)
+}
+
+const (
+	RouteTraceDrop_Scope       = "scope"       // the command is outside the sender's token scope
+	RouteTraceDrop_Inflight    = "inflight"    // the sender has too many requests in flight
+	RouteTraceDrop_NoRoute     = "noroute"     // no route for the destination
+	RouteTraceDrop_NoRouteInfo = "norouteinfo" // a response (or cancel) for a request the router doesn't know
+)
+
+// redacted: the message's data, error text and auth token are never included
+type RouteTraceData struct {
+	Ts      int64  `json:"ts"`
+	From    string `json:"from"`              // the route the message came in on
+	To      string `json:"to,omitempty"`      // the route it was delivered to, empty when dropped
+	Source  string `json:"source,omitempty"`  // requests only
+	Route   string `json:"route,omitempty"`   // the requested destination (requests only)
+	Command string `json:"command,omitempty"` // requests only
+	ReqId   string `json:"reqid,omitempty"`
+	ResId   string `json:"resid,omitempty"`
+	Cont    bool   `json:"cont,omitempty"`
+	Error   bool   `json:"error,omitempty"` // an error response
+	Size    int    `json:"size"`            // bytes
+	Dropped string `json:"dropped,omitempty"`
+	Missed  int64  `json:"missed,omitempty"` // records skipped just before this one (the subscriber fell behind)
+}
+
+type CommandResetRouteData struct {
+	RouteId    string `json:"routeid"`
+	Disconnect bool   `json:"disconnect,omitempty"` // also close the route's connection (the client reconnects)
+}
+
+type CommandResetRouteRtnData struct {
+	RouteId          string `json:"routeid"`
+	DrainedMessages  int    `json:"drainedmessages"`  // queued messages to the route that were dropped
+	CanceledRequests int    `json:"canceledrequests"` // requests from the route that were canceled
+	FailedRequests   int    `json:"failedrequests"`   // requests to the route that were failed back to their sources
+	Disconnected     bool   `json:"disconnected,omitempty"`
+}
+
+// stops writing to a local route's connection without disconnecting it.  messages for the route queue
+// in its output channel (up to its capacity, they still count against --max-buffer-memory), after that
+// Overflow applies: "disconnect" (the default) closes the connection, "drop" discards new messages
+// (responses included, so the route's requests time out).  "block" isn't allowed, it would stall the router.
+type CommandPauseRouteData struct {
+	RouteId  string `json:"routeid"`
+	Overflow string `json:"overflow,omitempty"`
+}
+
+// resuming writes out the queued messages in order
+type CommandResumeRouteData struct {
+	RouteId string `json:"routeid"`
+}
+
+type PauseRouteRtnData struct {
+	RouteId  string `json:"routeid"`
+	Paused   bool   `json:"paused"`
+	Overflow string `json:"overflow,omitempty"`
+	Queued   int    `json:"queued"`            // messages waiting in the output channel
+	Dropped  int64  `json:"dropped,omitempty"` // dropped on overflow while paused
+}
+
+// message counts at each stage of the upstream path (stdin -> parser -> channel -> forwarder -> router).
+// the pending counts are messages between two stages, a pending count that keeps growing points at the stall
+type PipelineStatsData struct {
+	Enabled        bool  `json:"enabled"` // false unless the server runs with --trace-pipeline
+	Parsed         int64 `json:"parsed"`
+	Delivered      int64 `json:"delivered"`
+	Received       int64 `json:"received"`
+	Injected       int64 `json:"injected"`
+	Dropped        int64 `json:"dropped"`
+	RawLines       int64 `json:"rawlines"`                // non-packet lines on stdin (ignored)
+	CorruptFrames  int64 `json:"corruptframes,omitempty"` // corrupt packet frames on stdin (discarded, the parser resynced)
+	PendingParse   int64 `json:"pendingparse"`
+	PendingChannel int64 `json:"pendingchannel"`
+	PendingInject  int64 `json:"pendinginject"`
+}
+
+// data for the connserver:event wave event (scoped to the connection name)
+type ConnServerEventData struct {
+	Type    string `json:"type"`
+	Ts      int64  `json:"ts"`
+	Message string `json:"message"`
+	Data    any    `json:"data,omitempty"`
+	Dropped int64  `json:"dropped,omitempty"` // events lost just before this one (upstream consumer too slow)
+}
+
+// data for the queue:high and queue:recovered connserver events
+type QueueWatermarkEventData struct {
+	RouteId   string `json:"routeid"`
+	Depth     int    `json:"depth"`
+	PeakDepth int    `json:"peakdepth"`
+	Watermark int    `json:"watermark"` // the watermark that was crossed
+}
+
+type TlsCertInfo struct {
+	ServerName string `json:"servername"`
+	Subject    string `json:"subject,omitempty"`
+	NotAfter   int64  `json:"notafter,omitempty"` // unix ms
+}
+
+type CommandReloadCertRtnData struct {
+	Certs []TlsCertInfo `json:"certs"`
+}
+
+const (
+	FlowControl_SlowDown = "slowdown"
+	FlowControl_Resume   = "resume"
+)
+
+// sent by the router to a route that has too many requests outstanding (slowdown), and again once
+// it has caught up (resume).  cooperative, the hard limits (--max-inflight-per-route) still apply
+type FlowControlData struct {
+	Action   string `json:"action"`
+	Reason   string `json:"reason,omitempty"`
+	InFlight int    `json:"inflight"`
+	Limit    int    `json:"limit,omitempty"` // the hard limit, 0 if none
+}
+
+// sends Message to every local route as a connserver:event of type "broadcast" (e.g. a maintenance
+// notice before a restart).  the event also goes upstream like other server events.
+type CommandBroadcastData struct {
+	Message string `json:"message"`
+	Level   string `json:"level,omitempty"` // "info" (default), "warning" or "error"
+	InMs    int64  `json:"inms,omitempty"`  // optional, time until the announced action (for countdowns)
+}
+
+type BroadcastEventData struct {
+	Message string `json:"message"`
+	Level   string `json:"level"`
+	AtTs    int64  `json:"atts,omitempty"` // when the announced action happens (unix ms), from InMs
+}
+
+type CommandBroadcastRtnData struct {
+	NumRoutes int `json:"numroutes"` // routes the broadcast was sent to
+}
+
+// kernel tcp stats for a listener route's connection (defaults to the caller's own route, other routes
+// require admin).  only tcp (and tls over tcp) connections have them, for other transports Available is false.
+type CommandSocketStatsData struct {
+	RouteId string `json:"routeid,omitempty"`
+}
+
+type SocketStatsData struct {
+	RouteId    string       `json:"routeid"`
+	Transport  string       `json:"transport"`
+	LocalAddr  string       `json:"localaddr,omitempty"`
+	RemoteAddr string       `json:"remoteaddr,omitempty"`
+	Available  bool         `json:"available"`
+	Reason     string       `json:"reason,omitempty"` // why stats are unavailable
+	Tcp        *TcpInfoData `json:"tcp,omitempty"`
+}
+
+// from TCP_INFO (linux), fields the kernel doesn't report are zero
+type TcpInfoData struct {
+	State           string `json:"state"`
+	RttUs           uint32 `json:"rttus"` // smoothed rtt
+	RttVarUs        uint32 `json:"rttvarus"`
+	MinRttUs        uint32 `json:"minrttus,omitempty"`
+	RtoUs           uint32 `json:"rtous"`
+	Retransmits     uint32 `json:"retransmits"` // total retransmitted segments
+	Lost            uint32 `json:"lost"`
+	Unacked         uint32 `json:"unacked"`
+	SndCwnd         uint32 `json:"sndcwnd"` // segments
+	SndSsthresh     uint32 `json:"sndssthresh"`
+	SndMss          uint32 `json:"sndmss"`
+	RcvWnd          uint32 `json:"rcvwnd,omitempty"`
+	NotSentBytes    uint32 `json:"notsentbytes"` // queued in the send buffer, not yet sent
+	BytesSent       uint64 `json:"bytessent,omitempty"`
+	BytesAcked      uint64 `json:"bytesacked,omitempty"`
+	BytesReceived   uint64 `json:"bytesreceived,omitempty"`
+	BytesRetrans    uint64 `json:"bytesretrans,omitempty"`
+	DeliveryRate    uint64 `json:"deliveryrate,omitempty"`    // bytes/sec
+	BusyTimeUs      uint64 `json:"busytimeus,omitempty"`      // time with unacked data in flight
+	RwndLimitedUs   uint64 `json:"rwndlimitedus,omitempty"`   // stalled on the peer's receive window (slow reader)
+	SndbufLimitedUs uint64 `json:"sndbuflimitedus,omitempty"` // stalled on the local send buffer
+}
+
+// graceful shutdown of the connserver, runs after the response is sent
+type CommandShutdownData struct {
+	GraceMs int64 `json:"gracems,omitempty"` // 0 uses the server's --shutdown-grace
+}
+
+type CommandServerInfoRtnData struct {
+	Version    string `json:"version"`
+	Pid        int    `json:"pid"`
+	StartTs    int64  `json:"startts,omitempty"` // unix ms
+	RouterMode bool   `json:"routermode,omitempty"`
+	RootDir    string `json:"rootdir,omitempty"`
+	Quiesced   bool   `json:"quiesced,omitempty"`
+
+	OverloadRejected   int64 `json:"overloadrejected,omitempty"`   // listener connections refused by --reject-above-load/--reject-above-mem
+	AcceptRateDelayed  int64 `json:"acceptratedelayed,omitempty"`  // listener connections held back by --accept-rate
+	AcceptRateRejected int64 `json:"acceptraterejected,omitempty"` // refused by --accept-rate (would have waited longer than --accept-rate-wait)
+
+	LogWritesDropped int64 `json:"logwritesdropped,omitempty"` // handler log writes dropped because stdout couldn't keep up
+	LogWriteErrors   int64 `json:"logwriteerrors,omitempty"`
+
+	SysInfoUnavailable bool   `json:"sysinfounavailable,omitempty"` // the sysinfo loop gave up after repeated failures
+	SysInfoError       string `json:"sysinfoerror,omitempty"`
+
+	ConnDurations []ConnDurationBucketData `json:"conndurations,omitempty"` // lifetime histogram of listener connection durations
+
+	BlockTypeCounts map[string]int `json:"blocktypecounts,omitempty"` // active local routes by block type
+
+	Handshakes *HandshakeStatsData `json:"handshakes,omitempty"` // listener handshake latency
+
+	BufferMemory *BufferMemoryData `json:"buffermemory,omitempty"` // set with --max-buffer-memory
+
+	Issues []ServerIssueData `json:"issues,omitempty"` // ongoing problems, newest first
+}
+
+// what the calling route can do on this server (commands that exist but are disabled for it have a Reason)
+type CommandCapabilitiesRtnData struct {
+	Version    string                  `json:"version"`
+	RouterMode bool                    `json:"routermode,omitempty"`
+	ReadOnly   bool                    `json:"readonly,omitempty"`
+	Admin      bool                    `json:"admin,omitempty"`      // the caller has admin authorization
+	Scope      []string                `json:"scope,omitempty"`      // the caller's token scope, empty if unscoped
+	PolicyRule string                  `json:"policyrule,omitempty"` // the connserver --policy rule that applies to the caller
+	Commands   []CommandCapabilityData `json:"commands"`
+	Limits     CapabilityLimitsData    `json:"limits"`
+}
+
+type CommandCapabilityData struct {
+	Command     string `json:"command"`
+	Enabled     bool   `json:"enabled"`
+	Reason      string `json:"reason,omitempty"`      // why it is disabled ("read-only", "admin", "scope", "router")
+	Concurrency int    `json:"concurrency,omitempty"` // --command-concurrency limit
+}
+
+type CapabilityLimitsData struct {
+	MaxPacketSize    int64    `json:"maxpacketsize"` // 0 for no limit
+	Encodings        []string `json:"encodings"`
+	Compression      []string `json:"compression"` // empty when messages are never compressed
+	MaxInflight      int      `json:"maxinflight,omitempty"`
+	CommandQueueSize int      `json:"commandqueuesize,omitempty"`
+	ExecEnvDeny      []string `json:"execenvdeny,omitempty"`
+}
+
+type ServerIssueData struct {
+	Key      string `json:"key"`      // what is degraded ("sysinfo", "upstream")
+	Severity string `json:"severity"` // "warning" or "error"
+	Message  string `json:"message"`
+	Ts       int64  `json:"ts"` // when the issue was raised (or last changed)
+}
+
+// bytes queued for listener clients (not yet written to their connections)
+type BufferMemoryData struct {
+	Used       int64 `json:"used"`
+	Limit      int64 `json:"limit"`
+	ShedRoutes int64 `json:"shedroutes"` // low priority routes disconnected to free memory (lifetime)
+}
+
+type HandshakeStatsData struct {
+	Count      int64   `json:"count"` // lifetime
+	MaxMs      int64   `json:"maxms"` // lifetime
+	AvgMs      float64 `json:"avgms"` // over the last WindowSize handshakes
+	WindowSize int     `json:"windowsize"`
+}
+
+type ConnDurationBucketData struct {
+	Label string `json:"label"`
+	MaxMs int64  `json:"maxms,omitempty"` // exclusive upper bound, 0 for the last (open) bucket
+	Count int64  `json:"count"`
+}
+
+// effective connserver configuration (sensitive values are never included)
+type ConnServerConfigData struct {
+	RouterMode          bool            `json:"routermode"`
+	Transports          []string        `json:"transports"`                  // "stdio" plus "network:addr" for each listener
+	Listen              string          `json:"listen,omitempty"`            // the main listener as a url (tcp://host:port with the resolved port, or unix)
+	ResumeGraceMs       int64           `json:"resumegracems,omitempty"`     // --resume-grace
+	ResumeBufferBytes   int64           `json:"resumebufferbytes,omitempty"` // set with --resume-grace or --daemon
+	Daemon              bool            `json:"daemon,omitempty"`            // --daemon, the detached process upstreams attach to
+	DaemonStateFile     string          `json:"daemonstatefile,omitempty"`
+	RootDir             string          `json:"rootdir,omitempty"`
+	HandshakeTimeoutMs  int64           `json:"handshaketimeoutms"`
+	ConnIdleTimeoutMs   int64           `json:"connidletimeoutms,omitempty"` // --conn-idle-timeout
+	ListenBacklog       int             `json:"listenbacklog,omitempty"`     // 0 is the system default
+	HealthAddr          string          `json:"healthaddr,omitempty"`
+	GatewayAddr         string          `json:"gatewayaddr,omitempty"` // the resolved address (the picked port for port 0)
+	MetricsSocket       string          `json:"metricssocket,omitempty"`
+	CommandConcurrency  map[string]int  `json:"commandconcurrency,omitempty"`
+	CommandQueueSize    int             `json:"commandqueuesize"`
+	LogBufferBytes      int             `json:"logbufferbytes"`
+	LogFile             string          `json:"logfile,omitempty"`
+	LogMaxSize          int64           `json:"logmaxsize,omitempty"`
+	LogKeep             int             `json:"logkeep,omitempty"`
+	TlsServerNames      []string        `json:"tlsservernames,omitempty"`
+	SysInfoInclude      []string        `json:"sysinfoinclude"`
+	SysInfoIntervalMs   int64           `json:"sysinfointervalms"`
+	MaxSysInfoErrors    int             `json:"maxsysinfoerrors"`
+	SysInfoJitter       float64         `json:"sysinfojitter,omitempty"`
+	SysInfoHistory      int             `json:"sysinfohistory"`
+	SysInfoTimeoutMs    int64           `json:"sysinfotimeoutms"` // per subsystem
+	ShutdownFlushMs     int64           `json:"shutdownflushms"`
+	ShutdownGraceMs     int64           `json:"shutdowngracems"`
+	DrainTimeoutMs      int64           `json:"draintimeoutms"`                // --drain-timeout
+	InjectTimeoutMs     int64           `json:"injecttimeoutms"`               // --upstream-inject-timeout
+	UpstreamCompression []string        `json:"upstreamcompression,omitempty"` // offered on the upstream stream (the negotiated one is in the upstream route stats)
+	UpstreamWindow      int64           `json:"upstreamwindow,omitempty"`      // flow control window advertised to the upstream
+	TracePipeline       bool            `json:"tracepipeline,omitempty"`
+	WatchSocket         bool            `json:"watchsocket,omitempty"`
+	MaxInflight         int             `json:"maxinflight,omitempty"` // per route
+	CarryRouteStats     bool            `json:"carryroutestats,omitempty"`
+	InputFullPolicy     string          `json:"inputfullpolicy"`
+	InputFullTimeoutMs  int64           `json:"inputfulltimeoutms"`
+	MaxBufferMemory     int64           `json:"maxbuffermemory,omitempty"`
+	QueueHighWatermark  int             `json:"queuehighwatermark"`
+	QueueLowWatermark   int             `json:"queuelowwatermark"`
+	QueueSustainMs      int64           `json:"queuesustainms"`
+	RejectAboveLoad     float64         `json:"rejectaboveload,omitempty"`
+	RejectAboveMem      float64         `json:"rejectabovemem,omitempty"`
+	AcceptRate          float64         `json:"acceptrate,omitempty"` // connections per second
+	AcceptBurst         int             `json:"acceptburst,omitempty"`
+	AcceptRateWaitMs    int64           `json:"acceptratewaitms,omitempty"`
+	ExecEnvDeny         []string        `json:"execenvdeny,omitempty"`
+	RuntimeProbeTools   []string        `json:"runtimeprobetools,omitempty"`
+	BackpressureHigh    int             `json:"backpressurehigh,omitempty"`
+	BackpressureLow     int             `json:"backpressurelow,omitempty"`
+	DeadmanIntervalMs   int64           `json:"deadmanintervalms,omitempty"` // --deadman-interval (the max, routes may negotiate shorter)
+	SysInfoPushUrl      string          `json:"sysinfopushurl,omitempty"`    // redacted
+	ConfigFile          string          `json:"configfile,omitempty"`
+	PolicyFile          string          `json:"policyfile,omitempty"`
+	PolicyRules         int             `json:"policyrules,omitempty"` // rules in the policy file (not counting the default)
+	Quiesced            bool            `json:"quiesced"`
+	Toggles             map[string]bool `json:"toggles"`
+}
+
+type CommandLogTailData struct {
+	Lines int `json:"lines,omitempty"` // 0 for everything in the buffer
+}
+
+type CommandLogTailRtnData struct {
+	Entries     []logring.LogEntry `json:"entries"`
+	Dropped     int64              `json:"dropped"`   // entries evicted from the buffer since start
+	Truncated   bool               `json:"truncated"` // true if older entries were dropped (the tail is not the complete log)
+	BufferBytes int                `json:"bufferbytes"`
+	MaxBytes    int                `json:"maxbytes"`
+}
+
+// reports on the --log-file.  Action "rotate" rotates it now (whatever its size), "reopen" closes and
+// reopens it without renaming anything (after an external logrotate moved it), "" only reports
+type CommandLogFileData struct {
+	Action string `json:"action,omitempty"`
+}
+
+type LogFileData struct {
+	Path         string   `json:"path"`
+	Size         int64    `json:"size"`
+	MaxSize      int64    `json:"maxsize,omitempty"` // --log-max-size, 0 never rotates on size
+	Keep         int      `json:"keep"`
+	RotatedFiles []string `json:"rotatedfiles,omitempty"` // newest first
+	Rotations    int64    `json:"rotations,omitempty"`
+	LastRotateTs int64    `json:"lastrotatets,omitempty"`
+	LastError    string   `json:"lasterror,omitempty"`
 }
 
 type ConnKeywords struct {
@@ -494,8 +1823,9 @@ const (
 )
 
 type TimeSeriesData struct {
-	Ts     int64              `json:"ts"`
-	Values map[string]float64 `json:"values"`
+	Ts          int64              `json:"ts"`
+	Values      map[string]float64 `json:"values"`
+	Unavailable []string           `json:"unavailable,omitempty"` // subsystems that timed out this cycle (their values are missing)
 }
 
 type MetaSettingsType struct {
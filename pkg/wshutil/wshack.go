@@ -0,0 +1,155 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// opt-in at-least-once delivery for fire-and-forget commands.
+// the sender sets ackreq + a unique ackid, the receiving WshRpc sends back an "ack" command (routed to the message source)
+// once the handler has returned.  the sender retransmits the same message until it is acked or it runs out of retries.
+// receivers remember recently seen ackids so retransmits are acked again but not processed twice.
+
+const DefaultAckTimeout = 2 * time.Second
+const DefaultAckRetries = 3
+const AckDedupWindow = 1 * time.Minute
+
+type AckOpts struct {
+	Timeout    time.Duration // time to wait for an ack before retransmitting
+	MaxRetries int           // number of retransmits, 0 for the default (total attempts is MaxRetries+1)
+}
+
+type ackState struct {
+	Done   bool
+	SeenTs time.Time
+}
+
+func (w *WshRpc) registerAck(ackId string) chan struct{} {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	rtn := make(chan struct{}, 1)
+	w.AckMap[ackId] = rtn
+	return rtn
+}
+
+func (w *WshRpc) unregisterAck(ackId string) {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	delete(w.AckMap, ackId)
+}
+
+func (w *WshRpc) recvAck(ackId string) {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	ackCh := w.AckMap[ackId]
+	if ackCh == nil {
+		// late or duplicate ack
+		return
+	}
+	select {
+	case ackCh <- struct{}{}:
+	default:
+	}
+}
+
+// returns false if the message is a retransmit that should not be processed again
+func (w *WshRpc) startAckedMessage(msg *RpcMessage) bool {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	now := time.Now()
+	for ackId, state := range w.ackSeen {
+		if state.Done && now.Sub(state.SeenTs) > AckDedupWindow {
+			delete(w.ackSeen, ackId)
+		}
+	}
+	state := w.ackSeen[msg.AckId]
+	if state == nil {
+		w.ackSeen[msg.AckId] = &ackState{SeenTs: now}
+		return true
+	}
+	if state.Done {
+		// already processed, the ack must have been lost
+		go w.sendAck(msg)
+	}
+	// if still processing, the ack goes out when the handler returns
+	return false
+}
+
+func (w *WshRpc) finishAckedMessage(msg *RpcMessage) {
+	w.Lock.Lock()
+	if state := w.ackSeen[msg.AckId]; state != nil {
+		state.Done = true
+		state.SeenTs = time.Now()
+	}
+	w.Lock.Unlock()
+	w.sendAck(msg)
+}
+
+func (w *WshRpc) sendAck(msg *RpcMessage) {
+	defer panichandler.PanicHandler("WshRpc.sendAck")
+	ackMsg := &RpcMessage{
+		Command:   wshrpc.Command_Ack,
+		Route:     msg.Source,
+		AckId:     msg.AckId,
+		AuthToken: w.GetAuthToken(),
+	}
+	barr, _ := json.Marshal(ackMsg) // will never fail
+	w.OutputCh <- barr
+}
+
+// sends a command (no response) and blocks until the receiver acks it, retransmitting on ack timeout
+func (w *WshRpc) SendCommandWithAck(command string, data any, opts *wshrpc.RpcOpts, ackOpts *AckOpts) error {
+	if command == "" {
+		return fmt.Errorf("command cannot be empty")
+	}
+	if opts == nil {
+		opts = &wshrpc.RpcOpts{}
+	}
+	ackTimeout := DefaultAckTimeout
+	maxRetries := DefaultAckRetries
+	if ackOpts != nil {
+		if ackOpts.Timeout > 0 {
+			ackTimeout = ackOpts.Timeout
+		}
+		if ackOpts.MaxRetries > 0 {
+			maxRetries = ackOpts.MaxRetries
+		}
+	}
+	msg := &RpcMessage{
+		Command:   command,
+		Data:      data,
+		Route:     opts.Route,
+		AuthToken: w.GetAuthToken(),
+		AckReq:    true,
+		AckId:     uuid.New().String(),
+	}
+	barr, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	ackCh := w.registerAck(msg.AckId)
+	defer w.unregisterAck(msg.AckId)
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 && w.Debug {
+			log.Printf("[%s] retransmitting %q (ackid:%s attempt:%d)\n", w.DebugName, command, msg.AckId, attempt+1)
+		}
+		w.OutputCh <- barr
+		timer := time.NewTimer(ackTimeout)
+		select {
+		case <-ackCh:
+			timer.Stop()
+			return nil
+		case <-timer.C:
+		}
+	}
+	return fmt.Errorf("EC-TIME: no ack received for %q after %d attempts", command, maxRetries+1)
+}
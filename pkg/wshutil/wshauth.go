@@ -0,0 +1,93 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// checks the credential a client sends in its "authenticate" message (HandleClientProxyAuth).
+// returns the client's rpc context and the route id + auth token its route will use.
+type AuthVerifier interface {
+	VerifyAuth(router *WshRouter, credential string) (*wshrpc.RpcContext, *wshrpc.CommandAuthenticateRtnData, error)
+}
+
+// the default: the jwt is only parsed locally (the router does not have the secret) and then
+// validated by the upstream, which also assigns the route id and auth token
+type JwtAuthVerifier struct{}
+
+func (JwtAuthVerifier) VerifyAuth(router *WshRouter, credential string) (*wshrpc.RpcContext, *wshrpc.CommandAuthenticateRtnData, error) {
+	// validate the token format locally before sending it upstream
+	peerCtx, err := ExtractUnverifiedRpcContext(credential)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid jwt token: %w", err)
+	}
+	if err := CheckUnverifiedTokenExpiry(credential); err != nil {
+		return nil, nil, fmt.Errorf("invalid jwt token: %w", err)
+	}
+	authRtn, err := router.HandleProxyAuth(credential)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error handling proxy auth: %w", err)
+	}
+	return peerCtx, authRtn, nil
+}
+
+// for simple setups: clients present a shared secret instead of a jwt.  the upstream never sees these
+// clients authenticate, so their traffic is sent with the router's own auth token (UpstreamAuthToken).
+type StaticSecretAuthVerifier struct {
+	Secret            string
+	UpstreamAuthToken string
+	RpcContext        wshrpc.RpcContext // context given to every client
+	Fallback          AuthVerifier      // optional, credentials that don't match the secret are passed on (e.g. JwtAuthVerifier{})
+}
+
+const staticSecretRoutePrefix = "static:"
+
+func MakeStaticSecretRouteId() string {
+	return staticSecretRoutePrefix + uuid.New().String()
+}
+
+// static secret clients share the router's upstream auth token, they never authenticated upstream themselves
+func IsStaticSecretRouteId(routeId string) bool {
+	return strings.HasPrefix(routeId, staticSecretRoutePrefix)
+}
+
+func (v *StaticSecretAuthVerifier) VerifyAuth(router *WshRouter, credential string) (*wshrpc.RpcContext, *wshrpc.CommandAuthenticateRtnData, error) {
+	if v.Secret == "" {
+		return nil, nil, errors.New("no shared secret configured")
+	}
+	if subtle.ConstantTimeCompare([]byte(credential), []byte(v.Secret)) != 1 {
+		if v.Fallback != nil {
+			return v.Fallback.VerifyAuth(router, credential)
+		}
+		return nil, nil, errors.New("invalid shared secret")
+	}
+	if v.UpstreamAuthToken == "" {
+		return nil, nil, errors.New("router is not authenticated with its upstream")
+	}
+	rpcCtx := v.RpcContext
+	return &rpcCtx, &wshrpc.CommandAuthenticateRtnData{RouteId: MakeStaticSecretRouteId(), AuthToken: v.UpstreamAuthToken}, nil
+}
+
+func (router *WshRouter) SetAuthVerifier(verifier AuthVerifier) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.authVerifier = verifier
+}
+
+// never nil (defaults to JwtAuthVerifier)
+func (router *WshRouter) GetAuthVerifier() AuthVerifier {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	if router.authVerifier == nil {
+		return JwtAuthVerifier{}
+	}
+	return router.authVerifier
+}
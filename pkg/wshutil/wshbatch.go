@@ -0,0 +1,146 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const MaxBatchRequests = 64
+const MaxBatchConcurrency = 8
+
+// checks a single sub-request before it runs (permissions the router would have checked for a
+// top level request, e.g. the token scope).  may be nil
+type BatchCheckFn func(ctx context.Context, command string) error
+
+// validates the whole batch up front, so a malformed batch fails as a whole instead of partially running
+func validateBatch(data wshrpc.CommandBatchData) error {
+	if len(data.Requests) == 0 {
+		return errors.New("batch has no requests")
+	}
+	if len(data.Requests) > MaxBatchRequests {
+		return fmt.Errorf("too many requests in batch (%d, max %d)", len(data.Requests), MaxBatchRequests)
+	}
+	if data.StopOnError && !data.Sequential {
+		return errors.New("stoponerror requires sequential")
+	}
+	for idx, subReq := range data.Requests {
+		methodDecl := WshCommandDeclMap[subReq.Command]
+		if methodDecl == nil {
+			return fmt.Errorf("request %d: unknown command %q", idx, subReq.Command)
+		}
+		if subReq.Command == wshrpc.Command_Batch {
+			return fmt.Errorf("request %d: batches cannot be nested", idx)
+		}
+		if methodDecl.CommandType != wshrpc.RpcType_Call {
+			return fmt.Errorf("request %d: command %q is a %s command, only call commands can be batched", idx, subReq.Command, methodDecl.CommandType)
+		}
+	}
+	return nil
+}
+
+// calls the impl's command method directly (same decoding as serverImplAdapter).  the context is the
+// batch's, so the sub-request sees the same source, rpc context and deadline
+func callBatchSubRequest(ctx context.Context, impl any, subReq wshrpc.BatchSubRequest, checkFn BatchCheckFn) (rtnData any, rtnErr error) {
+	if checkFn != nil {
+		if err := checkFn(ctx, subReq.Command); err != nil {
+			return nil, err
+		}
+	}
+	methodDecl := WshCommandDeclMap[subReq.Command]
+	rmethod := findCmdMethod(impl, subReq.Command)
+	if rmethod == nil {
+		return nil, fmt.Errorf("command not implemented %q", subReq.Command)
+	}
+	if w := GetWshRpcFromContext(ctx); w != nil {
+		if limiter := w.getCommandLimiter(); limiter != nil {
+			releaseFn, err := limiter.Acquire(ctx, subReq.Command)
+			if err != nil {
+				return nil, err
+			}
+			defer releaseFn()
+		}
+	}
+	callParams := []reflect.Value{reflect.ValueOf(ctx)}
+	if methodDecl.CommandDataType != nil {
+		var rpcCtx *wshrpc.RpcContext
+		if handler := GetRpcResponseHandlerFromContext(ctx); handler != nil {
+			handlerRpcCtx := handler.GetRpcContext()
+			rpcCtx = &handlerRpcCtx
+		}
+		cmdData, err := recodeCommandData(subReq.Command, subReq.Data, rpcCtx)
+		if err != nil {
+			return nil, err
+		}
+		callParams = append(callParams, reflect.ValueOf(cmdData))
+	}
+	// returned as-is if the command panics (PanicHandler recovers, the named results are kept)
+	rtnErr = fmt.Errorf("panic in command %q", subReq.Command)
+	defer panichandler.PanicHandler("batch:" + subReq.Command)
+	rtnVals := reflect.ValueOf(impl).MethodByName(rmethod.Name).Call(callParams)
+	return decodeRtnVals(rtnVals)
+}
+
+// runs every sub-request and collects the responses in request order.  one sub-request failing (or
+// panicking) only sets its own error.  once ctx is done the remaining sub-requests fail with ctx's error
+func RunBatch(ctx context.Context, impl any, data wshrpc.CommandBatchData, checkFn BatchCheckFn) (*wshrpc.CommandBatchRtnData, error) {
+	if err := validateBatch(data); err != nil {
+		return nil, err
+	}
+	rtn := &wshrpc.CommandBatchRtnData{Responses: make([]wshrpc.BatchSubResponse, len(data.Requests))}
+	runOne := func(idx int) bool {
+		subReq := data.Requests[idx]
+		resp := wshrpc.BatchSubResponse{Id: subReq.Id, Command: subReq.Command}
+		startTs := time.Now()
+		var err error
+		if err = ctx.Err(); err == nil {
+			resp.Data, err = callBatchSubRequest(ctx, impl, subReq, checkFn)
+		}
+		resp.DurationMs = time.Since(startTs).Milliseconds()
+		if err != nil {
+			resp.Data = nil
+			resp.Error = err.Error()
+		}
+		rtn.Responses[idx] = resp
+		return err == nil
+	}
+	if data.Sequential {
+		for idx := range data.Requests {
+			if !runOne(idx) && data.StopOnError {
+				for skipIdx := idx + 1; skipIdx < len(data.Requests); skipIdx++ {
+					subReq := data.Requests[skipIdx]
+					rtn.Responses[skipIdx] = wshrpc.BatchSubResponse{Id: subReq.Id, Command: subReq.Command, Skipped: true}
+				}
+				break
+			}
+		}
+	} else {
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, MaxBatchConcurrency)
+		for idx := range data.Requests {
+			wg.Add(1)
+			sem <- struct{}{}
+			go func() {
+				defer wg.Done()
+				defer func() { <-sem }()
+				runOne(idx)
+			}()
+		}
+		wg.Wait()
+	}
+	for _, resp := range rtn.Responses {
+		if resp.Error != "" {
+			rtn.Errors++
+		}
+	}
+	return rtn, nil
+}
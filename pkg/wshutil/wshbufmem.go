@@ -0,0 +1,143 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// low priority routes are disconnected once the buffered bytes pass this share of the limit
+const BufferShedFraction = 0.9
+const bufferBudgetPollInterval = 50 * time.Millisecond
+
+// server-wide cap on the bytes queued for proxies (messages routed to a client that has not written
+// them out yet).  over the limit, readers made with MakeBudgetReader stop reading new messages until
+// the backlog drains (backpressure on every client).  past BufferShedFraction low qos routes are shed.
+type BufferBudget struct {
+	Limit int64
+	Used  atomic.Int64
+	Shed  atomic.Int64 // routes disconnected to free memory (lifetime)
+}
+
+func MakeBufferBudget(limit int64) *BufferBudget {
+	return &BufferBudget{Limit: limit}
+}
+
+func (b *BufferBudget) OverLimit() bool {
+	return b.Used.Load() >= b.Limit
+}
+
+func (b *BufferBudget) shouldShed() bool {
+	return float64(b.Used.Load()) >= float64(b.Limit)*BufferShedFraction
+}
+
+func (b *BufferBudget) Snapshot() *wshrpc.BufferMemoryData {
+	return &wshrpc.BufferMemoryData{Used: b.Used.Load(), Limit: b.Limit, ShedRoutes: b.Shed.Load()}
+}
+
+// accounts every message queued in the proxy's ToRemoteCh against the budget.  the bytes are released
+// by AdaptProxyOutputToStream (as they are written) and DrainToRemote.  set before the proxy is registered.
+func (p *WshRpcProxy) SetBufferBudget(budget *BufferBudget) {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	p.budget = budget
+}
+
+func (p *WshRpcProxy) getBufferBudget() *BufferBudget {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.budget
+}
+
+func (p *WshRpcProxy) reserveBuffered(numBytes int) {
+	budget := p.getBufferBudget()
+	if budget == nil {
+		return
+	}
+	budget.Used.Add(int64(numBytes))
+	if !budget.shouldShed() {
+		return
+	}
+	peerCtx := p.GetPeerRpcContext()
+	if peerCtx == nil || peerCtx.QosClass != wshrpc.QosClass_Low {
+		return
+	}
+	if p.shed.CompareAndSwap(false, true) && p.CloseConn() {
+		budget.Shed.Add(1)
+		log.Printf("buffered messages at %d bytes (limit %d), disconnecting low priority route\n", budget.Used.Load(), budget.Limit)
+	}
+}
+
+func (p *WshRpcProxy) releaseBuffered(numBytes int) {
+	if budget := p.getBufferBudget(); budget != nil {
+		budget.Used.Add(-int64(numBytes))
+	}
+}
+
+// discards whatever is still queued for the remote (the connection is gone), returns the number of messages
+func (p *WshRpcProxy) DrainToRemote() int {
+	numDrained := 0
+	for {
+		select {
+		case msg := <-p.ToRemoteCh:
+			p.releaseBuffered(len(msg))
+			numDrained++
+		default:
+			return numDrained
+		}
+	}
+}
+
+// messages queued for the remote that haven't been written yet (including one being written)
+func (p *WshRpcProxy) PendingToRemote() int {
+	pending := len(p.ToRemoteCh)
+	if p.writing.Load() {
+		pending++
+	}
+	return pending
+}
+
+// AdaptOutputChToStream for a proxy, releases each message's bytes from the proxy's budget once written
+func AdaptProxyOutputToStream(p *WshRpcProxy, output io.Writer) error {
+	for msg := range p.ToRemoteCh {
+		p.writing.Store(true)
+		p.waitUnpaused()
+		_, err := output.Write(msg)
+		if err == nil {
+			_, err = output.Write([]byte{'\n'})
+		}
+		p.writing.Store(false)
+		p.releaseBuffered(len(msg))
+		if err != nil {
+			return fmt.Errorf("error writing to output (AdaptProxyOutputToStream): %w", err)
+		}
+	}
+	return nil
+}
+
+type budgetReader struct {
+	Reader io.Reader
+	Budget *BufferBudget
+}
+
+// waits (before each read) while the budget is over its limit
+func MakeBudgetReader(reader io.Reader, budget *BufferBudget) io.Reader {
+	if budget == nil {
+		return reader
+	}
+	return &budgetReader{Reader: reader, Budget: budget}
+}
+
+func (r *budgetReader) Read(buf []byte) (int, error) {
+	for r.Budget.OverLimit() {
+		time.Sleep(bufferBudgetPollInterval)
+	}
+	return r.Reader.Read(buf)
+}
@@ -0,0 +1,122 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const DefaultCommandQueueSize = 16
+
+// limits how many requests for a command are handled at once.  requests over the limit wait
+// (at most MaxQueue per command), past that they fail with an EC-BUSY error.
+// streaming commands hold their slot until the stream ends.
+type CommandLimiter struct {
+	Lock     *sync.Mutex
+	MaxQueue int
+	Slots    map[string]*commandSlots // command => slots
+}
+
+type commandSlots struct {
+	Limit   int
+	Sem     chan struct{}
+	Waiting int
+}
+
+// parses "remotestreamfile=4,exec=2" (command names as sent on the wire)
+func ParseCommandConcurrency(spec string) (map[string]int, error) {
+	rtn := make(map[string]int)
+	if strings.TrimSpace(spec) == "" {
+		return rtn, nil
+	}
+	declMap := wshrpc.GenerateWshCommandDeclMap()
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		command, limitStr, ok := strings.Cut(part, "=")
+		command = strings.TrimSpace(command)
+		if !ok || command == "" {
+			return nil, fmt.Errorf("invalid command limit %q (expected command=limit)", part)
+		}
+		if declMap[command] == nil {
+			return nil, fmt.Errorf("invalid command limit %q (unknown command %q)", part, command)
+		}
+		limit, err := strconv.Atoi(strings.TrimSpace(limitStr))
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid command limit %q (limit must be a positive integer)", part)
+		}
+		if _, found := rtn[command]; found {
+			return nil, fmt.Errorf("duplicate command limit for %q", command)
+		}
+		rtn[command] = limit
+	}
+	return rtn, nil
+}
+
+func MakeCommandLimiter(limits map[string]int, maxQueue int) *CommandLimiter {
+	rtn := &CommandLimiter{Lock: &sync.Mutex{}, MaxQueue: max(maxQueue, 0), Slots: make(map[string]*commandSlots)}
+	for command, limit := range limits {
+		rtn.Slots[command] = &commandSlots{Limit: limit, Sem: make(chan struct{}, limit)}
+	}
+	return rtn
+}
+
+// the returned release func must be called when the request is done (it is never nil on success)
+func (l *CommandLimiter) Acquire(ctx context.Context, command string) (func(), error) {
+	slots := l.Slots[command]
+	if slots == nil {
+		return func() {}, nil
+	}
+	release := func() { <-slots.Sem }
+	select {
+	case slots.Sem <- struct{}{}:
+		return release, nil
+	default:
+	}
+	l.Lock.Lock()
+	if slots.Waiting >= l.MaxQueue {
+		l.Lock.Unlock()
+		return nil, fmt.Errorf("EC-BUSY: too many concurrent %q requests (limit %d), retry later", command, slots.Limit)
+	}
+	slots.Waiting++
+	l.Lock.Unlock()
+	defer func() {
+		l.Lock.Lock()
+		slots.Waiting--
+		l.Lock.Unlock()
+	}()
+	select {
+	case slots.Sem <- struct{}{}:
+		return release, nil
+	case <-ctx.Done():
+		return nil, fmt.Errorf("EC-BUSY: timed out waiting for a %q slot (limit %d)", command, slots.Limit)
+	}
+}
+
+func (l *CommandLimiter) Limits() map[string]int {
+	rtn := make(map[string]int)
+	for command, slots := range l.Slots {
+		rtn[command] = slots.Limit
+	}
+	return rtn
+}
+
+// "command=limit" pairs, sorted by command
+func (l *CommandLimiter) String() string {
+	var parts []string
+	for command, limit := range l.Limits() {
+		parts = append(parts, fmt.Sprintf("%s=%d", command, limit))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
@@ -0,0 +1,133 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// a deadman route must send a "keepalive" command at least once per interval or it is disconnected.
+// only the keepalive counts (other traffic doesn't), so it proves the client is still actively there.
+// the interval is negotiated in the authenticate packet (RpcMessage.Deadman), the server's policy (see
+// SetDeadmanPolicy) is an upper bound that also applies to clients that ask for none.
+const MinDeadmanInterval = time.Second
+const MaxDeadmanInterval = time.Hour
+const DeadmanErrStr = "EC-DEADMAN"
+
+// time for the deadman message to be written before the connection is closed
+const deadmanCloseDelay = 200 * time.Millisecond
+
+type routeDeadman struct {
+	Interval time.Duration
+	Timer    *time.Timer
+}
+
+// requested is what the client asked for (0 for none), policy is the server's maximum (0 for none).
+// returns the interval to enforce, 0 if the route has no deadman
+func NegotiateDeadman(requested time.Duration, policy time.Duration) (time.Duration, error) {
+	if requested < 0 || (requested > 0 && (requested < MinDeadmanInterval || requested > MaxDeadmanInterval)) {
+		return 0, fmt.Errorf("invalid deadman interval %v (must be between %v and %v)", requested, MinDeadmanInterval, MaxDeadmanInterval)
+	}
+	if policy > 0 && (requested == 0 || requested > policy) {
+		return policy, nil
+	}
+	return requested, nil
+}
+
+func (router *WshRouter) SetDeadmanPolicy(interval time.Duration) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.deadmanPolicy = interval
+}
+
+func (router *WshRouter) GetDeadmanPolicy() time.Duration {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	return router.deadmanPolicy
+}
+
+// arms the route's deadman, the first keepalive is due one interval from now.  onMiss (optional) is called
+// after the route has been reset and is being disconnected
+func (router *WshRouter) StartRouteDeadman(routeId string, interval time.Duration, onMiss func(routeId string, interval time.Duration)) {
+	dm := &routeDeadman{Interval: interval}
+	router.Lock.Lock()
+	if old := router.deadmen[routeId]; old != nil {
+		old.Timer.Stop()
+	}
+	router.deadmen[routeId] = dm
+	dm.Timer = time.AfterFunc(interval, func() {
+		defer panichandler.PanicHandler("WshRouter:deadman")
+		router.deadmanExpired(routeId, dm, onMiss)
+	})
+	router.Lock.Unlock()
+	router.stats.setDeadman(routeId, interval.Milliseconds())
+}
+
+// must hold lock
+func (router *WshRouter) stopRouteDeadmanLocked(routeId string) {
+	if dm := router.deadmen[routeId]; dm != nil {
+		dm.Timer.Stop()
+		delete(router.deadmen, routeId)
+	}
+}
+
+// returns false if the route has no deadman (the keepalive is then routed like any other command)
+func (router *WshRouter) recordKeepalive(routeId string) bool {
+	router.Lock.Lock()
+	dm := router.deadmen[routeId]
+	if dm != nil {
+		dm.Timer.Reset(dm.Interval)
+	}
+	router.Lock.Unlock()
+	if dm == nil {
+		return false
+	}
+	router.stats.recordKeepalive(routeId)
+	return true
+}
+
+// called from the route's recv loop, true if msg was a keepalive that was consumed here
+func (router *WshRouter) handleRouteKeepalive(routeId string, msg RpcMessage) bool {
+	if msg.Command != wshrpc.Command_Keepalive || !router.recordKeepalive(routeId) {
+		return false
+	}
+	if msg.ReqId != "" {
+		respBytes, _ := json.Marshal(RpcMessage{ResId: msg.ReqId})
+		router.sendRoutedMessage(respBytes, routeId)
+	}
+	return true
+}
+
+// the route's in-flight requests fail with EC-RESET, the client is told why and the connection is closed
+// (the normal cleanup then disposes of the route)
+func (router *WshRouter) deadmanExpired(routeId string, dm *routeDeadman, onMiss func(routeId string, interval time.Duration)) {
+	router.Lock.Lock()
+	if router.deadmen[routeId] != dm {
+		// stopped or replaced, or a keepalive raced the timer
+		router.Lock.Unlock()
+		return
+	}
+	delete(router.deadmen, routeId)
+	router.Lock.Unlock()
+	reason := fmt.Sprintf("%s: no keepalive within %v, route %q disconnected", DeadmanErrStr, dm.Interval, routeId)
+	log.Printf("[router] %s\n", reason)
+	proxy, err := router.getLocalProxy(routeId)
+	if err != nil {
+		return
+	}
+	router.ResetRoute(routeId, false)
+	msgBytes, _ := json.Marshal(RpcMessage{Command: wshrpc.Command_Message, Route: routeId, Data: wshrpc.CommandMessageData{Message: reason}})
+	proxy.SendRpcMessage(msgBytes)
+	if onMiss != nil {
+		onMiss(routeId, dm.Interval)
+	}
+	time.Sleep(deadmanCloseDelay)
+	proxy.CloseConn()
+}
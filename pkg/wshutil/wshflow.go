@@ -0,0 +1,112 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/util/utilfn"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// cooperative backpressure.  when a route's outstanding requests reach the high watermark the router sends
+// it a flowcontrol "slowdown", and a "resume" once they drop to the low watermark (the gap avoids flapping).
+// a WshRpc that was told to slow down delays each new request by FlowControlSendDelay until it resumes.
+
+const FlowControlSendDelay = 100 * time.Millisecond
+const flowControlHighPercent = 80 // of --max-inflight-per-route, when no explicit watermark is set
+
+// high 0 derives it from the in-flight limit (80%), low 0 uses half of high.  backpressure is off
+// when there is neither a high watermark nor an in-flight limit
+func (router *WshRouter) SetBackpressure(high int, low int) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	if high <= 0 && router.maxInflight > 0 {
+		high = max(router.maxInflight*flowControlHighPercent/100, 1)
+	}
+	if low <= 0 || low >= high {
+		low = high / 2
+	}
+	router.backpressureHigh = max(high, 0)
+	router.backpressureLow = max(low, 0)
+}
+
+func (router *WshRouter) GetBackpressure() (int, int) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	return router.backpressureHigh, router.backpressureLow
+}
+
+func (router *WshRouter) IsRouteSlowedDown(routeId string) bool {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	return router.slowedRoutes[routeId]
+}
+
+// sends slowdown/resume when the route crosses a watermark (called after its in-flight count changes)
+func (router *WshRouter) updateBackpressure(routeId string) {
+	if routeId == "" || routeId == UpstreamRoute {
+		return
+	}
+	router.Lock.Lock()
+	high, low := router.backpressureHigh, router.backpressureLow
+	count := router.inflight[routeId]
+	slowed := router.slowedRoutes[routeId]
+	var action string
+	if high > 0 && !slowed && count >= high {
+		router.slowedRoutes[routeId] = true
+		action = wshrpc.FlowControl_SlowDown
+	} else if slowed && count <= low {
+		delete(router.slowedRoutes, routeId)
+		action = wshrpc.FlowControl_Resume
+	}
+	maxInflight := router.maxInflight
+	router.Lock.Unlock()
+	if action == "" {
+		return
+	}
+	data := wshrpc.FlowControlData{Action: action, InFlight: count, Limit: maxInflight}
+	if action == wshrpc.FlowControl_SlowDown {
+		data.Reason = fmt.Sprintf("%d requests outstanding (slowdown at %d)", count, high)
+	}
+	msgBytes, _ := json.Marshal(RpcMessage{Command: wshrpc.Command_FlowControl, Route: routeId, Data: data})
+	router.sendRoutedMessage(msgBytes, routeId)
+}
+
+func (w *WshRpc) recvFlowControl(msg RpcMessage) {
+	var data wshrpc.FlowControlData
+	if err := utilfn.ReUnmarshal(&data, msg.Data); err != nil {
+		log.Printf("wshrpc received bad flowcontrol message: %v\n", err)
+		return
+	}
+	switch data.Action {
+	case wshrpc.FlowControl_SlowDown:
+		if !w.slowedDown.Swap(true) {
+			log.Printf("[%s] router requested slowdown: %s\n", w.DebugName, data.Reason)
+		}
+	case wshrpc.FlowControl_Resume:
+		w.slowedDown.Store(false)
+	}
+}
+
+func (w *WshRpc) IsSlowedDown() bool {
+	return w.slowedDown.Load()
+}
+
+// delays a new request while the router has asked us to slow down (returns early if ctx is done)
+func (w *WshRpc) waitForFlowControl(ctx context.Context) {
+	if !w.slowedDown.Load() {
+		return
+	}
+	timer := time.NewTimer(FlowControlSendDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
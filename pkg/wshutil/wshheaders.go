@@ -0,0 +1,83 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+)
+
+// headers are optional string metadata on a request (trace ids, user context, routing hints).  they
+// are set with RpcOpts.Headers, travel with the request through every router untouched, and are
+// readable by the handler (GetRpcHeaders).  responses don't carry headers.
+const MaxHeaders = 32
+const MaxHeaderKeyLen = 128
+const MaxHeaderBytes = 8 * 1024 // all keys plus values
+
+func isHeaderKeyChar(ch rune) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') ||
+		ch == '-' || ch == '_' || ch == '.' || ch == ':'
+}
+
+// nil and empty are valid
+func ValidateHeaders(headers map[string]string) error {
+	if len(headers) > MaxHeaders {
+		return fmt.Errorf("too many headers (%d, max %d)", len(headers), MaxHeaders)
+	}
+	totalBytes := 0
+	for key, val := range headers {
+		if key == "" || len(key) > MaxHeaderKeyLen {
+			return fmt.Errorf("invalid header key %q (must be 1 to %d chars)", key, MaxHeaderKeyLen)
+		}
+		for _, ch := range key {
+			if !isHeaderKeyChar(ch) {
+				return fmt.Errorf("invalid header key %q (only letters, digits and -_.: are allowed)", key)
+			}
+		}
+		totalBytes += len(key) + len(val)
+	}
+	if totalBytes > MaxHeaderBytes {
+		return fmt.Errorf("headers too large (%d bytes, max %d)", totalBytes, MaxHeaderBytes)
+	}
+	return nil
+}
+
+func (r *RpcMessage) checkHeaders() error {
+	if r.Command == "" {
+		return fmt.Errorf("only command packets may have headers set")
+	}
+	return ValidateHeaders(r.Headers)
+}
+
+// the request is not forwarded, the sender gets the error (if it expects a response)
+func (router *WshRouter) sendHeaderError(routeId string, msg RpcMessage, err error) {
+	if msg.ReqId == "" {
+		return
+	}
+	respBytes, _ := json.Marshal(RpcMessage{ResId: msg.ReqId, Error: fmt.Sprintf("invalid headers: %v", err)})
+	router.sendRoutedMessage(respBytes, routeId)
+}
+
+// a copy of the request's headers (nil if it had none or ctx is not a request context)
+func GetRpcHeaders(ctx context.Context) map[string]string {
+	handler := GetRpcResponseHandlerFromContext(ctx)
+	if handler == nil {
+		return nil
+	}
+	return handler.GetHeaders()
+}
+
+func GetRpcHeader(ctx context.Context, key string) string {
+	handler := GetRpcResponseHandlerFromContext(ctx)
+	if handler == nil {
+		return ""
+	}
+	return handler.headers[key]
+}
+
+func (handler *RpcResponseHandler) GetHeaders() map[string]string {
+	return maps.Clone(handler.headers)
+}
@@ -0,0 +1,109 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// an optional idle check for proxy routes (half-open or wedged connections never return from the read).
+// any bytes read from the remote count as activity.  once a route was silent for the idle timeout it
+// is sent a ping (a keepalive request, any response will do), if nothing at all arrives within the
+// grace the route is considered dead.  the ping is queued on the proxy's ToRemoteCh, so
+// AdaptProxyOutputToStream stays the only writer on the connection.
+const DefaultIdlePingGrace = 10 * time.Second
+const IdlePingReqIdPrefix = "idleping:"
+
+type ActivityTracker struct {
+	last atomic.Int64 // unix nanos
+}
+
+func MakeActivityTracker() *ActivityTracker {
+	rtn := &ActivityTracker{}
+	rtn.Touch()
+	return rtn
+}
+
+func (t *ActivityTracker) Touch() {
+	t.last.Store(time.Now().UnixNano())
+}
+
+func (t *ActivityTracker) LastActivity() time.Time {
+	return time.Unix(0, t.last.Load())
+}
+
+type activityReader struct {
+	Reader  io.Reader
+	Tracker *ActivityTracker
+}
+
+// records activity on every successful read (partial packets included)
+func MakeActivityReader(reader io.Reader, tracker *ActivityTracker) io.Reader {
+	return &activityReader{Reader: reader, Tracker: tracker}
+}
+
+func (r *activityReader) Read(buf []byte) (int, error) {
+	n, err := r.Reader.Read(buf)
+	if n > 0 {
+		r.Tracker.Touch()
+	}
+	return n, err
+}
+
+// the ping grace, capped at the idle timeout
+func idlePingGrace(idleTimeout time.Duration) time.Duration {
+	return min(DefaultIdlePingGrace, idleTimeout)
+}
+
+// sends the ping, true if there was any activity within the grace.  the response (if it comes back in
+// time) is consumed by the router as a simple request
+func (router *WshRouter) pingIdleRoute(routeId string, proxy *WshRpcProxy, tracker *ActivityTracker, grace time.Duration, done <-chan struct{}) bool {
+	pingTime := time.Now()
+	reqId := IdlePingReqIdPrefix + uuid.New().String()
+	respCh := router.registerSimpleRequest(reqId)
+	defer router.clearSimpleRequest(reqId)
+	pingBytes, _ := json.Marshal(RpcMessage{Command: wshrpc.Command_Keepalive, ReqId: reqId, Route: routeId, Timeout: int(grace.Milliseconds())})
+	proxy.SendRpcMessage(pingBytes)
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-respCh:
+	case <-timer.C:
+	}
+	return !tracker.LastActivity().Before(pingTime)
+}
+
+// runs until done is closed or the route is found dead (onIdle is then called, it should close the
+// connection, the normal cleanup unregisters the route).  a paused proxy isn't pinged, its output is
+// held so the ping couldn't reach the remote
+func (router *WshRouter) RunIdleCheck(routeId string, proxy *WshRpcProxy, tracker *ActivityTracker, idleTimeout time.Duration, done <-chan struct{}, onIdle func(idleFor time.Duration)) {
+	timer := time.NewTimer(idleTimeout)
+	defer timer.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-timer.C:
+		}
+		idleFor := time.Since(tracker.LastActivity())
+		if idleFor < idleTimeout {
+			timer.Reset(idleTimeout - idleFor)
+			continue
+		}
+		if proxy.IsPaused() || router.pingIdleRoute(routeId, proxy, tracker, idlePingGrace(idleTimeout), done) {
+			timer.Reset(idleTimeout)
+			continue
+		}
+		onIdle(time.Since(tracker.LastActivity()))
+		return
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// limits the requests a route can have outstanding (sent, no final response yet) through the router.
+// counted from the RpcMap, so only requests that expect a response count.  the upstream is never limited.
+// 0 disables the limit
+func (router *WshRouter) SetMaxInflightPerRoute(maxInflight int) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.maxInflight = max(maxInflight, 0)
+}
+
+func (router *WshRouter) GetInflightCount(routeId string) int {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	return router.inflight[routeId]
+}
+
+// must hold router.Lock
+func (router *WshRouter) addRouteInfoLocked(info *routeInfo) {
+	if old := router.RpcMap[info.RpcId]; old != nil {
+		// reused reqid, the old request no longer gets a response through the router
+		router.removeRouteInfoLocked(old.RpcId)
+	}
+	router.RpcMap[info.RpcId] = info
+	if info.FromRouteId != "" {
+		router.inflight[info.FromRouteId]++
+	}
+}
+
+// must hold router.Lock
+func (router *WshRouter) removeRouteInfoLocked(rpcId string) {
+	info := router.RpcMap[rpcId]
+	if info == nil {
+		return
+	}
+	delete(router.RpcMap, rpcId)
+	if info.FromRouteId == "" {
+		return
+	}
+	router.inflight[info.FromRouteId]--
+	if router.inflight[info.FromRouteId] <= 0 {
+		delete(router.inflight, info.FromRouteId)
+	}
+}
+
+// a route that goes away stops counting its requests (a reconnect with the same route id starts at 0)
+//
+// must hold router.Lock
+func (router *WshRouter) clearInflightLocked(routeId string) {
+	if router.inflight[routeId] == 0 {
+		return
+	}
+	for _, info := range router.RpcMap {
+		if info.FromRouteId == routeId {
+			info.FromRouteId = ""
+		}
+	}
+	delete(router.inflight, routeId)
+}
+
+// rejects a new request from a route that is at its in-flight limit.  returns false if the
+// message was rejected (the sender gets an error response)
+func (router *WshRouter) checkInflightLimit(msg RpcMessage, fromRouteId string) bool {
+	if msg.ReqId == "" || fromRouteId == UpstreamRoute {
+		return true
+	}
+	router.Lock.Lock()
+	maxInflight := router.maxInflight
+	count := router.inflight[fromRouteId]
+	router.Lock.Unlock()
+	if maxInflight == 0 || count < maxInflight {
+		return true
+	}
+	respBytes, _ := json.Marshal(RpcMessage{
+		ResId: msg.ReqId,
+		Error: fmt.Sprintf("EC-BUSY: too many outstanding requests from route %q (limit %d), retry after some complete", fromRouteId, maxInflight),
+	})
+	router.sendRoutedMessage(respBytes, fromRouteId)
+	return false
+}
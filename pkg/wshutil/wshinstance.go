@@ -0,0 +1,145 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const MaxInstanceIdLen = 64
+
+// instances the router remembers after their route is gone (the oldest are evicted)
+const MaxInstanceHistory = 1024
+
+// a client instance id is a stable id chosen by the client (kept across reconnects) so the server can
+// correlate its routes.  it is only sent in the authenticate packet.
+type clientInstance struct {
+	RouteId     string // live route, empty when disconnected
+	LastRouteId string
+	Reconnects  int
+	Stats       *wshrpc.RouteStatsData // counters of the last route, saved when it went away
+	GoneTs      int64
+}
+
+func isInstanceIdChar(ch rune) bool {
+	return (ch >= 'a' && ch <= 'z') || (ch >= 'A' && ch <= 'Z') || (ch >= '0' && ch <= '9') ||
+		ch == '-' || ch == '_' || ch == '.' || ch == ':'
+}
+
+// empty is valid (the client did not send one)
+func ValidateInstanceId(instanceId string) error {
+	if len(instanceId) > MaxInstanceIdLen {
+		return fmt.Errorf("invalid instance id (longer than %d chars)", MaxInstanceIdLen)
+	}
+	for _, ch := range instanceId {
+		if !isInstanceIdChar(ch) {
+			return fmt.Errorf("invalid instance id %q (only letters, digits and -_.: are allowed)", instanceId)
+		}
+	}
+	return nil
+}
+
+// when set, a reconnecting instance's new route starts with the counters of its previous route
+func (router *WshRouter) SetCarryInstanceStats(carry bool) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.carryInstanceStats = carry
+}
+
+func (router *WshRouter) GetRouteInstanceId(routeId string) string {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	return router.routeInstances[routeId]
+}
+
+// records the route as the instance's current connection.  an instance has at most one live route, if it
+// is still connected on another route that route id is returned (stale, the caller should reset it).
+func (router *WshRouter) BindInstance(routeId string, instanceId string) (string, error) {
+	if instanceId == "" {
+		return "", nil
+	}
+	if err := ValidateInstanceId(instanceId); err != nil {
+		return "", err
+	}
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	if router.RouteMap[routeId] == nil {
+		return "", fmt.Errorf("cannot bind instance %q, route %q is not registered", instanceId, routeId)
+	}
+	if curInstanceId := router.routeInstances[routeId]; curInstanceId != "" && curInstanceId != instanceId {
+		return "", fmt.Errorf("route %q is already bound to instance %q", routeId, curInstanceId)
+	}
+	inst := router.instances[instanceId]
+	if inst == nil {
+		router.evictInstancesLocked()
+		inst = &clientInstance{}
+		router.instances[instanceId] = inst
+	}
+	var staleRouteId string
+	if inst.RouteId != "" && inst.RouteId != routeId {
+		// the old connection is still registered (e.g. the client reconnected before we saw the disconnect)
+		staleRouteId = inst.RouteId
+		router.saveInstanceStatsLocked(inst, staleRouteId)
+		delete(router.routeInstances, staleRouteId)
+	}
+	if inst.LastRouteId != "" && inst.LastRouteId != routeId {
+		inst.Reconnects++
+	}
+	router.stats.setInstance(routeId, instanceId, inst.LastRouteId, inst.Reconnects)
+	if router.carryInstanceStats && inst.Stats != nil {
+		router.stats.carryCounters(routeId, inst.Stats)
+	}
+	inst.RouteId = routeId
+	inst.LastRouteId = routeId
+	inst.Stats = nil
+	inst.GoneTs = 0
+	router.routeInstances[routeId] = instanceId
+	return staleRouteId, nil
+}
+
+// must hold router.Lock
+func (router *WshRouter) saveInstanceStatsLocked(inst *clientInstance, routeId string) {
+	inst.LastRouteId = routeId
+	inst.Stats = router.stats.getRouteCopy(routeId)
+	inst.RouteId = ""
+	inst.GoneTs = time.Now().UnixMilli()
+}
+
+// called when the route is unregistered (before its stats are removed), must hold router.Lock
+func (router *WshRouter) releaseInstanceLocked(routeId string) {
+	instanceId := router.routeInstances[routeId]
+	if instanceId == "" {
+		return
+	}
+	delete(router.routeInstances, routeId)
+	inst := router.instances[instanceId]
+	if inst == nil || inst.RouteId != routeId {
+		return
+	}
+	router.saveInstanceStatsLocked(inst, routeId)
+}
+
+// drops disconnected instances (oldest first) to make room for a new one, must hold router.Lock
+func (router *WshRouter) evictInstancesLocked() {
+	for len(router.instances) >= MaxInstanceHistory {
+		var oldestId string
+		var oldestTs int64
+		for instanceId, inst := range router.instances {
+			if inst.RouteId != "" {
+				continue
+			}
+			if oldestId == "" || inst.GoneTs < oldestTs {
+				oldestId, oldestTs = instanceId, inst.GoneTs
+			}
+		}
+		if oldestId == "" {
+			// every instance is connected, the table grows past the limit rather than forget a live route
+			return
+		}
+		delete(router.instances, oldestId)
+	}
+}
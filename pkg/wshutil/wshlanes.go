@@ -0,0 +1,159 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"sync"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+)
+
+// messages this big are bulk (file chunks, sysinfo history, big listings), they wait for stream credit
+const BulkMessageSize = 16 * 1024
+
+// writes a channel of messages to a flow controlled stream (see packetparser.PacketStream) with two
+// lanes.  bulk messages wait while canSendBulk is false, the interactive ones queued behind them are
+// written first.  the messages of one request (and of one event type to one route) are never reordered,
+// once one of them is waiting in the bulk lane the next ones follow it there.  a nil message (a flush
+// marker) goes through the bulk lane too, it is passed to writeFn after everything queued before it
+type LaneWriter struct {
+	lock        *sync.Mutex
+	cond        *sync.Cond
+	writeFn     func(msg []byte) error
+	canSendBulk func() bool
+	maxQueued   int
+	interactive [][]byte
+	bulk        []laneMsg
+	bulkKeys    map[string]int // key => messages in the bulk lane
+	closed      bool           // the input is closed, bulk messages no longer wait
+	failed      bool           // writeFn failed, the rest of the input is discarded
+}
+
+type laneMsg struct {
+	Msg []byte
+	Key string
+}
+
+func MakeLaneWriter(writeFn func(msg []byte) error, canSendBulk func() bool, maxQueued int) *LaneWriter {
+	lock := &sync.Mutex{}
+	return &LaneWriter{
+		lock:        lock,
+		cond:        sync.NewCond(lock),
+		writeFn:     writeFn,
+		canSendBulk: canSendBulk,
+		maxQueued:   max(maxQueued, 1),
+		bulkKeys:    make(map[string]int),
+	}
+}
+
+// call when canSendBulk may have become true (e.g. from packetparser.PacketStream.SetCreditFn)
+func (lw *LaneWriter) Wake() {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	lw.cond.Broadcast()
+}
+
+// what keeps messages in order: the request (a response has the ResId of its request), or for
+// messages without ids (events) the command and route
+func getLaneKey(msg []byte) string {
+	var ids struct {
+		Command string `json:"command,omitempty"`
+		Route   string `json:"route,omitempty"`
+		ReqId   string `json:"reqid,omitempty"`
+		ResId   string `json:"resid,omitempty"`
+	}
+	if err := json.Unmarshal(msg, &ids); err != nil {
+		return ""
+	}
+	switch {
+	case ids.ReqId != "":
+		return ids.ReqId
+	case ids.ResId != "":
+		return ids.ResId
+	}
+	return ids.Command + "\x00" + ids.Route
+}
+
+func (lw *LaneWriter) enqueue(msg []byte) {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	for len(lw.interactive)+len(lw.bulk) >= lw.maxQueued && !lw.failed {
+		lw.cond.Wait()
+	}
+	if lw.failed {
+		return
+	}
+	if msg == nil {
+		lw.bulk = append(lw.bulk, laneMsg{})
+		lw.cond.Broadcast()
+		return
+	}
+	key := getLaneKey(msg)
+	if len(msg) >= BulkMessageSize || lw.bulkKeys[key] > 0 {
+		lw.bulk = append(lw.bulk, laneMsg{Msg: msg, Key: key})
+		lw.bulkKeys[key]++
+	} else {
+		lw.interactive = append(lw.interactive, msg)
+	}
+	lw.cond.Broadcast()
+}
+
+// the next message to write, false once the input is closed and everything was written
+func (lw *LaneWriter) next() ([]byte, bool) {
+	lw.lock.Lock()
+	defer lw.lock.Unlock()
+	for {
+		if len(lw.interactive) > 0 {
+			msg := lw.interactive[0]
+			lw.interactive = lw.interactive[1:]
+			lw.cond.Broadcast()
+			return msg, true
+		}
+		if len(lw.bulk) > 0 && (lw.bulk[0].Msg == nil || lw.closed || lw.canSendBulk()) {
+			head := lw.bulk[0]
+			lw.bulk = lw.bulk[1:]
+			if head.Msg != nil {
+				if lw.bulkKeys[head.Key]--; lw.bulkKeys[head.Key] <= 0 {
+					delete(lw.bulkKeys, head.Key)
+				}
+			}
+			lw.cond.Broadcast()
+			return head.Msg, true
+		}
+		if lw.closed && len(lw.bulk) == 0 {
+			return nil, false
+		}
+		lw.cond.Wait()
+	}
+}
+
+// until outputCh is closed (and drained) or writeFn fails (its error is returned)
+func (lw *LaneWriter) Run(outputCh chan []byte) error {
+	go func() {
+		defer panichandler.PanicHandler("LaneWriter:enqueue")
+		for msg := range outputCh {
+			lw.enqueue(msg)
+		}
+		lw.lock.Lock()
+		lw.closed = true
+		lw.cond.Broadcast()
+		lw.lock.Unlock()
+	}()
+	for {
+		msg, ok := lw.next()
+		if !ok {
+			return nil
+		}
+		if err := lw.writeFn(msg); err != nil {
+			lw.lock.Lock()
+			lw.failed = true
+			lw.interactive = nil
+			lw.bulk = nil
+			lw.cond.Broadcast()
+			lw.lock.Unlock()
+			return err
+		}
+	}
+}
@@ -0,0 +1,140 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/wavetermdev/waveterm/pkg/util/ratelog"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// while a proxy is paused AdaptProxyOutputToStream stops writing, so messages queue in ToRemoteCh.
+// once it is full the pause's overflow policy applies in SendRpcMessage (see CommandPauseRouteData).
+type proxyPause struct {
+	ResumeCh chan struct{} // closed on resume
+	Overflow string
+	Dropped  int64
+	Closed   bool // the overflow disconnect already ran
+}
+
+func (p *WshRpcProxy) Pause(overflow string) error {
+	if overflow == "" {
+		overflow = FullChPolicy_Disconnect
+	}
+	if overflow != FullChPolicy_Disconnect && overflow != FullChPolicy_Drop {
+		return fmt.Errorf("invalid overflow policy %q (must be %q or %q)", overflow, FullChPolicy_Disconnect, FullChPolicy_Drop)
+	}
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	if p.pause != nil {
+		p.pause.Overflow = overflow
+		return nil
+	}
+	p.pause = &proxyPause{ResumeCh: make(chan struct{}), Overflow: overflow}
+	return nil
+}
+
+// returns the messages dropped while paused, false if the proxy wasn't paused
+func (p *WshRpcProxy) Resume() (int64, bool) {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	if p.pause == nil {
+		return 0, false
+	}
+	close(p.pause.ResumeCh)
+	dropped := p.pause.Dropped
+	p.pause = nil
+	return dropped, true
+}
+
+func (p *WshRpcProxy) IsPaused() bool {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.pause != nil
+}
+
+func (p *WshRpcProxy) getPause() *proxyPause {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.pause
+}
+
+func (p *WshRpcProxy) waitUnpaused() {
+	if pause := p.getPause(); pause != nil {
+		<-pause.ResumeCh
+	}
+}
+
+// returns false if the message was not queued (dropped, or the connection was closed)
+func (p *WshRpcProxy) sendPaused(msg []byte, pause *proxyPause) bool {
+	select {
+	case p.ToRemoteCh <- msg:
+		return true
+	default:
+	}
+	p.Lock.Lock()
+	if p.pause != pause {
+		// resumed in the meantime, the writer is draining the channel again
+		p.Lock.Unlock()
+		p.ToRemoteCh <- msg
+		return true
+	}
+	pause.Dropped++
+	doClose := pause.Overflow == FullChPolicy_Disconnect && !pause.Closed
+	if doClose {
+		pause.Closed = true
+	}
+	p.Lock.Unlock()
+	if doClose {
+		log.Printf("paused route output queue is full (%d messages), disconnecting\n", len(p.ToRemoteCh))
+		p.CloseConn()
+	} else if pause.Overflow == FullChPolicy_Drop {
+		ratelog.Printf("paused route output queue is full, dropping message\n")
+	}
+	return false
+}
+
+func (router *WshRouter) getLocalProxy(routeId string) (*WshRpcProxy, error) {
+	rpc := router.GetRpc(routeId)
+	if rpc == nil {
+		return nil, fmt.Errorf("no local route %q", routeId)
+	}
+	proxy, ok := rpc.(*WshRpcProxy)
+	if !ok {
+		return nil, fmt.Errorf("route %q is not a listener connection", routeId)
+	}
+	return proxy, nil
+}
+
+func (router *WshRouter) PauseRoute(routeId string, overflow string) (*wshrpc.PauseRouteRtnData, error) {
+	proxy, err := router.getLocalProxy(routeId)
+	if err != nil {
+		return nil, err
+	}
+	if err := proxy.Pause(overflow); err != nil {
+		return nil, err
+	}
+	pause := proxy.getPause()
+	rtn := &wshrpc.PauseRouteRtnData{RouteId: routeId, Paused: true, Queued: len(proxy.ToRemoteCh)}
+	if pause != nil {
+		rtn.Overflow = pause.Overflow
+	}
+	return rtn, nil
+}
+
+// Queued is what the writer is about to flush
+func (router *WshRouter) ResumeRoute(routeId string) (*wshrpc.PauseRouteRtnData, error) {
+	proxy, err := router.getLocalProxy(routeId)
+	if err != nil {
+		return nil, err
+	}
+	queued := len(proxy.ToRemoteCh)
+	dropped, wasPaused := proxy.Resume()
+	if !wasPaused {
+		return nil, fmt.Errorf("route %q is not paused", routeId)
+	}
+	return &wshrpc.PauseRouteRtnData{RouteId: routeId, Queued: queued, Dropped: dropped}, nil
+}
@@ -0,0 +1,215 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const MaxPolicyRules = 256
+
+// one rule of a command policy.  the match fields are ANDed, an empty field matches every route.
+// Allow (empty for every command) and Deny take scope entries (commands, presets, "*" or "prefix*"),
+// Deny wins over Allow
+type CommandPolicyRule struct {
+	Name       string   `json:"name,omitempty"`       // shown in errors and in the route info
+	Routes     []string `json:"routes,omitempty"`     // route id globs (path.Match syntax), e.g. "static:*"
+	BlockTypes []string `json:"blocktypes,omitempty"` // the block type from the route's token
+	Auth       string   `json:"auth,omitempty"`       // "jwt" or "static" (see RouteAuth_*)
+	Allow      []string `json:"allow,omitempty"`
+	Deny       []string `json:"deny,omitempty"`
+}
+
+// restricts what listener clients may invoke, on top of their token scope (a command must be allowed by
+// both).  the first matching rule applies, Default (if set) applies to routes no rule matches, routes
+// matching nothing are unrestricted.  static secret routes have no token scope, so for them matching
+// nothing means staticSecretNoRule (refused everything)
+type CommandPolicy struct {
+	Rules   []CommandPolicyRule `json:"rules"`
+	Default *CommandPolicyRule  `json:"default,omitempty"`
+}
+
+// a command refused by the token scope or the policy, Reason is CommandDenied_*
+type CommandDeniedError struct {
+	Command string
+	Reason  string
+	Rule    string // the policy rule, for CommandDenied_Policy
+}
+
+const (
+	CommandDenied_Scope  = "scope"
+	CommandDenied_Policy = "policy"
+)
+
+func (e *CommandDeniedError) Error() string {
+	if e.Reason == CommandDenied_Policy {
+		return fmt.Sprintf("permission denied: command %s is not allowed by the connserver policy (rule %s)", e.Command, e.Rule)
+	}
+	return fmt.Sprintf("permission denied: command %s is not allowed by the token scope", e.Command)
+}
+
+func validatePolicyRule(rule *CommandPolicyRule) error {
+	for _, pattern := range rule.Routes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid route pattern %q: %w", pattern, err)
+		}
+	}
+	if rule.Auth != "" && rule.Auth != RouteAuth_Jwt && rule.Auth != RouteAuth_Static {
+		return fmt.Errorf("invalid auth %q (must be %s or %s)", rule.Auth, RouteAuth_Jwt, RouteAuth_Static)
+	}
+	for _, entry := range slices.Concat(rule.Allow, rule.Deny) {
+		if err := ValidateScopeEntry(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// rules without a name are named by their position ("#1" for the first)
+func ParseCommandPolicy(barr []byte) (*CommandPolicy, error) {
+	var policy CommandPolicy
+	if err := json.Unmarshal(barr, &policy); err != nil {
+		return nil, fmt.Errorf("invalid policy json: %w", err)
+	}
+	if len(policy.Rules) == 0 && policy.Default == nil {
+		return nil, errors.New("policy has no rules")
+	}
+	if len(policy.Rules) > MaxPolicyRules {
+		return nil, fmt.Errorf("too many policy rules (%d, max %d)", len(policy.Rules), MaxPolicyRules)
+	}
+	for idx := range policy.Rules {
+		rule := &policy.Rules[idx]
+		if rule.Name == "" {
+			rule.Name = fmt.Sprintf("#%d", idx+1)
+		}
+		if err := validatePolicyRule(rule); err != nil {
+			return nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+	}
+	if policy.Default != nil {
+		if len(policy.Default.Routes) > 0 || len(policy.Default.BlockTypes) > 0 || policy.Default.Auth != "" {
+			return nil, errors.New("the default rule cannot have routes, blocktypes or auth")
+		}
+		if policy.Default.Name == "" {
+			policy.Default.Name = "default"
+		}
+		if err := validatePolicyRule(policy.Default); err != nil {
+			return nil, fmt.Errorf("default rule: %w", err)
+		}
+	}
+	return &policy, nil
+}
+
+func ReadCommandPolicyFile(fileName string) (*CommandPolicy, error) {
+	barr, err := os.ReadFile(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read policy file: %w", err)
+	}
+	policy, err := ParseCommandPolicy(barr)
+	if err != nil {
+		return nil, fmt.Errorf("policy file %q: %w", fileName, err)
+	}
+	return policy, nil
+}
+
+func (rule *CommandPolicyRule) matchesRoute(routeId string, rpcCtx *wshrpc.RpcContext) bool {
+	if len(rule.Routes) > 0 && !slices.ContainsFunc(rule.Routes, func(pattern string) bool {
+		matched, _ := path.Match(pattern, routeId)
+		return matched
+	}) {
+		return false
+	}
+	if len(rule.BlockTypes) > 0 {
+		blockType := ""
+		if rpcCtx != nil {
+			blockType = wshrpc.NormalizeBlockType(rpcCtx.BlockType)
+		}
+		if !slices.ContainsFunc(rule.BlockTypes, func(bt string) bool { return wshrpc.NormalizeBlockType(bt) == blockType }) {
+			return false
+		}
+	}
+	if rule.Auth != "" && rule.Auth != getRouteAuthState(routeId) {
+		return false
+	}
+	return true
+}
+
+func (rule *CommandPolicyRule) AllowsCommand(command string) bool {
+	if alwaysAllowedCommands[command] {
+		return true
+	}
+	for _, entry := range rule.Deny {
+		if scopeEntryMatches(entry, command) {
+			return false
+		}
+	}
+	return len(rule.Allow) == 0 || ScopeAllowsCommand(rule.Allow, command)
+}
+
+// static secret clients share the router's upstream token and have no token scope of their own, so a
+// policy that has no rule for them must not leave them with every command
+var staticSecretNoRule = CommandPolicyRule{Name: "no rule for static secret clients", Auth: RouteAuth_Static, Deny: []string{"*"}}
+
+// the rule that applies to a route, nil if the route is unrestricted
+func (policy *CommandPolicy) GetRouteRule(routeId string, rpcCtx *wshrpc.RpcContext) *CommandPolicyRule {
+	if policy == nil {
+		return nil
+	}
+	for idx := range policy.Rules {
+		if policy.Rules[idx].matchesRoute(routeId, rpcCtx) {
+			return &policy.Rules[idx]
+		}
+	}
+	if policy.Default == nil && IsStaticSecretRouteId(routeId) {
+		return &staticSecretNoRule
+	}
+	return policy.Default
+}
+
+// applies to listener clients (proxy routes) only, nil clears the policy
+func (router *WshRouter) SetCommandPolicy(policy *CommandPolicy) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.policy = policy
+}
+
+func (router *WshRouter) GetCommandPolicy() *CommandPolicy {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	return router.policy
+}
+
+// the policy rule that applies to a listener client, nil if none does (or it isn't a listener client)
+func (router *WshRouter) GetRoutePolicyRule(routeId string) *CommandPolicyRule {
+	proxy, ok := router.GetRpc(routeId).(*WshRpcProxy)
+	if !ok {
+		return nil
+	}
+	return router.GetCommandPolicy().GetRouteRule(routeId, proxy.GetPeerRpcContext())
+}
+
+// checks a command from a route against its token scope and the policy, returns a *CommandDeniedError
+// if it is refused.  only listener clients (proxy routes) are restricted
+func (router *WshRouter) CheckRouteCommand(routeId string, command string) error {
+	proxy, ok := router.GetRpc(routeId).(*WshRpcProxy)
+	if !ok {
+		return nil
+	}
+	peerCtx := proxy.GetPeerRpcContext()
+	if peerCtx != nil && !ScopeAllowsCommand(peerCtx.Scope, command) {
+		return &CommandDeniedError{Command: command, Reason: CommandDenied_Scope}
+	}
+	rule := router.GetCommandPolicy().GetRouteRule(routeId, peerCtx)
+	if rule != nil && !rule.AllowsCommand(command) {
+		return &CommandDeniedError{Command: command, Reason: CommandDenied_Policy, Rule: rule.Name}
+	}
+	return nil
+}
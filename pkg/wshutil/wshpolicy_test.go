@@ -0,0 +1,216 @@
+package wshutil
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestParseCommandPolicy_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy string
+		errStr string
+	}{
+		{"not json", `{"rules": [`, "invalid policy json"},
+		{"no rules", `{"rules": []}`, "no rules"},
+		{"bad route glob", `{"rules": [{"routes": ["[abc"]}]}`, "invalid route pattern"},
+		{"bad auth", `{"rules": [{"auth": "password"}]}`, "invalid auth"},
+		{"unknown allow entry", `{"rules": [{"allow": ["notacommand"]}]}`, "invalid scope entry"},
+		{"unknown deny entry", `{"rules": [{"deny": ["alsonotacommand"]}]}`, "invalid scope entry"},
+		{"bare star prefix", `{"rules": [{"allow": ["**"]}]}`, "invalid scope entry"},
+		{"default with routes", `{"default": {"routes": ["*"]}}`, "default rule cannot"},
+		{"default with auth", `{"default": {"auth": "jwt"}}`, "default rule cannot"},
+		{"bad default entry", `{"default": {"deny": ["nope"]}}`, "default rule"},
+		{"too many rules", `{"rules": [` + strings.Repeat(`{},`, MaxPolicyRules) + `{}]}`, "too many policy rules"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ParseCommandPolicy([]byte(tc.policy))
+			if err == nil {
+				t.Fatalf("expected policy %s to be rejected", tc.policy)
+			}
+			if !strings.Contains(err.Error(), tc.errStr) {
+				t.Fatalf("expected an error containing %q, got %v", tc.errStr, err)
+			}
+		})
+	}
+}
+
+func TestParseCommandPolicy_Names(t *testing.T) {
+	policy, err := ParseCommandPolicy([]byte(`{"rules": [{"name": "first"}, {}], "default": {"allow": ["read-only"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.Rules[0].Name != "first" || policy.Rules[1].Name != "#2" || policy.Default.Name != "default" {
+		t.Fatalf("unexpected rule names %q, %q, %q", policy.Rules[0].Name, policy.Rules[1].Name, policy.Default.Name)
+	}
+}
+
+func TestCommandPolicyRule_AllowsCommand(t *testing.T) {
+	tests := []struct {
+		name     string
+		rule     CommandPolicyRule
+		command  string
+		expected bool
+	}{
+		{"empty allow allows everything", CommandPolicyRule{}, wshrpc.Command_RemoteMkdir, true},
+		{"allowed command", CommandPolicyRule{Allow: []string{wshrpc.Command_RemoteFileInfo}}, wshrpc.Command_RemoteFileInfo, true},
+		{"command not allowed", CommandPolicyRule{Allow: []string{wshrpc.Command_RemoteFileInfo}}, wshrpc.Command_RemoteMkdir, false},
+		{"deny wins over allow", CommandPolicyRule{Allow: []string{"*"}, Deny: []string{wshrpc.Command_Exec}}, wshrpc.Command_Exec, false},
+		{"deny wins over the same command", CommandPolicyRule{Allow: []string{wshrpc.Command_Exec}, Deny: []string{wshrpc.Command_Exec}}, wshrpc.Command_Exec, false},
+		{"deny leaves the rest allowed", CommandPolicyRule{Allow: []string{"*"}, Deny: []string{wshrpc.Command_Exec}}, wshrpc.Command_RemoteMkdir, true},
+		{"deny without allow", CommandPolicyRule{Deny: []string{ScopePreset_Exec}}, wshrpc.Command_KillExec, false},
+		{"preset in allow", CommandPolicyRule{Allow: []string{ScopePreset_FileAccess}}, wshrpc.Command_RemoteFileRename, true},
+		{"preset in allow, command outside it", CommandPolicyRule{Allow: []string{ScopePreset_FileAccess}}, wshrpc.Command_Exec, false},
+		{"preset in deny", CommandPolicyRule{Allow: []string{"*"}, Deny: []string{ScopePreset_FileAccess}}, wshrpc.Command_RemoteWriteFile, false},
+		{"prefix allow", CommandPolicyRule{Allow: []string{"remotefile*"}}, wshrpc.Command_RemoteFileTouch, true},
+		{"prefix allow, other prefix", CommandPolicyRule{Allow: []string{"remotefile*"}}, wshrpc.Command_RemoteMkdir, false},
+		{"prefix deny", CommandPolicyRule{Allow: []string{"*"}, Deny: []string{"remotefile*"}}, wshrpc.Command_RemoteFileDelete, false},
+		{"protocol commands always allowed", CommandPolicyRule{Deny: []string{"*"}}, wshrpc.Command_Authenticate, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := tc.rule.AllowsCommand(tc.command); got != tc.expected {
+				t.Fatalf("AllowsCommand(%q) = %v, expected %v", tc.command, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestCommandPolicy_GetRouteRule(t *testing.T) {
+	policy, err := ParseCommandPolicy([]byte(`{"rules": [
+		{"name": "static", "auth": "static", "allow": ["read-only"]},
+		{"name": "preview", "blocktypes": ["preview"], "allow": ["file-access"]},
+		{"name": "tools", "routes": ["proxy:tool*"], "deny": ["exec"]}
+	], "default": {"allow": ["read-only"]}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		routeId  string
+		rpcCtx   *wshrpc.RpcContext
+		expected string
+	}{
+		{staticSecretRoutePrefix + "1", nil, "static"},
+		{"proxy:x", &wshrpc.RpcContext{BlockType: "preview"}, "preview"},
+		{"proxy:tool1", &wshrpc.RpcContext{BlockType: "term"}, "tools"},
+		{"proxy:other", nil, "default"},
+	}
+	for _, tc := range tests {
+		rule := policy.GetRouteRule(tc.routeId, tc.rpcCtx)
+		if rule == nil || rule.Name != tc.expected {
+			t.Errorf("route %q: expected rule %q, got %v", tc.routeId, tc.expected, rule)
+		}
+	}
+	var nilPolicy *CommandPolicy
+	if nilPolicy.GetRouteRule("proxy:x", nil) != nil {
+		t.Errorf("expected no rule without a policy")
+	}
+}
+
+func TestCheckRouteCommand_ProxiedAndDirect(t *testing.T) {
+	router := NewWshRouter()
+	policy, err := ParseCommandPolicy([]byte(`{"rules": [{"name": "noexec", "deny": ["exec"]}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	router.SetCommandPolicy(policy)
+	scoped := MakeRpcProxy()
+	scoped.PeerRpcContext = &wshrpc.RpcContext{Scope: []string{ScopePreset_ReadOnly, wshrpc.Command_Exec}}
+	router.RegisterRoute("proxy:scoped", scoped, false)
+	unscoped := MakeRpcProxy()
+	router.RegisterRoute("proxy:unscoped", unscoped, false)
+	direct := MakeWshRpc(nil, make(chan []byte, 1), wshrpc.RpcContext{}, nil)
+	router.RegisterRoute("direct", direct, false)
+
+	checkDenied := func(routeId string, command string, reason string) {
+		t.Helper()
+		err := router.CheckRouteCommand(routeId, command)
+		var deniedErr *CommandDeniedError
+		if !errors.As(err, &deniedErr) {
+			t.Fatalf("%s on %s: expected a CommandDeniedError, got %v", command, routeId, err)
+		}
+		if deniedErr.Reason != reason {
+			t.Fatalf("%s on %s: expected reason %q, got %q", command, routeId, reason, deniedErr.Reason)
+		}
+	}
+	checkAllowed := func(routeId string, command string) {
+		t.Helper()
+		if err := router.CheckRouteCommand(routeId, command); err != nil {
+			t.Fatalf("%s on %s: expected it to be allowed, got %v", command, routeId, err)
+		}
+	}
+	// a proxied route gets its token scope and the policy
+	checkAllowed("proxy:scoped", wshrpc.Command_RemoteFileInfo)
+	checkDenied("proxy:scoped", wshrpc.Command_RemoteMkdir, CommandDenied_Scope)
+	checkDenied("proxy:scoped", wshrpc.Command_Exec, CommandDenied_Policy)
+	checkAllowed("proxy:scoped", wshrpc.Command_Authenticate)
+	// no scope is no scope restriction, the policy still applies
+	checkAllowed("proxy:unscoped", wshrpc.Command_RemoteMkdir)
+	checkDenied("proxy:unscoped", wshrpc.Command_Exec, CommandDenied_Policy)
+	// direct (local) routes and unknown routes are never restricted
+	checkAllowed("direct", wshrpc.Command_Exec)
+	checkAllowed("unknown", wshrpc.Command_Exec)
+	if rule := router.GetRoutePolicyRule("direct"); rule != nil {
+		t.Errorf("expected no policy rule for a direct route, got %q", rule.Name)
+	}
+	if rule := router.GetRoutePolicyRule("proxy:scoped"); rule == nil || rule.Name != "noexec" {
+		t.Errorf("expected the noexec rule for the proxied route, got %v", rule)
+	}
+	var deniedErr *CommandDeniedError
+	if errors.As(router.CheckRouteCommand("proxy:unscoped", wshrpc.Command_Exec), &deniedErr) && !strings.Contains(deniedErr.Error(), "rule noexec") {
+		t.Errorf("expected the error to name the rule, got %q", deniedErr.Error())
+	}
+}
+
+// static secret clients have no token scope, a policy that doesn't cover them must not allow them everything
+func TestCheckRouteCommand_StaticSecretRoutes(t *testing.T) {
+	verifier := &StaticSecretAuthVerifier{Secret: "secret", UpstreamAuthToken: "upstream-token"}
+	router := NewWshRouter()
+	peerCtx, authRtn, err := verifier.VerifyAuth(router, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(peerCtx.Scope) != 0 {
+		t.Fatalf("expected no token scope for a static secret client, got %v", peerCtx.Scope)
+	}
+	proxy := MakeRpcProxy()
+	proxy.PeerRpcContext = peerCtx
+	routeId := authRtn.RouteId
+	router.RegisterRoute(routeId, proxy, false)
+	tests := []struct {
+		name     string
+		policy   string // "" for no policy
+		command  string
+		expected bool
+	}{
+		{"no policy", "", wshrpc.Command_Exec, true},
+		{"jwt-only rule", `{"rules": [{"auth": "jwt", "allow": ["read-only"]}]}`, wshrpc.Command_RemoteFileInfo, false},
+		{"jwt-only rule, protocol command", `{"rules": [{"auth": "jwt", "allow": ["read-only"]}]}`, wshrpc.Command_Authenticate, true},
+		{"static rule allows", `{"rules": [{"auth": "static", "allow": ["read-only"]}]}`, wshrpc.Command_RemoteFileInfo, true},
+		{"static rule refuses", `{"rules": [{"auth": "static", "allow": ["read-only"]}]}`, wshrpc.Command_RemoteMkdir, false},
+		{"default allows", `{"rules": [], "default": {"allow": ["read-only"]}}`, wshrpc.Command_RemoteFileInfo, true},
+		{"default refuses", `{"rules": [], "default": {"allow": ["read-only"]}}`, wshrpc.Command_Exec, false},
+	}
+	for _, tc := range tests {
+		var policy *CommandPolicy
+		if tc.policy != "" {
+			policy, err = ParseCommandPolicy([]byte(tc.policy))
+			if err != nil {
+				t.Fatalf("%s: %v", tc.name, err)
+			}
+		}
+		router.SetCommandPolicy(policy)
+		err := router.CheckRouteCommand(routeId, tc.command)
+		if tc.expected && err != nil {
+			t.Errorf("%s: expected %s to be allowed, got %v", tc.name, tc.command, err)
+		}
+		var deniedErr *CommandDeniedError
+		if !tc.expected && (!errors.As(err, &deniedErr) || deniedErr.Reason != CommandDenied_Policy) {
+			t.Errorf("%s: expected %s to be refused by the policy, got %v", tc.name, tc.command, err)
+		}
+	}
+}
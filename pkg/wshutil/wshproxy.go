@@ -7,17 +7,30 @@ import (
 	"encoding/json"
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 )
 
 type WshRpcProxy struct {
-	Lock         *sync.Mutex
-	RpcContext   *wshrpc.RpcContext
-	ToRemoteCh   chan []byte
-	FromRemoteCh chan []byte
-	AuthToken    string
+	Lock           *sync.Mutex
+	RpcContext     *wshrpc.RpcContext
+	PeerRpcContext *wshrpc.RpcContext // claims from the jwt the client authenticated with (set by HandleClientProxyAuth, verified upstream)
+	ToRemoteCh     chan []byte
+	FromRemoteCh   chan []byte
+	AuthToken      string
+	CloseFn        func()        // optional, closes the underlying connection (see SetCloseFn)
+	InstanceId     string        // client instance id presented in the authenticate packet (optional)
+	Deadman        time.Duration // negotiated keepalive deadline (0 for none), see wshdeadman.go
+	budget         *BufferBudget
+	shed           atomic.Bool
+	writing        atomic.Bool // a message taken off ToRemoteCh is being written (see AdaptProxyOutputToStream)
+	disposed       atomic.Bool // see MarkDisposed
+	requireJwt     bool        // see SetRequireJwt
+	upstreamJwt    string      // the jwt the client authenticated with upstream (for ReauthUpstream), empty for static secret clients
+	pause          *proxyPause // set while paused (see Pause, wshpause.go)
 }
 
 func MakeRpcProxy() *WshRpcProxy {
@@ -40,12 +53,75 @@ func (p *WshRpcProxy) GetRpcContext() *wshrpc.RpcContext {
 	return p.RpcContext
 }
 
+func (p *WshRpcProxy) SetCloseFn(closeFn func()) {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	p.CloseFn = closeFn
+}
+
+// closes the underlying connection (the client has to reconnect), false if the proxy has no CloseFn
+func (p *WshRpcProxy) CloseConn() bool {
+	p.Lock.Lock()
+	closeFn := p.CloseFn
+	p.Lock.Unlock()
+	if closeFn == nil {
+		return false
+	}
+	closeFn()
+	// a paused writer would never see the closed connection
+	p.Resume()
+	return true
+}
+
+// for transports without filesystem protection (tcp): the first command must be an authenticate with a
+// valid jwt, anything else (including the router's shared secret) fails the handshake
+func (p *WshRpcProxy) SetRequireJwt(requireJwt bool) {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	p.requireJwt = requireJwt
+}
+
+func (p *WshRpcProxy) HasCloseFn() bool {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.CloseFn != nil
+}
+
+// true the first time it is called, so the owner disposes of the proxy's route only once
+func (p *WshRpcProxy) MarkDisposed() bool {
+	return !p.disposed.Swap(true)
+}
+
+func (p *WshRpcProxy) GetUpstreamJwt() string {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.upstreamJwt
+}
+
+func (p *WshRpcProxy) GetPeerRpcContext() *wshrpc.RpcContext {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.PeerRpcContext
+}
+
 func (p *WshRpcProxy) SetAuthToken(authToken string) {
 	p.Lock.Lock()
 	defer p.Lock.Unlock()
 	p.AuthToken = authToken
 }
 
+func (p *WshRpcProxy) GetInstanceId() string {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.InstanceId
+}
+
+func (p *WshRpcProxy) GetDeadman() time.Duration {
+	p.Lock.Lock()
+	defer p.Lock.Unlock()
+	return p.Deadman
+}
+
 func (p *WshRpcProxy) GetAuthToken() string {
 	p.Lock.Lock()
 	defer p.Lock.Unlock()
@@ -66,7 +142,7 @@ func (p *WshRpcProxy) sendResponseError(msg RpcMessage, sendErr error) {
 	p.SendRpcMessage(respBytes)
 }
 
-func (p *WshRpcProxy) sendAuthenticateResponse(msg RpcMessage, routeId string) {
+func (p *WshRpcProxy) sendAuthenticateResponse(msg RpcMessage, routeId string, deadman time.Duration) {
 	if msg.ReqId == "" {
 		// no response needed
 		return
@@ -74,7 +150,7 @@ func (p *WshRpcProxy) sendAuthenticateResponse(msg RpcMessage, routeId string) {
 	resp := RpcMessage{
 		ResId: msg.ReqId,
 		Route: msg.Source,
-		Data:  wshrpc.CommandAuthenticateRtnData{RouteId: routeId},
+		Data:  wshrpc.CommandAuthenticateRtnData{RouteId: routeId, DeadmanMs: deadman.Milliseconds()},
 	}
 	respBytes, _ := json.Marshal(resp)
 	p.SendRpcMessage(respBytes)
@@ -111,9 +187,30 @@ func handleAuthenticationCommand(msg RpcMessage) (*wshrpc.RpcContext, string, er
 }
 
 // runs on the client (stdio client)
-func (p *WshRpcProxy) HandleClientProxyAuth(router *WshRouter) (string, error) {
+// the connecting client must send an "authenticate" command carrying its jwt token (there is no environment
+// to carry the token for network transports).  timeout bounds the whole handshake (0 means no timeout).
+func (p *WshRpcProxy) HandleClientProxyAuth(router *WshRouter, timeout time.Duration) (string, error) {
+	p.Lock.Lock()
+	requireJwt := p.requireJwt
+	p.Lock.Unlock()
+	var verifier AuthVerifier = JwtAuthVerifier{}
+	if !requireJwt {
+		verifier = router.GetAuthVerifier()
+	}
+	var timeoutCh <-chan time.Time
+	if timeout > 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		timeoutCh = timer.C
+	}
 	for {
-		msgBytes, ok := <-p.FromRemoteCh
+		var msgBytes []byte
+		var ok bool
+		select {
+		case msgBytes, ok = <-p.FromRemoteCh:
+		case <-timeoutCh:
+			return "", fmt.Errorf("timeout waiting for authentication (%v)", timeout)
+		}
 		if !ok {
 			return "", fmt.Errorf("remote closed, not authenticated")
 		}
@@ -131,15 +228,53 @@ func (p *WshRpcProxy) HandleClientProxyAuth(router *WshRouter) (string, error) {
 		if origMsg.Command != wshrpc.Command_Authenticate {
 			respErr := fmt.Errorf("connection not authenticated")
 			p.sendResponseError(origMsg, respErr)
+			if requireJwt {
+				return "", respErr
+			}
 			continue
 		}
-		authRtn, err := router.HandleProxyAuth(origMsg.Data)
+		credential, ok := origMsg.Data.(string)
+		if !ok || credential == "" {
+			respErr := fmt.Errorf("no credential in authenticate message")
+			p.sendResponseError(origMsg, respErr)
+			return "", respErr
+		}
+		peerCtx, authRtn, err := verifier.VerifyAuth(router, credential)
 		if err != nil {
-			respErr := fmt.Errorf("error handling proxy auth: %w", err)
+			p.sendResponseError(origMsg, err)
+			return "", err
+		}
+		qosClass, ok := wshrpc.NormalizeQosClass(peerCtx.QosClass)
+		if !ok {
+			respErr := fmt.Errorf("invalid qos class %q (valid classes: high, normal, low)", peerCtx.QosClass)
+			p.sendResponseError(origMsg, respErr)
+			return "", respErr
+		}
+		peerCtx.QosClass = qosClass
+		if err := ValidateInstanceId(origMsg.InstanceId); err != nil {
+			p.sendResponseError(origMsg, err)
+			return "", err
+		}
+		deadman, err := NegotiateDeadman(time.Duration(origMsg.Deadman)*time.Millisecond, router.GetDeadmanPolicy())
+		if err != nil {
+			p.sendResponseError(origMsg, err)
+			return "", err
+		}
+		if router.GetRpc(authRtn.RouteId) != nil {
+			// reject before announcing, the existing connection keeps the route
+			respErr := fmt.Errorf("%w: %q (duplicate connection)", ErrRouteExists, authRtn.RouteId)
 			p.sendResponseError(origMsg, respErr)
 			return "", respErr
 		}
 		p.SetAuthToken(authRtn.AuthToken)
+		p.Lock.Lock()
+		if !IsStaticSecretRouteId(authRtn.RouteId) {
+			p.upstreamJwt = credential
+		}
+		p.PeerRpcContext = peerCtx
+		p.InstanceId = origMsg.InstanceId
+		p.Deadman = deadman
+		p.Lock.Unlock()
 		announceMsg := RpcMessage{
 			Command:   wshrpc.Command_RouteAnnounce,
 			Source:    authRtn.RouteId,
@@ -147,7 +282,7 @@ func (p *WshRpcProxy) HandleClientProxyAuth(router *WshRouter) (string, error) {
 		}
 		announceBytes, _ := json.Marshal(announceMsg)
 		router.InjectMessage(announceBytes, authRtn.RouteId)
-		p.sendAuthenticateResponse(origMsg, authRtn.RouteId)
+		p.sendAuthenticateResponse(origMsg, authRtn.RouteId, deadman)
 		return authRtn.RouteId, nil
 	}
 }
@@ -180,12 +315,19 @@ func (p *WshRpcProxy) HandleAuthentication() (*wshrpc.RpcContext, error) {
 			p.sendResponseError(msg, err)
 			continue
 		}
-		p.sendAuthenticateResponse(msg, routeId)
+		p.sendAuthenticateResponse(msg, routeId, 0)
 		return newCtx, nil
 	}
 }
 
 func (p *WshRpcProxy) SendRpcMessage(msg []byte) {
+	p.reserveBuffered(len(msg))
+	if pause := p.getPause(); pause != nil {
+		if !p.sendPaused(msg, pause) {
+			p.releaseBuffered(len(msg))
+		}
+		return
+	}
 	p.ToRemoteCh <- msg
 }
 
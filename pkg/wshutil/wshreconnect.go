@@ -0,0 +1,201 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+	"github.com/wavetermdev/waveterm/pkg/util/namedpipe"
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const (
+	ReconnectEvent_Connected    = "connected"
+	ReconnectEvent_Disconnected = "disconnected"
+	ReconnectEvent_Reconnecting = "reconnecting"
+	ReconnectEvent_GaveUp       = "gaveup"
+)
+
+const DefaultReconnectInitialBackoff = 100 * time.Millisecond
+const DefaultReconnectMaxBackoff = 10 * time.Second
+const PipeDialTimeout = 5 * time.Second // how long to wait while every pipe instance is busy
+
+type DialFnType = func() (net.Conn, error)
+
+type ReconnectEvent struct {
+	Type    string
+	Attempt int           // number of failed attempts since the last successful connection
+	Delay   time.Duration // for "reconnecting", the backoff delay before the next attempt
+	Err     error
+}
+
+type ReconnectOpts struct {
+	InitialBackoff time.Duration // defaults to DefaultReconnectInitialBackoff
+	MaxBackoff     time.Duration // defaults to DefaultReconnectMaxBackoff
+	MaxAttempts    int           // consecutive failed dials before giving up (0 = retry forever)
+	OnEvent        func(ReconnectEvent)
+	InstanceId     string // sent with every authenticate so the server can correlate reconnects (defaults to a random uuid)
+}
+
+func (opts *ReconnectOpts) fireEvent(event ReconnectEvent) {
+	if opts.OnEvent == nil {
+		return
+	}
+	defer panichandler.PanicHandler("ReconnectOpts:OnEvent")
+	opts.OnEvent(event)
+}
+
+func (opts *ReconnectOpts) nextBackoff(backoff time.Duration) time.Duration {
+	if backoff <= 0 {
+		return opts.InitialBackoff
+	}
+	backoff *= 2
+	if backoff > opts.MaxBackoff {
+		backoff = opts.MaxBackoff
+	}
+	return backoff
+}
+
+// dials a wave domain socket (tries tcp first, for wsl), or a named pipe (a connserver on windows)
+func MakeDomainSocketDialer(sockName string) DialFnType {
+	return func() (net.Conn, error) {
+		if namedpipe.IsPipePath(sockName) {
+			return namedpipe.Dial(sockName, PipeDialTimeout)
+		}
+		conn, tcpErr := tryTcpSocket(sockName)
+		if tcpErr == nil {
+			return conn, nil
+		}
+		conn, unixErr := net.Dial("unix", sockName)
+		if unixErr != nil {
+			return nil, fmt.Errorf("failed to connect to tcp or unix domain socket: tcp err:%w: unix socket err: %w", tcpErr, unixErr)
+		}
+		return conn, nil
+	}
+}
+
+func writeAuthPacket(conn net.Conn, jwtToken string, instanceId string) error {
+	authMsg := RpcMessage{Command: wshrpc.Command_Authenticate, Data: jwtToken, InstanceId: instanceId}
+	barr, err := json.Marshal(authMsg)
+	if err != nil {
+		return err
+	}
+	barr = append(barr, '\n')
+	_, err = conn.Write(barr)
+	return err
+}
+
+// pumps outputCh to conn until the conn fails or doneCh is closed
+func pumpOutputChToConn(outputCh chan []byte, conn net.Conn, doneCh chan struct{}) {
+	for {
+		select {
+		case <-doneCh:
+			return
+		case msg, ok := <-outputCh:
+			if !ok {
+				conn.Close()
+				return
+			}
+			msg = append(msg, '\n')
+			if _, err := conn.Write(msg); err != nil {
+				// the message is lost, the rpc layer will time out the request
+				log.Printf("error writing to reconnecting conn: %v\n", err)
+				conn.Close()
+				return
+			}
+		}
+	}
+}
+
+// after giving up nothing writes OutputCh to a conn, so it is drained here forever (inputCh stays open, so
+// runServer never closes it and late senders cannot panic).  a request that raced closeRpc is failed
+// with the close error instead of waiting for its timeout
+func drainClosedOutputCh(w *WshRpc) {
+	closedErr := w.getClosedErr()
+	for msgBytes := range w.OutputCh {
+		var msg RpcMessage
+		if err := json.Unmarshal(msgBytes, &msg); err != nil {
+			continue
+		}
+		if msg.IsRpcRequest() && msg.ReqId != "" {
+			w.unregisterRpc(msg.ReqId, closedErr)
+		}
+	}
+}
+
+// creates a WshRpc that survives connection drops.  each time the connection drops we redial with exponential
+// backoff, and re-send the authenticate packet (jwtToken) as the first packet on the new connection so the
+// server re-registers our route.  requests in flight when the connection drops will time out normally.
+// once MaxAttempts dials in a row fail the rpc is closed: pending and later requests fail right away.
+func SetupReconnectingRpcClient(dialFn DialFnType, jwtToken string, serverImpl ServerImpl, opts *ReconnectOpts) (*WshRpc, error) {
+	var optsCopy ReconnectOpts
+	if opts != nil {
+		optsCopy = *opts
+	}
+	if optsCopy.InitialBackoff <= 0 {
+		optsCopy.InitialBackoff = DefaultReconnectInitialBackoff
+	}
+	if optsCopy.MaxBackoff < optsCopy.InitialBackoff {
+		optsCopy.MaxBackoff = DefaultReconnectMaxBackoff
+	}
+	if optsCopy.InstanceId == "" {
+		optsCopy.InstanceId = uuid.New().String()
+	}
+	if err := ValidateInstanceId(optsCopy.InstanceId); err != nil {
+		return nil, err
+	}
+	conn, err := dialFn()
+	if err != nil {
+		return nil, err
+	}
+	inputCh := make(chan []byte, DefaultInputChSize)
+	outputCh := make(chan []byte, DefaultOutputChSize)
+	rtn := MakeWshRpc(inputCh, outputCh, wshrpc.RpcContext{}, serverImpl)
+	go func() {
+		defer panichandler.PanicHandler("SetupReconnectingRpcClient:loop")
+		for {
+			authErr := writeAuthPacket(conn, jwtToken, optsCopy.InstanceId)
+			if authErr == nil {
+				optsCopy.fireEvent(ReconnectEvent{Type: ReconnectEvent_Connected})
+				doneCh := make(chan struct{})
+				go func(conn net.Conn) {
+					defer panichandler.PanicHandler("SetupReconnectingRpcClient:output")
+					pumpOutputChToConn(outputCh, conn, doneCh)
+				}(conn) // conn is redialed below while this pump may still be exiting
+				readErr := AdaptStreamToMsgCh(conn, inputCh)
+				close(doneCh)
+				conn.Close()
+				optsCopy.fireEvent(ReconnectEvent{Type: ReconnectEvent_Disconnected, Err: readErr})
+			} else {
+				conn.Close()
+				optsCopy.fireEvent(ReconnectEvent{Type: ReconnectEvent_Disconnected, Err: authErr})
+			}
+			var backoff time.Duration
+			var attempt int
+			for {
+				backoff = optsCopy.nextBackoff(backoff)
+				optsCopy.fireEvent(ReconnectEvent{Type: ReconnectEvent_Reconnecting, Attempt: attempt, Delay: backoff})
+				time.Sleep(backoff)
+				conn, err = dialFn()
+				if err == nil {
+					break
+				}
+				attempt++
+				if optsCopy.MaxAttempts > 0 && attempt >= optsCopy.MaxAttempts {
+					rtn.closeRpc(fmt.Errorf("connection lost, gave up reconnecting after %d attempts: %w", attempt, err))
+					optsCopy.fireEvent(ReconnectEvent{Type: ReconnectEvent_GaveUp, Attempt: attempt, Err: err})
+					drainClosedOutputCh(rtn)
+					return
+				}
+			}
+		}
+	}()
+	return rtn, nil
+}
@@ -0,0 +1,153 @@
+package wshutil
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// hands out the queued server-side conns' peers, fails once they run out
+type testDialer struct {
+	lock  sync.Mutex
+	conns []net.Conn
+}
+
+func (d *testDialer) addConn() net.Conn {
+	clientConn, serverConn := net.Pipe()
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.conns = append(d.conns, clientConn)
+	return serverConn
+}
+
+func (d *testDialer) dial() (net.Conn, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if len(d.conns) == 0 {
+		return nil, errors.New("connection refused")
+	}
+	conn := d.conns[0]
+	d.conns = d.conns[1:]
+	return conn, nil
+}
+
+func readTestMsg(t *testing.T, reader *bufio.Reader) RpcMessage {
+	t.Helper()
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatalf("reading message: %v", err)
+	}
+	var msg RpcMessage
+	if err := json.Unmarshal(line, &msg); err != nil {
+		t.Fatalf("bad message %q: %v", line, err)
+	}
+	return msg
+}
+
+func waitForEvent(t *testing.T, eventCh chan ReconnectEvent, eventType string) ReconnectEvent {
+	t.Helper()
+	timeoutCh := time.After(5 * time.Second)
+	for {
+		select {
+		case event := <-eventCh:
+			if event.Type == eventType {
+				return event
+			}
+		case <-timeoutCh:
+			t.Fatalf("timed out waiting for %q event", eventType)
+		}
+	}
+}
+
+func makeTestReconnectOpts(maxAttempts int) (*ReconnectOpts, chan ReconnectEvent) {
+	eventCh := make(chan ReconnectEvent, 100)
+	opts := &ReconnectOpts{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		MaxAttempts:    maxAttempts,
+		InstanceId:     "test-instance",
+		OnEvent:        func(event ReconnectEvent) { eventCh <- event },
+	}
+	return opts, eventCh
+}
+
+func TestSetupReconnectingRpcClient_ReauthenticatesAfterDrop(t *testing.T) {
+	dialer := &testDialer{}
+	firstConn := dialer.addConn()
+	opts, eventCh := makeTestReconnectOpts(0)
+	_, err := SetupReconnectingRpcClient(dialer.dial, "jwt-token", nil, opts)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	authMsg := readTestMsg(t, bufio.NewReader(firstConn))
+	if authMsg.Command != wshrpc.Command_Authenticate || authMsg.Data != "jwt-token" || authMsg.InstanceId != "test-instance" {
+		t.Fatalf("first packet = %+v, want the authenticate packet", authMsg)
+	}
+	waitForEvent(t, eventCh, ReconnectEvent_Connected)
+	secondConn := dialer.addConn()
+	firstConn.Close()
+	waitForEvent(t, eventCh, ReconnectEvent_Disconnected)
+	authMsg = readTestMsg(t, bufio.NewReader(secondConn))
+	if authMsg.Command != wshrpc.Command_Authenticate || authMsg.InstanceId != "test-instance" {
+		t.Fatalf("first packet after reconnect = %+v, want the authenticate packet", authMsg)
+	}
+	waitForEvent(t, eventCh, ReconnectEvent_Connected)
+	secondConn.Close()
+}
+
+func TestSetupReconnectingRpcClient_GaveUpFailsRequests(t *testing.T) {
+	dialer := &testDialer{}
+	serverConn := dialer.addConn()
+	opts, eventCh := makeTestReconnectOpts(2)
+	rpc, err := SetupReconnectingRpcClient(dialer.dial, "jwt-token", nil, opts)
+	if err != nil {
+		t.Fatalf("setup: %v", err)
+	}
+	reader := bufio.NewReader(serverConn)
+	readTestMsg(t, reader)
+	pendingErrCh := make(chan error, 1)
+	go func() {
+		_, err := rpc.SendRpcRequest("test", nil, &wshrpc.RpcOpts{Timeout: 30000})
+		pendingErrCh <- err
+	}()
+	if msg := readTestMsg(t, reader); msg.Command != "test" {
+		t.Fatalf("got %q, want the pending request", msg.Command)
+	}
+	serverConn.Close()
+	waitForEvent(t, eventCh, ReconnectEvent_GaveUp)
+	select {
+	case err := <-pendingErrCh:
+		if err == nil || !strings.Contains(err.Error(), "gave up reconnecting") {
+			t.Fatalf("pending request err = %v, want the give-up error", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("pending request was not failed after giving up")
+	}
+	// more than the output buffer, none of these may block (or panic on a closed OutputCh)
+	doneCh := make(chan struct{})
+	go func() {
+		defer close(doneCh)
+		for i := 0; i < DefaultOutputChSize+10; i++ {
+			if _, err := rpc.SendRpcRequest("test", nil, nil); err == nil {
+				t.Errorf("request %d after giving up succeeded", i)
+				return
+			}
+			if err := rpc.SendCommand("test", nil, nil); err == nil {
+				t.Errorf("command %d after giving up succeeded", i)
+				return
+			}
+		}
+	}()
+	select {
+	case <-doneCh:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("sends after giving up blocked")
+	}
+}
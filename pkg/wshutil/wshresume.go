@@ -0,0 +1,124 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// routes whose messages carry an upstream auth token (WshRpc and WshRpcProxy)
+type authTokenHolder interface {
+	GetAuthToken() string
+	SetAuthToken(token string)
+}
+
+type UpstreamReauthResult struct {
+	TokenMap map[string]string // old auth token => new auth token
+	Failed   []string          // routes that could not authenticate again (sorted), their clients have to reconnect
+}
+
+type reauthRoute struct {
+	routeId  string
+	rpc      authTokenHolder
+	oldToken string
+	jwt      string
+}
+
+// after the upstream connection was replaced (connserver --resume-grace) every route has to authenticate
+// again, the new upstream doesn't know the old auth tokens.  a route authenticates with the jwt its client
+// first presented (creds overrides it per route, e.g. a fresh jwt for the router's own route), a route
+// sharing another route's token (static secret clients) follows that route.  the upstream registers each
+// route as it authenticates, so nothing has to be re-announced.  fails only if a route in creds fails
+func (router *WshRouter) ReauthUpstream(creds map[string]string) (*UpstreamReauthResult, error) {
+	var routes []reauthRoute
+	router.Lock.Lock()
+	for routeId, rpc := range router.RouteMap {
+		holder, ok := rpc.(authTokenHolder)
+		if !ok {
+			continue
+		}
+		route := reauthRoute{routeId: routeId, rpc: holder, oldToken: holder.GetAuthToken(), jwt: creds[routeId]}
+		if route.oldToken == "" {
+			continue
+		}
+		if proxy, ok := rpc.(*WshRpcProxy); ok && route.jwt == "" {
+			route.jwt = proxy.GetUpstreamJwt()
+		}
+		routes = append(routes, route)
+	}
+	router.Lock.Unlock()
+	rtn := &UpstreamReauthResult{TokenMap: make(map[string]string)}
+	newTokens := make(map[string]string) // routeid => new token
+	for _, route := range routes {
+		if route.jwt == "" {
+			continue
+		}
+		authRtn, err := router.HandleProxyAuth(route.jwt)
+		if err == nil && authRtn.RouteId != route.routeId {
+			err = fmt.Errorf("upstream assigned route %q", authRtn.RouteId)
+		}
+		if err != nil {
+			if creds[route.routeId] != "" {
+				return nil, fmt.Errorf("route %q: %w", route.routeId, err)
+			}
+			log.Printf("[router] route %q cannot authenticate with the new upstream: %v\n", route.routeId, err)
+			rtn.Failed = append(rtn.Failed, route.routeId)
+			continue
+		}
+		rtn.TokenMap[route.oldToken] = authRtn.AuthToken
+		newTokens[route.routeId] = authRtn.AuthToken
+	}
+	for _, route := range routes {
+		newToken, ok := newTokens[route.routeId]
+		if !ok && route.jwt == "" {
+			newToken, ok = rtn.TokenMap[route.oldToken]
+			if !ok {
+				rtn.Failed = append(rtn.Failed, route.routeId)
+			}
+		}
+		if ok {
+			route.rpc.SetAuthToken(newToken)
+		}
+	}
+	if verifier, ok := router.GetAuthVerifier().(*StaticSecretAuthVerifier); ok {
+		if newToken, ok := rtn.TokenMap[verifier.UpstreamAuthToken]; ok {
+			verifierCopy := *verifier
+			verifierCopy.UpstreamAuthToken = newToken
+			router.SetAuthVerifier(&verifierCopy)
+		}
+	}
+	sort.Strings(rtn.Failed)
+	return rtn, nil
+}
+
+// for messages queued before ReauthUpstream, returns msgBytes unchanged if its token wasn't replaced
+func RemapAuthToken(msgBytes []byte, tokenMap map[string]string) []byte {
+	var msg RpcMessage
+	if err := json.Unmarshal(msgBytes, &msg); err != nil {
+		return msgBytes
+	}
+	newToken, ok := tokenMap[msg.AuthToken]
+	if !ok {
+		return msgBytes
+	}
+	msg.AuthToken = newToken
+	newBytes, err := json.Marshal(msg)
+	if err != nil {
+		return msgBytes
+	}
+	return newBytes
+}
+
+// the only messages written to a resumed upstream before ReauthUpstream is done
+func IsAuthenticateMessage(msgBytes []byte) bool {
+	var msg struct {
+		Command string `json:"command"`
+	}
+	return json.Unmarshal(msgBytes, &msg) == nil && msg.Command == wshrpc.Command_Authenticate
+}
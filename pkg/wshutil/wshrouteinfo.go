@@ -0,0 +1,129 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"sort"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const (
+	RouteKind_Proxy    = "proxy"
+	RouteKind_Local    = "local"
+	RouteKind_Upstream = "upstream"
+)
+
+// how a proxy route authenticated
+const (
+	RouteAuth_Jwt    = "jwt"
+	RouteAuth_Static = "static" // the shared secret (StaticSecretAuthVerifier)
+)
+
+func getRouteAuthState(routeId string) string {
+	if IsStaticSecretRouteId(routeId) {
+		return RouteAuth_Static
+	}
+	return RouteAuth_Jwt
+}
+
+// a listener connection was accepted, counted until ConnClosed (authenticated or not)
+func (router *WshRouter) ConnOpened() {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.conns++
+	router.connsTotal++
+}
+
+func (router *WshRouter) ConnClosed() {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.conns--
+}
+
+// the address local wsh clients can reach this router on (a tcp host:port, usable as the jwt sock),
+// reported by GetRegisteredRoutes.  empty for the domain socket
+func (router *WshRouter) SetListenAddr(addr string) {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	router.listenAddr = addr
+}
+
+func (router *WshRouter) GetListenAddr() string {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	return router.listenAddr
+}
+
+// the registered routes and the connection counters, all read under one lock hold so the snapshot is
+// consistent with concurrent registers/unregisters
+func (router *WshRouter) GetRegisteredRoutes() *wshrpc.CommandRouteInfoRtnData {
+	// taken first, the stats lock is never acquired while holding the router lock
+	stats := router.stats.snapshot()
+	routeStats := make(map[string]wshrpc.RouteStatsData)
+	for _, stat := range stats.Routes {
+		routeStats[stat.RouteId] = stat
+	}
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	rtn := &wshrpc.CommandRouteInfoRtnData{
+		Ts:          time.Now().UnixMilli(),
+		Routes:      make([]wshrpc.RegisteredRouteData, 0, len(router.RouteMap)+1),
+		HasUpstream: router.UpstreamClient != nil,
+		Conns:       router.conns,
+		ConnsTotal:  router.connsTotal,
+		ListenAddr:  router.listenAddr,
+	}
+	announced := make(map[string]int)
+	for _, localRouteId := range router.AnnouncedRoutes {
+		announced[localRouteId]++
+	}
+	for routeId, rpc := range router.RouteMap {
+		route := wshrpc.RegisteredRouteData{
+			RouteId:   routeId,
+			Kind:      RouteKind_Local,
+			Announced: announced[routeId],
+		}
+		if regTime, ok := router.routeRegTimes[routeId]; ok {
+			route.RegisteredTs = regTime.UnixMilli()
+		}
+		if stat, ok := routeStats[routeId]; ok {
+			route.MsgsIn = stat.MsgsIn
+			route.MsgsOut = stat.MsgsOut
+			route.Dropped = stat.Dropped
+			route.LastActivityTs = stat.LastActivityTs
+		}
+		if proxy, ok := rpc.(*WshRpcProxy); ok {
+			route.Kind = RouteKind_Proxy
+			route.AuthState = getRouteAuthState(routeId)
+			peerCtx := proxy.GetPeerRpcContext()
+			if peerCtx != nil {
+				route.Scope = peerCtx.Scope
+			}
+			if rule := router.policy.GetRouteRule(routeId, peerCtx); rule != nil {
+				route.PolicyRule = rule.Name
+			}
+			rtn.NumProxy++
+		} else {
+			rtn.NumLocal++
+		}
+		rtn.Routes = append(rtn.Routes, route)
+	}
+	rtn.NumRoutes = len(rtn.Routes)
+	if rtn.HasUpstream {
+		upstream := wshrpc.RegisteredRouteData{RouteId: UpstreamRoute, Kind: RouteKind_Upstream}
+		if stat, ok := routeStats[UpstreamRoute]; ok {
+			upstream.MsgsIn = stat.MsgsIn
+			upstream.MsgsOut = stat.MsgsOut
+			upstream.Dropped = stat.Dropped
+			upstream.LastActivityTs = stat.LastActivityTs
+		}
+		rtn.Routes = append(rtn.Routes, upstream)
+	}
+	sort.Slice(rtn.Routes, func(i, j int) bool {
+		return rtn.Routes[i].RouteId < rtn.Routes[j].RouteId
+	})
+	return rtn
+}
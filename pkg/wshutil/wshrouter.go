@@ -32,6 +32,7 @@ type routeInfo struct {
 	RpcId         string
 	SourceRouteId string
 	DestRouteId   string
+	FromRouteId   string // the local route the request came in on, counted against its in-flight limit ("" for the upstream)
 }
 
 type msgAndRoute struct {
@@ -40,13 +41,31 @@ type msgAndRoute struct {
 }
 
 type WshRouter struct {
-	Lock             *sync.Mutex
-	RouteMap         map[string]AbstractRpcClient // routeid => client
-	UpstreamClient   AbstractRpcClient            // upstream client (if we are not the terminal router)
-	AnnouncedRoutes  map[string]string            // routeid => local routeid
-	RpcMap           map[string]*routeInfo        // rpcid => routeinfo
-	SimpleRequestMap map[string]chan *RpcMessage  // simple reqid => response channel
-	InputCh          chan msgAndRoute
+	Lock               *sync.Mutex
+	RouteMap           map[string]AbstractRpcClient // routeid => client
+	UpstreamClient     AbstractRpcClient            // upstream client (if we are not the terminal router)
+	AnnouncedRoutes    map[string]string            // routeid => local routeid
+	RpcMap             map[string]*routeInfo        // rpcid => routeinfo
+	SimpleRequestMap   map[string]chan *RpcMessage  // simple reqid => response channel
+	InputCh            chan msgAndRoute
+	stats              *routerStats
+	authVerifier       AuthVerifier   // for HandleClientProxyAuth, nil for the default (jwt)
+	inflight           map[string]int // from routeid => outstanding requests (see wshinflight.go)
+	maxInflight        int
+	slowedRoutes       map[string]bool // routes sent a slowdown (see wshflow.go)
+	backpressureHigh   int
+	backpressureLow    int
+	instances          map[string]*clientInstance // instanceid => instance (see wshinstance.go)
+	routeInstances     map[string]string          // routeid => instanceid
+	carryInstanceStats bool
+	deadmen            map[string]*routeDeadman // routeid => keepalive deadline (see wshdeadman.go)
+	deadmanPolicy      time.Duration
+	routeRegTimes      map[string]time.Time // routeid => registration time (see GetRegisteredRoutes)
+	conns              int                  // open listener connections (see ConnOpened)
+	connsTotal         int64
+	listenAddr         string         // advertised wsh client address (see SetListenAddr)
+	traces             routeTraces    // see wshroutetrace.go
+	policy             *CommandPolicy // see wshpolicy.go
 }
 
 func MakeConnectionRouteId(connId string) string {
@@ -78,7 +97,14 @@ func NewWshRouter() *WshRouter {
 		AnnouncedRoutes:  make(map[string]string),
 		RpcMap:           make(map[string]*routeInfo),
 		SimpleRequestMap: make(map[string]chan *RpcMessage),
+		instances:        make(map[string]*clientInstance),
+		routeInstances:   make(map[string]string),
 		InputCh:          make(chan msgAndRoute, DefaultInputChSize),
+		stats:            makeRouterStats(),
+		inflight:         make(map[string]int),
+		slowedRoutes:     make(map[string]bool),
+		deadmen:          make(map[string]*routeDeadman),
+		routeRegTimes:    make(map[string]time.Time),
 	}
 	go rtn.runServer()
 	return rtn
@@ -107,13 +133,30 @@ func (router *WshRouter) SendEvent(routeId string, event wps.WaveEvent) {
 		// nothing to do
 		return
 	}
+	router.stats.recordOut(routeId, len(msgBytes))
 	rpc.SendRpcMessage(msgBytes)
 }
 
+// like SendEvent, but a route that isn't local is reached through the upstream.  returns false if the
+// event could not be sent anywhere
+func (router *WshRouter) SendRoutedEvent(routeId string, event wps.WaveEvent) bool {
+	defer panichandler.PanicHandler("WshRouter.SendRoutedEvent")
+	msg := RpcMessage{
+		Command: wshrpc.Command_EventRecv,
+		Route:   routeId,
+		Data:    event,
+	}
+	msgBytes, err := json.Marshal(msg)
+	if err != nil {
+		return false
+	}
+	return router.sendRoutedMessage(msgBytes, routeId)
+}
+
 func (router *WshRouter) handleNoRoute(msg RpcMessage) {
 	nrErr := noRouteErr(msg.Route)
 	if msg.ReqId == "" {
-		if msg.Command == wshrpc.Command_Message {
+		if msg.Command == wshrpc.Command_Message || msg.Command == wshrpc.Command_Ack || msg.Command == wshrpc.Command_FlowControl {
 			// to prevent infinite loops
 			return
 		}
@@ -132,19 +175,28 @@ func (router *WshRouter) handleNoRoute(msg RpcMessage) {
 	router.sendRoutedMessage(respBytes, msg.Source)
 }
 
-func (router *WshRouter) registerRouteInfo(rpcId string, sourceRouteId string, destRouteId string) {
+func (router *WshRouter) registerRouteInfo(rpcId string, sourceRouteId string, destRouteId string, fromRouteId string) {
 	if rpcId == "" {
 		return
 	}
+	if fromRouteId == UpstreamRoute {
+		fromRouteId = ""
+	}
 	router.Lock.Lock()
-	defer router.Lock.Unlock()
-	router.RpcMap[rpcId] = &routeInfo{RpcId: rpcId, SourceRouteId: sourceRouteId, DestRouteId: destRouteId}
+	router.addRouteInfoLocked(&routeInfo{RpcId: rpcId, SourceRouteId: sourceRouteId, DestRouteId: destRouteId, FromRouteId: fromRouteId})
+	router.Lock.Unlock()
+	router.updateBackpressure(fromRouteId)
 }
 
 func (router *WshRouter) unregisterRouteInfo(rpcId string) {
 	router.Lock.Lock()
-	defer router.Lock.Unlock()
-	delete(router.RpcMap, rpcId)
+	var fromRouteId string
+	if info := router.RpcMap[rpcId]; info != nil {
+		fromRouteId = info.FromRouteId
+	}
+	router.removeRouteInfoLocked(rpcId)
+	router.Lock.Unlock()
+	router.updateBackpressure(fromRouteId)
 }
 
 func (router *WshRouter) getRouteInfo(rpcId string) *routeInfo {
@@ -184,24 +236,32 @@ func (router *WshRouter) getAnnouncedRoute(routeId string) string {
 
 // returns true if message was sent, false if failed
 func (router *WshRouter) sendRoutedMessage(msgBytes []byte, routeId string) bool {
+	return router.routeMessage(msgBytes, routeId) != ""
+}
+
+// returns the local route (or UpstreamRoute) the message was sent to, "" if failed
+func (router *WshRouter) routeMessage(msgBytes []byte, routeId string) string {
 	rpc := router.GetRpc(routeId)
 	if rpc != nil {
+		router.stats.recordOut(routeId, len(msgBytes))
 		rpc.SendRpcMessage(msgBytes)
-		return true
+		return routeId
 	}
 	upstream := router.GetUpstreamClient()
 	if upstream != nil {
+		router.stats.recordOut(UpstreamRoute, len(msgBytes))
 		upstream.SendRpcMessage(msgBytes)
-		return true
+		return UpstreamRoute
 	} else {
 		// we are the upstream, so consult our announced routes map
 		localRouteId := router.getAnnouncedRoute(routeId)
 		rpc := router.GetRpc(localRouteId)
 		if rpc == nil {
-			return false
+			return ""
 		}
+		router.stats.recordOut(localRouteId, len(msgBytes))
 		rpc.SendRpcMessage(msgBytes)
-		return true
+		return localRouteId
 	}
 }
 
@@ -224,13 +284,26 @@ func (router *WshRouter) runServer() {
 			continue
 		}
 		if msg.Command != "" {
+			if !router.checkCommandScope(msg, input.fromRouteId) {
+				router.stats.recordDropped(input.fromRouteId)
+				router.traceMessage(&msg, input.fromRouteId, "", wshrpc.RouteTraceDrop_Scope, len(msgBytes))
+				continue
+			}
+			if !router.checkInflightLimit(msg, input.fromRouteId) {
+				router.stats.recordDropped(input.fromRouteId)
+				router.traceMessage(&msg, input.fromRouteId, "", wshrpc.RouteTraceDrop_Inflight, len(msgBytes))
+				continue
+			}
 			// new comand, setup new rpc
-			ok := router.sendRoutedMessage(msgBytes, routeId)
-			if !ok {
+			toRouteId := router.routeMessage(msgBytes, routeId)
+			if toRouteId == "" {
+				router.stats.recordDropped(input.fromRouteId)
+				router.traceMessage(&msg, input.fromRouteId, "", wshrpc.RouteTraceDrop_NoRoute, len(msgBytes))
 				router.handleNoRoute(msg)
 				continue
 			}
-			router.registerRouteInfo(msg.ReqId, msg.Source, routeId)
+			router.traceMessage(&msg, input.fromRouteId, toRouteId, "", len(msgBytes))
+			router.registerRouteInfo(msg.ReqId, msg.Source, routeId, input.fromRouteId)
 			continue
 		}
 		// look at reqid or resid to route correctly
@@ -238,10 +311,13 @@ func (router *WshRouter) runServer() {
 			routeInfo := router.getRouteInfo(msg.ReqId)
 			if routeInfo == nil {
 				// no route info, nothing to do
+				router.stats.recordDropped(input.fromRouteId)
+				router.traceMessage(&msg, input.fromRouteId, "", wshrpc.RouteTraceDrop_NoRouteInfo, len(msgBytes))
 				continue
 			}
 			// no need to check the return value here (noop if failed)
-			router.sendRoutedMessage(msgBytes, routeInfo.DestRouteId)
+			toRouteId := router.routeMessage(msgBytes, routeInfo.DestRouteId)
+			router.traceMessage(&msg, input.fromRouteId, toRouteId, "", len(msgBytes))
 			continue
 		} else if msg.ResId != "" {
 			ok := router.trySimpleResponse(&msg)
@@ -251,9 +327,12 @@ func (router *WshRouter) runServer() {
 			routeInfo := router.getRouteInfo(msg.ResId)
 			if routeInfo == nil {
 				// no route info, nothing to do
+				router.stats.recordDropped(input.fromRouteId)
+				router.traceMessage(&msg, input.fromRouteId, "", wshrpc.RouteTraceDrop_NoRouteInfo, len(msgBytes))
 				continue
 			}
-			router.sendRoutedMessage(msgBytes, routeInfo.SourceRouteId)
+			toRouteId := router.routeMessage(msgBytes, routeInfo.SourceRouteId)
+			router.traceMessage(&msg, input.fromRouteId, toRouteId, "", len(msgBytes))
 			if !msg.Cont {
 				router.unregisterRouteInfo(msg.ResId)
 			}
@@ -282,21 +361,49 @@ func (router *WshRouter) WaitForRegister(ctx context.Context, routeId string) er
 	}
 }
 
+var ErrRouteExists = errors.New("route already registered")
+
 // this will also consume the output channel of the abstract client
+// duplicate policy: an existing route is replaced (and logged).  this is what reconnecting blocks/controllers
+// rely on.  the old client is orphaned, so callers that accept untrusted connections should use RegisterRouteExclusive.
 func (router *WshRouter) RegisterRoute(routeId string, rpc AbstractRpcClient, shouldAnnounce bool) {
+	router.registerRoute(routeId, rpc, shouldAnnounce, false, nil)
+}
+
+// like RegisterRoute, but fails with ErrRouteExists (leaving the existing route untouched) if the route is already registered
+func (router *WshRouter) RegisterRouteExclusive(routeId string, rpc AbstractRpcClient, shouldAnnounce bool) error {
+	return router.registerRoute(routeId, rpc, shouldAnnounce, true, nil)
+}
+
+// like RegisterRouteExclusive, onRegisterFn runs only if the route is registered, under the router lock and before
+// any message from the route is read (for state that must be in place for the route's first message, but must
+// never be set by a connection that lost the route to another one).  it must not call back into the router
+func (router *WshRouter) RegisterRouteExclusiveFn(routeId string, rpc AbstractRpcClient, shouldAnnounce bool, onRegisterFn func()) error {
+	return router.registerRoute(routeId, rpc, shouldAnnounce, true, onRegisterFn)
+}
+
+func (router *WshRouter) registerRoute(routeId string, rpc AbstractRpcClient, shouldAnnounce bool, exclusive bool, onRegisterFn func()) error {
 	if routeId == SysRoute || routeId == UpstreamRoute {
 		// cannot register sys route
 		log.Printf("error: WshRouter cannot register %s route\n", routeId)
-		return
+		return fmt.Errorf("cannot register reserved route %q", routeId)
 	}
-	log.Printf("[router] registering wsh route %q\n", routeId)
 	router.Lock.Lock()
 	defer router.Lock.Unlock()
 	alreadyExists := router.RouteMap[routeId] != nil
+	if alreadyExists && exclusive {
+		log.Printf("[router] rejecting duplicate registration of wsh route %q\n", routeId)
+		return fmt.Errorf("%w: %q", ErrRouteExists, routeId)
+	}
+	log.Printf("[router] registering wsh route %q\n", routeId)
 	if alreadyExists {
 		log.Printf("[router] warning: route %q already exists (replacing)\n", routeId)
 	}
+	if onRegisterFn != nil {
+		onRegisterFn()
+	}
 	router.RouteMap[routeId] = rpc
+	router.routeRegTimes[routeId] = time.Now()
 	go func() {
 		defer panichandler.PanicHandler("WshRouter:registerRoute:recvloop")
 		// announce
@@ -315,6 +422,17 @@ func (router *WshRouter) RegisterRoute(routeId string, rpc AbstractRpcClient, sh
 			if err != nil {
 				continue
 			}
+			router.stats.recordIn(routeId, len(msgBytes))
+			if router.handleRouteKeepalive(routeId, rpcMsg) {
+				continue
+			}
+			if len(rpcMsg.Headers) > 0 {
+				if err := rpcMsg.checkHeaders(); err != nil {
+					router.stats.recordDropped(routeId)
+					router.sendHeaderError(routeId, rpcMsg, err)
+					continue
+				}
+			}
 			if rpcMsg.Command != "" {
 				if rpcMsg.Source == "" {
 					rpcMsg.Source = routeId
@@ -330,6 +448,7 @@ func (router *WshRouter) RegisterRoute(routeId string, rpc AbstractRpcClient, sh
 			router.InputCh <- msgAndRoute{msgBytes: msgBytes, fromRouteId: routeId}
 		}
 	}()
+	return nil
 }
 
 func (router *WshRouter) UnregisterRoute(routeId string) {
@@ -337,10 +456,16 @@ func (router *WshRouter) UnregisterRoute(routeId string) {
 	router.Lock.Lock()
 	defer router.Lock.Unlock()
 	delete(router.RouteMap, routeId)
+	delete(router.routeRegTimes, routeId)
+	router.releaseInstanceLocked(routeId)
+	router.stats.removeRoute(routeId)
+	router.clearInflightLocked(routeId)
+	delete(router.slowedRoutes, routeId)
+	router.stopRouteDeadmanLocked(routeId)
 	// clear out announced routes
-	for routeId, localRouteId := range router.AnnouncedRoutes {
+	for announcedId, localRouteId := range router.AnnouncedRoutes {
 		if localRouteId == routeId {
-			delete(router.AnnouncedRoutes, routeId)
+			delete(router.AnnouncedRoutes, announcedId)
 		}
 	}
 	go func() {
@@ -357,6 +482,16 @@ func (router *WshRouter) GetRpc(routeId string) AbstractRpcClient {
 	return router.RouteMap[routeId]
 }
 
+func (router *WshRouter) GetLocalRouteIds() []string {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	rtn := make([]string, 0, len(router.RouteMap))
+	for routeId := range router.RouteMap {
+		rtn = append(rtn, routeId)
+	}
+	return rtn
+}
+
 func (router *WshRouter) SetUpstreamClient(rpc AbstractRpcClient) {
 	router.Lock.Lock()
 	defer router.Lock.Unlock()
@@ -370,9 +505,31 @@ func (router *WshRouter) GetUpstreamClient() AbstractRpcClient {
 }
 
 func (router *WshRouter) InjectMessage(msgBytes []byte, fromRouteId string) {
+	router.stats.recordIn(fromRouteId, len(msgBytes))
 	router.InputCh <- msgAndRoute{msgBytes: msgBytes, fromRouteId: fromRouteId}
 }
 
+// like InjectMessage, but gives up if the router hasn't taken the message within timeout
+// (returns false, the message is dropped and counted against fromRouteId)
+func (router *WshRouter) InjectMessageWithTimeout(msgBytes []byte, fromRouteId string, timeout time.Duration) bool {
+	router.stats.recordIn(fromRouteId, len(msgBytes))
+	input := msgAndRoute{msgBytes: msgBytes, fromRouteId: fromRouteId}
+	select {
+	case router.InputCh <- input:
+		return true
+	default:
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case router.InputCh <- input:
+		return true
+	case <-timer.C:
+		router.stats.recordDropped(fromRouteId)
+		return false
+	}
+}
+
 func (router *WshRouter) registerSimpleRequest(reqId string) chan *RpcMessage {
 	router.Lock.Lock()
 	defer router.Lock.Unlock()
@@ -0,0 +1,49 @@
+package wshutil
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// routes announced through a local route go away with it, the ones announced through other routes stay
+func TestUnregisterRoute_ClearsAnnouncedRoutes(t *testing.T) {
+	router := NewWshRouter()
+	for _, routeId := range []string{"proxy1", "proxy2"} {
+		router.RegisterRoute(routeId, MakeWshRpc(nil, nil, wshrpc.RpcContext{}, nil), false)
+	}
+	announced := map[string]string{"block1": "proxy1", "block2": "proxy1", "block3": "proxy2"}
+	for announcedId, localRouteId := range announced {
+		router.handleAnnounceMessage(RpcMessage{Command: wshrpc.Command_RouteAnnounce, Source: announcedId}, msgAndRoute{fromRouteId: localRouteId})
+	}
+	router.UnregisterRoute("proxy1")
+	for announcedId, localRouteId := range announced {
+		got := router.getAnnouncedRoute(announcedId)
+		if localRouteId == "proxy1" && got != "" {
+			t.Errorf("%q is still announced through the unregistered route", announcedId)
+		}
+		if localRouteId == "proxy2" && got != "proxy2" {
+			t.Errorf("%q announced through proxy2 = %q after unregistering proxy1", announcedId, got)
+		}
+	}
+}
+
+func TestRegisterRouteExclusiveFn_OnlyForTheWinner(t *testing.T) {
+	router := NewWshRouter()
+	var registered []string
+	for _, name := range []string{"first", "second"} {
+		err := router.RegisterRouteExclusiveFn("route1", MakeWshRpc(nil, nil, wshrpc.RpcContext{}, nil), false, func() {
+			registered = append(registered, name)
+		})
+		if name == "first" && err != nil {
+			t.Fatalf("first registration: %v", err)
+		}
+		if name == "second" && !errors.Is(err, ErrRouteExists) {
+			t.Fatalf("second registration = %v, want ErrRouteExists", err)
+		}
+	}
+	if len(registered) != 1 || registered[0] != "first" {
+		t.Fatalf("onRegisterFn ran for %v, want only the first registration", registered)
+	}
+}
@@ -0,0 +1,64 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+const ResetRouteErrStr = "EC-RESET: route was reset"
+
+// recovers a wedged local route without touching any other route:
+//   - messages queued for delivery to the route (not yet written to its connection) are dropped
+//   - every in-flight request the route sent is canceled at its destination and fails with EC-RESET at the route
+//   - every in-flight request sent to the route is canceled at the route and fails with EC-RESET at its source
+//   - the route's counters are zeroed
+//
+// the route stays registered and its connection stays open unless disconnect is set, in which case the
+// connection is closed and the client has to reconnect (the normal cleanup then unregisters the route).
+func (router *WshRouter) ResetRoute(routeId string, disconnect bool) (*wshrpc.CommandResetRouteRtnData, error) {
+	rpc := router.GetRpc(routeId)
+	if rpc == nil {
+		return nil, fmt.Errorf("no local route %q", routeId)
+	}
+	rtn := &wshrpc.CommandResetRouteRtnData{RouteId: routeId}
+	proxy, isProxy := rpc.(*WshRpcProxy)
+	routeAuthToken := ""
+	if isProxy {
+		routeAuthToken = proxy.GetAuthToken()
+		rtn.DrainedMessages = proxy.DrainToRemote()
+	}
+	var routeInfos []*routeInfo
+	router.Lock.Lock()
+	for rpcId, info := range router.RpcMap {
+		if info.SourceRouteId == routeId || info.DestRouteId == routeId {
+			routeInfos = append(routeInfos, info)
+			router.removeRouteInfoLocked(rpcId)
+		}
+	}
+	router.Lock.Unlock()
+	router.updateBackpressure(routeId)
+	for _, info := range routeInfos {
+		errBytes, _ := json.Marshal(RpcMessage{ResId: info.RpcId, Error: ResetRouteErrStr})
+		if info.SourceRouteId == routeId {
+			cancelBytes, _ := json.Marshal(RpcMessage{ReqId: info.RpcId, Cancel: true, AuthToken: routeAuthToken})
+			router.sendRoutedMessage(cancelBytes, info.DestRouteId)
+			router.sendRoutedMessage(errBytes, routeId)
+			rtn.CanceledRequests++
+		} else {
+			cancelBytes, _ := json.Marshal(RpcMessage{ReqId: info.RpcId, Cancel: true})
+			router.sendRoutedMessage(cancelBytes, routeId)
+			router.sendRoutedMessage(errBytes, info.SourceRouteId)
+			rtn.FailedRequests++
+		}
+	}
+	router.stats.resetRoute(routeId)
+	if disconnect && isProxy {
+		rtn.Disconnected = proxy.CloseConn()
+	}
+	return rtn, nil
+}
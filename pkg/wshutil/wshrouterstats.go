@@ -0,0 +1,316 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// message counters for the router.  "in" is traffic received from a route, "out" is traffic delivered to a route.
+// all counters are guarded by a single lock so a reset (and a snapshot) is atomic across every counter.
+type routerStats struct {
+	Lock       *sync.Mutex
+	StatsSince time.Time
+	Totals     wshrpc.RouteStatsData
+	Routes     map[string]*wshrpc.RouteStatsData
+}
+
+func makeRouterStats() *routerStats {
+	return &routerStats{
+		Lock:       &sync.Mutex{},
+		StatsSince: time.Now(),
+		Routes:     make(map[string]*wshrpc.RouteStatsData),
+	}
+}
+
+// must hold lock
+func (rs *routerStats) getRoute_nolock(routeId string) *wshrpc.RouteStatsData {
+	stats := rs.Routes[routeId]
+	if stats == nil {
+		stats = &wshrpc.RouteStatsData{RouteId: routeId}
+		rs.Routes[routeId] = stats
+	}
+	return stats
+}
+
+func (rs *routerStats) recordIn(routeId string, numBytes int) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	if routeId != "" {
+		stats := rs.getRoute_nolock(routeId)
+		stats.MsgsIn++
+		stats.BytesIn += int64(numBytes)
+		stats.LastActivityTs = time.Now().UnixMilli()
+	}
+	rs.Totals.MsgsIn++
+	rs.Totals.BytesIn += int64(numBytes)
+}
+
+func (rs *routerStats) recordOut(routeId string, numBytes int) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	if routeId != "" {
+		stats := rs.getRoute_nolock(routeId)
+		stats.MsgsOut++
+		stats.BytesOut += int64(numBytes)
+		stats.LastActivityTs = time.Now().UnixMilli()
+	}
+	rs.Totals.MsgsOut++
+	rs.Totals.BytesOut += int64(numBytes)
+}
+
+// fromRouteId is the route the dropped message came from
+func (rs *routerStats) recordDropped(fromRouteId string) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	if fromRouteId != "" {
+		rs.getRoute_nolock(fromRouteId).Dropped++
+	}
+	rs.Totals.Dropped++
+}
+
+func (rs *routerStats) setBlockType(routeId string, blockType string) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	rs.getRoute_nolock(routeId).BlockType = blockType
+}
+
+func (rs *routerStats) setTransport(routeId string, transport string) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	rs.getRoute_nolock(routeId).Transport = transport
+}
+
+func (rs *routerStats) setQosClass(routeId string, qosClass string) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	rs.getRoute_nolock(routeId).QosClass = qosClass
+}
+
+func (rs *routerStats) setDeadman(routeId string, deadmanMs int64) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	rs.getRoute_nolock(routeId).DeadmanMs = deadmanMs
+}
+
+func (rs *routerStats) recordKeepalive(routeId string) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	stats := rs.getRoute_nolock(routeId)
+	stats.Keepalives++
+	stats.LastKeepaliveTs = time.Now().UnixMilli()
+}
+
+func (rs *routerStats) setCompression(routeId string, algo string) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	rs.getRoute_nolock(routeId).Compression = algo
+}
+
+func (rs *routerStats) recordCompression(routeId string, rawBytes int64, compressedBytes int64) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	stats := rs.getRoute_nolock(routeId)
+	stats.BytesRaw += rawBytes
+	stats.BytesCompressed += compressedBytes
+	rs.Totals.BytesRaw += rawBytes
+	rs.Totals.BytesCompressed += compressedBytes
+}
+
+// a fresh entry that keeps the route's tags (they survive resets)
+func retainRouteTags(stats *wshrpc.RouteStatsData) *wshrpc.RouteStatsData {
+	return &wshrpc.RouteStatsData{
+		RouteId:        stats.RouteId,
+		BlockType:      stats.BlockType,
+		Transport:      stats.Transport,
+		QosClass:       stats.QosClass,
+		Compression:    stats.Compression,
+		InstanceId:     stats.InstanceId,
+		PrevRouteId:    stats.PrevRouteId,
+		Reconnects:     stats.Reconnects,
+		DeadmanMs:      stats.DeadmanMs,
+		LastActivityTs: stats.LastActivityTs,
+	}
+}
+
+func setCompressionRatio(stats *wshrpc.RouteStatsData) {
+	if stats.BytesRaw > 0 {
+		stats.CompressionRatio = float64(stats.BytesCompressed) / float64(stats.BytesRaw)
+	}
+}
+
+func (rs *routerStats) setInstance(routeId string, instanceId string, prevRouteId string, reconnects int) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	stats := rs.getRoute_nolock(routeId)
+	stats.InstanceId = instanceId
+	stats.PrevRouteId = prevRouteId
+	stats.Reconnects = reconnects
+}
+
+// nil if the route has no stats
+func (rs *routerStats) getRouteCopy(routeId string) *wshrpc.RouteStatsData {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	stats := rs.Routes[routeId]
+	if stats == nil {
+		return nil
+	}
+	statsCopy := *stats
+	return &statsCopy
+}
+
+// adds a previous route's counters to the route (totals already include them)
+func (rs *routerStats) carryCounters(routeId string, prev *wshrpc.RouteStatsData) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	stats := rs.getRoute_nolock(routeId)
+	stats.MsgsIn += prev.MsgsIn
+	stats.BytesIn += prev.BytesIn
+	stats.MsgsOut += prev.MsgsOut
+	stats.BytesOut += prev.BytesOut
+	stats.Dropped += prev.Dropped
+	stats.BytesRaw += prev.BytesRaw
+	stats.BytesCompressed += prev.BytesCompressed
+}
+
+// zeros one route's counters (keeps its tags)
+func (rs *routerStats) resetRoute(routeId string) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	stats := rs.Routes[routeId]
+	if stats == nil {
+		return
+	}
+	rs.Routes[routeId] = retainRouteTags(stats)
+}
+
+func (rs *routerStats) removeRoute(routeId string) {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	delete(rs.Routes, routeId)
+}
+
+func (rs *routerStats) reset() time.Time {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	rs.StatsSince = time.Now()
+	rs.Totals = wshrpc.RouteStatsData{}
+	for routeId, stats := range rs.Routes {
+		rs.Routes[routeId] = retainRouteTags(stats)
+	}
+	return rs.StatsSince
+}
+
+func (rs *routerStats) snapshot() *wshrpc.CommandRouteStatsRtnData {
+	rs.Lock.Lock()
+	defer rs.Lock.Unlock()
+	rtn := &wshrpc.CommandRouteStatsRtnData{
+		StatsSince: rs.StatsSince.UnixMilli(),
+		Totals:     rs.Totals,
+	}
+	setCompressionRatio(&rtn.Totals)
+	for _, stats := range rs.Routes {
+		routeStats := *stats
+		setCompressionRatio(&routeStats)
+		rtn.Routes = append(rtn.Routes, routeStats)
+	}
+	sort.Slice(rtn.Routes, func(i, j int) bool {
+		return rtn.Routes[i].RouteId < rtn.Routes[j].RouteId
+	})
+	rtn.Total = len(rtn.Routes)
+	return rtn
+}
+
+// filters and pages the routes of a snapshot (totals always cover every route)
+func FilterRouteStats(stats *wshrpc.CommandRouteStatsRtnData, query wshrpc.CommandRouteStatsData) *wshrpc.CommandRouteStatsRtnData {
+	rtn := &wshrpc.CommandRouteStatsRtnData{StatsSince: stats.StatsSince, Totals: stats.Totals}
+	var matched []wshrpc.RouteStatsData
+	for _, route := range stats.Routes {
+		if query.BlockType != "" && route.BlockType != query.BlockType {
+			continue
+		}
+		if query.Transport != "" && route.Transport != query.Transport {
+			continue
+		}
+		if query.QosClass != "" && route.QosClass != query.QosClass {
+			continue
+		}
+		matched = append(matched, route)
+	}
+	rtn.Total = len(matched)
+	start := min(max(query.Offset, 0), len(matched))
+	end := len(matched)
+	if query.Limit > 0 {
+		end = min(start+query.Limit, len(matched))
+	}
+	rtn.Routes = matched[start:end]
+	return rtn
+}
+
+func (router *WshRouter) GetRouteStats() *wshrpc.CommandRouteStatsRtnData {
+	rtn := router.stats.snapshot()
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	for idx := range rtn.Routes {
+		rtn.Routes[idx].InFlight = router.inflight[rtn.Routes[idx].RouteId]
+		rtn.Totals.InFlight += rtn.Routes[idx].InFlight
+		if proxy, ok := router.RouteMap[rtn.Routes[idx].RouteId].(*WshRpcProxy); ok {
+			rtn.Routes[idx].QueueDepth = len(proxy.ToRemoteCh)
+			rtn.Routes[idx].Paused = proxy.IsPaused()
+			rtn.Totals.QueueDepth += rtn.Routes[idx].QueueDepth
+		}
+	}
+	return rtn
+}
+
+// messages waiting in each local proxy's output channel (routes that aren't proxies are skipped)
+func (router *WshRouter) GetRouteQueueDepths() map[string]int {
+	router.Lock.Lock()
+	defer router.Lock.Unlock()
+	rtn := make(map[string]int)
+	for routeId, rpc := range router.RouteMap {
+		if proxy, ok := rpc.(*WshRpcProxy); ok {
+			rtn[routeId] = len(proxy.ToRemoteCh)
+		}
+	}
+	return rtn
+}
+
+// zeros all counters, returns the new "stats since" time
+func (router *WshRouter) ResetRouteStats() time.Time {
+	return router.stats.reset()
+}
+
+// tags the route's stats with the (normalized) block type, the tag is kept across stats resets
+func (router *WshRouter) SetRouteBlockType(routeId string, blockType string) {
+	router.stats.setBlockType(routeId, wshrpc.NormalizeBlockType(blockType))
+}
+
+func (router *WshRouter) SetRouteTransport(routeId string, transport string) {
+	router.stats.setTransport(routeId, transport)
+}
+
+func (router *WshRouter) SetRouteQosClass(routeId string, qosClass string) {
+	router.stats.setQosClass(routeId, qosClass)
+}
+
+// tags the route with its negotiated compression algorithm (kept across stats resets)
+func (router *WshRouter) SetRouteCompression(routeId string, algo string) {
+	router.stats.setCompression(routeId, algo)
+}
+
+// called by a compressing transport with the payload size before and after compression
+func (router *WshRouter) RecordRouteCompression(routeId string, rawBytes int64, compressedBytes int64) {
+	router.stats.recordCompression(routeId, rawBytes, compressedBytes)
+}
+
+// true if the route is registered directly with this router (as opposed to being reachable via the upstream)
+func (router *WshRouter) IsLocalRoute(routeId string) bool {
+	return router.GetRpc(routeId) != nil
+}
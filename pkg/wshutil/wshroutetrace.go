@@ -0,0 +1,117 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// opt-in tracing of the messages passing through the router.  subscribers get the metadata only
+// (routes, command, ids, size), never the data.  a slow subscriber loses events (counted in Missed)
+// rather than slowing the router down
+
+const MaxRouteTraceSubscribers = 4
+const RouteTraceBufferSize = 256
+
+var ErrTooManyTraces = errors.New("too many route traces running")
+
+type RouteTraceSub struct {
+	Ch     chan wshrpc.RouteTraceData
+	filter wshrpc.CommandRouteTraceData
+	reqId  string // the trace's own rpc, excluded from every trace
+	missed int64  // guarded by the trace lock
+}
+
+type routeTraces struct {
+	lock  sync.Mutex
+	subs  []*RouteTraceSub
+	count atomic.Int32 // len(subs), checked without the lock on every message
+}
+
+// excludeReqId is the rpc delivering the events, its messages are never traced (by any subscriber,
+// two traces would otherwise trace each other's events forever)
+func (router *WshRouter) SubscribeTrace(filter wshrpc.CommandRouteTraceData, excludeReqId string) (*RouteTraceSub, error) {
+	traces := &router.traces
+	traces.lock.Lock()
+	defer traces.lock.Unlock()
+	if len(traces.subs) >= MaxRouteTraceSubscribers {
+		return nil, ErrTooManyTraces
+	}
+	sub := &RouteTraceSub{Ch: make(chan wshrpc.RouteTraceData, RouteTraceBufferSize), filter: filter, reqId: excludeReqId}
+	traces.subs = append(traces.subs, sub)
+	traces.count.Store(int32(len(traces.subs)))
+	return sub, nil
+}
+
+// stops delivering events, the channel is not closed (the router may be mid send)
+func (router *WshRouter) UnsubscribeTrace(sub *RouteTraceSub) {
+	traces := &router.traces
+	traces.lock.Lock()
+	defer traces.lock.Unlock()
+	for idx, other := range traces.subs {
+		if other == sub {
+			traces.subs = append(traces.subs[:idx], traces.subs[idx+1:]...)
+			break
+		}
+	}
+	traces.count.Store(int32(len(traces.subs)))
+}
+
+func (sub *RouteTraceSub) matches(event *wshrpc.RouteTraceData) bool {
+	if sub.filter.Command != "" && sub.filter.Command != event.Command {
+		return false
+	}
+	if sub.filter.RouteId != "" {
+		routeId := sub.filter.RouteId
+		return event.From == routeId || event.To == routeId || event.Source == routeId || event.Route == routeId
+	}
+	return true
+}
+
+// called from runServer for every message, toRouteId is the route it was delivered to ("" if dropped)
+func (router *WshRouter) traceMessage(msg *RpcMessage, fromRouteId string, toRouteId string, dropped string, size int) {
+	if router.traces.count.Load() == 0 {
+		return
+	}
+	event := wshrpc.RouteTraceData{
+		Ts:      time.Now().UnixMilli(),
+		From:    fromRouteId,
+		To:      toRouteId,
+		Source:  msg.Source,
+		Route:   msg.Route,
+		Command: msg.Command,
+		ReqId:   msg.ReqId,
+		ResId:   msg.ResId,
+		Cont:    msg.Cont,
+		Error:   msg.Error != "",
+		Size:    size,
+		Dropped: dropped,
+	}
+	traces := &router.traces
+	traces.lock.Lock()
+	defer traces.lock.Unlock()
+	for _, sub := range traces.subs {
+		if sub.reqId != "" && (msg.ReqId == sub.reqId || msg.ResId == sub.reqId) {
+			return
+		}
+	}
+	for _, sub := range traces.subs {
+		if !sub.matches(&event) {
+			continue
+		}
+		subEvent := event
+		subEvent.Missed = sub.missed
+		select {
+		case sub.Ch <- subEvent:
+			sub.missed = 0
+		default:
+			sub.missed++
+		}
+	}
+}
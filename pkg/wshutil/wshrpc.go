@@ -45,13 +45,21 @@ type WshRpc struct {
 	InputCh            chan []byte
 	OutputCh           chan []byte
 	RpcContext         *atomic.Pointer[wshrpc.RpcContext]
-	AuthToken          string
+	AuthToken          string     // use Get/SetAuthToken, replaced when the upstream is resumed (see ReauthUpstream)
+	authTokenLock      sync.Mutex // only guards AuthToken
 	RpcMap             map[string]*rpcData
 	ServerImpl         ServerImpl
+	ServerImplSelector func(source string) ServerImpl // optional, picks the ServerImpl per request source (nil result falls back to ServerImpl)
+	CommandLimiter     *CommandLimiter                // optional, per-command concurrency limits for incoming requests
 	EventListener      *EventListener
 	ResponseHandlerMap map[string]*RpcResponseHandler // reqId => handler
+	AckMap             map[string]chan struct{}       // ackId => waiting sender
+	ackSeen            map[string]*ackState           // ackId => state (for de-duping retransmits)
 	Debug              bool
 	DebugName          string
+	trace              atomic.Bool           // like Debug, but can be flipped at runtime (see SetTrace)
+	slowedDown         atomic.Bool           // set by a flowcontrol slowdown from the router (see wshflow.go)
+	closedErr          atomic.Pointer[error] // set by closeRpc, new requests fail with it instead of being sent
 }
 
 type wshRpcContextKey struct{}
@@ -107,18 +115,25 @@ func (w *WshRpc) RecvRpcMessage() ([]byte, bool) {
 }
 
 type RpcMessage struct {
-	Command   string `json:"command,omitempty"`
-	ReqId     string `json:"reqid,omitempty"`
-	ResId     string `json:"resid,omitempty"`
-	Timeout   int    `json:"timeout,omitempty"`
-	Route     string `json:"route,omitempty"`     // to route/forward requests to alternate servers
-	AuthToken string `json:"authtoken,omitempty"` // needed for routing unauthenticated requests (WshRpcMultiProxy)
-	Source    string `json:"source,omitempty"`    // source route id
-	Cont      bool   `json:"cont,omitempty"`      // flag if additional requests/responses are forthcoming
-	Cancel    bool   `json:"cancel,omitempty"`    // used to cancel a streaming request or response (sent from the side that is not streaming)
-	Error     string `json:"error,omitempty"`
-	DataType  string `json:"datatype,omitempty"`
-	Data      any    `json:"data,omitempty"`
+	Command    string            `json:"command,omitempty"`
+	ReqId      string            `json:"reqid,omitempty"`
+	ResId      string            `json:"resid,omitempty"`
+	Timeout    int               `json:"timeout,omitempty"`
+	Deadline   int64             `json:"deadline,omitempty"`   // optional absolute deadline (unix ms) set by the client, the earlier of timeout and deadline wins
+	Route      string            `json:"route,omitempty"`      // to route/forward requests to alternate servers
+	AuthToken  string            `json:"authtoken,omitempty"`  // needed for routing unauthenticated requests (WshRpcMultiProxy)
+	Source     string            `json:"source,omitempty"`     // source route id
+	Cont       bool              `json:"cont,omitempty"`       // flag if additional requests/responses are forthcoming
+	Seq        int64             `json:"seq,omitempty"`        // sequence number for streaming responses (starts at 1, allows receiver to detect missing chunks)
+	Cancel     bool              `json:"cancel,omitempty"`     // used to cancel a streaming request or response (sent from the side that is not streaming)
+	AckReq     bool              `json:"ackreq,omitempty"`     // sender wants an ack once the message has been processed
+	AckId      string            `json:"ackid,omitempty"`      // id of the message to be acked (set on both the original message and the ack)
+	InstanceId string            `json:"instanceid,omitempty"` // authenticate only, stable id of the logical client (kept across reconnects)
+	Deadman    int64             `json:"deadman,omitempty"`    // authenticate only, requested keepalive deadline in ms (see wshdeadman.go)
+	Headers    map[string]string `json:"headers,omitempty"`    // command packets only, request metadata (see wshheaders.go)
+	Error      string            `json:"error,omitempty"`
+	DataType   string            `json:"datatype,omitempty"`
+	Data       any               `json:"data,omitempty"`
 }
 
 func (r *RpcMessage) IsRpcRequest() bool {
@@ -151,14 +166,32 @@ func (r *RpcMessage) Validate() error {
 		if r.DataType != "" {
 			return fmt.Errorf("command packets may not have datatype set")
 		}
-		return nil
+		if r.Seq != 0 {
+			return fmt.Errorf("command packets may not have seq set")
+		}
+		if (r.AckReq || r.Command == wshrpc.Command_Ack) && r.AckId == "" {
+			return fmt.Errorf("ack packets must have ackid set")
+		}
+		if r.InstanceId != "" && r.Command != wshrpc.Command_Authenticate {
+			return fmt.Errorf("only authenticate packets may have instanceid set")
+		}
+		return ValidateHeaders(r.Headers)
+	}
+	if len(r.Headers) > 0 {
+		return fmt.Errorf("only command packets may have headers set")
+	}
+	if r.AckReq || r.AckId != "" {
+		return fmt.Errorf("only command packets may have ackreq or ackid set")
+	}
+	if r.InstanceId != "" {
+		return fmt.Errorf("only authenticate packets may have instanceid set")
 	}
 	if r.ReqId != "" {
 		if r.ResId == "" {
 			return fmt.Errorf("request packets must have resid set")
 		}
-		if r.Timeout != 0 {
-			return fmt.Errorf("non-command request packets may not have timeout set")
+		if r.Timeout != 0 || r.Deadline != 0 {
+			return fmt.Errorf("non-command request packets may not have timeout or deadline set")
 		}
 		return nil
 	}
@@ -169,8 +202,8 @@ func (r *RpcMessage) Validate() error {
 		if r.ReqId == "" {
 			return fmt.Errorf("response packets must have reqid set")
 		}
-		if r.Timeout != 0 {
-			return fmt.Errorf("response packets may not have timeout set")
+		if r.Timeout != 0 || r.Deadline != 0 {
+			return fmt.Errorf("response packets may not have timeout or deadline set")
 		}
 		return nil
 	}
@@ -211,6 +244,8 @@ func MakeWshRpc(inputCh chan []byte, outputCh chan []byte, rpcCtx wshrpc.RpcCont
 		EventListener:      MakeEventListener(),
 		ServerImpl:         serverImpl,
 		ResponseHandlerMap: make(map[string]*RpcResponseHandler),
+		AckMap:             make(map[string]chan struct{}),
+		ackSeen:            make(map[string]*ackState),
 	}
 	rtn.RpcContext.Store(&rpcCtx)
 	go rtn.runServer()
@@ -231,13 +266,47 @@ func (w *WshRpc) SetRpcContext(ctx wshrpc.RpcContext) {
 }
 
 func (w *WshRpc) SetAuthToken(token string) {
+	w.authTokenLock.Lock()
+	defer w.authTokenLock.Unlock()
 	w.AuthToken = token
 }
 
 func (w *WshRpc) GetAuthToken() string {
+	w.authTokenLock.Lock()
+	defer w.authTokenLock.Unlock()
 	return w.AuthToken
 }
 
+// returns the number of outgoing requests waiting for a response and incoming requests still being handled
+func (w *WshRpc) GetInFlightCounts() (int, int) {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	return len(w.RpcMap), len(w.ResponseHandlerMap)
+}
+
+// fails every request waiting for a response with err, and every request sent after this.  used once
+// nothing will ever read OutputCh again (the reconnecting client gave up), the caller keeps draining it
+func (w *WshRpc) closeRpc(err error) {
+	w.closedErr.CompareAndSwap(nil, &err)
+	w.Lock.Lock()
+	reqIds := make([]string, 0, len(w.RpcMap))
+	for reqId := range w.RpcMap {
+		reqIds = append(reqIds, reqId)
+	}
+	w.Lock.Unlock()
+	for _, reqId := range reqIds {
+		w.unregisterRpc(reqId, err)
+	}
+}
+
+func (w *WshRpc) getClosedErr() error {
+	errPtr := w.closedErr.Load()
+	if errPtr == nil {
+		return nil
+	}
+	return *errPtr
+}
+
 func (w *WshRpc) registerResponseHandler(reqId string, handler *RpcResponseHandler) {
 	w.Lock.Lock()
 	defer w.Lock.Unlock()
@@ -264,6 +333,13 @@ func (w *WshRpc) cancelRequest(reqId string) {
 }
 
 func (w *WshRpc) handleRequest(req *RpcMessage) {
+	if req.AckReq {
+		if !w.startAckedMessage(req) {
+			// retransmit of a message we've already seen
+			return
+		}
+		defer w.finishAckedMessage(req)
+	}
 	// events first
 	if req.Command == wshrpc.Command_EventRecv {
 		if req.Data == nil {
@@ -285,7 +361,7 @@ func (w *WshRpc) handleRequest(req *RpcMessage) {
 	if timeoutMs <= 0 {
 		timeoutMs = DefaultTimeoutMs
 	}
-	ctx, cancelFn := context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	ctx, cancelFn := makeRequestContext(timeoutMs, req.Deadline)
 	ctx = withWshRpcContext(ctx, w)
 	respHandler = &RpcResponseHandler{
 		w:               w,
@@ -296,13 +372,16 @@ func (w *WshRpc) handleRequest(req *RpcMessage) {
 		source:          req.Source,
 		done:            &atomic.Bool{},
 		canceled:        &atomic.Bool{},
+		seq:             &atomic.Int64{},
 		contextCancelFn: &atomic.Pointer[context.CancelFunc]{},
 		rpcCtx:          w.GetRpcContext(),
+		headers:         req.Headers,
 	}
 	respHandler.contextCancelFn.Store(&cancelFn)
 	respHandler.ctx = withRespHandler(ctx, respHandler)
 	w.registerResponseHandler(req.ReqId, respHandler)
 	isAsync := false
+	releaseFn := func() {}
 	defer func() {
 		panicErr := panichandler.PanicHandler("handleRequest")
 		if panicErr != nil {
@@ -311,22 +390,51 @@ func (w *WshRpc) handleRequest(req *RpcMessage) {
 		if isAsync {
 			go func() {
 				defer panichandler.PanicHandler("handleRequest:finalize")
+				defer releaseFn()
 				<-ctx.Done()
 				respHandler.Finalize()
 			}()
 		} else {
 			cancelFn()
 			respHandler.Finalize()
+			releaseFn()
 		}
 	}()
-	handlerFn := serverImplAdapter(w.ServerImpl)
+	if ctx.Err() != nil {
+		// the client already gave up (deadline passed while the request was queued/routed), skip the work
+		respHandler.SendResponseError(fmt.Errorf("EC-TIME: request deadline exceeded before it was handled"))
+		return
+	}
+	if limiter := w.getCommandLimiter(); limiter != nil {
+		// waits for a slot (bounded by the request context)
+		rel, err := limiter.Acquire(ctx, req.Command)
+		if err != nil {
+			respHandler.SendResponseError(err)
+			return
+		}
+		releaseFn = rel
+	}
+	handlerFn := serverImplAdapter(w.getServerImpl(req.Source))
 	isAsync = !handlerFn(respHandler)
 }
 
+// the client deadline is an absolute time, so it also covers time spent queued in routers/proxies.
+// it can only shorten the timeout (protects against clock skew between hosts extending requests)
+func makeRequestContext(timeoutMs int, deadlineMs int64) (context.Context, context.CancelFunc) {
+	timeoutDeadline := time.Now().Add(time.Duration(timeoutMs) * time.Millisecond)
+	if deadlineMs > 0 {
+		clientDeadline := time.UnixMilli(deadlineMs)
+		if clientDeadline.Before(timeoutDeadline) {
+			return context.WithDeadline(context.Background(), clientDeadline)
+		}
+	}
+	return context.WithDeadline(context.Background(), timeoutDeadline)
+}
+
 func (w *WshRpc) runServer() {
 	defer close(w.OutputCh)
 	for msgBytes := range w.InputCh {
-		if w.Debug {
+		if w.Debug || w.trace.Load() {
 			log.Printf("[%s] received message: %s\n", w.DebugName, string(msgBytes))
 		}
 		var msg RpcMessage
@@ -341,6 +449,14 @@ func (w *WshRpc) runServer() {
 			}
 			continue
 		}
+		if msg.Command == wshrpc.Command_Ack {
+			w.recvAck(msg.AckId)
+			continue
+		}
+		if msg.Command == wshrpc.Command_FlowControl {
+			w.recvFlowControl(msg)
+			continue
+		}
 		if msg.IsRpcRequest() {
 			go w.handleRequest(&msg)
 		} else {
@@ -369,6 +485,42 @@ func (w *WshRpc) getResponseCh(resId string) chan *RpcMessage {
 	return rd.ResCh
 }
 
+// logs every received message
+func (w *WshRpc) SetTrace(trace bool) {
+	w.trace.Store(trace)
+}
+
+func (w *WshRpc) SetCommandLimiter(limiter *CommandLimiter) {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	w.CommandLimiter = limiter
+}
+
+func (w *WshRpc) getCommandLimiter() *CommandLimiter {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	return w.CommandLimiter
+}
+
+func (w *WshRpc) getServerImpl(source string) ServerImpl {
+	w.Lock.Lock()
+	selectorFn := w.ServerImplSelector
+	serverImpl := w.ServerImpl
+	w.Lock.Unlock()
+	if selectorFn != nil {
+		if rtn := selectorFn(source); rtn != nil {
+			return rtn
+		}
+	}
+	return serverImpl
+}
+
+func (w *WshRpc) SetServerImplSelector(selectorFn func(source string) ServerImpl) {
+	w.Lock.Lock()
+	defer w.Lock.Unlock()
+	w.ServerImplSelector = selectorFn
+}
+
 func (w *WshRpc) SetServerImpl(serverImpl ServerImpl) {
 	validateServerImpl(serverImpl)
 	w.Lock.Lock()
@@ -448,6 +600,7 @@ type RpcRequestHandler struct {
 	reqId       string
 	respCh      chan *RpcMessage
 	cachedResp  *RpcMessage
+	lastSeq     int64
 }
 
 func (handler *RpcRequestHandler) Context() context.Context {
@@ -496,9 +649,20 @@ func (handler *RpcRequestHandler) NextResponse() (any, error) {
 	if resp.Error != "" {
 		return nil, errors.New(resp.Error)
 	}
+	if resp.Seq != 0 {
+		if resp.Seq != handler.lastSeq+1 {
+			return nil, fmt.Errorf("out of sequence response (expected seq %d, got %d)", handler.lastSeq+1, resp.Seq)
+		}
+		handler.lastSeq = resp.Seq
+	}
 	return resp.Data, nil
 }
 
+// returns the number of sequenced (streaming) responses received so far
+func (handler *RpcRequestHandler) ResponseSeq() int64 {
+	return handler.lastSeq
+}
+
 func (handler *RpcRequestHandler) finalize() {
 	cancelFnPtr := handler.ctxCancelFn.Load()
 	if cancelFnPtr != nil && *cancelFnPtr != nil {
@@ -519,8 +683,10 @@ type RpcResponseHandler struct {
 	command         string
 	commandData     any
 	rpcCtx          wshrpc.RpcContext
+	headers         map[string]string
 	canceled        *atomic.Bool // canceled by requestor
 	done            *atomic.Bool
+	seq             *atomic.Int64
 }
 
 func (handler *RpcResponseHandler) Context() context.Context {
@@ -539,6 +705,10 @@ func (handler *RpcResponseHandler) GetRpcContext() wshrpc.RpcContext {
 	return handler.rpcCtx
 }
 
+func (handler *RpcResponseHandler) GetReqId() string {
+	return handler.reqId
+}
+
 func (handler *RpcResponseHandler) GetSource() string {
 	return handler.source
 }
@@ -576,6 +746,11 @@ func (handler *RpcResponseHandler) SendResponse(data any, done bool) error {
 		Cont:      !done,
 		AuthToken: handler.w.GetAuthToken(),
 	}
+	seq := handler.seq.Add(1)
+	if !done || seq > 1 {
+		// only streaming responses are sequenced (single responses stay unchanged on the wire)
+		msg.Seq = seq
+	}
 	barr, err := json.Marshal(msg)
 	if err != nil {
 		return err
@@ -638,12 +813,18 @@ func (w *WshRpc) SendComplexRequest(command string, data any, opts *wshrpc.RpcOp
 	if command == "" {
 		return nil, fmt.Errorf("command cannot be empty")
 	}
+	if err := ValidateHeaders(opts.Headers); err != nil {
+		return nil, err
+	}
+	if err := w.getClosedErr(); err != nil {
+		return nil, err
+	}
 	handler := &RpcRequestHandler{
 		w:           w,
 		ctxCancelFn: &atomic.Pointer[context.CancelFunc]{},
 	}
 	var cancelFn context.CancelFunc
-	handler.ctx, cancelFn = context.WithTimeout(context.Background(), time.Duration(timeoutMs)*time.Millisecond)
+	handler.ctx, cancelFn = makeRequestContext(timeoutMs, opts.Deadline)
 	handler.ctxCancelFn.Store(&cancelFn)
 	if !opts.NoResponse {
 		handler.reqId = uuid.New().String()
@@ -653,14 +834,17 @@ func (w *WshRpc) SendComplexRequest(command string, data any, opts *wshrpc.RpcOp
 		ReqId:     handler.reqId,
 		Data:      data,
 		Timeout:   timeoutMs,
+		Deadline:  opts.Deadline,
 		Route:     opts.Route,
 		AuthToken: w.GetAuthToken(),
+		Headers:   opts.Headers,
 	}
 	barr, err := json.Marshal(req)
 	if err != nil {
 		return nil, err
 	}
 	handler.respCh = w.registerRpc(handler.ctx, handler.reqId)
+	w.waitForFlowControl(handler.ctx)
 	w.OutputCh <- barr
 	return handler, nil
 }
@@ -0,0 +1,146 @@
+package wshutil
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func makeTestResponseHandler(t *testing.T) (*RpcResponseHandler, chan []byte) {
+	t.Helper()
+	outputCh := make(chan []byte, 10)
+	w := MakeWshRpc(make(chan []byte), outputCh, wshrpc.RpcContext{}, nil)
+	handler := &RpcResponseHandler{
+		w:               w,
+		ctx:             context.Background(),
+		reqId:           "req1",
+		done:            &atomic.Bool{},
+		canceled:        &atomic.Bool{},
+		seq:             &atomic.Int64{},
+		contextCancelFn: &atomic.Pointer[context.CancelFunc]{},
+	}
+	return handler, outputCh
+}
+
+func readTestResponse(t *testing.T, outputCh chan []byte) RpcMessage {
+	t.Helper()
+	select {
+	case barr := <-outputCh:
+		var msg RpcMessage
+		if err := json.Unmarshal(barr, &msg); err != nil {
+			t.Fatalf("bad response %q: %v", barr, err)
+		}
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no response sent")
+	}
+	return RpcMessage{}
+}
+
+func TestSendResponse_SingleResponseUnsequenced(t *testing.T) {
+	handler, outputCh := makeTestResponseHandler(t)
+	if err := handler.SendResponse("data", true); err != nil {
+		t.Fatal(err)
+	}
+	msg := readTestResponse(t, outputCh)
+	if msg.Seq != 0 || msg.Cont || msg.Data != "data" {
+		t.Fatalf("single response = %+v, want no seq and no cont", msg)
+	}
+	if err := handler.SendResponse("more", true); err == nil {
+		t.Fatalf("a response after the final one was sent")
+	}
+}
+
+func TestSendResponse_StreamingNumbered(t *testing.T) {
+	handler, outputCh := makeTestResponseHandler(t)
+	for i := 0; i < 3; i++ {
+		if err := handler.SendResponse(i, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := handler.SendResponse(nil, true); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 4; i++ {
+		msg := readTestResponse(t, outputCh)
+		if msg.Seq != i {
+			t.Fatalf("response %d has seq %d", i, msg.Seq)
+		}
+		if msg.Cont != (i < 4) {
+			t.Fatalf("response %d has cont %v", i, msg.Cont)
+		}
+	}
+}
+
+// sends a request from a client rpc and returns its handler and a func to inject responses to it
+func makeTestRequest(t *testing.T) (*RpcRequestHandler, func(seq int64, data any, cont bool)) {
+	t.Helper()
+	inputCh := make(chan []byte, 10)
+	outputCh := make(chan []byte, 10)
+	w := MakeWshRpc(inputCh, outputCh, wshrpc.RpcContext{}, nil)
+	handler, err := w.SendComplexRequest("test", nil, &wshrpc.RpcOpts{Timeout: 5000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := readTestResponse(t, outputCh)
+	sendResp := func(seq int64, data any, cont bool) {
+		barr, _ := json.Marshal(RpcMessage{ResId: req.ReqId, Seq: seq, Data: data, Cont: cont})
+		inputCh <- barr
+	}
+	return handler, sendResp
+}
+
+func TestNextResponse_SingleResponse(t *testing.T) {
+	handler, sendResp := makeTestRequest(t)
+	sendResp(0, "data", false)
+	data, err := handler.NextResponse()
+	if err != nil || data != "data" {
+		t.Fatalf("NextResponse = %v, %v", data, err)
+	}
+	if handler.ResponseSeq() != 0 {
+		t.Fatalf("an unsequenced response moved the seq to %d", handler.ResponseSeq())
+	}
+	if !handler.ResponseDone() {
+		t.Fatalf("the request is not done after its single response")
+	}
+}
+
+func TestNextResponse_Streaming(t *testing.T) {
+	handler, sendResp := makeTestRequest(t)
+	sendResp(1, "a", true)
+	sendResp(2, "b", true)
+	sendResp(3, nil, false)
+	var got []any
+	for !handler.ResponseDone() {
+		data, err := handler.NextResponse()
+		if err != nil {
+			t.Fatalf("NextResponse after %v: %v", got, err)
+		}
+		got = append(got, data)
+	}
+	if len(got) != 3 || got[0] != "a" || got[1] != "b" || got[2] != nil {
+		t.Fatalf("got responses %v", got)
+	}
+	if handler.ResponseSeq() != 3 {
+		t.Fatalf("ResponseSeq = %d, want 3", handler.ResponseSeq())
+	}
+}
+
+func TestNextResponse_Gap(t *testing.T) {
+	handler, sendResp := makeTestRequest(t)
+	sendResp(1, "a", true)
+	sendResp(3, "c", true)
+	if _, err := handler.NextResponse(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := handler.NextResponse()
+	if err == nil || !strings.Contains(err.Error(), "out of sequence response (expected seq 2, got 3)") {
+		t.Fatalf("NextResponse after a gap = %v, want the out of sequence error", err)
+	}
+	handler.finalize()
+}
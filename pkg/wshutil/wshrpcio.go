@@ -5,8 +5,13 @@ package wshutil
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"log"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/util/ratelog"
 )
 
 // special I/O wrappers for wshrpc
@@ -21,34 +26,47 @@ type lineBuf struct {
 
 const maxLineLength = 128 * 1024
 
-func streamToLines_processBuf(lineBuf *lineBuf, readBuf []byte, lineFn func([]byte)) {
+func streamToLines_processBuf(lineBuf *lineBuf, readBuf []byte, lineFn func([]byte) error) error {
 	for len(readBuf) > 0 {
 		nlIdx := bytes.IndexByte(readBuf, '\n')
 		if nlIdx == -1 {
 			if lineBuf.inLongLine || len(lineBuf.buf)+len(readBuf) > maxLineLength {
 				lineBuf.buf = nil
 				lineBuf.inLongLine = true
-				return
+				return nil
 			}
 			lineBuf.buf = append(lineBuf.buf, readBuf...)
-			return
+			return nil
 		}
 		if !lineBuf.inLongLine && len(lineBuf.buf)+nlIdx <= maxLineLength {
 			line := append(lineBuf.buf, readBuf[:nlIdx]...)
-			lineFn(line)
+			if err := lineFn(line); err != nil {
+				return err
+			}
 		}
 		lineBuf.buf = nil
 		lineBuf.inLongLine = false
 		readBuf = readBuf[nlIdx+1:]
 	}
+	return nil
 }
 
 func StreamToLines(input io.Reader, lineFn func([]byte)) error {
+	return streamToLinesErr(input, func(line []byte) error {
+		lineFn(line)
+		return nil
+	})
+}
+
+// stops reading as soon as lineFn returns an error (and returns it)
+func streamToLinesErr(input io.Reader, lineFn func([]byte) error) error {
 	var lineBuf lineBuf
 	readBuf := make([]byte, 16*1024)
 	for {
 		n, err := input.Read(readBuf)
-		streamToLines_processBuf(&lineBuf, readBuf[:n], lineFn)
+		if lineErr := streamToLines_processBuf(&lineBuf, readBuf[:n], lineFn); lineErr != nil {
+			return lineErr
+		}
 		if err != nil {
 			return err
 		}
@@ -61,6 +79,58 @@ func AdaptStreamToMsgCh(input io.Reader, output chan []byte) error {
 	})
 }
 
+// what AdaptStreamToMsgChWithPolicy does when the output channel stays full (the consumer is
+// stuck or falling behind).  blocking applies backpressure to the sender, which is usually what we want.
+const (
+	FullChPolicy_Block      = "block"      // wait forever (same as AdaptStreamToMsgCh)
+	FullChPolicy_Disconnect = "disconnect" // wait up to Timeout, then stop reading (the caller closes the connection)
+	FullChPolicy_Drop       = "drop"       // wait up to Timeout, then drop the message and keep reading
+)
+
+var ErrFullChTimeout = errors.New("input channel stayed full, consumer is stuck")
+
+type FullChPolicy struct {
+	Mode    string
+	Timeout time.Duration // 0 is the same as FullChPolicy_Block
+	LogName string        // identifies the connection in logs
+}
+
+func ValidateFullChPolicy(mode string) error {
+	switch mode {
+	case FullChPolicy_Block, FullChPolicy_Disconnect, FullChPolicy_Drop:
+		return nil
+	}
+	return fmt.Errorf("invalid full channel policy %q (must be %q, %q or %q)", mode, FullChPolicy_Block, FullChPolicy_Disconnect, FullChPolicy_Drop)
+}
+
+// returns ErrFullChTimeout when the disconnect policy triggers
+func AdaptStreamToMsgChWithPolicy(input io.Reader, output chan []byte, policy FullChPolicy) error {
+	if policy.Mode == FullChPolicy_Block || policy.Mode == "" || policy.Timeout <= 0 {
+		return AdaptStreamToMsgCh(input, output)
+	}
+	return streamToLinesErr(input, func(line []byte) error {
+		select {
+		case output <- line:
+			return nil
+		default:
+		}
+		timer := time.NewTimer(policy.Timeout)
+		defer timer.Stop()
+		select {
+		case output <- line:
+			return nil
+		case <-timer.C:
+		}
+		if policy.Mode == FullChPolicy_Disconnect {
+			log.Printf("[%s] input channel full for %v, disconnecting\n", policy.LogName, policy.Timeout)
+			return ErrFullChTimeout
+		}
+		// repeats are collapsed by ratelog
+		ratelog.Printf("[%s] input channel full for %v, dropped message\n", policy.LogName, policy.Timeout)
+		return nil
+	})
+}
+
 func AdaptOutputChToStream(outputCh chan []byte, output io.Writer) error {
 	for msg := range outputCh {
 		if _, err := output.Write(msg); err != nil {
@@ -0,0 +1,158 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+// protocol commands a route always needs, whatever its scope
+var alwaysAllowedCommands = map[string]bool{
+	wshrpc.Command_Authenticate: true,
+	wshrpc.Command_Dispose:      true,
+	wshrpc.Command_Ack:          true,
+	wshrpc.Command_Keepalive:    true,
+	wshrpc.Command_FlowControl:  true,
+}
+
+const (
+	ScopePreset_ReadOnly   = "read-only"
+	ScopePreset_FileAccess = "file-access"
+	ScopePreset_Exec       = "exec"
+	ScopePreset_Forward    = "forward"
+)
+
+// named groups of commands a scope (or a policy rule) can list instead of the commands themselves.
+// "exec" is also a command, as a scope entry it allows the commands needed to drive an exec too
+var ScopePresets = map[string][]string{
+	// queries that change nothing on the host or in wave
+	ScopePreset_ReadOnly: {
+		wshrpc.Command_RemoteStreamFile, wshrpc.Command_RemoteFileInfo, wshrpc.Command_RemoteFileJoin,
+		wshrpc.Command_FileTail, wshrpc.Command_FileWatch, wshrpc.Command_FileChecksum, wshrpc.Command_DiskUsage,
+		wshrpc.Command_FileSubscribe, wshrpc.Command_FileUnsubscribe,
+		wshrpc.Command_FileTransferRead, wshrpc.Command_CheckWritable, wshrpc.Command_GetCwd,
+		wshrpc.Command_GetMeta, wshrpc.Command_BlockInfo, wshrpc.Command_ResolveIds, wshrpc.Command_WaveInfo,
+		wshrpc.Command_GetVar, wshrpc.Command_FileRead, wshrpc.Command_EventSub, wshrpc.Command_EventUnsub,
+		wshrpc.Command_EventUnsubAll, wshrpc.Command_EventReadHistory, wshrpc.Command_StreamCpuData,
+		wshrpc.Command_RemoteProcessList, wshrpc.Command_GetSysInfoInterval, wshrpc.Command_SysInfoHistory,
+		wshrpc.Command_SysInfoStream, wshrpc.Command_GetSysInfoCollectors, wshrpc.Command_ServerInfo,
+		wshrpc.Command_RouteStats, wshrpc.Command_RouteInfo, wshrpc.Command_GetServerConfig,
+		wshrpc.Command_PipelineStats, wshrpc.Command_GetToggle, wshrpc.Command_EntropyInfo, wshrpc.Command_FdInfo,
+		wshrpc.Command_OSInfo, wshrpc.Command_ProcessWatch, wshrpc.Command_ResolveHost, wshrpc.Command_CpuDetail,
+		wshrpc.Command_GetPriority, wshrpc.Command_SocketStats, wshrpc.Command_ListExec, wshrpc.Command_LocaleInfo,
+		wshrpc.Command_RuntimeVersions, wshrpc.Command_Capabilities, wshrpc.Command_MemoryPressure,
+		wshrpc.Command_TimeSyncStatus, wshrpc.Command_GpuInfo, wshrpc.Command_CgroupLimits,
+		wshrpc.Command_Batch, // every sub-request is checked on its own
+	},
+	// reading and changing files (everything in read-only that is about files)
+	ScopePreset_FileAccess: {
+		wshrpc.Command_RemoteStreamFile, wshrpc.Command_RemoteFileInfo, wshrpc.Command_RemoteFileJoin,
+		wshrpc.Command_FileTail, wshrpc.Command_FileWatch, wshrpc.Command_FileChecksum, wshrpc.Command_DiskUsage,
+		wshrpc.Command_FileSubscribe, wshrpc.Command_FileUnsubscribe,
+		wshrpc.Command_FileTransferRead, wshrpc.Command_CheckWritable, wshrpc.Command_GetCwd,
+		wshrpc.Command_RemoteFileTouch, wshrpc.Command_RemoteFileRename, wshrpc.Command_RemoteWriteFile,
+		wshrpc.Command_RemoteFileDelete, wshrpc.Command_RemoteMkdir, wshrpc.Command_FileTransferWrite,
+		wshrpc.Command_SetCwd, wshrpc.Command_Batch,
+	},
+	// running processes on the host
+	ScopePreset_Exec: {
+		wshrpc.Command_Exec, wshrpc.Command_ExecInput, wshrpc.Command_ListExec, wshrpc.Command_KillExec,
+	},
+	// port forwarding (a tunnel is as open-ended as exec, so no other preset includes it)
+	ScopePreset_Forward: {
+		wshrpc.Command_ForwardStart, wshrpc.Command_ForwardData, wshrpc.Command_ForwardStop,
+	},
+}
+
+// matches a single scope entry: a command, a preset name, "*" or a prefix pattern ("remotefile*")
+func scopeEntryMatches(entry string, command string) bool {
+	if entry == command || entry == "*" {
+		return true
+	}
+	if preset, ok := ScopePresets[entry]; ok {
+		return slices.Contains(preset, command)
+	}
+	if prefix, ok := strings.CutSuffix(entry, "*"); ok && strings.HasPrefix(command, prefix) {
+		return true
+	}
+	return false
+}
+
+// an entry must be a known command, a preset, "*" or a prefix pattern of at least one character
+func ValidateScopeEntry(entry string) error {
+	if entry == "*" || ScopePresets[entry] != nil || WshCommandDeclMap[entry] != nil {
+		return nil
+	}
+	if prefix, ok := strings.CutSuffix(entry, "*"); ok && prefix != "" && !strings.Contains(prefix, "*") {
+		return nil
+	}
+	return fmt.Errorf("invalid scope entry %q (not a command, a preset (%s) or a prefix pattern)", entry, strings.Join(slices.Sorted(maps.Keys(ScopePresets)), ", "))
+}
+
+// a token scope is a list of allowed commands, an entry ending in "*" allows every command with that
+// prefix ("remotefile*") and a preset name allows its commands (see ScopePresets).  an empty scope allows
+// everything (tokens minted before scopes existed).
+func ScopeAllowsCommand(scope []string, command string) bool {
+	if len(scope) == 0 || alwaysAllowedCommands[command] {
+		return true
+	}
+	for _, entry := range scope {
+		if scopeEntryMatches(entry, command) {
+			return true
+		}
+	}
+	return false
+}
+
+// the "scope" claim is either a list of strings or a single space/comma separated string
+func parseScopeClaim(claim any) []string {
+	var rtn []string
+	switch val := claim.(type) {
+	case string:
+		rtn = strings.FieldsFunc(val, func(r rune) bool { return r == ' ' || r == ',' })
+	case []any:
+		for _, entry := range val {
+			if str, ok := entry.(string); ok && str != "" {
+				rtn = append(rtn, str)
+			}
+		}
+	}
+	return rtn
+}
+
+// the scope of a route connected through a proxy (nil for unscoped or non-proxy routes)
+func (router *WshRouter) GetRouteScope(routeId string) []string {
+	proxy, ok := router.GetRpc(routeId).(*WshRpcProxy)
+	if !ok {
+		return nil
+	}
+	peerCtx := proxy.GetPeerRpcContext()
+	if peerCtx == nil {
+		return nil
+	}
+	return peerCtx.Scope
+}
+
+// denies commands outside the sending route's token scope or its policy rule.  returns false if the
+// message was rejected (an error response is sent back for requests)
+func (router *WshRouter) checkCommandScope(msg RpcMessage, fromRouteId string) bool {
+	err := router.CheckRouteCommand(fromRouteId, msg.Command)
+	if err == nil {
+		return true
+	}
+	if msg.ReqId != "" {
+		respBytes, _ := json.Marshal(RpcMessage{
+			ResId: msg.ReqId,
+			Error: err.Error(),
+		})
+		router.sendRoutedMessage(respBytes, fromRouteId)
+	}
+	return false
+}
@@ -0,0 +1,100 @@
+package wshutil
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/wavetermdev/waveterm/pkg/wshrpc"
+)
+
+func TestScopePresets_AllowExactlyTheirCommands(t *testing.T) {
+	for presetName, commands := range ScopePresets {
+		for _, command := range commands {
+			if WshCommandDeclMap[command] == nil {
+				t.Errorf("preset %s lists unknown command %q", presetName, command)
+			}
+		}
+		for command := range WshCommandDeclMap {
+			expected := slices.Contains(commands, command) || alwaysAllowedCommands[command]
+			if got := ScopeAllowsCommand([]string{presetName}, command); got != expected {
+				t.Errorf("scope [%s] allows %q = %v, expected %v", presetName, command, got, expected)
+			}
+		}
+	}
+}
+
+func TestScopeAllowsCommand_UnknownScope(t *testing.T) {
+	for _, entry := range []string{"bogus", "read_only", "READ-ONLY", "nosuchcommand"} {
+		if err := ValidateScopeEntry(entry); err == nil {
+			t.Errorf("expected scope entry %q to be invalid", entry)
+		}
+		for command := range WshCommandDeclMap {
+			if alwaysAllowedCommands[command] {
+				continue
+			}
+			if ScopeAllowsCommand([]string{entry}, command) {
+				t.Errorf("unknown scope %q allows %q", entry, command)
+			}
+		}
+	}
+}
+
+func TestScopeAllowsCommand_Entries(t *testing.T) {
+	tests := []struct {
+		name     string
+		scope    []string
+		command  string
+		expected bool
+	}{
+		{"empty scope allows everything", nil, wshrpc.Command_Exec, true},
+		{"star", []string{"*"}, wshrpc.Command_Exec, true},
+		{"single command", []string{wshrpc.Command_RemoteFileInfo}, wshrpc.Command_RemoteFileInfo, true},
+		{"other command", []string{wshrpc.Command_RemoteFileInfo}, wshrpc.Command_RemoteMkdir, false},
+		{"prefix", []string{"remotefile*"}, wshrpc.Command_RemoteFileRename, true},
+		{"prefix, other command", []string{"remotefile*"}, wshrpc.Command_Exec, false},
+		{"preset and command", []string{ScopePreset_ReadOnly, wshrpc.Command_RemoteMkdir}, wshrpc.Command_RemoteMkdir, true},
+		{"protocol command outside the scope", []string{wshrpc.Command_RemoteFileInfo}, wshrpc.Command_Keepalive, true},
+		{"read-only refuses forwarding", []string{ScopePreset_ReadOnly}, wshrpc.Command_ForwardStart, false},
+		{"file-access and exec refuse forwarding", []string{ScopePreset_FileAccess, ScopePreset_Exec}, wshrpc.Command_ForwardStart, false},
+		{"forward preset", []string{ScopePreset_ReadOnly, ScopePreset_Forward}, wshrpc.Command_ForwardData, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ScopeAllowsCommand(tc.scope, tc.command); got != tc.expected {
+				t.Fatalf("ScopeAllowsCommand(%v, %q) = %v, expected %v", tc.scope, tc.command, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestValidateScopeEntry_Valid(t *testing.T) {
+	for _, entry := range []string{"*", ScopePreset_ReadOnly, ScopePreset_FileAccess, ScopePreset_Exec, ScopePreset_Forward, wshrpc.Command_RemoteFileInfo, "remotefile*"} {
+		if err := ValidateScopeEntry(entry); err != nil {
+			t.Errorf("expected scope entry %q to be valid: %v", entry, err)
+		}
+	}
+	// the error lists the presets
+	if err := ValidateScopeEntry("bogus"); err == nil || !strings.Contains(err.Error(), ScopePreset_Forward) {
+		t.Errorf("invalid entry error %v does not list the %q preset", err, ScopePreset_Forward)
+	}
+}
+
+func TestParseScopeClaim(t *testing.T) {
+	tests := []struct {
+		claim    any
+		expected []string
+	}{
+		{"read-only exec", []string{"read-only", "exec"}},
+		{"read-only,exec, getmeta", []string{"read-only", "exec", "getmeta"}},
+		{[]any{"read-only", "", 5, "exec"}, []string{"read-only", "exec"}},
+		{nil, nil},
+		{42, nil},
+	}
+	for _, tc := range tests {
+		if got := parseScopeClaim(tc.claim); !reflect.DeepEqual(got, tc.expected) {
+			t.Errorf("parseScopeClaim(%v) = %v, expected %v", tc.claim, got, tc.expected)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"context"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/wavetermdev/waveterm/pkg/panichandler"
+)
+
+// graceful shutdown runs its steps in phase order (steps within a phase run in the order they were added)
+const (
+	ShutdownPhase_StopAccepting  = iota // no new connections
+	ShutdownPhase_DrainUpstream         // write out what is queued for the upstream
+	ShutdownPhase_DisposeRoutes         // tear down the local routes
+	ShutdownPhase_CloseListeners        // close the listeners
+	ShutdownPhase_Final                 // last chance to flush (logs, disposes queued by the earlier phases)
+)
+
+const DefaultShutdownGrace = 5 * time.Second
+const ShutdownProgressInterval = 1 * time.Second
+
+type shutdownStep struct {
+	Phase int
+	Name  string
+	Fn    func(ctx context.Context)
+}
+
+// makes a graceful shutdown observable.  Progress is logged every ShutdownProgressInterval while the
+// sequence runs, Pending (one line per thing that didn't drain, with the reason) once if the grace period expires
+type ShutdownReporter struct {
+	Progress func() string
+	Pending  func() []string
+}
+
+type ShutdownSequence struct {
+	Lock     *sync.Mutex
+	Steps    []shutdownStep
+	Reporter *ShutdownReporter
+	started  bool
+	curStep  string
+	doneCh   chan struct{} // closed when the run finishes
+}
+
+var defaultShutdownSequence = MakeShutdownSequence()
+
+func MakeShutdownSequence() *ShutdownSequence {
+	return &ShutdownSequence{Lock: &sync.Mutex{}, doneCh: make(chan struct{})}
+}
+
+// the step's ctx is done when the grace period runs out, steps should return by then
+func (s *ShutdownSequence) AddStep(phase int, name string, fn func(ctx context.Context)) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.Steps = append(s.Steps, shutdownStep{Phase: phase, Name: name, Fn: fn})
+}
+
+func (s *ShutdownSequence) SetReporter(reporter *ShutdownReporter) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.Reporter = reporter
+}
+
+func (s *ShutdownSequence) getProgress() (string, *ShutdownReporter) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	return s.curStep, s.Reporter
+}
+
+func (s *ShutdownSequence) setCurStep(name string) {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	s.curStep = name
+}
+
+func (s *ShutdownSequence) logProgress(startTs time.Time) {
+	stepName, reporter := s.getProgress()
+	if reporter == nil || reporter.Progress == nil {
+		return
+	}
+	log.Printf("shutdown: %v elapsed, step %q, %s\n", time.Since(startTs).Round(100*time.Millisecond), stepName, reporter.Progress())
+}
+
+func (s *ShutdownSequence) runProgressLogger(startTs time.Time, stopCh chan struct{}) {
+	defer panichandler.PanicHandler("ShutdownSequence:progress")
+	ticker := time.NewTicker(ShutdownProgressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			s.logProgress(startTs)
+		}
+	}
+}
+
+func (s *ShutdownSequence) logPending() {
+	_, reporter := s.getProgress()
+	if reporter == nil || reporter.Pending == nil {
+		return
+	}
+	pending := reporter.Pending()
+	if len(pending) == 0 {
+		return
+	}
+	log.Printf("shutdown: %d item(s) did not drain within the grace period:\n", len(pending))
+	for _, line := range pending {
+		log.Printf("  %s\n", line)
+	}
+}
+
+// runs the steps once.  the first caller runs them and gets true, concurrent (and later) callers
+// wait for that run to finish and get false.
+// the whole sequence shares the grace period, once it expires the remaining steps are skipped
+// and a step that is still running is abandoned.
+func (s *ShutdownSequence) Run(grace time.Duration) bool {
+	s.Lock.Lock()
+	if s.started {
+		s.Lock.Unlock()
+		<-s.doneCh
+		return false
+	}
+	s.started = true
+	defer close(s.doneCh)
+	steps := make([]shutdownStep, len(s.Steps))
+	copy(steps, s.Steps)
+	s.Lock.Unlock()
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Phase < steps[j].Phase
+	})
+	startTs := time.Now()
+	ctx, cancelFn := context.WithTimeout(context.Background(), grace)
+	defer cancelFn()
+	stopCh := make(chan struct{})
+	loggerDoneCh := make(chan struct{})
+	go func() {
+		defer close(loggerDoneCh)
+		s.runProgressLogger(startTs, stopCh)
+	}()
+	defer func() {
+		close(stopCh)
+		<-loggerDoneCh
+	}()
+	timedOut := false
+	for idx, step := range steps {
+		if ctx.Err() != nil {
+			log.Printf("shutdown grace period (%v) expired, skipping %d step(s)\n", grace, len(steps)-idx)
+			timedOut = true
+			break
+		}
+		s.setCurStep(step.Name)
+		doneCh := make(chan struct{})
+		go func() {
+			defer panichandler.PanicHandler("ShutdownSequence:" + step.Name)
+			defer close(doneCh)
+			step.Fn(ctx)
+		}()
+		select {
+		case <-doneCh:
+		case <-ctx.Done():
+			log.Printf("shutdown step %q did not finish within the grace period\n", step.Name)
+			timedOut = true
+		}
+	}
+	if timedOut {
+		s.logPending()
+	}
+	return true
+}
+
+func (s *ShutdownSequence) Started() bool {
+	s.Lock.Lock()
+	defer s.Lock.Unlock()
+	return s.started
+}
+
+func AddShutdownStep(phase int, name string, fn func(ctx context.Context)) {
+	defaultShutdownSequence.AddStep(phase, name, fn)
+}
+
+func SetShutdownReporter(reporter *ShutdownReporter) {
+	defaultShutdownSequence.SetReporter(reporter)
+}
+
+// every shutdown trigger should come through here.  runs the registered shutdown steps (bounded
+// by grace) and exits.  the first trigger wins (its reason and exit code are used), later triggers
+// block until the process exits so their callers can't race the cleanup (e.g. by returning from main).
+func GracefulShutdown(reason string, exitCode int, quiet bool, grace time.Duration) {
+	if !defaultShutdownSequence.Run(grace) {
+		select {}
+	}
+	doShutdown(reason, exitCode, quiet)
+}
@@ -0,0 +1,182 @@
+package wshutil
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestShutdownSequence_PhaseOrder(t *testing.T) {
+	seq := MakeShutdownSequence()
+	var lock sync.Mutex
+	var ran []string
+	record := func(name string) func(context.Context) {
+		return func(ctx context.Context) {
+			lock.Lock()
+			defer lock.Unlock()
+			ran = append(ran, name)
+		}
+	}
+	// added out of order, phases must still run in order (and steps in a phase in add order)
+	seq.AddStep(ShutdownPhase_CloseListeners, "closelisteners", record("closelisteners"))
+	seq.AddStep(ShutdownPhase_Final, "final", record("final"))
+	seq.AddStep(ShutdownPhase_DisposeRoutes, "disposeroutes", record("disposeroutes"))
+	seq.AddStep(ShutdownPhase_DrainUpstream, "drain1", record("drain1"))
+	seq.AddStep(ShutdownPhase_StopAccepting, "stopaccepting", record("stopaccepting"))
+	seq.AddStep(ShutdownPhase_DrainUpstream, "drain2", record("drain2"))
+	if !seq.Run(time.Second) {
+		t.Fatalf("expected the first run to execute")
+	}
+	expected := []string{"stopaccepting", "drain1", "drain2", "disposeroutes", "closelisteners", "final"}
+	if !reflect.DeepEqual(ran, expected) {
+		t.Fatalf("wrong step order, got %v, expected %v", ran, expected)
+	}
+}
+
+func TestShutdownSequence_RunsOnce(t *testing.T) {
+	seq := MakeShutdownSequence()
+	count := 0
+	seq.AddStep(ShutdownPhase_Final, "count", func(ctx context.Context) { count++ })
+	if !seq.Run(time.Second) {
+		t.Fatalf("expected the first run to execute")
+	}
+	if seq.Run(time.Second) {
+		t.Fatalf("expected the second run to be a no-op")
+	}
+	if count != 1 {
+		t.Fatalf("expected the step to run once, ran %d times", count)
+	}
+}
+
+func TestShutdownSequence_GraceExpires(t *testing.T) {
+	seq := MakeShutdownSequence()
+	stuckCh := make(chan struct{})
+	defer close(stuckCh)
+	lateRan := false
+	seq.AddStep(ShutdownPhase_DrainUpstream, "stuck", func(ctx context.Context) {
+		// ignores ctx, the sequence must not wait past the grace period
+		<-stuckCh
+	})
+	seq.AddStep(ShutdownPhase_CloseListeners, "late", func(ctx context.Context) { lateRan = true })
+	startTime := time.Now()
+	seq.Run(50 * time.Millisecond)
+	if elapsed := time.Since(startTime); elapsed > time.Second {
+		t.Fatalf("shutdown took %v, expected it to stop at the grace period", elapsed)
+	}
+	if lateRan {
+		t.Fatalf("expected steps after the grace period to be skipped")
+	}
+}
+
+func TestShutdownSequence_StepCtxDeadline(t *testing.T) {
+	seq := MakeShutdownSequence()
+	errCh := make(chan error, 1)
+	seq.AddStep(ShutdownPhase_DisposeRoutes, "waits", func(ctx context.Context) {
+		<-ctx.Done()
+		errCh <- ctx.Err()
+	})
+	seq.Run(20 * time.Millisecond)
+	select {
+	case err := <-errCh:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("expected the step ctx to hit its deadline, got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("step ctx was never canceled")
+	}
+}
+
+func TestShutdownSequence_ConcurrentTriggers(t *testing.T) {
+	seq := MakeShutdownSequence()
+	var lock sync.Mutex
+	count := 0
+	finished := false
+	seq.AddStep(ShutdownPhase_DisposeRoutes, "slow", func(ctx context.Context) {
+		lock.Lock()
+		count++
+		lock.Unlock()
+		time.Sleep(50 * time.Millisecond)
+		lock.Lock()
+		finished = true
+		lock.Unlock()
+	})
+	const numTriggers = 8
+	var wg sync.WaitGroup
+	results := make(chan bool, numTriggers)
+	for i := 0; i < numTriggers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ran := seq.Run(time.Second)
+			lock.Lock()
+			// every trigger, including the ones that lost, must only return once the run is complete
+			if !finished {
+				t.Errorf("Run returned (ran=%v) before the shutdown steps finished", ran)
+			}
+			lock.Unlock()
+			results <- ran
+		}()
+	}
+	wg.Wait()
+	close(results)
+	numRan := 0
+	for ran := range results {
+		if ran {
+			numRan++
+		}
+	}
+	if numRan != 1 {
+		t.Fatalf("expected exactly one trigger to run the sequence, got %d", numRan)
+	}
+	if count != 1 {
+		t.Fatalf("expected the step to run once, ran %d times", count)
+	}
+	if !seq.Started() {
+		t.Fatalf("expected the sequence to report it started")
+	}
+}
+
+func TestShutdownSequence_ReporterPendingOnTimeout(t *testing.T) {
+	seq := MakeShutdownSequence()
+	progressCalls := 0
+	pendingCalls := 0
+	seq.SetReporter(&ShutdownReporter{
+		Progress: func() string {
+			progressCalls++
+			return "draining"
+		},
+		Pending: func() []string {
+			pendingCalls++
+			return []string{"route \"a\": still open"}
+		},
+	})
+	seq.AddStep(ShutdownPhase_DisposeRoutes, "stuck", func(ctx context.Context) {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+	})
+	seq.Run(ShutdownProgressInterval + 200*time.Millisecond)
+	if progressCalls < 1 {
+		t.Fatalf("expected progress to be reported during the grace period")
+	}
+	if pendingCalls != 1 {
+		t.Fatalf("expected pending to be reported once on timeout, got %d", pendingCalls)
+	}
+}
+
+func TestShutdownSequence_ReporterNoPendingWhenDrained(t *testing.T) {
+	seq := MakeShutdownSequence()
+	pendingCalls := 0
+	seq.SetReporter(&ShutdownReporter{
+		Pending: func() []string {
+			pendingCalls++
+			return nil
+		},
+	})
+	seq.AddStep(ShutdownPhase_DisposeRoutes, "quick", func(ctx context.Context) {})
+	seq.Run(time.Second)
+	if pendingCalls != 0 {
+		t.Fatalf("expected no pending report after a clean drain, got %d", pendingCalls)
+	}
+}
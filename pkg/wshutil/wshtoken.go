@@ -0,0 +1,77 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	TokenErr_Malformed = "malformed" // not a parseable jwt
+	TokenErr_Expired   = "expired"
+	TokenErr_Signature = "signature" // signed with a different secret (or tampered with)
+	TokenErr_Claims    = "claims"    // missing or unexpected claims
+)
+
+// warn about tokens that expire within this window (clients will start failing soon)
+const TokenExpiryWarningWindow = 24 * time.Hour
+
+type TokenError struct {
+	Kind string
+	Err  error
+}
+
+func (e *TokenError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TokenError) Unwrap() error {
+	return e.Err
+}
+
+func makeTokenError(kind string, format string, args ...any) *TokenError {
+	return &TokenError{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// returns "" if err is not a TokenError
+func GetTokenErrorKind(err error) string {
+	var tokenErr *TokenError
+	if errors.As(err, &tokenErr) {
+		return tokenErr.Kind
+	}
+	return ""
+}
+
+func makeExpiredError(expTime time.Time) *TokenError {
+	return makeTokenError(TokenErr_Expired, "token expired %v ago (at %s)", time.Since(expTime).Round(time.Second), expTime.Format(time.RFC3339))
+}
+
+// checks the exp claim without verifying the signature, so an expired token is reported clearly before
+// it is sent upstream.  logs a warning if the token expires soon.  tokens without an exp claim pass.
+func CheckUnverifiedTokenExpiry(tokenStr string) error {
+	token, _, err := new(jwt.Parser).ParseUnverified(tokenStr, jwt.MapClaims{})
+	if err != nil {
+		return makeTokenError(TokenErr_Malformed, "error parsing token: %w", err)
+	}
+	expTime, err := token.Claims.GetExpirationTime()
+	if err != nil {
+		return makeTokenError(TokenErr_Claims, "invalid exp claim: %w", err)
+	}
+	if expTime == nil {
+		return nil
+	}
+	untilExp := time.Until(expTime.Time)
+	if untilExp <= 0 {
+		return makeExpiredError(expTime.Time)
+	}
+	if untilExp < TokenExpiryWarningWindow {
+		log.Printf("warning: jwt token expires in %v (at %s)\n", untilExp.Round(time.Second), expTime.Time.Format(time.RFC3339))
+	}
+	return nil
+}
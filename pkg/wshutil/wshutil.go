@@ -6,6 +6,7 @@ package wshutil
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -21,6 +22,7 @@ import (
 	"github.com/google/uuid"
 	"github.com/wavetermdev/waveterm/pkg/panichandler"
 	"github.com/wavetermdev/waveterm/pkg/util/packetparser"
+	"github.com/wavetermdev/waveterm/pkg/util/ratelog"
 	"github.com/wavetermdev/waveterm/pkg/wavebase"
 	"github.com/wavetermdev/waveterm/pkg/wshrpc"
 	"golang.org/x/term"
@@ -127,8 +129,18 @@ var origTermState *term.State
 var shutdownSignalHandlersInstalled bool
 var shutdownOnce sync.Once
 var extraShutdownFunc atomic.Pointer[func()]
+var hangupHandler atomic.Pointer[func()]
 
+// exits right away (runs once, concurrent callers block until the process exits).  if a graceful
+// shutdown is already running it wins, the caller just waits for it.
 func DoShutdown(reason string, exitCode int, quiet bool) {
+	if defaultShutdownSequence.Started() {
+		select {}
+	}
+	doShutdown(reason, exitCode, quiet)
+}
+
+func doShutdown(reason string, exitCode int, quiet bool) {
 	shutdownOnce.Do(func() {
 		defer os.Exit(exitCode)
 		RestoreTermState()
@@ -143,22 +155,47 @@ func DoShutdown(reason string, exitCode int, quiet bool) {
 }
 
 func installShutdownSignalHandlers(quiet bool) {
+	InstallShutdownSignalHandlers(quiet, DefaultShutdownGrace)
+}
+
+// SIGHUP/SIGTERM/SIGINT run a graceful shutdown (see GracefulShutdown), SIGHUP calls the hangup
+// handler instead if one is set (see SetHangupHandler)
+func InstallShutdownSignalHandlers(quiet bool, grace time.Duration) {
 	termModeLock.Lock()
 	defer termModeLock.Unlock()
 	if shutdownSignalHandlersInstalled {
 		return
 	}
+	shutdownSignalHandlersInstalled = true
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
 	go func() {
 		defer panichandler.PanicHandlerNoTelemetry("installShutdownSignalHandlers")
 		for sig := range sigCh {
-			DoShutdown(fmt.Sprintf("got signal %v", sig), 1, quiet)
+			if hangupFn := hangupHandler.Load(); sig == syscall.SIGHUP && hangupFn != nil {
+				(*hangupFn)()
+				continue
+			}
+			GracefulShutdown(fmt.Sprintf("got signal %v", sig), 1, quiet, grace)
 			break
 		}
 	}()
 }
 
+// for processes that outlive their terminal (connserver --resume-grace): SIGHUP calls fn instead of
+// shutting down, and a write to a broken stdout returns EPIPE instead of killing the process with
+// SIGPIPE.  the signal is caught rather than ignored, so child processes still get the default
+func SetHangupHandler(fn func()) {
+	hangupHandler.Store(&fn)
+	pipeCh := make(chan os.Signal, 1)
+	signal.Notify(pipeCh, syscall.SIGPIPE)
+	go func() {
+		defer panichandler.PanicHandlerNoTelemetry("SetHangupHandler:sigpipe")
+		for range pipeCh {
+		}
+	}()
+}
+
 func SetTermRawModeAndInstallShutdownHandlers(quietShutdown bool) {
 	SetTermRawMode()
 	installShutdownSignalHandlers(quietShutdown)
@@ -260,13 +297,9 @@ func tryTcpSocket(sockName string) (net.Conn, error) {
 }
 
 func SetupDomainSocketRpcClient(sockName string, serverImpl ServerImpl) (*WshRpc, error) {
-	conn, tcpErr := tryTcpSocket(sockName)
-	var unixErr error
-	if tcpErr != nil {
-		conn, unixErr = net.Dial("unix", sockName)
-	}
-	if tcpErr != nil && unixErr != nil {
-		return nil, fmt.Errorf("failed to connect to tcp or unix domain socket: tcp err:%w: unix socket err: %w", tcpErr, unixErr)
+	conn, err := MakeDomainSocketDialer(sockName)()
+	if err != nil {
+		return nil, err
 	}
 	rtn, errCh, err := SetupConnRpcClient(conn, serverImpl)
 	go func() {
@@ -292,12 +325,24 @@ func MakeClientJWTToken(rpcCtx wshrpc.RpcContext, sockName string) (string, erro
 	if rpcCtx.TabId != "" {
 		claims["tabid"] = rpcCtx.TabId
 	}
+	if rpcCtx.BlockType != "" {
+		claims["blocktype"] = rpcCtx.BlockType
+	}
+	if rpcCtx.QosClass != "" {
+		claims["qosclass"] = rpcCtx.QosClass
+	}
+	if len(rpcCtx.Scope) > 0 {
+		claims["scope"] = rpcCtx.Scope
+	}
 	if rpcCtx.Conn != "" {
 		claims["conn"] = rpcCtx.Conn
 	}
 	if rpcCtx.ClientType != "" {
 		claims["ctype"] = rpcCtx.ClientType
 	}
+	if rpcCtx.RootDir != "" {
+		claims["rootdir"] = rpcCtx.RootDir
+	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	tokenStr, err := token.SignedString([]byte(wavebase.JwtSecret))
 	if err != nil {
@@ -311,28 +356,39 @@ func ValidateAndExtractRpcContextFromToken(tokenStr string) (*wshrpc.RpcContext,
 	token, err := parser.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
 		return []byte(wavebase.JwtSecret), nil
 	})
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		// the parser validates exp itself, report it the same way as CheckUnverifiedTokenExpiry
+		err = CheckUnverifiedTokenExpiry(tokenStr)
+		if err == nil {
+			err = makeTokenError(TokenErr_Expired, "token has expired")
+		}
+		return nil, err
+	}
+	if errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		return nil, makeTokenError(TokenErr_Signature, "invalid token signature: %w", err)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error parsing token: %w", err)
+		return nil, makeTokenError(TokenErr_Malformed, "error parsing token: %w", err)
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil, fmt.Errorf("error getting claims from token")
+		return nil, makeTokenError(TokenErr_Claims, "error getting claims from token")
 	}
 	// validate "exp" claim
 	if exp, ok := claims["exp"].(float64); ok {
 		if int64(exp) < time.Now().Unix() {
-			return nil, fmt.Errorf("token has expired")
+			return nil, makeExpiredError(time.Unix(int64(exp), 0))
 		}
 	} else {
-		return nil, fmt.Errorf("exp claim is missing or invalid")
+		return nil, makeTokenError(TokenErr_Claims, "exp claim is missing or invalid")
 	}
 	// validate "iss" claim
 	if iss, ok := claims["iss"].(string); ok {
 		if iss != "waveterm" {
-			return nil, fmt.Errorf("unexpected issuer: %s", iss)
+			return nil, makeTokenError(TokenErr_Claims, "unexpected issuer: %s", iss)
 		}
 	} else {
-		return nil, fmt.Errorf("iss claim is missing or invalid")
+		return nil, makeTokenError(TokenErr_Claims, "iss claim is missing or invalid")
 	}
 	return mapClaimsToRpcContext(claims), nil
 }
@@ -349,6 +405,19 @@ func mapClaimsToRpcContext(claims jwt.MapClaims) *wshrpc.RpcContext {
 			rpcCtx.TabId = tabId
 		}
 	}
+	if claims["blocktype"] != nil {
+		if blockType, ok := claims["blocktype"].(string); ok {
+			rpcCtx.BlockType = blockType
+		}
+	}
+	if claims["qosclass"] != nil {
+		if qosClass, ok := claims["qosclass"].(string); ok {
+			rpcCtx.QosClass = qosClass
+		}
+	}
+	if claims["scope"] != nil {
+		rpcCtx.Scope = parseScopeClaim(claims["scope"])
+	}
 	if claims["conn"] != nil {
 		if conn, ok := claims["conn"].(string); ok {
 			rpcCtx.Conn = conn
@@ -359,6 +428,11 @@ func mapClaimsToRpcContext(claims jwt.MapClaims) *wshrpc.RpcContext {
 			rpcCtx.ClientType = ctype
 		}
 	}
+	if claims["rootdir"] != nil {
+		if rootDir, ok := claims["rootdir"].(string); ok {
+			rpcCtx.RootDir = rootDir
+		}
+	}
 	return rpcCtx
 }
 
@@ -370,7 +444,7 @@ func RunWshRpcOverListener(listener net.Listener) {
 			break
 		}
 		if err != nil {
-			log.Printf("error accepting connection: %v\n", err)
+			ratelog.Printf("error accepting connection: %v\n", err)
 			break
 		}
 		log.Print("got domain socket connection\n")
@@ -403,11 +477,27 @@ type WriteFlusher interface {
 	Flush() error
 }
 
-// blocking, returns if there is an error, or on EOF of input
+// blocking, returns if there is an error, or on EOF of input.  compression and flow control are
+// negotiated with the connserver (see packetparser.PacketStream), older connservers get plain packets
 func HandleStdIOClient(logName string, input io.Reader, output io.Writer) {
 	proxy := MakeRpcMultiProxy()
 	rawCh := make(chan []byte, DefaultInputChSize)
-	go packetparser.Parse(input, proxy.FromRemoteRawCh, rawCh)
+	packetStream := packetparser.MakePacketStream(output, packetparser.StreamOpts{
+		Compression: packetparser.SupportedCompression,
+		Window:      packetparser.DefaultCreditWindow,
+		OnHello: func(peer packetparser.HelloData, algo string) {
+			log.Printf("[%s] negotiated the packet stream (compression %q, window %d)\n", logName, algo, peer.Window)
+		},
+	})
+	if err := packetStream.SendHello(); err != nil {
+		ratelog.Printf("[%s] error writing to output: %v\n", logName, err)
+		return
+	}
+	go func() {
+		defer panichandler.PanicHandler("HandleStdIOClient:Parse")
+		defer packetStream.Close()
+		packetStream.Parse(input, proxy.FromRemoteRawCh, rawCh, nil)
+	}()
 	doneCh := make(chan struct{})
 	var doneOnce sync.Once
 	closeDoneCh := func() {
@@ -423,12 +513,10 @@ func HandleStdIOClient(logName string, input io.Reader, output io.Writer) {
 	go func() {
 		defer panichandler.PanicHandler("HandleStdIOClient:ToRemoteChLoop")
 		defer closeDoneCh()
-		for msg := range proxy.ToRemoteCh {
-			err := packetparser.WritePacket(output, msg)
-			if err != nil {
-				log.Printf("[%s] error writing to output: %v\n", logName, err)
-				break
-			}
+		laneWriter := MakeLaneWriter(packetStream.WritePacket, packetStream.CanSendBulk, cap(proxy.ToRemoteCh))
+		packetStream.SetCreditFn(laneWriter.Wake)
+		if err := laneWriter.Run(proxy.ToRemoteCh); err != nil {
+			ratelog.Printf("[%s] error writing to output: %v\n", logName, err)
 		}
 	}()
 	go func() {
@@ -448,7 +536,7 @@ func handleDomainSocketClient(conn net.Conn) {
 		defer panichandler.PanicHandler("handleDomainSocketClient:AdaptOutputChToStream")
 		writeErr := AdaptOutputChToStream(proxy.ToRemoteCh, conn)
 		if writeErr != nil {
-			log.Printf("error writing to domain socket: %v\n", writeErr)
+			ratelog.Printf("error writing to domain socket: %v\n", writeErr)
 		}
 	}()
 	go func() {
@@ -466,7 +554,7 @@ func handleDomainSocketClient(conn net.Conn) {
 	rpcCtx, err := proxy.HandleAuthentication()
 	if err != nil {
 		conn.Close()
-		log.Printf("error handling authentication: %v\n", err)
+		ratelog.Printf("error handling authentication: %v\n", err)
 		return
 	}
 	// now that we're authenticated, set the ctx and attach to the router
@@ -488,11 +576,11 @@ func ExtractUnverifiedRpcContext(tokenStr string) (*wshrpc.RpcContext, error) {
 	// we want to read the claims without validating the signature
 	token, _, err := new(jwt.Parser).ParseUnverified(tokenStr, jwt.MapClaims{})
 	if err != nil {
-		return nil, fmt.Errorf("error parsing token: %w", err)
+		return nil, makeTokenError(TokenErr_Malformed, "error parsing token: %w", err)
 	}
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
-		return nil, fmt.Errorf("error getting claims from token")
+		return nil, makeTokenError(TokenErr_Claims, "error getting claims from token")
 	}
 	return mapClaimsToRpcContext(claims), nil
 }